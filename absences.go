@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// absenceDateLayout is how absence and battle days are written
+	absenceDateLayout = "2006-01-02"
+	// maxAbsenceDays is the longest a single absence can be
+	maxAbsenceDays = 366
+	// maxAbsenceNoteLength is how long a note on an absence can be
+	maxAbsenceNoteLength = 256
+	// scheduleLookaheadDays is how far ahead a team's recurring battles are checked against absences
+	scheduleLookaheadDays = 28
+	// scheduleAlternativeDays is how far either side of a battle days everyone is around are looked for
+	scheduleAlternativeDays = 3
+	// maxScheduleAlternatives is the most days suggested instead of a battle key members are away for
+	maxScheduleAlternatives = 3
+	// absenceConflictDays is how many days ahead team admins are warned of key members being away for a battle
+	absenceConflictDays = 3
+	// maxScheduleNameLength is the longest recurring battle name, leaving room for the day added to its battles names
+	maxScheduleNameLength = maxBattleNameLength - len(" "+absenceDateLayout)
+)
+
+// parseBattleSchedule parses a recurring battle's cron expression, which runs at a single time of day at most once a day
+func parseBattleSchedule(Schedule string) (*cronSchedule, error) {
+	c, err := parseCron(Schedule)
+	if err != nil {
+		return nil, err
+	}
+	if bits.OnesCount64(c.minute) != 1 || bits.OnesCount64(c.hour) != 1 {
+		return nil, errors.New("recurring battles run at a single minute and hour")
+	}
+
+	return c, nil
+}
+
+// scheduleLocation gets the time zone the recurring battle runs in, UTC when it isn't known
+func scheduleLocation(bs *database.BattleSchedule) *time.Location {
+	if loc, err := time.LoadLocation(bs.Timezone); err == nil {
+		return loc
+	}
+
+	return time.UTC
+}
+
+// at gets the time the schedule, parsed by parseBattleSchedule, runs on the day of t
+func (c *cronSchedule) at(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), bits.TrailingZeros64(c.hour), bits.TrailingZeros64(c.minute), 0, 0, t.Location())
+}
+
+// ScheduleOccurrence is a day a team's recurring battle runs on
+type ScheduleOccurrence struct {
+	Date string    `json:"date"`
+	Time time.Time `json:"time"`
+	// Absent are the names of the key members away that day
+	Absent []string `json:"absent"`
+	// Alternatives are nearby week days everyone is around, when anyone is absent
+	Alternatives []string `json:"alternatives"`
+}
+
+// TeamBattleSchedule is a team's recurring battle along with its upcoming days
+type TeamBattleSchedule struct {
+	*database.BattleSchedule
+	Occurrences []*ScheduleOccurrence `json:"occurrences"`
+}
+
+// teamAvailability answers which of a recurring battle's key members are away on a day
+type teamAvailability struct {
+	// names of the key members by ID
+	names    map[string]string
+	absences []*database.WarriorAbsence
+}
+
+// newTeamAvailability gets the availability of the team's key members, every member when no key members are given
+func newTeamAvailability(Team *database.Team, KeyWarriorIDs []string, Absences []*database.WarriorAbsence) *teamAvailability {
+	key := make(map[string]bool)
+	for _, id := range KeyWarriorIDs {
+		key[id] = true
+	}
+	a := &teamAvailability{names: make(map[string]string), absences: Absences}
+	for _, tw := range Team.Warriors {
+		if len(key) == 0 || key[tw.WarriorID] {
+			a.names[tw.WarriorID] = tw.WarriorName
+		}
+	}
+
+	return a
+}
+
+// away gets the names of the key members away on the day of t
+func (a *teamAvailability) away(t time.Time) []string {
+	day := t.Format(absenceDateLayout)
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, absence := range a.absences {
+		name, ok := a.names[absence.WarriorID]
+		if !ok || seen[absence.WarriorID] {
+			continue
+		}
+		// absence days are dates, so compare them as written rather than across timezones
+		if day >= absence.StartDate.Format(absenceDateLayout) && day <= absence.EndDate.Format(absenceDateLayout) {
+			seen[absence.WarriorID] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// scheduleOccurrences lists the days the schedule runs from now over the days, with the key members away each day
+// and, when any are, the closest week days to it everyone is around that aren't already battle days or past
+func scheduleOccurrences(c *cronSchedule, Now time.Time, Days int, a *teamAvailability) []*ScheduleOccurrence {
+	today := time.Date(Now.Year(), Now.Month(), Now.Day(), 0, 0, 0, 0, Now.Location())
+	occurrences := make([]*ScheduleOccurrence, 0)
+	for i := 0; i < Days; i++ {
+		day := today.AddDate(0, 0, i)
+		if !c.runsOn(day) || c.at(day).Before(Now) {
+			continue
+		}
+		o := &ScheduleOccurrence{
+			Date:         day.Format(absenceDateLayout),
+			Time:         c.at(day),
+			Absent:       a.away(day),
+			Alternatives: make([]string, 0),
+		}
+		if len(o.Absent) > 0 {
+			for offset := 1; offset <= scheduleAlternativeDays && len(o.Alternatives) < maxScheduleAlternatives; offset++ {
+				for _, alt := range []time.Time{day.AddDate(0, 0, offset), day.AddDate(0, 0, -offset)} {
+					if len(o.Alternatives) == maxScheduleAlternatives || c.at(alt).Before(Now) || c.runsOn(alt) ||
+						alt.Weekday() == time.Saturday || alt.Weekday() == time.Sunday || len(a.away(alt)) > 0 {
+						continue
+					}
+					o.Alternatives = append(o.Alternatives, alt.Format(absenceDateLayout))
+				}
+			}
+		}
+		occurrences = append(occurrences, o)
+	}
+
+	return occurrences
+}
+
+// handleWarriorAbsencesGet gets the warrior's upcoming absences
+func (s *server) handleWarriorAbsencesGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, s.database.GetWarriorAbsences(WarriorID))
+	}
+}
+
+// handleWarriorAbsenceAdd handles the warrior marking days they'll be away
+func (s *server) handleWarriorAbsenceAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var keyVal struct {
+			StartDate string `json:"startDate"`
+			EndDate   string `json:"endDate"`
+			Note      string `json:"note"`
+		}
+		if err := json.Unmarshal(body, &keyVal); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		StartDate, startErr := time.Parse(absenceDateLayout, keyVal.StartDate)
+		EndDate, endErr := time.Parse(absenceDateLayout, keyVal.EndDate)
+		if startErr != nil || endErr != nil || EndDate.Before(StartDate) {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "absences need a start and end date as YYYY-MM-DD, the end not before the start"})
+			return
+		}
+		if EndDate.Sub(StartDate) >= maxAbsenceDays*24*time.Hour {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "absences can't be longer than a year"})
+			return
+		}
+		Note := strings.TrimSpace(keyVal.Note)
+		if len(Note) > maxAbsenceNoteLength {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "note too long"})
+			return
+		}
+
+		Absence, err := s.database.AddWarriorAbsence(WarriorID, StartDate, EndDate, Note)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Absence)
+	}
+}
+
+// handleWarriorAbsenceDelete handles the warrior removing one of their absences
+func (s *server) handleWarriorAbsenceDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if err := s.database.DeleteWarriorAbsence(WarriorID, vars["absenceId"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleTeamBattleSchedulesGet gets the team's recurring battles with their upcoming days and who's away for them
+func (s *server) handleTeamBattleSchedulesGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		Team, err := s.database.GetTeam(TeamID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		Schedules, err := s.database.GetTeamBattleSchedules(TeamID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		Absences, err := s.database.GetTeamAbsences(TeamID, now, now.AddDate(0, 0, scheduleLookaheadDays+scheduleAlternativeDays))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		TeamSchedules := make([]*TeamBattleSchedule, 0)
+		for _, bs := range Schedules {
+			ts := &TeamBattleSchedule{BattleSchedule: bs, Occurrences: make([]*ScheduleOccurrence, 0)}
+			if c, err := parseBattleSchedule(bs.Schedule); err == nil {
+				ts.Occurrences = scheduleOccurrences(c, now.In(scheduleLocation(bs)), scheduleLookaheadDays, newTeamAvailability(Team, bs.KeyWarriorIDs, Absences))
+			}
+			TeamSchedules = append(TeamSchedules, ts)
+		}
+
+		RespondWithJSON(w, http.StatusOK, TeamSchedules)
+	}
+}
+
+// handleTeamBattleScheduleCreate handles a team admin adding a recurring battle to the team
+func (s *server) handleTeamBattleScheduleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var keyVal struct {
+			Name          string   `json:"name"`
+			Schedule      string   `json:"schedule"`
+			Timezone      string   `json:"timezone"`
+			KeyWarriorIDs []string `json:"keyWarriors"`
+		}
+		if err := json.Unmarshal(body, &keyVal); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// the name becomes the name of its battles and calendar events
+		var nameErr error
+		if keyVal.Name, nameErr = cleanName("name", keyVal.Name, maxScheduleNameLength); nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+		if err := s.moderation.Check(keyVal.Name); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if _, err := parseBattleSchedule(keyVal.Schedule); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if keyVal.Timezone == "" {
+			keyVal.Timezone = "UTC"
+		}
+		if _, _, err := ValidateBattleLocale(keyVal.Timezone, ""); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		Team, err := s.database.GetTeam(TeamID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		members := make(map[string]bool)
+		for _, tw := range Team.Warriors {
+			members[tw.WarriorID] = true
+		}
+		for _, id := range keyVal.KeyWarriorIDs {
+			if !members[id] {
+				RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "key warriors must be members of the team"})
+				return
+			}
+		}
+
+		Schedule, err := s.database.CreateBattleSchedule(TeamID, keyVal.Name, strings.Join(strings.Fields(keyVal.Schedule), " "), keyVal.Timezone, keyVal.KeyWarriorIDs)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Schedule)
+	}
+}
+
+// handleTeamBattleScheduleDelete handles a team admin removing one of the team's recurring battles
+func (s *server) handleTeamBattleScheduleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := s.database.DeleteBattleSchedule(vars["teamId"], vars["scheduleId"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// sendAbsenceConflicts warns team admins of recurring battles coming up that key members will be away for,
+// each battle day is only looked at once so admins hear about it once
+func (s *server) sendAbsenceConflicts() error {
+	Schedules, err := s.database.GetBattleSchedules()
+	if err != nil {
+		return err
+	}
+
+	for _, bs := range Schedules {
+		now := time.Now().In(scheduleLocation(bs))
+		day := time.Date(now.Year(), now.Month(), now.Day()+absenceConflictDays, 0, 0, 0, 0, now.Location())
+		c, err := parseBattleSchedule(bs.Schedule)
+		if err != nil || !c.runsOn(day) {
+			continue
+		}
+		Team, err := s.database.GetTeam(bs.TeamID)
+		if err != nil {
+			continue
+		}
+		Absences, err := s.database.GetTeamAbsences(bs.TeamID, now, day.AddDate(0, 0, scheduleAlternativeDays))
+		if err != nil {
+			return err
+		}
+
+		for _, o := range scheduleOccurrences(c, now, absenceConflictDays+1, newTeamAvailability(Team, bs.KeyWarriorIDs, Absences)) {
+			if o.Date != day.Format(absenceDateLayout) || len(o.Absent) == 0 {
+				continue
+			}
+			Alternatives := make([]string, 0, len(o.Alternatives))
+			for _, alt := range o.Alternatives {
+				t, _ := time.Parse(absenceDateLayout, alt)
+				Alternatives = append(Alternatives, t.Format("Monday January 2"))
+			}
+			for _, tw := range Team.Warriors {
+				if tw.Role != "ADMIN" || tw.WarriorEmail == "" ||
+					!s.database.WarriorNotifies(tw.WarriorID, database.NotificationAbsenceConflict, database.NotificationChannelEmail) {
+					continue
+				}
+				// one admin's mailbox failing shouldn't keep the others from hearing about it
+				_ = s.email.SendAbsenceConflict(tw.WarriorName, tw.WarriorEmail, Team.TeamName, bs.Name, day.Format("Monday January 2"), o.Absent, Alternatives)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestParseBattleSchedule(t *testing.T) {
+	for spec, valid := range map[string]bool{
+		"0 10 * * 1":    true,
+		"30 9 1,15 * *": true,
+		"0 9,14 * * 1":  false,
+		"*/30 10 * * 1": false,
+		"0 10 * *":      false,
+	} {
+		if _, err := parseBattleSchedule(spec); (err == nil) != valid {
+			t.Error("Expected ", spec, " valid to be ", valid, " got ", err)
+		}
+	}
+}
+
+func TestScheduleOccurrences(t *testing.T) {
+	c, _ := parseBattleSchedule("0 10 * * 1")
+	day := func(d string) time.Time {
+		t, _ := time.Parse(absenceDateLayout, d)
+		return t
+	}
+	Team := &database.Team{Warriors: []*database.TeamWarrior{{WarriorID: "w1", WarriorName: "Thor"}, {WarriorID: "w2", WarriorName: "Loki"}}}
+	Absences := []*database.WarriorAbsence{{WarriorID: "w2", StartDate: day("2026-10-26"), EndDate: day("2026-10-27")}}
+	// a monday, before the battle
+	Now := time.Date(2026, time.October, 19, 8, 0, 0, 0, time.UTC)
+
+	occurrences := scheduleOccurrences(c, Now, 14, newTeamAvailability(Team, nil, Absences))
+	if len(occurrences) != 2 || occurrences[0].Date != "2026-10-19" || occurrences[1].Date != "2026-10-26" {
+		t.Fatal("Unexpected occurrences ", occurrences)
+	}
+	if !occurrences[0].Time.Equal(time.Date(2026, time.October, 19, 10, 0, 0, 0, time.UTC)) || len(occurrences[0].Absent) != 0 {
+		t.Error("Unexpected first occurrence ", occurrences[0])
+	}
+	if !reflect.DeepEqual(occurrences[1].Absent, []string{"Loki"}) {
+		t.Error("Expected Loki to be away got ", occurrences[1].Absent)
+	}
+	// the tuesday Loki is still away and the weekend are passed over
+	if want := []string{"2026-10-28", "2026-10-29", "2026-10-23"}; !reflect.DeepEqual(occurrences[1].Alternatives, want) {
+		t.Error("Expected alternatives ", want, " got ", occurrences[1].Alternatives)
+	}
+
+	occurrences = scheduleOccurrences(c, Now, 14, newTeamAvailability(Team, []string{"w1"}, Absences))
+	if len(occurrences[1].Absent) != 0 || len(occurrences[1].Alternatives) != 0 {
+		t.Error("Expected Loki's absence not to matter when only Thor is key got ", occurrences[1])
+	}
+
+	// the battle already started today
+	if occurrences = scheduleOccurrences(c, Now.Add(3*time.Hour), 7, newTeamAvailability(Team, nil, Absences)); len(occurrences) != 0 {
+		t.Error("Expected no occurrences after today's battle got ", occurrences)
+	}
+}
+
+// absenceMock keeps the warrior's absences
+type absenceMock struct {
+	*database.Mock
+	absences []*database.WarriorAbsence
+}
+
+func (m *absenceMock) AddWarriorAbsence(WarriorID string, StartDate time.Time, EndDate time.Time, Note string) (*database.WarriorAbsence, error) {
+	a := &database.WarriorAbsence{AbsenceID: "a1", WarriorID: WarriorID, StartDate: StartDate, EndDate: EndDate, Note: Note}
+	m.absences = append(m.absences, a)
+	return a, nil
+}
+
+func TestHandleWarriorAbsenceAdd(t *testing.T) {
+	s, db := newMockServer()
+	mock := &absenceMock{Mock: db}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/warrior/{id}/absences", s.warriorOnly(s.handleWarriorAbsenceAdd()))
+
+	tests := []struct {
+		warriorID string
+		body      string
+		status    int
+	}{
+		{"w1", `{"startDate": "2026-12-24", "endDate": "2027-01-02", "note": "Holidays"}`, http.StatusOK},
+		{"w1", `{"startDate": "2026-12-24", "endDate": "2026-12-23"}`, http.StatusBadRequest},
+		{"w1", `{"startDate": "24/12/2026", "endDate": "2027-01-02"}`, http.StatusBadRequest},
+		{"w1", `{"startDate": "2026-01-01", "endDate": "2027-06-01"}`, http.StatusBadRequest},
+		// only for themselves
+		{"a1", `{"startDate": "2026-12-24", "endDate": "2027-01-02"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/warrior/"+tt.warriorID+"/absences", strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, "key1")
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+	if len(mock.absences) != 1 || mock.absences[0].Note != "Holidays" || mock.absences[0].EndDate.Format(absenceDateLayout) != "2027-01-02" {
+		t.Error("Unexpected absences ", mock.absences)
+	}
+}
+
+// battleScheduleMock has a team of w1 and keeps the recurring battles added to it
+type battleScheduleMock struct {
+	*database.Mock
+	schedules []*database.BattleSchedule
+}
+
+func (m *battleScheduleMock) GetTeam(TeamID string) (*database.Team, error) {
+	return &database.Team{TeamID: TeamID, Warriors: []*database.TeamWarrior{{WarriorID: "w1"}}}, nil
+}
+
+func (m *battleScheduleMock) CreateBattleSchedule(TeamID string, Name string, Schedule string, Timezone string, KeyWarriorIDs []string) (*database.BattleSchedule, error) {
+	bs := &database.BattleSchedule{ScheduleID: "s1", TeamID: TeamID, Name: Name, Schedule: Schedule, Timezone: Timezone}
+	m.schedules = append(m.schedules, bs)
+	return bs, nil
+}
+
+func TestHandleTeamBattleScheduleCreateName(t *testing.T) {
+	s, db := newMockServer()
+	mock := &battleScheduleMock{Mock: db}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/team/{teamId}/schedules", s.handleTeamBattleScheduleCreate())
+
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{`"Refinement\r\nDESCRIPTION:injected"`, http.StatusOK},
+		{`"\u200b "`, http.StatusBadRequest},
+		{`"` + strings.Repeat("a", maxScheduleNameLength+1) + `"`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/team/t1/schedules", strings.NewReader(`{"name": `+tt.name+`, "schedule": "0 10 * * 1"}`))
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected the name ", tt.name, " to respond ", tt.status, " got ", w.Code, w.Body.String())
+		}
+	}
+	if len(mock.schedules) != 1 || mock.schedules[0].Name != "Refinement DESCRIPTION:injected" {
+		t.Error("Expected the name cleaned to a single line got ", mock.schedules)
+	}
+}
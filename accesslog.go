@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+var contextKeyAccessLog contextKey = "accessLog"
+
+// slowRequestAlertInterval is how often a slow route alerts the webhook at most, so a struggling instance doesn't
+// flood it with one alert per request
+const slowRequestAlertInterval = time.Minute
+
+// alertClient posts slow request alerts to the webhook the operator configured, which may well be internal
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// accessEntry is what's known about a request once it has been handled, the warrior being filled in by the
+// middleware that authenticates them further down
+type accessEntry struct {
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs int64     `json:"durationMs"`
+	WarriorID  string    `json:"warriorId,omitempty"`
+	Time       time.Time `json:"time"`
+	duration   time.Duration
+}
+
+// noteAccessWarrior records who made the request for the access log
+func noteAccessWarrior(r *http.Request, warriorID string) {
+	if entry, ok := r.Context().Value(contextKeyAccessLog).(*accessEntry); ok {
+		entry.WarriorID = warriorID
+	}
+}
+
+// slowRequestAlerts remembers when each route last alerted
+type slowRequestAlerts struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// due reports whether the route may alert again, marking it as having alerted when it may
+func (a *slowRequestAlerts) due(route string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if last, ok := a.last[route]; ok && now.Sub(last) < slowRequestAlertInterval {
+		return false
+	}
+	a.last[route] = now
+
+	return true
+}
+
+// accessLog logs every request when enabled and those taking longer than the threshold regardless, posting slow ones
+// to the webhook when set. Websockets are left out as they stay open for as long as the warrior is in the arena
+func accessLog(Enabled bool, Threshold time.Duration, WebhookURL string) mux.MiddlewareFunc {
+	alerts := &slowRequestAlerts{last: make(map[string]time.Time)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			entry := &accessEntry{Method: r.Method, Route: auditRoute(r), Path: r.URL.Path, Time: start}
+			sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(sr, r.WithContext(context.WithValue(r.Context(), contextKeyAccessLog, entry)))
+
+			entry.Status = sr.status
+			entry.duration = time.Since(start)
+			entry.DurationMs = entry.duration.Milliseconds()
+
+			slow := Threshold > 0 && entry.duration >= Threshold
+			if slow {
+				log.Printf("slow request %s %s %d %s warrior=%s\n", entry.Method, entry.Route, entry.Status, entry.duration, entry.WarriorID)
+				if WebhookURL != "" && alerts.due(entry.Method+" "+entry.Route, start) {
+					go postSlowRequest(WebhookURL, entry)
+				}
+			} else if Enabled {
+				log.Printf("%s %s %d %s warrior=%s\n", entry.Method, entry.Route, entry.Status, entry.duration, entry.WarriorID)
+			}
+		})
+	}
+}
+
+// postSlowRequest alerts the webhook of a slow request
+func postSlowRequest(WebhookURL string, entry *accessEntry) {
+	body, _ := json.Marshal(entry)
+	req, err := http.NewRequest(http.MethodPost, WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Println("invalid slow request webhook : " + err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Thunderdome-Event", "slow_request")
+
+	resp, err := alertClient.Do(req)
+	if err != nil {
+		log.Println("unable to alert slow request webhook : " + err.Error())
+		return
+	}
+	resp.Body.Close()
+}
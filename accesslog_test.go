@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAccessLogSlowRequest(t *testing.T) {
+	alerts := make(chan accessEntry, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entry accessEntry
+		_ = json.NewDecoder(r.Body).Decode(&entry)
+		alerts <- entry
+	}))
+	defer hook.Close()
+
+	router := mux.NewRouter()
+	router.Use(accessLog(false, time.Millisecond, hook.URL))
+	router.HandleFunc("/api/battle/{id}/plans", func(w http.ResponseWriter, r *http.Request) {
+		noteAccessWarrior(r, "w1")
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/battle/b1/plans", nil))
+
+	select {
+	case entry := <-alerts:
+		if entry.Route != "/api/battle/{id}/plans" || entry.WarriorID != "w1" || entry.Status != http.StatusTeapot {
+			t.Error("Expected the route template, warrior and status got ", entry)
+		}
+		if entry.DurationMs < 5 {
+			t.Error("Expected the duration got ", entry.DurationMs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the slow request to be posted to the webhook")
+	}
+
+	// the same route alerts once a minute at most
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/battle/b2/plans", nil))
+	select {
+	case entry := <-alerts:
+		t.Error("Expected the second slow request not to alert got ", entry)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// statusRecorder remembers the status code a handler responded with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	// detail is what the request changed, set by handlers whose changes need more than the route to audit
+	detail string
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// auditRoute gets the route template of the request so audits group by endpoint rather than by ID
+func auditRoute(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+
+	return r.URL.Path
+}
+
+// logAPIRequest records a request made with an API key once its handler has responded
+func (s *server) logAPIRequest(apiKey string, warriorID string, sr *statusRecorder, r *http.Request, start time.Time) {
+	s.database.LogAPIRequest(apiKey, warriorID, r.Method, auditRoute(r), sr.detail, sr.status, time.Since(start))
+}
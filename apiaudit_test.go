@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAuditRoute(t *testing.T) {
+	var route string
+	var sr *statusRecorder
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/plans", func(w http.ResponseWriter, r *http.Request) {
+		sr = &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		route = auditRoute(r)
+		sr.WriteHeader(http.StatusForbidden)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/battle/b1/plans", nil))
+
+	if route != "/api/battle/{id}/plans" {
+		t.Error("Expected the route template got ", route)
+	}
+	if sr.status != http.StatusForbidden {
+		t.Error("Expected the recorded status to be 403 got ", sr.status)
+	}
+}
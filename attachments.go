@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// maxAttachmentBytes is the largest file that can be attached to a plan
+const maxAttachmentBytes = 10 << 20
+
+// attachmentKey is where the attachment's file is kept in storage
+func attachmentKey(AttachmentID string) string {
+	return "attachments/" + AttachmentID
+}
+
+// handlePlanAttachmentUpload handles a battle warrior attaching a file to a plan, sent as the multipart form's file.
+// images are identified by their content and have their metadata stripped before they're stored
+func (s *server) handlePlanAttachmentUpload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		PlanID := vars["planId"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if !s.database.IsBattleWarrior(BattleID, warriorID) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentBytes+(1<<20))
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		Data, err := ioutil.ReadAll(io.LimitReader(file, maxAttachmentBytes+1))
+		if err != nil || len(Data) == 0 || len(Data) > maxAttachmentBytes {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "attachments can be up to 10MB"})
+			return
+		}
+
+		Name := truncateRunes(filepath.Base(filepath.Clean("/"+header.Filename)), 256)
+		if err := s.moderation.Check(Name); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		ContentType := sniffImage(Data)
+		if ContentType != "" {
+			if Data, err = sanitizeImage(Data, ContentType); err != nil {
+				RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		} else {
+			ContentType = http.DetectContentType(Data)
+		}
+
+		Attachment, err := s.database.AddPlanAttachment(BattleID, PlanID, warriorID, Name, ContentType, len(Data))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := s.storage.Put(attachmentKey(Attachment.AttachmentID), bytes.NewReader(Data), ContentType); err != nil {
+			log.Println("error storing attachment : " + err.Error() + "\n")
+			_ = s.database.DeletePlanAttachment(BattleID, Attachment.AttachmentID)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Attachment)
+	}
+}
+
+// handlePlanAttachmentsGet gets the files attached to a plan
+func (s *server) handlePlanAttachmentsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if !s.database.IsBattleWarrior(BattleID, warriorID) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, s.database.GetPlanAttachments(BattleID, vars["planId"]))
+	}
+}
+
+// setAttachmentHeaders keeps the browser from running anything in an attachment, files other than images being
+// downloaded rather than shown
+func setAttachmentHeaders(w http.ResponseWriter, ContentType string, Name string) {
+	if !isImageType(ContentType) {
+		ContentType = "application/octet-stream"
+		w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(Name))
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+}
+
+// handlePlanAttachmentGet serves an attached file
+func (s *server) handlePlanAttachmentGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if !s.database.IsBattleWarrior(BattleID, warriorID) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		Attachment, err := s.database.GetPlanAttachment(BattleID, vars["attachmentId"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		file, err := s.storage.Get(attachmentKey(Attachment.AttachmentID))
+		if err != nil {
+			log.Println("error getting attachment : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		setAttachmentHeaders(w, Attachment.ContentType, Attachment.Name)
+		w.Header().Set("Content-Length", strconv.Itoa(Attachment.Size))
+		if _, err := io.Copy(w, file); err != nil {
+			log.Println("error sending attachment : " + err.Error() + "\n")
+		}
+	}
+}
+
+// handlePlanAttachmentThumbnail serves a thumbnail of an attached image in one of the thumbnail widths
+func (s *server) handlePlanAttachmentThumbnail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Width, widthErr := strconv.Atoi(vars["width"])
+		if widthErr != nil || !thumbnailWidths[Width] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !s.database.IsBattleWarrior(BattleID, warriorID) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		Attachment, err := s.database.GetPlanAttachment(BattleID, vars["attachmentId"])
+		if err != nil || !isImageType(Attachment.ContentType) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		thumb, ContentType, err := s.media.thumbnail(attachmentKey(Attachment.AttachmentID), Attachment.ContentType, Width)
+		if err != nil {
+			log.Println("error making thumbnail : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		setAttachmentHeaders(w, ContentType, Attachment.Name)
+		w.Header().Set("Content-Length", strconv.Itoa(len(thumb)))
+		if _, err := w.Write(thumb); err != nil {
+			log.Println("unable to write image.")
+		}
+	}
+}
+
+// handlePlanAttachmentDelete handles removing an attachment, by the warrior who attached it or the battle leader
+func (s *server) handlePlanAttachmentDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Attachment, err := s.database.GetPlanAttachment(BattleID, vars["attachmentId"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if Attachment.WarriorID != warriorID && s.database.ConfirmLeader(BattleID, warriorID) != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if err := s.database.DeletePlanAttachment(BattleID, Attachment.AttachmentID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := s.media.delete(attachmentKey(Attachment.AttachmentID)); err != nil {
+			log.Println("error deleting attachment : " + err.Error() + "\n")
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// deleteRemovedAttachments deletes the files of attachments whose rows are gone, whether they were removed by a
+// warrior or along with their plan or battle, from storage
+func (s *server) deleteRemovedAttachments() error {
+	if s.media == nil {
+		return nil
+	}
+	AttachmentIDs, err := s.database.GetDeletedAttachments(500)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, AttachmentID := range AttachmentIDs {
+		if err := s.media.delete(attachmentKey(AttachmentID)); err != nil {
+			log.Println("error deleting attachment : " + err.Error() + "\n")
+			failed++
+			continue
+		}
+		if err := s.database.ClearDeletedAttachment(AttachmentID); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("unable to delete %d of %d attachments", failed, len(AttachmentIDs))
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// attachmentMock keeps attachments in memory, w1 being in battle b1
+type attachmentMock struct {
+	*database.Mock
+	attachments map[string]*database.PlanAttachment
+	deleted     []string
+}
+
+func (m *attachmentMock) IsBattleWarrior(BattleID string, WarriorID string) bool {
+	return BattleID == "b1" && WarriorID == "w1"
+}
+
+func (m *attachmentMock) AddPlanAttachment(BattleID string, PlanID string, WarriorID string, Name string, ContentType string, Size int) (*database.PlanAttachment, error) {
+	a := &database.PlanAttachment{AttachmentID: "a1", PlanID: PlanID, WarriorID: WarriorID, Name: Name, ContentType: ContentType, Size: Size}
+	m.attachments[a.AttachmentID] = a
+	return a, nil
+}
+
+func (m *attachmentMock) GetPlanAttachment(BattleID string, AttachmentID string) (*database.PlanAttachment, error) {
+	if a, ok := m.attachments[AttachmentID]; ok {
+		return a, nil
+	}
+	return nil, errors.New("attachment not found")
+}
+
+func (m *attachmentMock) GetDeletedAttachments(Limit int) ([]string, error) {
+	AttachmentIDs := make([]string, 0)
+	for _, AttachmentID := range m.deleted {
+		AttachmentIDs = append(AttachmentIDs, AttachmentID)
+	}
+	return AttachmentIDs, nil
+}
+
+func (m *attachmentMock) ClearDeletedAttachment(AttachmentID string) error {
+	for i, ID := range m.deleted {
+		if ID == AttachmentID {
+			m.deleted = append(m.deleted[:i], m.deleted[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func uploadRequest(t *testing.T, Name string, Data []byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(Data)
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/api/battle/b1/plan/p1/attachments", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set(apiKeyHeaderName, "key1")
+
+	return r
+}
+
+func TestHandlePlanAttachments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, db := newMockServer()
+	mock := &attachmentMock{Mock: db, attachments: make(map[string]*database.PlanAttachment)}
+	s.database = mock
+	if s.storage, err = storage.NewLocal(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.media = &mediaService{storage: s.storage}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/plan/{planId}/attachments", s.warriorOnly(s.handlePlanAttachmentUpload())).Methods("POST")
+	router.HandleFunc("/api/battle/{id}/attachments/{attachmentId}", s.warriorOnly(s.handlePlanAttachmentGet())).Methods("GET")
+	router.HandleFunc("/api/battle/{id}/attachments/{attachmentId}/thumbnail/{width}", s.warriorOnly(s.handlePlanAttachmentThumbnail())).Methods("GET")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, "../../mockup.jpg", testJPEG(t, 600, 300, 1)))
+	if w.Code != http.StatusOK {
+		t.Fatal("Expected the image to be attached got ", w.Code, w.Body.String())
+	}
+	a := mock.attachments["a1"]
+	if a.Name != "mockup.jpg" || a.ContentType != "image/jpeg" {
+		t.Error("Unexpected attachment ", a)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/battle/b1/attachments/a1", nil)
+	r.Header.Set(apiKeyHeaderName, "key1")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || bytes.Contains(w.Body.Bytes(), []byte("GPS")) || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Error("Expected the attachment without its EXIF got ", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/battle/b1/attachments/a1/thumbnail/64", nil)
+	r.Header.Set(apiKeyHeaderName, "key1")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Error("Expected a thumbnail got ", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// html is kept as a download rather than shown
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, "notes.html", []byte("<html><script>alert(1)</script></html>")))
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/battle/b1/attachments/a1", nil)
+	r.Header.Set(apiKeyHeaderName, "key1")
+	router.ServeHTTP(w, r)
+	if w.Header().Get("Content-Type") != "application/octet-stream" || w.Header().Get("Content-Disposition") == "" {
+		t.Error("Expected html to be downloaded got ", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestDeleteRemovedAttachments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, db := newMockServer()
+	mock := &attachmentMock{Mock: db, attachments: make(map[string]*database.PlanAttachment)}
+	s.database = mock
+	if s.storage, err = storage.NewLocal(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.media = &mediaService{storage: s.storage}
+
+	if err := s.storage.Put(attachmentKey("a1"), bytes.NewReader(testJPEG(t, 600, 300, 1)), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.media.thumbnail(attachmentKey("a1"), "image/jpeg", 64); err != nil {
+		t.Fatal(err)
+	}
+
+	// the attachment's row went along with its battle
+	mock.deleted = []string{"a1"}
+	if err := s.deleteRemovedAttachments(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.storage.Get(attachmentKey("a1")); err == nil {
+		t.Error("Expected the attachment's file to be deleted")
+	}
+	if _, err := s.storage.Get(thumbnailKey(attachmentKey("a1"), 64)); err == nil {
+		t.Error("Expected the attachment's thumbnail to be deleted")
+	}
+	if len(mock.deleted) != 0 {
+		t.Error("Expected the attachment to be cleared from the queue got ", mock.deleted)
+	}
+}
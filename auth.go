@@ -2,33 +2,22 @@ package main
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
 	ldap "github.com/go-ldap/ldap/v3"
 	"github.com/spf13/viper"
 )
 
-func (s *server) createCookie(warriorID string) *http.Cookie {
-	encoded, err := s.cookie.Encode(s.config.SecureCookieName, warriorID)
-	var NewCookie *http.Cookie
-
-	if err == nil {
-		NewCookie = &http.Cookie{
-			Name:     s.config.SecureCookieName,
-			Value:    encoded,
-			Path:     s.config.PathPrefix + "/",
-			HttpOnly: true,
-			Domain:   s.config.AppDomain,
-			MaxAge:   86400 * 30, // 30 days
-			Secure:   s.config.SecureCookieFlag,
-			SameSite: http.SameSiteStrictMode,
-		}
-	}
-	return NewCookie
+// createCookie starts a 30 day session for the warrior, getting the cookie holding it or nil when it couldn't be started
+func (s *server) createCookie(r *http.Request, warriorID string) *http.Cookie {
+	return s.sessionCookie(r, warriorID, 30)
 }
 
 func (s *server) authWarriorDatabase(warriorEmail string, warriorPassword string) (*database.Warrior, error) {
@@ -37,6 +26,8 @@ func (s *server) authWarriorDatabase(warriorEmail string, warriorPassword string
 		log.Println("Failed authenticating user", warriorEmail)
 	} else if authedWarrior == nil {
 		log.Println("Unknown user", warriorEmail)
+	} else {
+		s.database.RecordWarriorLogin(authedWarrior.WarriorID)
 	}
 	return authedWarrior, err
 }
@@ -94,21 +85,83 @@ func (s *server) authAndCreateWarriorLdap(warriorUsername string, warriorPasswor
 		return authedWarrior, err
 	}
 
-	authedWarrior, err = s.database.GetWarriorByEmail(useremail)
+	return s.recruitWarrior(usercn, useremail)
+}
+
+// recruitWarrior gets the warrior authenticated by an external identity provider by email, automatically adding
+// them as a verified warrior named after their email when they have no name and don't exist yet, and records
+// their login
+func (s *server) recruitWarrior(WarriorName string, WarriorEmail string) (*database.Warrior, error) {
+	authedWarrior, _ := s.database.GetWarriorByEmail(WarriorEmail)
 	if authedWarrior == nil {
-		log.Println("Warrior", useremail, "does not exist in database, auto-recruit")
-		newWarrior, verifyID, err := s.database.CreateWarriorCorporal(usercn, useremail, "", "")
+		// the identity provider's names aren't held to ours, it's better to cut them than refuse the warrior
+		WarriorName = truncateRunes(sanitizeName(WarriorName), maxWarriorNameLength)
+		if WarriorName == "" {
+			WarriorName = strings.SplitN(WarriorEmail, "@", 2)[0]
+		}
+		log.Println("Warrior", WarriorEmail, "does not exist in database, auto-recruit")
+		if err := s.licenseAllows(database.LicenseWarriors); err != nil {
+			return nil, err
+		}
+		newWarrior, verifyID, err := s.database.CreateWarriorCorporal(WarriorName, WarriorEmail, "", "")
 		if err != nil {
 			log.Println("Failed auto-creating new warrior", err)
-			return authedWarrior, err
+			return nil, err
 		}
 		err = s.database.VerifyWarriorAccount(verifyID)
 		if err != nil {
 			log.Println("Failed verifying new warrior", err)
-			return authedWarrior, err
+			return nil, err
 		}
 		authedWarrior = newWarrior
 	}
+	s.database.RecordWarriorLogin(authedWarrior.WarriorID)
 
 	return authedWarrior, nil
 }
+
+// frontendWarriorCookie sets the cookie the UI keeps the signed in warrior in, as the UI does after a login
+// request. Its value is percent encoded like encodeURIComponent does
+func (s *server) frontendWarriorCookie(w http.ResponseWriter, warrior *database.Warrior) {
+	value, err := json.Marshal(map[string]interface{}{
+		"id":                   warrior.WarriorID,
+		"name":                 warrior.WarriorName,
+		"email":                warrior.WarriorEmail,
+		"rank":                 warrior.WarriorRank,
+		"notificationsEnabled": warrior.NotificationsEnabled,
+	})
+	if err != nil {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.config.FrontendCookieName,
+		Value:    strings.ReplaceAll(url.QueryEscape(string(value)), "+", "%20"),
+		Path:     s.config.PathPrefix + "/",
+		MaxAge:   86400 * 365,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// redirectLoggedIn logs in the warrior signed in with an external identity provider outside the UI, sending them on
+// to the battle they were on their way to or their battles
+func (s *server) redirectLoggedIn(w http.ResponseWriter, r *http.Request, warrior *database.Warrior, BattleID string) {
+	cookie := s.createCookie(r, warrior.WarriorID)
+	if cookie == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, cookie)
+	s.frontendWarriorCookie(w, warrior)
+
+	// the UI's battle routes, named games with friendly verbs
+	battles, battle := "/battles", "/battle/"
+	if viper.GetBool("config.friendly_ui_verbs") {
+		battles, battle = "/games", "/game/"
+	}
+	target := s.config.PathPrefix + battles
+	if BattleID != "" {
+		target = s.config.PathPrefix + battle + url.PathEscape(BattleID)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
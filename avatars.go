@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxAvatarBytes is the largest avatar the template service can respond with
+	maxAvatarBytes = 256 << 10
+	// maxAvatarCacheEntries keeps the avatars cached in memory bounded
+	maxAvatarCacheEntries = 1000
+	// failures are cached briefly so warriors without an avatar don't hit the service on every page
+	maxAvatarErrorTTL = time.Minute
+)
+
+// isAvatarTemplate checks whether the avatar service is a URL template rather than one of the named services
+func isAvatarTemplate(AvatarService string) bool {
+	return strings.HasPrefix(AvatarService, "https://") || strings.HasPrefix(AvatarService, "http://")
+}
+
+// avatarPlaceholders are filled in from the warrior when a template uses them
+var avatarPlaceholders = []string{"{name}", "{email}", "{email_md5}", "{email_sha256}"}
+
+// cachedAvatar is an avatar fetched from the template service
+type cachedAvatar struct {
+	image       []byte
+	contentType string
+	err         error
+	expires     time.Time
+}
+
+// avatarProxy fetches warrior avatars from a URL template, e.g. DiceBear or a company directory, caching them
+// so the service sees a request per warrior and size per TTL and browsers never talk to it directly
+type avatarProxy struct {
+	template string
+	ttl      time.Duration
+	http     *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*cachedAvatar
+}
+
+// newAvatarProxy creates a proxy for the template keeping avatars for TTL
+func newAvatarProxy(Template string, TTL time.Duration) *avatarProxy {
+	return &avatarProxy{
+		template: Template,
+		ttl:      TTL,
+		http:     &http.Client{Timeout: 10 * time.Second},
+		cache:    make(map[string]*cachedAvatar),
+	}
+}
+
+// needsWarrior checks whether the template uses any of the warrior's details beyond their id
+func (a *avatarProxy) needsWarrior() bool {
+	for _, placeholder := range avatarPlaceholders {
+		if strings.Contains(a.template, placeholder) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// avatarURL fills in the template's placeholders, escaping each value
+func (a *avatarProxy) avatarURL(WarriorID string, Width int, Name string, Email string) string {
+	Email = strings.ToLower(strings.TrimSpace(Email))
+	md5Sum := md5.Sum([]byte(Email))
+	sha256Sum := sha256.Sum256([]byte(Email))
+
+	return strings.NewReplacer(
+		"{id}", url.PathEscape(WarriorID),
+		"{width}", strconv.Itoa(Width),
+		"{name}", url.QueryEscape(Name),
+		"{email}", url.QueryEscape(Email),
+		"{email_md5}", hex.EncodeToString(md5Sum[:]),
+		"{email_sha256}", hex.EncodeToString(sha256Sum[:]),
+	).Replace(a.template)
+}
+
+// get gets the avatar at the URL, from the cache when it was fetched within the TTL
+func (a *avatarProxy) get(URL string) ([]byte, string, error) {
+	a.mu.Lock()
+	cached, ok := a.cache[URL]
+	a.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.image, cached.contentType, cached.err
+	}
+
+	image, contentType, err := a.fetch(URL)
+	if err != nil {
+		log.Println("unable to get avatar from template : " + err.Error() + "\n")
+	}
+
+	ttl := a.ttl
+	if err != nil && ttl > maxAvatarErrorTTL {
+		ttl = maxAvatarErrorTTL
+	}
+	a.mu.Lock()
+	if len(a.cache) >= maxAvatarCacheEntries {
+		a.evict()
+	}
+	a.cache[URL] = &cachedAvatar{image: image, contentType: contentType, err: err, expires: time.Now().Add(ttl)}
+	a.mu.Unlock()
+
+	return image, contentType, err
+}
+
+// evict drops the expired avatars, or all of them when none have expired, expects the lock held
+func (a *avatarProxy) evict() {
+	now := time.Now()
+	for URL, cached := range a.cache {
+		if now.After(cached.expires) {
+			delete(a.cache, URL)
+		}
+	}
+	if len(a.cache) >= maxAvatarCacheEntries {
+		a.cache = make(map[string]*cachedAvatar)
+	}
+}
+
+// fetch requests the avatar from the template service, refusing anything that isn't an image
+func (a *avatarProxy) fetch(URL string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", "Thunderdome avatars")
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("avatar service responded %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", errors.New("avatar service responded with " + mediaType)
+	}
+
+	image, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAvatarBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(image) > maxAvatarBytes {
+		return nil, "", errors.New("avatar too large")
+	}
+
+	return image, mediaType, nil
+}
+
+// avatarProxyWidths are the sizes avatars are fetched from the avatar service in, keeping how many are cached per
+// warrior bounded
+var avatarProxyWidths = map[int]bool{24: true, 32: true, 48: true, 64: true, 96: true, 128: true, 256: true, 512: true}
+
+// handleWarriorAvatarProxy serves the warrior's avatar from the avatar template, falling back to the generated
+// goadorable avatar when the service has none for them, like guests without an email for a directory
+func (s *server) handleWarriorAvatarProxy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Width, widthErr := strconv.Atoi(vars["width"])
+		if widthErr != nil || !avatarProxyWidths[Width] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		WarriorID := vars["id"]
+		if _, err := uuid.Parse(WarriorID); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var Name, Email string
+		if s.avatars.needsWarrior() {
+			warrior, err := s.database.GetWarrior(WarriorID)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			Name, Email = warrior.WarriorName, warrior.WarriorEmail
+		}
+
+		image, contentType, err := s.avatars.get(s.avatars.avatarURL(WarriorID, Width, Name, Email))
+		if err != nil {
+			image, err = renderAvatar("goadorable", WarriorID, "", Width)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			contentType = "image/png"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(s.avatars.ttl.Seconds())))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// svg avatars, like DiceBear's, can carry script that mustn't run when opened directly
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+		if _, err := w.Write(image); err != nil {
+			log.Println("unable to write image.")
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAvatarURL(t *testing.T) {
+	a := newAvatarProxy("https://directory.example.com/photo?user={email}&size={width}&h={email_md5}", time.Hour)
+	if !a.needsWarrior() {
+		t.Error("Expected a template with the email to need the warrior")
+	}
+	got := a.avatarURL("w1", 48, "Thor", " Thor+Odinson@Example.com")
+	want := "https://directory.example.com/photo?user=thor%2Bodinson%40example.com&size=48&h=31df33bd02263ee47af98a26dc31c658"
+	if got != want {
+		t.Error("Unexpected avatar url ", got)
+	}
+
+	if newAvatarProxy("https://avatars.dicebear.com/api/bottts/{id}.svg?w={width}", time.Hour).needsWarrior() {
+		t.Error("Expected a template with only the id not to need the warrior")
+	}
+	for service, want := range map[string]bool{"https://avatars.example.com/{id}": true, "goadorable": false, "dicebear": false} {
+		if isAvatarTemplate(service) != want {
+			t.Error("Expected ", service, " to be a template ", want)
+		}
+	}
+}
+
+func TestHandleWarriorAvatarProxy(t *testing.T) {
+	const warriorID = "11111111-1111-1111-1111-111111111111"
+	const missingID = "22222222-2222-2222-2222-222222222222"
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/"+missingID+".png" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte("<svg>" + r.URL.Path + "</svg>"))
+	}))
+	defer srv.Close()
+
+	s, _ := newMockServer()
+	s.avatars = newAvatarProxy(srv.URL+"/{id}.png?w={width}", time.Hour)
+	router := mux.NewRouter()
+	router.HandleFunc("/avatar/{width}/{id}", s.handleWarriorAvatarProxy())
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/avatar/48/"+warriorID, nil))
+		if w.Code != http.StatusOK || w.Body.String() != "<svg>/"+warriorID+".png</svg>" || w.Header().Get("Content-Type") != "image/svg+xml" {
+			t.Error("Unexpected avatar ", w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Header().Get("Content-Security-Policy"), "sandbox") {
+			t.Error("Expected the avatar to be sandboxed")
+		}
+	}
+	if requests != 1 {
+		t.Error("Expected the avatar to be cached got ", requests, " requests")
+	}
+
+	// the service not having one falls back to the generated avatar
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/avatar/48/"+missingID, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Error("Expected the generated avatar got ", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	for _, path := range []string{"/avatar/4096/" + warriorID, "/avatar/49/" + warriorID} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Error("Expected a width that isn't allowed to be refused got ", w.Code)
+		}
+	}
+
+	requests = 0
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/avatar/48/w1", nil))
+	if w.Code != http.StatusNotFound || requests != 0 {
+		t.Error("Expected an id that isn't a warrior's to be refused got ", w.Code)
+	}
+}
+
+func TestAvatarProxyRateLimited(t *testing.T) {
+	s, _ := newMockServer()
+	s.avatars = newAvatarProxy("https://avatars.example.com/{id}.png", time.Hour)
+	s.avatarThrottle = &loginThrottle{attempts: make(map[string]*throttleWindow), window: time.Minute, limit: 1}
+	router := mux.NewRouter()
+	router.HandleFunc("/avatar/{width}/{id}", rateLimited(s.avatarThrottle, s.handleWarriorAvatarProxy()))
+
+	codes := make([]int, 0)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/avatar/48/w1", nil))
+		codes = append(codes, w.Code)
+	}
+	if codes[0] == http.StatusTooManyRequests || codes[1] != http.StatusTooManyRequests {
+		t.Error("Expected the second avatar to be rate limited got ", codes)
+	}
+}
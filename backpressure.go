@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// closeTooSlow closes connections whose client doesn't read its messages as fast as they're sent
+	closeTooSlow = 4003
+	// closeRateLimited closes connections of a warrior sending more messages than allowed
+	closeRateLimited = 4005
+)
+
+// socketLimits keep a single client from exhausting the server's memory or flooding its arena
+type socketLimits struct {
+	// MaxMessageSize is the most bytes a message read from a client can have
+	MaxMessageSize int64
+	// SendQueueSize is the most bytes queued for a connection before it's disconnected as too slow
+	SendQueueSize int64
+	// Rate is how many messages a second a warrior can send across their connections once Burst is used up
+	Rate  float64
+	Burst float64
+}
+
+// defaultSocketLimits are the limits until they're configured
+var defaultSocketLimits = socketLimits{
+	MaxMessageSize: 1024 * 1024,
+	SendQueueSize:  4 * 1024 * 1024,
+	Rate:           20,
+	Burst:          60,
+}
+
+// enqueue queues the data to be written to the connection, false when the client isn't keeping up and the queue
+// is full, by count or size
+func (h *hub) enqueue(c *connection, data []byte) bool {
+	size := int64(len(data))
+	if atomic.AddInt64(&c.queued, size) > h.limits.SendQueueSize {
+		atomic.AddInt64(&c.queued, -size)
+		return false
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		atomic.AddInt64(&c.queued, -size)
+		return false
+	}
+}
+
+// dequeued frees the data written to the connection from its queue
+func (c *connection) dequeued(data []byte) {
+	atomic.AddInt64(&c.queued, -int64(len(data)))
+}
+
+// drop closes a connection whose client isn't keeping up, telling it why once what's queued is written
+func (h *hub) drop(c *connection) {
+	c.closeMessage = websocket.FormatCloseMessage(closeTooSlow, "too slow")
+	close(c.send)
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// warriorRates limits how many messages each warrior sends with a token bucket per warrior, shared by all their
+// connections so opening more tabs doesn't raise the limit
+type warriorRates struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	pruned  time.Time
+}
+
+// allow reports whether the warrior can send another message, using up one of their tokens
+func (r *warriorRates) allow(WarriorID string, limits socketLimits, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// warriors whose bucket filled back up are as good as new, there's no need to keep them
+	if now.Sub(r.pruned) > time.Minute {
+		for id, b := range r.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*limits.Rate >= limits.Burst {
+				delete(r.buckets, id)
+			}
+		}
+		r.pruned = now
+	}
+
+	b, ok := r.buckets[WarriorID]
+	if !ok {
+		b = &rateBucket{tokens: limits.Burst, last: now}
+		r.buckets[WarriorID] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * limits.Rate
+	if b.tokens > limits.Burst {
+		b.tokens = limits.Burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// inspectRequest asks the hub for its view of an arena
+type inspectRequest struct {
+	arena string
+	reply chan *arenaState
+}
+
+// arenaState is what the hub holds in memory for an arena
+type arenaState struct {
+	Connections []connectionState `json:"connections"`
+	// Seq is the sequence number of the last event broadcast to the arena
+	Seq uint64 `json:"seq"`
+	// Parent is the arena of the battle a breakout was split from
+	Parent string `json:"parent,omitempty"`
+	// Plans are the plans as last broadcast, only kept while a snapshot connection is in the arena
+	Plans    map[string]json.RawMessage `json:"plans"`
+	ReadOnly bool                       `json:"readOnly"`
+}
+
+// connectionState is a connection registered in an arena
+type connectionState struct {
+	WarriorID string `json:"warriorId"`
+	Bot       bool   `json:"bot"`
+	Version   int    `json:"version"`
+	Snapshot  bool   `json:"snapshot"`
+	// Queued is how many bytes of events are waiting to be written to the connection
+	Queued int64 `json:"queued"`
+}
+
+// inspect gets the hub's view of the arena
+func (h *hub) inspect(arena string) *arenaState {
+	req := inspectRequest{arena, make(chan *arenaState, 1)}
+	h.inspections <- req
+
+	return <-req.reply
+}
+
+// arenaState copies the hub's view of the arena, it's only called from run so it can't change underneath
+func (h *hub) arenaState(arena string) *arenaState {
+	state := &arenaState{
+		Connections: make([]connectionState, 0, len(h.arenas[arena])),
+		Seq:         h.seq[arena],
+		Parent:      h.parents[arena],
+		ReadOnly:    h.breakers.isOpen(arena),
+	}
+	for c := range h.arenas[arena] {
+		state.Connections = append(state.Connections, connectionState{
+			WarriorID: c.warriorID,
+			Bot:       c.bot,
+			Version:   c.version,
+			Snapshot:  c.snapshot,
+			Queued:    atomic.LoadInt64(&c.queued),
+		})
+	}
+	sort.Slice(state.Connections, func(i, j int) bool {
+		return state.Connections[i].WarriorID < state.Connections[j].WarriorID
+	})
+	if known, ok := h.plans[arena]; ok {
+		state.Plans = make(map[string]json.RawMessage, len(known))
+		for PlanID, plan := range known {
+			state.Plans[PlanID] = json.RawMessage(plan)
+		}
+	}
+
+	return state
+}
+
+// stateDiff is somewhere the hub and the database disagree about a battle, a missing side is null
+type stateDiff struct {
+	// Kind is warrior or plan
+	Kind     string      `json:"kind"`
+	ID       string      `json:"id"`
+	Field    string      `json:"field"`
+	Hub      interface{} `json:"hub"`
+	Database interface{} `json:"database"`
+}
+
+// diffBattleState compares the hub's view of the battle with the database's, which warriors are connected against
+// those the database has active and, when the hub keeps them, the plans as last broadcast field by field. The vote
+// values of the active plan are hidden in both so only who voted is compared
+func diffBattleState(state *arenaState, battle *database.Battle) []stateDiff {
+	diffs := make([]stateDiff, 0)
+
+	connected := make(map[string]bool)
+	for _, c := range state.Connections {
+		if !c.Bot {
+			connected[c.WarriorID] = true
+		}
+	}
+	for _, w := range battle.Warriors {
+		if w.Active != connected[w.WarriorID] {
+			diffs = append(diffs, stateDiff{Kind: "warrior", ID: w.WarriorID, Field: "active", Hub: connected[w.WarriorID], Database: w.Active})
+		}
+		delete(connected, w.WarriorID)
+	}
+	for WarriorID := range connected {
+		diffs = append(diffs, stateDiff{Kind: "warrior", ID: WarriorID, Field: "active", Hub: true})
+	}
+
+	if state.Plans == nil {
+		return sortDiffs(diffs)
+	}
+	hubPlans := make(map[string]map[string]interface{}, len(state.Plans))
+	for PlanID, plan := range state.Plans {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(plan, &fields); err == nil {
+			hubPlans[PlanID] = hideActiveVotes(fields)
+		}
+	}
+	for _, p := range battle.Plans {
+		var fields map[string]interface{}
+		plan, _ := json.Marshal(p)
+		_ = json.Unmarshal(plan, &fields)
+		fields = hideActiveVotes(fields)
+
+		hubFields, ok := hubPlans[p.PlanID]
+		if !ok {
+			diffs = append(diffs, stateDiff{Kind: "plan", ID: p.PlanID, Field: "", Database: fields})
+			continue
+		}
+		delete(hubPlans, p.PlanID)
+		for Field, value := range fields {
+			if !reflect.DeepEqual(hubFields[Field], value) {
+				diffs = append(diffs, stateDiff{Kind: "plan", ID: p.PlanID, Field: Field, Hub: hubFields[Field], Database: value})
+			}
+		}
+	}
+	for PlanID, fields := range hubPlans {
+		diffs = append(diffs, stateDiff{Kind: "plan", ID: PlanID, Field: "", Hub: fields})
+	}
+
+	return sortDiffs(diffs)
+}
+
+// hideActiveVotes blanks the vote values of an active plan, the database hides them and broadcasts only show the
+// warrior who acted their own
+func hideActiveVotes(plan map[string]interface{}) map[string]interface{} {
+	if active, _ := plan["active"].(bool); !active {
+		return plan
+	}
+	votes, _ := plan["votes"].([]interface{})
+	for _, v := range votes {
+		if vote, ok := v.(map[string]interface{}); ok {
+			vote["vote"] = ""
+		}
+	}
+
+	return plan
+}
+
+// sortDiffs orders the diffs by kind, id and field so snapshots compare between requests
+func sortDiffs(diffs []stateDiff) []stateDiff {
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Kind != diffs[j].Kind {
+			return diffs[i].Kind > diffs[j].Kind
+		}
+		if diffs[i].ID != diffs[j].ID {
+			return diffs[i].ID < diffs[j].ID
+		}
+		return diffs[i].Field < diffs[j].Field
+	})
+
+	return diffs
+}
+
+// handleBattleSnapshotGet dumps the battle as the hub holds it in memory and as the database has it, with where they
+// disagree, to debug warriors seeing the battle differently
+func (s *server) handleBattleSnapshotGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		BattleID := mux.Vars(r)["battleId"]
+
+		battle, err := s.database.GetBattle(BattleID, "")
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		state := h.inspect(BattleID)
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"hub":      state,
+			"database": battle,
+			"diff":     diffBattleState(state, battle),
+		})
+	}
+}
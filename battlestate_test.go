@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+func TestDiffBattleState(t *testing.T) {
+	// the plans as last broadcast, after voting on p2 showed w1 their own vote
+	broadcast, _ := json.Marshal([]*database.Plan{
+		{PlanID: "p1", Points: "5", Votes: []*database.Vote{}},
+		{PlanID: "p2", PlanActive: true, Votes: []*database.Vote{{WarriorID: "w1", VoteValue: "3"}}},
+		{PlanID: "p3"},
+	})
+	hb := &hub{
+		arenas: map[string]map[*connection]bool{
+			"b1": {&connection{warriorID: "w1", snapshot: true}: true, &connection{warriorID: "w3"}: true, &connection{warriorID: "bot1", bot: true}: true},
+		},
+		seq:      map[string]uint64{"b1": 7},
+		parents:  make(map[string]string),
+		plans:    map[string]map[string]string{"b1": indexPlans(broadcast)},
+		breakers: &arenaBreakers{failures: make(map[string][]time.Time), open: make(map[string]bool)},
+	}
+	state := hb.arenaState("b1")
+	if state.Seq != 7 || len(state.Connections) != 3 || len(state.Plans) != 3 {
+		t.Fatal("Expected the hub's view of the arena got ", state)
+	}
+
+	battle := &database.Battle{
+		Warriors: []*database.BattleWarrior{{WarriorID: "w1", Active: true}, {WarriorID: "w2", Active: true}},
+		Plans: []*database.Plan{
+			{PlanID: "p1", Points: "8", Votes: []*database.Vote{}},
+			{PlanID: "p2", PlanActive: true, Votes: []*database.Vote{{WarriorID: "w1"}}},
+			{PlanID: "p4"},
+		},
+	}
+	want := []struct {
+		kind  string
+		id    string
+		field string
+	}{
+		{"warrior", "w2", "active"},
+		{"warrior", "w3", "active"},
+		{"plan", "p1", "points"},
+		{"plan", "p3", ""},
+		{"plan", "p4", ""},
+	}
+	diffs := diffBattleState(state, battle)
+	if len(diffs) != len(want) {
+		t.Fatal("Expected ", len(want), " differences got ", diffs)
+	}
+	for i, d := range diffs {
+		if d.Kind != want[i].kind || d.ID != want[i].id || d.Field != want[i].field {
+			t.Error("Expected ", want[i], " got ", d)
+		}
+	}
+	if diffs[2].Hub != "5" || diffs[2].Database != "8" {
+		t.Error("Expected the points of both sides got ", diffs[2])
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/calendar"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// calendarLookaheadDays is how far ahead teams' recurring battles are booked in their calendars
+	calendarLookaheadDays = 7
+	// calendarSlotLength is how long booked calendar events are
+	calendarSlotLength = time.Hour
+	// calendarOpenLead is how long before a slot starts its join link opens the battle
+	calendarOpenLead = 10 * time.Minute
+	// calendarStateTTL is how long a team admin has to authorize the calendar
+	calendarStateTTL = 15 * time.Minute
+	// icsTimeLayout is how iCalendar feeds write UTC times
+	icsTimeLayout = "20060102T150405Z"
+)
+
+// errCalendarSlotGone is opening a slot whose battle was opened and then deleted
+var errCalendarSlotGone = errors.New("the slot's battle was deleted")
+
+// calendarRedirectURL is where the calendar provider sends the team admin back to after authorizing
+func (s *server) calendarRedirectURL(Provider string) string {
+	return "https://" + s.config.AppDomain + s.config.PathPrefix + "/api/calendar/" + Provider + "/callback"
+}
+
+// calendarState is the OAuth state of the team admin connecting the team's calendar, signed so the callback
+// knows which team to connect without trusting the browser
+func (s *server) calendarState(TeamID string, WarriorID string, Expires time.Time) string {
+	params := url.Values{}
+	params.Set("teamId", TeamID)
+	params.Set("warriorId", WarriorID)
+	params.Set("expires", strconv.FormatInt(Expires.Unix(), 10))
+	params.Set("signature", urlSignature([]byte(s.config.SigningKey), "calendar-state", params))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(params.Encode()))
+}
+
+// calendarCookieName is the name of the cookie the state of a team admin connecting a calendar is kept in
+func (s *server) calendarCookieName() string {
+	return s.config.SecureCookieName + "_calendar"
+}
+
+// calendarCookie keeps or, when State is empty, clears the state so the callback only connects the calendar for the
+// browser that started connecting it. It's sent on the calendar provider's redirect back so it can't be SameSite strict
+func (s *server) calendarCookie(w http.ResponseWriter, State string) error {
+	cookie := &http.Cookie{
+		Name:     s.calendarCookieName(),
+		Path:     s.config.PathPrefix + "/api/calendar",
+		HttpOnly: true,
+		Domain:   s.config.AppDomain,
+		MaxAge:   -1,
+		Secure:   s.config.SecureCookieFlag,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if State != "" {
+		encoded, err := s.cookie.Encode(s.calendarCookieName(), State)
+		if err != nil {
+			return err
+		}
+		cookie.Value = encoded
+		cookie.MaxAge = int(calendarStateTTL.Seconds())
+	}
+	http.SetCookie(w, cookie)
+
+	return nil
+}
+
+// verifyCalendarState gets the team and admin of an unexpired state from calendarState
+func (s *server) verifyCalendarState(State string) (string, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(State)
+	if err != nil {
+		return "", "", errors.New("invalid state")
+	}
+	params, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return "", "", errors.New("invalid state")
+	}
+	signature := params.Get("signature")
+	params.Del("signature")
+
+	expected := urlSignature([]byte(s.config.SigningKey), "calendar-state", params)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return "", "", errors.New("invalid state signature")
+	}
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", "", errors.New("state expired")
+	}
+
+	return params.Get("teamId"), params.Get("warriorId"), nil
+}
+
+// calendarJoinURL is the signed link put in a slot's calendar event, opening the slot's battle when followed
+func (s *server) calendarJoinURL(ScheduleID string, Start time.Time) string {
+	params := url.Values{}
+	params.Set("start", strconv.FormatInt(Start.Unix(), 10))
+	// the link works until the day after, for anyone joining late
+	link, _ := s.signURL("/api/calendar/slots/"+ScheduleID+"/join", params, time.Until(Start.Add(24*time.Hour)))
+
+	return link
+}
+
+// calendarAccessToken gets an unexpired access token for the team's calendar, refreshing and saving it when needed
+func (s *server) calendarAccessToken(c *database.TeamCalendar) (string, error) {
+	provider, ok := s.calendars[c.Provider]
+	if !ok {
+		return "", errors.New("calendar provider " + c.Provider + " isn't configured")
+	}
+
+	token := &calendar.Token{AccessToken: c.AccessToken, RefreshToken: c.RefreshToken, Expiry: c.Expiry}
+	if !token.Expired() {
+		return token.AccessToken, nil
+	}
+	token, err := provider.Refresh(token)
+	if err != nil {
+		return "", err
+	}
+	c.AccessToken, c.RefreshToken, c.Expiry = token.AccessToken, token.RefreshToken, token.Expiry
+	if err := s.database.SetTeamCalendar(c); err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// openCalendarSlot opens the battle of a booked slot, led by who connected the team's calendar, getting the
+// battle already opened for it when there is one. A slot whose battle was deleted isn't opened again
+func (s *server) openCalendarSlot(slot *database.CalendarSlot) (string, error) {
+	if slot.BattleID != "" {
+		return slot.BattleID, nil
+	}
+	if slot.Opened {
+		return "", errCalendarSlotGone
+	}
+
+	PointValuesAllowed, AutoFinishVoting, err := applyBattleDefaults(s.battleDefaults(slot.TeamID), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	Battle, err := s.database.CreateBattle(
+		slot.LeaderID, slot.Name+" "+slot.StartTime.Format(absenceDateLayout),
+		PointValuesAllowed, nil, AutoFinishVoting, slot.Timezone, "", slot.TeamID, false,
+	)
+	if err != nil {
+		return "", err
+	}
+	BattleID, err := s.database.SetCalendarSlotBattle(slot.ScheduleID, slot.StartTime, Battle.BattleID)
+	if err != nil {
+		return "", err
+	}
+	if BattleID != Battle.BattleID {
+		// opened at the same time elsewhere, keep theirs
+		_ = s.database.DeleteBattle(Battle.BattleID, slot.LeaderID)
+		if BattleID == "" {
+			return "", errCalendarSlotGone
+		}
+		return BattleID, nil
+	}
+	ops.publish("battle_started", BattleID, "")
+
+	return BattleID, nil
+}
+
+// bookCalendarSlots books the coming week of every connected team's recurring battles as events in their calendar,
+// each occurrence is reserved before its event is created so it's only ever booked once
+func (s *server) bookCalendarSlots() error {
+	Calendars, err := s.database.GetTeamCalendars()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range Calendars {
+		provider, ok := s.calendars[c.Provider]
+		if !ok {
+			continue
+		}
+		Schedules, err := s.database.GetTeamBattleSchedules(c.TeamID)
+		if err != nil || len(Schedules) == 0 {
+			continue
+		}
+		AccessToken, err := s.calendarAccessToken(c)
+		if err != nil {
+			// the team may have revoked access, the others still get booked
+			log.Println("calendar of team " + c.TeamID + ": " + err.Error())
+			continue
+		}
+
+		for _, bs := range Schedules {
+			cs, err := parseBattleSchedule(bs.Schedule)
+			if err != nil {
+				continue
+			}
+			now := time.Now().In(scheduleLocation(bs))
+			today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			for i := 0; i < calendarLookaheadDays; i++ {
+				day := today.AddDate(0, 0, i)
+				Start := cs.at(day)
+				if !cs.runsOn(day) || Start.Before(now) {
+					continue
+				}
+				Reserved, err := s.database.CreateCalendarSlot(bs.ScheduleID, c.TeamID, Start)
+				if err != nil {
+					log.Println("calendar of team " + c.TeamID + ": " + err.Error())
+					continue
+				}
+				if !Reserved {
+					continue
+				}
+				EventID, err := provider.CreateEvent(AccessToken, &calendar.Event{
+					Title:   bs.Name,
+					JoinURL: s.calendarJoinURL(bs.ScheduleID, Start),
+					Start:   Start,
+					End:     Start.Add(calendarSlotLength),
+				})
+				if err != nil {
+					log.Println("calendar of team " + c.TeamID + ": " + err.Error())
+					// release the slot so the next run books it
+					if err := s.database.DeleteCalendarSlot(bs.ScheduleID, Start); err != nil {
+						log.Println("calendar of team " + c.TeamID + ": " + err.Error())
+					}
+					continue
+				}
+				if err := s.database.SetCalendarSlotEvent(bs.ScheduleID, Start, EventID); err != nil {
+					log.Println("calendar of team " + c.TeamID + ": " + err.Error())
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// openDueCalendarSlots opens the battles of booked slots that have started without anyone following the join link,
+// a slot that can't be opened doesn't hold up the others
+func (s *server) openDueCalendarSlots() error {
+	Slots, err := s.database.GetDueCalendarSlots(time.Now())
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, slot := range Slots {
+		if _, err := s.openCalendarSlot(slot); err != nil {
+			log.Println("calendar slot of schedule " + slot.ScheduleID + ": " + err.Error())
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("unable to open %d of %d calendar slots", failed, len(Slots))
+	}
+
+	return nil
+}
+
+// handleTeamCalendarGet gets the team's connected calendar, null when none is, and the providers that can be connected
+func (s *server) handleTeamCalendarGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Calendar, err := s.database.GetTeamCalendar(vars["teamId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		Providers := make([]string, 0, len(s.calendars))
+		for _, name := range []string{calendar.Google, calendar.Microsoft} {
+			if _, ok := s.calendars[name]; ok {
+				Providers = append(Providers, name)
+			}
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"calendar":  Calendar,
+			"providers": Providers,
+		})
+	}
+}
+
+// handleTeamCalendarConnect handles a team admin starting to connect a calendar, getting the provider's
+// URL to authorize it at
+func (s *server) handleTeamCalendarConnect() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		provider, ok := s.calendars[vars["provider"]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		State := s.calendarState(vars["teamId"], warriorID, time.Now().Add(calendarStateTTL))
+		if err := s.calendarCookie(w, State); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]string{
+			"url": provider.AuthCodeURL(s.calendarRedirectURL(provider.Name), State),
+		})
+	}
+}
+
+// handleCalendarCallback handles the team admin coming back from authorizing the calendar, saving its tokens. The
+// state has to match the one kept in their browser so nobody else's authorization can be slipped in
+func (s *server) handleCalendarCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		provider, ok := s.calendars[vars["provider"]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		var CookieState string
+		State := r.URL.Query().Get("state")
+		cookie, err := r.Cookie(s.calendarCookieName())
+		if err != nil || s.cookie.Decode(s.calendarCookieName(), cookie.Value, &CookieState) != nil ||
+			CookieState == "" || State != CookieState {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.calendarCookie(w, "")
+
+		TeamID, WarriorID, err := s.verifyCalendarState(State)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		// they may have been removed as admin while away
+		if Role, err := s.database.GetTeamWarriorRole(TeamID, WarriorID); err != nil || Role != "ADMIN" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		Code := r.URL.Query().Get("code")
+		if Code == "" {
+			// the admin declined
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": r.URL.Query().Get("error")})
+			return
+		}
+
+		token, err := provider.Exchange(s.calendarRedirectURL(provider.Name), Code)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if err := s.database.SetTeamCalendar(&database.TeamCalendar{
+			TeamID:       TeamID,
+			Provider:     provider.Name,
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+			Expiry:       token.Expiry,
+			ConnectedBy:  WarriorID,
+		}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, s.config.PathPrefix+"/", http.StatusFound)
+	}
+}
+
+// handleTeamCalendarDelete handles a team admin disconnecting the team's calendar, events already booked stay
+// in the calendar but their links no longer open battles
+func (s *server) handleTeamCalendarDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := s.database.DeleteTeamCalendar(vars["teamId"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleCalendarSlotJoin handles following the join link of a calendar event, opening the slot's battle from
+// shortly before it starts and sending them to it, earlier they're told when it opens
+func (s *server) handleCalendarSlotJoin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		start, err := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		slot, err := s.database.GetCalendarSlot(vars["scheduleId"], time.Unix(start, 0))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if slot == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if OpensAt := slot.StartTime.Add(-calendarOpenLead); slot.BattleID == "" && time.Now().Before(OpensAt) {
+			RespondWithJSON(w, http.StatusTooEarly, map[string]interface{}{"opensAt": OpensAt})
+			return
+		}
+
+		BattleID, err := s.openCalendarSlot(slot)
+		if err == errCalendarSlotGone {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, s.battleJoinURL(BattleID), http.StatusFound)
+	}
+}
+
+// icsText escapes text for an iCalendar property value, carriage returns are dropped so a value can't end its line
+var icsText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "")
+
+// icsLine writes a content line folded to 75 octets as RFC 5545 requires, without splitting a character
+func icsLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// continuation lines start with the space
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// teamCalendarFeed writes the coming weeks of the team's recurring battles as an iCalendar feed
+func (s *server) teamCalendarFeed(Schedules []*database.BattleSchedule, now time.Time) []byte {
+	var b strings.Builder
+	icsLine(&b, "BEGIN:VCALENDAR")
+	icsLine(&b, "VERSION:2.0")
+	icsLine(&b, "PRODID:-//Thunderdome//Recurring battles//EN")
+
+	for _, bs := range Schedules {
+		cs, err := parseBattleSchedule(bs.Schedule)
+		if err != nil {
+			continue
+		}
+		local := now.In(scheduleLocation(bs))
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+		for i := 0; i < scheduleLookaheadDays; i++ {
+			day := today.AddDate(0, 0, i)
+			Start := cs.at(day)
+			if !cs.runsOn(day) || Start.Before(local) {
+				continue
+			}
+			icsLine(&b, "BEGIN:VEVENT")
+			icsLine(&b, "UID:"+bs.ScheduleID+"-"+strconv.FormatInt(Start.Unix(), 10)+"@"+s.config.AppDomain)
+			icsLine(&b, "DTSTAMP:"+now.UTC().Format(icsTimeLayout))
+			icsLine(&b, "DTSTART:"+Start.UTC().Format(icsTimeLayout))
+			icsLine(&b, "DTEND:"+Start.Add(calendarSlotLength).UTC().Format(icsTimeLayout))
+			icsLine(&b, "SUMMARY:"+icsText.Replace(bs.Name))
+			icsLine(&b, "END:VEVENT")
+		}
+	}
+	icsLine(&b, "END:VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// handleTeamCalendarFeedLink gets a signed link to the team's recurring battles iCalendar feed,
+// which calendar apps can subscribe to without credentials until it expires
+func (s *server) handleTeamCalendarFeedLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		link, expires := s.signURL("/api/team/"+vars["teamId"]+"/calendar.ics", nil, feedLinkTTL)
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{"url": link, "expires": expires})
+	}
+}
+
+// handleTeamCalendarFeed handles getting the team's recurring battles iCalendar feed with a signed link
+func (s *server) handleTeamCalendarFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Schedules, err := s.database.GetTeamBattleSchedules(vars["teamId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(s.teamCalendarFeed(Schedules, time.Now()))
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/calendar"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestCalendarState(t *testing.T) {
+	state := testSigningServer.calendarState("t1", "w1", time.Now().Add(time.Minute))
+	TeamID, WarriorID, err := testSigningServer.verifyCalendarState(state)
+	if err != nil || TeamID != "t1" || WarriorID != "w1" {
+		t.Error("Expected the state to verify for t1 and w1 got ", TeamID, WarriorID, err)
+	}
+
+	other := &server{config: &ServerConfig{SigningKey: "other"}}
+	if _, _, err := other.verifyCalendarState(state); err == nil {
+		t.Error("Expected a state signed with another key to fail verification")
+	}
+
+	expired := testSigningServer.calendarState("t1", "w1", time.Now().Add(-time.Minute))
+	if _, _, err := testSigningServer.verifyCalendarState(expired); err == nil {
+		t.Error("Expected an expired state to fail verification")
+	}
+}
+
+// calendarSlotMock has a booked slot whose battle is opened by joining
+type calendarSlotMock struct {
+	*database.Mock
+	slot   *database.CalendarSlot
+	opened int
+}
+
+func (m *calendarSlotMock) GetCalendarSlot(ScheduleID string, StartTime time.Time) (*database.CalendarSlot, error) {
+	if ScheduleID != m.slot.ScheduleID || !StartTime.Equal(m.slot.StartTime) {
+		return nil, nil
+	}
+	return m.slot, nil
+}
+
+func (m *calendarSlotMock) CreateBattle(LeaderID string, BattleName string, PointValuesAllowed []string, Plans []*database.Plan, AutoFinishVoting bool, Timezone string, Locale string, TeamID string, RequireReady bool) (*database.Battle, error) {
+	m.opened++
+	return &database.Battle{BattleID: "b2", LeaderID: LeaderID, BattleName: BattleName, TeamID: TeamID}, nil
+}
+
+func (m *calendarSlotMock) SetCalendarSlotBattle(ScheduleID string, StartTime time.Time, BattleID string) (string, error) {
+	if m.slot.Opened {
+		return m.slot.BattleID, nil
+	}
+	m.slot.BattleID, m.slot.Opened = BattleID, true
+	return BattleID, nil
+}
+
+func (m *calendarSlotMock) GetTeamWarriorRole(TeamID string, WarriorID string) (string, error) {
+	return "ADMIN", nil
+}
+
+func TestHandleCalendarCallbackState(t *testing.T) {
+	s, db := newMockServer()
+	s.database = &calendarSlotMock{Mock: db}
+	s.config.SigningKey = "secret"
+	s.calendars = map[string]*calendar.Provider{calendar.Google: calendar.NewGoogle("client", "secret")}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/calendar/{provider}/callback", s.handleCalendarCallback())
+
+	State := s.calendarState("t1", "w1", time.Now().Add(time.Minute))
+	callback := func(State string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/calendar/google/callback?state="+State, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := callback(State, nil); w.Code != http.StatusForbidden {
+		t.Error("Expected a callback without the state cookie to respond 403 got ", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	s.calendarCookie(w, s.calendarState("t1", "w1", time.Now().Add(time.Minute+time.Second)))
+	if w := callback(State, w.Result().Cookies()[0]); w.Code != http.StatusForbidden {
+		t.Error("Expected a callback with another browser's state to respond 403 got ", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	s.calendarCookie(w, State)
+	// without a code the admin declined, past the state check
+	if w := callback(State, w.Result().Cookies()[0]); w.Code != http.StatusBadRequest {
+		t.Error("Expected a callback with its browser's state to respond 400 without a code got ", w.Code)
+	}
+}
+
+func TestHandleCalendarSlotJoin(t *testing.T) {
+	s, db := newMockServer()
+	s.config = testSigningServer.config
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	mock := &calendarSlotMock{Mock: db, slot: &database.CalendarSlot{ScheduleID: "s1", TeamID: "t1", Name: "Refinement", StartTime: start, LeaderID: "w1"}}
+	s.database = mock
+	router := mux.NewRouter().PathPrefix("/td").Subrouter()
+	router.HandleFunc("/api/calendar/slots/{scheduleId}/join", s.signedOnly(s.handleCalendarSlotJoin()))
+
+	join := func(link string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", link, nil))
+		return w
+	}
+
+	link := s.calendarJoinURL("s1", start)
+	if w := join(link); w.Code != http.StatusTooEarly || mock.opened != 0 {
+		t.Error("Expected joining an hour early to respond 425 without opening got ", w.Code)
+	}
+
+	mock.slot.StartTime = time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	link = s.calendarJoinURL("s1", mock.slot.StartTime)
+	if w := join(link); w.Code != http.StatusFound || !strings.HasSuffix(w.Header().Get("Location"), "/battle/b2") {
+		t.Error("Expected joining shortly before the start to redirect to the opened battle got ", w.Code, w.Header().Get("Location"))
+	}
+	if w := join(link); w.Code != http.StatusFound || mock.opened != 1 {
+		t.Error("Expected joining again to redirect to the same battle got ", w.Code, mock.opened)
+	}
+
+	// the battle was deleted
+	mock.slot.BattleID = ""
+	if w := join(link); w.Code != http.StatusGone || mock.opened != 1 {
+		t.Error("Expected joining after its battle was deleted to respond 410 without opening got ", w.Code, mock.opened)
+	}
+
+	unbooked := s.calendarJoinURL("s2", mock.slot.StartTime)
+	if w := join(unbooked); w.Code != http.StatusNotFound {
+		t.Error("Expected joining an unbooked slot to respond 404 got ", w.Code)
+	}
+
+	u, _ := url.Parse(link)
+	q := u.Query()
+	q.Set("start", "1")
+	u.RawQuery = q.Encode()
+	if w := join(u.String()); w.Code != http.StatusForbidden {
+		t.Error("Expected a changed start to respond 403 got ", w.Code)
+	}
+}
+
+func TestICSLine(t *testing.T) {
+	var b strings.Builder
+	icsLine(&b, "SUMMARY:"+icsText.Replace("Sprint\r\nDESCRIPTION:injected\r"))
+	if b.String() != "SUMMARY:Sprint\\nDESCRIPTION:injected\r\n" {
+		t.Error("Expected carriage returns and new lines not to end the line got ", b.String())
+	}
+
+	b.Reset()
+	icsLine(&b, "SUMMARY:"+strings.Repeat("é", 60))
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	for i, line := range lines {
+		if len(line) > 75 || !utf8.ValidString(line) || (i > 0 && !strings.HasPrefix(line, " ")) {
+			t.Error("Expected lines folded to 75 octets on character boundaries got ", lines)
+		}
+	}
+	if unfolded := strings.Replace(b.String(), "\r\n ", "", -1); unfolded != "SUMMARY:"+strings.Repeat("é", 60)+"\r\n" {
+		t.Error("Expected the folded line to unfold to the original got ", unfolded)
+	}
+}
+
+// calendarFeedMock has the team's recurring battles
+type calendarFeedMock struct {
+	*database.Mock
+	schedules []*database.BattleSchedule
+}
+
+func (m *calendarFeedMock) GetTeamBattleSchedules(TeamID string) ([]*database.BattleSchedule, error) {
+	return m.schedules, nil
+}
+
+func TestHandleTeamCalendarFeed(t *testing.T) {
+	s, db := newMockServer()
+	s.config = testSigningServer.config
+	s.database = &calendarFeedMock{Mock: db, schedules: []*database.BattleSchedule{
+		{ScheduleID: "s1", TeamID: "t1", Name: "Refinement; sprint 2", Schedule: "30 9 * * *", Timezone: "UTC"},
+	}}
+	router := mux.NewRouter().PathPrefix("/td").Subrouter()
+	router.HandleFunc("/api/team/{teamId}/calendar.ics", s.signedOnly(s.handleTeamCalendarFeed()))
+
+	feed := func(link string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", link, nil))
+		return w
+	}
+
+	link, _ := s.signURL("/api/team/t1/calendar.ics", nil, feedLinkTTL)
+	w := feed(link)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "SUMMARY:Refinement\\; sprint 2\r\n") {
+		t.Error("Expected the signed feed to have the recurring battle got ", w.Code, w.Body.String())
+	}
+	if strings.Count(w.Body.String(), "BEGIN:VEVENT") < scheduleLookaheadDays-1 {
+		t.Error("Expected the feed to have the coming weeks got ", w.Body.String())
+	}
+
+	if w := feed("/td/api/team/t1/calendar.ics"); w.Code != http.StatusForbidden {
+		t.Error("Expected the unsigned feed to respond 403 got ", w.Code)
+	}
+	if w := feed(strings.Replace(link, "/t1/", "/t2/", 1)); w.Code != http.StatusForbidden {
+		t.Error("Expected another team's feed with the link to respond 403 got ", w.Code)
+	}
+
+	expired, _ := s.signURL("/api/team/t1/calendar.ics", nil, -time.Minute)
+	if w := feed(expired); w.Code != http.StatusForbidden {
+		t.Error("Expected an expired feed link to respond 403 got ", w.Code)
+	}
+}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -19,23 +25,53 @@ const (
 
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
+)
+
+const (
+	// socketVersionLegacy is the original flat {type, value, warriorId} event format
+	socketVersionLegacy = 1
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 1024 * 1024
+	// socketVersionEnvelope wraps events in a {v, type, payload, seq} envelope
+	socketVersionEnvelope = 2
+
+	// socketProtocolPrefix is the websocket subprotocol prefix used to negotiate the api version
+	socketProtocolPrefix = "thunderdome.v"
 )
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols: []string{
+		socketProtocolPrefix + strconv.Itoa(socketVersionEnvelope),
+		socketProtocolPrefix + strconv.Itoa(socketVersionLegacy),
+	},
 }
 
 // connection is an middleman between the websocket connection and the hub.
 type connection struct {
+	// Bytes of outbound messages queued, first so it's aligned for atomic access.
+	queued int64
+
 	// The websocket connection.
 	ws *websocket.Conn
 
+	// Whether the connection belongs to a bot participant
+	bot bool
+
+	// The warrior the connection belongs to
+	warriorID string
+
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// Close message written once send is closed, empty when the connection isn't dropped by the hub
+	closeMessage []byte
+
+	// The negotiated websocket api version
+	version int
+
+	// Whether the connection loads plans incrementally rather than in full
+	snapshot bool
 }
 
 // SocketEvent is the event structure used for socket messages
@@ -58,9 +94,375 @@ func CreateSocketEvent(EventType string, EventValue string, EventWarrior string)
 	return event
 }
 
+// breakoutActivityEvent wraps an event from a breakout arena so it can be
+// relayed to the parent battle
+func breakoutActivityEvent(BreakoutID string, event []byte) []byte {
+	activity, _ := json.Marshal(struct {
+		BreakoutID string          `json:"breakoutId"`
+		Event      json.RawMessage `json:"event"`
+	}{BreakoutID, event})
+
+	return CreateSocketEvent("breakout_activity", string(activity), "")
+}
+
+// SocketEnvelope is the versioned event structure used for socket messages
+// sent to and received from clients that negotiated api version 2 or later
+type SocketEnvelope struct {
+	Version   int             `json:"v"`
+	EventType string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	Seq       uint64          `json:"seq"`
+	WarriorID string          `json:"warriorId,omitempty"`
+}
+
+// negotiateSocketVersion determines the websocket api version requested by the client,
+// either through the negotiated subprotocol or the v query parameter, defaulting to legacy
+func negotiateSocketVersion(r *http.Request, subprotocol string) int {
+	requested := r.URL.Query().Get("v")
+	if strings.HasPrefix(subprotocol, socketProtocolPrefix) {
+		requested = strings.TrimPrefix(subprotocol, socketProtocolPrefix)
+	}
+
+	version, err := strconv.Atoi(requested)
+	if err != nil || version < socketVersionLegacy || version > socketVersionEnvelope {
+		return socketVersionLegacy
+	}
+
+	return version
+}
+
+// encodeSocketEvent converts a legacy encoded event into the format of the given api version
+func encodeSocketEvent(version int, event []byte, seq uint64) []byte {
+	if version < socketVersionEnvelope {
+		return event
+	}
+
+	var se SocketEvent
+	if err := json.Unmarshal(event, &se); err != nil {
+		log.Printf("unable to encode socket event: %v", err)
+		return event
+	}
+
+	envelope := &SocketEnvelope{
+		Version:   version,
+		EventType: se.EventType,
+		Payload:   socketPayload(se.EventValue),
+		Seq:       seq,
+		WarriorID: se.EventWarrior,
+	}
+
+	encoded, _ := json.Marshal(envelope)
+
+	return encoded
+}
+
+// socketPayload turns a legacy event value into a raw json payload,
+// values that already contain json are embedded as is instead of as an escaped string
+func socketPayload(value string) json.RawMessage {
+	if value != "" && json.Valid([]byte(value)) {
+		return json.RawMessage(value)
+	}
+
+	payload, _ := json.Marshal(value)
+
+	return payload
+}
+
+// decodeSocketEvent parses an incoming client message in either the legacy
+// or envelope format returning the event type and its value
+func decodeSocketEvent(msg []byte) (eventType string, eventValue string, err error) {
+	var envelope struct {
+		Version   int             `json:"v"`
+		EventType string          `json:"type"`
+		Value     string          `json:"value"`
+		Payload   json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		return "", "", err
+	}
+
+	if envelope.Version < socketVersionEnvelope {
+		return envelope.EventType, envelope.Value, nil
+	}
+
+	// string payloads are passed along unquoted to match legacy values
+	var value string
+	if err := json.Unmarshal(envelope.Payload, &value); err == nil {
+		return envelope.EventType, value, nil
+	}
+
+	return envelope.EventType, string(envelope.Payload), nil
+}
+
+// planListEvents are the server events whose value is the battle's full list of plans
+var planListEvents = map[string]bool{
+	"plan_added":                true,
+	"plan_activated":            true,
+	"plan_skipped":              true,
+	"plan_revised":              true,
+	"plan_burned":               true,
+	"plan_split":                true,
+	"plan_finalized":            true,
+	"plan_checked":              true,
+	"plan_questions_updated":    true,
+	"vote_activity":             true,
+	"vote_retracted":            true,
+	"voting_ended":              true,
+	"dots_placed":               true,
+	"breakouts_merged":          true,
+	"plan_dependencies_updated": true,
+}
+
+// PlanDelta is the value of plan list events sent to snapshot connections
+type PlanDelta struct {
+	Plans   []json.RawMessage `json:"plans"`
+	Removed []string          `json:"removed"`
+	Total   int               `json:"total"`
+}
+
+// indexPlans keys a json list of plans by plan id
+func indexPlans(plans []byte) map[string]string {
+	var list []json.RawMessage
+	known := make(map[string]string)
+	if err := json.Unmarshal(plans, &list); err != nil {
+		return known
+	}
+
+	for _, p := range list {
+		var plan struct {
+			PlanID string `json:"id"`
+		}
+		if err := json.Unmarshal(p, &plan); err == nil {
+			known[plan.PlanID] = string(p)
+		}
+	}
+
+	return known
+}
+
+// planDeltaEvent turns a plan list event into one holding only the plans that changed
+// from the known plans, which are updated to match. Other events return nil
+func planDeltaEvent(event []byte, known map[string]string) []byte {
+	var se SocketEvent
+	if err := json.Unmarshal(event, &se); err != nil || !planListEvents[se.EventType] {
+		return nil
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal([]byte(se.EventValue), &list); err != nil {
+		return nil
+	}
+
+	delta := PlanDelta{
+		Plans:   make([]json.RawMessage, 0),
+		Removed: make([]string, 0),
+		Total:   len(list),
+	}
+	current := make(map[string]bool)
+	for _, p := range list {
+		var plan struct {
+			PlanID string `json:"id"`
+		}
+		_ = json.Unmarshal(p, &plan)
+		current[plan.PlanID] = true
+		if known[plan.PlanID] != string(p) {
+			delta.Plans = append(delta.Plans, p)
+			known[plan.PlanID] = string(p)
+		}
+	}
+	for PlanID := range known {
+		if !current[PlanID] {
+			delta.Removed = append(delta.Removed, PlanID)
+			delete(known, PlanID)
+		}
+	}
+	sort.Strings(delta.Removed)
+
+	value, _ := json.Marshal(delta)
+
+	return CreateSocketEvent(se.EventType, string(value), se.EventWarrior)
+}
+
+// PlanConflict describes the current state of a plan a stale edit was rejected for
+type PlanConflict struct {
+	PlanID  string         `json:"planId"`
+	Version int            `json:"version"`
+	Plan    *database.Plan `json:"plan"`
+}
+
+// planConflict finds the current version of the plan among the battles plans
+func planConflict(PlanID string, plans []*database.Plan) PlanConflict {
+	conflict := PlanConflict{PlanID: PlanID}
+	for _, plan := range plans {
+		if plan.PlanID == PlanID {
+			conflict.Version = plan.Version
+			conflict.Plan = plan
+		}
+	}
+
+	return conflict
+}
+
+// maxBattleNotesLength is the most characters a battles notes can hold
+const maxBattleNotesLength = 20000
+
+// clientEvents are the socket events clients can send, anything else including the events the server
+// sends is dropped rather than broadcast
+var clientEvents = map[string]bool{
+	"vote":                  true,
+	"retract_vote":          true,
+	"add_plan":              true,
+	"activate_plan":         true,
+	"skip_plan":             true,
+	"end_voting":            true,
+	"finalize_plan":         true,
+	"revise_plan":           true,
+	"split_plan":            true,
+	"set_plan_dependencies": true,
+	"check_plan":            true,
+	"ask_question":          true,
+	"resolve_question":      true,
+	"start_dot_voting":      true,
+	"place_dots":            true,
+	"end_dot_voting":        true,
+	"confidence_round":      true,
+	"confidence_vote":       true,
+	"require_ready":         true,
+	"create_breakouts":      true,
+	"merge_breakouts":       true,
+	"burn_plan":             true,
+	"promote_leader":        true,
+	"revise_battle":         true,
+	"revise_notes":          true,
+	"concede_battle":        true,
+	"jab_warrior":           true,
+	"highlight":             true,
+	"raise_hand":            true,
+	"lower_hand":            true,
+	"clear_hands":           true,
+	"reorder_hands":         true,
+	"abandon_battle":        true,
+}
+
+// botRestrictedEvents are the socket events bot participants are not allowed to send
+var botRestrictedEvents = map[string]bool{
+	"vote":            true,
+	"place_dots":      true,
+	"confidence_vote": true,
+	"retract_vote":    true,
+	"promote_leader":  true,
+	"concede_battle":  true,
+	"raise_hand":      true,
+}
+
+// readOnlyEvents are the socket events that don't write to the database, still handled while an arena is read only
+var readOnlyEvents = map[string]bool{
+	"jab_warrior": true,
+	"highlight":   true,
+}
+
+// leaderEvents are the socket events changing the battle that are handled one at a time per battle
+var leaderEvents = map[string]bool{
+	"add_plan":              true,
+	"activate_plan":         true,
+	"skip_plan":             true,
+	"end_voting":            true,
+	"finalize_plan":         true,
+	"revise_plan":           true,
+	"split_plan":            true,
+	"resolve_question":      true,
+	"start_dot_voting":      true,
+	"end_dot_voting":        true,
+	"confidence_round":      true,
+	"require_ready":         true,
+	"create_breakouts":      true,
+	"merge_breakouts":       true,
+	"burn_plan":             true,
+	"promote_leader":        true,
+	"revise_battle":         true,
+	"concede_battle":        true,
+	"clear_hands":           true,
+	"reorder_hands":         true,
+	"set_plan_dependencies": true,
+}
+
+// moderated checks the texts of a socket event with the servers moderator, letting the warrior that sent
+// content it refuses know
+func (s subscription) moderated(srv *server, Texts ...string) bool {
+	if srv.moderation.Check(Texts...) == nil {
+		return true
+	}
+	h.whisper <- whisper{message{CreateSocketEvent("content_rejected", "", s.warriorID), s.arena}, s.conn}
+
+	return false
+}
+
+// named cleans a name from a socket event, letting the warrior that sent one that isn't allowed know why
+func (s subscription) named(Field string, Name string, MaxLength int) (string, bool) {
+	Name, err := cleanName(Field, Name, MaxLength)
+	if err != nil {
+		invalid, _ := json.Marshal(err)
+		h.whisper <- whisper{message{CreateSocketEvent("name_invalid", string(invalid), s.warriorID), s.arena}, s.conn}
+		return "", false
+	}
+
+	return Name, true
+}
+
+// voteAllowed checks the vote is one of the battle's point values, and a special card its team or organization
+// still allows when their defaults limit them
+func (srv *server) voteAllowed(Battle *database.Battle, VoteValue string) error {
+	if !contains(Battle.PointValuesAllowed, VoteValue) {
+		return errors.New("vote " + VoteValue + " isn't one of the battle's point values")
+	}
+	if specialCard(VoteValue) {
+		d := srv.battleDefaults(Battle.TeamID)
+		if len(d.SpecialCards) > 0 && !contains(d.SpecialCards, VoteValue) {
+			return errors.New(VoteValue + " isn't an allowed special card")
+		}
+	}
+
+	return nil
+}
+
+// eventFailed checks whether an event failed for the database being unreachable, switching the arena to read only
+// with a warning once writes keep failing, and back once the database can be reached again
+func (srv *server) eventFailed(BattleID string) {
+	if srv.database.Ping() == nil {
+		return
+	}
+	if !h.breakers.fail(BattleID, time.Now()) {
+		return
+	}
+
+	log.Println("database writes failing, battle " + BattleID + " switched to read only")
+	h.broadcast <- message{CreateSocketEvent("arena_read_only", "", ""), BattleID}
+	go func() {
+		for {
+			time.Sleep(breakerRetry)
+			if srv.database.Ping() == nil {
+				break
+			}
+		}
+		h.breakers.close(BattleID)
+		log.Println("database reachable again, battle " + BattleID + " switched back from read only")
+		h.broadcast <- message{CreateSocketEvent("arena_recovered", "", ""), BattleID}
+	}()
+}
+
 // readPump pumps messages from the websocket connection to the hub.
 func (s subscription) readPump(srv *server) {
 	var forceClosed bool
+	// held while handling a leader event, released should handling it panic so the arena isn't left stuck
+	var unlock func()
+	defer func() {
+		if p := recover(); p != nil {
+			if unlock != nil {
+				unlock()
+			}
+			srv.reportPanic(p, map[string]string{"socket": "read", "battleId": s.arena, "warriorId": s.warriorID})
+		}
+	}()
 	c := s.conn
 	defer func() {
 		BattleID := s.arena
@@ -84,7 +486,7 @@ func (s subscription) readPump(srv *server) {
 			log.Printf("close error: %v", err)
 		}
 	}()
-	c.ws.SetReadLimit(maxMessageSize)
+	c.ws.SetReadLimit(h.limits.MaxMessageSize)
 	c.ws.SetReadDeadline(time.Now().Add(pongWait))
 	c.ws.SetPongHandler(func(string) error { c.ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
@@ -95,23 +497,90 @@ func (s subscription) readPump(srv *server) {
 			}
 			break
 		}
+		if !h.rates.allow(s.warriorID, h.limits, time.Now()) {
+			log.Println("warrior " + s.warriorID + " sent messages too fast, disconnecting")
+			cm := websocket.FormatCloseMessage(closeRateLimited, "rate limited")
+			if err := c.ws.WriteControl(websocket.CloseMessage, cm, time.Now().Add(writeWait)); err != nil {
+				log.Printf("rate limited close error: %v", err)
+			}
+			break
+		}
 
 		var badEvent bool
-		keyVal := make(map[string]string)
-		json.Unmarshal(msg, &keyVal) // check for errors
+		eventType, eventValue, decodeErr := decodeSocketEvent(msg)
+		if decodeErr != nil {
+			log.Printf("error decoding socket event: %v", decodeErr)
+			continue
+		}
+		keyVal := map[string]string{
+			"type":  eventType,
+			"value": eventValue,
+		}
 		warriorID := s.warriorID
 		battleID := s.arena
 
+		if !clientEvents[keyVal["type"]] {
+			continue
+		}
+
+		// bots never vote and can't remove the battle or its leader
+		if c.bot && botRestrictedEvents[keyVal["type"]] {
+			continue
+		}
+
+		// nothing is written while the database is failing, rather than telling the arena it was
+		if !readOnlyEvents[keyVal["type"]] && h.breakers.isOpen(battleID) {
+			h.whisper <- whisper{message{CreateSocketEvent("arena_read_only", "", warriorID), battleID}, c}
+			continue
+		}
+
+		// the broadcast happens under the lock too so arenas see leader actions in the order they were applied
+		if leaderEvents[keyVal["type"]] {
+			unlock = h.locks.lock(battleID)
+		}
+
 		switch keyVal["type"] {
 		case "vote":
 			var wv struct {
 				VoteValue        string `json:"voteValue"`
 				PlanID           string `json:"planId"`
 				AutoFinishVoting bool   `json:"autoFinishVoting"`
+				VoteID           string `json:"voteId"`
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &wv)
 
-			Plans, AllVoted := srv.database.SetVote(battleID, warriorID, wv.PlanID, wv.VoteValue)
+			Battle, err := srv.database.GetBattle(battleID, warriorID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			// the client's cards aren't trusted, it may be out of date or not the UI at all
+			if err := srv.voteAllowed(Battle, wv.VoteValue); err != nil {
+				invalid, _ := json.Marshal(map[string]interface{}{
+					"planId":             wv.PlanID,
+					"voteId":             wv.VoteID,
+					"voteValue":          wv.VoteValue,
+					"error":              err.Error(),
+					"pointValuesAllowed": Battle.PointValuesAllowed,
+				})
+				h.whisper <- whisper{message{CreateSocketEvent("vote_invalid", string(invalid), warriorID), battleID}, c}
+				badEvent = true
+				break
+			}
+
+			Plans, AllVoted, err := srv.database.SetVote(battleID, warriorID, wv.PlanID, wv.VoteValue, wv.VoteID, srv.config.VoteChangePolicy == "reject")
+			if err == database.ErrVoteChangeRejected {
+				rejected, _ := json.Marshal(map[string]string{
+					"planId": wv.PlanID,
+					"voteId": wv.VoteID,
+				})
+				h.whisper <- whisper{message{CreateSocketEvent("vote_rejected", string(rejected), warriorID), battleID}, c}
+			}
+			if err != nil {
+				// duplicate votes have already been counted
+				badEvent = true
+				break
+			}
 
 			updatedPlans, _ := json.Marshal(Plans)
 			msg = CreateSocketEvent("vote_activity", string(updatedPlans), warriorID)
@@ -141,6 +610,25 @@ func (s subscription) readPump(srv *server) {
 			Link := planObj["link"]
 			Description := planObj["description"]
 			AcceptanceCriteria := planObj["acceptanceCriteria"]
+			PlanName, valid := s.named("planName", PlanName, maxPlanNameLength)
+			if !valid || !s.moderated(srv, PlanName, Description, AcceptanceCriteria) {
+				badEvent = true
+				break
+			}
+			planObj["planName"] = PlanName
+			var planOptions struct {
+				AllowDuplicate bool `json:"allowDuplicate"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &planOptions)
+			// the leader gets to use the plan already there, or add it anyway
+			if !planOptions.AllowDuplicate {
+				if duplicate := srv.findPlanDuplicate(battleID, warriorID, PlanName, ReferenceID); duplicate != nil {
+					ack, _ := json.Marshal(planDuplicateAck{Plan: planObj, Duplicate: duplicate})
+					h.whisper <- whisper{message{CreateSocketEvent("plan_duplicate", string(ack), warriorID), battleID}, c}
+					badEvent = true
+					break
+				}
+			}
 
 			plans, err := srv.database.CreatePlan(battleID, warriorID, PlanName, PlanType, ReferenceID, Link, Description, AcceptanceCriteria)
 			if err != nil {
@@ -196,14 +684,222 @@ func (s subscription) readPump(srv *server) {
 			Link := planObj["link"]
 			Description := planObj["description"]
 			AcceptanceCriteria := planObj["acceptanceCriteria"]
+			var planVersion struct {
+				Version int `json:"version"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &planVersion)
+			PlanName, valid := s.named("planName", PlanName, maxPlanNameLength)
+			if !valid || !s.moderated(srv, PlanName, Description, AcceptanceCriteria) {
+				badEvent = true
+				break
+			}
 
-			plans, err := srv.database.RevisePlan(battleID, warriorID, PlanID, PlanName, PlanType, ReferenceID, Link, Description, AcceptanceCriteria)
+			plans, err := srv.database.RevisePlan(battleID, warriorID, PlanID, PlanName, PlanType, ReferenceID, Link, Description, AcceptanceCriteria, planVersion.Version)
+			if err == database.ErrPlanConflict {
+				conflict, _ := json.Marshal(planConflict(PlanID, plans))
+				h.whisper <- whisper{message{CreateSocketEvent("plan_conflict", string(conflict), warriorID), battleID}, c}
+			}
 			if err != nil {
 				badEvent = true
 				break
 			}
 			updatedPlans, _ := json.Marshal(plans)
 			msg = CreateSocketEvent("plan_revised", string(updatedPlans), "")
+		case "split_plan":
+			var splitPlan struct {
+				PlanID string           `json:"planId"`
+				Plans  []*database.Plan `json:"plans"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &splitPlan)
+			var splitTexts []string
+			valid := true
+			for _, plan := range splitPlan.Plans {
+				if plan.PlanName, valid = s.named("planName", plan.PlanName, maxPlanNameLength); !valid {
+					break
+				}
+				splitTexts = append(splitTexts, plan.PlanName, plan.Description, plan.AcceptanceCriteria)
+			}
+			if !valid || !s.moderated(srv, splitTexts...) {
+				badEvent = true
+				break
+			}
+
+			plans, err := srv.database.SplitPlan(battleID, warriorID, splitPlan.PlanID, splitPlan.Plans)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedPlans, _ := json.Marshal(plans)
+			msg = CreateSocketEvent("plan_split", string(updatedPlans), "")
+		case "set_plan_dependencies":
+			var dependencies struct {
+				PlanID    string   `json:"planId"`
+				DependsOn []string `json:"dependsOn"`
+			}
+			if err := json.Unmarshal([]byte(keyVal["value"]), &dependencies); err != nil {
+				badEvent = true
+				break
+			}
+			// a plan can't end up waiting on itself
+			if dependencyCycle(planDependencies(srv.database.GetPlans(battleID, warriorID), dependencies.PlanID, dependencies.DependsOn)) {
+				badEvent = true
+				break
+			}
+
+			plans, err := srv.database.SetPlanDependencies(battleID, warriorID, dependencies.PlanID, dependencies.DependsOn)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedPlans, _ := json.Marshal(plans)
+			msg = CreateSocketEvent("plan_dependencies_updated", string(updatedPlans), "")
+		case "check_plan":
+			var checkPlan struct {
+				PlanID  string `json:"planId"`
+				ItemID  string `json:"itemId"`
+				Checked bool   `json:"checked"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &checkPlan)
+
+			plans, err := srv.database.CheckPlanChecklistItem(battleID, warriorID, checkPlan.PlanID, checkPlan.ItemID, checkPlan.Checked)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedPlans, _ := json.Marshal(plans)
+			msg = CreateSocketEvent("plan_checked", string(updatedPlans), warriorID)
+		case "ask_question":
+			var planQuestion struct {
+				PlanID   string `json:"planId"`
+				Question string `json:"question"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &planQuestion)
+			if planQuestion.Question == "" || !s.moderated(srv, planQuestion.Question) {
+				badEvent = true
+				break
+			}
+
+			plans, err := srv.database.AskPlanQuestion(battleID, warriorID, planQuestion.PlanID, planQuestion.Question)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			go srv.notifyMentions(battleID, warriorID, planQuestion.Question, "")
+			updatedPlans, _ := json.Marshal(plans)
+			msg = CreateSocketEvent("plan_questions_updated", string(updatedPlans), warriorID)
+		case "resolve_question":
+			var resolvedQuestion struct {
+				QuestionID string `json:"questionId"`
+				Answer     string `json:"answer"`
+			}
+			json.Unmarshal([]byte(keyVal["value"]), &resolvedQuestion)
+			if !s.moderated(srv, resolvedQuestion.Answer) {
+				badEvent = true
+				break
+			}
+
+			plans, err := srv.database.ResolvePlanQuestion(battleID, warriorID, resolvedQuestion.QuestionID, resolvedQuestion.Answer)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			go srv.notifyMentions(battleID, warriorID, resolvedQuestion.Answer, "")
+			updatedPlans, _ := json.Marshal(plans)
+			msg = CreateSocketEvent("plan_questions_updated", string(updatedPlans), "")
+		case "start_dot_voting":
+			DotBudget, _ := strconv.Atoi(keyVal["value"])
+			plans, err := srv.database.StartDotVoting(battleID, warriorID, DotBudget)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedDotVoting, _ := json.Marshal(map[string]interface{}{
+				"dotBudget": DotBudget,
+				"plans":     plans,
+			})
+			msg = CreateSocketEvent("dot_voting_started", string(updatedDotVoting), "")
+		case "place_dots":
+			planDots := make(map[string]int)
+			json.Unmarshal([]byte(keyVal["value"]), &planDots)
+
+			plans, err := srv.database.SetWarriorDots(battleID, warriorID, planDots)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedPlans, _ := json.Marshal(plans)
+			msg = CreateSocketEvent("dots_placed", string(updatedPlans), warriorID)
+		case "end_dot_voting":
+			plans, err := srv.database.EndDotVoting(battleID, warriorID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedPlans, _ := json.Marshal(plans)
+			msg = CreateSocketEvent("dot_voting_ended", string(updatedPlans), "")
+		case "confidence_round":
+			Open, _ := strconv.ParseBool(keyVal["value"])
+			confidence, err := srv.database.SetBattleConfidenceOpen(battleID, warriorID, Open)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedConfidence, _ := json.Marshal(confidence)
+			msg = CreateSocketEvent("confidence_updated", string(updatedConfidence), "")
+		case "confidence_vote":
+			Confidence, _ := strconv.Atoi(keyVal["value"])
+			confidence, err := srv.database.SetConfidenceVote(battleID, warriorID, Confidence)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedConfidence, _ := json.Marshal(confidence)
+			msg = CreateSocketEvent("confidence_updated", string(updatedConfidence), warriorID)
+		case "require_ready":
+			RequireReady, _ := strconv.ParseBool(keyVal["value"])
+			err := srv.database.SetBattleRequireReady(battleID, warriorID, RequireReady)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			msg = CreateSocketEvent("require_ready_updated", strconv.FormatBool(RequireReady), "")
+		case "create_breakouts":
+			var breakouts []*database.Breakout
+			json.Unmarshal([]byte(keyVal["value"]), &breakouts)
+			// breakout names become the names of their battles
+			valid := true
+			BreakoutNames := make([]string, 0, len(breakouts))
+			for _, breakout := range breakouts {
+				if breakout.Name, valid = s.named("breakoutName", breakout.Name, maxBattleNameLength); !valid {
+					break
+				}
+				BreakoutNames = append(BreakoutNames, breakout.Name)
+			}
+			if !valid || !s.moderated(srv, BreakoutNames...) {
+				badEvent = true
+				break
+			}
+
+			breakouts, err := srv.database.CreateBreakouts(battleID, warriorID, breakouts)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedBreakouts, _ := json.Marshal(breakouts)
+			msg = CreateSocketEvent("breakouts_created", string(updatedBreakouts), "")
+		case "merge_breakouts":
+			breakouts := srv.database.GetBreakouts(battleID)
+			plans, err := srv.database.MergeBreakouts(battleID, warriorID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			// send the breakout warriors back to the parent battle
+			for _, breakout := range breakouts {
+				h.broadcast <- message{CreateSocketEvent("breakout_merged", battleID, ""), breakout.BattleID}
+			}
+			updatedPlans, _ := json.Marshal(plans)
+			msg = CreateSocketEvent("breakouts_merged", string(updatedPlans), "")
 		case "burn_plan":
 			plans, err := srv.database.BurnPlan(battleID, warriorID, keyVal["value"])
 			if err != nil {
@@ -225,10 +921,35 @@ func (s subscription) readPump(srv *server) {
 				BattleName         string   `json:"battleName"`
 				PointValuesAllowed []string `json:"pointValuesAllowed"`
 				AutoFinishVoting   bool     `json:"autoFinishVoting"`
+				Timezone           string   `json:"timezone,omitempty"`
+				Locale             string   `json:"locale,omitempty"`
 			}
 			json.Unmarshal([]byte(keyVal["value"]), &revisedBattle)
 
-			err := srv.database.ReviseBattle(battleID, warriorID, revisedBattle.BattleName, revisedBattle.PointValuesAllowed, revisedBattle.AutoFinishVoting)
+			_, _, localeErr := ValidateBattleLocale(revisedBattle.Timezone, revisedBattle.Locale)
+			var valid bool
+			if revisedBattle.BattleName, valid = s.named("battleName", revisedBattle.BattleName, maxBattleNameLength); !valid {
+				badEvent = true
+				break
+			}
+			if localeErr != nil || !s.moderated(srv, revisedBattle.BattleName) {
+				badEvent = true
+				break
+			}
+			var TeamID string
+			if battle, err := srv.database.GetBattle(battleID, warriorID); err == nil {
+				TeamID = battle.TeamID
+			}
+			var defaultsErr error
+			revisedBattle.PointValuesAllowed, revisedBattle.AutoFinishVoting, defaultsErr = applyBattleDefaults(
+				srv.battleDefaults(TeamID), revisedBattle.PointValuesAllowed, &revisedBattle.AutoFinishVoting,
+			)
+			if defaultsErr != nil {
+				badEvent = true
+				break
+			}
+
+			err := srv.database.ReviseBattle(battleID, warriorID, revisedBattle.BattleName, revisedBattle.PointValuesAllowed, revisedBattle.AutoFinishVoting, revisedBattle.Timezone, revisedBattle.Locale)
 			if err != nil {
 				badEvent = true
 				break
@@ -236,12 +957,43 @@ func (s subscription) readPump(srv *server) {
 
 			updatedBattle, _ := json.Marshal(revisedBattle)
 			msg = CreateSocketEvent("battle_revised", string(updatedBattle), "")
+		case "revise_notes":
+			var revisedNotes database.BattleNotes
+			json.Unmarshal([]byte(keyVal["value"]), &revisedNotes)
+			if utf8.RuneCountInString(revisedNotes.Notes) > maxBattleNotesLength || !s.moderated(srv, revisedNotes.Notes) {
+				badEvent = true
+				break
+			}
+
+			// only warriors newly mentioned by the revision are notified
+			var previousNotes string
+			if strings.Contains(revisedNotes.Notes, "@") {
+				if previous, err := srv.database.GetBattleNotes(battleID); err == nil {
+					previousNotes = previous.Notes
+				}
+			}
+
+			notes, err := srv.database.ReviseBattleNotes(battleID, warriorID, revisedNotes.Notes, revisedNotes.Version)
+			if err == database.ErrNotesConflict {
+				conflict, _ := json.Marshal(notes)
+				h.whisper <- whisper{message{CreateSocketEvent("notes_conflict", string(conflict), warriorID), battleID}, c}
+			}
+			if err != nil {
+				badEvent = true
+				break
+			}
+			if strings.Contains(notes.Notes, "@") {
+				go srv.notifyMentions(battleID, warriorID, notes.Notes, previousNotes)
+			}
+			updatedNotes, _ := json.Marshal(notes)
+			msg = CreateSocketEvent("notes_revised", string(updatedNotes), warriorID)
 		case "concede_battle":
 			err := srv.database.DeleteBattle(battleID, warriorID)
 			if err != nil {
 				badEvent = true
 				break
 			}
+			ops.publish("battle_ended", battleID, "")
 			msg = CreateSocketEvent("battle_conceded", "", "")
 		case "jab_warrior":
 			err := srv.database.ConfirmLeader(battleID, warriorID)
@@ -249,6 +1001,63 @@ func (s subscription) readPump(srv *server) {
 				badEvent = true
 				break
 			}
+			msg = CreateSocketEvent("jab_warrior", keyVal["value"], warriorID)
+		case "highlight":
+			// ephemeral facilitation event, broadcast the leaders focus without persisting it
+			err := srv.database.ConfirmLeader(battleID, warriorID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+
+			highlight, err := highlightEvent(keyVal["value"], warriorID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			msg = highlight
+		case "raise_hand":
+			hands, err := srv.database.RaiseHand(battleID, warriorID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedHands, _ := json.Marshal(hands)
+			msg = CreateSocketEvent("hands_updated", string(updatedHands), warriorID)
+		case "lower_hand":
+			// warriors lower their own hand, the leader anyone's by giving their id
+			HandWarriorID := warriorID
+			if keyVal["value"] != "" {
+				HandWarriorID = keyVal["value"]
+			}
+			hands, err := srv.database.LowerHand(battleID, warriorID, HandWarriorID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedHands, _ := json.Marshal(hands)
+			msg = CreateSocketEvent("hands_updated", string(updatedHands), warriorID)
+		case "clear_hands":
+			hands, err := srv.database.ClearRaisedHands(battleID, warriorID)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedHands, _ := json.Marshal(hands)
+			msg = CreateSocketEvent("hands_updated", string(updatedHands), warriorID)
+		case "reorder_hands":
+			var WarriorIDs []string
+			if err := json.Unmarshal([]byte(keyVal["value"]), &WarriorIDs); err != nil {
+				badEvent = true
+				break
+			}
+			hands, err := srv.database.ReorderRaisedHands(battleID, warriorID, WarriorIDs)
+			if err != nil {
+				badEvent = true
+				break
+			}
+			updatedHands, _ := json.Marshal(hands)
+			msg = CreateSocketEvent("hands_updated", string(updatedHands), warriorID)
 		case "abandon_battle":
 			_, err := srv.database.AbandonBattle(battleID, warriorID)
 			if err != nil {
@@ -258,12 +1067,20 @@ func (s subscription) readPump(srv *server) {
 			badEvent = true // don't want this event to cause write panic
 			forceClosed = true
 		default:
+			badEvent = true
 		}
 
 		if !badEvent {
 			m := message{msg, s.arena}
 			h.broadcast <- m
 		}
+		if badEvent && !forceClosed && !readOnlyEvents[keyVal["type"]] {
+			srv.eventFailed(battleID)
+		}
+		if unlock != nil {
+			unlock()
+			unlock = nil
+		}
 
 		if forceClosed {
 			break
@@ -289,9 +1106,10 @@ func (s *subscription) writePump() {
 		select {
 		case message, ok := <-c.send:
 			if !ok {
-				c.write(websocket.CloseMessage, []byte{})
+				c.write(websocket.CloseMessage, c.closeMessage)
 				return
 			}
+			c.dequeued(message)
 			if err := c.write(websocket.TextMessage, message); err != nil {
 				return
 			}
@@ -303,6 +1121,41 @@ func (s *subscription) writePump() {
 	}
 }
 
+// highlightEvent is the highlight_updated event scrolling everyone to the plan or point card the leader highlighted,
+// with only the plan and card of the leaders highlight
+func highlightEvent(value string, WarriorID string) ([]byte, error) {
+	var highlight struct {
+		PlanID    string `json:"planId"`
+		CardValue string `json:"cardValue"`
+	}
+	if err := json.Unmarshal([]byte(value), &highlight); err != nil {
+		return nil, err
+	}
+	updatedHighlight, _ := json.Marshal(highlight)
+
+	return CreateSocketEvent("highlight_updated", string(updatedHighlight), WarriorID), nil
+}
+
+// ephemeralEvents are the server events that aren't persisted, left out of battle recordings too
+var ephemeralEvents = map[string]bool{
+	"highlight_updated": true,
+}
+
+// recordBattleEvents persists the events broadcast to arenas so battles can be replayed
+func (s *server) recordBattleEvents(events <-chan recordedEvent) {
+	for e := range events {
+		var se SocketEvent
+		if err := json.Unmarshal(e.data, &se); err != nil {
+			log.Println(err)
+			continue
+		}
+		if ephemeralEvents[se.EventType] {
+			continue
+		}
+		_ = s.database.RecordBattleEvent(e.arena, e.seq, se.EventType, se.EventValue, se.EventWarrior)
+	}
+}
+
 // serveWs handles websocket requests from the peer.
 func (s *server) serveWs() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -315,9 +1168,22 @@ func (s *server) serveWs() http.HandlerFunc {
 			log.Println(err)
 			return
 		}
+		socketVersion := negotiateSocketVersion(r, ws.Subprotocol())
 
-		// make sure warrior cookies are valid
-		warriorID, cookieErr := s.validateWarriorCookie(w, r)
+		// make sure warrior cookies or bot api key are valid
+		var warriorID string
+		var cookieErr error
+		var isBot bool
+		apiKey := strings.TrimSpace(r.Header.Get(apiKeyHeaderName))
+		if apiKey != "" {
+			warriorID, cookieErr = s.database.ValidateAPIKey(apiKey)
+			isBot = cookieErr == nil && s.database.IsBattleBot(battleID, warriorID)
+			if !isBot {
+				cookieErr = errors.New("api key is not a battle bot")
+			}
+		} else {
+			warriorID, cookieErr = s.validateWarriorCookie(w, r)
+		}
 		if cookieErr != nil {
 			cm := websocket.FormatCloseMessage(4001, "unauthorized")
 			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
@@ -341,6 +1207,20 @@ func (s *server) serveWs() http.HandlerFunc {
 			}
 			return
 		}
+		// snapshot connections start with only the active plan, fetching the rest by page
+		snapshot := r.URL.Query().Get("snapshot") == "true"
+		if snapshot {
+			plans, _ := json.Marshal(b.Plans)
+			h.seed <- message{plans, battleID}
+
+			activePlans := make([]*database.Plan, 0)
+			for _, plan := range b.Plans {
+				if plan.PlanID == b.ActivePlanID {
+					activePlans = append(activePlans, plan)
+				}
+			}
+			b.Plans = activePlans
+		}
 		battle, _ := json.Marshal(b)
 
 		// make sure warrior exists
@@ -348,7 +1228,9 @@ func (s *server) serveWs() http.HandlerFunc {
 
 		if warErr != nil {
 			log.Println("error finding warrior : " + warErr.Error() + "\n")
-			s.clearWarriorCookies(w)
+			if !isBot {
+				s.clearWarriorCookies(w)
+			}
 			cm := websocket.FormatCloseMessage(4001, "unauthorized")
 			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
 				log.Printf("unauthorized close error: %v", err)
@@ -359,15 +1241,15 @@ func (s *server) serveWs() http.HandlerFunc {
 			return
 		}
 
-		c := &connection{send: make(chan []byte, 256), ws: ws}
-		ss := subscription{c, battleID, warriorID}
+		c := &connection{send: make(chan []byte, 256), ws: ws, version: socketVersion, bot: isBot, warriorID: warriorID, snapshot: snapshot}
+		ss := subscription{c, battleID, warriorID, b.ParentID}
 		h.register <- ss
 
 		Warriors, _ := s.database.AddWarriorToBattle(ss.arena, warriorID)
 		updatedWarriors, _ := json.Marshal(Warriors)
 
 		initEvent := CreateSocketEvent("init", string(battle), warriorID)
-		_ = c.write(websocket.TextMessage, initEvent)
+		_ = c.write(websocket.TextMessage, encodeSocketEvent(c.version, initEvent, 0))
 
 		joinedEvent := CreateSocketEvent("warrior_joined", string(updatedWarriors), warriorID)
 		m := message{joinedEvent, ss.arena}
@@ -377,3 +1259,87 @@ func (s *server) serveWs() http.HandlerFunc {
 		go ss.readPump(s)
 	}
 }
+
+// maxReplayGap is the longest a replay waits between events, so a battle left idle doesn't hold the socket for hours
+const maxReplayGap = 2 * time.Second
+
+// replayWait is how long a replay waits for an event recorded gap milliseconds after the previous one
+func replayWait(gap int64, speed float64) time.Duration {
+	wait := time.Duration(float64(gap)/speed) * time.Millisecond
+	if wait > maxReplayGap {
+		return maxReplayGap
+	}
+
+	return wait
+}
+
+// serveReplay plays back a recorded battle over a websocket with its original timing, idle gaps shortened,
+// the optional speed query param speeds up (or slows down) the playback
+func (s *server) serveReplay() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		battleID := vars["id"]
+
+		speed, err := strconv.ParseFloat(r.URL.Query().Get("speed"), 64)
+		if err != nil || speed <= 0 {
+			speed = 1
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer ws.Close()
+		c := &connection{ws: ws, version: negotiateSocketVersion(r, ws.Subprotocol())}
+
+		warriorID, cookieErr := s.validateWarriorCookie(w, r)
+		if cookieErr != nil {
+			cm := websocket.FormatCloseMessage(4001, "unauthorized")
+			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
+				log.Printf("unauthorized close error: %v", err)
+			}
+			return
+		}
+
+		events, err := s.database.GetBattleRecording(battleID, warriorID)
+		if err != nil {
+			cm := websocket.FormatCloseMessage(4004, "battle not found")
+			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
+				log.Printf("not found close error: %v", err)
+			}
+			return
+		}
+
+		// stop playback as soon as the viewer goes away
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		var lastOffset int64
+		for _, e := range events {
+			wait := replayWait(e.Offset-lastOffset, speed)
+			lastOffset = e.Offset
+
+			select {
+			case <-closed:
+				return
+			case <-time.After(wait):
+			}
+
+			event := CreateSocketEvent(e.Type, e.Value, e.WarriorID)
+			if err := c.write(websocket.TextMessage, encodeSocketEvent(c.version, event, e.Seq)); err != nil {
+				return
+			}
+		}
+
+		cm := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "replay finished")
+		_ = c.write(websocket.CloseMessage, cm)
+	}
+}
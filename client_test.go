@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+func TestNegotiateSocketVersionDefault(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/arena/test", nil)
+	v := negotiateSocketVersion(r, "")
+
+	if v != socketVersionLegacy {
+		t.Error("Expected 1, got ", v)
+	}
+}
+
+func TestNegotiateSocketVersionSubprotocol(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/arena/test?v=1", nil)
+	v := negotiateSocketVersion(r, "thunderdome.v2")
+
+	if v != socketVersionEnvelope {
+		t.Error("Expected 2, got ", v)
+	}
+}
+
+func TestNegotiateSocketVersionUnsupported(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/arena/test?v=99", nil)
+	v := negotiateSocketVersion(r, "")
+
+	if v != socketVersionLegacy {
+		t.Error("Expected 1, got ", v)
+	}
+}
+
+func TestEncodeSocketEventEnvelope(t *testing.T) {
+	event := CreateSocketEvent("plan_added", `[{"id":"abc"}]`, "")
+	var envelope SocketEnvelope
+	json.Unmarshal(encodeSocketEvent(socketVersionEnvelope, event, 7), &envelope)
+
+	if envelope.Version != 2 || envelope.EventType != "plan_added" || envelope.Seq != 7 {
+		t.Error("Unexpected envelope ", envelope)
+	}
+	if string(envelope.Payload) != `[{"id":"abc"}]` {
+		t.Error("Expected raw json payload, got ", string(envelope.Payload))
+	}
+}
+
+func TestDecodeSocketEventEnvelope(t *testing.T) {
+	eventType, eventValue, err := decodeSocketEvent([]byte(`{"v":2,"type":"activate_plan","payload":"abc"}`))
+
+	if err != nil || eventType != "activate_plan" || eventValue != "abc" {
+		t.Error("Unexpected decode ", eventType, eventValue, err)
+	}
+}
+
+func TestDecodeSocketEventLegacy(t *testing.T) {
+	eventType, eventValue, err := decodeSocketEvent([]byte(`{"type":"vote","value":"{\"planId\":\"abc\"}"}`))
+
+	if err != nil || eventType != "vote" || eventValue != `{"planId":"abc"}` {
+		t.Error("Unexpected decode ", eventType, eventValue, err)
+	}
+}
+
+func TestPlanDeltaEvent(t *testing.T) {
+	known := indexPlans([]byte(`[{"id":"a","points":""},{"id":"b","points":""}]`))
+	event := CreateSocketEvent("plan_finalized", `[{"id":"a","points":"3"},{"id":"c","points":""}]`, "")
+
+	var se SocketEvent
+	json.Unmarshal(planDeltaEvent(event, known), &se)
+	var delta PlanDelta
+	json.Unmarshal([]byte(se.EventValue), &delta)
+
+	if se.EventType != "plan_finalized" || delta.Total != 2 || len(delta.Plans) != 2 {
+		t.Error("Unexpected delta ", se.EventType, se.EventValue)
+	}
+	if len(delta.Removed) != 1 || delta.Removed[0] != "b" {
+		t.Error("Expected b removed, got ", delta.Removed)
+	}
+	if _, ok := known["b"]; ok || known["a"] != `{"id":"a","points":"3"}` {
+		t.Error("Known plans not updated ", known)
+	}
+}
+
+func TestPlanDeltaEventIgnoresOtherEvents(t *testing.T) {
+	event := CreateSocketEvent("leader_updated", "abc", "")
+
+	if planDeltaEvent(event, map[string]string{}) != nil {
+		t.Error("Expected nil for non plan list event")
+	}
+}
+
+func TestClientEventsExcludeServerEvents(t *testing.T) {
+	for EventType := range planListEvents {
+		if clientEvents[EventType] {
+			t.Error("Expected clients not to send the server event ", EventType)
+		}
+	}
+	for _, EventType := range []string{"highlight_updated", "breakout_activity", "vote_rejected", "unknown"} {
+		if clientEvents[EventType] {
+			t.Error("Expected clients not to send ", EventType)
+		}
+	}
+}
+
+func TestPlanConflict(t *testing.T) {
+	plans := []*database.Plan{
+		{PlanID: "a", Version: 2},
+		{PlanID: "b", Version: 5},
+	}
+	conflict := planConflict("b", plans)
+
+	if conflict.Version != 5 || conflict.Plan != plans[1] {
+		t.Error("Unexpected conflict ", conflict)
+	}
+}
+
+func TestConnectedWarriors(t *testing.T) {
+	hb := hub{arenas: map[string]map[*connection]bool{
+		"battle": {
+			&connection{warriorID: "one"}:            true,
+			&connection{warriorID: "one"}:            true,
+			&connection{warriorID: "two"}:            true,
+			&connection{warriorID: "bot", bot: true}: true,
+		},
+		"bots": {
+			&connection{warriorID: "bot", bot: true}: true,
+		},
+	}}
+
+	counts := hb.connectedWarriors([]string{"battle", "bots", "empty"})
+	if len(counts) != 1 || counts["battle"] != 2 {
+		t.Error("Expected only the battle with 2 warriors got ", counts)
+	}
+}
+
+func TestArenaLocks(t *testing.T) {
+	locks := &arenaLocks{locks: make(map[string]*arenaLock)}
+
+	unlock := locks.lock("battle")
+	locked := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		unlockSecond := locks.lock("battle")
+		locked <- true
+		unlockSecond()
+		close(done)
+	}()
+
+	// other arenas aren't held up
+	locks.lock("other")()
+
+	select {
+	case <-locked:
+		t.Fatal("Expected the second lock to wait for the first")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+	<-done
+
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if len(locks.locks) != 0 {
+		t.Error("Expected the unused locks to be removed got ", locks.locks)
+	}
+}
+
+func TestArenaBreakers(t *testing.T) {
+	breakers := &arenaBreakers{failures: make(map[string][]time.Time), open: make(map[string]bool)}
+	now := time.Now()
+
+	// failures spread over more than the window don't add up
+	breakers.fail("battle", now.Add(-time.Minute))
+	breakers.fail("battle", now.Add(-2*time.Second))
+	if breakers.fail("battle", now) || breakers.isOpen("battle") {
+		t.Fatal("Expected failures outside the window not to switch the arena to read only")
+	}
+	if !breakers.fail("battle", now.Add(time.Second)) || !breakers.isOpen("battle") {
+		t.Fatal("Expected the third failure within the window to switch the arena to read only")
+	}
+	if breakers.fail("battle", now.Add(2*time.Second)) {
+		t.Error("Expected a read only arena not to be switched again")
+	}
+	if breakers.isOpen("other") {
+		t.Error("Expected other arenas to stay writable")
+	}
+
+	breakers.close("battle")
+	if breakers.isOpen("battle") || breakers.fail("battle", now.Add(3*time.Second)) {
+		t.Error("Expected the arena to be writable with its failures forgotten once closed")
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	hb := &hub{limits: socketLimits{SendQueueSize: 10}}
+	c := &connection{send: make(chan []byte, 4)}
+
+	if !hb.enqueue(c, []byte("123456")) || !hb.enqueue(c, []byte("1234")) {
+		t.Fatal("Expected messages within the queue size to be queued")
+	}
+	if hb.enqueue(c, []byte("1")) || c.queued != 10 {
+		t.Fatal("Expected a message over the queue size not to be queued got ", c.queued)
+	}
+	c.dequeued(<-c.send)
+	if !hb.enqueue(c, []byte("12")) || c.queued != 6 {
+		t.Error("Expected written messages to free the queue got ", c.queued)
+	}
+
+	hb.drop(c)
+	for range c.send {
+	}
+	if len(c.closeMessage) == 0 {
+		t.Error("Expected a dropped connection to be told why")
+	}
+}
+
+func TestDeliverSlowRecorder(t *testing.T) {
+	hb := &hub{
+		arenas:   make(map[string]map[*connection]bool),
+		seq:      make(map[string]uint64),
+		plans:    make(map[string]map[string]string),
+		recorder: make(chan recordedEvent, 1),
+	}
+	dropped := recordingsDropped.Value()
+
+	// the recorder isn't reading, the second event is dropped rather than blocking the hub
+	hb.deliver(message{[]byte(`{}`), "b1"})
+	hb.deliver(message{[]byte(`{}`), "b1"})
+	if len(hb.recorder) != 1 || recordingsDropped.Value() != dropped+1 {
+		t.Error("Expected the event the recorder had no room for to be dropped got ", recordingsDropped.Value()-dropped)
+	}
+}
+
+func TestDeliverSkipsRecordingFederatedArenas(t *testing.T) {
+	hb := &hub{
+		arenas:   make(map[string]map[*connection]bool),
+		seq:      make(map[string]uint64),
+		plans:    make(map[string]map[string]string),
+		recorder: make(chan recordedEvent, 1),
+	}
+
+	hb.deliver(message{[]byte(`{}`), federatedArena("p1", "b1")})
+	if len(hb.recorder) != 0 {
+		t.Error("Expected an event relayed from a peer not to be recorded")
+	}
+}
+
+func TestHighlightEvent(t *testing.T) {
+	event, err := highlightEvent(`{"planId":"p1","cardValue":"5","extra":"<script>"}`, "w1")
+	expected := `{"type":"highlight_updated","value":"{\"planId\":\"p1\",\"cardValue\":\"5\"}","warriorId":"w1"}`
+	if err != nil || string(event) != expected {
+		t.Error("Expected only the plan and card highlighted got ", string(event), err)
+	}
+
+	if _, err := highlightEvent("p1", "w1"); err == nil {
+		t.Error("Expected a highlight that isn't an object to be refused")
+	}
+}
+
+// battleEventRecorderMock keeps the types of the recorded events
+type battleEventRecorderMock struct {
+	*database.Mock
+	recorded []string
+}
+
+func (m *battleEventRecorderMock) RecordBattleEvent(BattleID string, Seq uint64, EventType string, EventValue string, WarriorID string) error {
+	m.recorded = append(m.recorded, EventType)
+	return nil
+}
+
+func TestRecordBattleEventsSkipsEphemeral(t *testing.T) {
+	s, db := newMockServer()
+	mock := &battleEventRecorderMock{Mock: db}
+	s.database = mock
+
+	events := make(chan recordedEvent, 2)
+	events <- recordedEvent{message{CreateSocketEvent("highlight_updated", `{"planId":"p1"}`, "w1"), "b1"}, 1}
+	events <- recordedEvent{message{CreateSocketEvent("plan_added", `[]`, ""), "b1"}, 2}
+	close(events)
+	s.recordBattleEvents(events)
+
+	if len(mock.recorded) != 1 || mock.recorded[0] != "plan_added" {
+		t.Error("Expected only the persisted events to be recorded got ", mock.recorded)
+	}
+}
+
+func TestWarriorRates(t *testing.T) {
+	rates := &warriorRates{buckets: make(map[string]*rateBucket)}
+	limits := socketLimits{Rate: 2, Burst: 3}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !rates.allow("w1", limits, now) {
+			t.Fatal("Expected messages within the burst to be allowed")
+		}
+	}
+	if rates.allow("w1", limits, now) {
+		t.Fatal("Expected a message over the burst not to be allowed")
+	}
+	if !rates.allow("w2", limits, now) {
+		t.Error("Expected other warriors to have their own limit")
+	}
+	if !rates.allow("w1", limits, now.Add(500*time.Millisecond)) || rates.allow("w1", limits, now.Add(500*time.Millisecond)) {
+		t.Error("Expected the rate to allow one more message after half a second")
+	}
+
+	rates.allow("w3", limits, now.Add(2*time.Minute))
+	if _, ok := rates.buckets["w1"]; ok {
+		t.Error("Expected warriors whose limit refilled to be pruned")
+	}
+}
+
+func TestVoteAllowed(t *testing.T) {
+	s, db := newMockServer()
+	battle := &database.Battle{BattleID: "b1", PointValuesAllowed: []string{"1", "2", "3", "?", "☕"}}
+
+	tests := map[string]bool{"2": true, "?": true, "☕": true, "5": false, "": false, "<script>": false}
+	for vote, allowed := range tests {
+		if err := s.voteAllowed(battle, vote); (err == nil) != allowed {
+			t.Error("Expected vote ", vote, " allowed to be ", allowed, " got ", err)
+		}
+	}
+
+	// the organization stopped allowing coffee breaks after the battle was created
+	db.Defaults = &database.BattleDefaults{PointValuesAllowed: []string{"1", "2", "3", "?"}, SpecialCards: []string{"?"}}
+	if s.voteAllowed(battle, "☕") == nil || s.voteAllowed(battle, "?") != nil || s.voteAllowed(battle, "3") != nil {
+		t.Error("Expected only the special cards the defaults allow to be voted")
+	}
+}
+
+func TestReplayWait(t *testing.T) {
+	if wait := replayWait(1000, 1); wait != time.Second {
+		t.Error("Expected the recorded gap got ", wait)
+	}
+	if wait := replayWait(1000, 4); wait != 250*time.Millisecond {
+		t.Error("Expected the gap sped up got ", wait)
+	}
+	if wait := replayWait(int64(time.Hour/time.Millisecond), 1); wait != maxReplayGap {
+		t.Error("Expected an idle hour to be capped got ", wait)
+	}
+}
+
+func TestDeliverForgetsEmptyArenas(t *testing.T) {
+	hb := &hub{
+		arenas:  make(map[string]map[*connection]bool),
+		seq:     make(map[string]uint64),
+		parents: make(map[string]string),
+		plans:   make(map[string]map[string]string),
+	}
+
+	hb.deliver(message{CreateSocketEvent("plan_added", "[]", ""), "nobody-here"})
+	if _, ok := hb.seq["nobody-here"]; ok || len(hb.seq) != 0 {
+		t.Error("Expected no sequence kept for an arena without connections got ", hb.seq)
+	}
+}
@@ -22,6 +22,10 @@ func InitConfig() {
 	viper.SetDefault("http.frontend_cookie_name", "warrior")
 	viper.SetDefault("http.domain", "thunderdome.dev")
 	viper.SetDefault("http.path_prefix", "")
+	viper.SetDefault("http.access_log", false)
+	viper.SetDefault("http.slow_request_ms", 2000)
+	viper.SetDefault("http.slow_request_webhook", "")
+	viper.SetDefault("http.trusted_proxies", "")
 
 	viper.SetDefault("analytics.enabled", true)
 	viper.SetDefault("analytics.id", "UA-140245309-1")
@@ -43,7 +47,10 @@ func InitConfig() {
 	viper.SetDefault("config.defaultPointValues",
 		[]string{"1", "2", "3", "5", "8", "13", "?"})
 	viper.SetDefault("config.show_warrior_rank", false)
+	viper.SetDefault("config.gamification", false)
 	viper.SetDefault("config.avatar_service", "goadorable")
+	viper.SetDefault("config.avatar_cache_minutes", 60)
+	viper.SetDefault("config.avatar_requests_per_minute", 300)
 	viper.SetDefault("config.toast_timeout", 1000)
 	viper.SetDefault("config.allow_guests", true)
 	viper.SetDefault("config.allow_registration", true)
@@ -51,8 +58,62 @@ func InitConfig() {
 	viper.SetDefault("config.default_locale", "en")
 	viper.SetDefault("config.friendly_ui_verbs", false)
 	viper.SetDefault("config.allow_external_api", false)
+	viper.SetDefault("config.plan_split_threshold", "13")
+	viper.SetDefault("config.record_battles", true)
+	viper.SetDefault("config.link_previews", true)
+	viper.SetDefault("config.vote_change_policy", "overwrite")
+	viper.SetDefault("config.usage_report", true)
+	viper.SetDefault("config.battle_summary_email", true)
+	viper.SetDefault("config.api_audit_retention_days", 90)
+	viper.SetDefault("config.battle_retention_days", 0)
+	viper.SetDefault("config.vote_retention_days", 0)
+	viper.SetDefault("config.battle_history_days", 90)
+	viper.SetDefault("config.encryption_keys", "")
+	viper.SetDefault("config.diagnostics", false)
+	viper.SetDefault("config.sentry_dsn", "")
+	viper.SetDefault("config.update_check", true)
+
+	viper.SetDefault("inbound_email.address", "")
+	viper.SetDefault("inbound_email.secret", "")
+
+	viper.SetDefault("twilio.auth_token", "")
+	viper.SetDefault("twilio.phone_number", "")
+
+	viper.SetDefault("federation.instance_url", "")
+	viper.SetDefault("federation.key", "")
+
+	viper.SetDefault("moderation.words", "")
+	viper.SetDefault("moderation.words_file", "")
+	viper.SetDefault("moderation.api_url", "")
+	viper.SetDefault("moderation.api_key", "")
+
+	viper.SetDefault("storage.backend", "")
+	viper.SetDefault("storage.local_path", "data")
+	viper.SetDefault("storage.endpoint", "")
+	viper.SetDefault("storage.region", "")
+	viper.SetDefault("storage.bucket", "")
+	viper.SetDefault("storage.access_key", "")
+	viper.SetDefault("storage.secret_key", "")
+
+	viper.SetDefault("websocket.max_message_kb", 1024)
+	viper.SetDefault("websocket.send_queue_kb", 4096)
+	viper.SetDefault("websocket.rate_limit", 20)
+	viper.SetDefault("websocket.rate_burst", 60)
+
+	viper.SetDefault("telemetry.enabled", false)
+	viper.SetDefault("telemetry.endpoint", "")
+
+	viper.SetDefault("license.key", "")
+	viper.SetDefault("license.public_key", "")
 
 	viper.SetDefault("auth.method", "normal")
+	viper.SetDefault("auth.argon2.memory", 64*1024)
+	viper.SetDefault("auth.argon2.iterations", 3)
+	viper.SetDefault("auth.argon2.parallelism", 2)
+	viper.SetDefault("auth.trusted_networks", "")
+	viper.SetDefault("auth.login_attempts", 10)
+	viper.SetDefault("auth.trusted_login_attempts", 0)
+	viper.SetDefault("auth.login_window_minutes", 15)
 	viper.SetDefault("auth.ldap.url", "")
 	viper.SetDefault("auth.ldap.use_tls", true)
 	viper.SetDefault("auth.ldap.bindname", "")
@@ -61,6 +122,16 @@ func InitConfig() {
 	viper.SetDefault("auth.ldap.filter", "(&(objectClass=posixAccount)(mail=%s))")
 	viper.SetDefault("auth.ldap.mail_attr", "mail")
 	viper.SetDefault("auth.ldap.cn_attr", "cn")
+	viper.SetDefault("auth.oidc.issuer", "")
+	viper.SetDefault("auth.oidc.client_id", "")
+	viper.SetDefault("auth.oidc.client_secret", "")
+	viper.SetDefault("auth.oidc.scopes", "openid profile email")
+	viper.SetDefault("auth.oidc.name_claim", "name")
+	viper.SetDefault("auth.oidc.email_claim", "email")
+	viper.SetDefault("auth.oidc.allow_unverified_email", false)
+	viper.SetDefault("auth.header.trusted_proxies", "")
+	viper.SetDefault("auth.header.user_header", "X-Forwarded-User")
+	viper.SetDefault("auth.header.email_header", "X-Forwarded-Email")
 
 	viper.BindEnv("http.cookie_hashkey", "COOKIE_HASHKEY")
 	viper.BindEnv("http.port", "PORT")
@@ -69,6 +140,10 @@ func InitConfig() {
 	viper.BindEnv("http.frontend_cookie_name", "FRONTEND_COOKIE_NAME")
 	viper.BindEnv("http.domain", "APP_DOMAIN")
 	viper.BindEnv("http.path_prefix", "PATH_PREFIX")
+	viper.BindEnv("http.access_log", "HTTP_ACCESS_LOG")
+	viper.BindEnv("http.slow_request_ms", "HTTP_SLOW_REQUEST_MS")
+	viper.BindEnv("http.slow_request_webhook", "HTTP_SLOW_REQUEST_WEBHOOK")
+	viper.BindEnv("http.trusted_proxies", "HTTP_TRUSTED_PROXIES")
 
 	viper.BindEnv("analytics.enabled", "ANALYTICS_ENABLED")
 	viper.BindEnv("analytics.id", "ANALYTICS_ID")
@@ -92,7 +167,10 @@ func InitConfig() {
 	viper.BindEnv("config.allowedPointValues", "CONFIG_POINTS_ALLOWED")
 	viper.BindEnv("config.defaultPointValues", "CONFIG_POINTS_DEFAULT")
 	viper.BindEnv("config.show_warrior_rank", "CONFIG_SHOW_RANK")
+	viper.BindEnv("config.gamification", "CONFIG_GAMIFICATION")
 	viper.BindEnv("config.avatar_service", "CONFIG_AVATAR_SERVICE")
+	viper.BindEnv("config.avatar_cache_minutes", "CONFIG_AVATAR_CACHE_MINUTES")
+	viper.BindEnv("config.avatar_requests_per_minute", "CONFIG_AVATAR_REQUESTS_PER_MINUTE")
 	viper.BindEnv("config.toast_timeout", "CONFIG_TOAST_TIMEOUT")
 	viper.BindEnv("config.allow_guests", "CONFIG_ALLOW_GUESTS")
 	viper.BindEnv("config.allow_registration", "CONFIG_ALLOW_REGISTRATION")
@@ -100,8 +178,67 @@ func InitConfig() {
 	viper.BindEnv("config.default_locale", "CONFIG_DEFAULT_LOCALE")
 	viper.BindEnv("config.friendly_ui_verbs", "CONFIG_FRIENDLY_UI_VERBS")
 	viper.BindEnv("config.allow_external_api", "CONFIG_ALLOW_EXTERNAL_API")
+	viper.BindEnv("config.plan_split_threshold", "CONFIG_PLAN_SPLIT_THRESHOLD")
+	viper.BindEnv("config.record_battles", "CONFIG_RECORD_BATTLES")
+	viper.BindEnv("config.link_previews", "CONFIG_LINK_PREVIEWS")
+	viper.BindEnv("config.vote_change_policy", "CONFIG_VOTE_CHANGE_POLICY")
+	viper.BindEnv("config.usage_report", "CONFIG_USAGE_REPORT")
+	viper.BindEnv("config.battle_summary_email", "CONFIG_BATTLE_SUMMARY_EMAIL")
+	viper.BindEnv("config.api_audit_retention_days", "CONFIG_API_AUDIT_RETENTION_DAYS")
+	viper.BindEnv("config.battle_retention_days", "CONFIG_BATTLE_RETENTION_DAYS")
+	viper.BindEnv("config.vote_retention_days", "CONFIG_VOTE_RETENTION_DAYS")
+	viper.BindEnv("config.battle_history_days", "CONFIG_BATTLE_HISTORY_DAYS")
+	viper.BindEnv("config.encryption_keys", "CONFIG_ENCRYPTION_KEYS")
+	viper.BindEnv("config.diagnostics", "CONFIG_DIAGNOSTICS")
+	viper.BindEnv("config.sentry_dsn", "CONFIG_SENTRY_DSN")
+	viper.BindEnv("config.update_check", "CONFIG_UPDATE_CHECK")
+
+	viper.BindEnv("inbound_email.address", "INBOUND_EMAIL_ADDRESS")
+	viper.BindEnv("inbound_email.secret", "INBOUND_EMAIL_SECRET")
+
+	viper.BindEnv("twilio.auth_token", "TWILIO_AUTH_TOKEN")
+	viper.BindEnv("twilio.phone_number", "TWILIO_PHONE_NUMBER")
+
+	viper.BindEnv("federation.instance_url", "FEDERATION_INSTANCE_URL")
+	viper.BindEnv("federation.key", "FEDERATION_KEY")
+
+	viper.BindEnv("calendar.google_client_id", "CALENDAR_GOOGLE_CLIENT_ID")
+	viper.BindEnv("calendar.google_client_secret", "CALENDAR_GOOGLE_CLIENT_SECRET")
+	viper.BindEnv("calendar.microsoft_client_id", "CALENDAR_MICROSOFT_CLIENT_ID")
+	viper.BindEnv("calendar.microsoft_client_secret", "CALENDAR_MICROSOFT_CLIENT_SECRET")
+
+	viper.BindEnv("moderation.words", "MODERATION_WORDS")
+	viper.BindEnv("moderation.words_file", "MODERATION_WORDS_FILE")
+	viper.BindEnv("moderation.api_url", "MODERATION_API_URL")
+	viper.BindEnv("moderation.api_key", "MODERATION_API_KEY")
+
+	viper.BindEnv("storage.backend", "STORAGE_BACKEND")
+	viper.BindEnv("storage.local_path", "STORAGE_LOCAL_PATH")
+	viper.BindEnv("storage.endpoint", "STORAGE_ENDPOINT")
+	viper.BindEnv("storage.region", "STORAGE_REGION")
+	viper.BindEnv("storage.bucket", "STORAGE_BUCKET")
+	viper.BindEnv("storage.access_key", "STORAGE_ACCESS_KEY")
+	viper.BindEnv("storage.secret_key", "STORAGE_SECRET_KEY")
+
+	viper.BindEnv("websocket.max_message_kb", "WEBSOCKET_MAX_MESSAGE_KB")
+	viper.BindEnv("websocket.send_queue_kb", "WEBSOCKET_SEND_QUEUE_KB")
+	viper.BindEnv("websocket.rate_limit", "WEBSOCKET_RATE_LIMIT")
+	viper.BindEnv("websocket.rate_burst", "WEBSOCKET_RATE_BURST")
+
+	viper.BindEnv("telemetry.enabled", "TELEMETRY_ENABLED")
+	viper.BindEnv("telemetry.endpoint", "TELEMETRY_ENDPOINT")
+
+	viper.BindEnv("license.key", "LICENSE_KEY")
+	viper.BindEnv("license.public_key", "LICENSE_PUBLIC_KEY")
 
 	viper.BindEnv("auth.method", "AUTH_METHOD")
+	viper.BindEnv("auth.argon2.memory", "AUTH_ARGON2_MEMORY")
+	viper.BindEnv("auth.argon2.iterations", "AUTH_ARGON2_ITERATIONS")
+	viper.BindEnv("auth.argon2.parallelism", "AUTH_ARGON2_PARALLELISM")
+	viper.BindEnv("auth.trusted_networks", "AUTH_TRUSTED_NETWORKS")
+	viper.BindEnv("auth.login_attempts", "AUTH_LOGIN_ATTEMPTS")
+	viper.BindEnv("auth.trusted_login_attempts", "AUTH_TRUSTED_LOGIN_ATTEMPTS")
+	viper.BindEnv("auth.login_window_minutes", "AUTH_LOGIN_WINDOW_MINUTES")
 	viper.BindEnv("auth.ldap.url", "AUTH_LDAP_URL")
 	viper.BindEnv("auth.ldap.use_tls", "AUTH_LDAP_USE_TLS")
 	viper.BindEnv("auth.ldap.bindname", "AUTH_LDAP_BINDNAME")
@@ -110,6 +247,16 @@ func InitConfig() {
 	viper.BindEnv("auth.ldap.filter", "AUTH_LDAP_FILTER")
 	viper.BindEnv("auth.ldap.mail_attr", "AUTH_LDAP_MAIL_ATTR")
 	viper.BindEnv("auth.ldap.cn_attr", "AUTH_LDAP_CN_ATTR")
+	viper.BindEnv("auth.oidc.issuer", "AUTH_OIDC_ISSUER")
+	viper.BindEnv("auth.oidc.client_id", "AUTH_OIDC_CLIENT_ID")
+	viper.BindEnv("auth.oidc.client_secret", "AUTH_OIDC_CLIENT_SECRET")
+	viper.BindEnv("auth.oidc.scopes", "AUTH_OIDC_SCOPES")
+	viper.BindEnv("auth.oidc.name_claim", "AUTH_OIDC_NAME_CLAIM")
+	viper.BindEnv("auth.oidc.email_claim", "AUTH_OIDC_EMAIL_CLAIM")
+	viper.BindEnv("auth.oidc.allow_unverified_email", "AUTH_OIDC_ALLOW_UNVERIFIED_EMAIL")
+	viper.BindEnv("auth.header.trusted_proxies", "AUTH_HEADER_TRUSTED_PROXIES")
+	viper.BindEnv("auth.header.user_header", "AUTH_HEADER_USER_HEADER")
+	viper.BindEnv("auth.header.email_header", "AUTH_HEADER_EMAIL_HEADER")
 
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/spf13/viper"
+)
+
+// specialCard reports whether the point value isn't a number or fraction, like ? or a coffee cup
+func specialCard(Value string) bool {
+	parts := strings.SplitN(Value, "/", 2)
+	for _, part := range parts {
+		if _, err := strconv.ParseFloat(part, 64); err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// battleDefaults gets the battle defaults of the team's domain, or the organization's when the team has none,
+// those of the config until an admin sets them
+func (s *server) battleDefaults(TeamID string) *database.BattleDefaults {
+	if TeamID != "" {
+		for _, td := range s.teamDomains() {
+			if td.TeamID == TeamID && td.Defaults != nil {
+				return td.Defaults
+			}
+		}
+	}
+	if d, err := s.database.GetBattleDefaults(); err == nil && d != nil {
+		return d
+	}
+
+	return &database.BattleDefaults{
+		PointValuesAllowed:  viper.GetStringSlice("config.defaultPointValues"),
+		AutoFinishVoting:    true,
+		SpecialCards:        make([]string, 0),
+		Locked:              make([]string, 0),
+		BattleRetentionDays: viper.GetInt("config.battle_retention_days"),
+		VoteRetentionDays:   viper.GetInt("config.vote_retention_days"),
+	}
+}
+
+// applyBattleDefaults fills in the battle settings left out with the organization's defaults, replaces those it
+// locked and drops the special cards it doesn't allow, failing when only disallowed special cards were left
+func applyBattleDefaults(d *database.BattleDefaults, PointValuesAllowed []string, AutoFinishVoting *bool) ([]string, bool, error) {
+	if len(PointValuesAllowed) == 0 || contains(d.Locked, database.BattleDefaultPointValues) {
+		PointValuesAllowed = d.PointValuesAllowed
+	}
+	AutoFinish := d.AutoFinishVoting
+	if AutoFinishVoting != nil && !contains(d.Locked, database.BattleDefaultAutoFinishVoting) {
+		AutoFinish = *AutoFinishVoting
+	}
+
+	if len(d.SpecialCards) > 0 {
+		allowed := make([]string, 0, len(PointValuesAllowed))
+		for _, v := range PointValuesAllowed {
+			if !specialCard(v) || contains(d.SpecialCards, v) {
+				allowed = append(allowed, v)
+			}
+		}
+		if len(allowed) == 0 {
+			return nil, false, errors.New("no point values allowed")
+		}
+		PointValuesAllowed = allowed
+	}
+
+	return PointValuesAllowed, AutoFinish, nil
+}
+
+// validateBattleDefaults checks the defaults only use allowed point values and special cards
+func validateBattleDefaults(d *database.BattleDefaults) error {
+	if d.SpecialCards == nil {
+		d.SpecialCards = make([]string, 0)
+	}
+	if d.Locked == nil {
+		d.Locked = make([]string, 0)
+	}
+
+	AllowedPointValues := viper.GetStringSlice("config.allowedPointValues")
+	if len(d.PointValuesAllowed) == 0 {
+		return errors.New("pointValuesAllowed can't be empty")
+	}
+	for _, v := range d.PointValuesAllowed {
+		if !contains(AllowedPointValues, v) {
+			return errors.New("point value " + v + " isn't allowed")
+		}
+	}
+	for _, v := range d.SpecialCards {
+		if !specialCard(v) || !contains(AllowedPointValues, v) {
+			return errors.New(v + " isn't an allowed special card")
+		}
+	}
+	for _, l := range d.Locked {
+		if l != database.BattleDefaultPointValues && l != database.BattleDefaultAutoFinishVoting {
+			return errors.New(l + " can't be locked")
+		}
+	}
+	if d.BattleRetentionDays < 0 || d.VoteRetentionDays < 0 {
+		return errors.New("retention days can't be negative")
+	}
+	if _, _, err := applyBattleDefaults(d, nil, nil); err != nil {
+		return errors.New("pointValuesAllowed are all special cards that aren't allowed")
+	}
+
+	return nil
+}
+
+// handleBattleDefaultsGet gets the defaults battles are created with and which of them can't be changed,
+// those of the team given by ?teamId= or the one the request came in for
+func (s *server) handleBattleDefaultsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		RespondWithJSON(w, http.StatusOK, s.battleDefaults(requestTeamID(r, r.URL.Query().Get("teamId"))))
+	}
+}
+
+// handleBattleDefaultsUpdate handles an admin setting the organization's battle defaults
+func (s *server) handleBattleDefaultsUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+
+		var d database.BattleDefaults
+		if err := json.Unmarshal(body, &d); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := validateBattleDefaults(&d); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if err := s.database.SetBattleDefaults(&d, warriorID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, d)
+	}
+}
+
+// applyRetention runs the organization's retention, when it keeps battles or votes for a limited time
+func (s *server) applyRetention() error {
+	d := s.battleDefaults("")
+	if d.BattleRetentionDays == 0 && d.VoteRetentionDays == 0 {
+		return nil
+	}
+	_, err := s.database.ApplyRetention(d.BattleRetentionDays, d.VoteRetentionDays)
+
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/spf13/viper"
+)
+
+func TestSpecialCard(t *testing.T) {
+	tests := map[string]bool{
+		"0":   false,
+		"13":  false,
+		"1/2": false,
+		"0.5": false,
+		"?":   true,
+		"☕":   true,
+		"XL":  true,
+		"1/?": true,
+	}
+	for value, special := range tests {
+		if specialCard(value) != special {
+			t.Error("Expected ", value, " special to be ", special)
+		}
+	}
+}
+
+func TestApplyBattleDefaults(t *testing.T) {
+	yes, no := true, false
+	open := &database.BattleDefaults{PointValuesAllowed: []string{"1", "2", "3", "?"}, AutoFinishVoting: true}
+	locked := &database.BattleDefaults{
+		PointValuesAllowed: []string{"1", "2", "3", "?"},
+		AutoFinishVoting:   true,
+		SpecialCards:       []string{"?"},
+		Locked:             []string{database.BattleDefaultPointValues, database.BattleDefaultAutoFinishVoting},
+	}
+	noCoffee := &database.BattleDefaults{PointValuesAllowed: []string{"1", "2"}, SpecialCards: []string{"?"}}
+
+	tests := []struct {
+		defaults   *database.BattleDefaults
+		points     []string
+		autoFinish *bool
+		wantPoints []string
+		wantFinish bool
+		wantErr    bool
+	}{
+		{open, nil, nil, []string{"1", "2", "3", "?"}, true, false},
+		{open, []string{"5", "8", "☕"}, &no, []string{"5", "8", "☕"}, false, false},
+		{locked, []string{"5", "8"}, &no, []string{"1", "2", "3", "?"}, true, false},
+		{noCoffee, []string{"5", "?", "☕"}, &yes, []string{"5", "?"}, true, false},
+		{noCoffee, []string{"☕"}, nil, nil, false, true},
+	}
+	for _, tt := range tests {
+		points, autoFinish, err := applyBattleDefaults(tt.defaults, tt.points, tt.autoFinish)
+		if (err != nil) != tt.wantErr {
+			t.Error("Expected ", tt.points, " error to be ", tt.wantErr, " got ", err)
+			continue
+		}
+		if !tt.wantErr && (!reflect.DeepEqual(points, tt.wantPoints) || autoFinish != tt.wantFinish) {
+			t.Error("Expected ", tt.points, " to become ", tt.wantPoints, tt.wantFinish, " got ", points, autoFinish)
+		}
+	}
+}
+
+func TestHandleBattleDefaultsUpdate(t *testing.T) {
+	s, db := newMockServer()
+	handler := s.adminOnly(s.handleBattleDefaultsUpdate())
+	viper.Set("config.allowedPointValues", []string{"1", "2", "3", "5", "?", "☕"})
+	defer viper.Set("config.allowedPointValues", nil)
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"pointValuesAllowed": ["1", "2", "3", "?"], "specialCards": ["?"], "locked": ["pointValuesAllowed"], "battleRetentionDays": 365}`, http.StatusOK},
+		{`{"pointValuesAllowed": ["1", "100"]}`, http.StatusBadRequest},
+		{`{"pointValuesAllowed": []}`, http.StatusBadRequest},
+		{`{"pointValuesAllowed": ["1"], "specialCards": ["5"]}`, http.StatusBadRequest},
+		{`{"pointValuesAllowed": ["☕"], "specialCards": ["?"]}`, http.StatusBadRequest},
+		{`{"pointValuesAllowed": ["1"], "locked": ["timezone"]}`, http.StatusBadRequest},
+		{`{"pointValuesAllowed": ["1"], "voteRetentionDays": -1}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/api/admin/defaults", strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, "admin1")
+		handler(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if db.Defaults == nil || db.Defaults.BattleRetentionDays != 365 || s.battleDefaults("") != db.Defaults {
+		t.Error("Expected the valid defaults to be saved got ", db.Defaults)
+	}
+}
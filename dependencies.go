@@ -0,0 +1,50 @@
+package main
+
+import "github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+
+// dependencyCycle checks whether following the plans dependencies ever leads back to a plan already on the way
+func dependencyCycle(Dependencies map[string][]string) bool {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+
+	var visit func(PlanID string) bool
+	visit = func(PlanID string) bool {
+		switch state[PlanID] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[PlanID] = visiting
+		for _, DependsOn := range Dependencies[PlanID] {
+			if visit(DependsOn) {
+				return true
+			}
+		}
+		state[PlanID] = done
+
+		return false
+	}
+
+	for PlanID := range Dependencies {
+		if visit(PlanID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// planDependencies gets the dependencies of the plans with the plan's replaced by those given
+func planDependencies(Plans []*database.Plan, PlanID string, DependsOn []string) map[string][]string {
+	dependencies := make(map[string][]string)
+	for _, p := range Plans {
+		dependencies[p.PlanID] = p.DependsOn
+	}
+	dependencies[PlanID] = DependsOn
+
+	return dependencies
+}
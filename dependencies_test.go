@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+func TestDependencyCycle(t *testing.T) {
+	tests := []struct {
+		dependencies map[string][]string
+		want         bool
+	}{
+		{map[string][]string{}, false},
+		{map[string][]string{"b": {"a"}, "c": {"a", "b"}}, false},
+		{map[string][]string{"a": {"a"}}, true},
+		{map[string][]string{"a": {"c"}, "b": {"a"}, "c": {"b"}}, true},
+	}
+	for _, tt := range tests {
+		if got := dependencyCycle(tt.dependencies); got != tt.want {
+			t.Error("Expected ", tt.dependencies, " to have a cycle ", tt.want, " got ", got)
+		}
+	}
+}
+
+func TestPlanDependencies(t *testing.T) {
+	plans := []*database.Plan{
+		{PlanID: "p1", DependsOn: []string{}},
+		{PlanID: "p2", DependsOn: []string{"p1"}},
+	}
+	if !dependencyCycle(planDependencies(plans, "p1", []string{"p2"})) {
+		t.Error("Expected making the plan depend on its dependent to be a cycle")
+	}
+	if dependencyCycle(planDependencies(plans, "p2", []string{})) {
+		t.Error("Expected clearing the dependencies not to be a cycle")
+	}
+}
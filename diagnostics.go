@@ -0,0 +1,61 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+)
+
+// maxProfileSeconds is the longest a CPU profile or trace runs, pprof's 30 second default would outlast the
+// server's 15 second write timeout and always come back truncated
+const maxProfileSeconds = 10
+
+// capProfileSeconds runs the profile for the seconds asked for up to maxProfileSeconds, or the default seconds
+// when not asked for
+func capProfileSeconds(next http.HandlerFunc, Default int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		seconds, err := strconv.Atoi(q.Get("seconds"))
+		if err != nil || seconds <= 0 {
+			seconds = Default
+		}
+		if seconds > maxProfileSeconds {
+			seconds = maxProfileSeconds
+		}
+		q.Set("seconds", strconv.Itoa(seconds))
+		r.URL.RawQuery = q.Encode()
+		next(w, r)
+	}
+}
+
+// hub figures published with expvar, read from the live view totals the hub keeps up to date
+func init() {
+	expvar.Publish("hub", expvar.Func(func() interface{} {
+		ops.mu.Lock()
+		defer ops.mu.Unlock()
+
+		return map[string]int{
+			"arenas":      ops.arenas,
+			"connections": ops.connections,
+			"liveViews":   len(ops.subscribers),
+		}
+	}))
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// diagnosticsRoutes exposes pprof profiles at /debug/pprof/ and expvar at /debug/vars to admins
+func (s *server) diagnosticsRoutes() {
+	// pprof finds the profile by the path after /debug/pprof/
+	profiles := http.StripPrefix(s.config.PathPrefix, http.HandlerFunc(pprof.Index))
+
+	s.router.HandleFunc("/debug/pprof/cmdline", s.adminOnly(pprof.Cmdline))
+	s.router.HandleFunc("/debug/pprof/profile", s.adminOnly(capProfileSeconds(pprof.Profile, maxProfileSeconds)))
+	s.router.HandleFunc("/debug/pprof/symbol", s.adminOnly(pprof.Symbol))
+	s.router.HandleFunc("/debug/pprof/trace", s.adminOnly(capProfileSeconds(pprof.Trace, 1)))
+	s.router.PathPrefix("/debug/pprof/").HandlerFunc(s.adminOnly(profiles.ServeHTTP))
+	s.router.Handle("/debug/vars", s.adminOnly(expvar.Handler().ServeHTTP))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCapProfileSeconds(t *testing.T) {
+	var seconds string
+	handler := capProfileSeconds(func(w http.ResponseWriter, r *http.Request) {
+		seconds = r.URL.Query().Get("seconds")
+	}, maxProfileSeconds)
+
+	tests := map[string]string{
+		"/debug/pprof/profile":            "10",
+		"/debug/pprof/profile?seconds=5":  "5",
+		"/debug/pprof/profile?seconds=30": "10",
+		"/debug/pprof/profile?seconds=-1": "10",
+	}
+	for target, want := range tests {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+		if seconds != want {
+			t.Error("Expected ", target, " to profile for ", want, " seconds got ", seconds)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+// the places a plan being added can already be
+const (
+	planDuplicateBattle     = "battle"
+	planDuplicateParkingLot = "parkingLot"
+)
+
+// planDuplicate is the plan that a plan being added matches by reference id, or by name without one
+type planDuplicate struct {
+	PlanID      string `json:"id"`
+	PlanName    string `json:"name"`
+	ReferenceID string `json:"referenceId"`
+	// Source is where the plan is, the battle or its team's parking lot to pull it from instead
+	Source string `json:"source"`
+}
+
+// planDuplicateAck is the value of the plan_duplicate socket event whispered back instead of adding the plan
+type planDuplicateAck struct {
+	Plan      map[string]string `json:"plan"`
+	Duplicate *planDuplicate    `json:"duplicate"`
+}
+
+// parkedPlans are the parked plans as plans to look for duplicates among
+func parkedPlans(Parked []*database.ParkedPlan) []*database.Plan {
+	Plans := make([]*database.Plan, 0, len(Parked))
+	for _, p := range Parked {
+		Plans = append(Plans, &database.Plan{PlanID: p.ParkedPlanID, PlanName: p.PlanName, ReferenceID: p.ReferenceID})
+	}
+
+	return Plans
+}
+
+// findPlanDuplicate finds the plan of the battle, or of its team's parking lot, the plan being added would duplicate
+func (s *server) findPlanDuplicate(BattleID string, WarriorID string, Name string, ReferenceID string) *planDuplicate {
+	battle, err := s.database.GetBattle(BattleID, WarriorID)
+	if err != nil {
+		return nil
+	}
+	if p := duplicatePlan(battle.Plans, Name, ReferenceID); p != nil {
+		return &planDuplicate{PlanID: p.PlanID, PlanName: p.PlanName, ReferenceID: p.ReferenceID, Source: planDuplicateBattle}
+	}
+	if battle.TeamID == "" {
+		return nil
+	}
+	if p := duplicatePlan(parkedPlans(s.database.GetTeamParkedPlans(battle.TeamID)), Name, ReferenceID); p != nil {
+		return &planDuplicate{PlanID: p.PlanID, PlanName: p.PlanName, ReferenceID: p.ReferenceID, Source: planDuplicateParkingLot}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// duplicatesMock has a team with a plan waiting in its parking lot
+type duplicatesMock struct {
+	*database.Mock
+	parked []string
+}
+
+func (m *duplicatesMock) GetTeamParkedPlans(TeamID string) []*database.ParkedPlan {
+	return []*database.ParkedPlan{{ParkedPlanID: "pp1", PlanName: "Search", ReferenceID: "ENG-3"}}
+}
+
+func (m *duplicatesMock) ParkTeamPlan(TeamID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string) ([]*database.ParkedPlan, error) {
+	m.parked = append(m.parked, PlanName)
+	return m.GetTeamParkedPlans(TeamID), nil
+}
+
+func TestFindPlanDuplicate(t *testing.T) {
+	s, db := newMockServer()
+	db.Battles["b1"].TeamID = "t1"
+	db.Battles["b1"].Plans = []*database.Plan{{PlanID: "p1", PlanName: "Login page", ReferenceID: "ENG-1"}}
+	s.database = &duplicatesMock{Mock: db}
+
+	tests := []struct {
+		name        string
+		referenceID string
+		id          string
+		source      string
+	}{
+		{"Sign in", "eng-1", "p1", planDuplicateBattle},
+		{" login  PAGE", "", "p1", planDuplicateBattle},
+		{"Find things", "ENG-3", "pp1", planDuplicateParkingLot},
+		{"Login page", "ENG-2", "", ""},
+	}
+	for _, tt := range tests {
+		duplicate := s.findPlanDuplicate("b1", "w1", tt.name, tt.referenceID)
+		if tt.id == "" {
+			if duplicate != nil {
+				t.Error("Expected ", tt.name, " not to be a duplicate got ", duplicate)
+			}
+			continue
+		}
+		if duplicate == nil || duplicate.PlanID != tt.id || duplicate.Source != tt.source {
+			t.Error("Expected ", tt.name, " to duplicate ", tt.id, " got ", duplicate)
+		}
+	}
+}
+
+func TestHandleTeamParkedPlanAddDuplicate(t *testing.T) {
+	s, db := newMockServer()
+	mock := &duplicatesMock{Mock: db}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/team/{teamId}/parking-lot", s.handleTeamParkedPlanAdd())
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"planName": "Find things", "referenceId": "ENG-3"}`, http.StatusConflict},
+		{`{"planName": "Find things", "referenceId": "ENG-3", "allowDuplicate": true}`, http.StatusOK},
+		{`{"planName": "Login"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/api/team/t1/parking-lot", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+		if w.Code == http.StatusConflict && !strings.Contains(w.Body.String(), `"id":"pp1"`) {
+			t.Error("Expected the parked plan it duplicates got ", w.Body.String())
+		}
+	}
+	if strings.Join(mock.parked, ",") != "Find things,Login" {
+		t.Error("Unexpected plans parked ", mock.parked)
+	}
+}
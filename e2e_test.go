@@ -0,0 +1,214 @@
+//go:build e2e
+// +build e2e
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+// the end to end tests run the real handlers and websockets against the database configured through the
+// usual DB_ environment, see make e2e which starts a throwaway Postgres for them
+
+// hubRunning starts the hub once for all the tests
+var hubRunning sync.Once
+
+type e2eClient struct {
+	t      *testing.T
+	url    string
+	cookie string
+}
+
+// post sends the JSON body decoding the response into out, keeping the warrior cookie it's given
+func (c *e2eClient) post(path string, body interface{}, out interface{}) {
+	payload, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, c.url+path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if c.cookie != "" {
+		req.Header.Set("Cookie", c.cookie)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("POST %s responded %s", path, resp.Status)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == viper.GetString("http.backend_cookie_name") {
+			c.cookie = cookie.Name + "=" + cookie.Value
+		}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// arena joins the battle's websocket
+func (c *e2eClient) arena(BattleID string) *websocket.Conn {
+	header := http.Header{}
+	header.Set("Cookie", c.cookie)
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(c.url, "http")+"/api/arena/"+BattleID, header)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return ws
+}
+
+// await reads events until one of the type arrives, decoding its value into out
+func await(t *testing.T, ws *websocket.Conn, EventType string, out interface{}) {
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		var event SocketEvent
+		if err := ws.ReadJSON(&event); err != nil {
+			t.Fatalf("waiting for %s : %v", EventType, err)
+		}
+		if event.EventType == EventType {
+			if out != nil {
+				if err := json.Unmarshal([]byte(event.EventValue), out); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// send sends a socket event with a value that's either a string or marshaled to one
+func send(t *testing.T, ws *websocket.Conn, EventType string, value interface{}) {
+	v, ok := value.(string)
+	if !ok {
+		b, _ := json.Marshal(value)
+		v = string(b)
+	}
+	if err := ws.WriteJSON(map[string]string{"type": EventType, "value": v}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestE2EBattle(t *testing.T) {
+	InitConfig()
+	s := newServer()
+	hubRunning.Do(func() { go h.run() })
+
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	c := &e2eClient{t: t, url: srv.URL}
+	email := fmt.Sprintf("e2e-%d@thunderdome.dev", time.Now().UnixNano())
+
+	var enlisted database.Warrior
+	c.post("/api/enlist", map[string]string{
+		"warriorName":      "E2E Leader",
+		"warriorEmail":     email,
+		"warriorPassword1": "e2e-password",
+		"warriorPassword2": "e2e-password",
+	}, &enlisted)
+
+	// logging in again with the password rather than relying on the cookie from enlisting
+	c.cookie = ""
+	var warrior database.Warrior
+	c.post("/api/auth", map[string]string{"warriorEmail": email, "warriorPassword": "e2e-password"}, &warrior)
+	if warrior.WarriorID != enlisted.WarriorID || c.cookie == "" {
+		t.Fatal("Expected to be logged in as the enlisted warrior got ", warrior.WarriorID)
+	}
+
+	var battle database.Battle
+	c.post("/api/battle", map[string]interface{}{
+		"battleName":         "E2E Battle",
+		"pointValuesAllowed": []string{"1", "2", "3", "5", "8"},
+		"plans":              []map[string]string{{"name": "E2E Plan", "type": "Story"}},
+	}, &battle)
+	if battle.BattleID == "" || len(battle.Plans) != 1 {
+		t.Fatal("Expected the battle with its plan got ", battle)
+	}
+	PlanID := battle.Plans[0].PlanID
+
+	ws := c.arena(battle.BattleID)
+	await(t, ws, "init", nil)
+
+	send(t, ws, "activate_plan", PlanID)
+	await(t, ws, "plan_activated", nil)
+
+	send(t, ws, "vote", map[string]interface{}{"planId": PlanID, "voteValue": "5"})
+	var plans []*database.Plan
+	await(t, ws, "vote_activity", &plans)
+	if len(plans[0].Votes) != 1 {
+		t.Fatal("Expected the vote to be counted got ", plans[0].Votes)
+	}
+
+	send(t, ws, "end_voting", PlanID)
+	await(t, ws, "voting_ended", nil)
+
+	send(t, ws, "finalize_plan", map[string]string{"planId": PlanID, "planPoints": "5"})
+	await(t, ws, "plan_finalized", nil)
+	ws.Close()
+
+	// rejoining loads the battle from the database rather than the events that were broadcast
+	ws = c.arena(battle.BattleID)
+	defer ws.Close()
+	var rejoined database.Battle
+	await(t, ws, "init", &rejoined)
+	if len(rejoined.Plans) != 1 || rejoined.Plans[0].Points != "5" || len(rejoined.Plans[0].Votes) != 1 {
+		t.Error("Expected the plan to be pointed 5 with the vote kept got ", rejoined.Plans)
+	}
+}
+
+func TestE2EBreakoutLeaderMustJoin(t *testing.T) {
+	InitConfig()
+	s := newServer()
+	hubRunning.Do(func() { go h.run() })
+
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	c := &e2eClient{t: t, url: srv.URL}
+	var warrior database.Warrior
+	c.post("/api/enlist", map[string]string{
+		"warriorName":      "E2E Leader",
+		"warriorEmail":     fmt.Sprintf("e2e-%d@thunderdome.dev", time.Now().UnixNano()),
+		"warriorPassword1": "e2e-password",
+		"warriorPassword2": "e2e-password",
+	}, &warrior)
+
+	var battle database.Battle
+	c.post("/api/battle", map[string]interface{}{
+		"battleName":         "E2E Breakouts",
+		"pointValuesAllowed": []string{"1", "2", "3", "5", "8"},
+		"plans":              []map[string]string{{"name": "E2E Plan", "type": "Story"}},
+	}, &battle)
+
+	ws := c.arena(battle.BattleID)
+	defer ws.Close()
+	await(t, ws, "init", nil)
+
+	// a warrior that never joined the battle is refused, then the leader's own breakout goes through
+	send(t, ws, "create_breakouts", []map[string]interface{}{
+		{"name": "Outsiders", "leaderId": "00000000-0000-0000-0000-000000000001", "planIds": []string{battle.Plans[0].PlanID}},
+	})
+	send(t, ws, "create_breakouts", []map[string]interface{}{
+		{"name": "Insiders", "leaderId": warrior.WarriorID, "planIds": []string{battle.Plans[0].PlanID}},
+	})
+	var breakouts []*database.Breakout
+	await(t, ws, "breakouts_created", &breakouts)
+	if len(breakouts) != 1 || breakouts[0].Name != "Insiders" || breakouts[0].LeaderID != warrior.WarriorID {
+		t.Error("Expected only the breakout led by a warrior of the battle got ", breakouts)
+	}
+}
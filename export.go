@@ -0,0 +1,425 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// BattleExportSummary is the summary.json of a warriors battles export
+type BattleExportSummary struct {
+	WarriorID    string                `json:"warriorId"`
+	WarriorName  string                `json:"warriorName"`
+	ExportedDate time.Time             `json:"exportedDate"`
+	Battles      []*BattleExportRecord `json:"battles"`
+}
+
+// BattleExportRecord describes a battle in the export summary and which file holds its plans
+type BattleExportRecord struct {
+	BattleID     string `json:"id"`
+	BattleName   string `json:"name"`
+	Leader       bool   `json:"leader"`
+	PlanCount    int    `json:"planCount"`
+	PointedCount int    `json:"pointedPlanCount"`
+	File         string `json:"file"`
+	NotesFile    string `json:"notesFile,omitempty"`
+}
+
+// battlePlansCSV writes the battles plans as csv including the warriors own vote on each, the plans each depends on
+// the plan each was split from and its clarification questions as refinement notes, with when voting on each ended
+// in the battles time zone
+func battlePlansCSV(plans []*database.Plan, WarriorID string, loc *time.Location) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+
+	names := make(map[string]string, len(plans))
+	for _, p := range plans {
+		names[p.PlanID] = p.PlanName
+	}
+
+	_ = cw.Write([]string{"Plan", "Type", "Reference ID", "Link", "Points", "Skipped", "Votes", "Your Vote", "Depends On", "Split", "Split From", "Refinement Notes", "Voted At"})
+	for _, p := range plans {
+		var vote string
+		for _, v := range p.Votes {
+			if v.WarriorID == WarriorID {
+				vote = v.VoteValue
+			}
+		}
+		var votedAt string
+		if !p.VoteEndTime.IsZero() {
+			votedAt = p.VoteEndTime.In(loc).Format(time.RFC3339)
+		}
+		dependsOn := make([]string, 0, len(p.DependsOn))
+		for _, PlanID := range p.DependsOn {
+			dependsOn = append(dependsOn, names[PlanID])
+		}
+		_ = cw.Write([]string{
+			p.PlanName,
+			p.Type,
+			p.ReferenceID,
+			p.Link,
+			p.Points,
+			strconv.FormatBool(p.PlanSkipped),
+			strconv.Itoa(len(p.Votes)),
+			vote,
+			strings.Join(dependsOn, "; "),
+			strconv.FormatBool(p.Split),
+			names[p.ParentID],
+			refinementNotes(p.Questions),
+			votedAt,
+		})
+	}
+	cw.Flush()
+
+	return buf.Bytes(), cw.Error()
+}
+
+// refinementNotes are the plans clarification questions a line each, followed by the answer of resolved ones
+func refinementNotes(questions []*database.PlanQuestion) string {
+	notes := make([]string, 0, len(questions))
+	for _, q := range questions {
+		if q.Resolved && q.Answer != "" {
+			notes = append(notes, q.Question+" - "+q.Answer)
+		} else {
+			notes = append(notes, q.Question)
+		}
+	}
+
+	return strings.Join(notes, "\n")
+}
+
+// writeBattlesExport writes a zip of a csv per battle and the notes of those that have them along with a summary.json
+func writeBattlesExport(w io.Writer, warrior *database.Warrior, battles []*database.Battle, getPlans func(BattleID string) []*database.Plan) error {
+	zw := zip.NewWriter(w)
+	summary := BattleExportSummary{
+		WarriorID:    warrior.WarriorID,
+		WarriorName:  warrior.WarriorName,
+		ExportedDate: time.Now().UTC(),
+		Battles:      make([]*BattleExportRecord, 0),
+	}
+
+	for _, b := range battles {
+		plans := getPlans(b.BattleID)
+		record := &BattleExportRecord{
+			BattleID:   b.BattleID,
+			BattleName: b.BattleName,
+			Leader:     b.LeaderID == warrior.WarriorID,
+			PlanCount:  len(plans),
+			File:       "battles/" + b.BattleID + ".csv",
+		}
+		for _, p := range plans {
+			if p.Points != "" {
+				record.PointedCount++
+			}
+		}
+
+		data, err := battlePlansCSV(plans, warrior.WarriorID, battleLocation(b))
+		if err != nil {
+			return err
+		}
+		f, err := zw.Create(record.File)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+
+		if b.Notes != nil && b.Notes.Notes != "" {
+			record.NotesFile = "battles/" + b.BattleID + "-notes.txt"
+			f, err := zw.Create(record.NotesFile)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write([]byte(b.Notes.Notes)); err != nil {
+				return err
+			}
+		}
+		summary.Battles = append(summary.Battles, record)
+	}
+
+	f, err := zw.Create("summary.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(summary); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// battleDocumentVersion is the schema version of battle documents, bumped when a change would break importing
+// documents exported before it
+const battleDocumentVersion = 1
+
+// maxBattleDocumentPlans is the most plans an imported battle can have
+const maxBattleDocumentPlans = 1000
+
+// BattleDocument is a single battle exported to be imported into another instance, holding nothing tied to the
+// instance it came from like warrior or plan ids
+type BattleDocument struct {
+	SchemaVersion int                   `json:"schemaVersion"`
+	ExportedDate  time.Time             `json:"exportedDate"`
+	Battle        BattleDocumentBattle  `json:"battle"`
+	Plans         []*BattleDocumentPlan `json:"plans"`
+}
+
+// BattleDocumentBattle is the settings and notes of an exported battle
+type BattleDocumentBattle struct {
+	Name               string   `json:"name"`
+	PointValuesAllowed []string `json:"pointValuesAllowed"`
+	AutoFinishVoting   bool     `json:"autoFinishVoting"`
+	Timezone           string   `json:"timezone"`
+	Locale             string   `json:"locale"`
+	RequireReady       bool     `json:"requireReady"`
+	Notes              string   `json:"notes"`
+}
+
+// BattleDocumentPlan is a plan of an exported battle with its results, the votes being their values alone
+type BattleDocumentPlan struct {
+	Name               string                               `json:"name"`
+	Type               string                               `json:"type"`
+	ReferenceID        string                               `json:"referenceId"`
+	Link               string                               `json:"link"`
+	Description        string                               `json:"description"`
+	AcceptanceCriteria string                               `json:"acceptanceCriteria"`
+	Points             string                               `json:"points"`
+	Skipped            bool                                 `json:"skipped"`
+	Votes              []string                             `json:"votes"`
+	Translations       map[string]*database.PlanTranslation `json:"translations,omitempty"`
+	DependsOn          []int                                `json:"dependsOn,omitempty"`
+	Split              bool                                 `json:"split,omitempty"`
+	SplitFrom          *int                                 `json:"splitFrom,omitempty"`
+	RefinementNotes    []*BattleDocumentQuestion            `json:"refinementNotes,omitempty"`
+}
+
+// BattleDocumentQuestion is a clarification question asked on an exported plan, without who asked it
+type BattleDocumentQuestion struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	Resolved bool   `json:"resolved"`
+}
+
+// newBattleDocument exports the battle and its plans, dated in the battles time zone
+func newBattleDocument(battle *database.Battle, plans []*database.Plan) *BattleDocument {
+	doc := &BattleDocument{
+		SchemaVersion: battleDocumentVersion,
+		ExportedDate:  time.Now().In(battleLocation(battle)),
+		Battle: BattleDocumentBattle{
+			Name:               battle.BattleName,
+			PointValuesAllowed: battle.PointValuesAllowed,
+			AutoFinishVoting:   battle.AutoFinishVoting,
+			Timezone:           battle.Timezone,
+			Locale:             battle.Locale,
+			RequireReady:       battle.RequireReady,
+		},
+		Plans: make([]*BattleDocumentPlan, 0, len(plans)),
+	}
+	if battle.Notes != nil {
+		doc.Battle.Notes = battle.Notes.Notes
+	}
+
+	index := make(map[string]int, len(plans))
+	for i, p := range plans {
+		index[p.PlanID] = i
+	}
+
+	for _, p := range plans {
+		// plan ids don't carry over to other instances so dependencies are the positions of the plans they're on
+		var dependsOn []int
+		for _, PlanID := range p.DependsOn {
+			if i, ok := index[PlanID]; ok {
+				dependsOn = append(dependsOn, i)
+			}
+		}
+		// and the plan it was split from its position too
+		var splitFrom *int
+		if i, ok := index[p.ParentID]; ok {
+			splitFrom = &i
+		}
+		var notes []*BattleDocumentQuestion
+		for _, q := range p.Questions {
+			notes = append(notes, &BattleDocumentQuestion{Question: q.Question, Answer: q.Answer, Resolved: q.Resolved})
+		}
+		votes := make([]string, 0, len(p.Votes))
+		for _, v := range p.Votes {
+			votes = append(votes, v.VoteValue)
+		}
+		doc.Plans = append(doc.Plans, &BattleDocumentPlan{
+			Name:               p.PlanName,
+			Type:               p.Type,
+			ReferenceID:        p.ReferenceID,
+			Link:               p.Link,
+			Description:        p.Description,
+			AcceptanceCriteria: p.AcceptanceCriteria,
+			Points:             p.Points,
+			Skipped:            p.PlanSkipped,
+			Votes:              votes,
+			Translations:       p.Translations,
+			DependsOn:          dependsOn,
+			Split:              p.Split,
+			SplitFrom:          splitFrom,
+			RefinementNotes:    notes,
+		})
+	}
+
+	return doc
+}
+
+// readBattleDocument reads and checks a battle document to import, refusing schema versions it doesn't know
+func readBattleDocument(r io.Reader) (*BattleDocument, error) {
+	var doc BattleDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, errors.New("invalid battle document")
+	}
+	if doc.SchemaVersion < 1 || doc.SchemaVersion > battleDocumentVersion {
+		return nil, errors.New("unsupported schema version " + strconv.Itoa(doc.SchemaVersion))
+	}
+	if doc.Battle.Name == "" {
+		return nil, errors.New("battle name required")
+	}
+	if len(doc.Plans) > maxBattleDocumentPlans {
+		return nil, errors.New("too many plans")
+	}
+	if _, _, err := ValidateBattleLocale(doc.Battle.Timezone, doc.Battle.Locale); err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(doc.Battle.Notes) > maxBattleNotesLength {
+		return nil, errors.New("battle notes too long")
+	}
+	dependencies := make(map[string][]string)
+	for i, p := range doc.Plans {
+		if p == nil || p.Name == "" {
+			return nil, errors.New("plan name required")
+		}
+		// points are stored as at most 3 characters, like the point values
+		if utf8.RuneCountInString(p.Points) > 3 {
+			return nil, errors.New("invalid plan points")
+		}
+		for _, d := range p.DependsOn {
+			if d < 0 || d >= len(doc.Plans) || d == i {
+				return nil, errors.New("invalid plan dependency")
+			}
+			dependencies[strconv.Itoa(i)] = append(dependencies[strconv.Itoa(i)], strconv.Itoa(d))
+		}
+		if p.SplitFrom != nil && (*p.SplitFrom < 0 || *p.SplitFrom >= len(doc.Plans) || *p.SplitFrom == i) {
+			return nil, errors.New("invalid plan split")
+		}
+	}
+	if dependencyCycle(dependencies) {
+		return nil, errors.New("invalid plan dependency")
+	}
+
+	return &doc, nil
+}
+
+// handleBattleExport handles a warrior in the battle exporting it as a battle document
+func (s *server) handleBattleExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if !s.database.IsBattleWarrior(BattleID, warriorID) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		battle, err := s.database.GetBattle(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="battle-`+BattleID+`.json"`)
+		RespondWithJSON(w, http.StatusOK, newBattleDocument(battle, battle.Plans))
+	}
+}
+
+// handleBattleImport handles creating a battle led by the warrior from a battle document, with ?results=false
+// leaving out the points, skipped plans and notes to use it as a template
+func (s *server) handleBattleImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		Results := r.URL.Query().Get("results") != "false"
+
+		doc, err := readBattleDocument(http.MaxBytesReader(w, r.Body, 5<<20))
+		if err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		Timezone := doc.Battle.Timezone
+		if Timezone == "" {
+			Timezone = "UTC"
+		}
+		PointValuesAllowed, AutoFinishVoting, err := applyBattleDefaults(s.battleDefaults(requestTeamID(r, "")), doc.Battle.PointValuesAllowed, &doc.Battle.AutoFinishVoting)
+		if err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		Notes := doc.Battle.Notes
+		if !Results {
+			Notes = ""
+		}
+
+		Texts := []string{doc.Battle.Name, Notes}
+		Plans := make([]*database.Plan, 0, len(doc.Plans))
+		for _, p := range doc.Plans {
+			Texts = append(Texts, p.Name, p.Description, p.AcceptanceCriteria)
+			Plan := &database.Plan{
+				PlanName:           truncateRunes(sanitizeName(p.Name), maxPlanNameLength),
+				Type:               p.Type,
+				ReferenceID:        p.ReferenceID,
+				Link:               p.Link,
+				Description:        p.Description,
+				AcceptanceCriteria: p.AcceptanceCriteria,
+				Translations:       p.Translations,
+			}
+			if Results {
+				Plan.Points = p.Points
+				Plan.PlanSkipped = p.Skipped
+				Plan.Split = p.Split
+			}
+			Plans = append(Plans, Plan)
+		}
+		if err := s.moderation.Check(Texts...); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		newBattle, err := s.database.CreateBattle(warriorID, truncateRunes(sanitizeName(doc.Battle.Name), maxBattleNameLength), PointValuesAllowed, Plans, AutoFinishVoting, Timezone, doc.Battle.Locale, "", doc.Battle.RequireReady)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for i, p := range doc.Plans {
+			for _, d := range p.DependsOn {
+				Plans[i].DependsOn = append(Plans[i].DependsOn, Plans[d].PlanID)
+			}
+			if p.SplitFrom != nil && Results {
+				Plans[i].ParentID = Plans[*p.SplitFrom].PlanID
+			}
+		}
+		if err := s.database.ImportBattleResults(newBattle.BattleID, Plans, Notes); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ops.publish("battle_started", newBattle.BattleID, "")
+
+		RespondWithJSON(w, http.StatusOK, newBattle)
+	}
+}
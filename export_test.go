@@ -0,0 +1,244 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestWriteBattlesExport(t *testing.T) {
+	warrior := &database.Warrior{WarriorID: "w1", WarriorName: "Thor"}
+	battles := []*database.Battle{
+		{BattleID: "b1", BattleName: "Sprint 1", LeaderID: "w1", Notes: &database.BattleNotes{Notes: "Split the epic"}},
+	}
+	plans := []*database.Plan{
+		{PlanName: "Login", Points: "3", Votes: []*database.Vote{{WarriorID: "w1", VoteValue: "5"}}},
+		{PlanName: "Logout"},
+	}
+
+	var buf bytes.Buffer
+	err := writeBattlesExport(&buf, warrior, battles, func(BattleID string) []*database.Plan {
+		return plans
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 3 || zr.File[0].Name != "battles/b1.csv" || zr.File[1].Name != "battles/b1-notes.txt" || zr.File[2].Name != "summary.json" {
+		t.Fatal("Unexpected zip contents ", zr.File)
+	}
+
+	f, _ := zr.File[2].Open()
+	var summary BattleExportSummary
+	json.NewDecoder(f).Decode(&summary)
+	if len(summary.Battles) != 1 || summary.Battles[0].PlanCount != 2 || summary.Battles[0].PointedCount != 1 || !summary.Battles[0].Leader || summary.Battles[0].NotesFile != "battles/b1-notes.txt" {
+		t.Error("Unexpected summary ", summary.Battles[0])
+	}
+}
+
+func TestBattlePlansCSV(t *testing.T) {
+	plans := []*database.Plan{
+		{PlanID: "p1", PlanName: "Login, with comma", Points: "3", Votes: []*database.Vote{{WarriorID: "w1", VoteValue: "5"}},
+			VoteEndTime: time.Date(2021, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{PlanID: "p2", PlanName: "Logout", DependsOn: []string{"p1"}},
+		{PlanID: "p3", PlanName: "Account", Points: "21", Split: true},
+		{PlanID: "p4", PlanName: "Delete account", ParentID: "p3", Questions: []*database.PlanQuestion{
+			{WarriorID: "w1", Question: "Soft delete?", Answer: "Yes, for 30 days", Resolved: true},
+			{WarriorID: "w2", Question: "Email the warrior?"},
+		}},
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	data, _ := battlePlansCSV(plans, "w1", berlin)
+
+	expected := "Plan,Type,Reference ID,Link,Points,Skipped,Votes,Your Vote,Depends On,Split,Split From,Refinement Notes,Voted At\n" +
+		"\"Login, with comma\",,,,3,false,1,5,,false,,,2021-03-01T10:30:00+01:00\n" +
+		"Logout,,,,,false,0,,\"Login, with comma\",false,,,\n" +
+		"Account,,,,21,false,0,,,true,,,\n" +
+		"Delete account,,,,,false,0,,,false,Account,\"Soft delete? - Yes, for 30 days\nEmail the warrior?\",\n"
+	if string(data) != expected {
+		t.Error("Unexpected csv ", string(data))
+	}
+}
+
+func TestBattleDocument(t *testing.T) {
+	battle := &database.Battle{
+		BattleID: "b1", BattleName: "Sprint 1", PointValuesAllowed: []string{"1", "3", "5"}, Timezone: "Europe/Berlin",
+		Locale: "de-DE", Notes: &database.BattleNotes{Notes: "Split the epic"},
+	}
+	plans := []*database.Plan{
+		{PlanID: "p1", PlanName: "Login", Points: "3", Votes: []*database.Vote{{WarriorID: "w1", VoteValue: "5"}}, Split: true},
+		{PlanID: "p2", PlanName: "Logout", PlanSkipped: true, DependsOn: []string{"p1"}},
+		{PlanID: "p3", PlanName: "Login with SSO", ParentID: "p1", Questions: []*database.PlanQuestion{
+			{WarriorID: "w1", Question: "Which providers?", Answer: "Google", Resolved: true},
+		}},
+	}
+
+	data, _ := json.Marshal(newBattleDocument(battle, plans))
+	if strings.Contains(string(data), "w1") || strings.Contains(string(data), "p1") {
+		t.Error("Expected the document to leave out warrior and plan ids ", string(data))
+	}
+
+	doc, err := readBattleDocument(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := doc.ExportedDate.Zone(); offset != 3600 && offset != 7200 {
+		t.Error("Expected the document dated in the battles time zone got ", doc.ExportedDate)
+	}
+	if doc.Battle.Name != "Sprint 1" || doc.Battle.Notes != "Split the epic" || len(doc.Plans) != 3 || doc.Plans[0].Points != "3" ||
+		len(doc.Plans[0].Votes) != 1 || doc.Plans[0].Votes[0] != "5" || !doc.Plans[1].Skipped ||
+		len(doc.Plans[1].DependsOn) != 1 || doc.Plans[1].DependsOn[0] != 0 {
+		t.Error("Unexpected document ", doc)
+	}
+	if !doc.Plans[0].Split || doc.Plans[0].SplitFrom != nil || doc.Plans[2].SplitFrom == nil || *doc.Plans[2].SplitFrom != 0 {
+		t.Error("Expected the split plan and the plan split from it got ", doc.Plans[0], doc.Plans[2])
+	}
+	if len(doc.Plans[0].RefinementNotes) != 0 || len(doc.Plans[2].RefinementNotes) != 1 ||
+		*doc.Plans[2].RefinementNotes[0] != (BattleDocumentQuestion{Question: "Which providers?", Answer: "Google", Resolved: true}) {
+		t.Error("Expected the questions as refinement notes got ", doc.Plans[2].RefinementNotes)
+	}
+
+	tests := []string{
+		`{"schemaVersion": 2, "battle": {"name": "Sprint 1"}}`,
+		`{"battle": {"name": "Sprint 1"}}`,
+		`{"schemaVersion": 1, "battle": {"name": ""}}`,
+		`{"schemaVersion": 1, "battle": {"name": "Sprint 1", "timezone": "Asgard/Bifrost"}}`,
+		`{"schemaVersion": 1, "battle": {"name": "Sprint 1"}, "plans": [{"name": ""}]}`,
+		`{"schemaVersion": 1, "battle": {"name": "Sprint 1"}, "plans": [{"name": "Login", "dependsOn": [0]}]}`,
+		`{"schemaVersion": 1, "battle": {"name": "Sprint 1"}, "plans": [{"name": "Login", "dependsOn": [1]}]}`,
+		`{"schemaVersion": 1, "battle": {"name": "Sprint 1"}, "plans": [{"name": "Login", "dependsOn": [1]}, {"name": "Logout", "dependsOn": [0]}]}`,
+		`{"schemaVersion": 1, "battle": {"name": "Sprint 1"}, "plans": [{"name": "Login", "splitFrom": 1}]}`,
+		`not json`,
+	}
+	for _, tt := range tests {
+		if _, err := readBattleDocument(strings.NewReader(tt)); err == nil {
+			t.Error("Expected ", tt, " to be refused")
+		}
+	}
+}
+
+// battleImportMock records the battle created from an imported document
+type battleImportMock struct {
+	*database.Mock
+	plans []*database.Plan
+	notes string
+}
+
+func (m *battleImportMock) CreateBattle(LeaderID string, BattleName string, PointValuesAllowed []string, Plans []*database.Plan, AutoFinishVoting bool, Timezone string, Locale string, TeamID string, RequireReady bool) (*database.Battle, error) {
+	for i, p := range Plans {
+		p.PlanID = "p" + strconv.Itoa(i+1)
+	}
+	return &database.Battle{BattleID: "b2", BattleName: BattleName, LeaderID: LeaderID}, nil
+}
+
+func (m *battleImportMock) ImportBattleResults(BattleID string, Plans []*database.Plan, Notes string) error {
+	m.plans, m.notes = Plans, Notes
+	return nil
+}
+
+func TestHandleBattleImport(t *testing.T) {
+	s, db := newMockServer()
+	db.Permissions["w1"] = []string{database.PermissionCreateBattles}
+	mock := &battleImportMock{Mock: db}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battles/import", s.permissionOnly(database.PermissionCreateBattles, s.handleBattleImport()))
+
+	body := `{"schemaVersion": 1, "battle": {"name": "Sprint 1", "notes": "Split the epic"}, "plans": [{"name": "Login", "points": "3", "split": true}, {"name": "Logout", "dependsOn": [0], "splitFrom": 0}]}`
+	for _, results := range []bool{true, false} {
+		target := "/api/battles/import"
+		if !results {
+			target += "?results=false"
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", target, strings.NewReader(body))
+		r.Header.Set(apiKeyHeaderName, "key1")
+		router.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatal("Expected the battle to be imported got ", w.Code, w.Body.String())
+		}
+		if len(mock.plans) != 2 || (mock.plans[0].Points == "3") != results || (mock.notes == "Split the epic") != results {
+			t.Error("Expected results imported to be ", results, " got ", mock.plans, mock.notes)
+		}
+		if len(mock.plans[1].DependsOn) != 1 || mock.plans[1].DependsOn[0] != "p1" {
+			t.Error("Expected the dependency to be on the imported plan got ", mock.plans[1].DependsOn)
+		}
+		if mock.plans[0].Split != results || (mock.plans[1].ParentID == "p1") != results {
+			t.Error("Expected the split imported to be ", results, " got ", mock.plans[0].Split, mock.plans[1].ParentID)
+		}
+	}
+}
+
+// exportMock has a warrior with a single battle to export
+type exportMock struct {
+	*database.Mock
+}
+
+func (m *exportMock) GetBattlesByWarrior(WarriorID string, Filter *database.BattleFilter) ([]*database.Battle, error) {
+	return []*database.Battle{{BattleID: "b1", BattleName: "Sprint 1", LeaderID: "w1"}}, nil
+}
+
+func (m *exportMock) GetBattleNotes(BattleID string) (*database.BattleNotes, error) {
+	return &database.BattleNotes{}, nil
+}
+
+func (m *exportMock) GetPlans(BattleID string, WarriorID string) []*database.Plan {
+	return []*database.Plan{{PlanName: "Login", Points: "3"}}
+}
+
+func TestWarriorBattlesExportLinkStored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, db := newMockServer()
+	s.config.AppDomain = "thunderdome.dev"
+	s.config.SigningKey = "secret"
+	s.database = &exportMock{Mock: db}
+	if s.storage, err = storage.NewLocal(dir); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/warrior/{id}/battles/export", s.signedOnly(s.handleWarriorBattlesExport())).Methods("GET").Queries("signature", "{signature}")
+	router.HandleFunc("/api/warrior/{id}/battles/export/link", s.warriorOnly(s.handleWarriorBattlesExportLink())).Methods("POST")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/warrior/w1/battles/export/link", nil)
+	r.Header.Set(apiKeyHeaderName, "key1")
+	router.ServeHTTP(w, r)
+	var link struct {
+		URL string `json:"url"`
+	}
+	json.NewDecoder(w.Body).Decode(&link)
+	if w.Code != http.StatusOK || !strings.Contains(link.URL, "stored=true") {
+		t.Fatal("Expected a link to the stored export got ", w.Code, link.URL)
+	}
+
+	// the stored export is served even when the battles can no longer be read
+	s.database = db
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", link.URL, nil))
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if w.Code != http.StatusOK || err != nil || len(zr.File) != 2 || zr.File[0].Name != "battles/b1.csv" {
+		t.Error("Unexpected stored export ", w.Code, err)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/federation"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+// passportTTL is how long a warrior has to arrive at a peer with the passport issued for them
+const passportTTL = time.Minute
+
+// federatedArenaPrefix marks the arenas events relayed from peers are broadcast to, they're kept apart from
+// the arenas of battles hosted here so a peer can't speak into them
+const federatedArenaPrefix = "federation:"
+
+// federatedPeersTTL is how long the peers of a battle are cached for when relaying its events
+const federatedPeersTTL = 30 * time.Second
+
+// federationRelayTimeout is how long a peer has to take a relayed event
+const federationRelayTimeout = 5 * time.Second
+
+// federationRelayBacklog is how many events are kept for a peer that's slow to take them, more are dropped
+const federationRelayBacklog = 256
+
+// relayedEvent is what's posted to a peer for each event of a battle federated with it
+type relayedEvent struct {
+	BattleID string          `json:"battleId"`
+	Event    json.RawMessage `json:"event"`
+}
+
+// federatedBattle is a battle shared with peers along with where warriors of each peer join it from
+type federatedBattle struct {
+	*database.FederationPeer
+	JoinURL string `json:"joinUrl"`
+}
+
+// federatedPeers caches the peers of each battle so relaying events doesn't query them for every event
+type federatedPeers struct {
+	mu    sync.Mutex
+	peers map[string]federatedPeersEntry
+}
+
+type federatedPeersEntry struct {
+	peers   []*database.FederationPeer
+	expires time.Time
+}
+
+// get gets the peers of the battle, loading them when they aren't cached
+func (f *federatedPeers) get(BattleID string, load func(string) ([]*database.FederationPeer, error)) []*database.FederationPeer {
+	f.mu.Lock()
+	entry, ok := f.peers[BattleID]
+	f.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.peers
+	}
+
+	peers, err := load(BattleID)
+	if err != nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	f.peers[BattleID] = federatedPeersEntry{peers, time.Now().Add(federatedPeersTTL)}
+	f.mu.Unlock()
+
+	return peers
+}
+
+// forget drops the cached peers of every battle, after peers or a battles federation changes
+func (f *federatedPeers) forget() {
+	f.mu.Lock()
+	f.peers = make(map[string]federatedPeersEntry)
+	f.mu.Unlock()
+}
+
+// federationInstanceURL is the URL this instance identifies as to peers
+func federationInstanceURL(AppDomain string, PathPrefix string) string {
+	if configured := viper.GetString("federation.instance_url"); configured != "" {
+		return strings.TrimRight(configured, "/")
+	}
+
+	return "https://" + AppDomain + PathPrefix
+}
+
+// federatedArena is the arena events of the peers battle are relayed into
+func federatedArena(PeerID string, BattleID string) string {
+	return federatedArenaPrefix + PeerID + ":" + BattleID
+}
+
+// relayFederatedEvents posts the events broadcast to battles federated with peers on to them. Each peer is posted
+// to from its own goroutine so a peer that's slow or down doesn't hold up the others, its events are dropped once
+// it's too far behind
+func (s *server) relayFederatedEvents(events <-chan message) {
+	backlogs := make(map[string]chan []byte)
+	for m := range events {
+		if strings.HasPrefix(m.arena, federatedArenaPrefix) {
+			continue
+		}
+
+		peers := s.federatedPeers.get(m.arena, s.database.GetBattleFederationPeers)
+		if len(peers) == 0 {
+			continue
+		}
+
+		body, _ := json.Marshal(relayedEvent{BattleID: m.arena, Event: m.data})
+		for _, peer := range peers {
+			backlog, ok := backlogs[peer.URL]
+			if !ok {
+				backlog = make(chan []byte, federationRelayBacklog)
+				backlogs[peer.URL] = backlog
+				go s.relayToPeer(peer.URL, backlog)
+			}
+			select {
+			case backlog <- body:
+			default:
+				log.Println("federation peer " + peer.URL + " is too far behind, dropping a relayed battle event")
+			}
+		}
+	}
+}
+
+// relayToPeer posts the events relayed to the peer in order, giving each federationRelayTimeout
+func (s *server) relayToPeer(PeerURL string, backlog <-chan []byte) {
+	for body := range backlog {
+		ctx, cancel := context.WithTimeout(context.Background(), federationRelayTimeout)
+		if err := s.federation.Post(ctx, PeerURL, "/api/federation/relay", body); err != nil {
+			log.Println("error relaying battle event to federation peer : " + err.Error() + "\n")
+		}
+		cancel()
+	}
+}
+
+// handleFederationIdentity publishes this instances url and public key for peers to pin
+func (s *server) handleFederationIdentity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		RespondWithJSON(w, http.StatusOK, s.federation.Identity())
+	}
+}
+
+// handleFederationPeersGet gets the instances this one is federated with
+func (s *server) handleFederationPeersGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Peers, err := s.database.GetFederationPeers()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Peers)
+	}
+}
+
+// handleFederationPeerAdd handles an admin federating with another instance, fetching its identity to pin its
+// public key. Federation is only established once the admins of both instances have added each other
+func (s *server) handleFederationPeerAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		PeerURL := strings.TrimRight(strings.TrimSpace(keyVal["url"]), "/")
+		if jsonErr != nil || !strings.HasPrefix(PeerURL, "https://") && !strings.HasPrefix(PeerURL, "http://") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if PeerURL == s.federation.URL {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Identity, err := s.federation.FetchIdentity(PeerURL)
+		if err != nil {
+			log.Println("error fetching federation peer identity : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		Peer, err := s.database.AddFederationPeer(PeerURL, Identity.PublicKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.federatedPeers.forget()
+
+		RespondWithJSON(w, http.StatusOK, Peer)
+	}
+}
+
+// handleFederationPeerDelete handles an admin ending federation with another instance
+func (s *server) handleFederationPeerDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		PeerID := vars["peerId"]
+
+		if err := s.database.DeleteFederationPeer(PeerID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.federatedPeers.forget()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// battleFederations gets the peers the battle is shared with along with the links their warriors join it by
+func (s *server) battleFederations(BattleID string) ([]*federatedBattle, error) {
+	Peers, err := s.database.GetBattleFederationPeers(BattleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var Federations = make([]*federatedBattle, 0)
+	for _, Peer := range Peers {
+		Federations = append(Federations, &federatedBattle{
+			FederationPeer: Peer,
+			JoinURL: Peer.URL + "/api/federation/join?" + url.Values{
+				"instance": {s.federation.URL},
+				"battleId": {BattleID},
+			}.Encode(),
+		})
+	}
+
+	return Federations, nil
+}
+
+// handleBattleFederationsGet gets the peers the battle is shared with, for its leader
+func (s *server) handleBattleFederationsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if err := s.database.ConfirmLeader(BattleID, warriorID); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		Federations, err := s.battleFederations(BattleID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Federations)
+	}
+}
+
+// handleBattleFederate handles the leader sharing the battle with a peer (PUT) or no longer sharing it (DELETE)
+func (s *server) handleBattleFederate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		PeerID := vars["peerId"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if _, err := s.database.GetFederationPeer(PeerID); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var err error
+		if r.Method == "DELETE" {
+			err = s.database.UnfederateBattle(BattleID, warriorID, PeerID)
+		} else {
+			err = s.database.FederateBattle(BattleID, warriorID, PeerID)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.federatedPeers.forget()
+
+		Federations, err := s.battleFederations(BattleID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Federations)
+	}
+}
+
+// handleFederationJoin issues the warrior a passport for a battle hosted by a peer and sends them there with it,
+// letting them watch the battle from here too
+func (s *server) handleFederationJoin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		Instance := strings.TrimRight(r.URL.Query().Get("instance"), "/")
+		BattleID := r.URL.Query().Get("battleId")
+		if _, err := uuid.Parse(BattleID); Instance == "" || err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Peer, err := s.database.GetFederationPeerByURL(Instance)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		Warrior, err := s.database.GetWarrior(warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if err := s.database.AddFederationWatcher(Peer.PeerID, BattleID, Warrior.WarriorID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		Passport, err := s.federation.IssuePassport(Warrior.WarriorID, Warrior.WarriorName, BattleID, Peer.URL, passportTTL)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, Peer.URL+"/api/federation/arrive?passport="+url.QueryEscape(Passport), http.StatusFound)
+	}
+}
+
+// federationArrivalPage sends the arriving warrior on to the battle, the strict cookies just set aren't sent
+// with the cross site redirect that brought them so it's done from a page of this instance
+var federationArrivalPage = template.Must(template.New("arrival").Parse(`<!DOCTYPE html>
+<html><head><meta http-equiv="refresh" content="0;url={{.}}"></head>
+<body><a href="{{.}}">{{.}}</a></body></html>`))
+
+// handleFederationArrive handles a warrior of a peer arriving with a passport for a battle federated with it,
+// logging them in as the guest warrior standing in for them here. Each passport is only accepted once
+func (s *server) handleFederationArrive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Token := r.URL.Query().Get("passport")
+		Unverified, err := federation.ReadPassport(Token)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Peer, err := s.database.GetFederationPeerByURL(strings.TrimRight(Unverified.Instance, "/"))
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		Passport, err := federation.VerifyPassport(Token, Peer.PublicKey, s.federation.URL)
+		if err != nil {
+			log.Println("error verifying federation passport : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if !s.database.IsBattleFederated(Passport.BattleID, Peer.PeerID) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err := s.database.UseFederationNonce(Peer.PeerID, Passport.Nonce, time.Unix(Passport.Expires, 0)); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		// the peers host is shown with the name so everyone can tell which side each warrior is from
+		Name := sanitizeName(Passport.WarriorName)
+		if u, err := url.Parse(Peer.URL); err == nil && u.Host != "" && len([]rune(u.Host)) < 48 {
+			Name = truncateRunes(Name, maxWarriorNameLength-len([]rune(u.Host))-3) + " (" + u.Host + ")"
+		}
+		Warrior, err := s.database.FederatedWarrior(Peer.PeerID, Passport.WarriorID, truncateRunes(Name, maxWarriorNameLength))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.createWarriorCookie(w, r, false, Warrior.WarriorID)
+		// the frontend keeps the warrior in a cookie of its own, set here as the warrior never registered
+		feWarrior, _ := json.Marshal(map[string]interface{}{
+			"id":                   Warrior.WarriorID,
+			"name":                 Warrior.WarriorName,
+			"rank":                 Warrior.WarriorRank,
+			"avatar":               Warrior.WarriorAvatar,
+			"notificationsEnabled": Warrior.NotificationsEnabled,
+		})
+		http.SetCookie(w, &http.Cookie{
+			Name:     s.config.FrontendCookieName,
+			Value:    strings.ReplaceAll(url.QueryEscape(string(feWarrior)), "+", "%20"),
+			Path:     s.config.PathPrefix + "/",
+			MaxAge:   86400 * 365,
+			SameSite: http.SameSiteStrictMode,
+		})
+
+		battlePath := "/battle/"
+		if viper.GetBool("config.friendly_ui_verbs") {
+			battlePath = "/game/"
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := federationArrivalPage.Execute(w, s.config.PathPrefix+battlePath+Passport.BattleID); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// handleFederationRelay handles a peer relaying an event of one of its battles federated with this instance,
+// broadcasting it to the warriors here watching it
+func (s *server) handleFederationRelay() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+
+		Peer, err := s.database.GetFederationPeerByURL(strings.TrimRight(r.Header.Get(federation.InstanceHeader), "/"))
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := federation.Verify(r, body, Peer.PublicKey); err != nil {
+			log.Println("error verifying federation relay : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var relayed relayedEvent
+		if err := json.Unmarshal(body, &relayed); err != nil || relayed.BattleID == "" || len(relayed.Event) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// arenas nobody is watching aren't kept by the hub, so there's nothing to broadcast to
+		arena := federatedArena(Peer.PeerID, relayed.BattleID)
+		if h.liveWarriors([]string{arena})[arena] > 0 {
+			h.broadcast <- message{[]byte(relayed.Event), arena}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// serveFederatedArena lets warriors here watch the events relayed from a peers battle over a websocket, only those
+// who joined the battle from here can, taking part is done on the peer
+func (s *server) serveFederatedArena() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		PeerID, BattleID := vars["peerId"], vars["battleId"]
+		arena := federatedArena(PeerID, BattleID)
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		warriorID, cookieErr := s.validateWarriorCookie(w, r)
+		if cookieErr != nil {
+			cm := websocket.FormatCloseMessage(4001, "unauthorized")
+			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
+				log.Printf("unauthorized close error: %v", err)
+			}
+			if err := ws.Close(); err != nil {
+				log.Printf("close error: %v", err)
+			}
+			return
+		}
+		if !s.database.IsFederationWatcher(PeerID, BattleID, warriorID) {
+			cm := websocket.FormatCloseMessage(4004, "battle not found")
+			if err := ws.WriteMessage(websocket.CloseMessage, cm); err != nil {
+				log.Printf("not found close error: %v", err)
+			}
+			if err := ws.Close(); err != nil {
+				log.Printf("close error: %v", err)
+			}
+			return
+		}
+
+		c := &connection{send: make(chan []byte, 256), ws: ws, version: negotiateSocketVersion(r, ws.Subprotocol()), warriorID: warriorID}
+		ss := subscription{c, arena, warriorID, ""}
+		h.register <- ss
+		go ss.writePump()
+		ws.SetReadLimit(h.limits.MaxMessageSize)
+
+		// watchers don't send anything, reading is only to notice them leaving
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				break
+			}
+		}
+		h.unregister <- ss
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/federation"
+)
+
+// federationMock knows a single peer, federated with battle b1
+type federationMock struct {
+	*database.Mock
+	peer    *database.FederationPeer
+	arrived []string
+	nonces  map[string]bool
+}
+
+func (m *federationMock) GetFederationPeerByURL(URL string) (*database.FederationPeer, error) {
+	if URL != m.peer.URL {
+		return nil, errors.New("federation peer not found")
+	}
+	return m.peer, nil
+}
+
+func (m *federationMock) IsBattleFederated(BattleID string, PeerID string) bool {
+	return BattleID == "b1" && PeerID == m.peer.PeerID
+}
+
+func (m *federationMock) UseFederationNonce(PeerID string, Nonce string, Expires time.Time) error {
+	if m.nonces[Nonce] {
+		return errors.New("federation nonce already used")
+	}
+	m.nonces[Nonce] = true
+	return nil
+}
+
+func (m *federationMock) FederatedWarrior(PeerID string, RemoteWarriorID string, WarriorName string) (*database.Warrior, error) {
+	m.arrived = append(m.arrived, RemoteWarriorID+" "+WarriorName)
+	return &database.Warrior{WarriorID: "g1", WarriorName: WarriorName, WarriorRank: "PRIVATE"}, nil
+}
+
+func newTestInstance(t *testing.T, URL string) *federation.Instance {
+	key, err := federation.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance, err := federation.New(URL, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return instance
+}
+
+func TestHandleFederationArrive(t *testing.T) {
+	s, db := newMockServer()
+	peer := newTestInstance(t, "https://vendor.example.com")
+	stranger := newTestInstance(t, "https://vendor.example.com")
+	mock := &federationMock{Mock: db, peer: &database.FederationPeer{PeerID: "p1", URL: peer.URL, PublicKey: peer.Identity().PublicKey}, nonces: make(map[string]bool)}
+	s.database = mock
+	s.federation = newTestInstance(t, "https://thunderdome.dev")
+
+	valid, _ := peer.IssuePassport("rw1", "Thor", "b1", s.federation.URL, time.Minute)
+	unfederated, _ := peer.IssuePassport("rw1", "Thor", "b2", s.federation.URL, time.Minute)
+	expired, _ := peer.IssuePassport("rw1", "Thor", "b1", s.federation.URL, -time.Minute)
+	forged, _ := stranger.IssuePassport("rw1", "Thor", "b1", s.federation.URL, time.Minute)
+	elsewhere, _ := peer.IssuePassport("rw1", "Thor", "b1", "https://other.example.com", time.Minute)
+	tests := []struct {
+		passport string
+		status   int
+	}{
+		{valid, http.StatusOK},
+		{valid, http.StatusForbidden},
+		{unfederated, http.StatusForbidden},
+		{expired, http.StatusForbidden},
+		{forged, http.StatusForbidden},
+		{elsewhere, http.StatusForbidden},
+		{"garbage", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/federation/arrive?passport="+url.QueryEscape(tt.passport), nil)
+		s.handleFederationArrive()(w, r)
+
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if len(mock.arrived) != 1 || mock.arrived[0] != "rw1 Thor (vendor.example.com)" {
+		t.Error("Unexpected arrivals ", mock.arrived)
+	}
+
+	again, _ := peer.IssuePassport("rw1", "Thor", "b1", s.federation.URL, time.Minute)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/federation/arrive?passport="+url.QueryEscape(again), nil)
+	s.handleFederationArrive()(w, r)
+	cookies := make(map[string]string)
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c.Value
+	}
+	if cookies["warriorId"] == "" || !strings.Contains(cookies["warrior"], "%22id%22%3A%22g1%22") {
+		t.Error("Expected the warrior cookies to be set got ", cookies)
+	}
+	if !strings.Contains(w.Body.String(), "/battle/b1") {
+		t.Error("Expected to be sent on to the battle got ", w.Body.String())
+	}
+}
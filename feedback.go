@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// minFeedbackResponses is the fewest responses a facilitator or team needs before their rating and comments
+	// are shown, so a single warrior's feedback can't be picked out of a small session
+	minFeedbackResponses = 3
+	// maxFeedbackCommentLength is how long a feedback comment can be
+	maxFeedbackCommentLength = 2000
+	// defaultFeedbackDays is how far back the feedback report looks without a days query param
+	defaultFeedbackDays = 90
+)
+
+// withholdFeedback blanks the rating and comments of summaries with too few responses to stay anonymous
+func withholdFeedback(Summaries []*database.FeedbackSummary) {
+	for _, fs := range Summaries {
+		if fs.Responses < minFeedbackResponses {
+			fs.AverageRating = 0
+			fs.Comments = make([]string, 0)
+		}
+	}
+}
+
+// handleBattleFeedbackSubmit handles a warrior rating a battle they took part in once it ended, with an optional
+// comment that isn't linked to them
+func (s *server) handleBattleFeedbackSubmit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var keyVal struct {
+			Rating  int    `json:"rating"`
+			Comment string `json:"comment"`
+		}
+		if err := json.Unmarshal(body, &keyVal); err != nil || keyVal.Rating < 1 || keyVal.Rating > 5 {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "rating must be between 1 and 5"})
+			return
+		}
+		Comment := strings.TrimSpace(keyVal.Comment)
+		if len(Comment) > maxFeedbackCommentLength {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "comment too long"})
+			return
+		}
+		if err := s.moderation.Check(Comment); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		err := s.database.SubmitSessionFeedback(BattleID, warriorID, keyVal.Rating, Comment)
+		if err == database.ErrFeedbackClosed {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleSessionFeedbackGet gets the feedback on battles ended in the last days by facilitator and by team
+func (s *server) handleSessionFeedbackGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Days := defaultFeedbackDays
+		if d := r.URL.Query().Get("days"); d != "" {
+			var err error
+			if Days, err = strconv.Atoi(d); err != nil || Days < 1 || Days > 366 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		Feedback, err := s.database.GetSessionFeedback(time.Now().AddDate(0, 0, -Days))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		withholdFeedback(Feedback.Facilitators)
+		withholdFeedback(Feedback.Teams)
+
+		RespondWithJSON(w, http.StatusOK, Feedback)
+	}
+}
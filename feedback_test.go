@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestWithholdFeedback(t *testing.T) {
+	Summaries := []*database.FeedbackSummary{
+		{Name: "Thor", Sessions: 4, Responses: 5, AverageRating: 4.2, Comments: []string{"Well paced"}},
+		{Name: "Loki", Sessions: 1, Responses: 2, AverageRating: 1.5, Comments: []string{"Too long"}},
+	}
+	withholdFeedback(Summaries)
+
+	if Summaries[0].AverageRating != 4.2 || len(Summaries[0].Comments) != 1 {
+		t.Error("Expected enough responses to be shown got ", Summaries[0])
+	}
+	if Summaries[1].AverageRating != 0 || len(Summaries[1].Comments) != 0 || Summaries[1].Responses != 2 {
+		t.Error("Expected too few responses to be withheld got ", Summaries[1])
+	}
+}
+
+// feedbackMock lets warriors give feedback on b1 once
+type feedbackMock struct {
+	*database.Mock
+	responded map[string]bool
+	comments  []string
+}
+
+func (m *feedbackMock) SubmitSessionFeedback(SessionID string, WarriorID string, Rating int, Comment string) error {
+	if SessionID != "b1" || m.responded[WarriorID] {
+		return database.ErrFeedbackClosed
+	}
+	m.responded[WarriorID] = true
+	m.comments = append(m.comments, Comment)
+	return nil
+}
+
+func TestHandleBattleFeedbackSubmit(t *testing.T) {
+	s, db := newMockServer()
+	mock := &feedbackMock{Mock: db, responded: make(map[string]bool)}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/feedback", s.warriorOnly(s.handleBattleFeedbackSubmit()))
+
+	tests := []struct {
+		battleID string
+		body     string
+		status   int
+	}{
+		{"b1", `{"rating": 0}`, http.StatusBadRequest},
+		{"b1", `{"rating": 6, "comment": "Great"}`, http.StatusBadRequest},
+		{"b1", `{"rating": 4, "comment": " Well paced "}`, http.StatusOK},
+		// only once per session
+		{"b1", `{"rating": 5}`, http.StatusForbidden},
+		{"b2", `{"rating": 5}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/battle/"+tt.battleID+"/feedback", strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, "key1")
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+	if len(mock.comments) != 1 || mock.comments[0] != "Well paced" {
+		t.Error("Unexpected comments ", mock.comments)
+	}
+}
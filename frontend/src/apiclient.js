@@ -1,3 +1,5 @@
+import { get } from 'svelte/store'
+import { locale } from 'svelte-i18n'
 import { PathPrefix } from './config'
 /**
  * Extends fetch with common inputs e.g. credentials, content-type
@@ -12,6 +14,10 @@ export default function(handle401) {
      */
     return function(endpoint, customConfig = {}) {
         const headers = { 'content-type': 'application/json' }
+        // validation errors are translated to the locale picked in the UI
+        if (get(locale)) {
+            headers['accept-language'] = get(locale)
+        }
         const customHeaders = customConfig.headers || {}
 
         const config = {
@@ -34,7 +40,9 @@ export default function(handle401) {
             }
 
             if (!response.ok) {
-                throw Error(response.statusText)
+                const error = Error(response.statusText)
+                error.status = response.status
+                throw error
             }
 
             return response
@@ -89,9 +89,38 @@ function supported(locale) {
     }
 }
 
+// gets the plan with its name and description in the locale
+// when it's been translated to it or its language
+function localizePlan(plan, locale) {
+    const translations = plan.translations || {}
+    const translation =
+        translations[locale] ||
+        (locale && translations[language(locale)]) ||
+        null
+    if (!translation) {
+        return plan
+    }
+
+    return {
+        ...plan,
+        name: translation.name,
+        description: translation.description || plan.description,
+    }
+}
+
 // We expose the svelte-i18n _ store so that our app has
 // a single API for i18n
-export { _, setupI18n, isLocaleLoaded, locale, locales, dir, date, number }
+export {
+    _,
+    setupI18n,
+    isLocaleLoaded,
+    locale,
+    locales,
+    dir,
+    date,
+    number,
+    localizePlan,
+}
 
 // Most of this setup came from
 // https://medium.com/i18n-and-l10n-resources-for-developers/a-step-by-step-guide-to-svelte-localization-with-svelte-i18n-v3-2c3ff0d645b8
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// experience earned for each kind of participation
+const (
+	xpPerVote             = 1
+	xpPerBattleJoined     = 5
+	xpPerBattleLed        = 10
+	xpPerPerfectConsensus = 25
+	// xpLevelFactor sets how quickly levels get further apart, level n taking xpLevelFactor * (n-1)^2 experience
+	xpLevelFactor = 50
+)
+
+// badges warriors earn
+const (
+	BadgeFirstBattle      = "first_battle"
+	BadgeHundredVotes     = "votes_100"
+	BadgePerfectConsensus = "perfect_consensus"
+)
+
+// WarriorGamification is a warrior's experience, level and badges
+type WarriorGamification struct {
+	WarriorID   string   `json:"warriorId"`
+	WarriorName string   `json:"warriorName"`
+	XP          int      `json:"xp"`
+	Level       int      `json:"level"`
+	Badges      []string `json:"badges"`
+}
+
+// newWarriorGamification works out the experience and badges earned from the warrior's participation
+func newWarriorGamification(p *database.WarriorParticipation) *WarriorGamification {
+	g := &WarriorGamification{
+		WarriorID:   p.WarriorID,
+		WarriorName: p.WarriorName,
+		XP: p.VotesCast*xpPerVote + p.BattlesJoined*xpPerBattleJoined + p.BattlesLed*xpPerBattleLed +
+			p.PerfectConsensusBattles*xpPerPerfectConsensus,
+		Badges: make([]string, 0),
+	}
+	g.Level = int(math.Sqrt(float64(g.XP)/xpLevelFactor)) + 1
+
+	if p.BattlesJoined > 0 || p.BattlesLed > 0 {
+		g.Badges = append(g.Badges, BadgeFirstBattle)
+	}
+	if p.VotesCast >= 100 {
+		g.Badges = append(g.Badges, BadgeHundredVotes)
+	}
+	if p.PerfectConsensusBattles > 0 {
+		g.Badges = append(g.Badges, BadgePerfectConsensus)
+	}
+
+	return g
+}
+
+// handleWarriorGamificationGet gets the warrior's experience, level and badges
+func (s *server) handleWarriorGamificationGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		Participation, err := s.database.GetWarriorParticipation(WarriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, newWarriorGamification(Participation))
+	}
+}
+
+// handleTeamLeaderboardGet gets the team's warriors by experience, the most first
+func (s *server) handleTeamLeaderboardGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Participation, err := s.database.GetTeamParticipation(vars["teamId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		Leaderboard := make([]*WarriorGamification, 0, len(Participation))
+		for _, p := range Participation {
+			Leaderboard = append(Leaderboard, newWarriorGamification(p))
+		}
+		sort.SliceStable(Leaderboard, func(i, j int) bool {
+			if Leaderboard[i].XP != Leaderboard[j].XP {
+				return Leaderboard[i].XP > Leaderboard[j].XP
+			}
+			return Leaderboard[i].WarriorName < Leaderboard[j].WarriorName
+		})
+
+		RespondWithJSON(w, http.StatusOK, Leaderboard)
+	}
+}
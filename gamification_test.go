@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestNewWarriorGamification(t *testing.T) {
+	tests := []struct {
+		participation database.WarriorParticipation
+		xp            int
+		level         int
+		badges        []string
+	}{
+		{database.WarriorParticipation{}, 0, 1, []string{}},
+		{database.WarriorParticipation{BattlesJoined: 1, VotesCast: 10}, 15, 1, []string{BadgeFirstBattle}},
+		{database.WarriorParticipation{BattlesJoined: 10, BattlesLed: 2, VotesCast: 120, PerfectConsensusBattles: 1}, 215, 3, []string{BadgeFirstBattle, BadgeHundredVotes, BadgePerfectConsensus}},
+	}
+	for _, tt := range tests {
+		g := newWarriorGamification(&tt.participation)
+		if g.XP != tt.xp || g.Level != tt.level || !reflect.DeepEqual(g.Badges, tt.badges) {
+			t.Error("Expected ", tt.xp, " xp, level ", tt.level, " and ", tt.badges, " got ", g.XP, g.Level, g.Badges)
+		}
+	}
+}
+
+// leaderboardMock has a team of three warriors
+type leaderboardMock struct {
+	*database.Mock
+}
+
+func (m *leaderboardMock) GetTeamParticipation(TeamID string) ([]*database.WarriorParticipation, error) {
+	return []*database.WarriorParticipation{
+		{WarriorID: "w1", WarriorName: "Thor", VotesCast: 5},
+		{WarriorID: "w2", WarriorName: "Loki", VotesCast: 50},
+		{WarriorID: "w3", WarriorName: "Hela", VotesCast: 5},
+	}, nil
+}
+
+func TestHandleTeamLeaderboardGet(t *testing.T) {
+	s, db := newMockServer()
+	s.database = &leaderboardMock{Mock: db}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/team/{teamId}/leaderboard", s.handleTeamLeaderboardGet())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/team/t1/leaderboard", nil))
+	var leaderboard []*WarriorGamification
+	json.NewDecoder(w.Body).Decode(&leaderboard)
+
+	var names []string
+	for _, g := range leaderboard {
+		names = append(names, g.WarriorName)
+	}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(names, []string{"Loki", "Hela", "Thor"}) {
+		t.Error("Unexpected leaderboard ", w.Code, names)
+	}
+}
@@ -5,8 +5,8 @@ go 1.16
 require (
 	github.com/anthonynsimon/bild v0.13.0
 	github.com/go-ldap/ldap/v3 v3.2.3
-	github.com/go-playground/locales v0.13.0 // indirect
-	github.com/go-playground/universal-translator v0.16.0 // indirect
+	github.com/go-playground/locales v0.13.0
+	github.com/go-playground/universal-translator v0.16.0
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/mux v1.7.3
 	github.com/gorilla/securecookie v1.1.1
@@ -16,8 +16,11 @@ require (
 	github.com/lib/pq v1.8.0
 	github.com/matcornic/hermes/v2 v2.1.0
 	github.com/o1egl/govatar v0.3.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/viper v1.6.3
 	golang.org/x/crypto v0.0.0-20200604202706-70a84ac30bf9
+	golang.org/x/net v0.0.0-20190522155817-f3200d17e092
+	golang.org/x/text v0.3.2
 	gopkg.in/DATA-DOG/go-sqlmock.v1 v1.3.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
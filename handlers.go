@@ -3,32 +3,46 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"html/template"
 	"image"
 	"image/png"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/issues"
 	"github.com/anthonynsimon/bild/transform"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/ipsn/go-adorable"
 	"github.com/o1egl/govatar"
+	qrcode "github.com/skip2/go-qrcode"
 	"github.com/spf13/viper"
-	"gopkg.in/go-playground/validator.v9"
 )
 
 type contextKey string
 
 var (
-	contextKeyWarriorID contextKey
-	apiKeyHeaderName    string = "X-API-Key"
+	contextKeyWarriorID      contextKey = "warriorId"
+	contextKeyTeamRole       contextKey = "teamRole"
+	contextKeyDepartmentRole contextKey = "departmentRole"
+	contextKeyTenant         contextKey = "tenant"
+	apiKeyHeaderName         string     = "X-API-Key"
 )
 
 type warriorAccount struct {
@@ -43,32 +57,67 @@ type warriorPassword struct {
 	Password2 string `json:"password2" validate:"required,min=6,max=72,eqfield=Password1"`
 }
 
-// ValidateWarriorAccount makes sure warrior name, email, and password are valid before creating the account
+// ValidateWarriorAccount makes sure warrior name, email, and password are valid before creating the account,
+// getting the cleaned name
 func ValidateWarriorAccount(name string, email string, pwd1 string, pwd2 string) (WarriorName string, WarriorEmail string, WarriorPassword string, validateErr error) {
-	v := validator.New()
+	name, nameErr := cleanName("warriorName", name, maxWarriorNameLength)
+	if nameErr != nil {
+		return "", "", "", nameErr
+	}
+
 	a := warriorAccount{
 		Name:      name,
 		Email:     email,
 		Password1: pwd1,
 		Password2: pwd2,
 	}
-	err := v.Struct(a)
+	err := validate.Struct(a)
 
 	return name, email, pwd1, err
 }
 
 // ValidateWarriorPassword makes sure warrior password is valid before updating the password
 func ValidateWarriorPassword(pwd1 string, pwd2 string) (WarriorPassword string, validateErr error) {
-	v := validator.New()
 	a := warriorPassword{
 		Password1: pwd1,
 		Password2: pwd2,
 	}
-	err := v.Struct(a)
+	err := validate.Struct(a)
 
 	return pwd1, err
 }
 
+// localePattern matches BCP 47 style language tags e.g. en, de-DE, zh-Hant-TW
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// maxLocaleLength is the longest battle locale, as long as the battles locale column
+const maxLocaleLength = 16
+
+// ValidateBattleLocale makes sure the battle timezone is a known IANA zone and the locale is a language tag,
+// empty values are allowed and leave the defaults in place
+func ValidateBattleLocale(timezone string, locale string) (Timezone string, Locale string, validateErr error) {
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return "", "", errors.New("invalid battle timezone")
+		}
+	}
+
+	if locale != "" && (len(locale) > maxLocaleLength || !localePattern.MatchString(locale)) {
+		return "", "", errors.New("invalid battle locale")
+	}
+
+	return timezone, locale, nil
+}
+
+// battleLocation gets the time zone the battle declared, UTC when it didn't or it isn't known
+func battleLocation(b *database.Battle) *time.Location {
+	if loc, err := time.LoadLocation(b.Timezone); err == nil && b.Timezone != "" {
+		return loc
+	}
+
+	return time.UTC
+}
+
 // RespondWithJSON takes a payload and writes the response
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
@@ -78,30 +127,40 @@ func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
+// RespondWithETag responds with JSON tagged with a hash of it, or 304 Not Modified when the
+// client already has that version so polling clients don't download unchanged state
+func RespondWithETag(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	response, _ := json.Marshal(payload)
+	sum := sha256.Sum256(response)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if match = strings.TrimPrefix(strings.TrimSpace(match), "W/"); match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
 // createWarriorCookie creates the warriors cookie
-func (s *server) createWarriorCookie(w http.ResponseWriter, isRegistered bool, WarriorID string) {
+func (s *server) createWarriorCookie(w http.ResponseWriter, r *http.Request, isRegistered bool, WarriorID string) {
 	var cookiedays = 365 // 356 days
 	if isRegistered {
 		cookiedays = 30 // 30 days
 	}
 
-	encoded, err := s.cookie.Encode(s.config.SecureCookieName, WarriorID)
-	if err != nil {
+	cookie := s.sessionCookie(r, WarriorID, cookiedays)
+	if cookie == nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 
 	}
-
-	cookie := &http.Cookie{
-		Name:     s.config.SecureCookieName,
-		Value:    encoded,
-		Path:     s.config.PathPrefix + "/",
-		HttpOnly: true,
-		Domain:   s.config.AppDomain,
-		MaxAge:   86400 * cookiedays,
-		Secure:   s.config.SecureCookieFlag,
-		SameSite: http.SameSiteStrictMode,
-	}
 	http.SetCookie(w, cookie)
 }
 
@@ -129,26 +188,20 @@ func (s *server) clearWarriorCookies(w http.ResponseWriter) {
 	http.SetCookie(w, beCookie)
 }
 
-// validateWarriorCookie returns the warriorID from secure cookies or errors if failures getting it
+// validateWarriorCookie returns the warriorID of the session in the secure cookie or errors if failures getting it,
+// like the session having expired or been revoked. Cookies from before sessions were stored are exchanged for one
 func (s *server) validateWarriorCookie(w http.ResponseWriter, r *http.Request) (string, error) {
-	var warriorID string
-
-	if cookie, err := r.Cookie(s.config.SecureCookieName); err == nil {
-		var value string
-		if err = s.cookie.Decode(s.config.SecureCookieName, cookie.Value, &value); err == nil {
-			warriorID = value
-		} else {
-			log.Println("error in reading warrior cookie : " + err.Error() + "\n")
-			s.clearWarriorCookies(w)
-			return "", errors.New("invalid warrior cookies")
-		}
-	} else {
+	session, err := s.cookieSession(r)
+	if err == errLegacyCookie {
+		session, err = s.exchangeLegacyCookie(w, r)
+	}
+	if err != nil {
 		log.Println("error in reading warrior cookie : " + err.Error() + "\n")
 		s.clearWarriorCookies(w)
 		return "", errors.New("invalid warrior cookies")
 	}
 
-	return warriorID, nil
+	return session.WarriorID, nil
 }
 
 /*
@@ -170,6 +223,9 @@ func (s *server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
+			sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer s.logAPIRequest(apiKey, warriorID, sr, r, time.Now())
+			w = sr
 		} else {
 			var cookieErr error
 			warriorID, cookieErr = s.validateWarriorCookie(w, r)
@@ -185,6 +241,7 @@ func (s *server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		noteAccessWarrior(r, warriorID)
 		ctx := context.WithValue(r.Context(), contextKeyWarriorID, warriorID)
 
 		h(w, r.WithContext(ctx))
@@ -206,6 +263,9 @@ func (s *server) warriorOnly(h http.HandlerFunc) http.HandlerFunc {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
+			sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer s.logAPIRequest(apiKey, warriorID, sr, r, time.Now())
+			w = sr
 		} else {
 			var cookieErr error
 			warriorID, cookieErr = s.validateWarriorCookie(w, r)
@@ -222,61 +282,183 @@ func (s *server) warriorOnly(h http.HandlerFunc) http.HandlerFunc {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		s.database.TouchWarriorActivity(warriorID)
 
+		noteAccessWarrior(r, warriorID)
 		ctx := context.WithValue(r.Context(), contextKeyWarriorID, warriorID)
 
 		h(w, r.WithContext(ctx))
 	}
 }
 
+// teamOnly validates that the request was made by a member of the team,
+// admins of the department the team belongs to are treated as team admins
+func (s *server) teamOnly(h http.HandlerFunc) http.HandlerFunc {
+	return s.warriorOnly(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Role, roleErr := s.database.GetTeamWarriorRole(TeamID, warriorID)
+		if Role != "ADMIN" && s.database.ConfirmTeamDepartmentAdmin(TeamID, warriorID) == nil {
+			Role, roleErr = "ADMIN", nil
+		}
+		if roleErr != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyTeamRole, Role)
+
+		h(w, r.WithContext(ctx))
+	})
+}
+
+// teamAdminOnly validates that the request was made by an admin of the team
+func (s *server) teamAdminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return s.teamOnly(func(w http.ResponseWriter, r *http.Request) {
+		Role := r.Context().Value(contextKeyTeamRole).(string)
+		if Role != "ADMIN" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	})
+}
+
+// departmentOnly validates that the request was made by a member of the department,
+// instance admins are treated as department admins
+func (s *server) departmentOnly(h http.HandlerFunc) http.HandlerFunc {
+	return s.warriorOnly(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		DepartmentID := vars["departmentId"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Role, roleErr := s.database.GetDepartmentWarriorRole(DepartmentID, warriorID)
+		if Role != "ADMIN" && s.database.ConfirmAdmin(warriorID) == nil {
+			Role, roleErr = "ADMIN", nil
+		}
+		if roleErr != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyDepartmentRole, Role)
+
+		h(w, r.WithContext(ctx))
+	})
+}
+
+// departmentAdminOnly validates that the request was made by an admin of the department,
+// the department scoped variant of adminOnly
+func (s *server) departmentAdminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return s.departmentOnly(func(w http.ResponseWriter, r *http.Request) {
+		Role := r.Context().Value(contextKeyDepartmentRole).(string)
+		if Role != "ADMIN" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	})
+}
+
+// signedOnly validates that the request was made with an unexpired signed URL,
+// URLs signed with a warriorId act as that warrior
+func (s *server) signedOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.verifySignedURL(r); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if warriorID := r.URL.Query().Get("warriorId"); warriorID != "" {
+			noteAccessWarrior(r, warriorID)
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyWarriorID, warriorID))
+		}
+
+		h(w, r)
+	}
+}
+
+// permissionOnly validates that the request was made by a warrior granted the permission through their rank or roles
+func (s *server) permissionOnly(Permission string, h http.HandlerFunc) http.HandlerFunc {
+	return s.warriorOnly(func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if err := s.database.ConfirmPermission(warriorID, Permission); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	})
+}
+
 /*
 	Handlers
 */
 
-// handleIndex parses the index html file, injecting any relevant data
-func (s *server) handleIndex() http.HandlerFunc {
-	type AppConfig struct {
-		AllowedPointValues []string
-		DefaultPointValues []string
-		ShowWarriorRank    bool
-		AvatarService      string
-		ToastTimeout       int
-		AllowGuests        bool
-		AllowRegistration  bool
-		AllowJiraImport    bool
-		DefaultLocale      string
-		FriendlyUIVerbs    bool
-		AuthMethod         string
-		AppVersion         string
-		CookieName         string
-		PathPrefix         string
-		APIEnabled         bool
+// AppConfig is the runtime config of the UI, injected into the index and served at /api/config
+type AppConfig struct {
+	AllowedPointValues []string
+	DefaultPointValues []string
+	ShowWarriorRank    bool
+	Gamification       bool
+	AvatarService      string
+	ToastTimeout       int
+	AllowGuests        bool
+	AllowRegistration  bool
+	AllowJiraImport    bool
+	DefaultLocale      string
+	FriendlyUIVerbs    bool
+	AuthMethod         string
+	AppVersion         string
+	CookieName         string
+	PathPrefix         string
+	APIEnabled         bool
+	PlanSplitThreshold string
+	VoteChangePolicy   string
+	LinkPreviews       bool
+	AppName            string
+	LogoURL            string
+	PrimaryColor       string
+}
+
+// requestWarriorID gets the warrior the request was made by from its API key or cookie, empty when it's anonymous
+func (s *server) requestWarriorID(r *http.Request) string {
+	var warriorID string
+	if apiKey := strings.TrimSpace(r.Header.Get(apiKeyHeaderName)); apiKey != "" {
+		warriorID, _ = s.database.ValidateAPIKey(apiKey)
+	} else if session, err := s.cookieSession(r); err == nil {
+		warriorID = session.WarriorID
 	}
-	type UIConfig struct {
-		AnalyticsEnabled bool
-		AnalyticsID      string
-		AppConfig        AppConfig
+	if warriorID == "" {
+		return ""
 	}
-
-	// get the html template from dist, have it ready for requests
-	tmplContent, ioErr := fs.ReadFile(f, "dist/index.html")
-	if ioErr != nil {
-		log.Println("Error opening index template")
-		log.Fatal(ioErr)
+	if _, err := s.database.GetWarrior(warriorID); err != nil {
+		return ""
 	}
 
-	tmplString := string(tmplContent)
-	tmpl, tmplErr := template.New("index").Parse(tmplString)
-	if tmplErr != nil {
-		log.Println("Error parsing index template")
-		log.Fatal(tmplErr)
+	return warriorID
+}
+
+// appConfig gets the UI's config for the request, teams served at their own hostname or path prefix get their own
+// branding and signed in warriors get the point values of the battle defaults they create battles with
+func (s *server) appConfig(r *http.Request) AppConfig {
+	// the template may point at an internal directory, the UI only needs to know avatars come from the proxy
+	AvatarService := viper.GetString("config.avatar_service")
+	if s.avatars != nil {
+		AvatarService = "template"
 	}
 
 	appConfig := AppConfig{
 		AllowedPointValues: viper.GetStringSlice("config.allowedPointValues"),
 		DefaultPointValues: viper.GetStringSlice("config.defaultPointValues"),
 		ShowWarriorRank:    viper.GetBool("config.show_warrior_rank"),
-		AvatarService:      viper.GetString("config.avatar_service"),
+		Gamification:       viper.GetBool("config.gamification"),
+		AvatarService:      AvatarService,
 		ToastTimeout:       viper.GetInt("config.toast_timeout"),
 		AllowGuests:        viper.GetBool("config.allow_guests"),
 		AllowRegistration:  viper.GetBool("config.allow_registration") && viper.GetString("auth.method") == "normal",
@@ -285,22 +467,70 @@ func (s *server) handleIndex() http.HandlerFunc {
 		FriendlyUIVerbs:    viper.GetBool("config.friendly_ui_verbs"),
 		AuthMethod:         viper.GetString("auth.method"),
 		APIEnabled:         viper.GetBool("config.allow_external_api"),
+		PlanSplitThreshold: viper.GetString("config.plan_split_threshold"),
+		VoteChangePolicy:   s.config.VoteChangePolicy,
+		LinkPreviews:       s.unfurler != nil,
 		AppVersion:         s.config.Version,
 		CookieName:         s.config.FrontendCookieName,
 		PathPrefix:         s.config.PathPrefix,
+		AppName:            "Thunderdome",
+	}
+
+	if t := requestTenant(r); t != nil {
+		appConfig.PathPrefix = t.pathPrefix
+		if t.domain.AppName != "" {
+			appConfig.AppName = t.domain.AppName
+		}
+		appConfig.LogoURL = t.domain.LogoURL
+		appConfig.PrimaryColor = t.domain.PrimaryColor
+	}
+	if s.requestWarriorID(r) != "" {
+		appConfig.DefaultPointValues = s.battleDefaults(requestTeamID(r, "")).PointValuesAllowed
+	}
+
+	return appConfig
+}
+
+// handleIndex parses the index html file, injecting any relevant data
+func (s *server) handleIndex() http.HandlerFunc {
+	type UIConfig struct {
+		AnalyticsEnabled bool
+		AnalyticsID      string
+		AppConfig        AppConfig
+	}
+
+	// get the html template from dist, have it ready for requests
+	tmplContent, ioErr := fs.ReadFile(f, "dist/index.html")
+	if ioErr != nil {
+		log.Println("Error opening index template")
+		log.Fatal(ioErr)
 	}
 
-	data := UIConfig{
-		AnalyticsEnabled: s.config.AnalyticsEnabled,
-		AnalyticsID:      s.config.AnalyticsID,
-		AppConfig:        appConfig,
+	tmplString := string(tmplContent)
+	tmpl, tmplErr := template.New("index").Parse(tmplString)
+	if tmplErr != nil {
+		log.Println("Error parsing index template")
+		log.Fatal(tmplErr)
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		data := UIConfig{
+			AnalyticsEnabled: s.config.AnalyticsEnabled,
+			AnalyticsID:      s.config.AnalyticsID,
+			AppConfig:        s.appConfig(r),
+		}
+
 		tmpl.Execute(w, data)
 	}
 }
 
+// handleAppConfig gets the UI's runtime config, for clients that don't load the index
+func (s *server) handleAppConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		RespondWithJSON(w, http.StatusOK, s.appConfig(r))
+	}
+}
+
 /*
 	Auth Handlers
 */
@@ -321,7 +551,7 @@ func (s *server) handleLogin() http.HandlerFunc {
 			return
 		}
 
-		cookie := s.createCookie(authedWarrior.WarriorID)
+		cookie := s.createCookie(r, authedWarrior.WarriorID)
 		if cookie != nil {
 			http.SetCookie(w, cookie)
 		} else {
@@ -350,7 +580,7 @@ func (s *server) handleLdapLogin() http.HandlerFunc {
 			return
 		}
 
-		cookie := s.createCookie(authedWarrior.WarriorID)
+		cookie := s.createCookie(r, authedWarrior.WarriorID)
 		if cookie != nil {
 			http.SetCookie(w, cookie)
 		} else {
@@ -365,6 +595,9 @@ func (s *server) handleLdapLogin() http.HandlerFunc {
 // handleLogout clears the warrior cookie(s) ending session
 func (s *server) handleLogout() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if session, err := s.cookieSession(r); err == nil {
+			s.database.DeleteWarriorSession(session.WarriorID, session.SessionID)
+		}
 		s.clearWarriorCookies(w)
 		return
 	}
@@ -388,7 +621,15 @@ func (s *server) handleWarriorRecruit() http.HandlerFunc {
 			return
 		}
 
-		WarriorName := keyVal["warriorName"]
+		WarriorName, nameErr := cleanName("warriorName", keyVal["warriorName"], maxWarriorNameLength)
+		if nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+		if err := s.moderation.Check(WarriorName); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
 
 		newWarrior, err := s.database.CreateWarriorPrivate(WarriorName)
 		if err != nil {
@@ -396,7 +637,7 @@ func (s *server) handleWarriorRecruit() http.HandlerFunc {
 			return
 		}
 
-		s.createWarriorCookie(w, false, newWarrior.WarriorID)
+		s.createWarriorCookie(w, r, false, newWarrior.WarriorID)
 
 		RespondWithJSON(w, http.StatusOK, newWarrior)
 	}
@@ -429,7 +670,15 @@ func (s *server) handleWarriorEnlist() http.HandlerFunc {
 		)
 
 		if accountErr != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			respondInvalid(w, r, accountErr)
+			return
+		}
+		if err := s.moderation.Check(WarriorName); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := s.licenseAllows(database.LicenseWarriors); err != nil {
+			RespondWithJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
 			return
 		}
 
@@ -439,7 +688,7 @@ func (s *server) handleWarriorEnlist() http.HandlerFunc {
 			return
 		}
 
-		s.createWarriorCookie(w, true, newWarrior.WarriorID)
+		s.createWarriorCookie(w, r, true, newWarrior.WarriorID)
 
 		s.email.SendWelcome(WarriorName, WarriorEmail, VerifyID)
 
@@ -481,7 +730,7 @@ func (s *server) handleResetPassword() http.HandlerFunc {
 		)
 
 		if passwordErr != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			respondInvalid(w, r, passwordErr)
 			return
 		}
 
@@ -516,7 +765,7 @@ func (s *server) handleUpdatePassword() http.HandlerFunc {
 		)
 
 		if passwordErr != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			respondInvalid(w, r, passwordErr)
 			return
 		}
 
@@ -527,6 +776,9 @@ func (s *server) handleUpdatePassword() http.HandlerFunc {
 			return
 		}
 
+		// changing the password ended all the warrior's sessions, this browser gets a new one to stay logged in
+		s.createWarriorCookie(w, r, true, warriorID)
+
 		s.email.SendPasswordUpdate(WarriorName, WarriorEmail)
 
 		return
@@ -556,141 +808,390 @@ func (s *server) handleWarriorProfile() http.HandlerFunc {
 	}
 }
 
-// handleWarriorProfileUpdate attempts to update warriors profile (currently limited to name)
-func (s *server) handleWarriorProfileUpdate() http.HandlerFunc {
+// handleWarriorPermissionsGet gets the permissions the warrior has through their rank and roles
+func (s *server) handleWarriorPermissionsGet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-		body, _ := ioutil.ReadAll(r.Body) // check for errors
-		keyVal := make(map[string]interface{})
-		json.Unmarshal(body, &keyVal) // check for errors
-		WarriorName := keyVal["warriorName"].(string)
-		WarriorAvatar := keyVal["warriorAvatar"].(string)
-		NotificationsEnabled, _ := keyVal["notificationsEnabled"].(bool)
-
 		WarriorID := vars["id"]
 		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
 		if WarriorID != warriorCookieID {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		updateErr := s.database.UpdateWarriorProfile(WarriorID, WarriorName, WarriorAvatar, NotificationsEnabled)
-		if updateErr != nil {
-			log.Println("error attempting to update warrior profile : " + updateErr.Error() + "\n")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		warrior, warErr := s.database.GetWarrior(WarriorID)
-		if warErr != nil {
-			log.Println("error reloading warrior after update : " + warErr.Error() + "\n")
+		permissions, err := s.database.GetWarriorPermissions(WarriorID)
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		RespondWithJSON(w, http.StatusOK, warrior)
+		RespondWithJSON(w, http.StatusOK, permissions)
 	}
 }
 
-// handleAccountVerification attempts to verify a warriors account
-func (s *server) handleAccountVerification() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		body, _ := ioutil.ReadAll(r.Body) // check for errors
-
-		keyVal := make(map[string]string)
-		json.Unmarshal(body, &keyVal) // check for errors
-		VerifyID := keyVal["verifyId"]
-
-		verifyErr := s.database.VerifyWarriorAccount(VerifyID)
-		if verifyErr != nil {
-			log.Println("error attempting to verify warrior account : " + verifyErr.Error() + "\n")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+// exportArtifactKey is where the warrior's battles export is stored for their export link
+func exportArtifactKey(WarriorID string) string {
+	return "exports/" + WarriorID + ".zip"
+}
 
-		return
+// writeWarriorBattlesExport writes the zip of the warriors battles
+func (s *server) writeWarriorBattlesExport(w io.Writer, warrior *database.Warrior) error {
+	WarriorID := warrior.WarriorID
+	battles, err := s.database.GetBattlesByWarrior(WarriorID, &database.BattleFilter{})
+	if err != nil {
+		battles = make([]*database.Battle, 0)
+	}
+	for _, b := range battles {
+		b.Notes, _ = s.database.GetBattleNotes(b.BattleID)
 	}
+
+	return writeBattlesExport(w, warrior, battles, func(BattleID string) []*database.Plan {
+		return s.database.GetPlans(BattleID, WarriorID)
+	})
 }
 
-// handleWarriorAvatar creates an avatar for the given warrior by ID
-func (s *server) handleWarriorAvatar() http.HandlerFunc {
+// handleWarriorBattlesExport streams a zip of the warriors battles so they can take their estimation history with them,
+// export links made with storage configured getting the zip stored when the link was made
+func (s *server) handleWarriorBattlesExport() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-
-		Width, _ := strconv.Atoi(vars["width"])
 		WarriorID := vars["id"]
-		AvatarGender := govatar.MALE
-		warriorGender, ok := vars["avatar"]
-		if ok {
-			if warriorGender == "female" {
-				AvatarGender = govatar.FEMALE
-			}
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
 		}
 
-		var avatar image.Image
-		if s.config.AvatarService == "govatar" {
-			avatar, _ = govatar.GenerateForUsername(AvatarGender, WarriorID)
-		} else { // must be goadorable
-			var err error
-			avatar, _, err = image.Decode(bytes.NewReader(adorable.PseudoRandom([]byte(WarriorID))))
+		if r.URL.Query().Get("stored") == "true" && s.storage != nil {
+			artifact, err := s.storage.Get(exportArtifactKey(WarriorID))
 			if err != nil {
-				log.Fatalln(err)
+				log.Println("error getting stored export : " + err.Error() + "\n")
+				w.WriteHeader(http.StatusNotFound)
+				return
 			}
-		}
+			defer artifact.Close()
 
-		img := transform.Resize(avatar, Width, Width, transform.Linear)
-		buffer := new(bytes.Buffer)
-
-		if err := png.Encode(buffer, img); err != nil {
-			log.Println("unable to encode image.")
-			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Disposition", `attachment; filename="thunderdome-battles.zip"`)
+			if _, err := io.Copy(w, artifact); err != nil {
+				log.Println("error sending stored export : " + err.Error() + "\n")
+			}
 			return
 		}
 
-		w.Header().Set("Content-Type", "image/png")
-		w.Header().Set("Content-Length", strconv.Itoa(len(buffer.Bytes())))
-
-		if _, err := w.Write(buffer.Bytes()); err != nil {
-			log.Println("unable to write image.")
+		warrior, warErr := s.database.GetWarrior(WarriorID)
+		if warErr != nil {
+			log.Println("error finding warrior : " + warErr.Error() + "\n")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="thunderdome-battles.zip"`)
+		if exportErr := s.writeWarriorBattlesExport(w, warrior); exportErr != nil {
+			log.Println("error exporting battles : " + exportErr.Error() + "\n")
+		}
 	}
 }
 
-/*
-	API Key Handlers
-*/
-
-// handleAPIKeyGenerate handles generating an API key for a warrior
-func (s *server) handleAPIKeyGenerate() http.HandlerFunc {
+// handleWarriorBattlesExportLink gets a link to download the warriors battles export without being logged in, with
+// storage configured the export is made and stored now so any instance can serve the link
+func (s *server) handleWarriorBattlesExportLink() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-		body, _ := ioutil.ReadAll(r.Body) // check for errors
-		keyVal := make(map[string]interface{})
-		json.Unmarshal(body, &keyVal) // check for errors
-		APIKeyName := keyVal["name"].(string)
-
 		WarriorID := vars["id"]
 		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
 		if WarriorID != warriorCookieID {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		APIKey, keyErr := s.database.GenerateAPIKey(WarriorID, APIKeyName)
-		if keyErr != nil {
-			log.Println("error attempting to generate api key : " + keyErr.Error() + "\n")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		params := url.Values{"warriorId": {WarriorID}}
+		if s.storage != nil {
+			warrior, warErr := s.database.GetWarrior(WarriorID)
+			if warErr != nil {
+				log.Println("error finding warrior : " + warErr.Error() + "\n")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			var artifact bytes.Buffer
+			if err := s.writeWarriorBattlesExport(&artifact, warrior); err != nil {
+				log.Println("error exporting battles : " + err.Error() + "\n")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if err := s.storage.Put(exportArtifactKey(WarriorID), &artifact, "application/zip"); err != nil {
+				log.Println("error storing export : " + err.Error() + "\n")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			params.Set("stored", "true")
 		}
 
-		RespondWithJSON(w, http.StatusOK, APIKey)
+		link, expires := s.signURL("/api/warrior/"+WarriorID+"/battles/export", params, exportLinkTTL)
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{"url": link, "expires": expires})
 	}
 }
 
-// handleWarriorAPIKeys handles getting warrior API keys
-func (s *server) handleWarriorAPIKeys() http.HandlerFunc {
+// handleWarriorProfileUpdate attempts to update warriors profile (currently limited to name)
+func (s *server) handleWarriorProfileUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]interface{})
+		json.Unmarshal(body, &keyVal) // check for errors
+		WarriorName := keyVal["warriorName"].(string)
+		WarriorAvatar := keyVal["warriorAvatar"].(string)
+		NotificationsEnabled, _ := keyVal["notificationsEnabled"].(bool)
+
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		WarriorName, nameErr := cleanName("warriorName", WarriorName, maxWarriorNameLength)
+		if nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+		if err := s.moderation.Check(WarriorName); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// the handle is optional, leaving it out of the update keeps the current one, a taken handle
+		// is refused before anything else changes
+		WarriorHandle, HandleUpdate := keyVal["warriorHandle"].(string)
+		WarriorHandle = strings.TrimPrefix(strings.TrimSpace(WarriorHandle), "@")
+		if HandleUpdate && WarriorHandle != "" {
+			if !handlePattern.MatchString(WarriorHandle) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := s.moderation.Check(WarriorHandle); err != nil {
+				RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+
+		if HandleUpdate {
+			if err := s.database.SetWarriorHandle(WarriorID, WarriorHandle); err != nil {
+				if err == database.ErrHandleTaken {
+					RespondWithJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+					return
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		updateErr := s.database.UpdateWarriorProfile(WarriorID, WarriorName, WarriorAvatar, NotificationsEnabled)
+		if updateErr != nil {
+			log.Println("error attempting to update warrior profile : " + updateErr.Error() + "\n")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		warrior, warErr := s.database.GetWarrior(WarriorID)
+		if warErr != nil {
+			log.Println("error reloading warrior after update : " + warErr.Error() + "\n")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, warrior)
+	}
+}
+
+// handleNotificationPreferencesGet gets whether the warrior wants each notification event through each channel
+func (s *server) handleNotificationPreferencesGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		Preferences, err := s.database.GetNotificationPreferences(WarriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Preferences)
+	}
+}
+
+// handleNotificationPreferencesUpdate saves the given notification preferences of the warrior
+func (s *server) handleNotificationPreferencesUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var Preferences []*database.NotificationPreference
+		if err := json.Unmarshal(body, &Preferences); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, p := range Preferences {
+			if p == nil || !database.ValidNotification(p.Event, p.Channel) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := s.database.SetNotificationPreferences(WarriorID, Preferences); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		Preferences, err := s.database.GetNotificationPreferences(WarriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Preferences)
+	}
+}
+
+// handleAccountVerification attempts to verify a warriors account
+func (s *server) handleAccountVerification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+
+		keyVal := make(map[string]string)
+		json.Unmarshal(body, &keyVal) // check for errors
+		VerifyID := keyVal["verifyId"]
+
+		verifyErr := s.database.VerifyWarriorAccount(VerifyID)
+		if verifyErr != nil {
+			log.Println("error attempting to verify warrior account : " + verifyErr.Error() + "\n")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		return
+	}
+}
+
+// maxAvatarWidth is the largest avatar generated, keeping a single request from allocating huge images
+const maxAvatarWidth = 512
+
+// renderAvatar generates the warrior's avatar as a PNG of the given width
+func renderAvatar(AvatarService string, WarriorID string, Gender string, Width int) ([]byte, error) {
+	if Width < 1 || Width > maxAvatarWidth {
+		return nil, errors.New("invalid avatar width")
+	}
+
+	AvatarGender := govatar.MALE
+	if Gender == "female" {
+		AvatarGender = govatar.FEMALE
+	}
+
+	var avatar image.Image
+	var err error
+	if AvatarService == "govatar" && Gender != "neutral" {
+		avatar, err = govatar.GenerateForUsername(AvatarGender, WarriorID)
+	} else { // must be goadorable or the govatar gender neutral option
+		avatar, _, err = image.Decode(bytes.NewReader(adorable.PseudoRandom([]byte(WarriorID))))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img := transform.Resize(avatar, Width, Width, transform.Linear)
+	buffer := new(bytes.Buffer)
+	if err := png.Encode(buffer, img); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// handleWarriorAvatar creates an avatar for the given warrior by ID
+func (s *server) handleWarriorAvatar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Width, widthErr := strconv.Atoi(vars["width"])
+		if widthErr != nil || Width < 1 || Width > maxAvatarWidth {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		WarriorID := vars["id"]
+		warriorGender, ok := vars["avatar"]
+		if !ok && s.config.AvatarService == "govatar" {
+			// no gender in the path, use the one the warrior chose in their profile
+			if warrior, err := s.database.GetWarrior(WarriorID); err == nil {
+				warriorGender = warrior.WarriorAvatar
+			}
+		}
+
+		avatar, err := renderAvatar(s.config.AvatarService, WarriorID, warriorGender, Width)
+		if err != nil {
+			log.Println("unable to generate avatar : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(len(avatar)))
+
+		if _, err := w.Write(avatar); err != nil {
+			log.Println("unable to write image.")
+		}
+	}
+}
+
+/*
+	API Key Handlers
+*/
+
+// handleAPIKeyGenerate handles generating an API key for a warrior
+func (s *server) handleAPIKeyGenerate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]interface{})
+		json.Unmarshal(body, &keyVal) // check for errors
+		APIKeyName := keyVal["name"].(string)
+
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		APIKey, keyErr := s.database.GenerateAPIKey(WarriorID, APIKeyName)
+		if keyErr != nil {
+			log.Println("error attempting to generate api key : " + keyErr.Error() + "\n")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, APIKey)
+	}
+}
+
+// handleWarriorAPIKeys handles getting warrior API keys
+func (s *server) handleWarriorAPIKeys() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 
@@ -764,6 +1265,45 @@ func (s *server) handleWarriorAPIKeyDelete() http.HandlerFunc {
 	}
 }
 
+// handleWarriorAPIKeyRequests gets a page of the audited requests made with the warriors API keys, optionally of one key
+func (s *server) handleWarriorAPIKeyRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		Limit, Offset := 100, 0
+		var err error
+
+		if v := query.Get("limit"); v != "" {
+			if Limit, err = strconv.Atoi(v); err != nil || Limit < 1 || Limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if Offset, err = strconv.Atoi(v); err != nil || Offset < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		Requests, err := s.database.GetAPIKeyRequests(WarriorID, query.Get("keyId"), Limit, Offset)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Requests)
+	}
+}
+
 /*
 	Battle Handlers
 */
@@ -781,59 +1321,2193 @@ func (s *server) handleBattleCreate() http.HandlerFunc {
 		var keyVal struct {
 			BattleName         string           `json:"battleName"`
 			PointValuesAllowed []string         `json:"pointValuesAllowed"`
-			AutoFinishVoting   bool             `json:"autoFinishVoting"`
+			AutoFinishVoting   *bool            `json:"autoFinishVoting"`
 			Plans              []*database.Plan `json:"plans"`
+			Timezone           string           `json:"timezone"`
+			Locale             string           `json:"locale"`
+			TeamID             string           `json:"teamId"`
+			RequireReady       bool             `json:"requireReady"`
 		}
 		json.Unmarshal(body, &keyVal) // check for errors
 
-		newBattle, err := s.database.CreateBattle(warriorID, keyVal.BattleName, keyVal.PointValuesAllowed, keyVal.Plans, keyVal.AutoFinishVoting)
+		if keyVal.TeamID != "" {
+			if _, roleErr := s.database.GetTeamWarriorRole(keyVal.TeamID, warriorID); roleErr != nil {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+
+		Timezone, Locale, localeErr := ValidateBattleLocale(keyVal.Timezone, keyVal.Locale)
+		if localeErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if Timezone == "" {
+			Timezone = "UTC"
+		}
+
+		PointValuesAllowed, AutoFinishVoting, defaultsErr := applyBattleDefaults(s.battleDefaults(requestTeamID(r, keyVal.TeamID)), keyVal.PointValuesAllowed, keyVal.AutoFinishVoting)
+		if defaultsErr != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": defaultsErr.Error()})
+			return
+		}
+
+		var nameErr error
+		if keyVal.BattleName, nameErr = cleanName("battleName", keyVal.BattleName, maxBattleNameLength); nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+		Texts := []string{keyVal.BattleName}
+		for _, plan := range keyVal.Plans {
+			if plan.PlanName, nameErr = cleanName("planName", plan.PlanName, maxPlanNameLength); nameErr != nil {
+				respondInvalid(w, r, nameErr)
+				return
+			}
+			Texts = append(Texts, plan.PlanName, plan.Description, plan.AcceptanceCriteria)
+		}
+		if err := s.moderation.Check(Texts...); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		newBattle, err := s.database.CreateBattle(warriorID, keyVal.BattleName, PointValuesAllowed, keyVal.Plans, AutoFinishVoting, Timezone, Locale, keyVal.TeamID, keyVal.RequireReady)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		ops.publish("battle_started", newBattle.BattleID, "")
 
 		RespondWithJSON(w, http.StatusOK, newBattle)
 	}
 }
 
-// handleBattlesGet looks up battles associated with warriorID
-func (s *server) handleBattlesGet() http.HandlerFunc {
+// handleBattleBotCreate handles registering a bot participant to the battle, returning its API key
+func (s *server) handleBattleBotCreate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
 		warriorID := r.Context().Value(contextKeyWarriorID).(string)
-		battles, err := s.database.GetBattlesByWarrior(warriorID)
+		// bots can't mint more bots with their own api key
+		if Warrior, err := s.database.GetWarrior(warriorID); err != nil || Warrior.WarriorRank == "BOT" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var nameErr error
+		if keyVal["name"], nameErr = cleanName("name", keyVal["name"], maxWarriorNameLength); nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+		if err := s.moderation.Check(keyVal["name"]); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
 
+		Bot, APIKey, err := s.database.CreateBattleBot(BattleID, warriorID, keyVal["name"])
 		if err != nil {
-			http.NotFound(w, r)
+			log.Println("error creating battle bot : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		RespondWithJSON(w, http.StatusOK, battles)
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"bot":    Bot,
+			"apiKey": APIKey,
+		})
 	}
 }
 
-/*
-	Admin Handlers
-*/
-
-// handleAppStats gets the applications stats
-func (s *server) handleAppStats() http.HandlerFunc {
+// handleBattleBotsGet handles getting the bots registered to a battle
+func (s *server) handleBattleBotsGet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		AppStats, err := s.database.GetAppStats()
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
 
+		err := s.database.ConfirmLeader(BattleID, warriorID)
 		if err != nil {
-			http.NotFound(w, r)
+			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		RespondWithJSON(w, http.StatusOK, AppStats)
+		RespondWithJSON(w, http.StatusOK, s.database.GetBattleBots(BattleID))
 	}
 }
 
-// handleGetRegisteredWarriors gets a list of registered warriors
-func (s *server) handleGetRegisteredWarriors() http.HandlerFunc {
+// handleBattleBotDelete handles removing a bot from the battle
+func (s *server) handleBattleBotDelete() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-		Limit, _ := strconv.Atoi(vars["limit"])
+		BattleID := vars["id"]
+		BotID := vars["botId"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		err := s.database.DeleteBattleBot(BattleID, warriorID, BotID)
+		if err != nil {
+			log.Println("error deleting battle bot : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, s.database.GetBattleBots(BattleID))
+	}
+}
+
+// handleBattlePlanRevise handles revising a plan, rejecting edits made from a stale version
+func (s *server) handleBattlePlanRevise() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		PlanID := vars["planId"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		var plan struct {
+			PlanName           string `json:"planName"`
+			Type               string `json:"type"`
+			ReferenceID        string `json:"referenceId"`
+			Link               string `json:"link"`
+			Description        string `json:"description"`
+			AcceptanceCriteria string `json:"acceptanceCriteria"`
+			Version            int    `json:"version"`
+		}
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		jsonErr := json.Unmarshal(body, &plan)
+		if jsonErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var nameErr error
+		if plan.PlanName, nameErr = cleanName("planName", plan.PlanName, maxPlanNameLength); nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+		if err := s.moderation.Check(plan.PlanName, plan.Description, plan.AcceptanceCriteria); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// in line with the leader actions coming in over the battles socket
+		unlock := h.locks.lock(BattleID)
+		defer unlock()
+
+		plans, err := s.database.RevisePlan(BattleID, warriorID, PlanID, plan.PlanName, plan.Type, plan.ReferenceID, plan.Link, plan.Description, plan.AcceptanceCriteria, plan.Version)
+		if err == database.ErrPlanConflict {
+			RespondWithJSON(w, http.StatusConflict, planConflict(PlanID, plans))
+			return
+		}
+		if err == database.ErrPlanNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedPlans, _ := json.Marshal(plans)
+		h.broadcast <- message{CreateSocketEvent("plan_revised", string(updatedPlans), ""), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, plans)
+	}
+}
+
+// handleBattlePlanPointsUpdate handles the leader setting a plans final points out of band with an API key, like from
+// a Jira automation, the change going into the API key audit along with the points it replaced
+func (s *server) handleBattlePlanPointsUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		PlanID := vars["planId"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		sr, ok := w.(*statusRecorder)
+		if !ok || strings.TrimSpace(r.Header.Get(apiKeyHeaderName)) == "" {
+			RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "api key required"})
+			return
+		}
+		var points struct {
+			Points string `json:"points"`
+		}
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		if err := json.Unmarshal(body, &points); err != nil || points.Points == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// in line with the leader actions coming in over the battles socket
+		unlock := h.locks.lock(BattleID)
+		defer unlock()
+
+		if err := s.database.ConfirmLeader(BattleID, warriorID); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		battle, err := s.database.GetBattle(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var Previous string
+		found := false
+		for _, p := range battle.Plans {
+			if p.PlanID == PlanID {
+				Previous, found = p.Points, true
+			}
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		allowed := false
+		for _, v := range battle.PointValuesAllowed {
+			allowed = allowed || v == points.Points
+		}
+		if !allowed {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "points not allowed in battle"})
+			return
+		}
+
+		plans, err := s.database.FinalizePlan(BattleID, warriorID, PlanID, points.Points)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		sr.detail = fmt.Sprintf("plan %s points %q to %q", PlanID, Previous, points.Points)
+
+		// only the plan being voted on ends the vote in the arena, any other just has its points changed
+		event := "plan_revised"
+		if battle.ActivePlanID == PlanID {
+			event = "plan_finalized"
+		}
+		updatedPlans, _ := json.Marshal(plans)
+		h.broadcast <- message{CreateSocketEvent(event, string(updatedPlans), warriorID), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, plans)
+	}
+}
+
+// handleBattlePlanTranslationUpdate handles the leader setting a plans name and description in another language
+func (s *server) handleBattlePlanTranslationUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		PlanID := vars["planId"]
+		Locale := vars["locale"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || !localePattern.MatchString(Locale) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var nameErr error
+		if keyVal["name"], nameErr = cleanName("name", keyVal["name"], maxPlanNameLength); nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+		if err := s.moderation.Check(keyVal["name"], keyVal["description"]); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		plans, err := s.database.SetPlanTranslation(BattleID, warriorID, PlanID, Locale, keyVal["name"], keyVal["description"])
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedPlans, _ := json.Marshal(plans)
+		h.broadcast <- message{CreateSocketEvent("plan_revised", string(updatedPlans), ""), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, plans)
+	}
+}
+
+// handleBattlePlanTranslationDelete handles the leader removing a plans translation
+func (s *server) handleBattlePlanTranslationDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		plans, err := s.database.DeletePlanTranslation(BattleID, warriorID, vars["planId"], vars["locale"])
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedPlans, _ := json.Marshal(plans)
+		h.broadcast <- message{CreateSocketEvent("plan_revised", string(updatedPlans), ""), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, plans)
+	}
+}
+
+// handleBattleIssueImport handles pulling issues from one of the registered issue providers into the battle as plans,
+// either a single issue by issueId or a provider specific source like a Linear cycle or Shortcut iteration, with
+// ?dryRun=true previewing them instead and keys limiting the import to the issues picked from the preview
+func (s *server) handleBattleIssueImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		Provider := vars["provider"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// the issue keys picked from a preview, the others being left out
+		Keys := keyVal["keys"]
+		delete(keyVal, "keys")
+		if !issues.Registered(Provider) {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := s.database.ConfirmLeader(BattleID, warriorID); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		battle, err := s.database.GetBattle(BattleID, warriorID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		APIKey, err := s.database.GetTeamIssueProviderKey(battle.TeamID, Provider)
+		if err != nil || APIKey == "" {
+			log.Println("battle team has no " + Provider + " integration")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		provider, _ := issues.New(Provider, APIKey)
+		var list []*issues.Issue
+		if keyVal["issueId"] != "" {
+			var issue *issues.Issue
+			issue, err = provider.ImportIssue(keyVal["issueId"])
+			list = []*issues.Issue{issue}
+		} else {
+			list, err = provider.ListIssues(keyVal)
+		}
+		if err == issues.ErrInvalidSource {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Println("error getting " + Provider + " issues : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		if r.URL.Query().Get("dryRun") == "true" {
+			RespondWithJSON(w, http.StatusOK, previewPlanImport(s.database.GetPlans(BattleID, warriorID), issuePlans(list)))
+			return
+		}
+		if Keys != "" {
+			picked := make(map[string]bool)
+			for _, Key := range strings.Split(Keys, ",") {
+				picked[strings.TrimSpace(Key)] = true
+			}
+			var pickedList []*issues.Issue
+			for _, issue := range list {
+				if picked[issue.Key] {
+					pickedList = append(pickedList, issue)
+				}
+			}
+			list = pickedList
+		}
+
+		// issues without a title left once cleaned can't be plans
+		Plans := make([]*database.Plan, 0, len(list))
+		Texts := make([]string, 0, 2*len(list))
+		for _, p := range issuePlans(list) {
+			if p.PlanName == "" {
+				continue
+			}
+			Plans = append(Plans, p)
+			Texts = append(Texts, p.PlanName, p.Description)
+		}
+		if err := s.moderation.Check(Texts...); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		plans, err := s.database.ImportPlans(BattleID, warriorID, Provider, Plans)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedPlans, _ := json.Marshal(plans)
+		h.broadcast <- message{CreateSocketEvent("plan_added", string(updatedPlans), ""), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, plans)
+	}
+}
+
+// handleBattlePlansGet handles getting a page of a battles plans, in the requested locale where they're translated
+func (s *server) handleBattlePlansGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Limit, limitErr := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limitErr != nil || Limit < 1 || Limit > 100 {
+			Limit = 100
+		}
+		Offset, offsetErr := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offsetErr != nil || Offset < 0 {
+			Offset = 0
+		}
+
+		plans, Total, err := s.database.GetPlansPage(BattleID, warriorID, Limit, Offset)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"plans":  localizePlans(plans, preferredLocales(r)),
+			"total":  Total,
+			"limit":  Limit,
+			"offset": Offset,
+		})
+	}
+}
+
+// handleBattleStateGet gets the compact state of a battle for low-power clients polling it,
+// answering 304 when it hasn't changed since the ETag sent in If-None-Match
+func (s *server) handleBattleStateGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		State, err := s.database.GetBattleState(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithETag(w, r, State)
+	}
+}
+
+// handleBattleRecordingGet handles getting the recorded events of a battle for replay
+func (s *server) handleBattleRecordingGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		events, err := s.database.GetBattleRecording(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, events)
+	}
+}
+
+// handleBattleHistoryGet handles getting the battle and its plans as they were at the time of the at query param
+func (s *server) handleBattleHistoryGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		At, err := time.Parse(time.RFC3339, r.URL.Query().Get("at"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		battle, err := s.database.GetBattleAt(BattleID, warriorID, At)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, battle)
+	}
+}
+
+// battleJoinURL gets the absolute UI URL warriors join the battle at
+func (s *server) battleJoinURL(BattleID string) string {
+	battlePath := "/battle/"
+	if viper.GetBool("config.friendly_ui_verbs") {
+		battlePath = "/game/"
+	}
+
+	return "https://" + s.config.AppDomain + s.config.PathPrefix + battlePath + BattleID
+}
+
+// handleBattleQRCode serves a QR code PNG of the battles join URL for phones to scan, ?size= sets its width in pixels
+func (s *server) handleBattleQRCode() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Size := 256
+		if v := r.URL.Query().Get("size"); v != "" {
+			var err error
+			if Size, err = strconv.Atoi(v); err != nil || Size < 64 || Size > 1024 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if _, err := s.database.GetBattle(BattleID, warriorID); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		qr, err := qrcode.Encode(s.battleJoinURL(BattleID), qrcode.Medium, Size)
+		if err != nil {
+			log.Println("unable to encode qr code : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(len(qr)))
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+
+		if _, err := w.Write(qr); err != nil {
+			log.Println("unable to write qr code.")
+		}
+	}
+}
+
+// handleBattleEmailCodeGet gets the address plans can be emailed to the battle at
+func (s *server) handleBattleEmailCodeGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Code, err := s.database.GetBattleEmailCode(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, s.battleEmailAddress(Code))
+	}
+}
+
+// handleBattleEmailCodeCreate handles turning on emailing plans to the battle, or replacing its email code
+func (s *server) handleBattleEmailCodeCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Code, err := s.database.SetBattleEmailCode(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, s.battleEmailAddress(Code))
+	}
+}
+
+// handleBattleEmailCodeDelete handles turning off emailing plans to the battle
+func (s *server) handleBattleEmailCodeDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if err := s.database.DeleteBattleEmailCode(BattleID, warriorID); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleInboundEmail receives emails forwarded by an inbound email service (Mailgun routes, SendGrid inbound parse)
+// adding them as a plan to the battle whose email code they were sent to
+func (s *server) handleInboundEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		if s.config.InboundEmailSecret == "" ||
+			subtle.ConstantTimeCompare([]byte(key), []byte(s.config.InboundEmailSecret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// mailgun and sendgrid name the fields differently
+		Recipients := r.FormValue("recipient") + "," + r.FormValue("to")
+		Sender := r.FormValue("from")
+		Body := r.FormValue("body-plain")
+		if Body == "" {
+			Body = r.FormValue("text")
+		}
+
+		Code, PlanName := inboundEmailCode(s.config.InboundEmailAddress, Recipients, r.FormValue("subject"))
+		PlanName = sanitizeName(PlanName)
+		if Code == "" || PlanName == "" {
+			// accept it anyway so the service doesn't keep retrying an email that will never match
+			log.Println("inbound email without a battle code or subject from " + Sender)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		Description := strings.TrimSpace(Body)
+		if Sender != "" {
+			Description += "\n\nFrom: " + Sender
+		}
+
+		BattleID, plans, err := s.database.AddEmailedPlan(Code, truncateRunes(PlanName, maxPlanNameLength), Description)
+		if err != nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		updatedPlans, _ := json.Marshal(plans)
+		h.broadcast <- message{CreateSocketEvent("plan_added", string(updatedPlans), ""), BattleID}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// castVote records a vote on the battles active plan made outside the websocket, broadcasting it
+// to the arena and ending voting when everyone has voted like a vote over the websocket would
+func (s *server) castVote(Battle *database.Battle, WarriorID string, VoteValue string, VoteID string) error {
+	Plans, AllVoted, err := s.database.SetVote(
+		Battle.BattleID, WarriorID, Battle.ActivePlanID, VoteValue, VoteID, s.config.VoteChangePolicy == "reject",
+	)
+	if err != nil {
+		return err
+	}
+
+	updatedPlans, _ := json.Marshal(Plans)
+	h.broadcast <- message{CreateSocketEvent("vote_activity", string(updatedPlans), WarriorID), Battle.BattleID}
+
+	if AllVoted && Battle.AutoFinishVoting {
+		plans, err := s.database.EndPlanVoting(Battle.BattleID, WarriorID, Battle.ActivePlanID, true)
+		if err == nil {
+			updatedPlans, _ := json.Marshal(plans)
+			h.broadcast <- message{CreateSocketEvent("voting_ended", string(updatedPlans), ""), Battle.BattleID}
+		}
+	}
+
+	return nil
+}
+
+// handleBattleSMSVotersGet gets the phones voting in the battle by text message and the number they text
+func (s *server) handleBattleSMSVotersGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Voters, err := s.database.GetBattleSMSVoters(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"phoneNumber": s.config.TwilioPhoneNumber,
+			"voters":      Voters,
+		})
+	}
+}
+
+// handleBattleSMSVoterAdd handles the leader adding a participant who votes by texting from their phone
+func (s *server) handleBattleSMSVoterAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.config.TwilioAuthToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		Phone, validPhone := normalizePhone(keyVal["phone"])
+		if jsonErr != nil || !validPhone {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		Name, nameErr := cleanName("name", keyVal["name"], maxWarriorNameLength)
+		if nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+
+		Voter, err := s.database.AddBattleSMSVoter(BattleID, warriorID, Name, Phone)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		Warriors := s.database.GetBattleWarriors(BattleID)
+		updatedWarriors, _ := json.Marshal(Warriors)
+		h.broadcast <- message{CreateSocketEvent("warrior_joined", string(updatedWarriors), Voter.WarriorID), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, Voter)
+	}
+}
+
+// handleBattleSMSVoterRemove handles the leader removing a phone from voting in the battle
+func (s *server) handleBattleSMSVoterRemove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Warriors, err := s.database.RemoveBattleSMSVoter(BattleID, warriorID, vars["warriorId"])
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedWarriors, _ := json.Marshal(Warriors)
+		h.broadcast <- message{CreateSocketEvent("warrior_retreated", string(updatedWarriors), vars["warriorId"]), BattleID}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// actionItemRequest is the body of adding or updating an action item
+type actionItemRequest struct {
+	Content   string `json:"content"`
+	OwnerID   string `json:"ownerId"`
+	DueDate   string `json:"dueDate"`
+	Completed bool   `json:"completed"`
+}
+
+// readActionItem reads an action item from the request body, the content is required and the due date
+// when set must be a YYYY-MM-DD date
+func readActionItem(r *http.Request) (*actionItemRequest, bool) {
+	var item actionItemRequest
+	body, _ := ioutil.ReadAll(r.Body) // check for errors
+	if err := json.Unmarshal(body, &item); err != nil {
+		return nil, false
+	}
+
+	item.Content = strings.TrimSpace(item.Content)
+	if item.Content == "" {
+		return nil, false
+	}
+	item.Content = truncateRunes(item.Content, 1000)
+	if _, err := time.Parse("2006-01-02", item.DueDate); item.DueDate != "" && err != nil {
+		return nil, false
+	}
+
+	return &item, true
+}
+
+// handleBattleActionItemsGet gets the action items recorded in the battle
+func (s *server) handleBattleActionItemsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if !s.database.IsBattleWarrior(BattleID, warriorID) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, s.database.GetBattleActionItems(BattleID))
+	}
+}
+
+// handleBattleActionItemAdd handles the leader recording an action item
+func (s *server) handleBattleActionItemAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		item, ok := readActionItem(r)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Items, err := s.database.AddBattleActionItem(BattleID, warriorID, item.Content, item.OwnerID, item.DueDate)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedItems, _ := json.Marshal(Items)
+		h.broadcast <- message{CreateSocketEvent("action_items_updated", string(updatedItems), warriorID), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, Items)
+	}
+}
+
+// handleBattleActionItemUpdate handles the leader revising or completing an action item
+func (s *server) handleBattleActionItemUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		item, ok := readActionItem(r)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Items, err := s.database.UpdateBattleActionItem(BattleID, warriorID, vars["itemId"], item.Content, item.OwnerID, item.DueDate, item.Completed)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedItems, _ := json.Marshal(Items)
+		h.broadcast <- message{CreateSocketEvent("action_items_updated", string(updatedItems), warriorID), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, Items)
+	}
+}
+
+// handleBattleActionItemDelete handles the leader removing an action item
+func (s *server) handleBattleActionItemDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Items, err := s.database.DeleteBattleActionItem(BattleID, warriorID, vars["itemId"])
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedItems, _ := json.Marshal(Items)
+		h.broadcast <- message{CreateSocketEvent("action_items_updated", string(updatedItems), warriorID), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, Items)
+	}
+}
+
+// handleTwilioSMS receives text messages sent to the twilio number, recording them as the
+// phones vote on the active plan of the battle it was added to
+func (s *server) handleTwilioSMS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.config.TwilioAuthToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature := twilioSignature(s.config.TwilioAuthToken, s.smsWebhookURL(), r.PostForm)
+		if !hmac.Equal([]byte(r.Header.Get("X-Twilio-Signature")), []byte(signature)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		BattleID, WarriorID, err := s.database.GetSMSVoter(r.PostForm.Get("From"))
+		if err != nil {
+			respondWithSMS(w, "This number isn't voting in a battle, ask the battle leader to add it.")
+			return
+		}
+
+		Battle, err := s.database.GetBattle(BattleID, WarriorID)
+		if err != nil || Battle.ActivePlanID == "" || Battle.VotingLocked {
+			respondWithSMS(w, "Voting isn't open right now.")
+			return
+		}
+
+		VoteValue, valid := smsVoteValue(r.PostForm.Get("Body"), Battle.PointValuesAllowed)
+		if !valid {
+			respondWithSMS(w, "Reply with one of "+strings.Join(Battle.PointValuesAllowed, ", "))
+			return
+		}
+
+		// the message id makes twilio retrying the webhook a no-op
+		err = s.castVote(Battle, WarriorID, VoteValue, smsVoteID(r.PostForm.Get("MessageSid")))
+		if err == database.ErrVoteChangeRejected {
+			respondWithSMS(w, "Your vote can't be changed.")
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		respondWithSMS(w, "Voted "+VoteValue)
+	}
+}
+
+// readBattleFilter reads the battles list filter from the search, status (active, voting or completed),
+// from and to (inclusive YYYY-MM-DD dates) and role (owned or joined) query params
+func readBattleFilter(query url.Values) (*database.BattleFilter, bool) {
+	Filter := &database.BattleFilter{
+		Search: strings.TrimSpace(query.Get("search")),
+		Status: query.Get("status"),
+		Role:   query.Get("role"),
+	}
+
+	switch Filter.Status {
+	case "", "active", "voting", "completed":
+	default:
+		return Filter, false
+	}
+	switch Filter.Role {
+	case "", "owned", "joined":
+	default:
+		return Filter, false
+	}
+	if from := query.Get("from"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return Filter, false
+		}
+		Filter.CreatedFrom = &date
+	}
+	if to := query.Get("to"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return Filter, false
+		}
+		date = date.AddDate(0, 0, 1)
+		Filter.CreatedTo = &date
+	}
+
+	return Filter, true
+}
+
+// battlesList is the warriors battles with the starred ones separate
+type battlesList struct {
+	Starred []*database.Battle `json:"starred"`
+	Battles []*database.Battle `json:"battles"`
+}
+
+// handleBattlesGet looks up battles associated with warriorID
+func (s *server) handleBattlesGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		Filter, ok := readBattleFilter(r.URL.Query())
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		battles, err := s.database.GetBattlesByWarrior(warriorID, Filter)
+
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		BattleIDs := make([]string, 0, len(battles))
+		for _, b := range battles {
+			BattleIDs = append(BattleIDs, b.BattleID)
+		}
+		live := h.liveWarriors(BattleIDs)
+		list := &battlesList{Starred: make([]*database.Battle, 0), Battles: make([]*database.Battle, 0)}
+		for _, b := range battles {
+			b.LiveWarriors = live[b.BattleID]
+			b.VotingInProgress = b.LiveWarriors > 0 && b.ActivePlanID != "" && !b.VotingLocked
+			if b.Starred {
+				list.Starred = append(list.Starred, b)
+			} else {
+				list.Battles = append(list.Battles, b)
+			}
+		}
+
+		RespondWithJSON(w, http.StatusOK, list)
+	}
+}
+
+// handleBattleStar handles starring (PUT) or unstarring (DELETE) a battle in the warriors list of battles
+func (s *server) handleBattleStar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if err := s.database.SetBattleStarred(BattleID, warriorID, r.Method == http.MethodPut); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+/*
+	Team Handlers
+*/
+
+// handleTeamCreate handles creating a team with the warrior as its admin
+func (s *server) handleTeamCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || keyVal["name"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := s.licenseAllows(database.LicenseTeams); err != nil {
+			RespondWithJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+
+		Team, err := s.database.CreateTeam(warriorID, keyVal["name"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Team)
+	}
+}
+
+// handleTeamsGet gets the teams the warrior belongs to
+func (s *server) handleTeamsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		RespondWithJSON(w, http.StatusOK, s.database.GetTeamsByWarrior(warriorID))
+	}
+}
+
+// handleTeamGet gets a team including its warriors
+func (s *server) handleTeamGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Team, err := s.database.GetTeam(vars["teamId"])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Team)
+	}
+}
+
+// handleTeamDelete handles deleting a team
+func (s *server) handleTeamDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := s.database.DeleteTeam(vars["teamId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		return
+	}
+}
+
+// handleTeamWarriorAdd handles adding a registered warrior to the team by email
+func (s *server) handleTeamWarriorAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || keyVal["email"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Role := keyVal["role"]
+		if Role != "ADMIN" {
+			Role = "MEMBER"
+		}
+
+		Team, err := s.database.TeamAddWarrior(vars["teamId"], keyVal["email"], Role)
+		if err == database.ErrWarriorNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if warrior, err := s.database.GetWarriorByEmail(keyVal["email"]); err == nil &&
+			s.database.WarriorNotifies(warrior.WarriorID, database.NotificationTeamAdded, database.NotificationChannelEmail) {
+			go s.email.SendTeamAdded(warrior.WarriorName, warrior.WarriorEmail, Team.TeamName)
+		}
+
+		RespondWithJSON(w, http.StatusOK, Team)
+	}
+}
+
+// handleTeamWarriorRemove handles removing a warrior from the team
+func (s *server) handleTeamWarriorRemove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Team, err := s.database.TeamRemoveWarrior(vars["teamId"], vars["warriorId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Team)
+	}
+}
+
+// handleTeamInvite gets a link warriors can join the team as a member with
+func (s *server) handleTeamInvite() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		link, expires := s.signURL("/api/team/"+vars["teamId"]+"/join", nil, inviteLinkTTL)
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{"url": link, "expires": expires})
+	}
+}
+
+// handleTeamJoin handles a warrior joining the team with an invite link
+func (s *server) handleTeamJoin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Team, err := s.database.TeamJoin(vars["teamId"], warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Team)
+	}
+}
+
+// handleTeamChecklistGet gets the teams Definition of Ready checklist
+func (s *server) handleTeamChecklistGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		RespondWithJSON(w, http.StatusOK, s.database.GetTeamChecklist(vars["teamId"]))
+	}
+}
+
+// handleTeamChecklistItemAdd handles adding an item to the teams Definition of Ready checklist
+func (s *server) handleTeamChecklistItemAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var keyVal struct {
+			Text      string `json:"text"`
+			SortOrder int    `json:"sortOrder"`
+		}
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || keyVal.Text == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Items, err := s.database.AddTeamChecklistItem(vars["teamId"], keyVal.Text, keyVal.SortOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Items)
+	}
+}
+
+// handleTeamParkedPlansGet gets the plans waiting in the teams parking lot
+func (s *server) handleTeamParkedPlansGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		RespondWithJSON(w, http.StatusOK, s.database.GetTeamParkedPlans(vars["teamId"]))
+	}
+}
+
+// handleTeamParkedPlanAdd handles parking a plan in the teams parking lot, a plan matching one already parked being
+// refused with the parked plan unless allowDuplicate is set
+func (s *server) handleTeamParkedPlanAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var plan struct {
+			PlanName           string `json:"planName"`
+			Type               string `json:"type"`
+			ReferenceID        string `json:"referenceId"`
+			Link               string `json:"link"`
+			Description        string `json:"description"`
+			AcceptanceCriteria string `json:"acceptanceCriteria"`
+			AllowDuplicate     bool   `json:"allowDuplicate"`
+		}
+		jsonErr := json.Unmarshal(body, &plan) // check for errors
+		if jsonErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var nameErr error
+		if plan.PlanName, nameErr = cleanName("planName", plan.PlanName, maxPlanNameLength); nameErr != nil {
+			respondInvalid(w, r, nameErr)
+			return
+		}
+		if err := s.moderation.Check(plan.PlanName, plan.Description, plan.AcceptanceCriteria); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if plan.Type == "" {
+			plan.Type = "Story"
+		}
+		if !plan.AllowDuplicate {
+			if p := duplicatePlan(parkedPlans(s.database.GetTeamParkedPlans(vars["teamId"])), plan.PlanName, plan.ReferenceID); p != nil {
+				RespondWithJSON(w, http.StatusConflict, map[string]*planDuplicate{"duplicate": {
+					PlanID: p.PlanID, PlanName: p.PlanName, ReferenceID: p.ReferenceID, Source: planDuplicateParkingLot,
+				}})
+				return
+			}
+		}
+
+		Plans, err := s.database.ParkTeamPlan(vars["teamId"], plan.PlanName, plan.Type, plan.ReferenceID, plan.Link, plan.Description, plan.AcceptanceCriteria)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Plans)
+	}
+}
+
+// handleTeamParkedPlanDelete handles removing a plan from the teams parking lot
+func (s *server) handleTeamParkedPlanDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Plans, err := s.database.DeleteTeamParkedPlan(vars["teamId"], vars["planId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Plans)
+	}
+}
+
+// handleTeamParkedPlansPull handles the leader of one of the teams battles pulling plans out of
+// the parking lot into their battle, all of them unless planIds are given
+func (s *server) handleTeamParkedPlansPull() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var pull struct {
+			BattleID string   `json:"battleId"`
+			PlanIDs  []string `json:"planIds"`
+		}
+		jsonErr := json.Unmarshal(body, &pull) // check for errors
+		if jsonErr != nil || pull.BattleID == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		unlock := h.locks.lock(pull.BattleID)
+		defer unlock()
+
+		Plans, err := s.database.PullTeamParkedPlans(vars["teamId"], pull.BattleID, warriorID, pull.PlanIDs)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedPlans, _ := json.Marshal(Plans)
+		h.broadcast <- message{CreateSocketEvent("plan_added", string(updatedPlans), ""), pull.BattleID}
+
+		RespondWithJSON(w, http.StatusOK, Plans)
+	}
+}
+
+// handleBattlePlanPark handles the leader moving a plan out of the battle into the parking lot of the battles team
+func (s *server) handleBattlePlanPark() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		unlock := h.locks.lock(BattleID)
+		defer unlock()
+
+		Plans, err := s.database.ParkBattlePlan(BattleID, warriorID, vars["planId"])
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedPlans, _ := json.Marshal(Plans)
+		h.broadcast <- message{CreateSocketEvent("plan_burned", string(updatedPlans), ""), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, Plans)
+	}
+}
+
+// handleTeamChecklistItemDelete handles removing an item from the teams Definition of Ready checklist
+func (s *server) handleTeamChecklistItemDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Items, err := s.database.DeleteTeamChecklistItem(vars["teamId"], vars["itemId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Items)
+	}
+}
+
+// handleTeamConfluenceGet gets the teams Confluence integration settings without the api token
+func (s *server) handleTeamConfluenceGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Confluence, err := s.database.GetTeamConfluence(vars["teamId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if Confluence == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Confluence)
+	}
+}
+
+// handleTeamConfluenceUpdate handles configuring where the teams battle results are published in Confluence
+func (s *server) handleTeamConfluenceUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var keyVal struct {
+			database.TeamConfluence
+			APIToken string `json:"apiToken"`
+		}
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		baseURL, urlErr := url.Parse(keyVal.BaseURL)
+		if jsonErr != nil || urlErr != nil || baseURL.Scheme != "https" || baseURL.Host == "" ||
+			keyVal.SpaceKey == "" || keyVal.Username == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// the api token is only required when first configuring the integration
+		Existing, err := s.database.GetTeamConfluence(TeamID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if Existing == nil && keyVal.APIToken == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		keyVal.TeamConfluence.APIToken = keyVal.APIToken
+		if err := s.database.SetTeamConfluence(TeamID, &keyVal.TeamConfluence); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, keyVal.TeamConfluence)
+	}
+}
+
+// handleTeamConfluenceDelete handles removing the teams Confluence integration
+func (s *server) handleTeamConfluenceDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := s.database.DeleteTeamConfluence(vars["teamId"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleTeamIssueProvidersGet gets the issue providers compiled into the server and whether the team has configured them
+func (s *server) handleTeamIssueProvidersGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		configured, err := s.database.GetTeamIssueProviders(vars["teamId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		providers := make(map[string]bool)
+		for _, Provider := range issues.Providers() {
+			providers[Provider] = false
+		}
+		for _, Provider := range configured {
+			if _, ok := providers[Provider]; ok {
+				providers[Provider] = true
+			}
+		}
+
+		RespondWithJSON(w, http.StatusOK, providers)
+	}
+}
+
+// handleTeamIssueProviderGet reports whether the team has configured an api key for the issue provider
+func (s *server) handleTeamIssueProviderGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if !issues.Registered(vars["provider"]) {
+			http.NotFound(w, r)
+			return
+		}
+
+		APIKey, err := s.database.GetTeamIssueProviderKey(vars["teamId"], vars["provider"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]bool{"configured": APIKey != ""})
+	}
+}
+
+// handleTeamIssueProviderUpdate handles saving the teams api key for the issue provider
+func (s *server) handleTeamIssueProviderUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if !issues.Registered(vars["provider"]) {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || keyVal["apiKey"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.database.SetTeamIssueProviderKey(vars["teamId"], vars["provider"], keyVal["apiKey"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]bool{"configured": true})
+	}
+}
+
+// handleTeamIssueProviderDelete handles removing the teams issue provider integration
+func (s *server) handleTeamIssueProviderDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := s.database.DeleteTeamIssueProviderKey(vars["teamId"], vars["provider"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleTeamJiraWebhookGet gets the URL and secret team admins configure a Jira webhook with
+func (s *server) handleTeamJiraWebhookGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+
+		Secret, err := s.jiraWebhookSecret(TeamID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]string{
+			"url":    s.jiraWebhookURL(TeamID),
+			"secret": Secret,
+			"events": "jira:issue_updated",
+		})
+	}
+}
+
+// handleJiraWebhook receives issue events from a teams Jira webhook, reconciling the plans imported from an issue
+// in the teams battles when its summary or description changes and letting their arenas know
+func (s *server) handleJiraWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamID := vars["teamId"]
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+
+		// teams that never got their secret haven't configured the webhook
+		Secret, err := s.database.GetTeamJiraWebhookSecret(TeamID)
+		if err != nil || Secret == "" ||
+			!hmac.Equal([]byte(r.Header.Get("X-Hub-Signature")), []byte(jiraSignature(Secret, body))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event jiraWebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if event.WebhookEvent != "jira:issue_updated" || event.Issue == nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		Synced, BattlePlans, err := s.database.SyncIssuePlans(TeamID, "jira", event.Issue.ID, map[string]string{
+			"name":        truncateRunes(sanitizeName(event.Issue.Fields.Summary), maxPlanNameLength),
+			"description": event.Issue.Fields.Description,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for BattleID, plans := range BattlePlans {
+			updatedPlans, _ := json.Marshal(plans)
+			h.broadcast <- message{CreateSocketEvent("plan_revised", string(updatedPlans), ""), BattleID}
+		}
+		for _, p := range Synced {
+			notice, _ := json.Marshal(p)
+			h.broadcast <- message{CreateSocketEvent("plan_synced", string(notice), ""), p.BattleID}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleBattleIssueConflictsGet gets the fields of the battles plans edited differently in the plan and its issue
+func (s *server) handleBattleIssueConflictsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		Conflicts, err := s.database.GetIssueConflicts(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Conflicts)
+	}
+}
+
+// handleBattleIssueConflictResolve resolves a conflicting plan field by taking the issues value (theirs)
+// or keeping the plans (mine) and pushing it to the issue
+func (s *server) handleBattleIssueConflictResolve() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		PlanID := vars["planId"]
+		Field := vars["field"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || !contains(database.IssueFields, Field) ||
+			(keyVal["resolution"] != "theirs" && keyVal["resolution"] != "mine") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		unlock := h.locks.lock(BattleID)
+		defer unlock()
+
+		plans, err := s.database.ResolveIssueConflict(BattleID, warriorID, PlanID, Field, keyVal["resolution"])
+		if err == database.ErrIssueConflictNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		updatedPlans, _ := json.Marshal(plans)
+		h.broadcast <- message{CreateSocketEvent("plan_revised", string(updatedPlans), ""), BattleID}
+
+		RespondWithJSON(w, http.StatusOK, plans)
+	}
+}
+
+/*
+	Department Handlers
+*/
+
+// handleDepartmentsGet gets the departments the warrior belongs to
+func (s *server) handleDepartmentsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		RespondWithJSON(w, http.StatusOK, s.database.GetDepartmentsByWarrior(warriorID))
+	}
+}
+
+// handleDepartmentGet gets a department including its teams and warriors
+func (s *server) handleDepartmentGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Department, err := s.database.GetDepartment(vars["departmentId"])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Department)
+	}
+}
+
+// handleDepartmentWarriorAdd handles adding a registered warrior to the department by email
+func (s *server) handleDepartmentWarriorAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || keyVal["email"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Role := keyVal["role"]
+		if Role != "ADMIN" {
+			Role = "MEMBER"
+		}
+
+		Department, err := s.database.DepartmentAddWarrior(vars["departmentId"], keyVal["email"], Role)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Department)
+	}
+}
+
+// handleDepartmentWarriorRemove handles removing a warrior from the department
+func (s *server) handleDepartmentWarriorRemove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		Department, err := s.database.DepartmentRemoveWarrior(vars["departmentId"], vars["warriorId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Department)
+	}
+}
+
+// handleDepartmentBattlesGet gets a page of the battles of the departments teams
+func (s *server) handleDepartmentBattlesGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		query := r.URL.Query()
+		Limit, Offset := 100, 0
+		var err error
+
+		if v := query.Get("limit"); v != "" {
+			if Limit, err = strconv.Atoi(v); err != nil || Limit < 1 || Limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if Offset, err = strconv.Atoi(v); err != nil || Offset < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		Battles, err := s.database.GetDepartmentBattles(vars["departmentId"], Limit, Offset)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Battles)
+	}
+}
+
+// handleDepartmentBattleDelete handles a department admin deleting a battle of one of the departments teams
+func (s *server) handleDepartmentBattleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["battleId"]
+
+		err := s.database.DeleteDepartmentBattle(vars["departmentId"], BattleID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		h.broadcast <- message{CreateSocketEvent("battle_conceded", "", ""), BattleID}
+		ops.publish("battle_ended", BattleID, "")
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+/*
+	REST Hook Handlers
+*/
+
+// handleHookMe gets the warrior the api key belongs to, used by automation platforms to test the connection
+func (s *server) handleHookMe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		warrior, warErr := s.database.GetWarrior(warriorID)
+		if warErr != nil {
+			log.Println("error finding warrior : " + warErr.Error() + "\n")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, warrior)
+	}
+}
+
+// handleHookSubscribe handles subscribing a target url to the events of the battles the warrior leads
+func (s *server) handleHookSubscribe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || !contains(outboxEventTypes, keyVal["event"]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		webhook := &database.Webhook{
+			Name:      "REST hook " + keyVal["event"],
+			URL:       keyVal["target_url"],
+			Events:    []string{keyVal["event"]},
+			Active:    true,
+			WarriorID: warriorID,
+		}
+		if !validWebhook(webhook) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		webhook, err := s.database.CreateWebhook(webhook)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusCreated, map[string]string{"id": webhook.WebhookID})
+	}
+}
+
+// handleHookUnsubscribe handles removing one of the warriors REST hook subscriptions
+func (s *server) handleHookUnsubscribe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if err := s.database.DeleteWarriorWebhook(warriorID, vars["hookId"]); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleHookTrigger gets the latest events of a type from the battles the warrior leads, newest first,
+// for polling triggers and sample data
+func (s *server) handleHookTrigger() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		if !contains(outboxEventTypes, vars["event"]) {
+			http.NotFound(w, r)
+			return
+		}
+
+		events, err := s.database.GetLeaderOutboxEvents(vars["event"], warriorID, 50)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		items := make([]*webhookEvent, 0, len(events))
+		for _, event := range events {
+			if item, err := newWebhookEvent(event); err == nil {
+				items = append(items, item)
+			}
+		}
+
+		RespondWithJSON(w, http.StatusOK, items)
+	}
+}
+
+/*
+	Admin Handlers
+*/
+
+// handleAppStats gets the applications stats along with whether an update is available
+func (s *server) handleAppStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		AppStats, err := s.database.GetAppStats()
+
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, struct {
+			*database.ApplicationStats
+			versionStatus
+		}{AppStats, s.versionStatus()})
+	}
+}
+
+// handleJobsGet gets the schedule and last run status of the background jobs
+func (s *server) handleJobsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses := make(map[string]*database.Job)
+		for _, j := range s.database.GetJobs() {
+			statuses[j.Name] = j
+		}
+
+		jobs := make([]*database.Job, 0)
+		for _, j := range s.jobs {
+			status, ok := statuses[j.name]
+			if !ok {
+				status = &database.Job{Name: j.name}
+			}
+			status.Schedule = j.spec
+			jobs = append(jobs, status)
+		}
+
+		RespondWithJSON(w, http.StatusOK, jobs)
+	}
+}
+
+// handleRetentionReportsGet gets a page of what the retention policy purged, newest first
+func (s *server) handleRetentionReportsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		Limit, Offset := 30, 0
+		var err error
+
+		if v := query.Get("limit"); v != "" {
+			if Limit, err = strconv.Atoi(v); err != nil || Limit < 1 || Limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if Offset, err = strconv.Atoi(v); err != nil || Offset < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		Reports, err := s.database.GetRetentionReports(Limit, Offset)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Reports)
+	}
+}
+
+// handleSecretsReencrypt handles re-encrypting the stored integration credentials with the current key
+// right away rather than waiting for the nightly job, after rotating keys
+func (s *server) handleSecretsReencrypt() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Count, err := s.database.ReencryptSecrets()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]int{"reencrypted": Count})
+	}
+}
+
+// handlePasswordHashReport gets how many warriors passwords are still hashed with a legacy scheme or outdated
+// parameters, to know when the transparent migration on login is done
+func (s *server) handlePasswordHashReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Report, err := s.database.GetPasswordHashReport()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Report)
+	}
+}
+
+// handleEmailTest sends a test email, to the admin unless an email is given,
+// returning the SMTP conversation so delivery problems can be diagnosed
+func (s *server) handleEmailTest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		json.Unmarshal(body, &keyVal) // check for errors
+
+		warrior, warErr := s.database.GetWarrior(warriorID)
+		if warErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		Name, Email := warrior.WarriorName, warrior.WarriorEmail
+		if keyVal["email"] != "" {
+			Email = keyVal["email"]
+		}
+		if Email == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		transcript, err := s.email.SendTest(Name, Email)
+		result := map[string]interface{}{
+			"sent":       err == nil,
+			"error":      "",
+			"transcript": transcript.Steps,
+		}
+		if err != nil {
+			result["error"] = err.Error()
+		}
+
+		RespondWithJSON(w, http.StatusOK, result)
+	}
+}
+
+// handleEmailDeliveriesGet gets the most recent email delivery attempts
+func (s *server) handleEmailDeliveriesGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deliveries, err := s.database.GetEmailDeliveries(100)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, deliveries)
+	}
+}
+
+// handleEmailBroadcastCreate queues an announcement email to every registered warrior or the members of a team,
+// warriors with notifications turned off are skipped
+func (s *server) handleEmailBroadcastCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		Subject := strings.TrimSpace(keyVal["subject"])
+		Body := strings.TrimSpace(keyVal["body"])
+		if jsonErr != nil || Subject == "" || len(Subject) > 256 || Body == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		TeamID := keyVal["teamId"]
+		if TeamID != "" {
+			if _, err := uuid.Parse(TeamID); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		Broadcast, err := s.database.CreateEmailBroadcast(warriorID, Subject, Body, TeamID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Broadcast)
+	}
+}
+
+// handleEmailBroadcastsGet gets a page of the announcements sent with how far their sending got
+func (s *server) handleEmailBroadcastsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		Limit, Offset := 30, 0
+		var err error
+
+		if v := query.Get("limit"); v != "" {
+			if Limit, err = strconv.Atoi(v); err != nil || Limit < 1 || Limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if Offset, err = strconv.Atoi(v); err != nil || Offset < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		Broadcasts, err := s.database.GetEmailBroadcasts(emailBroadcastMaxAttempts, Limit, Offset)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Broadcasts)
+	}
+}
+
+// validWebhook checks the webhook has a name, an http(s) url and a template that parses
+func validWebhook(wh *database.Webhook) bool {
+	hookURL, err := url.Parse(wh.URL)
+	if err != nil || (hookURL.Scheme != "http" && hookURL.Scheme != "https") || hookURL.Host == "" || wh.Name == "" {
+		return false
+	}
+	_, err = parseWebhookTemplate(wh.Template)
+
+	return err == nil
+}
+
+// handleAPIKeyRequestsGet gets a page of the audited API key requests, optionally of a warrior and/or key
+func (s *server) handleAPIKeyRequestsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		Limit, Offset := 100, 0
+		var err error
+
+		if v := query.Get("limit"); v != "" {
+			if Limit, err = strconv.Atoi(v); err != nil || Limit < 1 || Limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if Offset, err = strconv.Atoi(v); err != nil || Offset < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		Requests, err := s.database.GetAPIKeyRequests(query.Get("warriorId"), query.Get("keyId"), Limit, Offset)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Requests)
+	}
+}
+
+// handleWebhooksGet gets the webhooks
+func (s *server) handleWebhooksGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhooks, err := s.database.GetWebhooks()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, webhooks)
+	}
+}
+
+// handleWebhookCreate handles adding a webhook
+func (s *server) handleWebhookCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		webhook := &database.Webhook{Active: true}
+		jsonErr := json.Unmarshal(body, webhook) // check for errors
+		if jsonErr != nil || !validWebhook(webhook) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		webhook, err := s.database.CreateWebhook(webhook)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, webhook)
+	}
+}
+
+// handleWebhookUpdate handles updating a webhook
+func (s *server) handleWebhookUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		webhook := &database.Webhook{Active: true}
+		jsonErr := json.Unmarshal(body, webhook) // check for errors
+		if jsonErr != nil || !validWebhook(webhook) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		webhook.WebhookID = vars["webhookId"]
+		if err := s.database.UpdateWebhook(webhook); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, webhook)
+	}
+}
+
+// handleWebhookDelete handles removing a webhook
+func (s *server) handleWebhookDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := s.database.DeleteWebhook(vars["webhookId"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleGetRegisteredWarriors gets a list of registered warriors
+func (s *server) handleGetRegisteredWarriors() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		Limit, _ := strconv.Atoi(vars["limit"])
 		Offset, _ := strconv.Atoi(vars["offset"])
 
 		Warriors := s.database.GetRegisteredWarriors(Limit, Offset)
@@ -842,7 +3516,310 @@ func (s *server) handleGetRegisteredWarriors() http.HandlerFunc {
 	}
 }
 
-// handleWarriorCreate registers a user as a corporal warrior (authenticated)
+// validRole checks the role has a name and only known permissions
+func validRole(Name string, Permissions []string) bool {
+	if strings.TrimSpace(Name) == "" {
+		return false
+	}
+	for _, p := range Permissions {
+		if !contains(database.Permissions, p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleRolesGet gets the roles along with every permission that can be granted
+func (s *server) handleRolesGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roles, err := s.database.GetRoles()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"roles":       roles,
+			"permissions": database.Permissions,
+		})
+	}
+}
+
+// handleRoleCreate handles adding a role
+func (s *server) handleRoleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var role database.Role
+		jsonErr := json.Unmarshal(body, &role) // check for errors
+		if jsonErr != nil || !validRole(role.Name, role.Permissions) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		NewRole, err := s.database.CreateRole(strings.TrimSpace(role.Name), role.Description, role.Permissions)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, NewRole)
+	}
+}
+
+// handleRoleUpdate handles updating a roles name, description and permissions
+func (s *server) handleRoleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var role database.Role
+		jsonErr := json.Unmarshal(body, &role) // check for errors
+		if jsonErr != nil || !validRole(role.Name, role.Permissions) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.database.UpdateRole(vars["roleId"], strings.TrimSpace(role.Name), role.Description, role.Permissions); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleRoleDelete handles removing a role
+func (s *server) handleRoleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := s.database.DeleteRole(vars["roleId"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleRoleAssignmentsGet gets the warriors and team roles a role is assigned to
+func (s *server) handleRoleAssignmentsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		assignments, err := s.database.GetRoleAssignments(vars["roleId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, assignments)
+	}
+}
+
+// handleRoleWarriorAssign handles assigning a role to a warrior, PUT assigns and DELETE unassigns
+func (s *server) handleRoleWarriorAssign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var err error
+		if r.Method == http.MethodDelete {
+			err = s.database.UnassignWarriorRole(vars["roleId"], vars["warriorId"])
+		} else {
+			err = s.database.AssignWarriorRole(vars["roleId"], vars["warriorId"])
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleRoleTeamAssign handles assigning a role to everyone with a team role (ADMIN or MEMBER) in a team,
+// PUT assigns and DELETE unassigns
+func (s *server) handleRoleTeamAssign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TeamRole := strings.ToUpper(vars["teamRole"])
+		if TeamRole != "ADMIN" && TeamRole != "MEMBER" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if r.Method == http.MethodDelete {
+			err = s.database.UnassignTeamRole(vars["roleId"], vars["teamId"], TeamRole)
+		} else {
+			err = s.database.AssignTeamRole(vars["roleId"], vars["teamId"], TeamRole)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleAdminDepartmentsGet gets every department
+func (s *server) handleAdminDepartmentsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		RespondWithJSON(w, http.StatusOK, s.database.GetDepartments())
+	}
+}
+
+// handleDepartmentCreate handles creating an empty department
+func (s *server) handleDepartmentCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		keyVal := make(map[string]string)
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || keyVal["name"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		Department, err := s.database.CreateDepartment(keyVal["name"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Department)
+	}
+}
+
+// handleDepartmentDelete handles deleting a department, its teams are kept
+func (s *server) handleDepartmentDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := s.database.DeleteDepartment(vars["departmentId"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleDepartmentTeamAssign handles moving a team into a department with PUT and out of it with DELETE
+func (s *server) handleDepartmentTeamAssign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var Department *database.Department
+		var err error
+		if r.Method == http.MethodDelete {
+			Department, err = s.database.DepartmentRemoveTeam(vars["departmentId"], vars["teamId"])
+		} else {
+			Department, err = s.database.DepartmentAddTeam(vars["departmentId"], vars["teamId"])
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Department)
+	}
+}
+
+// handleWarriorSearch searches the registered warriors by name or email, rank, verified and when they were last active
+func (s *server) handleWarriorSearch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		Search := &database.WarriorSearch{
+			Query: strings.TrimSpace(query.Get("q")),
+			Rank:  query.Get("rank"),
+			Limit: 20,
+		}
+
+		if v := query.Get("limit"); v != "" {
+			Limit, err := strconv.Atoi(v)
+			if err != nil || Limit < 1 || Limit > 100 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			Search.Limit = Limit
+		}
+		if v := query.Get("offset"); v != "" {
+			Offset, err := strconv.Atoi(v)
+			if err != nil || Offset < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			Search.Offset = Offset
+		}
+		if v := query.Get("verified"); v != "" {
+			Verified, err := strconv.ParseBool(v)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			Search.Verified = &Verified
+		}
+		// dates are days like 2021-03-01
+		if v := query.Get("activeAfter"); v != "" {
+			ActiveAfter, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			Search.ActiveAfter = &ActiveAfter
+		}
+		if v := query.Get("activeBefore"); v != "" {
+			ActiveBefore, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			Search.ActiveBefore = &ActiveBefore
+		}
+
+		Warriors := s.database.SearchRegisteredWarriors(Search)
+
+		RespondWithJSON(w, http.StatusOK, Warriors)
+	}
+}
+
+// handleInactiveWarriorsGet gets the registered warriors that haven't been active for ?days= (90 by default),
+// for cleaning up unused accounts
+func (s *server) handleInactiveWarriorsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		Days, Limit, Offset := 90, 100, 0
+		var err error
+
+		if v := query.Get("days"); v != "" {
+			if Days, err = strconv.Atoi(v); err != nil || Days < 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			if Limit, err = strconv.Atoi(v); err != nil || Limit < 1 || Limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if Offset, err = strconv.Atoi(v); err != nil || Offset < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		Warriors := s.database.GetInactiveWarriors(Days, Limit, Offset)
+
+		RespondWithJSON(w, http.StatusOK, Warriors)
+	}
+}
+
+// handleWarriorCreate registers a user as a corporal warrior (authenticated), emailing them an invitation to set
+// their password when the admin doesn't give one
 func (s *server) handleWarriorCreate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, _ := ioutil.ReadAll(r.Body) // check for errors
@@ -852,6 +3829,41 @@ func (s *server) handleWarriorCreate() http.HandlerFunc {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		if err := s.licenseAllows(database.LicenseWarriors); err != nil {
+			RespondWithJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// without a password the warrior is invited to set their own, so the admin never knows it
+		if keyVal["warriorPassword1"] == "" && keyVal["warriorPassword2"] == "" {
+			WarriorName, WarriorEmail, _, accountErr := ValidateWarriorAccount(
+				keyVal["warriorName"],
+				keyVal["warriorEmail"],
+				"placeholder",
+				"placeholder",
+			)
+			if accountErr != nil {
+				respondInvalid(w, r, accountErr)
+				return
+			}
+
+			newWarrior, err := s.database.CreateInvitedWarrior(WarriorName, WarriorEmail)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			InviteID, err := s.database.CreateWarriorInvite(newWarrior.WarriorID)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			s.email.SendInvite(WarriorName, WarriorEmail, InviteID)
+
+			RespondWithJSON(w, http.StatusOK, newWarrior)
+			return
+		}
 
 		WarriorName, WarriorEmail, WarriorPassword, accountErr := ValidateWarriorAccount(
 			keyVal["warriorName"],
@@ -861,7 +3873,7 @@ func (s *server) handleWarriorCreate() http.HandlerFunc {
 		)
 
 		if accountErr != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			respondInvalid(w, r, accountErr)
 			return
 		}
 
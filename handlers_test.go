@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/moderation"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/securecookie"
+	"github.com/spf13/viper"
+)
+
+func TestValidateBattleLocaleValid(t *testing.T) {
+	tz, locale, err := ValidateBattleLocale("Europe/Berlin", "de-DE")
+
+	if err != nil || tz != "Europe/Berlin" || locale != "de-DE" {
+		t.Error("Expected valid timezone and locale, got ", tz, locale, err)
+	}
+}
+
+func TestValidateBattleLocaleEmpty(t *testing.T) {
+	_, _, err := ValidateBattleLocale("", "")
+
+	if err != nil {
+		t.Error("Expected empty values to be valid, got ", err)
+	}
+}
+
+func TestValidateBattleLocaleInvalidTimezone(t *testing.T) {
+	_, _, err := ValidateBattleLocale("Mars/Olympus_Mons", "en")
+
+	if err == nil {
+		t.Error("Expected invalid timezone error")
+	}
+}
+
+func TestValidateBattleLocaleInvalidLocale(t *testing.T) {
+	_, _, err := ValidateBattleLocale("UTC", "not a locale")
+
+	if err == nil {
+		t.Error("Expected invalid locale error")
+	}
+}
+
+func TestValidateBattleLocaleTooLong(t *testing.T) {
+	if _, _, err := ValidateBattleLocale("UTC", "zh-Hant-TW-variant"); err == nil {
+		t.Error("Expected a locale longer than the locale column to be refused")
+	}
+}
+
+func TestValidRole(t *testing.T) {
+	if !validRole("Facilitators", []string{"create_battles", "view_analytics"}) {
+		t.Error("Expected a named role with known permissions to be valid")
+	}
+	if validRole(" ", nil) {
+		t.Error("Expected a role without a name to be invalid")
+	}
+	if validRole("Facilitators", []string{"launch_missiles"}) {
+		t.Error("Expected a role with an unknown permission to be invalid")
+	}
+}
+
+func TestBattleJoinURL(t *testing.T) {
+	s := &server{config: &ServerConfig{AppDomain: "thunderdome.dev", PathPrefix: "/td"}}
+	expected := "https://thunderdome.dev/td/battle/b1"
+
+	if joinURL := s.battleJoinURL("b1"); joinURL != expected {
+		t.Error("Expected ", expected, " got ", joinURL)
+	}
+}
+
+func TestRespondWithETag(t *testing.T) {
+	first := httptest.NewRecorder()
+	RespondWithETag(first, httptest.NewRequest("GET", "/api/battle/b1/state", nil), map[string]bool{"voted": true})
+	etag := first.Header().Get("ETag")
+
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatal("Expected a tagged response got ", first.Code, etag)
+	}
+
+	r := httptest.NewRequest("GET", "/api/battle/b1/state", nil)
+	r.Header.Set("If-None-Match", etag)
+	second := httptest.NewRecorder()
+	RespondWithETag(second, r, map[string]bool{"voted": true})
+
+	if second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+		t.Error("Expected 304 for an unchanged state got ", second.Code)
+	}
+
+	third := httptest.NewRecorder()
+	RespondWithETag(third, r, map[string]bool{"voted": false})
+
+	if third.Code != http.StatusOK {
+		t.Error("Expected 200 for a changed state got ", third.Code)
+	}
+}
+
+func TestReadActionItem(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"content":" Update the runbook ","dueDate":"2021-03-01"}`))
+	if item, ok := readActionItem(r); !ok || item.Content != "Update the runbook" || item.DueDate != "2021-03-01" {
+		t.Error("Expected a valid action item got ", item, ok)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"content":"Update the runbook","dueDate":"next week"}`))
+	if _, ok := readActionItem(r); ok {
+		t.Error("Expected an invalid due date to be rejected")
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"content":" "}`))
+	if _, ok := readActionItem(r); ok {
+		t.Error("Expected empty content to be rejected")
+	}
+}
+
+func TestReadBattleFilter(t *testing.T) {
+	filter, ok := readBattleFilter(url.Values{"search": {" sprint "}, "status": {"voting"}, "to": {"2021-03-01"}, "role": {"owned"}})
+	if !ok || filter.Search != "sprint" || filter.Status != "voting" || filter.Role != "owned" || filter.CreatedFrom != nil {
+		t.Error("Expected a valid filter got ", filter, ok)
+	}
+	if filter.CreatedTo == nil || filter.CreatedTo.Format("2006-01-02") != "2021-03-02" {
+		t.Error("Expected the to date to include the whole day got ", filter.CreatedTo)
+	}
+
+	if _, ok := readBattleFilter(url.Values{"status": {"archived"}}); ok {
+		t.Error("Expected an invalid status to be rejected")
+	}
+
+	if _, ok := readBattleFilter(url.Values{"from": {"last week"}}); ok {
+		t.Error("Expected an invalid from date to be rejected")
+	}
+}
+
+func TestRenderAvatar(t *testing.T) {
+	for _, service := range []string{"goadorable", "govatar"} {
+		avatar, err := renderAvatar(service, "w1", "female", 48)
+		if err != nil || !bytes.HasPrefix(avatar, []byte("\x89PNG")) {
+			t.Error("Expected a png avatar from ", service, " got ", err)
+		}
+	}
+
+	for _, width := range []int{0, -1, maxAvatarWidth + 1} {
+		if _, err := renderAvatar("goadorable", "w1", "", width); err == nil {
+			t.Error("Expected an error for width ", width)
+		}
+	}
+}
+
+func TestHandleWarriorAvatarInvalidWidth(t *testing.T) {
+	s := &server{config: &ServerConfig{AvatarService: "goadorable"}}
+	router := mux.NewRouter()
+	router.PathPrefix("/avatar/{width}/{id}").Handler(s.handleWarriorAvatar())
+
+	for _, width := range []string{"abc", "0", "100000"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/avatar/"+width+"/w1", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Error("Expected width ", width, " to be a bad request got ", w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/avatar/48/w1", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Error("Expected the avatar got ", w.Code)
+	}
+}
+
+// newMockServer creates a server backed by an in memory datastore with a warrior w1 holding the API key key1,
+// an admin a1 holding admin1 and the battle b1 led by w1
+func newMockServer() (*server, *database.Mock) {
+	db := database.NewMock()
+	db.Warriors["w1"] = &database.Warrior{WarriorID: "w1", WarriorRank: "CORPORAL"}
+	db.Warriors["a1"] = &database.Warrior{WarriorID: "a1", WarriorRank: "GENERAL"}
+	db.APIKeys["key1"] = "w1"
+	db.APIKeys["admin1"] = "a1"
+	db.Battles["b1"] = &database.Battle{BattleID: "b1", LeaderID: "w1"}
+
+	return &server{
+		config:   &ServerConfig{SecureCookieName: "warriorId", FrontendCookieName: "warrior"},
+		cookie:   securecookie.New([]byte("strongest-avenger"), nil),
+		database: db,
+	}, db
+}
+
+func TestWarriorOnlyAPIKey(t *testing.T) {
+	s, db := newMockServer()
+	router := mux.NewRouter()
+	router.HandleFunc("/api/warrior/{id}/permissions", s.warriorOnly(s.handleWarriorPermissionsGet()))
+	db.Permissions["w1"] = []string{database.PermissionCreateBattles}
+
+	tests := []struct {
+		apiKey string
+		status int
+	}{
+		{"key1", http.StatusOK},
+		{"unknown", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/warrior/w1/permissions", nil)
+		r.Header.Set(apiKeyHeaderName, tt.apiKey)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected API key ", tt.apiKey, " to respond ", tt.status, " got ", w.Code)
+		}
+		if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), database.PermissionCreateBattles) {
+			t.Error("Expected the warrior's permissions got ", w.Body.String())
+		}
+	}
+
+	if len(db.APIRequests) != 1 || db.APIRequests[0] != "GET /api/warrior/{id}/permissions" {
+		t.Error("Expected the API key request to be audited got ", db.APIRequests)
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	s, _ := newMockServer()
+	handler := s.adminOnly(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for apiKey, status := range map[string]int{"admin1": http.StatusNoContent, "key1": http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/admin/stats", nil)
+		r.Header.Set(apiKeyHeaderName, apiKey)
+		handler(w, r)
+		if w.Code != status {
+			t.Error("Expected API key ", apiKey, " to respond ", status, " got ", w.Code)
+		}
+	}
+}
+
+func TestHandleBattleStar(t *testing.T) {
+	s, db := newMockServer()
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/star", s.warriorOnly(s.handleBattleStar())).Methods("PUT", "DELETE")
+
+	star := func(method string, BattleID string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/api/battle/"+BattleID+"/star", nil)
+		r.Header.Set(apiKeyHeaderName, "key1")
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := star("PUT", "b1"); code != http.StatusOK || !db.Starred["w1"]["b1"] {
+		t.Error("Expected the battle to be starred got ", code)
+	}
+	if code := star("DELETE", "b1"); code != http.StatusOK || db.Starred["w1"]["b1"] {
+		t.Error("Expected the battle to be unstarred got ", code)
+	}
+	if code := star("PUT", "missing"); code != http.StatusNotFound {
+		t.Error("Expected starring a missing battle to be not found got ", code)
+	}
+}
+
+func TestHandleBattleBotsGetLeaderOnly(t *testing.T) {
+	s, _ := newMockServer()
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/bots", s.warriorOnly(s.handleBattleBotsGet()))
+
+	for apiKey, status := range map[string]int{"key1": http.StatusOK, "admin1": http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/battle/b1/bots", nil)
+		r.Header.Set(apiKeyHeaderName, apiKey)
+		router.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Error("Expected API key ", apiKey, " to respond ", status, " got ", w.Code)
+		}
+	}
+}
+
+func TestHandleBattleBotCreateRefusesBots(t *testing.T) {
+	s, db := newMockServer()
+	db.Warriors["bot1"] = &database.Warrior{WarriorID: "bot1", WarriorRank: "BOT"}
+	db.APIKeys["botkey1"] = "bot1"
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/bot", s.warriorOnly(s.handleBattleBotCreate()))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/battle/b1/bot", strings.NewReader(`{"name": "Jira Bot"}`))
+	r.Header.Set(apiKeyHeaderName, "botkey1")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Error("Expected a bot's API key not to create bots got ", w.Code)
+	}
+}
+
+// broadcastMock records the broadcasts created
+type broadcastMock struct {
+	*database.Mock
+	broadcasts []*database.EmailBroadcast
+}
+
+func (m *broadcastMock) CreateEmailBroadcast(CreatedBy string, Subject string, Body string, TeamID string) (*database.EmailBroadcast, error) {
+	b := &database.EmailBroadcast{Subject: Subject, Body: Body, TeamID: TeamID, CreatedBy: CreatedBy}
+	m.broadcasts = append(m.broadcasts, b)
+	return b, nil
+}
+
+func TestHandleEmailBroadcastCreate(t *testing.T) {
+	s, db := newMockServer()
+	mock := &broadcastMock{Mock: db}
+	s.database = mock
+	handler := s.adminOnly(s.handleEmailBroadcastCreate())
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"subject": "Maintenance", "body": "Down for an hour on Sunday."}`, http.StatusOK},
+		{`{"subject": "Maintenance", "body": "Down for an hour on Sunday.", "teamId": "2a1e5a52-4ee0-4d52-8a17-2d8f2a0a5b0e"}`, http.StatusOK},
+		{`{"subject": "Maintenance", "body": "Down for an hour on Sunday.", "teamId": "asgard"}`, http.StatusBadRequest},
+		{`{"subject": "  ", "body": "Down for an hour on Sunday."}`, http.StatusBadRequest},
+		{`{"subject": "Maintenance"}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/admin/email/broadcasts", strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, "admin1")
+		handler(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if len(mock.broadcasts) != 2 || mock.broadcasts[0].CreatedBy != "a1" || mock.broadcasts[1].TeamID == "" {
+		t.Error("Expected the valid broadcasts to be queued by the admin got ", mock.broadcasts)
+	}
+}
+
+// preferencesMock keeps the notification preferences saved
+type preferencesMock struct {
+	*database.Mock
+	saved []*database.NotificationPreference
+}
+
+func (m *preferencesMock) SetNotificationPreferences(WarriorID string, Preferences []*database.NotificationPreference) error {
+	m.saved = append(m.saved, Preferences...)
+	return nil
+}
+
+func (m *preferencesMock) GetNotificationPreferences(WarriorID string) ([]*database.NotificationPreference, error) {
+	return m.saved, nil
+}
+
+func TestHandleNotificationPreferencesUpdate(t *testing.T) {
+	s, db := newMockServer()
+	mock := &preferencesMock{Mock: db}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/warrior/{id}/notifications", s.warriorOnly(s.handleNotificationPreferencesUpdate()))
+
+	tests := []struct {
+		warriorID string
+		body      string
+		status    int
+	}{
+		{"w1", `[{"event": "voting_started", "channel": "web", "enabled": false}]`, http.StatusOK},
+		{"w1", `[{"event": "voting_started", "channel": "email", "enabled": false}]`, http.StatusBadRequest},
+		{"w1", `[{"event": "ragnarok", "channel": "web", "enabled": false}]`, http.StatusBadRequest},
+		{"w1", `not json`, http.StatusBadRequest},
+		{"a1", `[{"event": "voting_started", "channel": "web", "enabled": false}]`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/api/warrior/"+tt.warriorID+"/notifications", strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, "key1")
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.warriorID, " ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if len(mock.saved) != 1 || mock.saved[0].Event != database.NotificationVotingStarted || mock.saved[0].Enabled {
+		t.Error("Expected only the valid preference to be saved got ", mock.saved)
+	}
+}
+
+// recruitMock creates guest warriors, counting them
+type recruitMock struct {
+	*database.Mock
+	recruited int
+}
+
+func (m *recruitMock) CreateWarriorPrivate(WarriorName string) (*database.Warrior, error) {
+	m.recruited++
+	return &database.Warrior{WarriorID: "g1", WarriorName: WarriorName, WarriorRank: "PRIVATE"}, nil
+}
+
+func TestHandleWarriorRecruitModeration(t *testing.T) {
+	s, db := newMockServer()
+	mock := &recruitMock{Mock: db}
+	s.database = mock
+	s.moderation = moderation.New([]string{"darn"}, "", "")
+	viper.Set("config.allow_guests", true)
+	defer viper.Set("config.allow_guests", nil)
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"warriorName": "Thor"}`, http.StatusOK},
+		{`{"warriorName": "Darn Thor"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/warrior", strings.NewReader(tt.body))
+		s.handleWarriorRecruit()(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if mock.recruited != 1 {
+		t.Error("Expected only the allowed warrior to be recruited got ", mock.recruited)
+	}
+}
+
+// pointsMock finalizes plans in the mock's battles
+type pointsMock struct {
+	*database.Mock
+}
+
+func (m *pointsMock) FinalizePlan(BattleID string, warriorID string, PlanID string, PlanPoints string) ([]*database.Plan, error) {
+	plans := m.Battles[BattleID].Plans
+	for _, p := range plans {
+		if p.PlanID == PlanID {
+			p.Points = PlanPoints
+		}
+	}
+	return plans, nil
+}
+
+func TestHandleBattlePlanPointsUpdate(t *testing.T) {
+	s, db := newMockServer()
+	db.Battles["b1"].PointValuesAllowed = []string{"1", "3", "5"}
+	db.Battles["b1"].Plans = []*database.Plan{{PlanID: "p1", Points: "3"}}
+	s.database = &pointsMock{Mock: db}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/plan/{planId}/points", s.warriorOnly(s.handleBattlePlanPointsUpdate()))
+	// the plans are broadcast to the arena once
+	go func() { <-h.broadcast }()
+
+	tests := []struct {
+		path   string
+		body   string
+		apiKey string
+		status int
+	}{
+		{"/api/battle/b1/plan/p1/points", `{"points": "5"}`, "key1", http.StatusOK},
+		{"/api/battle/b1/plan/p1/points", `{"points": "8"}`, "key1", http.StatusBadRequest},
+		{"/api/battle/b1/plan/p1/points", `{"points": ""}`, "key1", http.StatusBadRequest},
+		{"/api/battle/b1/plan/p2/points", `{"points": "5"}`, "key1", http.StatusNotFound},
+		{"/api/battle/b1/plan/p1/points", `{"points": "1"}`, "admin1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PATCH", tt.path, strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, tt.apiKey)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.path, " ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if db.Battles["b1"].Plans[0].Points != "5" {
+		t.Error("Expected the points to be set got ", db.Battles["b1"].Plans[0].Points)
+	}
+	if db.APIRequests[0] != `PATCH /api/battle/{id}/plan/{planId}/points plan p1 points "3" to "5"` {
+		t.Error("Expected the points change to be audited got ", db.APIRequests[0])
+	}
+}
+
+func TestHandleAppConfig(t *testing.T) {
+	s, db := newMockServer()
+	s.config.PathPrefix = "/td"
+	db.Defaults = &database.BattleDefaults{PointValuesAllowed: []string{"1", "2", "3"}}
+	db.Domains = []*database.TeamDomain{{TeamID: "t1", PathPrefix: "sales", AppName: "Sales Poker", PrimaryColor: "#1e40af"}}
+	viper.Set("config.defaultPointValues", []string{"1", "2", "3", "5", "8"})
+	defer viper.Set("config.defaultPointValues", nil)
+	handler := s.tenantRouting(http.HandlerFunc(s.handleAppConfig()))
+
+	get := func(path string, apiKey string) AppConfig {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		if apiKey != "" {
+			r.Header.Set(apiKeyHeaderName, apiKey)
+		}
+		handler.ServeHTTP(w, r)
+		var c AppConfig
+		if err := json.Unmarshal(w.Body.Bytes(), &c); err != nil || w.Code != http.StatusOK {
+			t.Fatal("Expected the config got ", w.Code, w.Body.String())
+		}
+		return c
+	}
+
+	if c := get("/td/api/config", ""); len(c.DefaultPointValues) != 5 || c.PathPrefix != "/td" || c.AppName != "Thunderdome" {
+		t.Error("Expected anonymous warriors to get the config's point values got ", c)
+	}
+	if c := get("/td/api/config", "key1"); len(c.DefaultPointValues) != 3 {
+		t.Error("Expected signed in warriors to get the battle defaults' point values got ", c.DefaultPointValues)
+	}
+	if c := get("/td/api/config", "unknown"); len(c.DefaultPointValues) != 5 {
+		t.Error("Expected an unknown API key to be treated as anonymous got ", c.DefaultPointValues)
+	}
+	if c := get("/td/sales/api/config", ""); c.PathPrefix != "/td/sales" || c.AppName != "Sales Poker" || c.PrimaryColor != "#1e40af" {
+		t.Error("Expected the team's branding and path prefix got ", c)
+	}
+}
+
+// teamWarriorMock has a single registered warrior to add to teams
+type teamWarriorMock struct {
+	*database.Mock
+}
+
+func (m *teamWarriorMock) TeamAddWarrior(TeamID string, WarriorEmail string, Role string) (*database.Team, error) {
+	if WarriorEmail != "thor@asgard.dev" {
+		return nil, database.ErrWarriorNotFound
+	}
+	return &database.Team{TeamID: TeamID, TeamName: "Avengers"}, nil
+}
+
+func (m *teamWarriorMock) GetWarriorByEmail(WarriorEmail string) (*database.Warrior, error) {
+	return nil, database.ErrWarriorNotFound
+}
+
+func TestHandleTeamWarriorAddNotFound(t *testing.T) {
+	s, db := newMockServer()
+	s.database = &teamWarriorMock{Mock: db}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/team/{teamId}/warriors", s.handleTeamWarriorAdd())
+
+	add := func(email string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/team/t1/warriors", strings.NewReader(`{"email": "`+email+`"}`))
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := add("thor@asgard.dev"); code != http.StatusOK {
+		t.Error("Expected the registered warrior to be added got ", code)
+	}
+	if code := add("loki@asgard.dev"); code != http.StatusNotFound {
+		t.Error("Expected an email no warrior has to be not found got ", code)
+	}
+}
+
+// planReviseMock has a single plan at version 2
+type planReviseMock struct {
+	*database.Mock
+}
+
+func (m *planReviseMock) RevisePlan(BattleID string, warriorID string, PlanID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string, Version int) ([]*database.Plan, error) {
+	plans := []*database.Plan{{PlanID: "p1", PlanName: "Login", Version: 2}}
+	if PlanID != "p1" {
+		return nil, database.ErrPlanNotFound
+	}
+	if Version != 0 && Version != 2 {
+		return plans, database.ErrPlanConflict
+	}
+	return plans, nil
+}
+
+func TestHandleBattlePlanReviseConflict(t *testing.T) {
+	s, db := newMockServer()
+	s.database = &planReviseMock{Mock: db}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/plan/{planId}", s.warriorOnly(s.handleBattlePlanRevise()))
+
+	revise := func(PlanID string, Version string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/api/battle/b1/plan/"+PlanID, strings.NewReader(`{"planName": "Login", "version": `+Version+`}`))
+		r.Header.Set(apiKeyHeaderName, "key1")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := revise("p1", "1"); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"version":2`) {
+		t.Error("Expected an edit from a stale version to conflict with the current one got ", w.Code, w.Body.String())
+	}
+	if w := revise("p2", "1"); w.Code != http.StatusNotFound {
+		t.Error("Expected revising a plan that isn't in the battle to respond 404 got ", w.Code)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// headerAuth trusts the warrior a reverse proxy like oauth2-proxy or Authelia signed in, given in its headers
+type headerAuth struct {
+	// proxies are the networks of the proxies whose headers are trusted, requests from anywhere else are refused
+	proxies     []*net.IPNet
+	userHeader  string
+	emailHeader string
+}
+
+// trusted checks the request came straight from one of the proxies, X-Forwarded-For isn't used as anyone can set it
+func (a *headerAuth) trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && inNetworks(ip, a.proxies)
+}
+
+// handleHeaderLogin logs in the warrior the trusted proxy signed in, auto-recruiting them on their first login and
+// going on to ?battleId= after
+func (s *server) handleHeaderLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.headerAuth.trusted(r) {
+			log.Println("Refused header login from untrusted address", r.RemoteAddr)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		WarriorEmail := strings.TrimSpace(r.Header.Get(s.headerAuth.emailHeader))
+		if WarriorEmail == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		authedWarrior, err := s.recruitWarrior(r.Header.Get(s.headerAuth.userHeader), WarriorEmail)
+		if err != nil {
+			log.Println("Failed header login", err)
+			RespondWithJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+
+		s.redirectLoggedIn(w, r, authedWarrior, r.URL.Query().Get("battleId"))
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleHeaderLogin(t *testing.T) {
+	s, db := newMockServer()
+	mock := &oidcMock{Mock: db}
+	s.database = mock
+	Proxies, _ := parseNetworks("10.0.0.0/8")
+	s.headerAuth = &headerAuth{proxies: Proxies, userHeader: "X-Forwarded-User", emailHeader: "X-Forwarded-Email"}
+
+	tests := []struct {
+		remoteAddr string
+		email      string
+		status     int
+	}{
+		{"203.0.113.7:4000", "thor@asgard.example", http.StatusForbidden},
+		{"10.1.2.3:4000", "", http.StatusUnauthorized},
+		{"10.1.2.3:4000", "thor@asgard.example", http.StatusFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/auth/header", nil)
+		r.RemoteAddr = tt.remoteAddr
+		r.Header.Set("X-Forwarded-For", "10.1.2.3")
+		r.Header.Set("X-Forwarded-Email", tt.email)
+		s.handleHeaderLogin()(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.remoteAddr, tt.email, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if len(mock.logins) != 1 || db.Warriors["w2"].WarriorName != "thor" {
+		t.Error("Expected the warrior to be recruited named after their email got ", mock.logins)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// BattleHeatmap is how long each warrior took to vote on each of the battle's plans
+type BattleHeatmap struct {
+	Warriors []*HeatmapWarrior `json:"warriors"`
+	Plans    []*HeatmapPlan    `json:"plans"`
+	// MaxLatencyMs is the longest anyone took to vote, to scale the heatmap's colors by
+	MaxLatencyMs int `json:"maxLatencyMs"`
+}
+
+// HeatmapWarrior is a column of the heatmap
+type HeatmapWarrior struct {
+	WarriorID   string `json:"id"`
+	WarriorName string `json:"name"`
+}
+
+// HeatmapPlan is a row of the heatmap
+type HeatmapPlan struct {
+	PlanID   string `json:"id"`
+	PlanName string `json:"name"`
+	// LatenciesMs are how long each warrior, by ID, took to vote after voting started
+	LatenciesMs map[string]int `json:"latenciesMs"`
+	MedianMs    int            `json:"medianMs"`
+	// Hesitation is the plan's median over the median of all the plans' medians, above 1 taking longer than usual
+	Hesitation float64 `json:"hesitation"`
+}
+
+// median gets the middle of the values, the mean of the two middle ones for an even count
+func median(Values []int) int {
+	if len(Values) == 0 {
+		return 0
+	}
+	sorted := append([]int(nil), Values...)
+	sort.Ints(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
+
+// newBattleHeatmap lays out the latencies by plan, in the battle's plan order, and warrior, plans and warriors without
+// any being left out
+func newBattleHeatmap(Plans []*database.Plan, Warriors []*database.BattleWarrior, Latencies []*database.VoteLatency) *BattleHeatmap {
+	heatmap := &BattleHeatmap{
+		Warriors: make([]*HeatmapWarrior, 0),
+		Plans:    make([]*HeatmapPlan, 0),
+	}
+
+	byPlan := make(map[string]map[string]int)
+	voted := make(map[string]bool)
+	for _, l := range Latencies {
+		if byPlan[l.PlanID] == nil {
+			byPlan[l.PlanID] = make(map[string]int)
+		}
+		byPlan[l.PlanID][l.WarriorID] = l.LatencyMs
+		voted[l.WarriorID] = true
+		if l.LatencyMs > heatmap.MaxLatencyMs {
+			heatmap.MaxLatencyMs = l.LatencyMs
+		}
+	}
+
+	for _, w := range Warriors {
+		if voted[w.WarriorID] {
+			heatmap.Warriors = append(heatmap.Warriors, &HeatmapWarrior{WarriorID: w.WarriorID, WarriorName: w.WarriorName})
+		}
+	}
+
+	medians := make([]int, 0)
+	for _, p := range Plans {
+		latencies, ok := byPlan[p.PlanID]
+		if !ok {
+			continue
+		}
+		values := make([]int, 0, len(latencies))
+		for _, ms := range latencies {
+			values = append(values, ms)
+		}
+		row := &HeatmapPlan{PlanID: p.PlanID, PlanName: p.PlanName, LatenciesMs: latencies, MedianMs: median(values)}
+		heatmap.Plans = append(heatmap.Plans, row)
+		medians = append(medians, row.MedianMs)
+	}
+
+	if typical := median(medians); typical > 0 {
+		for _, row := range heatmap.Plans {
+			row.Hesitation = float64(row.MedianMs) / float64(typical)
+		}
+	}
+
+	return heatmap
+}
+
+// handleBattleHeatmapGet gets the battle's voting speed heatmap for its leader to see which plans caused hesitation
+func (s *server) handleBattleHeatmapGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if err := s.database.ConfirmLeader(BattleID, warriorID); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		battle, err := s.database.GetBattle(BattleID, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		Latencies, err := s.database.GetBattleVoteLatencies(BattleID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, newBattleHeatmap(battle.Plans, battle.Warriors, Latencies))
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestNewBattleHeatmap(t *testing.T) {
+	Plans := []*database.Plan{{PlanID: "p1", PlanName: "Login"}, {PlanID: "p2", PlanName: "Search"}, {PlanID: "p3", PlanName: "Skipped"}}
+	Warriors := []*database.BattleWarrior{{WarriorID: "w1", WarriorName: "Thor"}, {WarriorID: "w2", WarriorName: "Loki"}, {WarriorID: "w3", WarriorName: "Hela"}}
+	Latencies := []*database.VoteLatency{
+		{PlanID: "p1", WarriorID: "w1", LatencyMs: 4000},
+		{PlanID: "p1", WarriorID: "w2", LatencyMs: 6000},
+		{PlanID: "p2", WarriorID: "w1", LatencyMs: 20000},
+		{PlanID: "p2", WarriorID: "w2", LatencyMs: 40000},
+	}
+
+	heatmap := newBattleHeatmap(Plans, Warriors, Latencies)
+	if len(heatmap.Warriors) != 2 || heatmap.Warriors[0].WarriorName != "Thor" || heatmap.Warriors[1].WarriorName != "Loki" {
+		t.Error("Expected only the warriors that voted got ", heatmap.Warriors)
+	}
+	if len(heatmap.Plans) != 2 || heatmap.Plans[0].PlanID != "p1" || heatmap.Plans[1].PlanID != "p2" {
+		t.Fatal("Expected only the plans voted on in order got ", heatmap.Plans)
+	}
+	if heatmap.MaxLatencyMs != 40000 {
+		t.Error("Expected the max latency to be 40000 got ", heatmap.MaxLatencyMs)
+	}
+	if heatmap.Plans[0].MedianMs != 5000 || heatmap.Plans[1].MedianMs != 30000 {
+		t.Error("Unexpected medians ", heatmap.Plans[0].MedianMs, heatmap.Plans[1].MedianMs)
+	}
+	// the typical plan took 17.5s
+	if heatmap.Plans[1].Hesitation <= 1 || heatmap.Plans[0].Hesitation >= 1 {
+		t.Error("Expected the search plan to stand out got ", heatmap.Plans[0].Hesitation, heatmap.Plans[1].Hesitation)
+	}
+	if heatmap.Plans[1].LatenciesMs["w2"] != 40000 {
+		t.Error("Expected Loki's latency on search got ", heatmap.Plans[1].LatenciesMs)
+	}
+
+	if empty := newBattleHeatmap(Plans, Warriors, nil); len(empty.Plans) != 0 || len(empty.Warriors) != 0 {
+		t.Error("Expected an empty heatmap without latencies")
+	}
+}
+
+// heatmapMock has latencies for the battle
+type heatmapMock struct {
+	*database.Mock
+}
+
+func (m *heatmapMock) GetBattleVoteLatencies(BattleID string) ([]*database.VoteLatency, error) {
+	return []*database.VoteLatency{{PlanID: "p1", WarriorID: "w1", LatencyMs: 1200}}, nil
+}
+
+func TestHandleBattleHeatmapGet(t *testing.T) {
+	s, db := newMockServer()
+	db.Battles["b1"].Plans = []*database.Plan{{PlanID: "p1", PlanName: "Login"}}
+	db.Battles["b1"].Warriors = []*database.BattleWarrior{{WarriorID: "w1", WarriorName: "Thor"}}
+	s.database = &heatmapMock{Mock: db}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/heatmap", s.warriorOnly(s.handleBattleHeatmapGet()))
+
+	tests := []struct {
+		apiKey string
+		status int
+	}{
+		{"key1", http.StatusOK},
+		// only the leader sees how long each warrior took
+		{"admin1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/battle/b1/heatmap", nil)
+		r.Header.Set(apiKeyHeaderName, tt.apiKey)
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.apiKey, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/battle/b1/heatmap", nil)
+	r.Header.Set(apiKeyHeaderName, "key1")
+	router.ServeHTTP(w, r)
+	var heatmap BattleHeatmap
+	if err := json.Unmarshal(w.Body.Bytes(), &heatmap); err != nil || len(heatmap.Plans) != 1 || heatmap.Plans[0].MedianMs != 1200 {
+		t.Error("Unexpected heatmap ", w.Body.String(), err)
+	}
+}
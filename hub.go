@@ -1,14 +1,140 @@
 package main
 
+import (
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+)
+
 type message struct {
 	data  []byte
 	arena string
 }
 
+// recordingsDropped counts the events left out of battle recordings because the recorder fell behind
+var recordingsDropped = expvar.NewInt("recordingsDropped")
+
+// recordedEvent is a message along with the sequence number it was broadcast with
+type recordedEvent struct {
+	message
+	seq uint64
+}
+
+// whisper is a message for a single connection in an arena
+type whisper struct {
+	message
+	conn *connection
+}
+
+// activityRequest asks the hub how many warriors are connected to each of the arenas
+type activityRequest struct {
+	arenas []string
+	reply  chan map[string]int
+}
+
+// arenaLocks holds a lock per arena for as long as someone is waiting on it, so a leader with the battle open in
+// two tabs can't interleave actions like ending voting and activating the next plan between their database
+// update and broadcast
+type arenaLocks struct {
+	mu    sync.Mutex
+	locks map[string]*arenaLock
+}
+
+type arenaLock struct {
+	sync.Mutex
+	waiting int
+}
+
+// lock locks the arena returning the func to unlock it
+func (l *arenaLocks) lock(arena string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[arena]
+	if !ok {
+		lock = &arenaLock{}
+		l.locks[arena] = lock
+	}
+	lock.waiting++
+	l.mu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		l.mu.Lock()
+		lock.waiting--
+		if lock.waiting == 0 {
+			delete(l.locks, arena)
+		}
+		l.mu.Unlock()
+	}
+}
+
+const (
+	// failed database writes within breakerWindow that switch an arena to read only
+	breakerFailures = 3
+	breakerWindow   = 30 * time.Second
+	// how often the database of a read only arena is checked to switch it back
+	breakerRetry = 10 * time.Second
+)
+
+// arenaBreakers switch arenas whose database writes keep failing to read only, so events aren't broadcast as
+// applied when they weren't stored, until the database is reachable again
+type arenaBreakers struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	open     map[string]bool
+}
+
+// isOpen reports whether the arena is read only
+func (b *arenaBreakers) isOpen(arena string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open[arena]
+}
+
+// fail records a failed database write in the arena, reporting whether it switched the arena to read only
+func (b *arenaBreakers) fail(arena string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open[arena] {
+		return false
+	}
+
+	recent := make([]time.Time, 0, breakerFailures)
+	for _, failed := range b.failures[arena] {
+		if now.Sub(failed) < breakerWindow {
+			recent = append(recent, failed)
+		}
+	}
+	recent = append(recent, now)
+	if len(recent) < breakerFailures {
+		b.failures[arena] = recent
+		return false
+	}
+
+	delete(b.failures, arena)
+	b.open[arena] = true
+
+	return true
+}
+
+// close switches the arena back from read only
+func (b *arenaBreakers) close(arena string) {
+	b.mu.Lock()
+	delete(b.open, arena)
+	delete(b.failures, arena)
+	b.mu.Unlock()
+}
+
 type subscription struct {
 	conn      *connection
 	arena     string
 	warriorID string
+	// parent is the arena of the battle a breakout was split from
+	parent string
 }
 
 // hub maintains the set of active connections and broadcasts messages to the
@@ -20,18 +146,71 @@ type hub struct {
 	// Inbound messages from the connections.
 	broadcast chan message
 
+	// Messages for a single connection rather than the whole arena.
+	whisper chan whisper
+
 	// Register requests from the connections.
 	register chan subscription
 
 	// Unregister requests from connections.
 	unregister chan subscription
+
+	// Sequence number of the last message broadcast to each arena.
+	seq map[string]uint64
+
+	// Parent arena of each breakout arena, events are relayed up to it.
+	parents map[string]string
+
+	// Plans known to snapshot connections in each arena, keyed by plan id.
+	plans map[string]map[string]string
+
+	// Seeds an arena's known plans when a snapshot connection joins.
+	seed chan message
+
+	// Broadcast messages are sent here to be persisted when battle recording is enabled.
+	recorder chan recordedEvent
+
+	// Broadcast messages are sent here to be relayed to federation peers when federation is enabled.
+	relay chan message
+
+	// Requests for the number of warriors connected to arenas.
+	activity chan activityRequest
+
+	// Requests for the hub's view of an arena.
+	inspections chan inspectRequest
+
+	// Serializes leader actions in each arena.
+	locks *arenaLocks
+
+	// Switches arenas to read only while their database writes fail.
+	breakers *arenaBreakers
+
+	// Limits on the messages connections send and are sent.
+	limits socketLimits
+
+	// Messages sent by each warrior, limited to the rate.
+	rates *warriorRates
+
+	// Number of registered connections across all arenas.
+	connections int
 }
 
 var h = hub{
-	broadcast:  make(chan message),
-	register:   make(chan subscription),
-	unregister: make(chan subscription),
-	arenas:     make(map[string]map[*connection]bool),
+	broadcast:   make(chan message),
+	whisper:     make(chan whisper),
+	register:    make(chan subscription),
+	unregister:  make(chan subscription),
+	arenas:      make(map[string]map[*connection]bool),
+	seq:         make(map[string]uint64),
+	parents:     make(map[string]string),
+	plans:       make(map[string]map[string]string),
+	seed:        make(chan message),
+	activity:    make(chan activityRequest),
+	inspections: make(chan inspectRequest),
+	locks:       &arenaLocks{locks: make(map[string]*arenaLock)},
+	breakers:    &arenaBreakers{failures: make(map[string][]time.Time), open: make(map[string]bool)},
+	limits:      defaultSocketLimits,
+	rates:       &warriorRates{buckets: make(map[string]*rateBucket)},
 }
 
 func (h *hub) run() {
@@ -43,7 +222,14 @@ func (h *hub) run() {
 				connections = make(map[*connection]bool)
 				h.arenas[s.arena] = connections
 			}
+			if !connections[s.conn] {
+				h.connections++
+			}
 			h.arenas[s.arena][s.conn] = true
+			if s.parent != "" {
+				h.parents[s.arena] = s.parent
+			}
+			h.connectionChanged("connection_opened", s.arena)
 		case s := <-h.unregister:
 			connections := h.arenas[s.arena]
 			if connections != nil {
@@ -52,22 +238,128 @@ func (h *hub) run() {
 					close(s.conn.send)
 					if len(connections) == 0 {
 						delete(h.arenas, s.arena)
+						delete(h.seq, s.arena)
+						delete(h.parents, s.arena)
+						delete(h.plans, s.arena)
 					}
+					h.connections--
+					h.connectionChanged("connection_closed", s.arena)
 				}
 			}
+		case w := <-h.whisper:
+			// direct replies aren't part of the arena's sequence
+			if h.arenas[w.arena][w.conn] {
+				h.enqueue(w.conn, encodeSocketEvent(w.conn.version, w.data, 0))
+			}
+		case req := <-h.activity:
+			req.reply <- h.connectedWarriors(req.arenas)
+		case req := <-h.inspections:
+			req.reply <- h.arenaState(req.arena)
+		case m := <-h.seed:
+			h.plans[m.arena] = indexPlans(m.data)
 		case m := <-h.broadcast:
-			connections := h.arenas[m.arena]
-			for c := range connections {
-				select {
-				case c.send <- m.data:
-				default:
-					close(c.send)
-					delete(connections, c)
-					if len(connections) == 0 {
-						delete(h.arenas, m.arena)
-					}
-				}
+			h.deliver(m)
+			// let the parent battle follow along with its breakouts
+			if parent, ok := h.parents[m.arena]; ok {
+				h.deliver(message{breakoutActivityEvent(m.arena, m.data), parent})
+			}
+		}
+	}
+}
+
+// liveWarriors gets how many warriors are connected to each of the arenas, arenas without any are left out
+func (h *hub) liveWarriors(arenas []string) map[string]int {
+	req := activityRequest{arenas, make(chan map[string]int, 1)}
+	h.activity <- req
+
+	return <-req.reply
+}
+
+// connectedWarriors counts the warriors with a connection in each arena, a warrior with several tabs
+// open counts once and bots not at all
+func (h *hub) connectedWarriors(arenas []string) map[string]int {
+	counts := make(map[string]int)
+	for _, arena := range arenas {
+		warriors := make(map[string]bool)
+		for c := range h.arenas[arena] {
+			if !c.bot {
+				warriors[c.warriorID] = true
+			}
+		}
+		if len(warriors) > 0 {
+			counts[arena] = len(warriors)
+		}
+	}
+
+	return counts
+}
+
+// connectionChanged lets admins watching the live view know about the connection
+func (h *hub) connectionChanged(Type string, arena string) {
+	ops.totals(len(h.arenas), h.connections)
+	ops.publish(Type, arena, "")
+}
+
+// deliver sends the message to every connection in its arena
+func (h *hub) deliver(m message) {
+	connections := h.arenas[m.arena]
+	h.seq[m.arena]++
+	// snapshot connections only get the plans that changed
+	var delta []byte
+	if known, ok := h.plans[m.arena]; ok {
+		delta = planDeltaEvent(m.data, known)
+	}
+	// encode once per api version and format rather than per connection
+	type encoding struct {
+		version int
+		delta   bool
+	}
+	encoded := make(map[encoding][]byte)
+	for c := range connections {
+		key := encoding{c.version, c.snapshot && delta != nil}
+		data, ok := encoded[key]
+		if !ok {
+			event := m.data
+			if key.delta {
+				event = delta
+			}
+			data = encodeSocketEvent(c.version, event, h.seq[m.arena])
+			encoded[key] = data
+		}
+		if !h.enqueue(c, data) {
+			h.drop(c)
+			delete(connections, c)
+			if len(connections) == 0 {
+				delete(h.arenas, m.arena)
+				delete(h.seq, m.arena)
+				delete(h.parents, m.arena)
+				delete(h.plans, m.arena)
 			}
+			h.connections--
+			h.connectionChanged("connection_dropped", m.arena)
+		}
+	}
+
+	// a slow recorder drops events from the recording rather than holding up every battle here,
+	// events relayed from peers belong to their battles and aren't recorded
+	if h.recorder != nil && !strings.HasPrefix(m.arena, federatedArenaPrefix) {
+		select {
+		case h.recorder <- recordedEvent{m, h.seq[m.arena]}:
+		default:
+			recordingsDropped.Add(1)
 		}
 	}
+
+	// a slow peer drops relayed events rather than holding up the battles here
+	if h.relay != nil {
+		select {
+		case h.relay <- m:
+		default:
+		}
+	}
+
+	// arenas nobody is connected to start their sequence over once someone is
+	if len(h.arenas[m.arena]) == 0 {
+		delete(h.seq, m.arena)
+	}
 }
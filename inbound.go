@@ -0,0 +1,49 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// subjectCode matches a battle email code at the start of a subject like [abc123] Login form
+var subjectCode = regexp.MustCompile(`^\s*\[([0-9a-zA-Z]+)\]\s*`)
+
+// inboundEmailCode finds the battle email code in the recipients plus address (plans+abc123@example.com)
+// or failing that the subject, returning the subject with the code removed
+func inboundEmailCode(Address string, Recipients string, Subject string) (string, string) {
+	at := strings.LastIndex(Address, "@")
+	if at > 0 {
+		plusAddress := regexp.MustCompile(
+			`(?i)` + regexp.QuoteMeta(Address[:at]) + `\+([0-9a-z]+)@` + regexp.QuoteMeta(Address[at+1:]),
+		)
+		if m := plusAddress.FindStringSubmatch(Recipients); m != nil {
+			return strings.ToLower(m[1]), strings.TrimSpace(Subject)
+		}
+	}
+
+	if m := subjectCode.FindStringSubmatch(Subject); m != nil {
+		return strings.ToLower(m[1]), strings.TrimSpace(Subject[len(m[0]):])
+	}
+
+	return "", strings.TrimSpace(Subject)
+}
+
+// truncateRunes cuts a string to a number of characters
+func truncateRunes(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+
+	return string(runes[:length])
+}
+
+// battleEmailAddress gets the code and plus address plans are emailed to the battle with
+func (s *server) battleEmailAddress(Code string) map[string]string {
+	Address := ""
+	if at := strings.LastIndex(s.config.InboundEmailAddress, "@"); at > 0 && Code != "" {
+		Address = s.config.InboundEmailAddress[:at] + "+" + Code + s.config.InboundEmailAddress[at:]
+	}
+
+	return map[string]string{"code": Code, "address": Address}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestInboundEmailCodePlusAddress(t *testing.T) {
+	Code, Subject := inboundEmailCode("plans@thunderdome.dev", "PM <Plans+AbC123@thunderdome.dev>, other@example.com", " Login form ")
+
+	if Code != "abc123" || Subject != "Login form" {
+		t.Error("Expected abc123 and Login form, got ", Code, Subject)
+	}
+}
+
+func TestInboundEmailCodeSubject(t *testing.T) {
+	Code, Subject := inboundEmailCode("plans@thunderdome.dev", "plans@thunderdome.dev", "[abc123] Login form")
+
+	if Code != "abc123" || Subject != "Login form" {
+		t.Error("Expected abc123 and Login form, got ", Code, Subject)
+	}
+}
+
+func TestInboundEmailCodeMissing(t *testing.T) {
+	Code, Subject := inboundEmailCode("", "plans+abc123@thunderdome.dev", "Login form")
+
+	if Code != "" || Subject != "Login form" {
+		t.Error("Expected no code, got ", Code, Subject)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/confluence"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/email"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/issues"
+)
+
+// battleEndedPayload is the outbox payload of a battle_ended event
+type battleEndedPayload struct {
+	BattleName string `json:"battleName"`
+	LeaderID   string `json:"leaderId"`
+	TeamID     string `json:"teamId"`
+	Plans      []struct {
+		PlanID      string `json:"planId"`
+		PlanName    string `json:"planName"`
+		ReferenceID string `json:"referenceId"`
+		Points      string `json:"points"`
+	} `json:"plans"`
+	ActionItems []struct {
+		Content   string `json:"content"`
+		OwnerName string `json:"ownerName"`
+		DueDate   string `json:"dueDate"`
+		Completed bool   `json:"completed"`
+	} `json:"actionItems"`
+}
+
+// planFinalizedPayload is the outbox payload of a plan_finalized event
+type planFinalizedPayload struct {
+	PlanID        string `json:"planId"`
+	PlanName      string `json:"planName"`
+	ReferenceID   string `json:"referenceId"`
+	Points        string `json:"points"`
+	TeamID        string `json:"teamId"`
+	IssueProvider string `json:"issueProvider"`
+	ExternalID    string `json:"externalId"`
+}
+
+// pushIssueEstimate writes the finalized points back to the tracker issue the plan was imported from
+func (s *server) pushIssueEstimate(event *database.OutboxEvent) error {
+	if event.EventType != "plan_finalized" {
+		return nil
+	}
+
+	var plan planFinalizedPayload
+	if err := json.Unmarshal(event.Payload, &plan); err != nil || plan.IssueProvider == "" || plan.TeamID == "" {
+		return nil
+	}
+
+	APIKey, err := s.database.GetTeamIssueProviderKey(plan.TeamID, plan.IssueProvider)
+	if err != nil || APIKey == "" {
+		return err
+	}
+
+	provider, err := issues.New(plan.IssueProvider, APIKey)
+	if err != nil {
+		// the provider isn't compiled into this build, nothing to push to
+		return nil
+	}
+
+	return provider.PushEstimate(plan.ExternalID, plan.Points)
+}
+
+// issuePlans converts tracker issues to plans for import, their titles cleaned like plan names and cut to fit
+func issuePlans(list []*issues.Issue) []*database.Plan {
+	Plans := make([]*database.Plan, 0, len(list))
+	for _, issue := range list {
+		Plans = append(Plans, &database.Plan{
+			PlanName:    truncateRunes(sanitizeName(issue.Title), maxPlanNameLength),
+			Type:        issue.Type,
+			ReferenceID: issue.Key,
+			Link:        issue.URL,
+			Description: issue.Description,
+			ExternalID:  issue.ID,
+		})
+	}
+
+	return Plans
+}
+
+// syncIssueEdits reconciles a plan edited in the battle with the tracker issue it was imported from,
+// pushing the plans edits to the issue unless the issue was edited differently in the meantime
+func (s *server) syncIssueEdits(event *database.OutboxEvent) error {
+	if event.EventType != "issue_plan_revised" {
+		return nil
+	}
+
+	// the same shape as a finalized plan, without the points
+	var plan planFinalizedPayload
+	if err := json.Unmarshal(event.Payload, &plan); err != nil || plan.IssueProvider == "" || plan.TeamID == "" {
+		return nil
+	}
+
+	APIKey, err := s.database.GetTeamIssueProviderKey(plan.TeamID, plan.IssueProvider)
+	if err != nil || APIKey == "" {
+		return err
+	}
+
+	provider, err := issues.New(plan.IssueProvider, APIKey)
+	if err != nil {
+		return nil
+	}
+	editor, ok := provider.(issues.Editor)
+	if !ok {
+		// the tracker only takes estimates
+		return nil
+	}
+
+	issue, err := provider.ImportIssue(plan.ExternalID)
+	if err != nil {
+		return err
+	}
+
+	Synced, Plans, err := s.database.ReconcileIssuePlan(plan.PlanID, map[string]string{
+		"name":        truncateRunes(sanitizeName(issue.Title), maxPlanNameLength),
+		"description": issue.Description,
+	})
+	if err != nil || Synced == nil {
+		return err
+	}
+	if Plans != nil {
+		updatedPlans, _ := json.Marshal(Plans)
+		h.broadcast <- message{CreateSocketEvent("plan_revised", string(updatedPlans), ""), Synced.BattleID}
+	}
+	if Synced.Changed || len(Synced.Conflicts) > 0 {
+		notice, _ := json.Marshal(Synced)
+		h.broadcast <- message{CreateSocketEvent("plan_synced", string(notice), ""), Synced.BattleID}
+	}
+	if len(Synced.Push) == 0 {
+		return nil
+	}
+
+	Title, Description := issue.Title, issue.Description
+	if v, ok := Synced.Push["name"]; ok {
+		Title = v
+	}
+	if v, ok := Synced.Push["description"]; ok {
+		Description = v
+	}
+	if err := editor.UpdateIssue(plan.ExternalID, Title, Description); err != nil {
+		return err
+	}
+
+	return s.database.SetIssuePlanBase(plan.PlanID, Synced.Push)
+}
+
+// publishConfluenceResults publishes a team battles results to the teams Confluence space once it has ended
+func (s *server) publishConfluenceResults(event *database.OutboxEvent) error {
+	if event.EventType != "battle_ended" {
+		return nil
+	}
+
+	var battle battleEndedPayload
+	if err := json.Unmarshal(event.Payload, &battle); err != nil || battle.TeamID == "" {
+		return nil
+	}
+
+	settings, err := s.database.GetTeamConfluence(battle.TeamID)
+	if err != nil || settings == nil {
+		return err
+	}
+
+	rows := make([]confluence.Row, 0, len(battle.Plans))
+	for _, p := range battle.Plans {
+		rows = append(rows, confluence.Row{Name: p.PlanName, ReferenceID: p.ReferenceID, Points: p.Points})
+	}
+
+	client := confluence.New(settings.BaseURL, settings.Username, settings.APIToken)
+
+	return client.UpsertPage(settings.SpaceKey, settings.ParentPageID, battle.BattleName+" Results", confluence.ResultsTable(rows))
+}
+
+// sendBattleSummary emails the leader of a battle that ended its results and the open action items
+func (s *server) sendBattleSummary(event *database.OutboxEvent) error {
+	if event.EventType != "battle_ended" {
+		return nil
+	}
+
+	var battle battleEndedPayload
+	if err := json.Unmarshal(event.Payload, &battle); err != nil || battle.LeaderID == "" {
+		return nil
+	}
+
+	leader, err := s.database.GetWarrior(battle.LeaderID)
+	if err != nil || leader.WarriorEmail == "" {
+		// guest leaders have nowhere to send it
+		return nil
+	}
+	if !s.database.WarriorNotifies(leader.WarriorID, database.NotificationBattleSummary, database.NotificationChannelEmail) {
+		return nil
+	}
+
+	plans := make([]email.ReportRow, 0, len(battle.Plans))
+	for _, p := range battle.Plans {
+		Label := p.PlanName
+		if p.ReferenceID != "" {
+			Label = "[" + p.ReferenceID + "] " + Label
+		}
+		Points := p.Points
+		if Points == "" {
+			Points = "Unpointed"
+		}
+		plans = append(plans, email.ReportRow{Label: Label, Value: Points})
+	}
+	items := make([]email.ActionItemRow, 0, len(battle.ActionItems))
+	for _, ai := range battle.ActionItems {
+		if !ai.Completed {
+			items = append(items, email.ActionItemRow{Content: ai.Content, Owner: ai.OwnerName, DueDate: ai.DueDate})
+		}
+	}
+
+	// resending on retry would spam the leader, a failed send is logged with the email deliveries instead
+	_ = s.email.SendBattleSummary(leader.WarriorName, leader.WarriorEmail, battle.BattleName, plans, items)
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// jiraWebhookEvent is the part of the payload Jira posts to webhooks for issue events that plans are synced from
+type jiraWebhookEvent struct {
+	WebhookEvent string `json:"webhookEvent"`
+	Issue        *struct {
+		ID     string `json:"id"`
+		Key    string `json:"key"`
+		Fields struct {
+			Summary     string `json:"summary"`
+			Description string `json:"description"`
+		} `json:"fields"`
+	} `json:"issue"`
+}
+
+// jiraWebhookSecret gets the secret the teams Jira webhook signs its requests with, generating a random one the
+// first time it's asked for
+func (s *server) jiraWebhookSecret(TeamID string) (string, error) {
+	Secret, err := s.database.GetTeamJiraWebhookSecret(TeamID)
+	if err != nil || Secret != "" {
+		return Secret, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return s.database.CreateTeamJiraWebhookSecret(TeamID, hex.EncodeToString(b))
+}
+
+// jiraWebhookURL is the URL the teams Jira webhook posts issue events to
+func (s *server) jiraWebhookURL(TeamID string) string {
+	return "https://" + s.config.AppDomain + s.config.PathPrefix + "/api/team/" + TeamID + "/webhooks/jira"
+}
+
+// jiraSignature is the X-Hub-Signature header Jira sends with the body of webhooks that have a secret
+func jiraSignature(Secret string, Body []byte) string {
+	mac := hmac.New(sha256.New, []byte(Secret))
+	mac.Write(Body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// syncMock records the issues plans are synced from and the conflicts resolved, teams get their webhook secret once
+type syncMock struct {
+	*database.Mock
+	synced   []string
+	resolved []string
+	secrets  map[string]string
+}
+
+func (m *syncMock) GetTeamJiraWebhookSecret(TeamID string) (string, error) {
+	return m.secrets[TeamID], nil
+}
+
+func (m *syncMock) CreateTeamJiraWebhookSecret(TeamID string, Secret string) (string, error) {
+	if m.secrets[TeamID] == "" {
+		m.secrets[TeamID] = Secret
+	}
+	return m.secrets[TeamID], nil
+}
+
+func (m *syncMock) ResolveIssueConflict(BattleID string, warriorID string, PlanID string, Field string, Resolution string) ([]*database.Plan, error) {
+	if err := m.ConfirmLeader(BattleID, warriorID); err != nil {
+		return nil, err
+	}
+	if PlanID != "p1" {
+		return nil, database.ErrIssueConflictNotFound
+	}
+	m.resolved = append(m.resolved, PlanID+" "+Field+" "+Resolution)
+	return nil, nil
+}
+
+func (m *syncMock) SyncIssuePlans(TeamID string, Provider string, ExternalID string, Theirs map[string]string) ([]*database.SyncedPlan, map[string][]*database.Plan, error) {
+	m.synced = append(m.synced, TeamID+" "+Provider+" "+ExternalID+" "+Theirs["name"]+" "+Theirs["description"])
+	return nil, nil, nil
+}
+
+func TestHandleJiraWebhook(t *testing.T) {
+	s, db := newMockServer()
+	mock := &syncMock{Mock: db, secrets: make(map[string]string)}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/team/{teamId}/webhooks/jira", s.handleJiraWebhook())
+
+	secret, _ := s.jiraWebhookSecret("t1")
+	if again, _ := s.jiraWebhookSecret("t1"); again != secret || len(secret) != 64 {
+		t.Error("Expected the team to keep its random secret got ", secret, again)
+	}
+	other, _ := s.jiraWebhookSecret("t2")
+
+	updated := []byte(`{"webhookEvent":"jira:issue_updated","issue":{"id":"10001","key":"ENG-1","fields":{"summary":"Login","description":"SSO"}}}`)
+	created := []byte(`{"webhookEvent":"jira:issue_created","issue":{"id":"10002","key":"ENG-2","fields":{"summary":"Logout"}}}`)
+	tests := []struct {
+		body      []byte
+		signature string
+		status    int
+	}{
+		{updated, jiraSignature(secret, updated), http.StatusOK},
+		{created, jiraSignature(secret, created), http.StatusOK},
+		{updated, jiraSignature(other, updated), http.StatusUnauthorized},
+		{updated, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/team/t1/webhooks/jira", bytes.NewReader(tt.body))
+		r.Header.Set("X-Hub-Signature", tt.signature)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", string(tt.body), " signed ", tt.signature, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if len(mock.synced) != 1 || mock.synced[0] != "t1 jira 10001 Login SSO" {
+		t.Error("Expected only the updated issue to be synced got ", mock.synced)
+	}
+}
+
+func TestHandleBattleIssueConflictResolve(t *testing.T) {
+	s, db := newMockServer()
+	mock := &syncMock{Mock: db}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/plan/{planId}/issue-conflict/{field}", s.warriorOnly(s.handleBattleIssueConflictResolve()))
+	// the resolved plans are broadcast to the arena once
+	go func() { <-h.broadcast }()
+
+	tests := []struct {
+		path   string
+		body   string
+		apiKey string
+		status int
+	}{
+		{"/api/battle/b1/plan/p1/issue-conflict/name", `{"resolution": "mine"}`, "key1", http.StatusOK},
+		{"/api/battle/b1/plan/p1/issue-conflict/name", `{"resolution": "ours"}`, "key1", http.StatusBadRequest},
+		{"/api/battle/b1/plan/p1/issue-conflict/points", `{"resolution": "theirs"}`, "key1", http.StatusBadRequest},
+		{"/api/battle/b1/plan/p2/issue-conflict/name", `{"resolution": "theirs"}`, "key1", http.StatusNotFound},
+		{"/api/battle/b1/plan/p1/issue-conflict/name", `{"resolution": "theirs"}`, "admin1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", tt.path, strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, tt.apiKey)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.path, " ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if len(mock.resolved) != 1 || mock.resolved[0] != "p1 name mine" {
+		t.Error("Expected only the valid resolution to be made got ", mock.resolved)
+	}
+}
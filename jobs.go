@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five field cron expression (minute hour day-of-month month day-of-week)
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// whether day-of-month and day-of-week were restricted, when both are a day matching either runs.
+	// Like cron a field starting with * such as */2 isn't restricted
+	domRestricted, dowRestricted bool
+}
+
+// cronFieldBounds are the allowed value ranges of each cron field
+var cronFieldBounds = [5][2]int{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 6},  // day of week, sunday is 0
+}
+
+// parseCron parses a cron expression supporting *, ranges (1-5), steps (*/15, 1-30/5) and lists (1,15)
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("cron expression must have 5 fields")
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFieldBounds[i][0], cronFieldBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron field %q: %v", field, err)
+		}
+		bits[i] = b
+	}
+
+	return &cronSchedule{
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: !strings.HasPrefix(fields[2], "*"),
+		dowRestricted: !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField turns a single cron field into a bitset of the values it matches
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return 0, errors.New("invalid step")
+			}
+			step = s
+			part = part[:i]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.New("invalid value")
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, errors.New("invalid value")
+				}
+			} else if step > 1 {
+				// 5/15 means starting at 5 every 15
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, errors.New("value out of range")
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// matches reports whether the schedule runs during the minute of t
+func (c *cronSchedule) matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 {
+		return false
+	}
+
+	return c.runsOn(t)
+}
+
+// runsOn reports whether the schedule runs at some point on the day of t
+func (c *cronSchedule) runsOn(t time.Time) bool {
+	if c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return domMatch || dowMatch
+	}
+
+	return domMatch && dowMatch
+}
+
+// job is recurring background work run on a cron schedule
+type job struct {
+	name     string
+	spec     string
+	schedule *cronSchedule
+	run      func() error
+}
+
+// registerJob schedules recurring work, jobs only run on one instance at a time
+func (s *server) registerJob(name string, spec string, run func() error) {
+	schedule, err := parseCron(spec)
+	if err != nil {
+		log.Fatalf("invalid schedule for job %s: %v", name, err)
+	}
+
+	s.jobs = append(s.jobs, &job{name: name, spec: spec, schedule: schedule, run: run})
+}
+
+// runJobs starts the scheduled jobs at the top of every minute they are due
+func (s *server) runJobs() {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(next.Sub(now))
+
+		for _, j := range s.jobs {
+			if j.schedule.matches(next) {
+				go s.runJob(j, next)
+			}
+		}
+	}
+}
+
+// runJob runs the job unless another instance already holds its lock or ran it
+func (s *server) runJob(j *job, scheduledFor time.Time) {
+	ran, err := s.database.RunJobExclusively(j.name, j.spec, scheduledFor, j.run)
+	if err != nil {
+		log.Printf("job %s failed: %v\n", j.name, err)
+		ops.publish("error", "", fmt.Sprintf("job %s failed: %v", j.name, err))
+	} else if !ran {
+		log.Printf("job %s already ran elsewhere, skipping\n", j.name)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Error("Expected error for ", spec)
+		}
+	}
+}
+
+func TestCronMatchesSteps(t *testing.T) {
+	c, _ := parseCron("*/15 9-17 * * 1-5")
+
+	// Monday 9:30
+	if !c.matches(time.Date(2021, 3, 1, 9, 30, 0, 0, time.UTC)) {
+		t.Error("Expected weekday 9:30 to match")
+	}
+	// Monday 9:31
+	if c.matches(time.Date(2021, 3, 1, 9, 31, 0, 0, time.UTC)) {
+		t.Error("Expected 9:31 not to match")
+	}
+	// Sunday 9:30
+	if c.matches(time.Date(2021, 2, 28, 9, 30, 0, 0, time.UTC)) {
+		t.Error("Expected sunday not to match")
+	}
+}
+
+func TestCronMatchesDayOfMonthOrWeek(t *testing.T) {
+	c, _ := parseCron("0 0 1 * 0")
+
+	// Monday the 1st
+	if !c.matches(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected the 1st to match")
+	}
+	// Sunday the 7th
+	if !c.matches(time.Date(2021, 3, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected sunday to match")
+	}
+	// Tuesday the 2nd
+	if c.matches(time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected tuesday the 2nd not to match")
+	}
+}
+
+func TestCronMatchesDayOfMonthStep(t *testing.T) {
+	c, _ := parseCron("0 0 */2 * 1")
+
+	// Monday the 1st
+	if !c.matches(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected monday the 1st to match")
+	}
+	// Monday the 8th
+	if c.matches(time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected monday the 8th not to match")
+	}
+	// Wednesday the 3rd
+	if c.matches(time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected wednesday the 3rd not to match")
+	}
+}
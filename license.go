@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/license"
+)
+
+// licenseLimit is a license limit compared to how much of it is used
+type licenseLimit struct {
+	// Limit is 0 when there's no limit
+	Limit     int        `json:"limit"`
+	Used      int        `json:"used"`
+	OverSince *time.Time `json:"overSince"`
+	// GraceEnds is when adding more is refused, nil while within the limit
+	GraceEnds *time.Time `json:"graceEnds"`
+}
+
+// licenseStatus is the instance's license and its usage
+type licenseStatus struct {
+	Licensed  bool                    `json:"licensed"`
+	Licensee  string                  `json:"licensee"`
+	Expires   *time.Time              `json:"expires"`
+	GraceDays int                     `json:"graceDays"`
+	State     string                  `json:"state"`
+	Limits    map[string]licenseLimit `json:"limits"`
+}
+
+// licenseLimitOf gets the license's limit on registered warriors or teams
+func licenseLimitOf(l *license.License, Resource string) int {
+	if Resource == database.LicenseTeams {
+		return l.Teams
+	}
+
+	return l.Warriors
+}
+
+// licenseUsed gets how many registered warriors or teams there are
+func licenseUsed(usage *database.LicenseUsage, Resource string) int {
+	if Resource == database.LicenseTeams {
+		return usage.Teams
+	}
+
+	return usage.Warriors
+}
+
+// licenseAllows checks the license allows adding another registered warrior or team, recording when its limit
+// is first gone over so the grace period can run out. Instances without a license have no limits
+func (s *server) licenseAllows(Resource string) error {
+	if s.license == nil {
+		return nil
+	}
+
+	usage, err := s.database.GetLicenseUsage()
+	if err != nil {
+		// the license isn't worth refusing sign ups over when its usage can't be counted
+		return nil
+	}
+	var OverSince *time.Time
+	if since, ok := usage.OverSince[Resource]; ok {
+		OverSince = &since
+	}
+
+	over, err := s.license.Allows(licenseLimitOf(s.license, Resource), licenseUsed(usage, Resource), OverSince, time.Now())
+	if err != nil {
+		log.Println("refused adding to " + Resource + " : " + err.Error())
+		return err
+	}
+	if over != (OverSince != nil) {
+		s.database.SetLicenseOverage(Resource, over)
+	}
+	if over && OverSince == nil {
+		log.Println("license limit on " + Resource + " gone over, adding more is refused after the grace period")
+	}
+
+	return nil
+}
+
+// handleLicenseGet gets the instance's license and its registered warriors and teams against the limits
+func (s *server) handleLicenseGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.license == nil {
+			RespondWithJSON(w, http.StatusOK, licenseStatus{Limits: make(map[string]licenseLimit)})
+			return
+		}
+
+		usage, err := s.database.GetLicenseUsage()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		status := licenseStatus{
+			Licensed:  true,
+			Licensee:  s.license.Licensee,
+			GraceDays: s.license.GraceDays,
+			State:     s.license.State(time.Now()),
+			Limits:    make(map[string]licenseLimit),
+		}
+		if !s.license.Expires.IsZero() {
+			status.Expires = &s.license.Expires
+		}
+		for _, Resource := range []string{database.LicenseWarriors, database.LicenseTeams} {
+			limit := licenseLimit{Limit: licenseLimitOf(s.license, Resource), Used: licenseUsed(usage, Resource)}
+			if since, ok := usage.OverSince[Resource]; ok {
+				GraceEnds := s.license.GraceEnds(since)
+				limit.OverSince, limit.GraceEnds = &since, &GraceEnds
+				if status.State == license.Active {
+					status.State = license.Grace
+				}
+			}
+			status.Limits[Resource] = limit
+		}
+
+		RespondWithJSON(w, http.StatusOK, status)
+	}
+}
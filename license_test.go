@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/license"
+)
+
+// licenseMock counts the teams created against the license
+type licenseMock struct {
+	*database.Mock
+	teams     int
+	overSince map[string]time.Time
+}
+
+func (m *licenseMock) GetLicenseUsage() (*database.LicenseUsage, error) {
+	usage := &database.LicenseUsage{Warriors: 2, Teams: m.teams, OverSince: make(map[string]time.Time)}
+	for Resource, since := range m.overSince {
+		usage.OverSince[Resource] = since
+	}
+	return usage, nil
+}
+
+func (m *licenseMock) SetLicenseOverage(Resource string, Over bool) error {
+	if Over {
+		m.overSince[Resource] = time.Now()
+	} else {
+		delete(m.overSince, Resource)
+	}
+	return nil
+}
+
+func (m *licenseMock) CreateTeam(WarriorID string, TeamName string) (*database.Team, error) {
+	m.teams++
+	return &database.Team{TeamName: TeamName}, nil
+}
+
+func TestHandleTeamCreateLicensed(t *testing.T) {
+	s, db := newMockServer()
+	mock := &licenseMock{Mock: db, teams: 1, overSince: make(map[string]time.Time)}
+	s.database = mock
+	s.license = &license.License{Licensee: "Acme", Teams: 2, GraceDays: 14}
+	handler := s.warriorOnly(s.handleTeamCreate())
+
+	create := func() int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/teams", strings.NewReader(`{"name": "Avengers"}`))
+		r.Header.Set(apiKeyHeaderName, "key1")
+		handler(w, r)
+		return w.Code
+	}
+
+	if code := create(); code != http.StatusOK || len(mock.overSince) != 0 {
+		t.Error("Expected a team within the limit to be created got ", code, mock.overSince)
+	}
+	if code := create(); code != http.StatusOK || len(mock.overSince) != 1 {
+		t.Error("Expected going over the limit to start the grace period got ", code, mock.overSince)
+	}
+
+	mock.overSince[database.LicenseTeams] = time.Now().Add(-15 * 24 * time.Hour)
+	if code := create(); code != http.StatusForbidden || mock.teams != 3 {
+		t.Error("Expected a team to be refused once the grace period ended got ", code, mock.teams)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/admin/license", nil)
+	r.Header.Set(apiKeyHeaderName, "admin1")
+	s.adminOnly(s.handleLicenseGet())(w, r)
+	var status licenseStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	teams := status.Limits[database.LicenseTeams]
+	if !status.Licensed || status.State != license.Grace || teams.Limit != 2 || teams.Used != 3 || teams.GraceEnds == nil {
+		t.Error("Expected the usage against the limits got ", status)
+	}
+}
+
+func TestLicenseAllowsUnlicensed(t *testing.T) {
+	s, _ := newMockServer()
+	if err := s.licenseAllows(database.LicenseWarriors); err != nil {
+		t.Error("Expected instances without a license to have no limits got ", err)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// The lite views are server rendered pages for joining a battle and voting with plain form posts,
+// for screen reader users and browsers where the websocket UI doesn't work
+
+//go:embed views
+var views embed.FS
+
+// liteStatuses are the messages shown after a vote form is posted, by the status query param
+var liteStatuses = map[string]string{
+	"voted":    "Your vote was recorded.",
+	"invalid":  "Pick one of the point values to vote.",
+	"closed":   "Voting isn't open right now.",
+	"rejected": "Your vote can't be changed.",
+}
+
+// liteVoter is a battle warrior in the votes list
+type liteVoter struct {
+	Name  string
+	Voted bool
+	Vote  string
+}
+
+// liteView is the data the lite templates are executed with
+type liteView struct {
+	Lang        string
+	Title       string
+	Self        string
+	Action      string
+	Status      string
+	AllowGuests bool
+	ActivePlan  *database.Plan
+	VotingOpen  bool
+	MyVote      string
+	PointValues []string
+	Voters      []*liteVoter
+}
+
+// parseLiteTemplates parses the lite views, have them ready for requests
+func parseLiteTemplates() *template.Template {
+	tmpl, err := template.ParseFS(views, "views/lite.html")
+	if err != nil {
+		log.Println("Error parsing lite templates")
+		log.Fatal(err)
+	}
+
+	return tmpl
+}
+
+// newLiteBattleView gets the lite view of the battle for the warrior
+func newLiteBattleView(Battle *database.Battle, WarriorID string) *liteView {
+	view := &liteView{
+		Title:       Battle.BattleName,
+		PointValues: Battle.PointValuesAllowed,
+		Voters:      make([]*liteVoter, 0),
+	}
+
+	for _, plan := range Battle.Plans {
+		if plan.PlanID == Battle.ActivePlanID {
+			view.ActivePlan = plan
+		}
+	}
+	if view.ActivePlan == nil {
+		return view
+	}
+	view.VotingOpen = !Battle.VotingLocked
+
+	votes := make(map[string]string)
+	for _, vote := range view.ActivePlan.Votes {
+		votes[vote.WarriorID] = vote.VoteValue
+	}
+	view.MyVote = votes[WarriorID]
+	for _, warrior := range Battle.Warriors {
+		vote, voted := votes[warrior.WarriorID]
+		if !voted && warrior.Abandoned {
+			continue
+		}
+		view.Voters = append(view.Voters, &liteVoter{Name: warrior.WarriorName, Voted: voted, Vote: vote})
+	}
+
+	return view
+}
+
+// handleLiteBattle renders the battle with a form to vote on the active plan,
+// or a form to join as a guest when the request has no warrior cookie
+func (s *server) handleLiteBattle() http.HandlerFunc {
+	tmpl := parseLiteTemplates()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		Self := s.config.PathPrefix + "/lite/battle/" + BattleID
+		Lang := viper.GetString("config.default_locale")
+
+		warriorID, cookieErr := s.validateWarriorCookie(w, r)
+		if cookieErr == nil {
+			if _, err := s.database.GetWarrior(warriorID); err != nil {
+				s.clearWarriorCookies(w)
+				cookieErr = err
+			}
+		}
+
+		Battle, err := s.database.GetBattle(BattleID, warriorID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if Battle.Locale != "" {
+			Lang = Battle.Locale
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if cookieErr != nil {
+			// the warrior cookie is SameSite strict so it isn't sent when following a link from another site,
+			// the join page links back to itself for warriors that already have one
+			tmpl.ExecuteTemplate(w, "join", &liteView{
+				Lang:        Lang,
+				Title:       Battle.BattleName,
+				Self:        Self,
+				Action:      Self + "/join",
+				AllowGuests: viper.GetBool("config.allow_guests"),
+			})
+			return
+		}
+
+		if s.database.EnlistWarrior(BattleID, warriorID) {
+			Battle.Warriors = s.database.GetBattleWarriors(BattleID)
+			updatedWarriors, _ := json.Marshal(Battle.Warriors)
+			h.broadcast <- message{CreateSocketEvent("warrior_joined", string(updatedWarriors), warriorID), BattleID}
+		}
+
+		Battle.Plans = localizePlans(Battle.Plans, preferredLocales(r))
+		view := newLiteBattleView(Battle, warriorID)
+		view.Lang = Lang
+		view.Self = Self
+		view.Action = Self + "/vote"
+		view.Status = liteStatuses[r.URL.Query().Get("status")]
+
+		tmpl.ExecuteTemplate(w, "battle", view)
+	}
+}
+
+// handleLiteJoin handles joining a battle from the lite view as a guest warrior
+func (s *server) handleLiteJoin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		Self := s.config.PathPrefix + "/lite/battle/" + vars["id"]
+
+		WarriorName := sanitizeName(r.PostFormValue("warriorName"))
+		if !viper.GetBool("config.allow_guests") || WarriorName == "" {
+			http.Redirect(w, r, Self, http.StatusSeeOther)
+			return
+		}
+
+		newWarrior, err := s.database.CreateWarriorPrivate(truncateRunes(WarriorName, maxWarriorNameLength))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.createWarriorCookie(w, r, false, newWarrior.WarriorID)
+
+		http.Redirect(w, r, Self, http.StatusSeeOther)
+	}
+}
+
+// handleLiteVote handles a vote posted from the lite view, redirecting back to it with the outcome
+func (s *server) handleLiteVote() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		Self := s.config.PathPrefix + "/lite/battle/" + BattleID
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		status := "voted"
+		Battle, err := s.database.GetBattle(BattleID, warriorID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		VoteValue, valid := smsVoteValue(r.PostFormValue("vote"), Battle.PointValuesAllowed)
+		switch {
+		case Battle.ActivePlanID == "" || Battle.VotingLocked:
+			status = "closed"
+		case !valid:
+			status = "invalid"
+		default:
+			err = s.castVote(Battle, warriorID, VoteValue, "")
+			if err == database.ErrVoteChangeRejected {
+				status = "rejected"
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		http.Redirect(w, r, Self+"?"+url.Values{"status": {status}}.Encode(), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+func TestNewLiteBattleView(t *testing.T) {
+	battle := &database.Battle{
+		BattleName:         "Sprint 1",
+		PointValuesAllowed: []string{"1", "2", "3"},
+		ActivePlanID:       "p1",
+		Warriors: []*database.BattleWarrior{
+			{WarriorID: "w1", WarriorName: "Ada"},
+			{WarriorID: "w2", WarriorName: "Bob"},
+			{WarriorID: "w3", WarriorName: "Gone", Abandoned: true},
+		},
+		Plans: []*database.Plan{
+			{PlanID: "p1", PlanName: "Login", Votes: []*database.Vote{{WarriorID: "w1", VoteValue: "2"}}},
+		},
+	}
+
+	view := newLiteBattleView(battle, "w1")
+	if view.ActivePlan == nil || !view.VotingOpen || view.MyVote != "2" {
+		t.Error("Expected open voting on the active plan with the warriors vote got ", view.ActivePlan, view.VotingOpen, view.MyVote)
+	}
+	if len(view.Voters) != 2 || !view.Voters[0].Voted || view.Voters[1].Voted {
+		t.Error("Expected Ada voted and Bob not voted got ", view.Voters)
+	}
+
+	var out strings.Builder
+	view.Lang = "en"
+	if err := parseLiteTemplates().ExecuteTemplate(&out, "battle", view); err != nil {
+		t.Error("Expected the battle view to render got ", err)
+	}
+	if !strings.Contains(out.String(), `value="2" checked`) {
+		t.Error("Expected the warriors vote to be checked got ", out.String())
+	}
+}
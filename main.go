@@ -2,13 +2,25 @@ package main
 
 import (
 	_ "embed"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
+	_ "time/tzdata" // battle timezones need zoneinfo even in scratch containers
 
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/calendar"
 	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
 	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/email"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/federation"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/license"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/moderation"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/oidc"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/releases"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/sentry"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/storage"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/unfurl"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/securecookie"
 	"github.com/spf13/viper"
@@ -45,6 +57,18 @@ type ServerConfig struct {
 	AvatarService string
 	// PathPrefix allows the application to be run on a shared domain
 	PathPrefix string
+	// Whether a changed vote overwrites the previous one or is rejected
+	VoteChangePolicy string
+	// address emails are sent to for adding plans, plus addressed with the battles email code
+	InboundEmailAddress string
+	// shared secret the inbound email webhook is called with, the webhook is off when empty
+	InboundEmailSecret string
+	// auth token of the twilio account texts are received with, voting by text is off when empty
+	TwilioAuthToken string
+	// number participants text their votes to
+	TwilioPhoneNumber string
+	// secret signed URLs are signed with, changing it invalidates links already shared
+	SigningKey string
 }
 
 type server struct {
@@ -52,14 +76,134 @@ type server struct {
 	router   *mux.Router
 	email    *email.Email
 	cookie   *securecookie.SecureCookie
-	database *database.Database
+	database database.Datastore
+	// integrations consuming battle domain events from the outbox, by name
+	outbox map[string]outboxHandler
+	// recurring background jobs
+	jobs []*job
+	// fetches plan link previews, nil when they're disabled
+	unfurler *unfurl.Unfurler
+	// reports panics, nil when no DSN is configured
+	sentry *sentry.Client
+	// this instance as known to its federation peers, nil when federation is off
+	federation *federation.Instance
+	// peers of each federated battle its events are relayed to
+	federatedPeers *federatedPeers
+	// limits login attempts by address, nil when there are no limits
+	loginThrottle *loginThrottle
+	// avatarThrottle limits how many avatars each address requests from the avatar service proxy a minute
+	avatarThrottle *loginThrottle
+	// refuses plan, battle and warrior names that aren't allowed, nil when moderation is off
+	moderation *moderation.Moderator
+	// serves avatars from the avatar service URL template, nil when a named service is used
+	avatars *avatarProxy
+	// keeps generated files like export artifacts, nil when no storage backend is configured
+	storage storage.Storage
+	// makes thumbnails of images in storage, nil without storage
+	media *mediaService
+	// calendar providers teams can connect by name, those without an OAuth client configured are left out
+	calendars map[string]*calendar.Provider
+	// teams' hostnames and path prefixes requests are routed by
+	tenants teamDomains
+	// checks the latest release for updates, nil when the update check is off
+	releases *releases.Checker
+	// limits registered warriors and teams, nil when the instance isn't licensed
+	license *license.License
+	// identity provider warriors sign in with, nil unless the auth method is oidc
+	oidc *oidc.Provider
+	// reverse proxy warriors sign in with, nil unless the auth method is header
+	headerAuth *headerAuth
 }
 
 func main() {
+	seedDemo := flag.Bool("seed-demo", false, "create demo warriors, a team and battles with votes on startup")
+	flag.Parse()
+
 	log.Println("Thunderdome version " + version)
 
 	InitConfig()
 
+	s := newServer()
+	if *seedDemo {
+		if err := s.database.SeedDemo(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if viper.GetBool("config.record_battles") {
+		h.recorder = make(chan recordedEvent, 256)
+		go s.recordBattleEvents(h.recorder)
+	}
+	if s.federation != nil {
+		h.relay = make(chan message, 256)
+		go s.relayFederatedEvents(h.relay)
+	}
+
+	go h.run()
+	s.outbox["confluence"] = s.publishConfluenceResults
+	s.outbox["issues"] = s.pushIssueEstimate
+	s.outbox["issue-sync"] = s.syncIssueEdits
+	s.outbox["webhooks"] = s.deliverWebhooks
+	if viper.GetBool("config.battle_summary_email") {
+		s.outbox["summary"] = s.sendBattleSummary
+	}
+	go s.runOutbox()
+
+	s.registerJob("outbox-cleanup", "0 3 * * *", func() error {
+		return s.database.PurgeOutboxEvents(30)
+	})
+	s.registerJob("stats-snapshot", "0 0 * * *", s.database.SnapshotAppStats)
+	s.registerJob("email-log-cleanup", "30 3 * * *", func() error {
+		return s.database.PurgeEmailDeliveries(30)
+	})
+	s.registerJob("session-cleanup", "15 3 * * *", s.database.PurgeExpiredSessions)
+	s.registerJob("api-audit-cleanup", "45 3 * * *", func() error {
+		return s.database.PurgeAPIKeyRequests(viper.GetInt("config.api_audit_retention_days"))
+	})
+	// admins can change the retention in the battle defaults at any time, so it's checked each run
+	s.registerJob("data-retention", "15 4 * * *", s.applyRetention)
+	if viper.GetInt("config.battle_history_days") > 0 {
+		s.registerJob("battle-history-compaction", "45 4 * * *", func() error {
+			return s.database.CompactBattleHistory(viper.GetInt("config.battle_history_days"))
+		})
+	}
+	s.registerJob("attachment-cleanup", "*/15 * * * *", s.deleteRemovedAttachments)
+	if viper.GetString("config.encryption_keys") != "" {
+		s.registerJob("secrets-reencrypt", "30 4 * * *", func() error {
+			_, err := s.database.ReencryptSecrets()
+			return err
+		})
+	}
+	s.registerJob("email-broadcasts", "* * * * *", s.sendEmailBroadcasts)
+	s.registerJob("absence-conflicts", "0 9 * * *", s.sendAbsenceConflicts)
+	if len(s.calendars) > 0 {
+		s.registerJob("calendar-events", "0 * * * *", s.bookCalendarSlots)
+		s.registerJob("calendar-battles", "* * * * *", s.openDueCalendarSlots)
+	}
+	if viper.GetBool("config.usage_report") {
+		s.registerJob("usage-report", "0 8 1 * *", s.sendUsageReport)
+	}
+	if telemetryEnabled() {
+		s.registerJob("telemetry", "0 5 * * 1", s.sendTelemetry)
+	}
+	go s.runJobs()
+
+	srv := &http.Server{
+		Handler: s.tenantRouting(s.router),
+		Addr:    fmt.Sprintf(":%s", s.config.ListenPort),
+		// Good practice: enforce timeouts for servers you create!
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Println("Access the WebUI via 127.0.0.1:" + s.config.ListenPort)
+
+	log.Fatal(srv.ListenAndServe())
+}
+
+// newServer creates the server from the config with its database connected and routes registered,
+// leaving the hub, outbox and jobs for the caller to start
+func newServer() *server {
 	cookieHashkey := viper.GetString("http.cookie_hashkey")
 	pathPrefix := viper.GetString("http.path_prefix")
 	router := mux.NewRouter()
@@ -70,37 +214,180 @@ func main() {
 
 	s := &server{
 		config: &ServerConfig{
-			ListenPort:         viper.GetString("http.port"),
-			AppDomain:          viper.GetString("http.domain"),
-			AdminEmail:         viper.GetString("admin.email"),
-			FrontendCookieName: viper.GetString("http.frontend_cookie_name"),
-			SecureCookieName:   viper.GetString("http.backend_cookie_name"),
-			SecureCookieFlag:   viper.GetBool("http.secure_cookie"),
-			AnalyticsEnabled:   viper.GetBool("analytics.enabled"),
-			AnalyticsID:        viper.GetString("analytics.id"),
-			Version:            version,
-			AvatarService:      viper.GetString(("config.avatar_service")),
-			PathPrefix:         pathPrefix,
+			ListenPort:          viper.GetString("http.port"),
+			AppDomain:           viper.GetString("http.domain"),
+			AdminEmail:          viper.GetString("admin.email"),
+			FrontendCookieName:  viper.GetString("http.frontend_cookie_name"),
+			SecureCookieName:    viper.GetString("http.backend_cookie_name"),
+			SecureCookieFlag:    viper.GetBool("http.secure_cookie"),
+			AnalyticsEnabled:    viper.GetBool("analytics.enabled"),
+			AnalyticsID:         viper.GetString("analytics.id"),
+			Version:             version,
+			AvatarService:       viper.GetString(("config.avatar_service")),
+			PathPrefix:          pathPrefix,
+			VoteChangePolicy:    viper.GetString("config.vote_change_policy"),
+			InboundEmailAddress: viper.GetString("inbound_email.address"),
+			InboundEmailSecret:  viper.GetString("inbound_email.secret"),
+			TwilioAuthToken:     viper.GetString("twilio.auth_token"),
+			TwilioPhoneNumber:   viper.GetString("twilio.phone_number"),
+			SigningKey:          cookieHashkey,
 		},
 		router: router,
 		cookie: securecookie.New([]byte(cookieHashkey), nil),
+		outbox: make(map[string]outboxHandler),
 	}
 	s.email = email.New(s.config.AppDomain, s.config.PathPrefix)
 	s.database = database.New(s.config.AdminEmail, schemaSQL)
+	s.email.OnDelivery = func(Recipient string, Subject string, SendErr error) {
+		Error := ""
+		if SendErr != nil {
+			Error = SendErr.Error()
+		}
+		s.database.LogEmailDelivery(Recipient, Subject, Error)
+	}
 
-	go h.run()
+	var sentryErr error
+	s.sentry, sentryErr = sentry.New(viper.GetString("config.sentry_dsn"), version)
+	if sentryErr != nil {
+		log.Fatal(sentryErr)
+	}
+	// the access log sees the 500 responded to panics
+	router.Use(accessLog(
+		viper.GetBool("http.access_log"),
+		time.Duration(viper.GetInt("http.slow_request_ms"))*time.Millisecond,
+		viper.GetString("http.slow_request_webhook"),
+	), s.recoverPanics)
 
-	s.routes()
+	LoginAttempts := viper.GetInt("auth.login_attempts")
+	TrustedLoginAttempts := viper.GetInt("auth.trusted_login_attempts")
+	if LoginAttempts > 0 || TrustedLoginAttempts > 0 {
+		Trusted, err := parseNetworks(viper.GetString("auth.trusted_networks"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		Proxies, err := parseNetworks(viper.GetString("http.trusted_proxies"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.loginThrottle = &loginThrottle{
+			attempts:     make(map[string]*throttleWindow),
+			window:       time.Duration(viper.GetInt("auth.login_window_minutes")) * time.Minute,
+			limit:        LoginAttempts,
+			trustedLimit: TrustedLoginAttempts,
+			trusted:      Trusted,
+			proxies:      Proxies,
+		}
+	}
 
-	srv := &http.Server{
-		Handler: s.router,
-		Addr:    fmt.Sprintf(":%s", s.config.ListenPort),
-		// Good practice: enforce timeouts for servers you create!
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+	if isAvatarTemplate(s.config.AvatarService) {
+		s.avatars = newAvatarProxy(s.config.AvatarService, time.Duration(viper.GetInt("config.avatar_cache_minutes"))*time.Minute)
+		if AvatarRequests := viper.GetInt("config.avatar_requests_per_minute"); AvatarRequests > 0 {
+			Proxies, err := parseNetworks(viper.GetString("http.trusted_proxies"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.avatarThrottle = &loginThrottle{
+				attempts: make(map[string]*throttleWindow),
+				window:   time.Minute,
+				limit:    AvatarRequests,
+				proxies:  Proxies,
+			}
+		}
 	}
 
-	log.Println("Access the WebUI via 127.0.0.1:" + s.config.ListenPort)
+	if viper.GetBool("config.link_previews") {
+		s.unfurler = unfurl.New(linkPreviewTTL)
+	}
 
-	log.Fatal(srv.ListenAndServe())
+	ModerationWords := strings.Split(viper.GetString("moderation.words"), ",")
+	if WordsFile := viper.GetString("moderation.words_file"); WordsFile != "" {
+		FileWords, err := moderation.ReadWords(WordsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ModerationWords = append(ModerationWords, FileWords...)
+	}
+	s.moderation = moderation.New(ModerationWords, viper.GetString("moderation.api_url"), viper.GetString("moderation.api_key"))
+
+	var storageErr error
+	s.storage, storageErr = storage.New(storage.Config{
+		Backend:   viper.GetString("storage.backend"),
+		LocalPath: viper.GetString("storage.local_path"),
+		Endpoint:  viper.GetString("storage.endpoint"),
+		Region:    viper.GetString("storage.region"),
+		Bucket:    viper.GetString("storage.bucket"),
+		AccessKey: viper.GetString("storage.access_key"),
+		SecretKey: viper.GetString("storage.secret_key"),
+	})
+	if storageErr != nil {
+		log.Fatal(storageErr)
+	}
+	if s.storage != nil {
+		s.media = &mediaService{storage: s.storage}
+	}
+
+	s.calendars = make(map[string]*calendar.Provider)
+	if ClientID := viper.GetString("calendar.google_client_id"); ClientID != "" {
+		s.calendars[calendar.Google] = calendar.NewGoogle(ClientID, viper.GetString("calendar.google_client_secret"))
+	}
+	if ClientID := viper.GetString("calendar.microsoft_client_id"); ClientID != "" {
+		s.calendars[calendar.Microsoft] = calendar.NewMicrosoft(ClientID, viper.GetString("calendar.microsoft_client_secret"))
+	}
+
+	if viper.GetString("auth.method") == "oidc" {
+		Issuer := viper.GetString("auth.oidc.issuer")
+		ClientID := viper.GetString("auth.oidc.client_id")
+		if Issuer == "" || ClientID == "" {
+			log.Fatal("auth.oidc.issuer and auth.oidc.client_id are required with the oidc auth method")
+		}
+		s.oidc = oidc.New(Issuer, ClientID, viper.GetString("auth.oidc.client_secret"), viper.GetString("auth.oidc.scopes"))
+	}
+
+	if viper.GetString("auth.method") == "header" {
+		Proxies, err := parseNetworks(viper.GetString("auth.header.trusted_proxies"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(Proxies) == 0 {
+			log.Fatal("auth.header.trusted_proxies is required with the header auth method")
+		}
+		s.headerAuth = &headerAuth{
+			proxies:     Proxies,
+			userHeader:  viper.GetString("auth.header.user_header"),
+			emailHeader: viper.GetString("auth.header.email_header"),
+		}
+	}
+
+	h.limits = socketLimits{
+		MaxMessageSize: viper.GetInt64("websocket.max_message_kb") * 1024,
+		SendQueueSize:  viper.GetInt64("websocket.send_queue_kb") * 1024,
+		Rate:           viper.GetFloat64("websocket.rate_limit"),
+		Burst:          viper.GetFloat64("websocket.rate_burst"),
+	}
+
+	if viper.GetBool("config.update_check") {
+		s.releases = releases.New(releases.LatestURL)
+	}
+
+	if LicenseKey := viper.GetString("license.key"); LicenseKey != "" {
+		var licenseErr error
+		s.license, licenseErr = license.Parse(LicenseKey, viper.GetString("license.public_key"))
+		if licenseErr != nil {
+			log.Fatal(licenseErr)
+		}
+		log.Println("Licensed to " + s.license.Licensee)
+	}
+
+	if FederationKey := viper.GetString("federation.key"); FederationKey != "" {
+		var federationErr error
+		s.federation, federationErr = federation.New(federationInstanceURL(s.config.AppDomain, s.config.PathPrefix), FederationKey)
+		if federationErr != nil {
+			log.Fatal(federationErr)
+		}
+		s.federatedPeers = &federatedPeers{peers: make(map[string]federatedPeersEntry)}
+	}
+
+	s.routes()
+
+	return s
 }
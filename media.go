@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/storage"
+	"github.com/anthonynsimon/bild/transform"
+)
+
+const (
+	// maxImagePixels refuses images that would take too much memory to decode, like decompression bombs, at 4 bytes a
+	// pixel this is 100MB decoded
+	maxImagePixels = 25000000
+	// jpegQuality is what sanitized photos and their thumbnails are encoded with
+	jpegQuality = 85
+)
+
+// thumbnailWidths are the sizes thumbnails are made in, keeping how many are cached per image bounded
+var thumbnailWidths = map[int]bool{64: true, 128: true, 256: true, 512: true}
+
+// errUnsupportedImage is returned for files that aren't a png, jpeg or gif
+var errUnsupportedImage = errors.New("unsupported image")
+
+// isImageType checks whether the content type is an image that can be processed
+func isImageType(ContentType string) bool {
+	return ContentType == "image/png" || ContentType == "image/jpeg" || ContentType == "image/gif"
+}
+
+// sniffImage gets the content type of the image from its content rather than what the uploader claimed, empty when
+// it isn't one that can be processed
+func sniffImage(Data []byte) string {
+	if contentType := http.DetectContentType(Data); isImageType(contentType) {
+		return contentType
+	}
+
+	return ""
+}
+
+// decodeImage decodes the image after checking its size
+func decodeImage(Data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(Data))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, errors.New("image too large")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(Data))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+
+	return img, nil
+}
+
+// encodeImage encodes the image as the content type, gifs becoming pngs as only their first frame is kept
+func encodeImage(img image.Image, ContentType string) ([]byte, string, error) {
+	buffer := new(bytes.Buffer)
+	if ContentType == "image/jpeg" {
+		if err := jpeg.Encode(buffer, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return buffer.Bytes(), ContentType, nil
+	}
+
+	if err := png.Encode(buffer, img); err != nil {
+		return nil, "", err
+	}
+
+	return buffer.Bytes(), "image/png", nil
+}
+
+// sanitizeImage re-encodes pngs and jpegs, stripping their metadata like the EXIF location of a photo, a jpeg's
+// orientation being applied to the pixels first. gifs don't carry EXIF and are kept as is so they stay animated
+func sanitizeImage(Data []byte, ContentType string) ([]byte, error) {
+	if ContentType == "image/gif" {
+		if _, err := gif.DecodeConfig(bytes.NewReader(Data)); err != nil {
+			return nil, errUnsupportedImage
+		}
+		return Data, nil
+	}
+
+	img, err := decodeImage(Data)
+	if err != nil {
+		return nil, err
+	}
+	if ContentType == "image/jpeg" {
+		img = orientImage(img, jpegOrientation(Data))
+	}
+
+	sanitized, _, err := encodeImage(img, ContentType)
+
+	return sanitized, err
+}
+
+// makeThumbnail scales the image down to fit within the width, keeping its aspect ratio, smaller images keep their size
+func makeThumbnail(Data []byte, ContentType string, Width int) ([]byte, string, error) {
+	img, err := decodeImage(Data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > Width || h > Width {
+		if w >= h {
+			w, h = Width, h*Width/w
+		} else {
+			w, h = w*Width/h, Width
+		}
+		if w < 1 {
+			w = 1
+		}
+		if h < 1 {
+			h = 1
+		}
+		img = transform.Resize(img, w, h, transform.Linear)
+	}
+
+	return encodeImage(img, ContentType)
+}
+
+// jpegOrientation reads the EXIF orientation of the jpeg, 1 (as is) when it has none
+func jpegOrientation(Data []byte) int {
+	if len(Data) < 4 || Data[0] != 0xFF || Data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(Data); {
+		if Data[i] != 0xFF {
+			return 1
+		}
+		marker := Data[i+1]
+		length := int(binary.BigEndian.Uint16(Data[i+2:]))
+		// the image data starts at SOS without any EXIF before it
+		if marker == 0xDA || length < 2 || i+2+length > len(Data) {
+			return 1
+		}
+		segment := Data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of the TIFF structure EXIF is stored in
+func exifOrientation(TIFF []byte) int {
+	if len(TIFF) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(TIFF[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(TIFF[4:]))
+	if offset < 8 || offset+2 > len(TIFF) {
+		return 1
+	}
+	entries := int(order.Uint16(TIFF[offset:]))
+	for e := 0; e < entries; e++ {
+		entry := offset + 2 + e*12
+		if entry+12 > len(TIFF) {
+			return 1
+		}
+		if order.Uint16(TIFF[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(TIFF[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
+
+// orientImage turns the image upright as the EXIF orientation describes, mirroring and rotating its pixels
+func orientImage(img image.Image, Orientation int) image.Image {
+	if Orientation <= 1 || Orientation > 8 {
+		return img
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// orientations 5 to 8 swap the width and height
+	dw, dh := w, h
+	if Orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch Orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.SetNRGBA(dx, dy, src.NRGBAAt(x, y))
+		}
+	}
+
+	return dst
+}
+
+// mediaService makes thumbnails of the images kept in storage, caching them there alongside the originals
+type mediaService struct {
+	storage storage.Storage
+}
+
+// thumbnailKey is where the thumbnail of the stored image is cached
+func thumbnailKey(Key string, Width int) string {
+	return "thumbnails/" + Key + "/" + strconv.Itoa(Width)
+}
+
+// thumbnail gets the thumbnail of the stored image, making it when it isn't cached yet
+func (m *mediaService) thumbnail(Key string, ContentType string, Width int) ([]byte, string, error) {
+	if !thumbnailWidths[Width] {
+		return nil, "", errors.New("invalid thumbnail width")
+	}
+	// thumbnails are jpegs for jpegs and pngs for everything else
+	thumbnailType := "image/png"
+	if ContentType == "image/jpeg" {
+		thumbnailType = ContentType
+	}
+
+	if cached, err := m.storage.Get(thumbnailKey(Key, Width)); err == nil {
+		defer cached.Close()
+		data, err := ioutil.ReadAll(cached)
+		return data, thumbnailType, err
+	}
+
+	original, err := m.storage.Get(Key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer original.Close()
+	data, err := ioutil.ReadAll(original)
+	if err != nil {
+		return nil, "", err
+	}
+
+	thumb, thumbnailType, err := makeThumbnail(data, ContentType, Width)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := m.storage.Put(thumbnailKey(Key, Width), bytes.NewReader(thumb), thumbnailType); err != nil {
+		return nil, "", err
+	}
+
+	return thumb, thumbnailType, nil
+}
+
+// delete removes the stored image and its cached thumbnails
+func (m *mediaService) delete(Key string) error {
+	for Width := range thumbnailWidths {
+		if err := m.storage.Delete(thumbnailKey(Key, Width)); err != nil {
+			return err
+		}
+	}
+
+	return m.storage.Delete(Key)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/storage"
+)
+
+// testJPEG encodes a w by h jpeg with an EXIF segment holding the orientation and a GPS like marker
+func testJPEG(t *testing.T, w int, h int, Orientation uint16) []byte {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{Orientation, 0})
+	tiff.WriteString("GPS 52.52N 13.40E")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var data bytes.Buffer
+	data.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&data, binary.BigEndian, uint16(len(segment)+2))
+	data.Write(segment)
+	data.Write(encoded.Bytes()[2:])
+
+	return data.Bytes()
+}
+
+func TestSanitizeImage(t *testing.T) {
+	data := testJPEG(t, 40, 20, 6)
+	if sniffImage(data) != "image/jpeg" || jpegOrientation(data) != 6 {
+		t.Fatal("Unexpected test jpeg ", sniffImage(data), jpegOrientation(data))
+	}
+
+	sanitized, err := sanitizeImage(data, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sanitized, []byte("Exif")) || bytes.Contains(sanitized, []byte("GPS")) {
+		t.Error("Expected the EXIF to be stripped")
+	}
+	config, _, _ := image.DecodeConfig(bytes.NewReader(sanitized))
+	if config.Width != 20 || config.Height != 40 {
+		t.Error("Expected the orientation to be applied got ", config.Width, "x", config.Height)
+	}
+
+	if sniffImage([]byte("<html><script>alert(1)</script></html>")) != "" {
+		t.Error("Expected html not to be an image")
+	}
+	if _, err := sanitizeImage([]byte("\x89PNG\r\n\x1a\nnot really"), "image/png"); err == nil {
+		t.Error("Expected a broken png to be refused")
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	// a 2x1 image with a red pixel on the left
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+
+	tests := []struct {
+		orientation int
+		w, h        int
+		x, y        int
+	}{
+		{1, 2, 1, 0, 0},
+		{2, 2, 1, 1, 0},
+		{3, 2, 1, 1, 0},
+		{6, 1, 2, 0, 0},
+		{8, 1, 2, 0, 1},
+	}
+	for _, tt := range tests {
+		oriented := orientImage(img, tt.orientation)
+		b := oriented.Bounds()
+		if b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Error("Expected orientation ", tt.orientation, " to be ", tt.w, "x", tt.h, " got ", b.Dx(), "x", b.Dy())
+			continue
+		}
+		if r, _, _, _ := oriented.At(tt.x, tt.y).RGBA(); r == 0 {
+			t.Error("Expected orientation ", tt.orientation, " to move the red pixel to ", tt.x, ",", tt.y)
+		}
+	}
+}
+
+func TestMediaThumbnail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mediaService{storage: store}
+
+	var original bytes.Buffer
+	png.Encode(&original, image.NewNRGBA(image.Rect(0, 0, 400, 100)))
+	store.Put("attachments/a1", &original, "image/png")
+
+	thumb, contentType, err := m.thumbnail("attachments/a1", "image/png", 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _, _ := image.DecodeConfig(bytes.NewReader(thumb))
+	if contentType != "image/png" || config.Width != 128 || config.Height != 32 {
+		t.Error("Unexpected thumbnail ", contentType, config.Width, "x", config.Height)
+	}
+	if _, err := store.Get(thumbnailKey("attachments/a1", 128)); err != nil {
+		t.Error("Expected the thumbnail to be cached got ", err)
+	}
+	if _, _, err := m.thumbnail("attachments/a1", "image/png", 100); err == nil {
+		t.Error("Expected a width that isn't a thumbnail width to be refused")
+	}
+
+	if err := m.delete("attachments/a1"); err != nil {
+		t.Error("Unexpected error deleting ", err)
+	}
+	if _, err := store.Get(thumbnailKey("attachments/a1", 128)); err != storage.ErrNotFound {
+		t.Error("Expected the cached thumbnail to be deleted got ", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+// maxMentions is the most warriors a single question, answer or revision of the notes notifies
+const maxMentions = 10
+
+// handlePattern is what a warrior handle is made of
+var handlePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,30}$`)
+
+// mentionPattern finds @handle mentions, leaving out the @ of email addresses
+var mentionPattern = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_@.])@([a-zA-Z0-9_]{3,30})\b`)
+
+// warriorMention is the value of the warrior_mentioned socket event
+type warriorMention struct {
+	WarriorID   string `json:"warriorId"`
+	MentionedBy string `json:"mentionedBy"`
+}
+
+// parseMentions finds the handles mentioned in the text, lower cased and each once
+func parseMentions(Text string) []string {
+	var handles []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(Text, -1) {
+		handle := strings.ToLower(match[1])
+		if seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+		if len(handles) == maxMentions {
+			break
+		}
+	}
+
+	return handles
+}
+
+// notifyMentions notifies the battle's warriors mentioned in the text through their preferred channels, those
+// already mentioned in the previous text, like an earlier revision of the notes, aren't notified again
+func (s *server) notifyMentions(BattleID string, WarriorID string, Text string, Previous string) {
+	previous := make(map[string]bool)
+	for _, handle := range parseMentions(Previous) {
+		previous[handle] = true
+	}
+	var handles []string
+	for _, handle := range parseMentions(Text) {
+		if !previous[handle] {
+			handles = append(handles, handle)
+		}
+	}
+	if len(handles) == 0 {
+		return
+	}
+
+	Warriors, err := s.database.GetBattleWarriorsByHandles(BattleID, handles)
+	if err != nil || len(Warriors) == 0 {
+		return
+	}
+	MentionedBy, err := s.database.GetWarrior(WarriorID)
+	if err != nil {
+		return
+	}
+
+	var battle *database.Battle
+	for _, w := range Warriors {
+		if w.WarriorID == WarriorID {
+			continue
+		}
+
+		// the battle page toasts it to the mentioned warrior when they want it in battle
+		mention, _ := json.Marshal(warriorMention{WarriorID: w.WarriorID, MentionedBy: MentionedBy.WarriorName})
+		h.broadcast <- message{CreateSocketEvent("warrior_mentioned", string(mention), WarriorID), BattleID}
+
+		if w.WarriorEmail == "" || !s.database.WarriorNotifies(w.WarriorID, database.NotificationMentioned, database.NotificationChannelEmail) {
+			continue
+		}
+		if battle == nil {
+			if battle, err = s.database.GetBattle(BattleID, WarriorID); err != nil {
+				return
+			}
+		}
+		s.email.SendMention(w.WarriorName, w.WarriorEmail, MentionedBy.WarriorName, BattleID, battle.BattleName, Text)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"@thor what about the login page?", []string{"thor"}},
+		{"ask @Thor and @loki, then @THOR again", []string{"thor", "loki"}},
+		// email addresses and handles too short aren't mentions
+		{"mail thor@example.com or @ab", nil},
+		{"(@hela_1) @odin.", []string{"hela_1", "odin"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseMentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Error("Expected ", tt.want, " from ", tt.text, " got ", got)
+		}
+	}
+
+	if got := parseMentions(strings.Repeat("@warrior ", 3) + "@a01 @a02 @a03 @a04 @a05 @a06 @a07 @a08 @a09 @a10 @a11"); len(got) != maxMentions {
+		t.Error("Expected mentions to be capped at ", maxMentions, " got ", len(got))
+	}
+}
+
+// handleMock gives out handles, thor being taken
+type handleMock struct {
+	*database.Mock
+	handles map[string]string
+}
+
+func (m *handleMock) UpdateWarriorProfile(WarriorID string, WarriorName string, WarriorAvatar string, NotificationsEnabled bool) error {
+	m.Warriors[WarriorID].WarriorName = WarriorName
+	return nil
+}
+
+func (m *handleMock) SetWarriorHandle(WarriorID string, Handle string) error {
+	if strings.ToLower(Handle) == "thor" {
+		return database.ErrHandleTaken
+	}
+	m.handles[WarriorID] = Handle
+	return nil
+}
+
+func TestHandleWarriorProfileUpdateHandle(t *testing.T) {
+	s, db := newMockServer()
+	db.Warriors["w1"].WarriorName = "Loki"
+	mock := &handleMock{Mock: db, handles: make(map[string]string)}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/warrior/{id}", s.warriorOnly(s.handleWarriorProfileUpdate()))
+
+	tests := []struct {
+		handle string
+		status int
+		want   string
+	}{
+		{`"@Loki_of_Asgard"`, http.StatusOK, "Loki_of_Asgard"},
+		{`"Thor"`, http.StatusConflict, "Loki_of_Asgard"},
+		{`"lo"`, http.StatusBadRequest, "Loki_of_Asgard"},
+		{`"loki laufeyson"`, http.StatusBadRequest, "Loki_of_Asgard"},
+		{`""`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		body := `{"warriorName": "Loki", "warriorAvatar": "identicon", "warriorHandle": ` + tt.handle + `}`
+		r := httptest.NewRequest("POST", "/api/warrior/w1", strings.NewReader(body))
+		r.Header.Set(apiKeyHeaderName, "key1")
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.handle, " to respond ", tt.status, " got ", w.Code)
+		}
+		if mock.handles["w1"] != tt.want {
+			t.Error("Expected the handle to be ", tt.want, " got ", mock.handles["w1"])
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// maxWarriorNameLength is the most characters a warrior's name can have
+	maxWarriorNameLength = 64
+	// maxBattleNameLength is the most characters a battle's name can have
+	maxBattleNameLength = 256
+	// maxPlanNameLength is the most characters a plan's name can have
+	maxPlanNameLength = 256
+	// maxCombiningMarks is how many accents and other combining marks a character can stack, more only make
+	// the name spill over the lines around it
+	maxCombiningMarks = 3
+)
+
+const (
+	// nameRequired is the code of a name that's empty once cleaned
+	nameRequired = "required"
+	// nameTooLong is the code of a name with more characters than allowed
+	nameTooLong = "too_long"
+)
+
+// nameError is a name that was refused, the field, code and max let clients explain it in their own language
+type nameError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Max     int    `json:"max,omitempty"`
+	Message string `json:"error"`
+}
+
+func (e *nameError) Error() string {
+	return e.Message
+}
+
+// sanitizeName normalizes a name to NFC and collapses its whitespace, dropping the control and invisible
+// formatting characters that don't belong in a name along with stray variation selectors and combining marks
+// stacked past maxCombiningMarks. Zero width joiners and tags stay so emoji sequences and flags keep working
+func sanitizeName(Name string) string {
+	Name = norm.NFC.String(strings.ToValidUTF8(Name, ""))
+
+	var b strings.Builder
+	var prev rune
+	marks := 0
+	space := false
+	for _, r := range Name {
+		switch {
+		case unicode.IsSpace(r):
+			// tabs, new lines and the like become a single space
+			space = b.Len() > 0
+			continue
+		case unicode.IsControl(r):
+			continue
+		case r == '\u200d':
+			// zero width joiners only join two characters
+			if prev == 0 || prev == '\u200d' || space {
+				continue
+			}
+		case r >= '\U000E0020' && r <= '\U000E007F':
+			// tags only follow the black flag of subdivision flags, like Scotland's, and each other
+			if prev != '\U0001F3F4' && !(prev >= '\U000E0020' && prev <= '\U000E007F') {
+				continue
+			}
+		case unicode.Is(unicode.Cf, r):
+			// bidi overrides, zero width spaces, byte order marks and other invisible formatting
+			continue
+		case unicode.Is(unicode.Variation_Selector, r):
+			// a variation selector only picks how the character before it is shown
+			if prev == 0 || space || unicode.Is(unicode.Variation_Selector, prev) {
+				continue
+			}
+		case unicode.In(r, unicode.Mn, unicode.Me):
+			if prev == 0 || space || marks >= maxCombiningMarks {
+				continue
+			}
+			marks++
+			b.WriteRune(r)
+			prev = r
+			continue
+		}
+
+		if space {
+			b.WriteRune(' ')
+			space = false
+		}
+		b.WriteRune(r)
+		prev = r
+		marks = 0
+	}
+
+	return strings.TrimSuffix(b.String(), "\u200d")
+}
+
+// cleanName sanitizes the name, refusing it when it ends up empty or with more characters than allowed
+func cleanName(Field string, Name string, MaxLength int) (string, error) {
+	Name = sanitizeName(Name)
+	if Name == "" {
+		return "", &nameError{Field: Field, Code: nameRequired, Message: Field + " is required"}
+	}
+	if len([]rune(Name)) > MaxLength {
+		return "", &nameError{
+			Field:   Field,
+			Code:    nameTooLong,
+			Max:     MaxLength,
+			Message: Field + " can't be longer than " + strconv.Itoa(MaxLength) + " characters",
+		}
+	}
+
+	return Name, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"  Thor   Odinson\t\n", "Thor Odinson"},
+		{"Thor\x00\x1b[31m", "Thor[31m"},
+		{"Th\u200bor\u202e\ufeff", "Thor"},
+		// decomposed accents become the precomposed characters
+		{"Jo\u0301rmungandr", "Jórmungandr"},
+		// stacked accents are cut, but not those of other characters
+		{"Zx\u0301\u0301\u0301\u0301\u0301alx\u0301o", "Zx\u0301\u0301\u0301alx\u0301o"},
+		{"\ufe0fStar⭐\ufe0f\ufe0f", "Star⭐\ufe0f"},
+		// woman technologist, a joined sequence with a skin tone
+		{"\u200d\U0001F469\U0001F3FD\u200d\U0001F4BB\u200d", "\U0001F469\U0001F3FD\u200d\U0001F4BB"},
+		// the flag of Scotland keeps its tags, stray ones are dropped
+		{"\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F Loki\U000E0067", "\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F Loki"},
+		{"Thor\xff", "Thor"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeName(tt.name); got != tt.want {
+			t.Errorf("Expected %+q to become %+q got %+q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	if name, err := cleanName("warriorName", " Thor ", maxWarriorNameLength); err != nil || name != "Thor" {
+		t.Error("Expected a valid name to be cleaned got ", name, err)
+	}
+	if _, err := cleanName("warriorName", "\u200b \t", maxWarriorNameLength); err == nil || err.(*nameError).Code != nameRequired {
+		t.Error("Expected a name of only invisible characters to be required got ", err)
+	}
+	if _, err := cleanName("warriorName", strings.Repeat("é", maxWarriorNameLength), maxWarriorNameLength); err != nil {
+		t.Error("Expected the length to be counted in characters got ", err)
+	}
+	if _, err := cleanName("warriorName", strings.Repeat("a", maxWarriorNameLength+1), maxWarriorNameLength); err == nil || err.(*nameError).Code != nameTooLong {
+		t.Error("Expected a name over the limit to be too long got ", err)
+	}
+}
+
+func TestHandleWarriorRecruitName(t *testing.T) {
+	s, _ := newMockServer()
+	viper.Set("config.allow_guests", true)
+	defer viper.Set("config.allow_guests", nil)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/warrior", strings.NewReader(`{"warriorName": "`+strings.Repeat("a", 10000)+`"}`))
+	s.handleWarriorRecruit()(w, r)
+
+	var invalid nameError
+	json.Unmarshal(w.Body.Bytes(), &invalid)
+	if w.Code != http.StatusBadRequest || invalid.Field != "warriorName" || invalid.Code != nameTooLong || invalid.Max != maxWarriorNameLength {
+		t.Error("Expected a 10,000 character name to be refused got ", w.Code, w.Body.String())
+	}
+}
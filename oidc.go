@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/oidc"
+	"github.com/spf13/viper"
+)
+
+// oidcLoginTTL is how long a warrior has to sign in with the identity provider
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcLogin is what the callback needs to finish a warrior's sign in, kept in a signed cookie between leaving for
+// the identity provider and coming back
+type oidcLogin struct {
+	State    string
+	Nonce    string
+	Verifier string
+	// BattleID is the battle the warrior was on their way to when signing in
+	BattleID string
+	Expires  int64
+}
+
+// oidcRedirectURL is where the identity provider sends the warrior back to after signing in
+func (s *server) oidcRedirectURL() string {
+	return "https://" + s.config.AppDomain + s.config.PathPrefix + "/api/auth/oidc/callback"
+}
+
+// oidcCookieName is the name of the cookie the sign in is kept in
+func (s *server) oidcCookieName() string {
+	return s.config.SecureCookieName + "_oidc"
+}
+
+// oidcCookie keeps or, when login is nil, clears the sign in. It's sent on the identity provider's redirect back
+// so it can't be SameSite strict
+func (s *server) oidcCookie(w http.ResponseWriter, login *oidcLogin) error {
+	cookie := &http.Cookie{
+		Name:     s.oidcCookieName(),
+		Path:     s.config.PathPrefix + "/api/auth/oidc",
+		HttpOnly: true,
+		Domain:   s.config.AppDomain,
+		MaxAge:   -1,
+		Secure:   s.config.SecureCookieFlag,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if login != nil {
+		encoded, err := s.cookie.Encode(s.oidcCookieName(), login)
+		if err != nil {
+			return err
+		}
+		cookie.Value = encoded
+		cookie.MaxAge = int(oidcLoginTTL.Seconds())
+	}
+	http.SetCookie(w, cookie)
+
+	return nil
+}
+
+// oidcWarrior gets the warrior the ID token's claims are for, auto-recruiting them on their first sign in
+func (s *server) oidcWarrior(claims oidc.Claims) (*database.Warrior, error) {
+	WarriorEmail := strings.TrimSpace(claims.String(viper.GetString("auth.oidc.email_claim")))
+	if WarriorEmail == "" {
+		return nil, errors.New("id token has no email claim")
+	}
+	// a warrior could otherwise take over the account of an email they put in their profile without owning it,
+	// providers that don't send email_verified have to be trusted explicitly
+	if verified, _ := claims["email_verified"].(bool); !verified && !viper.GetBool("auth.oidc.allow_unverified_email") {
+		return nil, errors.New("email " + WarriorEmail + " isn't verified")
+	}
+	return s.recruitWarrior(claims.String(viper.GetString("auth.oidc.name_claim")), WarriorEmail)
+}
+
+// handleOidcLogin sends the warrior to the identity provider to sign in, optionally going on to ?battleId= after
+func (s *server) handleOidcLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		login := &oidcLogin{
+			BattleID: r.URL.Query().Get("battleId"),
+			Expires:  time.Now().Add(oidcLoginTTL).Unix(),
+		}
+		var err error
+		for _, secret := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+			if *secret, err = oidc.Secret(); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		AuthURL, err := s.oidc.AuthCodeURL(s.oidcRedirectURL(), login.State, login.Nonce, login.Verifier)
+		if err != nil {
+			log.Println("Failed discovering oidc provider", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if err := s.oidcCookie(w, login); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, AuthURL, http.StatusFound)
+	}
+}
+
+// handleOidcCallback handles the warrior coming back from the identity provider, logging them in with the
+// warrior of their ID token's email
+func (s *server) handleOidcCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var login oidcLogin
+		cookie, err := r.Cookie(s.oidcCookieName())
+		if err != nil || s.cookie.Decode(s.oidcCookieName(), cookie.Value, &login) != nil ||
+			login.State == "" || r.URL.Query().Get("state") != login.State || time.Now().Unix() > login.Expires {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.oidcCookie(w, nil)
+
+		Code := r.URL.Query().Get("code")
+		if Code == "" {
+			// the warrior declined or the provider refused them
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": r.URL.Query().Get("error")})
+			return
+		}
+
+		claims, err := s.oidc.Exchange(s.oidcRedirectURL(), Code, login.Verifier, login.Nonce)
+		if err != nil {
+			log.Println("Failed exchanging oidc code", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		authedWarrior, err := s.oidcWarrior(claims)
+		if err != nil {
+			log.Println("Failed oidc login", err)
+			RespondWithJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+
+		s.redirectLoggedIn(w, r, authedWarrior, login.BattleID)
+	}
+}
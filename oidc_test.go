@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/oidc"
+	"github.com/spf13/viper"
+)
+
+// oidcMock finds warriors by email and recruits the unknown ones
+type oidcMock struct {
+	*database.Mock
+	logins []string
+}
+
+func (m *oidcMock) GetWarriorByEmail(WarriorEmail string) (*database.Warrior, error) {
+	for _, w := range m.Warriors {
+		if w.WarriorEmail == WarriorEmail {
+			return w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *oidcMock) CreateWarriorCorporal(WarriorName string, WarriorEmail string, WarriorPassword string, ActiveWarriorID string) (*database.Warrior, string, error) {
+	w := &database.Warrior{WarriorID: "w2", WarriorName: WarriorName, WarriorEmail: WarriorEmail, WarriorRank: "CORPORAL"}
+	m.Warriors[w.WarriorID] = w
+	return w, "v2", nil
+}
+
+func (m *oidcMock) VerifyWarriorAccount(VerifyID string) error {
+	return nil
+}
+
+func (m *oidcMock) RecordWarriorLogin(WarriorID string) {
+	m.logins = append(m.logins, WarriorID)
+}
+
+func TestHandleOidcLogin(t *testing.T) {
+	s, db := newMockServer()
+	mock := &oidcMock{Mock: db}
+	s.database = mock
+	s.config.AppDomain = "td.example"
+	viper.Set("auth.oidc.email_claim", "email")
+	defer viper.Set("auth.oidc.email_claim", nil)
+	viper.Set("auth.oidc.name_claim", "name")
+	defer viper.Set("auth.oidc.name_claim", nil)
+
+	// the identity provider signs in whoever the claims are for
+	claims := map[string]interface{}{"name": "Thor Odinson", "email": "thor@asgard.example", "email_verified": true}
+	var idp *httptest.Server
+	idp = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 idp.URL,
+				"authorization_endpoint": idp.URL + "/auth",
+				"token_endpoint":         idp.URL + "/token",
+			})
+		case "/token":
+			r.ParseForm()
+			if oidc.Challenge(r.PostForm.Get("code_verifier")) != claims["challenge"] {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			payload, _ := json.Marshal(claims)
+			json.NewEncoder(w).Encode(map[string]string{"id_token": "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"})
+		}
+	}))
+	defer idp.Close()
+	s.oidc = oidc.New(idp.URL, "thunderdome", "", "openid")
+	claims["iss"] = idp.URL
+	claims["aud"] = "thunderdome"
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+
+	login := func(state string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleOidcLogin()(w, httptest.NewRequest("GET", "/api/auth/oidc?battleId=b1", nil))
+		if w.Code != http.StatusFound {
+			t.Fatal("Expected the warrior to be sent to the identity provider got ", w.Code)
+		}
+		authURL, _ := url.Parse(w.Header().Get("Location"))
+		claims["nonce"] = authURL.Query().Get("nonce")
+		claims["challenge"] = authURL.Query().Get("code_challenge")
+		if state == "" {
+			state = authURL.Query().Get("state")
+		}
+
+		r := httptest.NewRequest("GET", "/api/auth/oidc/callback?code=c1&state="+url.QueryEscape(state), nil)
+		for _, c := range w.Result().Cookies() {
+			r.AddCookie(c)
+		}
+		w = httptest.NewRecorder()
+		s.handleOidcCallback()(w, r)
+		return w
+	}
+
+	if w := login("forged"); w.Code != http.StatusForbidden {
+		t.Error("Expected a callback with another state to be refused got ", w.Code)
+	}
+
+	w := login("")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/battle/b1" {
+		t.Fatal("Expected the warrior to be logged in and sent on to the battle got ", w.Code, w.Header().Get("Location"))
+	}
+	if len(mock.logins) != 1 || mock.logins[0] != "w2" || db.Warriors["w2"].WarriorName != "Thor Odinson" {
+		t.Error("Expected the warrior to be recruited on their first login got ", mock.logins)
+	}
+	r := httptest.NewRequest("GET", "/api/warrior/w2", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	if session, err := s.cookieSession(r); err != nil || session.WarriorID != "w2" {
+		t.Error("Expected the warrior's session cookie to be issued got ", session, err)
+	}
+
+	claims["email_verified"] = false
+	if w := login(""); w.Code != http.StatusForbidden || len(mock.logins) != 1 {
+		t.Error("Expected an unverified email to be refused got ", w.Code)
+	}
+
+	delete(claims, "email_verified")
+	if w := login(""); w.Code != http.StatusForbidden || len(mock.logins) != 1 {
+		t.Error("Expected an email without email_verified to be refused got ", w.Code)
+	}
+
+	viper.Set("auth.oidc.allow_unverified_email", true)
+	defer viper.Set("auth.oidc.allow_unverified_email", nil)
+	if w := login(""); w.Code != http.StatusFound || len(mock.logins) != 2 {
+		t.Error("Expected an email without email_verified to be allowed when unverified emails are got ", w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// opsEvent is instance activity streamed to admins watching the live view
+type opsEvent struct {
+	Type        string    `json:"type"`
+	BattleID    string    `json:"battleId,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Arenas      int       `json:"arenas"`
+	Connections int       `json:"connections"`
+	Time        time.Time `json:"time"`
+}
+
+// opsFeed fans instance activity out to the admin live view sockets, dropping events for sockets that fall behind
+// rather than holding up the hub
+type opsFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]bool
+	arenas      int
+	connections int
+}
+
+var ops = &opsFeed{subscribers: make(map[chan []byte]bool)}
+
+// subscribe starts receiving events, the first being a snapshot of the current totals
+func (f *opsFeed) subscribe() chan []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan []byte, 64)
+	f.subscribers[ch] = true
+	snapshot, _ := json.Marshal(&opsEvent{Type: "snapshot", Arenas: f.arenas, Connections: f.connections, Time: time.Now()})
+	ch <- snapshot
+
+	return ch
+}
+
+// unsubscribe stops receiving events
+func (f *opsFeed) unsubscribe(ch chan []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.subscribers, ch)
+}
+
+// totals records the number of active arenas and connections, kept up to date by the hub
+func (f *opsFeed) totals(arenas int, connections int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.arenas = arenas
+	f.connections = connections
+}
+
+// publish sends the event to every subscriber along with the current totals
+func (f *opsFeed) publish(Type string, BattleID string, Message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.subscribers) == 0 {
+		return
+	}
+	event, _ := json.Marshal(&opsEvent{
+		Type:        Type,
+		BattleID:    BattleID,
+		Message:     Message,
+		Arenas:      f.arenas,
+		Connections: f.connections,
+		Time:        time.Now(),
+	})
+	for ch := range f.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// serveOps streams instance activity to an admin over a websocket
+func (s *server) serveOps() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		events := ops.subscribe()
+		defer ops.unsubscribe(events)
+
+		// reads only to notice the admin leaving and answer pings
+		closed := make(chan bool)
+		go func() {
+			ws.SetReadLimit(512)
+			ws.SetReadDeadline(time.Now().Add(pongWait))
+			ws.SetPongHandler(func(string) error { ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					close(closed)
+					return
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(pingPeriod)
+		defer func() {
+			ticker.Stop()
+			ws.Close()
+		}()
+		for {
+			select {
+			case event := <-events:
+				ws.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := ws.WriteMessage(websocket.TextMessage, event); err != nil {
+					return
+				}
+			case <-ticker.C:
+				ws.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}
+}
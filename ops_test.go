@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOpsFeed(t *testing.T) {
+	feed := &opsFeed{subscribers: make(map[chan []byte]bool)}
+	feed.totals(2, 5)
+
+	events := feed.subscribe()
+	var snapshot opsEvent
+	json.Unmarshal(<-events, &snapshot)
+	if snapshot.Type != "snapshot" || snapshot.Arenas != 2 || snapshot.Connections != 5 {
+		t.Error("Expected a snapshot of the totals got ", snapshot)
+	}
+
+	feed.publish("battle_started", "battle", "")
+	var started opsEvent
+	json.Unmarshal(<-events, &started)
+	if started.Type != "battle_started" || started.BattleID != "battle" || started.Connections != 5 {
+		t.Error("Expected the battle_started event got ", started)
+	}
+
+	// a subscriber that isn't reading doesn't hold up publishing
+	for i := 0; i < cap(events)+10; i++ {
+		feed.publish("connection_opened", "battle", "")
+	}
+	if len(events) != cap(events) {
+		t.Error("Expected the events past the buffer to be dropped got ", len(events))
+	}
+
+	feed.unsubscribe(events)
+	if len(feed.subscribers) != 0 {
+		t.Error("Expected no subscribers left")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+const (
+	// How often the outbox is checked for pending events
+	outboxPollInterval = 5 * time.Second
+
+	// Maximum events handled per outbox transaction
+	outboxBatchSize = 100
+
+	// Events that failed this many times are left for an admin to look into
+	outboxMaxAttempts = 10
+)
+
+// outboxEventTypes are the event types written to the outbox
+var outboxEventTypes = []string{"voting_ended", "plan_finalized", "battle_ended", "issue_plan_revised"}
+
+// outboxHandler delivers an outbox event to an integration, since events are delivered
+// at least once a handler may see the same event again and should be idempotent
+type outboxHandler func(event *database.OutboxEvent) error
+
+// handleOutboxEvent passes the event to every registered integration it wasn't delivered by yet, recording those
+// that succeed so a retry only runs the ones that failed, and failing the event for retry if any of them did
+func (s *server) handleOutboxEvent(event *database.OutboxEvent) error {
+	Delivered, err := s.database.GetOutboxDeliveries(event.ID)
+	if err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(Delivered))
+	for _, name := range Delivered {
+		done[name] = true
+	}
+
+	names := make([]string, 0, len(s.outbox))
+	for name := range s.outbox {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var failed []string
+	for _, name := range names {
+		if done[name] {
+			continue
+		}
+		if err := s.outbox[name](event); err != nil {
+			log.Printf("outbox %s failed on event %d : %v\n", name, event.ID, err)
+			ops.publish("error", event.BattleID, fmt.Sprintf("outbox %s failed on event %d: %v", name, event.ID, err))
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if err := s.database.SetOutboxDelivered(name, event.ID); err != nil {
+			log.Println(err)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// runOutbox delivers pending battle domain events to the integrations
+func (s *server) runOutbox() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// keep draining while there are full batches waiting
+		for {
+			processed, err := s.database.ProcessOutboxEvents(outboxBatchSize, outboxMaxAttempts, s.handleOutboxEvent)
+			if err != nil || processed < outboxBatchSize {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+// outboxDeliveryMock records which handlers delivered which event
+type outboxDeliveryMock struct {
+	*database.Mock
+	delivered map[int64][]string
+}
+
+func (m *outboxDeliveryMock) GetOutboxDeliveries(EventID int64) ([]string, error) {
+	return m.delivered[EventID], nil
+}
+
+func (m *outboxDeliveryMock) SetOutboxDelivered(Handler string, EventID int64) error {
+	m.delivered[EventID] = append(m.delivered[EventID], Handler)
+	return nil
+}
+
+func TestHandleOutboxEventRetriesOnlyFailed(t *testing.T) {
+	s, db := newMockServer()
+	s.database = &outboxDeliveryMock{Mock: db, delivered: make(map[int64][]string)}
+
+	calls := make(map[string]int)
+	s.outbox = map[string]outboxHandler{
+		"a-broken": func(event *database.OutboxEvent) error {
+			calls["a-broken"]++
+			return errors.New("unavailable")
+		},
+		"b-working": func(event *database.OutboxEvent) error {
+			calls["b-working"]++
+			return nil
+		},
+		"c-working": func(event *database.OutboxEvent) error {
+			calls["c-working"]++
+			return nil
+		},
+	}
+
+	if err := s.handleOutboxEvent(testOutboxEvent); err == nil {
+		t.Error("Expected the broken handler to fail the event")
+	}
+	if err := s.handleOutboxEvent(testOutboxEvent); err == nil {
+		t.Error("Expected the broken handler to fail the retry")
+	}
+	if calls["a-broken"] != 2 || calls["b-working"] != 1 || calls["c-working"] != 1 {
+		t.Error("Expected every handler to run once and only the broken one to be retried got ", calls)
+	}
+}
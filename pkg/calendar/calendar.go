@@ -0,0 +1,253 @@
+// Package calendar connects teams' Google and Microsoft calendars over OAuth so their recurring battles can be
+// booked as calendar events.
+package calendar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Google is the name of the Google Calendar provider
+	Google = "google"
+	// Microsoft is the name of the Microsoft Outlook calendar provider
+	Microsoft = "microsoft"
+)
+
+// ErrNoRefreshToken is returned when refreshing a token the provider didn't give a refresh token with
+var ErrNoRefreshToken = errors.New("no refresh token")
+
+// Token is a team's access to their calendar
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+// Expired reports whether the access token is expired or about to be
+func (t *Token) Expired() bool {
+	return time.Now().Add(time.Minute).After(t.Expiry)
+}
+
+// Event is a calendar event to book
+type Event struct {
+	Title       string
+	Description string
+	// JoinURL is where attendees join the battle, set as the event's location
+	JoinURL string
+	Start   time.Time
+	End     time.Time
+}
+
+// Provider is a calendar service authorized over OAuth with the instance's client
+type Provider struct {
+	Name         string
+	clientID     string
+	clientSecret string
+	authURL      string
+	tokenURL     string
+	scope        string
+	eventsURL    string
+	// eventBody is the request body creating the event in the provider's format
+	eventBody func(e *Event) interface{}
+	http      *http.Client
+}
+
+// NewGoogle creates the Google Calendar provider for the OAuth client
+func NewGoogle(ClientID string, ClientSecret string) *Provider {
+	return &Provider{
+		Name:         Google,
+		clientID:     ClientID,
+		clientSecret: ClientSecret,
+		authURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL:     "https://oauth2.googleapis.com/token",
+		scope:        "https://www.googleapis.com/auth/calendar.events",
+		eventsURL:    "https://www.googleapis.com/calendar/v3/calendars/primary/events",
+		eventBody:    googleEvent,
+		http:         &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// NewMicrosoft creates the Microsoft Outlook calendar provider for the OAuth client
+func NewMicrosoft(ClientID string, ClientSecret string) *Provider {
+	return &Provider{
+		Name:         Microsoft,
+		clientID:     ClientID,
+		clientSecret: ClientSecret,
+		authURL:      "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		tokenURL:     "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		scope:        "offline_access Calendars.ReadWrite",
+		eventsURL:    "https://graph.microsoft.com/v1.0/me/events",
+		eventBody:    microsoftEvent,
+		http:         &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// AuthCodeURL is where the team admin is sent to let the instance book events in their calendar, coming back to
+// the redirect URL with a code and the state
+func (p *Provider) AuthCodeURL(RedirectURL string, State string) string {
+	params := url.Values{}
+	params.Set("client_id", p.clientID)
+	params.Set("redirect_uri", RedirectURL)
+	params.Set("response_type", "code")
+	params.Set("scope", p.scope)
+	params.Set("state", State)
+	// google only hands out a refresh token when asked for offline access
+	params.Set("access_type", "offline")
+	params.Set("prompt", "consent")
+
+	return p.authURL + "?" + params.Encode()
+}
+
+// Exchange trades the code the admin came back with for a token
+func (p *Provider) Exchange(RedirectURL string, Code string) (*Token, error) {
+	params := url.Values{}
+	params.Set("grant_type", "authorization_code")
+	params.Set("code", Code)
+	params.Set("redirect_uri", RedirectURL)
+
+	return p.token(params, "")
+}
+
+// Refresh gets a new access token for an expired token
+func (p *Provider) Refresh(t *Token) (*Token, error) {
+	if t.RefreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+	params := url.Values{}
+	params.Set("grant_type", "refresh_token")
+	params.Set("refresh_token", t.RefreshToken)
+
+	return p.token(params, t.RefreshToken)
+}
+
+// token requests a token from the token endpoint, keeping the refresh token when a refresh doesn't hand out a new one
+func (p *Provider) token(params url.Values, RefreshToken string) (*Token, error) {
+	params.Set("client_id", p.clientID)
+	params.Set("client_secret", p.clientSecret)
+
+	resp, err := p.http.PostForm(p.tokenURL, params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s token endpoint responded %s", p.Name, resp.Status)
+	}
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New(p.Name + " token endpoint responded without an access token")
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = RefreshToken
+	}
+
+	return &Token{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// CreateEvent books the event in the calendar of the token, getting the provider's id for it
+func (p *Provider) CreateEvent(AccessToken string, e *Event) (string, error) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(p.eventBody(e)); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.eventsURL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s responded %s creating an event", p.Name, resp.Status)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", err
+	}
+
+	return created.ID, nil
+}
+
+// description is the event's description ending with the join link
+func (e *Event) description() string {
+	return strings.TrimSpace(e.Description + "\n\nJoin the battle: " + e.JoinURL)
+}
+
+// googleEvent is the event as a Google Calendar events insert
+func googleEvent(e *Event) interface{} {
+	type eventTime struct {
+		DateTime string `json:"dateTime"`
+	}
+
+	return struct {
+		Summary     string    `json:"summary"`
+		Description string    `json:"description"`
+		Location    string    `json:"location"`
+		Start       eventTime `json:"start"`
+		End         eventTime `json:"end"`
+	}{
+		Summary:     e.Title,
+		Description: e.description(),
+		Location:    e.JoinURL,
+		Start:       eventTime{e.Start.Format(time.RFC3339)},
+		End:         eventTime{e.End.Format(time.RFC3339)},
+	}
+}
+
+// microsoftEvent is the event as a Microsoft Graph event
+func microsoftEvent(e *Event) interface{} {
+	type eventTime struct {
+		DateTime string `json:"dateTime"`
+		TimeZone string `json:"timeZone"`
+	}
+	type body struct {
+		ContentType string `json:"contentType"`
+		Content     string `json:"content"`
+	}
+	type location struct {
+		DisplayName string `json:"displayName"`
+	}
+
+	return struct {
+		Subject  string    `json:"subject"`
+		Body     body      `json:"body"`
+		Location location  `json:"location"`
+		Start    eventTime `json:"start"`
+		End      eventTime `json:"end"`
+	}{
+		Subject:  e.Title,
+		Body:     body{"text", e.description()},
+		Location: location{e.JoinURL},
+		Start:    eventTime{e.Start.UTC().Format("2006-01-02T15:04:05"), "UTC"},
+		End:      eventTime{e.End.UTC().Format("2006-01-02T15:04:05"), "UTC"},
+	}
+}
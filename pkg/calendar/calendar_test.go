@@ -0,0 +1,76 @@
+package calendar
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAuthCodeURL(t *testing.T) {
+	u, err := url.Parse(NewGoogle("client", "secret").AuthCodeURL("https://td.example/api/calendar/google/callback", "s1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != "client" || q.Get("state") != "s1" || q.Get("access_type") != "offline" {
+		t.Error("Unexpected auth code url ", u)
+	}
+}
+
+func TestRefreshKeepsRefreshToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != "r1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token":"a2","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	p := NewMicrosoft("client", "secret")
+	p.tokenURL = srv.URL
+	token, err := p.Refresh(&Token{AccessToken: "a1", RefreshToken: "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "a2" || token.RefreshToken != "r1" || token.Expired() {
+		t.Error("Unexpected token ", token)
+	}
+
+	if _, err := p.Refresh(&Token{AccessToken: "a1"}); err != ErrNoRefreshToken {
+		t.Error("Expected refreshing without a refresh token to fail")
+	}
+}
+
+func TestCreateEvent(t *testing.T) {
+	var created map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer a1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&created)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"e1"}`))
+	}))
+	defer srv.Close()
+
+	p := NewGoogle("client", "secret")
+	p.eventsURL = srv.URL
+	start := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	id, err := p.CreateEvent("a1", &Event{Title: "Refinement", JoinURL: "https://td.example/join", Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "e1" || created["summary"] != "Refinement" || created["location"] != "https://td.example/join" {
+		t.Error("Unexpected event ", id, created)
+	}
+
+	if _, err := p.CreateEvent("a2", &Event{Title: "Refinement"}); err == nil {
+		t.Error("Expected creating an event unauthorized to fail")
+	}
+}
@@ -0,0 +1,155 @@
+package confluence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/unfurl"
+)
+
+// siteClient is what clients talk to their wiki with, the base url is set by team admins so only public
+// addresses are connected to
+var siteClient = unfurl.PublicClient(15 * time.Second)
+
+// Client talks to a Confluence instance on behalf of a user with an api token
+type Client struct {
+	baseURL  string
+	username string
+	apiToken string
+	http     *http.Client
+}
+
+// Row is a row of a results table
+type Row struct {
+	Name        string
+	ReferenceID string
+	Points      string
+}
+
+// New creates a Confluence client, baseURL is the wiki root e.g. https://example.atlassian.net/wiki
+func New(baseURL string, username string, apiToken string) *Client {
+	return &Client{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: username,
+		apiToken: apiToken,
+		http:     siteClient,
+	}
+}
+
+type page struct {
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Space struct {
+		Key string `json:"key"`
+	} `json:"space"`
+	Ancestors []ancestor `json:"ancestors,omitempty"`
+	Version   *version   `json:"version,omitempty"`
+	Body      struct {
+		Storage struct {
+			Value          string `json:"value"`
+			Representation string `json:"representation"`
+		} `json:"storage"`
+	} `json:"body"`
+}
+
+type ancestor struct {
+	ID string `json:"id"`
+}
+
+type version struct {
+	Number int `json:"number"`
+}
+
+// do sends a request to the content api decoding the response into out when set
+func (c *Client) do(method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.apiToken)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("confluence responded %s to %s %s", resp.Status, method, path)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
+
+// UpsertPage creates the page under the parent page, or updates the page with the same title in the space
+func (c *Client) UpsertPage(SpaceKey string, ParentPageID string, Title string, Body string) error {
+	if SpaceKey == "" || Title == "" {
+		return errors.New("space key and title are required")
+	}
+
+	var existing struct {
+		Results []struct {
+			ID      string  `json:"id"`
+			Version version `json:"version"`
+		} `json:"results"`
+	}
+	query := url.Values{}
+	query.Set("spaceKey", SpaceKey)
+	query.Set("title", Title)
+	query.Set("expand", "version")
+	if err := c.do(http.MethodGet, "/rest/api/content?"+query.Encode(), nil, &existing); err != nil {
+		return err
+	}
+
+	p := page{Type: "page", Title: Title}
+	p.Space.Key = SpaceKey
+	p.Body.Storage.Value = Body
+	p.Body.Storage.Representation = "storage"
+	if ParentPageID != "" {
+		p.Ancestors = []ancestor{{ID: ParentPageID}}
+	}
+
+	if len(existing.Results) == 0 {
+		return c.do(http.MethodPost, "/rest/api/content", p, nil)
+	}
+
+	p.ID = existing.Results[0].ID
+	p.Version = &version{Number: existing.Results[0].Version.Number + 1}
+
+	return c.do(http.MethodPut, "/rest/api/content/"+url.PathEscape(p.ID), p, nil)
+}
+
+// ResultsTable renders the rows as a table in Confluence storage format
+func ResultsTable(Rows []Row) string {
+	var b strings.Builder
+	b.WriteString("<table><tbody><tr><th>Plan</th><th>Reference</th><th>Points</th></tr>")
+	for _, r := range Rows {
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>",
+			html.EscapeString(r.Name), html.EscapeString(r.ReferenceID), html.EscapeString(r.Points))
+	}
+	b.WriteString("</tbody></table>")
+
+	return b.String()
+}
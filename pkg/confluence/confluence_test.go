@@ -0,0 +1,89 @@
+package confluence
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/unfurl"
+)
+
+func init() {
+	// the test wikis are on loopback
+	siteClient = &http.Client{Timeout: 15 * time.Second}
+}
+
+func TestLoopbackRefused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request to a loopback address")
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, "thor", "token")
+	c.http = unfurl.PublicClient(time.Second)
+	if err := c.UpsertPage("TD", "", "Sprint 1 Results", "<p/>"); !errors.Is(err, unfurl.ErrBlockedAddress) {
+		t.Error("Expected ErrBlockedAddress got ", err)
+	}
+}
+
+func TestUpsertPageCreates(t *testing.T) {
+	var created page
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "thor" || p != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"results":[]}`))
+		case http.MethodPost:
+			json.NewDecoder(r.Body).Decode(&created)
+		}
+	}))
+	defer srv.Close()
+
+	err := New(srv.URL+"/", "thor", "token").UpsertPage("TD", "42", "Sprint 1 Results", "<p/>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Title != "Sprint 1 Results" || created.Space.Key != "TD" || created.Ancestors[0].ID != "42" {
+		t.Error("Unexpected page ", created)
+	}
+}
+
+func TestUpsertPageUpdates(t *testing.T) {
+	var updated page
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"results":[{"id":"7","version":{"number":3}}]}`))
+		case http.MethodPut:
+			path = r.URL.Path
+			json.NewDecoder(r.Body).Decode(&updated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	if err := New(srv.URL, "thor", "token").UpsertPage("TD", "", "Sprint 1 Results", "<p/>"); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/rest/api/content/7" || updated.Version.Number != 4 {
+		t.Error("Expected version 4 update of page 7, got ", path, updated.Version)
+	}
+}
+
+func TestResultsTableEscapes(t *testing.T) {
+	table := ResultsTable([]Row{{Name: "<b>Login</b>", Points: "3"}})
+	expected := "<table><tbody><tr><th>Plan</th><th>Reference</th><th>Points</th></tr>" +
+		"<tr><td>&lt;b&gt;Login&lt;/b&gt;</td><td></td><td>3</td></tr></tbody></table>"
+
+	if table != expected {
+		t.Error("Unexpected table ", table)
+	}
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AddWarriorAbsence marks the warrior away from the start to the end date
+func (d *Database) AddWarriorAbsence(WarriorID string, StartDate time.Time, EndDate time.Time, Note string) (*WarriorAbsence, error) {
+	var a = &WarriorAbsence{WarriorID: WarriorID, StartDate: StartDate, EndDate: EndDate, Note: Note}
+
+	if err := d.db.QueryRow(
+		`INSERT INTO warrior_absences (warrior_id, start_date, end_date, note) VALUES ($1, $2, $3, $4) RETURNING id`,
+		WarriorID, StartDate, EndDate, Note,
+	).Scan(&a.AbsenceID); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add absence")
+	}
+
+	return a, nil
+}
+
+// GetWarriorAbsences gets the warrior's absences that haven't ended yet, soonest first
+func (d *Database) GetWarriorAbsences(WarriorID string) []*WarriorAbsence {
+	var absences = make([]*WarriorAbsence, 0)
+	rows, err := d.db.Query(
+		`SELECT id, warrior_id, start_date, end_date, note FROM warrior_absences
+		WHERE warrior_id = $1 AND end_date >= CURRENT_DATE
+		ORDER BY start_date`,
+		WarriorID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var a WarriorAbsence
+			if err := rows.Scan(&a.AbsenceID, &a.WarriorID, &a.StartDate, &a.EndDate, &a.Note); err != nil {
+				log.Println(err)
+			} else {
+				absences = append(absences, &a)
+			}
+		}
+	}
+
+	return absences
+}
+
+// DeleteWarriorAbsence removes one of the warrior's absences
+func (d *Database) DeleteWarriorAbsence(WarriorID string, AbsenceID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM warrior_absences WHERE id = $1 AND warrior_id = $2`,
+		AbsenceID, WarriorID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete absence")
+	}
+
+	return nil
+}
+
+// GetTeamAbsences gets the absences of the team's members overlapping the days from and to
+func (d *Database) GetTeamAbsences(TeamID string, From time.Time, To time.Time) ([]*WarriorAbsence, error) {
+	var absences = make([]*WarriorAbsence, 0)
+	rows, err := d.db.Query(
+		`SELECT wa.id, wa.warrior_id, wa.start_date, wa.end_date, wa.note
+		FROM warrior_absences wa
+		JOIN team_warriors tw ON tw.warrior_id = wa.warrior_id
+		WHERE tw.team_id = $1 AND wa.end_date >= $2::DATE AND wa.start_date <= $3::DATE
+		ORDER BY wa.start_date`,
+		TeamID, From, To,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get team absences")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a WarriorAbsence
+		if err := rows.Scan(&a.AbsenceID, &a.WarriorID, &a.StartDate, &a.EndDate, &a.Note); err != nil {
+			log.Println(err)
+		} else {
+			absences = append(absences, &a)
+		}
+	}
+
+	return absences, nil
+}
+
+// CreateBattleSchedule adds a recurring battle to the team
+func (d *Database) CreateBattleSchedule(TeamID string, Name string, Schedule string, Timezone string, KeyWarriorIDs []string) (*BattleSchedule, error) {
+	if KeyWarriorIDs == nil {
+		KeyWarriorIDs = make([]string, 0)
+	}
+	var bs = &BattleSchedule{TeamID: TeamID, Name: Name, Schedule: Schedule, Timezone: Timezone, KeyWarriorIDs: KeyWarriorIDs}
+
+	if err := d.db.QueryRow(
+		`INSERT INTO team_battle_schedules (team_id, name, schedule, timezone, key_warriors) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_date`,
+		TeamID, Name, Schedule, Timezone, pq.Array(KeyWarriorIDs),
+	).Scan(&bs.ScheduleID, &bs.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create battle schedule")
+	}
+
+	return bs, nil
+}
+
+// getBattleSchedules gets the recurring battles of the team, or of every team when no team is given
+func (d *Database) getBattleSchedules(TeamID string) ([]*BattleSchedule, error) {
+	var schedules = make([]*BattleSchedule, 0)
+	rows, err := d.db.Query(
+		`SELECT id, team_id, name, schedule, timezone, key_warriors::TEXT[], created_date FROM team_battle_schedules
+		WHERE $1 = '' OR team_id::TEXT = $1
+		ORDER BY created_date`,
+		TeamID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get battle schedules")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bs BattleSchedule
+		if err := rows.Scan(&bs.ScheduleID, &bs.TeamID, &bs.Name, &bs.Schedule, &bs.Timezone, pq.Array(&bs.KeyWarriorIDs), &bs.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			if bs.KeyWarriorIDs == nil {
+				bs.KeyWarriorIDs = make([]string, 0)
+			}
+			schedules = append(schedules, &bs)
+		}
+	}
+
+	return schedules, nil
+}
+
+// GetTeamBattleSchedules gets the team's recurring battles
+func (d *Database) GetTeamBattleSchedules(TeamID string) ([]*BattleSchedule, error) {
+	return d.getBattleSchedules(TeamID)
+}
+
+// GetBattleSchedules gets every team's recurring battles
+func (d *Database) GetBattleSchedules() ([]*BattleSchedule, error) {
+	return d.getBattleSchedules("")
+}
+
+// DeleteBattleSchedule removes one of the team's recurring battles
+func (d *Database) DeleteBattleSchedule(TeamID string, ScheduleID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM team_battle_schedules WHERE id = $1 AND team_id = $2`,
+		ScheduleID, TeamID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete battle schedule")
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// GetBattleActionItems gets the battles action items in the order they were recorded
+func (d *Database) GetBattleActionItems(BattleID string) []*ActionItem {
+	var items = make([]*ActionItem, 0)
+	rows, err := d.db.Query(
+		`SELECT ai.id, ai.content, coalesce(ai.owner_id::TEXT, ''), coalesce(w.name, ''),
+			coalesce(to_char(ai.due_date, 'YYYY-MM-DD'), ''), ai.completed, ai.created_date
+		FROM battle_action_items ai
+		LEFT JOIN warriors w ON w.id = ai.owner_id
+		WHERE ai.battle_id = $1
+		ORDER BY ai.created_date`,
+		BattleID,
+	)
+	if err != nil {
+		log.Println(err)
+		return items
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var ai ActionItem
+		if err := rows.Scan(&ai.ActionItemID, &ai.Content, &ai.OwnerID, &ai.OwnerName, &ai.DueDate, &ai.Completed, &ai.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			items = append(items, &ai)
+		}
+	}
+
+	return items
+}
+
+// confirmActionItemOwner checks an action items owner is in the battle, no owner is allowed
+func (d *Database) confirmActionItemOwner(BattleID string, OwnerID string) error {
+	if OwnerID != "" && !d.IsBattleWarrior(BattleID, OwnerID) {
+		return errors.New("owner not in battle")
+	}
+
+	return nil
+}
+
+// AddBattleActionItem records an action item, DueDate is YYYY-MM-DD or empty
+func (d *Database) AddBattleActionItem(BattleID string, LeaderID string, Content string, OwnerID string, DueDate string) ([]*ActionItem, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+	if err := d.confirmActionItemOwner(BattleID, OwnerID); err != nil {
+		return nil, err
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO battle_action_items (battle_id, content, owner_id, due_date)
+		VALUES ($1, $2, NULLIF($3, '')::UUID, NULLIF($4, '')::DATE);`,
+		BattleID, Content, OwnerID, DueDate,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add action item")
+	}
+
+	return d.GetBattleActionItems(BattleID), nil
+}
+
+// UpdateBattleActionItem revises an action item, DueDate is YYYY-MM-DD or empty
+func (d *Database) UpdateBattleActionItem(BattleID string, LeaderID string, ActionItemID string, Content string, OwnerID string, DueDate string, Completed bool) ([]*ActionItem, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+	if err := d.confirmActionItemOwner(BattleID, OwnerID); err != nil {
+		return nil, err
+	}
+
+	res, err := d.db.Exec(
+		`UPDATE battle_action_items
+		SET content = $3, owner_id = NULLIF($4, '')::UUID, due_date = NULLIF($5, '')::DATE, completed = $6
+		WHERE id = $2 AND battle_id = $1;`,
+		BattleID, ActionItemID, Content, OwnerID, DueDate, Completed,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to update action item")
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		return nil, errors.New("action item not found")
+	}
+
+	return d.GetBattleActionItems(BattleID), nil
+}
+
+// DeleteBattleActionItem removes an action item from the battle
+func (d *Database) DeleteBattleActionItem(BattleID string, LeaderID string, ActionItemID string) ([]*ActionItem, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`DELETE FROM battle_action_items WHERE id = $2 AND battle_id = $1;`,
+		BattleID, ActionItemID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to delete action item")
+	}
+
+	return d.GetBattleActionItems(BattleID), nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"errors"
 	"log"
+	"time"
 )
 
 // ConfirmAdmin confirms whether the warrior is infact a GENERAL (ADMIN)
@@ -80,3 +81,127 @@ func (d *Database) DemoteWarrior(WarriorID string) error {
 
 	return nil
 }
+
+// UsageReport is a summary of instance activity over a period for admins
+type UsageReport struct {
+	From            time.Time    `json:"from"`
+	To              time.Time    `json:"to"`
+	NewRegistered   int          `json:"newRegisteredWarriors"`
+	NewUnregistered int          `json:"newUnregisteredWarriors"`
+	BattlesRun      int          `json:"battlesRun"`
+	PlansAdded      int          `json:"plansAdded"`
+	DatabaseSize    int64        `json:"databaseSize"`
+	DatabaseGrowth  int64        `json:"databaseGrowth"`
+	MostActiveTeams []*TeamUsage `json:"mostActiveTeams"`
+}
+
+// TeamUsage is the number of battles a team ran during a usage report period
+type TeamUsage struct {
+	TeamName    string `json:"name"`
+	BattleCount int    `json:"battleCount"`
+}
+
+// SnapshotAppStats records todays application stats so growth can be reported over time
+func (d *Database) SnapshotAppStats() error {
+	if _, err := d.db.Exec(
+		`INSERT INTO app_stats_snapshots
+			(snapshot_date, unregistered_warrior_count, registered_warrior_count, battle_count, plan_count, team_count, database_size)
+		SELECT CURRENT_DATE, s.unregistered_warrior_count, s.registered_warrior_count, s.battle_count, s.plan_count,
+			(SELECT COUNT(*) FROM teams), pg_database_size(current_database())
+		FROM get_app_stats() s
+		ON CONFLICT (snapshot_date) DO UPDATE SET
+			unregistered_warrior_count = EXCLUDED.unregistered_warrior_count,
+			registered_warrior_count = EXCLUDED.registered_warrior_count,
+			battle_count = EXCLUDED.battle_count,
+			plan_count = EXCLUDED.plan_count,
+			team_count = EXCLUDED.team_count,
+			database_size = EXCLUDED.database_size;`,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to snapshot application stats")
+	}
+
+	return nil
+}
+
+// GetUsageReport gets the instance usage from the given time up to but not including the to time, storage growth is
+// measured between the earliest stats snapshots taken since each of them, or the current size when there's none since
+// the to time yet
+func (d *Database) GetUsageReport(From time.Time, To time.Time) (*UsageReport, error) {
+	var r = &UsageReport{
+		From:            From,
+		To:              To,
+		MostActiveTeams: make([]*TeamUsage, 0),
+	}
+
+	e := d.db.QueryRow(
+		`SELECT
+			(SELECT COUNT(*) FROM warriors WHERE email IS NOT NULL AND created_date >= $1 AND created_date < $2),
+			(SELECT COUNT(*) FROM warriors WHERE email IS NULL AND created_date >= $1 AND created_date < $2),
+			(SELECT COUNT(*) FROM battles WHERE created_date >= $1 AND created_date < $2 AND parent_id IS NULL)
+				-- battles are deleted once conceded, their sessions remain for feedback
+				+ (SELECT COUNT(*) FROM battle_sessions WHERE ended_date >= $1 AND ended_date < $2),
+			(SELECT COUNT(*) FROM plans WHERE created_date >= $1 AND created_date < $2),
+			pg_database_size(current_database()),
+			coalesce((
+				SELECT database_size FROM app_stats_snapshots WHERE snapshot_date >= $2::DATE
+				ORDER BY snapshot_date LIMIT 1
+			), pg_database_size(current_database())) - coalesce((
+				SELECT database_size FROM app_stats_snapshots WHERE snapshot_date >= $1::DATE
+				ORDER BY snapshot_date LIMIT 1
+			), pg_database_size(current_database()))`,
+		From, To,
+	).Scan(&r.NewRegistered, &r.NewUnregistered, &r.BattlesRun, &r.PlansAdded, &r.DatabaseSize, &r.DatabaseGrowth)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to get usage report")
+	}
+
+	rows, err := d.db.Query(
+		`SELECT t.name, COUNT(*) AS battle_count
+		FROM teams t
+		JOIN (
+			SELECT team_id FROM battles WHERE created_date >= $1 AND created_date < $2
+			UNION ALL
+			SELECT team_id FROM battle_sessions WHERE ended_date >= $1 AND ended_date < $2
+		) b ON b.team_id = t.id
+		GROUP BY t.id
+		ORDER BY battle_count DESC, t.name
+		LIMIT 5`,
+		From, To,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var t TeamUsage
+			if err := rows.Scan(&t.TeamName, &t.BattleCount); err != nil {
+				log.Println(err)
+			} else {
+				r.MostActiveTeams = append(r.MostActiveTeams, &t)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// GetAdminWarriors gets the GENERAL rank warriors that have an email
+func (d *Database) GetAdminWarriors() []*Warrior {
+	var warriors = make([]*Warrior, 0)
+	rows, err := d.db.Query(
+		`SELECT id, name, email FROM warriors WHERE rank = 'GENERAL' AND email IS NOT NULL ORDER BY name`,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var w Warrior
+			if err := rows.Scan(&w.WarriorID, &w.WarriorName, &w.WarriorEmail); err != nil {
+				log.Println(err)
+			} else {
+				warriors = append(warriors, &w)
+			}
+		}
+	}
+
+	return warriors
+}
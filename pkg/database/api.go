@@ -146,17 +146,20 @@ func (d *Database) DeleteWarriorAPIKey(WarriorID string, KeyID string) ([]*APIKe
 	return keys, nil
 }
 
+// apiKeyID gets the stored ID of an API key, its prefix and hash
+func (d *Database) apiKeyID(APK string) string {
+	splitKey := strings.Split(APK, ".")
+
+	return splitKey[0] + "." + d.HashAPIKey(APK)
+}
+
 // ValidateAPIKey checks to see if the API key exists in the database and if so returns WarriorID
 func (d *Database) ValidateAPIKey(APK string) (WarriorID string, ValidatationErr error) {
 	var warID string = ""
 
-	splitKey := strings.Split(APK, ".")
-	hashedKey := d.HashAPIKey(APK)
-	keyID := splitKey[0] + "." + hashedKey
-
 	e := d.db.QueryRow(
 		`SELECT warrior_id FROM api_keys WHERE id = $1 AND active = true`,
-		keyID,
+		d.apiKeyID(APK),
 	).Scan(&warID)
 	if e != nil {
 		log.Println(e)
@@ -165,3 +168,76 @@ func (d *Database) ValidateAPIKey(APK string) (WarriorID string, ValidatationErr
 
 	return warID, nil
 }
+
+// LogAPIRequest records a request made with an API key for auditing
+func (d *Database) LogAPIRequest(APK string, WarriorID string, Method string, Route string, Detail string, Status int, Latency time.Duration) {
+	if _, err := d.db.Exec(
+		`INSERT INTO api_key_requests (key_id, warrior_id, method, route, detail, status, latency_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		d.apiKeyID(APK),
+		WarriorID,
+		Method,
+		Route,
+		Detail,
+		Status,
+		Latency.Milliseconds(),
+	); err != nil {
+		log.Println(err)
+	}
+}
+
+// GetAPIKeyRequests gets a page of the audited API key requests newest first,
+// optionally only those of a warrior and/or key
+func (d *Database) GetAPIKeyRequests(WarriorID string, KeyID string, Limit int, Offset int) ([]*APIKeyRequest, error) {
+	var requests = make([]*APIKeyRequest, 0)
+	rows, err := d.db.Query(
+		`SELECT id, key_id, warrior_id, method, route, detail, status, latency_ms, created_date
+		FROM api_key_requests
+		WHERE ($1 = '' OR warrior_id::TEXT = $1) AND ($2 = '' OR key_id = $2)
+		ORDER BY created_date DESC LIMIT $3 OFFSET $4;`,
+		WarriorID,
+		KeyID,
+		Limit,
+		Offset,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get api key requests")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var ar APIKeyRequest
+		if err := rows.Scan(
+			&ar.ID,
+			&ar.KeyID,
+			&ar.WarriorID,
+			&ar.Method,
+			&ar.Route,
+			&ar.Detail,
+			&ar.Status,
+			&ar.LatencyMs,
+			&ar.CreatedDate,
+		); err != nil {
+			log.Println(err)
+		} else {
+			ar.Prefix = strings.Split(ar.KeyID, ".")[0]
+			requests = append(requests, &ar)
+		}
+	}
+
+	return requests, nil
+}
+
+// PurgeAPIKeyRequests removes audited API key requests older than the given number of days
+func (d *Database) PurgeAPIKeyRequests(DaysOld int) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM api_key_requests WHERE created_date < NOW() - make_interval(days => $1);`,
+		DaysOld,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to purge api key requests")
+	}
+
+	return nil
+}
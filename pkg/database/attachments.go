@@ -0,0 +1,118 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// AddPlanAttachment records a file attached to the battle's plan, the file itself being kept in storage
+func (d *Database) AddPlanAttachment(BattleID string, PlanID string, WarriorID string, Name string, ContentType string, Size int) (*PlanAttachment, error) {
+	var a = &PlanAttachment{
+		PlanID:      PlanID,
+		WarriorID:   WarriorID,
+		Name:        Name,
+		ContentType: ContentType,
+		Size:        Size,
+	}
+
+	if err := d.db.QueryRow(
+		`INSERT INTO plan_attachments (plan_id, battle_id, warrior_id, name, content_type, size)
+		SELECT id, battle_id, $3, $4, $5, $6 FROM plans WHERE id = $2 AND battle_id = $1
+		RETURNING id, created_date;`,
+		BattleID, PlanID, WarriorID, Name, ContentType, Size,
+	).Scan(&a.AttachmentID, &a.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add plan attachment")
+	}
+
+	return a, nil
+}
+
+// GetPlanAttachments gets the files attached to the battle's plan in the order they were added
+func (d *Database) GetPlanAttachments(BattleID string, PlanID string) []*PlanAttachment {
+	var attachments = make([]*PlanAttachment, 0)
+	rows, err := d.db.Query(
+		`SELECT id, plan_id, coalesce(warrior_id::TEXT, ''), name, content_type, size, created_date
+		FROM plan_attachments
+		WHERE battle_id = $1 AND plan_id = $2
+		ORDER BY created_date`,
+		BattleID, PlanID,
+	)
+	if err != nil {
+		log.Println(err)
+		return attachments
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var a PlanAttachment
+		if err := rows.Scan(&a.AttachmentID, &a.PlanID, &a.WarriorID, &a.Name, &a.ContentType, &a.Size, &a.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			attachments = append(attachments, &a)
+		}
+	}
+
+	return attachments
+}
+
+// GetPlanAttachment gets one of the battle's attachments by ID
+func (d *Database) GetPlanAttachment(BattleID string, AttachmentID string) (*PlanAttachment, error) {
+	var a PlanAttachment
+	if err := d.db.QueryRow(
+		`SELECT id, plan_id, coalesce(warrior_id::TEXT, ''), name, content_type, size, created_date
+		FROM plan_attachments
+		WHERE battle_id = $1 AND id = $2`,
+		BattleID, AttachmentID,
+	).Scan(&a.AttachmentID, &a.PlanID, &a.WarriorID, &a.Name, &a.ContentType, &a.Size, &a.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("plan attachment not found")
+	}
+
+	return &a, nil
+}
+
+// DeletePlanAttachment removes the record of one of the battle's attachments
+func (d *Database) DeletePlanAttachment(BattleID string, AttachmentID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM plan_attachments WHERE battle_id = $1 AND id = $2`, BattleID, AttachmentID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete plan attachment")
+	}
+
+	return nil
+}
+
+// GetDeletedAttachments gets the IDs of removed attachments whose files are still to be deleted from storage, oldest first
+func (d *Database) GetDeletedAttachments(Limit int) ([]string, error) {
+	var AttachmentIDs = make([]string, 0)
+	rows, err := d.db.Query(
+		`SELECT id FROM deleted_attachments ORDER BY deleted_date LIMIT $1`, Limit)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get deleted attachments")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var AttachmentID string
+		if err := rows.Scan(&AttachmentID); err != nil {
+			log.Println(err)
+		} else {
+			AttachmentIDs = append(AttachmentIDs, AttachmentID)
+		}
+	}
+
+	return AttachmentIDs, nil
+}
+
+// ClearDeletedAttachment removes the removed attachment from the queue once its file is deleted from storage
+func (d *Database) ClearDeletedAttachment(AttachmentID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM deleted_attachments WHERE id = $1`, AttachmentID); err != nil {
+		log.Println(err)
+		return errors.New("unable to clear deleted attachment")
+	}
+
+	return nil
+}
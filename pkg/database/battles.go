@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+
+	"github.com/lib/pq"
 )
 
 //CreateBattle adds a new battle to the db
-func (d *Database) CreateBattle(LeaderID string, BattleName string, PointValuesAllowed []string, Plans []*Plan, AutoFinishVoting bool) (*Battle, error) {
+func (d *Database) CreateBattle(LeaderID string, BattleName string, PointValuesAllowed []string, Plans []*Plan, AutoFinishVoting bool, Timezone string, Locale string, TeamID string, RequireReady bool) (*Battle, error) {
 	var pointValuesJSON, _ = json.Marshal(PointValuesAllowed)
 
 	var b = &Battle{
@@ -21,25 +23,36 @@ func (d *Database) CreateBattle(LeaderID string, BattleName string, PointValuesA
 		ActivePlanID:       "",
 		PointValuesAllowed: PointValuesAllowed,
 		AutoFinishVoting:   AutoFinishVoting,
+		Timezone:           Timezone,
+		Locale:             Locale,
+		TeamID:             TeamID,
+		RequireReady:       RequireReady,
+		Checklist:          make([]*ChecklistItem, 0),
 	}
 
 	e := d.db.QueryRow(
-		`INSERT INTO battles (leader_id, name, point_values_allowed, auto_finish_voting) VALUES ($1, $2, $3, $4) RETURNING id`,
+		`INSERT INTO battles (leader_id, name, point_values_allowed, auto_finish_voting, timezone, locale, team_id, require_ready)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::UUID, $8) RETURNING id, created_date, updated_date`,
 		LeaderID,
 		BattleName,
 		string(pointValuesJSON),
 		AutoFinishVoting,
-	).Scan(&b.BattleID)
+		Timezone,
+		Locale,
+		TeamID,
+		RequireReady,
+	).Scan(&b.BattleID, &b.CreatedDate, &b.UpdatedDate)
 	if e != nil {
 		log.Println(e)
 		return nil, errors.New("error creating battle")
 	}
+	utc(&b.CreatedDate, &b.UpdatedDate)
 
 	for _, plan := range Plans {
 		plan.Votes = make([]*Vote, 0)
 
 		e := d.db.QueryRow(
-			`INSERT INTO plans (battle_id, name, type, reference_id, link, description, acceptance_criteria) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+			`INSERT INTO plans (battle_id, name, type, reference_id, link, description, acceptance_criteria) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_date, updated_date`,
 			b.BattleID,
 			plan.PlanName,
 			plan.Type,
@@ -47,19 +60,81 @@ func (d *Database) CreateBattle(LeaderID string, BattleName string, PointValuesA
 			plan.Link,
 			plan.Description,
 			plan.AcceptanceCriteria,
-		).Scan(&plan.PlanID)
+		).Scan(&plan.PlanID, &plan.CreatedDate, &plan.UpdatedDate)
 		if e != nil {
 			log.Println(e)
 		}
+		utc(&plan.CreatedDate, &plan.UpdatedDate)
 	}
 
 	b.Plans = Plans
+	if TeamID != "" {
+		b.Checklist = d.GetTeamChecklist(TeamID)
+	}
 
 	return b, nil
 }
 
-// ReviseBattle updates the battle by ID
-func (d *Database) ReviseBattle(BattleID string, warriorID string, BattleName string, PointValuesAllowed []string, AutoFinishVoting bool) error {
+// ImportBattleResults carries the points, skipped state, split and translations of an imported battle's plans, created
+// with CreateBattle, over along with the plans they were split from and its notes
+func (d *Database) ImportBattleResults(BattleID string, Plans []*Plan, Notes string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to import battle results")
+	}
+	defer tx.Rollback()
+
+	for _, plan := range Plans {
+		if plan.PlanID == "" {
+			continue
+		}
+		translations, _ := json.Marshal(plan.Translations)
+		if plan.Translations == nil {
+			translations = []byte("{}")
+		}
+		if _, err := tx.Exec(
+			`UPDATE plans SET points = $3, skipped = $4, translations = $5::JSONB, split = $6,
+			parent_id = (SELECT pp.id FROM plans pp WHERE pp.battle_id = $2 AND pp.id <> $1 AND pp.id::TEXT = $7)
+			WHERE id = $1 AND battle_id = $2`,
+			plan.PlanID, BattleID, plan.Points, plan.PlanSkipped, string(translations), plan.Split, plan.ParentID,
+		); err != nil {
+			log.Println(err)
+			return errors.New("unable to import battle results")
+		}
+		if len(plan.DependsOn) > 0 {
+			if _, err := tx.Exec(
+				`INSERT INTO plan_dependencies (plan_id, depends_on_id)
+				SELECT $1, dp.id FROM plans dp WHERE dp.battle_id = $2 AND dp.id <> $1 AND dp.id = ANY($3::UUID[])
+				ON CONFLICT DO NOTHING`,
+				plan.PlanID, BattleID, pq.Array(plan.DependsOn),
+			); err != nil {
+				log.Println(err)
+				return errors.New("unable to import battle results")
+			}
+		}
+	}
+
+	if Notes != "" {
+		if _, err := tx.Exec(
+			`UPDATE battles SET notes = $2, notes_version = notes_version + 1 WHERE id = $1`,
+			BattleID, Notes,
+		); err != nil {
+			log.Println(err)
+			return errors.New("unable to import battle results")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return errors.New("unable to import battle results")
+	}
+
+	return nil
+}
+
+// ReviseBattle updates the battle by ID, an empty Timezone or Locale keeps the current value
+func (d *Database) ReviseBattle(BattleID string, warriorID string, BattleName string, PointValuesAllowed []string, AutoFinishVoting bool, Timezone string, Locale string) error {
 	err := d.ConfirmLeader(BattleID, warriorID)
 	if err != nil {
 		return errors.New("incorrect permissions")
@@ -67,7 +142,10 @@ func (d *Database) ReviseBattle(BattleID string, warriorID string, BattleName st
 
 	var pointValuesJSON, _ = json.Marshal(PointValuesAllowed)
 	if _, err := d.db.Exec(
-		`UPDATE battles SET name = $2, point_values_allowed = $3, auto_finish_voting = $4 WHERE id = $1`, BattleID, BattleName, string(pointValuesJSON), AutoFinishVoting); err != nil {
+		`UPDATE battles
+		SET name = $2, point_values_allowed = $3, auto_finish_voting = $4,
+			timezone = COALESCE(NULLIF($5, ''), timezone), locale = COALESCE(NULLIF($6, ''), locale)
+		WHERE id = $1`, BattleID, BattleName, string(pointValuesJSON), AutoFinishVoting, Timezone, Locale); err != nil {
 		log.Println(err)
 		return errors.New("unable to revise battle")
 	}
@@ -87,13 +165,18 @@ func (d *Database) GetBattle(BattleID string, WarriorID string) (*Battle, error)
 		ActivePlanID:       "",
 		PointValuesAllowed: make([]string, 0),
 		AutoFinishVoting:   true,
+		Checklist:          make([]*ChecklistItem, 0),
+		Breakouts:          make([]*Breakout, 0),
+		Notes:              &BattleNotes{},
 	}
 
 	// get battle
 	var ActivePlanID sql.NullString
+	var TeamID sql.NullString
+	var ParentID sql.NullString
 	var pv string
 	e := d.db.QueryRow(
-		"SELECT id, name, leader_id, voting_locked, active_plan_id, point_values_allowed, auto_finish_voting FROM battles WHERE id = $1",
+		"SELECT id, name, leader_id, voting_locked, active_plan_id, point_values_allowed, auto_finish_voting, timezone, locale, team_id, require_ready, dot_budget, parent_id, notes, notes_version, created_date, updated_date FROM battles WHERE id = $1",
 		BattleID,
 	).Scan(
 		&b.BattleID,
@@ -103,31 +186,132 @@ func (d *Database) GetBattle(BattleID string, WarriorID string) (*Battle, error)
 		&ActivePlanID,
 		&pv,
 		&b.AutoFinishVoting,
+		&b.Timezone,
+		&b.Locale,
+		&TeamID,
+		&b.RequireReady,
+		&b.DotBudget,
+		&ParentID,
+		&b.Notes.Notes,
+		&b.Notes.Version,
+		&b.CreatedDate,
+		&b.UpdatedDate,
 	)
 	if e != nil {
 		log.Println(e)
 		return nil, errors.New("not found")
 	}
+	utc(&b.CreatedDate, &b.UpdatedDate)
 
 	_ = json.Unmarshal([]byte(pv), &b.PointValuesAllowed)
 	b.ActivePlanID = ActivePlanID.String
+	b.TeamID = TeamID.String
+	b.ParentID = ParentID.String
+	b.Breakouts = d.GetBreakouts(BattleID)
+	if b.TeamID != "" {
+		b.Checklist = d.GetTeamChecklist(b.TeamID)
+	}
 	b.Warriors = d.GetBattleWarriors(BattleID)
 	b.Plans = d.GetPlans(BattleID, WarriorID)
+	b.PlanCount = len(b.Plans)
+	b.Confidence, _ = d.GetBattleConfidence(BattleID)
+	b.RaisedHands = d.GetRaisedHands(BattleID)
 
 	return b, nil
 }
 
-// GetBattlesByWarrior gets a list of battles by WarriorID
-func (d *Database) GetBattlesByWarrior(WarriorID string) ([]*Battle, error) {
+// GetBattleState gets the compact state of a battle the warrior is in
+func (d *Database) GetBattleState(BattleID string, WarriorID string) (*BattleState, error) {
+	if !d.IsBattleWarrior(BattleID, WarriorID) {
+		return nil, errors.New("warrior not in battle")
+	}
+
+	var bs = &BattleState{PointValuesAllowed: make([]string, 0)}
+	var pv string
+	var PlanID, PlanName, PlanType, ReferenceID, Link, Points sql.NullString
+	e := d.db.QueryRow(
+		`SELECT b.id, b.name, b.voting_locked, b.point_values_allowed,
+			p.id, p.name, p.type, p.reference_id, p.link, p.points,
+			coalesce(p.votes @> jsonb_build_array(jsonb_build_object('warriorId', $2::TEXT)), false)
+		FROM battles b
+		LEFT JOIN plans p ON p.id = b.active_plan_id
+		WHERE b.id = $1`,
+		BattleID,
+		WarriorID,
+	).Scan(
+		&bs.BattleID,
+		&bs.BattleName,
+		&bs.VotingLocked,
+		&pv,
+		&PlanID,
+		&PlanName,
+		&PlanType,
+		&ReferenceID,
+		&Link,
+		&Points,
+		&bs.Voted,
+	)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("not found")
+	}
+
+	_ = json.Unmarshal([]byte(pv), &bs.PointValuesAllowed)
+	if PlanID.Valid {
+		bs.ActivePlan = &BattleStatePlan{
+			PlanID:      PlanID.String,
+			PlanName:    PlanName.String,
+			Type:        PlanType.String,
+			ReferenceID: ReferenceID.String,
+			Link:        Link.String,
+			Points:      Points.String,
+		}
+	}
+
+	return bs, nil
+}
+
+// SetBattleRequireReady sets whether plans must meet the teams Definition of Ready before voting
+func (d *Database) SetBattleRequireReady(BattleID string, warriorID string, RequireReady bool) error {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE battles SET updated_date = NOW(), require_ready = $2 WHERE id = $1`, BattleID, RequireReady); err != nil {
+		log.Println(err)
+		return errors.New("unable to update battle")
+	}
+
+	return nil
+}
+
+// GetBattlesByWarrior gets a list of battles by WarriorID narrowed down by the filter
+func (d *Database) GetBattlesByWarrior(WarriorID string, Filter *BattleFilter) ([]*Battle, error) {
 	var battles = make([]*Battle, 0)
 	battleRows, battlesErr := d.db.Query(`
-		SELECT b.id, b.name, b.leader_id, b.voting_locked, b.active_plan_id, b.point_values_allowed, b.auto_finish_voting,
-		CASE WHEN COUNT(p) = 0 THEN '[]'::json ELSE array_to_json(array_agg(row_to_json(p))) END AS plans
+		SELECT b.id, b.name, b.leader_id, b.voting_locked, b.active_plan_id, b.point_values_allowed, b.auto_finish_voting, b.timezone, b.locale, bw.starred,
+		b.created_date, b.updated_date,
+		CASE WHEN COUNT(p) = 0 THEN '[]'::json ELSE array_to_json(array_agg(
+			to_jsonb(p) || jsonb_build_object('createdDate', p.created_date, 'updatedDate', p.updated_date)
+		)) END AS plans
 		FROM battles b
 		LEFT JOIN plans p ON b.id = p.battle_id
 		LEFT JOIN battles_warriors bw ON b.id = bw.battle_id WHERE bw.warrior_id = $1 AND bw.abandoned = false
-		GROUP BY b.id ORDER BY b.created_date DESC
-	`, WarriorID)
+		AND ($2 = '' OR b.name ILIKE '%' || $2 || '%')
+		AND CASE $3
+			WHEN 'voting' THEN b.active_plan_id IS NOT NULL AND NOT b.voting_locked
+			WHEN 'completed' THEN EXISTS(SELECT 1 FROM plans cp WHERE cp.battle_id = b.id)
+				AND NOT EXISTS(SELECT 1 FROM plans cp WHERE cp.battle_id = b.id AND cp.points = '' AND NOT coalesce(cp.skipped, false))
+			WHEN 'active' THEN NOT EXISTS(SELECT 1 FROM plans cp WHERE cp.battle_id = b.id)
+				OR EXISTS(SELECT 1 FROM plans cp WHERE cp.battle_id = b.id AND cp.points = '' AND NOT coalesce(cp.skipped, false))
+			ELSE true END
+		AND ($4::TIMESTAMPTZ IS NULL OR b.created_date >= $4)
+		AND ($5::TIMESTAMPTZ IS NULL OR b.created_date < $5)
+		AND ($6 = '' OR ($6 = 'owned') = (b.leader_id = $1))
+		GROUP BY b.id, bw.starred ORDER BY b.created_date DESC
+	`, WarriorID, likeEscaper.Replace(Filter.Search), Filter.Status, Filter.CreatedFrom, Filter.CreatedTo, Filter.Role)
 	if battlesErr != nil {
 		return nil, errors.New("not found")
 	}
@@ -156,11 +340,21 @@ func (d *Database) GetBattlesByWarrior(WarriorID string) ([]*Battle, error) {
 			&ActivePlanID,
 			&pv,
 			&b.AutoFinishVoting,
+			&b.Timezone,
+			&b.Locale,
+			&b.Starred,
+			&b.CreatedDate,
+			&b.UpdatedDate,
 			&plans,
 		); err != nil {
 			log.Println(err)
 		} else {
 			_ = json.Unmarshal([]byte(plans), &b.Plans)
+			utc(&b.CreatedDate, &b.UpdatedDate)
+			for _, p := range b.Plans {
+				utc(&p.CreatedDate, &p.UpdatedDate)
+				utcVotes(p.Votes)
+			}
 			_ = json.Unmarshal([]byte(pv), &b.PointValuesAllowed)
 			b.ActivePlanID = ActivePlanID.String
 			battles = append(battles, b)
@@ -170,7 +364,25 @@ func (d *Database) GetBattlesByWarrior(WarriorID string) ([]*Battle, error) {
 	return battles, nil
 }
 
+// SetBattleStarred stars or unstars the battle in the warriors list of battles
+func (d *Database) SetBattleStarred(BattleID string, WarriorID string, Starred bool) error {
+	res, err := d.db.Exec(
+		`UPDATE battles_warriors SET starred = $3 WHERE battle_id = $1 AND warrior_id = $2 AND abandoned = false`,
+		BattleID, WarriorID, Starred,
+	)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to star battle")
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return errors.New("not found")
+	}
+
+	return nil
+}
+
 // ConfirmLeader confirms the warrior is infact leader of the battle
+// bots registered to the battle act on behalf of the leader and are also confirmed
 func (d *Database) ConfirmLeader(BattleID string, warriorID string) error {
 	var leaderID string
 	e := d.db.QueryRow("SELECT leader_id FROM battles WHERE id = $1", BattleID).Scan(&leaderID)
@@ -218,6 +430,21 @@ func (d *Database) GetBattleWarrior(BattleID string, WarriorID string) (*BattleW
 	return &w, nil
 }
 
+// IsBattleWarrior checks whether the warrior has joined the battle
+func (d *Database) IsBattleWarrior(BattleID string, WarriorID string) bool {
+	var participant bool
+	e := d.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM battles_warriors WHERE battle_id = $1 AND warrior_id = $2)`,
+		BattleID, WarriorID,
+	).Scan(&participant)
+	if e != nil {
+		log.Println(e)
+		return false
+	}
+
+	return participant
+}
+
 // GetBattleWarriors retrieves the warriors for a given battle from db
 func (d *Database) GetBattleWarriors(BattleID string) []*BattleWarrior {
 	var warriors = make([]*BattleWarrior, 0)
@@ -246,6 +473,7 @@ func (d *Database) GetBattleWarriors(BattleID string) []*BattleWarrior {
 }
 
 // GetBattleActiveWarriors retrieves the active warriors for a given battle from db
+// excluding bots as they never count toward voting quorum
 func (d *Database) GetBattleActiveWarriors(BattleID string) []*BattleWarrior {
 	var warriors = make([]*BattleWarrior, 0)
 	rows, err := d.db.Query(
@@ -253,7 +481,7 @@ func (d *Database) GetBattleActiveWarriors(BattleID string) []*BattleWarrior {
 			w.id, w.name, w.rank, w.avatar, bw.active
 		FROM battles_warriors bw
 		LEFT JOIN warriors w ON bw.warrior_id = w.id
-		WHERE bw.battle_id = $1 AND bw.active = true
+		WHERE bw.battle_id = $1 AND bw.active = true AND w.rank != 'BOT'
 		ORDER BY w.name`,
 		BattleID,
 	)
@@ -289,6 +517,24 @@ func (d *Database) AddWarriorToBattle(BattleID string, WarriorID string) ([]*Bat
 	return warriors, nil
 }
 
+// EnlistWarrior adds the warrior to the battle without marking them active, for participants that
+// aren't connected over the websocket, reporting whether they weren't in the battle before
+func (d *Database) EnlistWarrior(BattleID string, WarriorID string) bool {
+	res, err := d.db.Exec(
+		`INSERT INTO battles_warriors (battle_id, warrior_id, active) VALUES ($1, $2, false)
+		ON CONFLICT (battle_id, warrior_id) DO NOTHING`,
+		BattleID,
+		WarriorID,
+	)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	enlisted, _ := res.RowsAffected()
+
+	return enlisted > 0
+}
+
 // RetreatWarrior removes a warrior from the current battle by ID
 func (d *Database) RetreatWarrior(BattleID string, WarriorID string) []*BattleWarrior {
 	if _, err := d.db.Exec(
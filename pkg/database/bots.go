@@ -0,0 +1,122 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// CreateBattleBot adds a new bot warrior to the battle and generates its API key
+func (d *Database) CreateBattleBot(BattleID string, LeaderID string, BotName string) (*Warrior, *APIKey, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, nil, errors.New("incorrect permissions")
+	}
+
+	var bot = &Warrior{
+		WarriorName:   BotName,
+		WarriorRank:   "BOT",
+		WarriorAvatar: "identicon",
+		Verified:      true,
+	}
+
+	e := d.db.QueryRow(
+		`INSERT INTO warriors (name, rank, verified, notifications_enabled) VALUES ($1, $2, true, false) RETURNING id, created_date, updated_date`,
+		BotName,
+		bot.WarriorRank,
+	).Scan(&bot.WarriorID, &bot.CreatedDate, &bot.UpdatedDate)
+	if e != nil {
+		log.Println(e)
+		return nil, nil, errors.New("unable to create battle bot")
+	}
+	utc(&bot.CreatedDate, &bot.UpdatedDate)
+
+	if _, err := d.db.Exec(
+		`INSERT INTO battles_warriors (battle_id, warrior_id, active) VALUES ($1, $2, false)`,
+		BattleID,
+		bot.WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, nil, errors.New("unable to add bot to battle")
+	}
+
+	APIKey, keyErr := d.GenerateAPIKey(bot.WarriorID, BotName)
+	if keyErr != nil {
+		return nil, nil, keyErr
+	}
+
+	return bot, APIKey, nil
+}
+
+// GetBattleBots retrieves the bots registered to a battle
+func (d *Database) GetBattleBots(BattleID string) []*BattleWarrior {
+	var bots = make([]*BattleWarrior, 0)
+	rows, err := d.db.Query(
+		`SELECT
+			w.id, w.name, w.rank, w.avatar, bw.active
+		FROM battles_warriors bw
+		LEFT JOIN warriors w ON bw.warrior_id = w.id
+		WHERE bw.battle_id = $1 AND w.rank = 'BOT'
+		ORDER BY w.name`,
+		BattleID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var w BattleWarrior
+			if err := rows.Scan(&w.WarriorID, &w.WarriorName, &w.WarriorRank, &w.WarriorAvatar, &w.Active); err != nil {
+				log.Println(err)
+			} else {
+				bots = append(bots, &w)
+			}
+		}
+	}
+
+	return bots
+}
+
+// confirmPlanDriver confirms the warrior leads the battle or is one of its bots, bots co-drive the battle's plans but
+// nothing else the leader does
+func (d *Database) confirmPlanDriver(BattleID string, WarriorID string) error {
+	if err := d.ConfirmLeader(BattleID, WarriorID); err != nil && !d.IsBattleBot(BattleID, WarriorID) {
+		return err
+	}
+
+	return nil
+}
+
+// IsBattleBot checks whether the warrior is a bot registered to the battle
+func (d *Database) IsBattleBot(BattleID string, WarriorID string) bool {
+	var isBot bool
+	e := d.db.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM battles_warriors bw
+			JOIN warriors w ON w.id = bw.warrior_id
+			WHERE bw.battle_id = $1 AND bw.warrior_id = $2 AND w.rank = 'BOT'
+		)`,
+		BattleID,
+		WarriorID,
+	).Scan(&isBot)
+	if e != nil {
+		log.Println(e)
+		return false
+	}
+
+	return isBot
+}
+
+// DeleteBattleBot removes a bot and its API keys from the battle
+func (d *Database) DeleteBattleBot(BattleID string, LeaderID string, BotID string) error {
+	var leaderID string
+	e := d.db.QueryRow("SELECT leader_id FROM battles WHERE id = $1", BattleID).Scan(&leaderID)
+	if e != nil || leaderID != LeaderID {
+		return errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`call delete_battle_bot($1, $2);`, BattleID, BotID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete battle bot")
+	}
+
+	return nil
+}
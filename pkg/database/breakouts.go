@@ -0,0 +1,113 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// CreateBreakouts splits the battle into breakout battles each estimating a subset of its plans, led by warriors
+// of the battle
+func (d *Database) CreateBreakouts(BattleID string, warriorID string, Breakouts []*Breakout) ([]*Breakout, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create breakout")
+	}
+	defer tx.Rollback()
+
+	var ParentID string
+	e := tx.QueryRow(`SELECT coalesce(parent_id::TEXT, '') FROM battles WHERE id = $1`, BattleID).Scan(&ParentID)
+	if e != nil || ParentID != "" {
+		return nil, errors.New("breakouts can not be nested")
+	}
+
+	for _, breakout := range Breakouts {
+		newID, _ := uuid.NewUUID()
+		breakout.BattleID = newID.String()
+		if breakout.LeaderID == "" {
+			breakout.LeaderID = warriorID
+		}
+
+		var Joined bool
+		if err := tx.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM battles_warriors WHERE battle_id = $1 AND warrior_id::TEXT = $2 AND NOT abandoned)`,
+			BattleID, breakout.LeaderID,
+		).Scan(&Joined); err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to create breakout")
+		}
+		if !Joined {
+			return nil, errors.New("breakout leader not in battle")
+		}
+
+		if _, err := tx.Exec(
+			`call create_breakout($1, $2, $3, $4, $5);`,
+			BattleID, breakout.BattleID, breakout.Name, breakout.LeaderID, pq.Array(breakout.PlanIDs),
+		); err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to create breakout")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create breakout")
+	}
+
+	return d.GetBreakouts(BattleID), nil
+}
+
+// GetBreakouts gets the breakout battles of a battle along with their plans
+func (d *Database) GetBreakouts(BattleID string) []*Breakout {
+	var breakouts = make([]*Breakout, 0)
+	rows, err := d.db.Query(
+		`SELECT b.id, b.name, b.leader_id,
+			coalesce(json_agg(p.id) FILTER (WHERE p.id IS NOT NULL), '[]'::json)
+		FROM battles b
+		LEFT JOIN plans p ON p.battle_id = b.id
+		WHERE b.parent_id = $1
+		GROUP BY b.id
+		ORDER BY b.created_date`,
+		BattleID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var b Breakout
+			var planIDs string
+			if err := rows.Scan(&b.BattleID, &b.Name, &b.LeaderID, &planIDs); err != nil {
+				log.Println(err)
+			} else {
+				_ = json.Unmarshal([]byte(planIDs), &b.PlanIDs)
+				breakouts = append(breakouts, &b)
+			}
+		}
+	}
+
+	return breakouts
+}
+
+// MergeBreakouts moves the breakout battles plans and their results back into the parent battle
+func (d *Database) MergeBreakouts(BattleID string, warriorID string) ([]*Plan, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`call merge_breakouts($1);`, BattleID); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to merge breakouts")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
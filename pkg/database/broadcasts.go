@@ -0,0 +1,172 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// CreateEmailBroadcast queues the announcement for every registered warrior, or the members of the team when
+// TeamID is set, leaving out warriors who turned announcement emails or notifications off
+func (d *Database) CreateEmailBroadcast(CreatedBy string, Subject string, Body string, TeamID string) (*EmailBroadcast, error) {
+	b := &EmailBroadcast{Subject: Subject, Body: Body, TeamID: TeamID, CreatedBy: CreatedBy}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create email broadcast")
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(
+		`INSERT INTO email_broadcasts (subject, body, team_id, created_by) VALUES ($1, $2, NULLIF($3, '')::UUID, $4)
+		RETURNING id, created_date`,
+		Subject, Body, TeamID, CreatedBy,
+	).Scan(&b.BroadcastID, &b.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create email broadcast")
+	}
+
+	if err := tx.QueryRow(
+		`WITH audience AS (
+			SELECT w.id, coalesce(warrior_notifies(w.id, 'announcements', 'email'), false) AS notifies FROM warriors w
+			WHERE w.email IS NOT NULL AND w.email <> ''
+			AND ($2 = '' OR w.id IN (SELECT tw.warrior_id FROM team_warriors tw WHERE tw.team_id::TEXT = $2))
+		), queued AS (
+			INSERT INTO email_broadcast_recipients (broadcast_id, warrior_id)
+			SELECT $1, a.id FROM audience a WHERE a.notifies
+			RETURNING 1
+		)
+		SELECT (SELECT count(*) FROM queued), (SELECT count(*) FROM audience WHERE NOT notifies)`,
+		b.BroadcastID, TeamID,
+	).Scan(&b.Recipients, &b.Skipped); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create email broadcast")
+	}
+
+	if _, err := tx.Exec(`UPDATE email_broadcasts SET skipped = $2 WHERE id = $1`, b.BroadcastID, b.Skipped); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create email broadcast")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create email broadcast")
+	}
+
+	return b, nil
+}
+
+// ProcessEmailBroadcasts emails queued broadcasts to up to Limit recipients, those that failed MaxAttempts times are
+// given up on and warriors who turned announcements off since the broadcast was queued are skipped
+func (d *Database) ProcessEmailBroadcasts(Limit int, MaxAttempts int, send func(*BroadcastEmail) error) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("unable to process email broadcasts")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`WITH opted_out AS (
+			DELETE FROM email_broadcast_recipients r
+			WHERE r.sent_date IS NULL AND NOT coalesce(warrior_notifies(r.warrior_id, 'announcements', 'email'), false)
+			RETURNING r.broadcast_id
+		)
+		UPDATE email_broadcasts b SET skipped = b.skipped + o.count
+		FROM (SELECT broadcast_id, count(*) FROM opted_out GROUP BY broadcast_id) o
+		WHERE b.id = o.broadcast_id`,
+	); err != nil {
+		log.Println(err)
+		return 0, errors.New("unable to process email broadcasts")
+	}
+
+	rows, err := tx.Query(
+		`SELECT r.broadcast_id, r.warrior_id, w.name, w.email, b.subject, b.body
+		FROM email_broadcast_recipients r
+		JOIN email_broadcasts b ON b.id = r.broadcast_id
+		JOIN warriors w ON w.id = r.warrior_id
+		WHERE r.sent_date IS NULL AND r.attempts < $2
+		ORDER BY b.created_date
+		LIMIT $1
+		FOR UPDATE OF r SKIP LOCKED`,
+		Limit,
+		MaxAttempts,
+	)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("unable to process email broadcasts")
+	}
+
+	var emails = make([]*BroadcastEmail, 0)
+	for rows.Next() {
+		var e BroadcastEmail
+		if err := rows.Scan(&e.BroadcastID, &e.WarriorID, &e.WarriorName, &e.WarriorEmail, &e.Subject, &e.Body); err != nil {
+			log.Println(err)
+		} else {
+			emails = append(emails, &e)
+		}
+	}
+	rows.Close()
+
+	for _, e := range emails {
+		if sendErr := send(e); sendErr != nil {
+			if _, err := tx.Exec(
+				`UPDATE email_broadcast_recipients SET attempts = attempts + 1, last_error = $3
+				WHERE broadcast_id = $1 AND warrior_id = $2;`,
+				e.BroadcastID, e.WarriorID, sendErr.Error(),
+			); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE email_broadcast_recipients SET attempts = attempts + 1, sent_date = NOW()
+			WHERE broadcast_id = $1 AND warrior_id = $2;`,
+			e.BroadcastID, e.WarriorID,
+		); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return 0, errors.New("unable to process email broadcasts")
+	}
+
+	return len(emails), nil
+}
+
+// GetEmailBroadcasts gets the most recent broadcasts with how far their sending got, newest first
+func (d *Database) GetEmailBroadcasts(MaxAttempts int, Limit int, Offset int) ([]*EmailBroadcast, error) {
+	var broadcasts = make([]*EmailBroadcast, 0)
+	rows, err := d.db.Query(
+		`SELECT b.id, b.subject, b.body, coalesce(b.team_id::TEXT, ''), coalesce(b.created_by::TEXT, ''), b.skipped, b.created_date,
+			count(r.warrior_id), count(r.sent_date), count(*) FILTER (WHERE r.sent_date IS NULL AND r.attempts >= $1)
+		FROM email_broadcasts b
+		LEFT JOIN email_broadcast_recipients r ON r.broadcast_id = b.id
+		GROUP BY b.id
+		ORDER BY b.created_date DESC
+		LIMIT $2 OFFSET $3`,
+		MaxAttempts, Limit, Offset,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get email broadcasts")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b EmailBroadcast
+		if err := rows.Scan(
+			&b.BroadcastID, &b.Subject, &b.Body, &b.TeamID, &b.CreatedBy, &b.Skipped, &b.CreatedDate,
+			&b.Recipients, &b.Sent, &b.Failed,
+		); err != nil {
+			log.Println(err)
+		} else {
+			broadcasts = append(broadcasts, &b)
+		}
+	}
+
+	return broadcasts, nil
+}
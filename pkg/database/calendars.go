@@ -0,0 +1,250 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// TeamCalendar is the calendar a team admin connected the team's recurring battles are booked in
+type TeamCalendar struct {
+	TeamID       string    `json:"teamId"`
+	Provider     string    `json:"provider"`
+	AccessToken  string    `json:"-"`
+	RefreshToken string    `json:"-"`
+	Expiry       time.Time `json:"-"`
+	// ConnectedBy is the admin who connected the calendar, leading the battles opened for its events
+	ConnectedBy string    `json:"connectedBy"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+// CalendarSlot is an occurrence of a team's recurring battle booked in the team's calendar, times are stored in UTC
+type CalendarSlot struct {
+	ScheduleID string    `json:"scheduleId"`
+	TeamID     string    `json:"teamId"`
+	Name       string    `json:"name"`
+	StartTime  time.Time `json:"startTime"`
+	EventID    string    `json:"eventId"`
+	// BattleID is the battle opened for the slot, empty until it opens or once its battle is deleted
+	BattleID string `json:"battleId"`
+	// Opened is whether a battle was ever opened for the slot, so a deleted one isn't opened again
+	Opened bool `json:"opened"`
+	// LeaderID is who connected the team's calendar, leading the battle
+	LeaderID string `json:"leaderId"`
+	// Timezone is the time zone of the recurring battle, given to the battle opened for the slot
+	Timezone string `json:"timezone"`
+}
+
+// getTeamCalendars gets the connected calendar of the team, or of every team when no team is given
+func (d *Database) getTeamCalendars(TeamID string) ([]*TeamCalendar, error) {
+	var calendars = make([]*TeamCalendar, 0)
+	rows, err := d.db.Query(
+		`SELECT team_id, provider, access_token, refresh_token, expiry, connected_by, created_date FROM team_calendars
+		WHERE $1 = '' OR team_id::TEXT = $1`,
+		TeamID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get calendars")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c TeamCalendar
+		if err := rows.Scan(&c.TeamID, &c.Provider, &c.AccessToken, &c.RefreshToken, &c.Expiry, &c.ConnectedBy, &c.CreatedDate); err != nil {
+			log.Println(err)
+			continue
+		}
+		if c.AccessToken, err = d.secrets.Decrypt(c.AccessToken); err != nil {
+			log.Println(err)
+			continue
+		}
+		if c.RefreshToken, err = d.secrets.Decrypt(c.RefreshToken); err != nil {
+			log.Println(err)
+			continue
+		}
+		calendars = append(calendars, &c)
+	}
+
+	return calendars, nil
+}
+
+// GetTeamCalendar gets the team's connected calendar, nil when the team hasn't connected one
+func (d *Database) GetTeamCalendar(TeamID string) (*TeamCalendar, error) {
+	calendars, err := d.getTeamCalendars(TeamID)
+	if err != nil || len(calendars) == 0 {
+		return nil, err
+	}
+
+	return calendars[0], nil
+}
+
+// GetTeamCalendars gets every team's connected calendar
+func (d *Database) GetTeamCalendars() ([]*TeamCalendar, error) {
+	return d.getTeamCalendars("")
+}
+
+// SetTeamCalendar saves the team's calendar tokens, replacing any calendar connected before
+func (d *Database) SetTeamCalendar(c *TeamCalendar) error {
+	AccessToken, err := d.secrets.Encrypt(c.AccessToken)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to save calendar")
+	}
+	RefreshToken, err := d.secrets.Encrypt(c.RefreshToken)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to save calendar")
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO team_calendars (team_id, provider, access_token, refresh_token, expiry, connected_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (team_id) DO UPDATE SET
+			provider = EXCLUDED.provider,
+			access_token = EXCLUDED.access_token,
+			refresh_token = EXCLUDED.refresh_token,
+			expiry = EXCLUDED.expiry,
+			connected_by = EXCLUDED.connected_by;`,
+		c.TeamID, c.Provider, AccessToken, RefreshToken, c.Expiry.UTC(), c.ConnectedBy,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to save calendar")
+	}
+
+	return nil
+}
+
+// DeleteTeamCalendar disconnects the team's calendar, its booked slots no longer open battles
+func (d *Database) DeleteTeamCalendar(TeamID string) error {
+	if _, err := d.db.Exec(`DELETE FROM team_calendars WHERE team_id = $1;`, TeamID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete calendar")
+	}
+
+	return nil
+}
+
+// CreateCalendarSlot reserves the occurrence of the recurring battle before its calendar event is created, false when
+// it was already reserved so the event is only ever created once
+func (d *Database) CreateCalendarSlot(ScheduleID string, TeamID string, StartTime time.Time) (bool, error) {
+	var Reserved bool
+	e := d.db.QueryRow(
+		`INSERT INTO calendar_slots (schedule_id, team_id, start_time, event_id) VALUES ($1, $2, $3, '')
+		ON CONFLICT (schedule_id, start_time) DO NOTHING
+		RETURNING true;`,
+		ScheduleID, TeamID, StartTime.UTC(),
+	).Scan(&Reserved)
+	if e == sql.ErrNoRows {
+		return false, nil
+	}
+	if e != nil {
+		log.Println(e)
+		return false, errors.New("unable to create calendar slot")
+	}
+
+	return Reserved, nil
+}
+
+// SetCalendarSlotEvent records the calendar event booked for the reserved slot
+func (d *Database) SetCalendarSlotEvent(ScheduleID string, StartTime time.Time, EventID string) error {
+	if _, err := d.db.Exec(
+		`UPDATE calendar_slots SET event_id = $3 WHERE schedule_id = $1 AND start_time = $2;`,
+		ScheduleID, StartTime.UTC(), EventID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to set calendar slot event")
+	}
+
+	return nil
+}
+
+// DeleteCalendarSlot releases the slot's reservation when its calendar event couldn't be created, so it's tried again
+func (d *Database) DeleteCalendarSlot(ScheduleID string, StartTime time.Time) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM calendar_slots WHERE schedule_id = $1 AND start_time = $2 AND event_id = '';`,
+		ScheduleID, StartTime.UTC(),
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete calendar slot")
+	}
+
+	return nil
+}
+
+// calendarSlotsQuery selects slots along with their recurring battle's name and time zone and the leader of their battle
+const calendarSlotsQuery = `SELECT cs.schedule_id, cs.team_id, tbs.name, cs.start_time, cs.event_id,
+	coalesce(cs.battle_id::TEXT, ''), cs.opened, tc.connected_by, tbs.timezone
+	FROM calendar_slots cs
+	JOIN team_battle_schedules tbs ON tbs.id = cs.schedule_id
+	JOIN team_calendars tc ON tc.team_id = cs.team_id`
+
+// GetCalendarSlot gets the booked occurrence of the recurring battle, nil when it isn't booked
+func (d *Database) GetCalendarSlot(ScheduleID string, StartTime time.Time) (*CalendarSlot, error) {
+	var cs CalendarSlot
+	e := d.db.QueryRow(
+		calendarSlotsQuery+` WHERE cs.schedule_id = $1 AND cs.start_time = $2`,
+		ScheduleID, StartTime.UTC(),
+	).Scan(&cs.ScheduleID, &cs.TeamID, &cs.Name, &cs.StartTime, &cs.EventID, &cs.BattleID, &cs.Opened, &cs.LeaderID, &cs.Timezone)
+	if e == sql.ErrNoRows {
+		return nil, nil
+	}
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to get calendar slot")
+	}
+
+	return &cs, nil
+}
+
+// GetDueCalendarSlots gets the booked slots started by the time that were never opened, those that started
+// over a day before are left alone
+func (d *Database) GetDueCalendarSlots(By time.Time) ([]*CalendarSlot, error) {
+	var slots = make([]*CalendarSlot, 0)
+	rows, err := d.db.Query(
+		calendarSlotsQuery+` WHERE NOT cs.opened AND cs.start_time <= $1 AND cs.start_time > $1 - INTERVAL '1 day'
+		ORDER BY cs.start_time`,
+		By.UTC(),
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get calendar slots")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cs CalendarSlot
+		if err := rows.Scan(&cs.ScheduleID, &cs.TeamID, &cs.Name, &cs.StartTime, &cs.EventID, &cs.BattleID, &cs.Opened, &cs.LeaderID, &cs.Timezone); err != nil {
+			log.Println(err)
+		} else {
+			slots = append(slots, &cs)
+		}
+	}
+
+	return slots, nil
+}
+
+// SetCalendarSlotBattle sets the battle opened for the slot unless one was already, getting the slot's battle which
+// is empty when the one opened before was deleted
+func (d *Database) SetCalendarSlotBattle(ScheduleID string, StartTime time.Time, BattleID string) (string, error) {
+	var SlotBattleID string
+	if err := d.db.QueryRow(
+		`WITH opened AS (
+			UPDATE calendar_slots SET battle_id = $3, opened = true
+			WHERE schedule_id = $1 AND start_time = $2 AND NOT opened
+			RETURNING battle_id
+		)
+		SELECT coalesce(
+			(SELECT battle_id::TEXT FROM opened),
+			(SELECT battle_id::TEXT FROM calendar_slots WHERE schedule_id = $1 AND start_time = $2),
+			''
+		);`,
+		ScheduleID, StartTime.UTC(), BattleID,
+	).Scan(&SlotBattleID); err != nil {
+		log.Println(err)
+		return "", errors.New("unable to set calendar slot battle")
+	}
+
+	return SlotBattleID, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// GetTeamChecklist gets the teams Definition of Ready checklist items
+func (d *Database) GetTeamChecklist(TeamID string) []*ChecklistItem {
+	var items = make([]*ChecklistItem, 0)
+	rows, err := d.db.Query(
+		`SELECT id, text, sort_order FROM team_checklist_items WHERE team_id = $1 ORDER BY sort_order, created_date`,
+		TeamID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var ci ChecklistItem
+			if err := rows.Scan(&ci.ItemID, &ci.Text, &ci.SortOrder); err != nil {
+				log.Println(err)
+			} else {
+				items = append(items, &ci)
+			}
+		}
+	}
+
+	return items
+}
+
+// AddTeamChecklistItem adds an item to the teams Definition of Ready checklist
+func (d *Database) AddTeamChecklistItem(TeamID string, Text string, SortOrder int) ([]*ChecklistItem, error) {
+	if _, err := d.db.Exec(
+		`INSERT INTO team_checklist_items (team_id, text, sort_order) VALUES ($1, $2, $3)`,
+		TeamID,
+		Text,
+		SortOrder,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add checklist item")
+	}
+
+	return d.GetTeamChecklist(TeamID), nil
+}
+
+// DeleteTeamChecklistItem removes an item from the teams Definition of Ready checklist
+func (d *Database) DeleteTeamChecklistItem(TeamID string, ItemID string) ([]*ChecklistItem, error) {
+	if _, err := d.db.Exec(
+		`DELETE FROM team_checklist_items WHERE id = $1 AND team_id = $2`,
+		ItemID,
+		TeamID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to delete checklist item")
+	}
+
+	return d.GetTeamChecklist(TeamID), nil
+}
+
+// CheckPlanChecklistItem ticks or unticks a Definition of Ready item on a battles plan
+func (d *Database) CheckPlanChecklistItem(BattleID string, WarriorID string, PlanID string, ItemID string, Checked bool) ([]*Plan, error) {
+	var err error
+	if Checked {
+		_, err = d.db.Exec(
+			`INSERT INTO plan_checklist (plan_id, item_id, warrior_id)
+			SELECT p.id, ci.id, $4
+			FROM plans p
+			JOIN battles b ON b.id = p.battle_id
+			JOIN team_checklist_items ci ON ci.team_id = b.team_id
+			WHERE p.id = $2 AND p.battle_id = $1 AND ci.id = $3
+			ON CONFLICT (plan_id, item_id) DO NOTHING`,
+			BattleID, PlanID, ItemID, WarriorID,
+		)
+	} else {
+		_, err = d.db.Exec(
+			`DELETE FROM plan_checklist pc USING plans p
+			WHERE pc.plan_id = p.id AND p.battle_id = $1 AND pc.plan_id = $2 AND pc.item_id = $3`,
+			BattleID, PlanID, ItemID,
+		)
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to update plan checklist")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
+// getPlanChecklists gets the ticked checklist item ids for each plan of the battle
+func (d *Database) getPlanChecklists(BattleID string) map[string][]string {
+	checked := make(map[string][]string)
+	rows, err := d.db.Query(
+		`SELECT pc.plan_id, pc.item_id FROM plan_checklist pc
+		JOIN plans p ON p.id = pc.plan_id
+		WHERE p.battle_id = $1`,
+		BattleID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var PlanID, ItemID string
+			if err := rows.Scan(&PlanID, &ItemID); err != nil {
+				log.Println(err)
+			} else {
+				checked[PlanID] = append(checked[PlanID], ItemID)
+			}
+		}
+	}
+
+	return checked
+}
+
+// confirmPlanReady confirms every checklist item has been ticked for the plan
+// when the battle requires plans to meet the Definition of Ready before voting
+func (d *Database) confirmPlanReady(BattleID string, PlanID string) error {
+	var missing int
+	e := d.db.QueryRow(
+		`SELECT COUNT(ci.id)
+		FROM battles b
+		JOIN team_checklist_items ci ON ci.team_id = b.team_id
+		LEFT JOIN plan_checklist pc ON pc.item_id = ci.id AND pc.plan_id = $2
+		WHERE b.id = $1 AND b.require_ready = true AND pc.plan_id IS NULL`,
+		BattleID,
+		PlanID,
+	).Scan(&missing)
+	if e != nil {
+		log.Println(e)
+		return errors.New("unable to confirm plan is ready")
+	}
+
+	if missing > 0 {
+		return errors.New("plan does not meet the definition of ready")
+	}
+
+	return nil
+}
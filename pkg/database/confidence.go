@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// GetBattleConfidence gets the battles fist of five confidence round results
+func (d *Database) GetBattleConfidence(BattleID string) (*Confidence, error) {
+	var c = &Confidence{
+		Votes: make([]*ConfidenceVote, 0),
+	}
+
+	e := d.db.QueryRow(
+		`SELECT confidence_open FROM battles WHERE id = $1`, BattleID,
+	).Scan(&c.Open)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("battle not found")
+	}
+
+	rows, err := d.db.Query(
+		`SELECT warrior_id, confidence FROM battle_confidence WHERE battle_id = $1 ORDER BY created_date`,
+		BattleID,
+	)
+	if err == nil {
+		defer rows.Close()
+		total := 0
+		for rows.Next() {
+			var cv ConfidenceVote
+			if err := rows.Scan(&cv.WarriorID, &cv.Confidence); err != nil {
+				log.Println(err)
+			} else {
+				total += cv.Confidence
+				c.Votes = append(c.Votes, &cv)
+			}
+		}
+		if len(c.Votes) > 0 {
+			c.Average = float64(total) / float64(len(c.Votes))
+		}
+	}
+
+	return c, nil
+}
+
+// SetBattleConfidenceOpen opens or closes the battles confidence round, opening clears previous votes
+func (d *Database) SetBattleConfidenceOpen(BattleID string, warriorID string, Open bool) (*Confidence, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if Open {
+		if _, err := d.db.Exec(
+			`DELETE FROM battle_confidence WHERE battle_id = $1`, BattleID); err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to reset confidence round")
+		}
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE battles SET updated_date = NOW(), confidence_open = $2 WHERE id = $1`, BattleID, Open); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to update confidence round")
+	}
+
+	return d.GetBattleConfidence(BattleID)
+}
+
+// SetConfidenceVote sets the warriors fist of five confidence vote while the round is open
+func (d *Database) SetConfidenceVote(BattleID string, WarriorID string, Confidence int) (*Confidence, error) {
+	if Confidence < 1 || Confidence > 5 {
+		return nil, errors.New("confidence must be between 1 and 5")
+	}
+
+	res, err := d.db.Exec(
+		`INSERT INTO battle_confidence (battle_id, warrior_id, confidence)
+		SELECT id, $2, $3 FROM battles WHERE id = $1 AND confidence_open = true
+		ON CONFLICT (battle_id, warrior_id) DO UPDATE SET confidence = $3, created_date = NOW()`,
+		BattleID, WarriorID, Confidence,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to set confidence vote")
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return nil, errors.New("confidence round not open")
+	}
+
+	return d.GetBattleConfidence(BattleID)
+}
@@ -1,50 +1,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/secrets"
 	_ "github.com/lib/pq" // necessary for postgres
 	"github.com/spf13/viper"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// HashAndSalt takes a password byte and salt + hashes it
-// returning a hash string to store in db
-func HashAndSalt(pwd []byte) (string, error) {
-	// Use GenerateFromPassword to hash & salt pwd.
-	// MinCost is just an integer constant provided by the bcrypt
-	// package along with DefaultCost & MaxCost.
-	// The cost can be any value you want provided it isn't lower
-	// than the MinCost (4)
-	hash, err := bcrypt.GenerateFromPassword(pwd, bcrypt.MinCost)
-	if err != nil {
-		log.Println(err)
-		return "", err
-	}
-	// GenerateFromPassword returns a byte slice so we need to
-	// convert the bytes to a string and return it
-	return string(hash), nil
-}
-
-// ComparePasswords takes a password hash and compares it to entered password bytes
-// returning true if matches false if not
-func ComparePasswords(hashedPwd string, plainPwd []byte) bool {
-	// Since we'll be getting the hashed password from the DB it
-	// will be a string so we'll need to convert it to a byte slice
-	byteHash := []byte(hashedPwd)
-	err := bcrypt.CompareHashAndPassword(byteHash, plainPwd)
-	if err != nil {
-		log.Println(err)
-		return false
-	}
-
-	return true
-}
-
 // GetEnv gets environment variable matching key string
 // and if it finds none uses fallback string
 // returning either the matching or fallback string
@@ -86,6 +56,13 @@ func GetBoolEnv(key string, fallback bool) bool {
 	return boolResult
 }
 
+// utc moves the dates to UTC, the database returns them in its own time zone and they're sent as RFC3339 UTC
+func utc(Dates ...*time.Time) {
+	for _, Date := range Dates {
+		*Date = Date.UTC()
+	}
+}
+
 // New runs db migrations, sets up a db connection pool
 // and sets previously active warriors to false during startup
 func New(AdminEmail string, schemaSQL string) *Database {
@@ -111,6 +88,27 @@ func New(AdminEmail string, schemaSQL string) *Database {
 		d.config.sslmode,
 	)
 
+	// credentials of integrations are encrypted with the first key, the others decrypt what was stored before a rotation
+	var Keys []string
+	for _, k := range strings.Split(viper.GetString("config.encryption_keys"), ",") {
+		if strings.TrimSpace(k) != "" {
+			Keys = append(Keys, k)
+		}
+	}
+	keyring, err := secrets.New(Keys)
+	if err != nil {
+		log.Fatal("error loading encryption keys: ", err)
+	}
+	d.secrets = keyring
+
+	if err := SetPasswordParams(PasswordParams{
+		Memory:      uint32(viper.GetInt("auth.argon2.memory")),
+		Iterations:  uint32(viper.GetInt("auth.argon2.iterations")),
+		Parallelism: uint8(viper.GetInt("auth.argon2.parallelism")),
+	}); err != nil {
+		log.Fatal("error loading password hashing parameters: ", err)
+	}
+
 	pdb, err := sql.Open("postgres", psqlInfo)
 	if err != nil {
 		log.Fatal("error connecting to the database: ", err)
@@ -139,3 +137,11 @@ func New(AdminEmail string, schemaSQL string) *Database {
 
 	return d
 }
+
+// Ping checks the database is reachable, giving up after a couple of seconds
+func (d *Database) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return d.db.PingContext(ctx)
+}
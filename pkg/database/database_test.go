@@ -1,7 +1,9 @@
 package database
 
 import (
+	"encoding/json"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +44,84 @@ func TestGetIntEnvNonDefault(t *testing.T) {
 		t.Error("Expected 2, got ", TestEnv)
 	}
 }
+
+func TestDemoMode(t *testing.T) {
+	if mode := demoMode([]string{"3", "", "5"}); mode != "3" {
+		t.Error("Expected ties to go to the first vote cast got ", mode)
+	}
+	if mode := demoMode([]string{"8", "5", "8", "8"}); mode != "8" {
+		t.Error("Expected the most common vote got ", mode)
+	}
+}
+
+func TestReconcileIssueField(t *testing.T) {
+	tests := []struct {
+		mine, base, theirs string
+		want               int
+	}{
+		{"Login", "Login", "Login", issueFieldUnchanged},
+		{"Login with SSO", "Login", "Login with SSO", issueFieldAgreed},
+		{"Login", "Login", "Login with SSO", issueFieldTakeTheirs},
+		{"Login with SSO", "Login", "Login", issueFieldPush},
+		{"Login with SSO", "Login", "Login with SAML", issueFieldConflict},
+	}
+	for _, tt := range tests {
+		if got := reconcileIssueField(tt.mine, tt.base, tt.theirs); got != tt.want {
+			t.Error("Expected ", tt.mine, " ", tt.base, " ", tt.theirs, " to reconcile as ", tt.want, " got ", got)
+		}
+	}
+}
+
+func TestUTCVotes(t *testing.T) {
+	// votes as the database writes them, in its own time zone
+	var Votes []*Vote
+	if err := json.Unmarshal([]byte(
+		`[{"warriorId": "w1", "vote": "3", "createdDate": "2026-10-16T12:00:00.5+02:00", "updatedDate": "2026-10-16T12:05:00+02:00"}]`,
+	), &Votes); err != nil {
+		t.Fatal(err)
+	}
+	utcVotes(Votes)
+
+	sent, _ := json.Marshal(Votes)
+	if !strings.Contains(string(sent), `"createdDate":"2026-10-16T10:00:00.5Z","updatedDate":"2026-10-16T10:05:00Z"`) {
+		t.Error("Expected the vote dates in UTC got ", string(sent))
+	}
+}
+
+func TestEncryptedColumnsRotated(t *testing.T) {
+	// every column the integrations encrypt has to be re-encrypted when the key rotates
+	for _, want := range []string{
+		"team_confluence.api_token", "team_issue_providers.api_key", "team_calendars.access_token",
+		"team_calendars.refresh_token", "team_jira_webhooks.secret",
+	} {
+		found := false
+		for _, ec := range encryptedColumns {
+			if ec.table+"."+ec.column == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Expected ", want, " to be re-encrypted")
+		}
+	}
+}
+
+func TestVoteRetention(t *testing.T) {
+	// every table holding who voted what has to be stripped of it once votes are past retention
+	for _, want := range []string{
+		"battle_state_events", "plan_vote_latencies", "plan_vote_submissions", "outbox_events", "battle_events",
+	} {
+		found := false
+		for _, vr := range voteRetention {
+			if vr.table == want {
+				found = true
+				if !strings.Contains(vr.query, want) || !strings.Contains(vr.query, "$1") {
+					t.Error("Expected the ", want, " retention to apply to it past the vote days got ", vr.query)
+				}
+			}
+		}
+		if !found {
+			t.Error("Expected ", want, " to be stripped of votes")
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Datastore is everything the server reads and writes, implemented by Database against Postgres so handlers can be
+// unit tested with a Mock and other backends could be added
+type Datastore interface {
+	// action items
+	GetBattleActionItems(BattleID string) []*ActionItem
+	AddBattleActionItem(BattleID string, LeaderID string, Content string, OwnerID string, DueDate string) ([]*ActionItem, error)
+	UpdateBattleActionItem(BattleID string, LeaderID string, ActionItemID string, Content string, OwnerID string, DueDate string, Completed bool) ([]*ActionItem, error)
+	DeleteBattleActionItem(BattleID string, LeaderID string, ActionItemID string) ([]*ActionItem, error)
+
+	// admin
+	ConfirmAdmin(AdminID string) error
+	GetAppStats() (*ApplicationStats, error)
+	PromoteWarrior(WarriorID string) error
+	DemoteWarrior(WarriorID string) error
+	SnapshotAppStats() error
+	GetUsageReport(From time.Time, To time.Time) (*UsageReport, error)
+	GetAdminWarriors() []*Warrior
+
+	// api keys
+	HashAPIKey(apikey string) string
+	GenerateAPIKey(WarriorID string, KeyName string) (*APIKey, error)
+	GetWarriorAPIKeys(WarriorID string) ([]*APIKey, error)
+	UpdateWarriorAPIKey(WarriorID string, KeyID string, Active bool) ([]*APIKey, error)
+	DeleteWarriorAPIKey(WarriorID string, KeyID string) ([]*APIKey, error)
+	ValidateAPIKey(APK string) (WarriorID string, ValidatationErr error)
+	LogAPIRequest(APK string, WarriorID string, Method string, Route string, Detail string, Status int, Latency time.Duration)
+	GetAPIKeyRequests(WarriorID string, KeyID string, Limit int, Offset int) ([]*APIKeyRequest, error)
+	PurgeAPIKeyRequests(DaysOld int) error
+
+	// sessions
+	CreateWarriorSession(WarriorID string, UserAgent string, Days int) (string, error)
+	ExchangeLegacyCookie(WarriorID string, Cookie string, UserAgent string, Days int) (string, error)
+	GetSession(Token string) (*WarriorSession, error)
+	GetWarriorSessions(WarriorID string) ([]*WarriorSession, error)
+	DeleteWarriorSession(WarriorID string, SessionID string) error
+	PurgeExpiredSessions() error
+
+	// battles
+	CreateBattle(LeaderID string, BattleName string, PointValuesAllowed []string, Plans []*Plan, AutoFinishVoting bool, Timezone string, Locale string, TeamID string, RequireReady bool) (*Battle, error)
+	ImportBattleResults(BattleID string, Plans []*Plan, Notes string) error
+	ReviseBattle(BattleID string, warriorID string, BattleName string, PointValuesAllowed []string, AutoFinishVoting bool, Timezone string, Locale string) error
+	GetBattle(BattleID string, WarriorID string) (*Battle, error)
+	GetBattleState(BattleID string, WarriorID string) (*BattleState, error)
+	SetBattleRequireReady(BattleID string, warriorID string, RequireReady bool) error
+	GetBattlesByWarrior(WarriorID string, Filter *BattleFilter) ([]*Battle, error)
+	SetBattleStarred(BattleID string, WarriorID string, Starred bool) error
+	ConfirmLeader(BattleID string, warriorID string) error
+	GetBattleWarrior(BattleID string, WarriorID string) (*BattleWarrior, error)
+	IsBattleWarrior(BattleID string, WarriorID string) bool
+	GetBattleWarriors(BattleID string) []*BattleWarrior
+	GetBattleActiveWarriors(BattleID string) []*BattleWarrior
+	AddWarriorToBattle(BattleID string, WarriorID string) ([]*BattleWarrior, error)
+	EnlistWarrior(BattleID string, WarriorID string) bool
+	RetreatWarrior(BattleID string, WarriorID string) []*BattleWarrior
+	AbandonBattle(BattleID string, WarriorID string) ([]*BattleWarrior, error)
+	SetBattleLeader(BattleID string, warriorID string, LeaderID string) error
+	DeleteBattle(BattleID string, warriorID string) error
+
+	// battle bots
+	CreateBattleBot(BattleID string, LeaderID string, BotName string) (*Warrior, *APIKey, error)
+	GetBattleBots(BattleID string) []*BattleWarrior
+	IsBattleBot(BattleID string, WarriorID string) bool
+	DeleteBattleBot(BattleID string, LeaderID string, BotID string) error
+
+	// email broadcasts
+	CreateEmailBroadcast(CreatedBy string, Subject string, Body string, TeamID string) (*EmailBroadcast, error)
+	ProcessEmailBroadcasts(Limit int, MaxAttempts int, send func(*BroadcastEmail) error) (int, error)
+	GetEmailBroadcasts(MaxAttempts int, Limit int, Offset int) ([]*EmailBroadcast, error)
+
+	// breakouts
+	CreateBreakouts(BattleID string, warriorID string, Breakouts []*Breakout) ([]*Breakout, error)
+	GetBreakouts(BattleID string) []*Breakout
+	MergeBreakouts(BattleID string, warriorID string) ([]*Plan, error)
+
+	// checklist
+	GetTeamChecklist(TeamID string) []*ChecklistItem
+	AddTeamChecklistItem(TeamID string, Text string, SortOrder int) ([]*ChecklistItem, error)
+	DeleteTeamChecklistItem(TeamID string, ItemID string) ([]*ChecklistItem, error)
+	CheckPlanChecklistItem(BattleID string, WarriorID string, PlanID string, ItemID string, Checked bool) ([]*Plan, error)
+
+	// confidence votes
+	GetBattleConfidence(BattleID string) (*Confidence, error)
+	SetBattleConfidenceOpen(BattleID string, warriorID string, Open bool) (*Confidence, error)
+	SetConfidenceVote(BattleID string, WarriorID string, Confidence int) (*Confidence, error)
+
+	// demo
+	SeedDemo() error
+
+	// departments
+	CreateDepartment(Name string) (*Department, error)
+	GetDepartments() []*Department
+	GetDepartmentsByWarrior(WarriorID string) []*Department
+	GetDepartment(DepartmentID string) (*Department, error)
+	DeleteDepartment(DepartmentID string) error
+	GetDepartmentWarriorRole(DepartmentID string, WarriorID string) (string, error)
+	ConfirmTeamDepartmentAdmin(TeamID string, WarriorID string) error
+	DepartmentAddWarrior(DepartmentID string, WarriorEmail string, Role string) (*Department, error)
+	DepartmentRemoveWarrior(DepartmentID string, WarriorID string) (*Department, error)
+	DepartmentAddTeam(DepartmentID string, TeamID string) (*Department, error)
+	DepartmentRemoveTeam(DepartmentID string, TeamID string) (*Department, error)
+	GetDepartmentBattles(DepartmentID string, Limit int, Offset int) ([]*Battle, error)
+	DeleteDepartmentBattle(DepartmentID string, BattleID string) error
+
+	// dot voting
+	StartDotVoting(BattleID string, warriorID string, DotBudget int) ([]*Plan, error)
+	SetWarriorDots(BattleID string, WarriorID string, PlanDots map[string]int) ([]*Plan, error)
+	EndDotVoting(BattleID string, warriorID string) ([]*Plan, error)
+
+	// email deliveries
+	LogEmailDelivery(Recipient string, Subject string, Error string)
+	GetEmailDeliveries(Limit int) ([]*EmailDelivery, error)
+	PurgeEmailDeliveries(DaysOld int) error
+
+	// encryption
+	ReencryptSecrets() (int, error)
+
+	// session feedback
+	SubmitSessionFeedback(SessionID string, WarriorID string, Rating int, Comment string) error
+	GetSessionFeedback(From time.Time) (*SessionFeedback, error)
+
+	// federation
+	GetFederationPeers() ([]*FederationPeer, error)
+	GetFederationPeer(PeerID string) (*FederationPeer, error)
+	GetFederationPeerByURL(URL string) (*FederationPeer, error)
+	AddFederationPeer(URL string, PublicKey string) (*FederationPeer, error)
+	DeleteFederationPeer(PeerID string) error
+	FederateBattle(BattleID string, warriorID string, PeerID string) error
+	UnfederateBattle(BattleID string, warriorID string, PeerID string) error
+	GetBattleFederationPeers(BattleID string) ([]*FederationPeer, error)
+	IsBattleFederated(BattleID string, PeerID string) bool
+	UseFederationNonce(PeerID string, Nonce string, Expires time.Time) error
+	AddFederationWatcher(PeerID string, BattleID string, WarriorID string) error
+	IsFederationWatcher(PeerID string, BattleID string, WarriorID string) bool
+	FederatedWarrior(PeerID string, RemoteWarriorID string, WarriorName string) (*Warrior, error)
+
+	// gamification
+	GetWarriorParticipation(WarriorID string) (*WarriorParticipation, error)
+	GetTeamParticipation(TeamID string) ([]*WarriorParticipation, error)
+
+	// absences and battle schedules
+	AddWarriorAbsence(WarriorID string, StartDate time.Time, EndDate time.Time, Note string) (*WarriorAbsence, error)
+	GetWarriorAbsences(WarriorID string) []*WarriorAbsence
+	DeleteWarriorAbsence(WarriorID string, AbsenceID string) error
+	GetTeamAbsences(TeamID string, From time.Time, To time.Time) ([]*WarriorAbsence, error)
+	CreateBattleSchedule(TeamID string, Name string, Schedule string, Timezone string, KeyWarriorIDs []string) (*BattleSchedule, error)
+	GetTeamBattleSchedules(TeamID string) ([]*BattleSchedule, error)
+	GetBattleSchedules() ([]*BattleSchedule, error)
+	DeleteBattleSchedule(TeamID string, ScheduleID string) error
+
+	// battle defaults
+	GetBattleDefaults() (*BattleDefaults, error)
+	SetBattleDefaults(Defaults *BattleDefaults, UpdatedBy string) error
+
+	// team domains
+	GetTeamDomains() ([]*TeamDomain, error)
+	SetTeamDomain(td *TeamDomain) error
+	DeleteTeamDomain(TeamID string) error
+
+	// health
+	Ping() error
+
+	// license
+	GetLicenseUsage() (*LicenseUsage, error)
+	SetLicenseOverage(Resource string, Over bool) error
+
+	// battle history
+	GetBattleAt(BattleID string, WarriorID string, At time.Time) (*Battle, error)
+	CompactBattleHistory(DaysOld int) error
+
+	// raised hands
+	GetRaisedHands(BattleID string) []*RaisedHand
+	RaiseHand(BattleID string, WarriorID string) ([]*RaisedHand, error)
+	LowerHand(BattleID string, warriorID string, WarriorID string) ([]*RaisedHand, error)
+	ClearRaisedHands(BattleID string, warriorID string) ([]*RaisedHand, error)
+	ReorderRaisedHands(BattleID string, warriorID string, WarriorIDs []string) ([]*RaisedHand, error)
+
+	// inbound email
+	GetBattleEmailCode(BattleID string, warriorID string) (string, error)
+	SetBattleEmailCode(BattleID string, warriorID string) (string, error)
+	DeleteBattleEmailCode(BattleID string, warriorID string) error
+	AddEmailedPlan(Code string, PlanName string, Description string) (string, []*Plan, error)
+
+	// integrations
+	GetTeamConfluence(TeamID string) (*TeamConfluence, error)
+	SetTeamConfluence(TeamID string, c *TeamConfluence) error
+	DeleteTeamConfluence(TeamID string) error
+	GetTeamIssueProviders(TeamID string) ([]string, error)
+	GetTeamIssueProviderKey(TeamID string, Provider string) (string, error)
+	SetTeamIssueProviderKey(TeamID string, Provider string, APIKey string) error
+	DeleteTeamIssueProviderKey(TeamID string, Provider string) error
+	GetTeamJiraWebhookSecret(TeamID string) (string, error)
+	CreateTeamJiraWebhookSecret(TeamID string, Secret string) (string, error)
+	GetTeamCalendar(TeamID string) (*TeamCalendar, error)
+	GetTeamCalendars() ([]*TeamCalendar, error)
+	SetTeamCalendar(c *TeamCalendar) error
+	DeleteTeamCalendar(TeamID string) error
+	CreateCalendarSlot(ScheduleID string, TeamID string, StartTime time.Time) (bool, error)
+	SetCalendarSlotEvent(ScheduleID string, StartTime time.Time, EventID string) error
+	DeleteCalendarSlot(ScheduleID string, StartTime time.Time) error
+	GetCalendarSlot(ScheduleID string, StartTime time.Time) (*CalendarSlot, error)
+	GetDueCalendarSlots(By time.Time) ([]*CalendarSlot, error)
+	SetCalendarSlotBattle(ScheduleID string, StartTime time.Time, BattleID string) (string, error)
+
+	// background jobs
+	RunJobExclusively(Name string, Schedule string, ScheduledFor time.Time, run func() error) (bool, error)
+	GetJobs() []*Job
+
+	// notes
+	GetBattleNotes(BattleID string) (*BattleNotes, error)
+	ReviseBattleNotes(BattleID string, WarriorID string, Notes string, Version int) (*BattleNotes, error)
+
+	// issue sync
+	SyncIssuePlans(TeamID string, Provider string, ExternalID string, Theirs map[string]string) ([]*SyncedPlan, map[string][]*Plan, error)
+	ReconcileIssuePlan(PlanID string, Theirs map[string]string) (*SyncedPlan, []*Plan, error)
+	SetIssuePlanBase(PlanID string, Fields map[string]string) error
+	GetIssueConflicts(BattleID string, warriorID string) ([]*IssueConflict, error)
+	ResolveIssueConflict(BattleID string, warriorID string, PlanID string, Field string, Resolution string) ([]*Plan, error)
+
+	// notifications
+	GetNotificationPreferences(WarriorID string) ([]*NotificationPreference, error)
+	SetNotificationPreferences(WarriorID string, Preferences []*NotificationPreference) error
+	WarriorNotifies(WarriorID string, Event string, Channel string) bool
+
+	// outbox
+	ProcessOutboxEvents(Limit int, MaxAttempts int, handle func(*OutboxEvent) error) (int, error)
+	GetOutboxDeliveries(EventID int64) ([]string, error)
+	SetOutboxDelivered(Handler string, EventID int64) error
+	PurgeOutboxEvents(DaysOld int) error
+	GetLeaderOutboxEvents(EventType string, LeaderID string, Limit int) ([]*OutboxEvent, error)
+
+	// team parking lot
+	GetTeamParkedPlans(TeamID string) []*ParkedPlan
+	ParkTeamPlan(TeamID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string) ([]*ParkedPlan, error)
+	DeleteTeamParkedPlan(TeamID string, ParkedPlanID string) ([]*ParkedPlan, error)
+	ParkBattlePlan(BattleID string, LeaderID string, PlanID string) ([]*Plan, error)
+	PullTeamParkedPlans(TeamID string, BattleID string, LeaderID string, ParkedPlanIDs []string) ([]*Plan, error)
+
+	// plans
+	GetPlans(BattleID string, WarriorID string) []*Plan
+	GetPlansPage(BattleID string, WarriorID string, Limit int, Offset int) ([]*Plan, int, error)
+	CreatePlan(BattleID string, warriorID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string) ([]*Plan, error)
+	ImportPlans(BattleID string, warriorID string, Provider string, Plans []*Plan) ([]*Plan, error)
+	ActivatePlanVoting(BattleID string, warriorID string, PlanID string) ([]*Plan, error)
+	SetVote(BattleID string, WarriorID string, PlanID string, VoteValue string, VoteID string, RejectChanges bool) (BattlePlans []*Plan, AllWarriorsVoted bool, err error)
+	RetractVote(BattleID string, WarriorID string, PlanID string) []*Plan
+	EndPlanVoting(BattleID string, warriorID string, PlanID string, AutoFinishVoting bool) ([]*Plan, error)
+	SkipPlan(BattleID string, warriorID string, PlanID string) ([]*Plan, error)
+	RevisePlan(BattleID string, warriorID string, PlanID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string, Version int) ([]*Plan, error)
+	SetPlanTranslation(BattleID string, warriorID string, PlanID string, Locale string, PlanName string, Description string) ([]*Plan, error)
+	DeletePlanTranslation(BattleID string, warriorID string, PlanID string, Locale string) ([]*Plan, error)
+	BurnPlan(BattleID string, warriorID string, PlanID string) ([]*Plan, error)
+	FinalizePlan(BattleID string, warriorID string, PlanID string, PlanPoints string) ([]*Plan, error)
+	SplitPlan(BattleID string, warriorID string, PlanID string, ChildPlans []*Plan) ([]*Plan, error)
+	SetPlanDependencies(BattleID string, warriorID string, PlanID string, DependsOn []string) ([]*Plan, error)
+
+	// vote latencies
+	GetBattleVoteLatencies(BattleID string) ([]*VoteLatency, error)
+
+	// plan attachments
+	AddPlanAttachment(BattleID string, PlanID string, WarriorID string, Name string, ContentType string, Size int) (*PlanAttachment, error)
+	GetPlanAttachments(BattleID string, PlanID string) []*PlanAttachment
+	GetPlanAttachment(BattleID string, AttachmentID string) (*PlanAttachment, error)
+	DeletePlanAttachment(BattleID string, AttachmentID string) error
+	GetDeletedAttachments(Limit int) ([]string, error)
+	ClearDeletedAttachment(AttachmentID string) error
+
+	// plan questions
+	AskPlanQuestion(BattleID string, WarriorID string, PlanID string, Question string) ([]*Plan, error)
+	ResolvePlanQuestion(BattleID string, warriorID string, QuestionID string, Answer string) ([]*Plan, error)
+
+	// recordings
+	RecordBattleEvent(BattleID string, Seq uint64, EventType string, EventValue string, WarriorID string) error
+	GetBattleRecording(BattleID string, WarriorID string) ([]*BattleEvent, error)
+
+	// retention
+	ApplyRetention(BattleDays int, VoteDays int) (*RetentionReport, error)
+	GetRetentionReports(Limit int, Offset int) ([]*RetentionReport, error)
+
+	// roles and permissions
+	GetWarriorPermissions(WarriorID string) ([]string, error)
+	ConfirmPermission(WarriorID string, Permission string) error
+	GetRoles() ([]*Role, error)
+	CreateRole(Name string, Description string, Permissions []string) (*Role, error)
+	UpdateRole(RoleID string, Name string, Description string, Permissions []string) error
+	DeleteRole(RoleID string) error
+	GetRoleAssignments(RoleID string) (*RoleAssignments, error)
+	AssignWarriorRole(RoleID string, WarriorID string) error
+	UnassignWarriorRole(RoleID string, WarriorID string) error
+	AssignTeamRole(RoleID string, TeamID string, TeamRole string) error
+	UnassignTeamRole(RoleID string, TeamID string, TeamRole string) error
+
+	// voting by text
+	AddBattleSMSVoter(BattleID string, LeaderID string, Name string, Phone string) (*SMSVoter, error)
+	GetBattleSMSVoters(BattleID string, LeaderID string) ([]*SMSVoter, error)
+	RemoveBattleSMSVoter(BattleID string, LeaderID string, WarriorID string) ([]*BattleWarrior, error)
+	GetSMSVoter(Phone string) (BattleID string, WarriorID string, err error)
+
+	// warrior stats
+	GetWarriorVoteHistory(WarriorID string, From time.Time, To time.Time) ([]*WarriorVote, error)
+	CountWarriorBattles(WarriorID string, From time.Time, To time.Time) (Joined int, Led int, err error)
+
+	// teams
+	CreateTeam(WarriorID string, TeamName string) (*Team, error)
+	GetTeam(TeamID string) (*Team, error)
+	GetTeamsByWarrior(WarriorID string) []*Team
+	GetTeamWarriorRole(TeamID string, WarriorID string) (string, error)
+	TeamAddWarrior(TeamID string, WarriorEmail string, Role string) (*Team, error)
+	TeamJoin(TeamID string, WarriorID string) (*Team, error)
+	TeamRemoveWarrior(TeamID string, WarriorID string) (*Team, error)
+	DeleteTeam(TeamID string) error
+
+	// battle templates
+	CreateBattleTemplate(Name string, Description string, Document json.RawMessage, CreatedBy string) (*BattleTemplate, error)
+	GetBattleTemplates() []*BattleTemplate
+	DeleteBattleTemplate(TemplateID string) error
+
+	// warriors
+	GetRegisteredWarriors(Limit int, Offset int) []*Warrior
+	SearchRegisteredWarriors(Search *WarriorSearch) []*Warrior
+	GetInactiveWarriors(Days int, Limit int, Offset int) []*Warrior
+	RecordWarriorLogin(WarriorID string)
+	TouchWarriorActivity(WarriorID string)
+	GetWarrior(WarriorID string) (*Warrior, error)
+	GetWarriorByEmail(WarriorEmail string) (*Warrior, error)
+	AuthWarrior(WarriorEmail string, WarriorPassword string) (*Warrior, error)
+	CreateWarriorPrivate(WarriorName string) (*Warrior, error)
+	CreateWarriorCorporal(WarriorName string, WarriorEmail string, WarriorPassword string, ActiveWarriorID string) (NewWarrior *Warrior, VerifyID string, RegisterErr error)
+	UpdateWarriorProfile(WarriorID string, WarriorName string, WarriorAvatar string, NotificationsEnabled bool) error
+	WarriorResetRequest(WarriorEmail string) (resetID string, warriorName string, resetErr error)
+	WarriorResetPassword(ResetID string, WarriorPassword string) (warriorName string, warriorEmail string, resetErr error)
+	WarriorUpdatePassword(WarriorID string, WarriorPassword string) (warriorName string, warriorEmail string, resetErr error)
+	VerifyWarriorAccount(VerifyID string) error
+	CreateInvitedWarrior(WarriorName string, WarriorEmail string) (*Warrior, error)
+	CreateWarriorInvite(WarriorID string) (string, error)
+	GetPasswordHashReport() (*PasswordHashReport, error)
+	SetWarriorHandle(WarriorID string, Handle string) error
+	GetBattleWarriorsByHandles(BattleID string, Handles []string) ([]*Warrior, error)
+
+	// webhooks
+	GetWebhooks() ([]*Webhook, error)
+	GetActiveWebhooks() ([]*Webhook, error)
+	CreateWebhook(wh *Webhook) (*Webhook, error)
+	UpdateWebhook(wh *Webhook) error
+	DeleteWebhook(WebhookID string) error
+	DeleteWarriorWebhook(WarriorID string, WebhookID string) error
+	GetWebhookDeliveries(EventID int64) ([]string, error)
+	SetWebhookDelivered(WebhookID string, EventID int64) error
+}
+
+var _ Datastore = (*Database)(nil)
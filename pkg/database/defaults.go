@@ -0,0 +1,69 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// the battle defaults the organization can stop battles from overriding
+const (
+	BattleDefaultPointValues      = "pointValuesAllowed"
+	BattleDefaultAutoFinishVoting = "autoFinishVoting"
+)
+
+// BattleDefaults are the organization wide settings battles are created with
+type BattleDefaults struct {
+	PointValuesAllowed []string `json:"pointValuesAllowed"`
+	AutoFinishVoting   bool     `json:"autoFinishVoting"`
+	// SpecialCards are the cards that aren't numbers, like ?, battles may use, any when empty
+	SpecialCards []string `json:"specialCards"`
+	// Locked are the defaults battles can't override
+	Locked              []string `json:"locked"`
+	BattleRetentionDays int      `json:"battleRetentionDays"`
+	VoteRetentionDays   int      `json:"voteRetentionDays"`
+}
+
+// GetBattleDefaults gets the organization's battle defaults, nil when an admin hasn't set them
+func (d *Database) GetBattleDefaults() (*BattleDefaults, error) {
+	var document []byte
+	e := d.db.QueryRow(`SELECT defaults FROM battle_defaults`).Scan(&document)
+	if e == sql.ErrNoRows {
+		return nil, nil
+	}
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to get battle defaults")
+	}
+
+	var defaults BattleDefaults
+	if err := json.Unmarshal(document, &defaults); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get battle defaults")
+	}
+
+	return &defaults, nil
+}
+
+// SetBattleDefaults saves the organization's battle defaults
+func (d *Database) SetBattleDefaults(Defaults *BattleDefaults, UpdatedBy string) error {
+	document, err := json.Marshal(Defaults)
+	if err != nil {
+		return errors.New("unable to save battle defaults")
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO battle_defaults (defaults, updated_by) VALUES ($1::JSONB, $2)
+		ON CONFLICT (id) DO UPDATE SET
+			defaults = EXCLUDED.defaults,
+			updated_by = EXCLUDED.updated_by,
+			updated_date = NOW();`,
+		string(document), UpdatedBy,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to save battle defaults")
+	}
+
+	return nil
+}
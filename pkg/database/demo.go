@@ -0,0 +1,162 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// DemoPassword is the password every demo warrior logs in with
+const DemoPassword = "thunderdome"
+
+// demoWarriors are the demo team, the first one leads the battles and admins the team
+var demoWarriors = []struct {
+	Name  string
+	Email string
+}{
+	{"Thor", "thor@demo.thunderdome.dev"},
+	{"Loki", "loki@demo.thunderdome.dev"},
+	{"Valkyrie", "valkyrie@demo.thunderdome.dev"},
+	{"Heimdall", "heimdall@demo.thunderdome.dev"},
+}
+
+// demoPlan is a demo plan with its votes in the order of the demo warriors, an empty vote being one not cast
+type demoPlan struct {
+	Name  string
+	Type  string
+	Votes []string
+}
+
+// demoBattle is a demo battle with its plans pointed as far as Pointed, the next voted plan being left mid vote
+type demoBattle struct {
+	Name       string
+	Team       bool
+	Pointed    int
+	Plans      []demoPlan
+	ActionItem string
+}
+
+var demoBattles = []demoBattle{
+	{"Sprint 41 Refinement", true, 4, []demoPlan{
+		{"Login with single sign-on", "Story", []string{"8", "5", "8", "8"}},
+		{"Export battle results as CSV", "Story", []string{"3", "3", "2", "3"}},
+		{"Avatar upload fails for large images", "Bug", []string{"2", "1", "2", "2"}},
+		{"Upgrade Postgres driver", "Task", []string{"1", "1", "1", "2"}},
+	}, "Split single sign-on into an SSO spike and a login story"},
+	{"Sprint 42 Refinement", true, 2, []demoPlan{
+		{"Team dashboards", "Epic", []string{"13", "20", "13", "13"}},
+		{"Dark mode", "Story", []string{"5", "5", "3", "5"}},
+		{"Websocket reconnect drops votes", "Bug", []string{"3", "5", "", ""}},
+		{"Spike: search indexing", "Spike", nil},
+	}, ""},
+	{"Hackathon ideas", false, 1, []demoPlan{
+		{"Slack bot", "Story", []string{"5", "8", "5", "3"}},
+		{"Jira two way sync", "Story", nil},
+	}, ""},
+}
+
+// SeedDemo creates demo warriors, a team and battles with pointed plans, votes and action items so a fresh instance
+// has something to show, doing nothing when the demo warriors already exist
+func (d *Database) SeedDemo() error {
+	if _, err := d.GetWarriorByEmail(demoWarriors[0].Email); err == nil {
+		log.Println("demo data already seeded")
+		return nil
+	}
+
+	var WarriorIDs []string
+	for _, dw := range demoWarriors {
+		w, _, err := d.CreateWarriorCorporal(dw.Name, dw.Email, DemoPassword, "")
+		if err != nil {
+			return errors.New("unable to create demo warriors")
+		}
+		WarriorIDs = append(WarriorIDs, w.WarriorID)
+	}
+	LeaderID := WarriorIDs[0]
+
+	team, err := d.CreateTeam(LeaderID, "Asgard")
+	if err != nil {
+		return errors.New("unable to create demo team")
+	}
+	for _, dw := range demoWarriors[1:] {
+		if _, err := d.TeamAddWarrior(team.TeamID, dw.Email, "MEMBER"); err != nil {
+			return errors.New("unable to create demo team")
+		}
+	}
+
+	for _, demo := range demoBattles {
+		Plans := make([]*Plan, 0)
+		for _, dp := range demo.Plans {
+			Plans = append(Plans, &Plan{PlanName: dp.Name, Type: dp.Type})
+		}
+		TeamID := ""
+		if demo.Team {
+			TeamID = team.TeamID
+		}
+
+		b, err := d.CreateBattle(LeaderID, demo.Name, []string{"0", "1/2", "1", "2", "3", "5", "8", "13", "20", "40", "100", "?"}, Plans, false, "UTC", "en", TeamID, false)
+		if err != nil {
+			return errors.New("unable to create demo battles")
+		}
+		for _, WarriorID := range WarriorIDs {
+			if _, err := d.AddWarriorToBattle(b.BattleID, WarriorID); err != nil {
+				return errors.New("unable to create demo battles")
+			}
+		}
+
+		for i, p := range b.Plans {
+			dp := demo.Plans[i]
+			if dp.Votes == nil {
+				continue
+			}
+			if _, err := d.ActivatePlanVoting(b.BattleID, LeaderID, p.PlanID); err != nil {
+				return errors.New("unable to create demo votes")
+			}
+			for w, VoteValue := range dp.Votes {
+				if VoteValue == "" {
+					continue
+				}
+				if _, _, err := d.SetVote(b.BattleID, WarriorIDs[w], p.PlanID, VoteValue, "", false); err != nil {
+					return errors.New("unable to create demo votes")
+				}
+			}
+			if i >= demo.Pointed {
+				continue
+			}
+			if _, err := d.EndPlanVoting(b.BattleID, LeaderID, p.PlanID, false); err != nil {
+				return errors.New("unable to create demo votes")
+			}
+			// the most common vote wins, ties going to the one that got there first
+			if _, err := d.FinalizePlan(b.BattleID, LeaderID, p.PlanID, demoMode(dp.Votes)); err != nil {
+				return errors.New("unable to create demo votes")
+			}
+		}
+
+		if demo.ActionItem != "" {
+			if _, err := d.AddBattleActionItem(b.BattleID, LeaderID, demo.ActionItem, WarriorIDs[1], ""); err != nil {
+				return errors.New("unable to create demo action items")
+			}
+		}
+
+		for _, WarriorID := range WarriorIDs {
+			d.RetreatWarrior(b.BattleID, WarriorID)
+		}
+	}
+
+	return nil
+}
+
+// demoMode gets the most common vote
+func demoMode(Votes []string) string {
+	counts := make(map[string]int)
+	var mode string
+	for _, v := range Votes {
+		if v == "" {
+			continue
+		}
+		counts[v]++
+		if counts[v] > counts[mode] {
+			mode = v
+		}
+	}
+
+	return mode
+}
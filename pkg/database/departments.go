@@ -0,0 +1,304 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// CreateDepartment creates a new department without any teams or warriors
+func (d *Database) CreateDepartment(Name string) (*Department, error) {
+	newID, _ := uuid.NewUUID()
+	var dept = &Department{
+		DepartmentID: newID.String(),
+		Name:         Name,
+	}
+
+	if err := d.db.QueryRow(
+		`INSERT INTO departments (id, name) VALUES ($1, $2) RETURNING created_date;`,
+		dept.DepartmentID, Name,
+	).Scan(&dept.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create department")
+	}
+
+	return dept, nil
+}
+
+// GetDepartments gets a list of every department
+func (d *Database) GetDepartments() []*Department {
+	var departments = make([]*Department, 0)
+	rows, err := d.db.Query(
+		`SELECT id, name, created_date FROM departments ORDER BY name`,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var dept Department
+			if err := rows.Scan(&dept.DepartmentID, &dept.Name, &dept.CreatedDate); err != nil {
+				log.Println(err)
+			} else {
+				departments = append(departments, &dept)
+			}
+		}
+	}
+
+	return departments
+}
+
+// GetDepartmentsByWarrior gets a list of departments the warrior belongs to
+func (d *Database) GetDepartmentsByWarrior(WarriorID string) []*Department {
+	var departments = make([]*Department, 0)
+	rows, err := d.db.Query(
+		`SELECT dp.id, dp.name, dp.created_date, dw.role
+		FROM department_warriors dw
+		LEFT JOIN departments dp ON dp.id = dw.department_id
+		WHERE dw.warrior_id = $1
+		ORDER BY dp.name`,
+		WarriorID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var dept Department
+			if err := rows.Scan(&dept.DepartmentID, &dept.Name, &dept.CreatedDate, &dept.Role); err != nil {
+				log.Println(err)
+			} else {
+				departments = append(departments, &dept)
+			}
+		}
+	}
+
+	return departments
+}
+
+// GetDepartment gets a department by ID including its teams and warriors
+func (d *Database) GetDepartment(DepartmentID string) (*Department, error) {
+	var dept = &Department{
+		Teams:    make([]*Team, 0),
+		Warriors: make([]*DepartmentWarrior, 0),
+	}
+
+	e := d.db.QueryRow(
+		`SELECT id, name, created_date FROM departments WHERE id = $1`,
+		DepartmentID,
+	).Scan(&dept.DepartmentID, &dept.Name, &dept.CreatedDate)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("department not found")
+	}
+
+	teamRows, err := d.db.Query(
+		`SELECT id, name, created_date FROM teams WHERE department_id = $1 ORDER BY name`,
+		DepartmentID,
+	)
+	if err == nil {
+		defer teamRows.Close()
+		for teamRows.Next() {
+			var t Team
+			if err := teamRows.Scan(&t.TeamID, &t.TeamName, &t.CreatedDate); err != nil {
+				log.Println(err)
+			} else {
+				dept.Teams = append(dept.Teams, &t)
+			}
+		}
+	}
+
+	rows, err := d.db.Query(
+		`SELECT w.id, w.name, coalesce(w.email, ''), dw.role
+		FROM department_warriors dw
+		LEFT JOIN warriors w ON w.id = dw.warrior_id
+		WHERE dw.department_id = $1
+		ORDER BY w.name`,
+		DepartmentID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var dw DepartmentWarrior
+			if err := rows.Scan(&dw.WarriorID, &dw.WarriorName, &dw.WarriorEmail, &dw.Role); err != nil {
+				log.Println(err)
+			} else {
+				dept.Warriors = append(dept.Warriors, &dw)
+			}
+		}
+	}
+
+	return dept, nil
+}
+
+// DeleteDepartment removes the department, its teams are kept but no longer associated
+func (d *Database) DeleteDepartment(DepartmentID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM departments WHERE id = $1`, DepartmentID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete department")
+	}
+
+	return nil
+}
+
+// GetDepartmentWarriorRole gets the warriors role in the department, erroring if not a member
+func (d *Database) GetDepartmentWarriorRole(DepartmentID string, WarriorID string) (string, error) {
+	var role string
+	e := d.db.QueryRow(
+		`SELECT role FROM department_warriors WHERE department_id = $1 AND warrior_id = $2`,
+		DepartmentID,
+		WarriorID,
+	).Scan(&role)
+	if e != nil {
+		if e != sql.ErrNoRows {
+			log.Println(e)
+		}
+		return "", errors.New("warrior not a department member")
+	}
+
+	return role, nil
+}
+
+// ConfirmTeamDepartmentAdmin confirms whether the warrior is an admin of the department the team belongs to
+func (d *Database) ConfirmTeamDepartmentAdmin(TeamID string, WarriorID string) error {
+	var isAdmin bool
+	e := d.db.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM teams t
+			JOIN department_warriors dw ON dw.department_id = t.department_id
+			WHERE t.id = $1 AND dw.warrior_id = $2 AND dw.role = 'ADMIN'
+		)`,
+		TeamID,
+		WarriorID,
+	).Scan(&isAdmin)
+	if e != nil {
+		log.Println(e)
+		return errors.New("unable to confirm department admin")
+	}
+
+	if !isAdmin {
+		return errors.New("warrior not a department admin")
+	}
+
+	return nil
+}
+
+// DepartmentAddWarrior adds a registered warrior to the department by email
+func (d *Database) DepartmentAddWarrior(DepartmentID string, WarriorEmail string, Role string) (*Department, error) {
+	if _, err := d.db.Exec(
+		`INSERT INTO department_warriors (department_id, warrior_id, role)
+		SELECT $1, w.id, $3 FROM warriors w WHERE w.email = $2
+		ON CONFLICT (department_id, warrior_id) DO UPDATE SET role = $3`,
+		DepartmentID,
+		WarriorEmail,
+		Role,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add warrior to department")
+	}
+
+	return d.GetDepartment(DepartmentID)
+}
+
+// DepartmentRemoveWarrior removes a warrior from the department, they stay on its teams
+func (d *Database) DepartmentRemoveWarrior(DepartmentID string, WarriorID string) (*Department, error) {
+	if _, err := d.db.Exec(
+		`DELETE FROM department_warriors WHERE department_id = $1 AND warrior_id = $2`,
+		DepartmentID,
+		WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to remove warrior from department")
+	}
+
+	return d.GetDepartment(DepartmentID)
+}
+
+// DepartmentAddTeam moves the team into the department, a team belongs to at most one department
+func (d *Database) DepartmentAddTeam(DepartmentID string, TeamID string) (*Department, error) {
+	if _, err := d.db.Exec(
+		`UPDATE teams SET department_id = $1, updated_date = NOW() WHERE id = $2`,
+		DepartmentID,
+		TeamID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add team to department")
+	}
+
+	return d.GetDepartment(DepartmentID)
+}
+
+// DepartmentRemoveTeam removes the team from the department
+func (d *Database) DepartmentRemoveTeam(DepartmentID string, TeamID string) (*Department, error) {
+	if _, err := d.db.Exec(
+		`UPDATE teams SET department_id = NULL, updated_date = NOW() WHERE id = $2 AND department_id = $1`,
+		DepartmentID,
+		TeamID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to remove team from department")
+	}
+
+	return d.GetDepartment(DepartmentID)
+}
+
+// GetDepartmentBattles gets a page of the battles of the departments teams, newest first
+func (d *Database) GetDepartmentBattles(DepartmentID string, Limit int, Offset int) ([]*Battle, error) {
+	var battles = make([]*Battle, 0)
+	rows, err := d.db.Query(
+		`SELECT b.id, b.name, b.leader_id, b.team_id, COUNT(p.id), b.created_date, b.updated_date
+		FROM battles b
+		JOIN teams t ON t.id = b.team_id
+		LEFT JOIN plans p ON p.battle_id = b.id
+		WHERE t.department_id = $1
+		GROUP BY b.id ORDER BY b.created_date DESC
+		LIMIT $2 OFFSET $3;`,
+		DepartmentID,
+		Limit,
+		Offset,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get department battles")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var b Battle
+		if err := rows.Scan(&b.BattleID, &b.BattleName, &b.LeaderID, &b.TeamID, &b.PlanCount, &b.CreatedDate, &b.UpdatedDate); err != nil {
+			log.Println(err)
+		} else {
+			utc(&b.CreatedDate, &b.UpdatedDate)
+			battles = append(battles, &b)
+		}
+	}
+
+	return battles, nil
+}
+
+// DeleteDepartmentBattle deletes a battle of one of the departments teams
+func (d *Database) DeleteDepartmentBattle(DepartmentID string, BattleID string) error {
+	var inDepartment bool
+	e := d.db.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM battles b JOIN teams t ON t.id = b.team_id
+			WHERE b.id = $1 AND t.department_id = $2
+		)`,
+		BattleID,
+		DepartmentID,
+	).Scan(&inDepartment)
+	if e != nil {
+		log.Println(e)
+		return errors.New("unable to find battle")
+	}
+	if !inDepartment {
+		return errors.New("battle not in department")
+	}
+
+	if _, err := d.db.Exec(
+		`call delete_battle($1);`, BattleID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete battle")
+	}
+
+	return nil
+}
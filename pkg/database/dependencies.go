@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// getPlanDependencies gets the plans each of the battles plans depends on being estimated first
+func (d *Database) getPlanDependencies(BattleID string) map[string][]string {
+	dependencies := make(map[string][]string)
+	rows, err := d.db.Query(
+		`SELECT pd.plan_id, pd.depends_on_id FROM plan_dependencies pd
+		JOIN plans p ON p.id = pd.plan_id
+		WHERE p.battle_id = $1
+		ORDER BY pd.created_date`,
+		BattleID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var PlanID, DependsOnID string
+			if err := rows.Scan(&PlanID, &DependsOnID); err != nil {
+				log.Println(err)
+			} else {
+				dependencies[PlanID] = append(dependencies[PlanID], DependsOnID)
+			}
+		}
+	}
+
+	return dependencies
+}
+
+// SetPlanDependencies replaces the plans the plan depends on, plans of other battles are ignored
+func (d *Database) SetPlanDependencies(BattleID string, warriorID string, PlanID string, DependsOn []string) ([]*Plan, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to set plan dependencies")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`DELETE FROM plan_dependencies pd USING plans p
+		WHERE pd.plan_id = p.id AND p.id = $2 AND p.battle_id = $1`,
+		BattleID, PlanID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to set plan dependencies")
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO plan_dependencies (plan_id, depends_on_id)
+		SELECT p.id, dp.id FROM plans p
+		JOIN plans dp ON dp.battle_id = p.battle_id AND dp.id <> p.id
+		WHERE p.id = $2 AND p.battle_id = $1 AND dp.id = ANY($3::UUID[])
+		ON CONFLICT DO NOTHING`,
+		BattleID, PlanID, pq.Array(DependsOn),
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to set plan dependencies")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to set plan dependencies")
+	}
+
+	return d.GetPlans(BattleID, warriorID), nil
+}
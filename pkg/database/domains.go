@@ -0,0 +1,95 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// TeamDomain is a hostname or path prefix the instance serves a team's business unit at, with its own branding
+// and battle defaults
+type TeamDomain struct {
+	TeamID string `json:"teamId"`
+	// Host is the hostname requests for the team come in on, empty when only the path prefix is used
+	Host string `json:"host"`
+	// PathPrefix is the first path segment after the instance's path prefix requests for the team come in on,
+	// empty when only the host is used
+	PathPrefix   string `json:"pathPrefix"`
+	AppName      string `json:"appName"`
+	LogoURL      string `json:"logoUrl"`
+	PrimaryColor string `json:"primaryColor"`
+	// Defaults are the defaults of battles created for the team, the organization's when nil
+	Defaults *BattleDefaults `json:"defaults"`
+}
+
+// GetTeamDomains gets the hostnames and path prefixes of every team that has any
+func (d *Database) GetTeamDomains() ([]*TeamDomain, error) {
+	var domains = make([]*TeamDomain, 0)
+	rows, err := d.db.Query(
+		`SELECT team_id, coalesce(host, ''), coalesce(path_prefix, ''), app_name, logo_url, primary_color, defaults
+		FROM team_domains ORDER BY coalesce(host, path_prefix)`,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get team domains")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var td TeamDomain
+		var defaults []byte
+		if err := rows.Scan(&td.TeamID, &td.Host, &td.PathPrefix, &td.AppName, &td.LogoURL, &td.PrimaryColor, &defaults); err != nil {
+			log.Println(err)
+			continue
+		}
+		if defaults != nil {
+			if err := json.Unmarshal(defaults, &td.Defaults); err != nil {
+				log.Println(err)
+			}
+		}
+		domains = append(domains, &td)
+	}
+
+	return domains, nil
+}
+
+// SetTeamDomain saves the team's hostname, path prefix, branding and battle defaults
+func (d *Database) SetTeamDomain(td *TeamDomain) error {
+	var defaults interface{}
+	if td.Defaults != nil {
+		document, err := json.Marshal(td.Defaults)
+		if err != nil {
+			return errors.New("unable to save team domain")
+		}
+		defaults = string(document)
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO team_domains (team_id, host, path_prefix, app_name, logo_url, primary_color, defaults)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7::JSONB)
+		ON CONFLICT (team_id) DO UPDATE SET
+			host = EXCLUDED.host,
+			path_prefix = EXCLUDED.path_prefix,
+			app_name = EXCLUDED.app_name,
+			logo_url = EXCLUDED.logo_url,
+			primary_color = EXCLUDED.primary_color,
+			defaults = EXCLUDED.defaults,
+			updated_date = NOW();`,
+		td.TeamID, td.Host, td.PathPrefix, td.AppName, td.LogoURL, td.PrimaryColor, defaults,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to save team domain")
+	}
+
+	return nil
+}
+
+// DeleteTeamDomain stops serving the team at its own hostname or path prefix
+func (d *Database) DeleteTeamDomain(TeamID string) error {
+	if _, err := d.db.Exec(`DELETE FROM team_domains WHERE team_id = $1;`, TeamID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete team domain")
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// StartDotVoting starts a prioritization round giving each warrior a budget of dots to spread across plans
+func (d *Database) StartDotVoting(BattleID string, warriorID string, DotBudget int) ([]*Plan, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if DotBudget < 1 {
+		return nil, errors.New("dot budget must be at least 1")
+	}
+
+	if _, err := d.db.Exec(
+		`call start_dot_voting($1, $2);`, BattleID, DotBudget); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to start dot voting")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
+// SetWarriorDots replaces the warriors dot allocation, keyed by plan ID, for the current round
+func (d *Database) SetWarriorDots(BattleID string, WarriorID string, PlanDots map[string]int) ([]*Plan, error) {
+	for _, dots := range PlanDots {
+		if dots < 0 {
+			return nil, errors.New("dots can not be negative")
+		}
+	}
+
+	var planDotsJSON, _ = json.Marshal(PlanDots)
+	if _, err := d.db.Exec(
+		`call set_warrior_dots($1, $2, $3);`, BattleID, WarriorID, string(planDotsJSON)); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to set warrior dots")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
+// EndDotVoting ends the prioritization round, persisting dot totals and ordering plans by them
+func (d *Database) EndDotVoting(BattleID string, warriorID string) ([]*Plan, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`call end_dot_voting($1);`, BattleID); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to end dot voting")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
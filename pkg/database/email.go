@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// LogEmailDelivery records an attempt at sending an email
+func (d *Database) LogEmailDelivery(Recipient string, Subject string, Error string) {
+	if _, err := d.db.Exec(
+		`INSERT INTO email_deliveries (recipient, subject, error) VALUES ($1, $2, NULLIF($3, ''));`,
+		Recipient, Subject, Error,
+	); err != nil {
+		log.Println(err)
+	}
+}
+
+// GetEmailDeliveries gets the most recent email delivery attempts, newest first
+func (d *Database) GetEmailDeliveries(Limit int) ([]*EmailDelivery, error) {
+	var deliveries = make([]*EmailDelivery, 0)
+	rows, err := d.db.Query(
+		`SELECT recipient, subject, coalesce(error, ''), created_date
+		FROM email_deliveries ORDER BY id DESC LIMIT $1;`,
+		Limit,
+	)
+	if err != nil {
+		log.Println(err)
+		return deliveries, errors.New("unable to get email deliveries")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e EmailDelivery
+		if err := rows.Scan(&e.Recipient, &e.Subject, &e.Error, &e.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			deliveries = append(deliveries, &e)
+		}
+	}
+
+	return deliveries, nil
+}
+
+// PurgeEmailDeliveries removes email delivery attempts older than the given number of days
+func (d *Database) PurgeEmailDeliveries(DaysOld int) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM email_deliveries WHERE created_date < NOW() - make_interval(days => $1);`,
+		DaysOld,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to purge email deliveries")
+	}
+
+	return nil
+}
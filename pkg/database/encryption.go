@@ -0,0 +1,70 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// encryptedColumns are the tables and columns holding integration credentials, with the columns identifying a row
+var encryptedColumns = []struct {
+	table  string
+	column string
+	key    string
+}{
+	{"team_confluence", "api_token", "team_id::TEXT"},
+	{"team_issue_providers", "api_key", "team_id::TEXT || ':' || provider"},
+	{"team_calendars", "access_token", "team_id::TEXT"},
+	{"team_calendars", "refresh_token", "team_id::TEXT"},
+	{"team_jira_webhooks", "secret", "team_id::TEXT"},
+}
+
+// ReencryptSecrets encrypts the stored credentials still in plaintext or encrypted with a previous key
+// with the current key, returning how many were re-encrypted
+func (d *Database) ReencryptSecrets() (int, error) {
+	if d.secrets == nil {
+		return 0, nil
+	}
+
+	count := 0
+	for _, ec := range encryptedColumns {
+		rows, err := d.db.Query(`SELECT ` + ec.key + `, ` + ec.column + ` FROM ` + ec.table)
+		if err != nil {
+			log.Println(err)
+			return count, errors.New("unable to re-encrypt secrets")
+		}
+		stale := make(map[string]string)
+		for rows.Next() {
+			var RowKey, Value string
+			if err := rows.Scan(&RowKey, &Value); err != nil {
+				log.Println(err)
+			} else if d.secrets.Stale(Value) {
+				stale[RowKey] = Value
+			}
+		}
+		rows.Close()
+
+		for RowKey, Value := range stale {
+			Plain, err := d.secrets.Decrypt(Value)
+			if err != nil {
+				// a key dropped from the keyring too soon, leave it for when the key is back
+				log.Println(ec.table + " " + RowKey + ": " + err.Error())
+				continue
+			}
+			Encrypted, err := d.secrets.Encrypt(Plain)
+			if err != nil {
+				return count, errors.New("unable to re-encrypt secrets")
+			}
+			// only when it wasn't changed in the meantime
+			if _, err := d.db.Exec(
+				`UPDATE `+ec.table+` SET `+ec.column+` = $3 WHERE `+ec.key+` = $1 AND `+ec.column+` = $2`,
+				RowKey, Value, Encrypted,
+			); err != nil {
+				log.Println(err)
+				return count, errors.New("unable to re-encrypt secrets")
+			}
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"time"
+)
+
+// GetFederationPeers gets the instances this one is federated with
+func (d *Database) GetFederationPeers() ([]*FederationPeer, error) {
+	rows, err := d.db.Query(
+		`SELECT id, url, public_key, created_date, updated_date FROM federation_peers ORDER BY url`,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get federation peers")
+	}
+	defer rows.Close()
+
+	var peers = make([]*FederationPeer, 0)
+	for rows.Next() {
+		var p FederationPeer
+		if err := rows.Scan(&p.PeerID, &p.URL, &p.PublicKey, &p.CreatedDate, &p.UpdatedDate); err != nil {
+			log.Println(err)
+		} else {
+			peers = append(peers, &p)
+		}
+	}
+
+	return peers, nil
+}
+
+// GetFederationPeer gets a federation peer by id
+func (d *Database) GetFederationPeer(PeerID string) (*FederationPeer, error) {
+	var p FederationPeer
+	e := d.db.QueryRow(
+		`SELECT id, url, public_key, created_date, updated_date FROM federation_peers WHERE id = $1`,
+		PeerID,
+	).Scan(&p.PeerID, &p.URL, &p.PublicKey, &p.CreatedDate, &p.UpdatedDate)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("federation peer not found")
+	}
+
+	return &p, nil
+}
+
+// GetFederationPeerByURL gets a federation peer by the url it identifies as
+func (d *Database) GetFederationPeerByURL(URL string) (*FederationPeer, error) {
+	var p FederationPeer
+	e := d.db.QueryRow(
+		`SELECT id, url, public_key, created_date, updated_date FROM federation_peers WHERE url = $1`,
+		URL,
+	).Scan(&p.PeerID, &p.URL, &p.PublicKey, &p.CreatedDate, &p.UpdatedDate)
+	if e != nil {
+		if e != sql.ErrNoRows {
+			log.Println(e)
+		}
+		return nil, errors.New("federation peer not found")
+	}
+
+	return &p, nil
+}
+
+// AddFederationPeer pins the public key of the instance at the url, a peer already added has its key replaced
+func (d *Database) AddFederationPeer(URL string, PublicKey string) (*FederationPeer, error) {
+	var p FederationPeer
+	e := d.db.QueryRow(
+		`INSERT INTO federation_peers (url, public_key) VALUES ($1, $2)
+		ON CONFLICT (url) DO UPDATE SET public_key = EXCLUDED.public_key, updated_date = NOW()
+		RETURNING id, url, public_key, created_date, updated_date`,
+		URL, PublicKey,
+	).Scan(&p.PeerID, &p.URL, &p.PublicKey, &p.CreatedDate, &p.UpdatedDate)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to add federation peer")
+	}
+
+	return &p, nil
+}
+
+// DeleteFederationPeer removes the peer along with its battles federations, warriors that arrived
+// from it keep their guest accounts
+func (d *Database) DeleteFederationPeer(PeerID string) error {
+	if _, err := d.db.Exec(`DELETE FROM federation_peers WHERE id = $1`, PeerID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete federation peer")
+	}
+
+	return nil
+}
+
+// FederateBattle lets warriors of the peer join the battle, and relays its events to them
+func (d *Database) FederateBattle(BattleID string, warriorID string, PeerID string) error {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO battle_federations (battle_id, peer_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		BattleID, PeerID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to federate battle")
+	}
+
+	return nil
+}
+
+// UnfederateBattle stops the battle being shared with the peer
+func (d *Database) UnfederateBattle(BattleID string, warriorID string, PeerID string) error {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`DELETE FROM battle_federations WHERE battle_id = $1 AND peer_id = $2`,
+		BattleID, PeerID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to unfederate battle")
+	}
+
+	return nil
+}
+
+// GetBattleFederationPeers gets the peers a battle is shared with
+func (d *Database) GetBattleFederationPeers(BattleID string) ([]*FederationPeer, error) {
+	rows, err := d.db.Query(
+		`SELECT p.id, p.url, p.public_key, p.created_date, p.updated_date
+		FROM battle_federations bf
+		JOIN federation_peers p ON p.id = bf.peer_id
+		WHERE bf.battle_id = $1 ORDER BY p.url`,
+		BattleID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get battle federation peers")
+	}
+	defer rows.Close()
+
+	var peers = make([]*FederationPeer, 0)
+	for rows.Next() {
+		var p FederationPeer
+		if err := rows.Scan(&p.PeerID, &p.URL, &p.PublicKey, &p.CreatedDate, &p.UpdatedDate); err != nil {
+			log.Println(err)
+		} else {
+			peers = append(peers, &p)
+		}
+	}
+
+	return peers, nil
+}
+
+// IsBattleFederated checks the battle is shared with the peer
+func (d *Database) IsBattleFederated(BattleID string, PeerID string) bool {
+	var federated bool
+	e := d.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM battle_federations WHERE battle_id = $1 AND peer_id = $2)`,
+		BattleID, PeerID,
+	).Scan(&federated)
+	if e != nil {
+		log.Println(e)
+		return false
+	}
+
+	return federated
+}
+
+// UseFederationNonce accepts the nonce of a passport from the peer once, erroring when it was already used. Nonces
+// are kept until their passport expires, by when it'd be refused anyway
+func (d *Database) UseFederationNonce(PeerID string, Nonce string, Expires time.Time) error {
+	if _, err := d.db.Exec(`DELETE FROM federation_nonces WHERE expire_date < NOW();`); err != nil {
+		log.Println(err)
+	}
+
+	res, err := d.db.Exec(
+		`INSERT INTO federation_nonces (peer_id, nonce, expire_date) VALUES ($1, $2, NOW() + make_interval(secs => $3))
+		ON CONFLICT DO NOTHING;`,
+		PeerID, Nonce, math.Ceil(time.Until(Expires).Seconds()),
+	)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to use federation nonce")
+	}
+	if inserted, _ := res.RowsAffected(); inserted == 0 {
+		return errors.New("federation nonce already used")
+	}
+
+	return nil
+}
+
+// AddFederationWatcher lets the warrior watch the peer's battle they were issued a passport for from here
+func (d *Database) AddFederationWatcher(PeerID string, BattleID string, WarriorID string) error {
+	if _, err := d.db.Exec(
+		`INSERT INTO federation_watchers (peer_id, battle_id, warrior_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;`,
+		PeerID, BattleID, WarriorID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to add federation watcher")
+	}
+
+	return nil
+}
+
+// IsFederationWatcher checks the warrior may watch the peer's battle from here
+func (d *Database) IsFederationWatcher(PeerID string, BattleID string, WarriorID string) bool {
+	var watcher bool
+	e := d.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM federation_watchers WHERE peer_id = $1 AND battle_id = $2 AND warrior_id = $3)`,
+		PeerID, BattleID, WarriorID,
+	).Scan(&watcher)
+	if e != nil {
+		log.Println(e)
+		return false
+	}
+
+	return watcher
+}
+
+// FederatedWarrior gets the local guest warrior standing in for a warrior of the peer, creating them on their first
+// arrival and keeping their name in step with the peer after that
+func (d *Database) FederatedWarrior(PeerID string, RemoteWarriorID string, WarriorName string) (*Warrior, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get federated warrior")
+	}
+	defer tx.Rollback()
+
+	var WarriorID string
+	e := tx.QueryRow(
+		`SELECT warrior_id FROM federated_warriors WHERE peer_id = $1 AND remote_warrior_id = $2`,
+		PeerID, RemoteWarriorID,
+	).Scan(&WarriorID)
+	switch {
+	case e == sql.ErrNoRows:
+		if err := tx.QueryRow(
+			`INSERT INTO warriors (name) VALUES ($1) RETURNING id`, WarriorName,
+		).Scan(&WarriorID); err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to create federated warrior")
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO federated_warriors (peer_id, remote_warrior_id, warrior_id) VALUES ($1, $2, $3)`,
+			PeerID, RemoteWarriorID, WarriorID,
+		); err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to create federated warrior")
+		}
+	case e != nil:
+		log.Println(e)
+		return nil, errors.New("unable to get federated warrior")
+	default:
+		if _, err := tx.Exec(`UPDATE warriors SET name = $2 WHERE id = $1`, WarriorID, WarriorName); err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to get federated warrior")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get federated warrior")
+	}
+
+	return d.GetWarrior(WarriorID)
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrFeedbackClosed is returned when the warrior didn't take part in the session, already gave their feedback or
+// the session ended too long ago
+var ErrFeedbackClosed = errors.New("feedback closed")
+
+// maxFeedbackComments is the most recent comments kept in each summary
+const maxFeedbackComments = 10
+
+// SubmitSessionFeedback records the warrior's rating of an ended battle, the feedback itself isn't linked to them,
+// only that they responded so they can't respond twice
+func (d *Database) SubmitSessionFeedback(SessionID string, WarriorID string, Rating int, Comment string) error {
+	if Rating < 1 || Rating > 5 {
+		return errors.New("rating must be between 1 and 5")
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to submit feedback")
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE battle_session_warriors sw SET responded = true
+		FROM battle_sessions s
+		WHERE s.id = sw.session_id AND sw.session_id = $1 AND sw.warrior_id = $2 AND sw.responded = false
+		AND s.ended_date > NOW() - INTERVAL '7 days'`,
+		SessionID, WarriorID,
+	)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to submit feedback")
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrFeedbackClosed
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO battle_session_feedback (session_id, rating, comment) VALUES ($1, $2, $3)`,
+		SessionID, Rating, Comment,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to submit feedback")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return errors.New("unable to submit feedback")
+	}
+
+	return nil
+}
+
+// getFeedbackSummaries sums up the feedback of the sessions ended since from, grouped by the column given
+func (d *Database) getFeedbackSummaries(Group string, Name string, Join string, From time.Time) ([]*FeedbackSummary, error) {
+	var summaries = make([]*FeedbackSummary, 0)
+	rows, err := d.db.Query(
+		`SELECT `+Group+`, `+Name+`, COUNT(DISTINCT s.id), COUNT(f.rating), coalesce(AVG(f.rating), 0),
+			coalesce((array_agg(f.comment ORDER BY f.created_date DESC) FILTER (WHERE f.comment <> ''))[1:$2], '{}')
+		FROM battle_sessions s
+		`+Join+`
+		LEFT JOIN battle_session_feedback f ON f.session_id = s.id
+		WHERE s.ended_date >= $1
+		GROUP BY `+Group+`, `+Name+`
+		ORDER BY `+Name,
+		From, maxFeedbackComments,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get feedback")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fs FeedbackSummary
+		if err := rows.Scan(&fs.ID, &fs.Name, &fs.Sessions, &fs.Responses, &fs.AverageRating, pq.Array(&fs.Comments)); err != nil {
+			log.Println(err)
+		} else {
+			summaries = append(summaries, &fs)
+		}
+	}
+
+	return summaries, nil
+}
+
+// GetSessionFeedback sums up the feedback on the sessions ended since from by facilitator and by team
+func (d *Database) GetSessionFeedback(From time.Time) (*SessionFeedback, error) {
+	Facilitators, err := d.getFeedbackSummaries("s.leader_id", "w.name", "JOIN warriors w ON w.id = s.leader_id", From)
+	if err != nil {
+		return nil, err
+	}
+	Teams, err := d.getFeedbackSummaries("s.team_id", "t.name", "JOIN teams t ON t.id = s.team_id", From)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionFeedback{Facilitators: Facilitators, Teams: Teams}, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// perfectConsensusPlans is how many plans a battle needs pointed, every one without a differing vote, to count as a
+// perfect consensus
+const perfectConsensusPlans = 3
+
+// participationQuery counts each warrior's participation, the warriors being narrowed down by the condition
+const participationQuery = `SELECT w.id, w.name,
+	(SELECT count(*) FROM battles_warriors bw WHERE bw.warrior_id = w.id),
+	(SELECT count(*) FROM battles b WHERE b.leader_id = w.id),
+	(SELECT count(*) FROM plans p, jsonb_array_elements(p.votes) v WHERE v->>'warriorId' = w.id::TEXT),
+	(SELECT count(*) FROM battles_warriors bw WHERE bw.warrior_id = w.id
+		AND (SELECT count(*) FROM plans p WHERE p.battle_id = bw.battle_id AND p.points <> '') >= $2
+		AND NOT EXISTS (
+			SELECT 1 FROM plans p WHERE p.battle_id = bw.battle_id AND p.points <> '' AND (
+				jsonb_array_length(p.votes) < 2
+				OR (SELECT count(DISTINCT v->>'vote') FROM jsonb_array_elements(p.votes) v) > 1
+			)
+		))
+FROM warriors w
+`
+
+// scanParticipation reads a row of the participation query
+func scanParticipation(Scan func(dest ...interface{}) error) (*WarriorParticipation, error) {
+	var p WarriorParticipation
+	if err := Scan(&p.WarriorID, &p.WarriorName, &p.BattlesJoined, &p.BattlesLed, &p.VotesCast, &p.PerfectConsensusBattles); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// GetWarriorParticipation counts the battles the warrior joined and led, their votes and the battles they were in
+// where every plan was pointed without a differing vote
+func (d *Database) GetWarriorParticipation(WarriorID string) (*WarriorParticipation, error) {
+	p, err := scanParticipation(d.db.QueryRow(
+		participationQuery+`WHERE w.id = $1`, WarriorID, perfectConsensusPlans,
+	).Scan)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get warrior participation")
+	}
+
+	return p, nil
+}
+
+// GetTeamParticipation counts the participation of each of the team's warriors
+func (d *Database) GetTeamParticipation(TeamID string) ([]*WarriorParticipation, error) {
+	var participation = make([]*WarriorParticipation, 0)
+	rows, err := d.db.Query(
+		participationQuery+`JOIN team_warriors tw ON tw.warrior_id = w.id WHERE tw.team_id = $1`,
+		TeamID, perfectConsensusPlans,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get team participation")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanParticipation(rows.Scan)
+		if err != nil {
+			log.Println(err)
+		} else {
+			participation = append(participation, p)
+		}
+	}
+
+	return participation, nil
+}
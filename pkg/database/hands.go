@@ -0,0 +1,105 @@
+package database
+
+import (
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// GetRaisedHands gets the battles speaking queue, first to speak first
+func (d *Database) GetRaisedHands(BattleID string) []*RaisedHand {
+	var hands = make([]*RaisedHand, 0)
+	rows, err := d.db.Query(
+		`SELECT warrior_id, raised_date FROM battle_raised_hands WHERE battle_id = $1 ORDER BY position, raised_date`,
+		BattleID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var rh RaisedHand
+			if err := rows.Scan(&rh.WarriorID, &rh.RaisedDate); err != nil {
+				log.Println(err)
+			} else {
+				hands = append(hands, &rh)
+			}
+		}
+	}
+
+	return hands
+}
+
+// RaiseHand adds the warrior to the end of the battles speaking queue, a hand already raised keeps its place
+func (d *Database) RaiseHand(BattleID string, WarriorID string) ([]*RaisedHand, error) {
+	if _, err := d.db.Exec(
+		`INSERT INTO battle_raised_hands (battle_id, warrior_id, position)
+		SELECT $1, $2, coalesce(MAX(position), 0) + 1 FROM battle_raised_hands WHERE battle_id = $1
+		ON CONFLICT (battle_id, warrior_id) DO NOTHING`,
+		BattleID, WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to raise hand")
+	}
+
+	return d.GetRaisedHands(BattleID), nil
+}
+
+// LowerHand takes the warrior out of the battles speaking queue, the warrior lowering it being the one whose hand it
+// is or the battles leader
+func (d *Database) LowerHand(BattleID string, warriorID string, WarriorID string) ([]*RaisedHand, error) {
+	if warriorID != WarriorID {
+		if err := d.ConfirmLeader(BattleID, warriorID); err != nil {
+			return nil, errors.New("incorrect permissions")
+		}
+	}
+
+	if _, err := d.db.Exec(
+		`DELETE FROM battle_raised_hands WHERE battle_id = $1 AND warrior_id = $2`,
+		BattleID, WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to lower hand")
+	}
+
+	return d.GetRaisedHands(BattleID), nil
+}
+
+// ClearRaisedHands empties the battles speaking queue
+func (d *Database) ClearRaisedHands(BattleID string, warriorID string) ([]*RaisedHand, error) {
+	if err := d.ConfirmLeader(BattleID, warriorID); err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`DELETE FROM battle_raised_hands WHERE battle_id = $1`, BattleID); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to clear raised hands")
+	}
+
+	return d.GetRaisedHands(BattleID), nil
+}
+
+// ReorderRaisedHands puts the battles speaking queue in the order of the warriors given, hands raised since the
+// leader saw the queue follow in the order they were
+func (d *Database) ReorderRaisedHands(BattleID string, warriorID string, WarriorIDs []string) ([]*RaisedHand, error) {
+	if err := d.ConfirmLeader(BattleID, warriorID); err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE battle_raised_hands h SET position = o.position
+		FROM (
+			SELECT rh.warrior_id, ROW_NUMBER() OVER (ORDER BY r.ord NULLS LAST, rh.position, rh.raised_date) AS position
+			FROM battle_raised_hands rh
+			LEFT JOIN unnest($2::UUID[]) WITH ORDINALITY AS r(warrior_id, ord) ON r.warrior_id = rh.warrior_id
+			WHERE rh.battle_id = $1
+		) o
+		WHERE h.battle_id = $1 AND h.warrior_id = o.warrior_id`,
+		BattleID, pq.Array(WarriorIDs),
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to reorder raised hands")
+	}
+
+	return d.GetRaisedHands(BattleID), nil
+}
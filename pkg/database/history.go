@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// battleStateAt selects the latest event of each battle and plan entity up to $2 that has ever been part of the
+// battle $1, so plans moved to a breakout and back end up where they were at the time
+const battleStateAt = `
+	SELECT DISTINCT ON (entity_id) op, state FROM battle_state_events
+	WHERE entity_id IN (SELECT entity_id FROM battle_state_events WHERE battle_id = $1 AND entity = $3)
+	AND created_date <= $2
+	ORDER BY entity_id, id DESC
+`
+
+// CompactBattleHistory collapses the battle state log older than the given number of days into the state of each
+// battle and plan as of then, so it doesn't grow without bound while the battle can still be seen at any point since
+func (d *Database) CompactBattleHistory(DaysOld int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to compact battle history")
+	}
+	defer tx.Rollback()
+
+	// all but the latest event of each battle and plan before the cutoff, which becomes its snapshot
+	if _, err := tx.Exec(
+		`DELETE FROM battle_state_events e
+		WHERE e.created_date < NOW() - make_interval(days => $1)
+		AND EXISTS (
+			SELECT 1 FROM battle_state_events l
+			WHERE l.entity_id = e.entity_id AND l.id > e.id AND l.created_date < NOW() - make_interval(days => $1)
+		)`,
+		DaysOld,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to compact battle history")
+	}
+	// whatever was deleted before the cutoff isn't there to be seen after it
+	if _, err := tx.Exec(
+		`DELETE FROM battle_state_events WHERE op = 'delete' AND created_date < NOW() - make_interval(days => $1)`,
+		DaysOld,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to compact battle history")
+	}
+	if _, err := tx.Exec(
+		`UPDATE battle_state_events SET op = 'snapshot'
+		WHERE op <> 'snapshot' AND created_date < NOW() - make_interval(days => $1)`,
+		DaysOld,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to compact battle history")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return errors.New("unable to compact battle history")
+	}
+
+	return nil
+}
+
+// GetBattleAt projects the battle and its plans as they were at the time from the battle state log
+func (d *Database) GetBattleAt(BattleID string, WarriorID string, At time.Time) (*Battle, error) {
+	if !d.IsBattleWarrior(BattleID, WarriorID) {
+		return nil, errors.New("warrior not in battle")
+	}
+
+	var b = &Battle{
+		BattleID:           BattleID,
+		Warriors:           make([]*BattleWarrior, 0),
+		Plans:              make([]*Plan, 0),
+		PointValuesAllowed: make([]string, 0),
+		Checklist:          make([]*ChecklistItem, 0),
+		Breakouts:          make([]*Breakout, 0),
+	}
+
+	var ActivePlanID sql.NullString
+	var TeamID sql.NullString
+	var ParentID sql.NullString
+	var pv string
+	e := d.db.QueryRow(
+		`SELECT b.name, b.leader_id, b.voting_locked, b.active_plan_id, b.point_values_allowed, b.auto_finish_voting,
+			b.timezone, b.locale, b.team_id, b.require_ready, b.dot_budget, b.parent_id, b.created_date, b.updated_date
+		FROM (`+battleStateAt+`) e, jsonb_populate_record(NULL::battles, e.state) b
+		WHERE e.op <> 'delete' AND b.id = $1`,
+		BattleID, At, "battle",
+	).Scan(
+		&b.BattleName,
+		&b.LeaderID,
+		&b.VotingLocked,
+		&ActivePlanID,
+		&pv,
+		&b.AutoFinishVoting,
+		&b.Timezone,
+		&b.Locale,
+		&TeamID,
+		&b.RequireReady,
+		&b.DotBudget,
+		&ParentID,
+		&b.CreatedDate,
+		&b.UpdatedDate,
+	)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("not found")
+	}
+	utc(&b.CreatedDate, &b.UpdatedDate)
+	_ = json.Unmarshal([]byte(pv), &b.PointValuesAllowed)
+	b.ActivePlanID = ActivePlanID.String
+	b.TeamID = TeamID.String
+	b.ParentID = ParentID.String
+
+	planRows, err := d.db.Query(
+		`SELECT p.id, p.name, coalesce(p.type, ''), coalesce(p.reference_id, ''), coalesce(p.link, ''),
+			coalesce(p.description, ''), coalesce(p.acceptance_criteria, ''), p.points, p.active, coalesce(p.skipped, false),
+			p.votestart_time, p.voteend_time, p.votes, coalesce(p.parent_id::TEXT, ''), coalesce(p.split, false),
+			coalesce(p.version, 1), coalesce(p.issue_provider, ''), coalesce(p.external_id, ''), coalesce(p.dots, 0),
+			p.created_date, p.updated_date
+		FROM (`+battleStateAt+`) e, jsonb_populate_record(NULL::plans, e.state) p
+		WHERE e.op <> 'delete' AND p.battle_id = $1
+		ORDER BY p.sort_order, p.created_date`,
+		BattleID, At, "plan",
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get battle history")
+	}
+	defer planRows.Close()
+
+	for planRows.Next() {
+		var v string
+		var p = &Plan{
+			Votes:     make([]*Vote, 0),
+			Checked:   make([]string, 0),
+			Questions: make([]*PlanQuestion, 0),
+		}
+		if err := planRows.Scan(
+			&p.PlanID, &p.PlanName, &p.Type, &p.ReferenceID, &p.Link, &p.Description, &p.AcceptanceCriteria, &p.Points,
+			&p.PlanActive, &p.PlanSkipped, &p.VoteStartTime, &p.VoteEndTime, &v, &p.ParentID, &p.Split, &p.Version,
+			&p.IssueProvider, &p.ExternalID, &p.Dots, &p.CreatedDate, &p.UpdatedDate,
+		); err != nil {
+			log.Println(err)
+			continue
+		}
+		_ = json.Unmarshal([]byte(v), &p.Votes)
+		utc(&p.CreatedDate, &p.UpdatedDate)
+		utcVotes(p.Votes)
+
+		// same as the live plans, votes on the plan being voted on stay hidden
+		for _, vote := range p.Votes {
+			if p.PlanActive && vote.WarriorID != WarriorID {
+				vote.VoteValue = ""
+			}
+		}
+
+		b.Plans = append(b.Plans, p)
+	}
+	b.PlanCount = len(b.Plans)
+
+	return b, nil
+}
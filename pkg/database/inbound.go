@@ -0,0 +1,97 @@
+package database
+
+import (
+	"crypto/rand"
+	"errors"
+	"log"
+)
+
+// generate a random lowercase alphanumeric code safe to use in an email address
+func emailCode(length int) (string, error) {
+	chars := "0123456789abcdefghijklmnopqrstuvwxyz"
+	bytes := make([]byte, length)
+
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	for i, b := range bytes {
+		bytes[i] = chars[b%byte(len(chars))]
+	}
+
+	return string(bytes), nil
+}
+
+// GetBattleEmailCode gets the code plans are emailed to the battle with, empty when emailing plans is off
+func (d *Database) GetBattleEmailCode(BattleID string, warriorID string) (string, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return "", errors.New("incorrect permissions")
+	}
+
+	var Code string
+	if err := d.db.QueryRow(
+		`SELECT coalesce(email_code, '') FROM battles WHERE id = $1;`, BattleID,
+	).Scan(&Code); err != nil {
+		log.Println(err)
+		return "", errors.New("unable to get battle email code")
+	}
+
+	return Code, nil
+}
+
+// SetBattleEmailCode generates a new email code for the battle, replacing any previous one
+func (d *Database) SetBattleEmailCode(BattleID string, warriorID string) (string, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return "", errors.New("incorrect permissions")
+	}
+
+	Code, err := emailCode(12)
+	if err != nil {
+		log.Println(err)
+		return "", errors.New("unable to generate battle email code")
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE battles SET updated_date = NOW(), email_code = $2 WHERE id = $1;`, BattleID, Code,
+	); err != nil {
+		log.Println(err)
+		return "", errors.New("unable to set battle email code")
+	}
+
+	return Code, nil
+}
+
+// DeleteBattleEmailCode turns off emailing plans to the battle
+func (d *Database) DeleteBattleEmailCode(BattleID string, warriorID string) error {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE battles SET updated_date = NOW(), email_code = NULL WHERE id = $1;`, BattleID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete battle email code")
+	}
+
+	return nil
+}
+
+// AddEmailedPlan adds a plan from an email to the battle with the email code, returning the battle ID and its plans
+func (d *Database) AddEmailedPlan(Code string, PlanName string, Description string) (string, []*Plan, error) {
+	var BattleID string
+	if err := d.db.QueryRow(
+		`INSERT INTO plans (battle_id, name, type, description)
+		SELECT id, $2, 'Story', $3 FROM battles WHERE email_code = $1
+		RETURNING battle_id;`,
+		Code, PlanName, Description,
+	).Scan(&BattleID); err != nil {
+		log.Println(err)
+		return "", nil, errors.New("unable to add emailed plan")
+	}
+
+	return BattleID, d.GetPlans(BattleID, ""), nil
+}
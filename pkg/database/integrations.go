@@ -0,0 +1,192 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// TeamConfluence is a teams Confluence integration settings
+type TeamConfluence struct {
+	BaseURL      string `json:"baseUrl"`
+	SpaceKey     string `json:"spaceKey"`
+	ParentPageID string `json:"parentPageId"`
+	Username     string `json:"username"`
+	APIToken     string `json:"-"`
+}
+
+// GetTeamConfluence gets the teams Confluence settings, nil when the team hasn't configured it
+func (d *Database) GetTeamConfluence(TeamID string) (*TeamConfluence, error) {
+	var c TeamConfluence
+	e := d.db.QueryRow(
+		`SELECT base_url, space_key, coalesce(parent_page_id, ''), username, api_token FROM team_confluence WHERE team_id = $1`,
+		TeamID,
+	).Scan(&c.BaseURL, &c.SpaceKey, &c.ParentPageID, &c.Username, &c.APIToken)
+	if e == sql.ErrNoRows {
+		return nil, nil
+	}
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to get confluence settings")
+	}
+	if c.APIToken, e = d.secrets.Decrypt(c.APIToken); e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to get confluence settings")
+	}
+
+	return &c, nil
+}
+
+// SetTeamConfluence saves the teams Confluence settings, an empty APIToken keeps the current one
+func (d *Database) SetTeamConfluence(TeamID string, c *TeamConfluence) error {
+	APIToken, err := d.secrets.Encrypt(c.APIToken)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to save confluence settings")
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO team_confluence (team_id, base_url, space_key, parent_page_id, username, api_token)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+		ON CONFLICT (team_id) DO UPDATE SET
+			base_url = EXCLUDED.base_url,
+			space_key = EXCLUDED.space_key,
+			parent_page_id = EXCLUDED.parent_page_id,
+			username = EXCLUDED.username,
+			api_token = coalesce(NULLIF($6, ''), team_confluence.api_token),
+			updated_date = NOW();`,
+		TeamID, c.BaseURL, c.SpaceKey, c.ParentPageID, c.Username, APIToken,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to save confluence settings")
+	}
+
+	return nil
+}
+
+// DeleteTeamConfluence removes the teams Confluence integration
+func (d *Database) DeleteTeamConfluence(TeamID string) error {
+	if _, err := d.db.Exec(`DELETE FROM team_confluence WHERE team_id = $1;`, TeamID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete confluence settings")
+	}
+
+	return nil
+}
+
+// GetTeamIssueProviders gets the names of the issue providers the team has configured
+func (d *Database) GetTeamIssueProviders(TeamID string) ([]string, error) {
+	var providers = make([]string, 0)
+	rows, err := d.db.Query(`SELECT provider FROM team_issue_providers WHERE team_id = $1 ORDER BY provider;`, TeamID)
+	if err != nil {
+		log.Println(err)
+		return providers, errors.New("unable to get issue providers")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var Provider string
+		if err := rows.Scan(&Provider); err != nil {
+			log.Println(err)
+		} else {
+			providers = append(providers, Provider)
+		}
+	}
+
+	return providers, nil
+}
+
+// GetTeamIssueProviderKey gets the teams api key for an issue provider, empty when the team hasn't configured it
+func (d *Database) GetTeamIssueProviderKey(TeamID string, Provider string) (string, error) {
+	var APIKey string
+	e := d.db.QueryRow(
+		`SELECT api_key FROM team_issue_providers WHERE team_id = $1 AND provider = $2`,
+		TeamID, Provider,
+	).Scan(&APIKey)
+	if e == sql.ErrNoRows {
+		return "", nil
+	}
+	if e != nil {
+		log.Println(e)
+		return "", errors.New("unable to get issue provider settings")
+	}
+	if APIKey, e = d.secrets.Decrypt(APIKey); e != nil {
+		log.Println(e)
+		return "", errors.New("unable to get issue provider settings")
+	}
+
+	return APIKey, nil
+}
+
+// SetTeamIssueProviderKey saves the teams api key for an issue provider
+func (d *Database) SetTeamIssueProviderKey(TeamID string, Provider string, APIKey string) error {
+	APIKey, err := d.secrets.Encrypt(APIKey)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to save issue provider settings")
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO team_issue_providers (team_id, provider, api_key) VALUES ($1, $2, $3)
+		ON CONFLICT (team_id, provider) DO UPDATE SET api_key = EXCLUDED.api_key, updated_date = NOW();`,
+		TeamID, Provider, APIKey,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to save issue provider settings")
+	}
+
+	return nil
+}
+
+// GetTeamJiraWebhookSecret gets the secret the teams Jira webhook signs its requests with, empty when the team
+// hasn't got one yet
+func (d *Database) GetTeamJiraWebhookSecret(TeamID string) (string, error) {
+	var Secret string
+	e := d.db.QueryRow(`SELECT secret FROM team_jira_webhooks WHERE team_id = $1`, TeamID).Scan(&Secret)
+	if e == sql.ErrNoRows {
+		return "", nil
+	}
+	if e != nil {
+		log.Println(e)
+		return "", errors.New("unable to get jira webhook secret")
+	}
+	if Secret, e = d.secrets.Decrypt(Secret); e != nil {
+		log.Println(e)
+		return "", errors.New("unable to get jira webhook secret")
+	}
+
+	return Secret, nil
+}
+
+// CreateTeamJiraWebhookSecret saves the secret for the teams Jira webhook unless it already has one, getting the
+// teams secret
+func (d *Database) CreateTeamJiraWebhookSecret(TeamID string, Secret string) (string, error) {
+	Encrypted, err := d.secrets.Encrypt(Secret)
+	if err != nil {
+		log.Println(err)
+		return "", errors.New("unable to save jira webhook secret")
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO team_jira_webhooks (team_id, secret) VALUES ($1, $2) ON CONFLICT (team_id) DO NOTHING;`,
+		TeamID, Encrypted,
+	); err != nil {
+		log.Println(err)
+		return "", errors.New("unable to save jira webhook secret")
+	}
+
+	return d.GetTeamJiraWebhookSecret(TeamID)
+}
+
+// DeleteTeamIssueProviderKey removes the teams issue provider integration
+func (d *Database) DeleteTeamIssueProviderKey(TeamID string, Provider string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM team_issue_providers WHERE team_id = $1 AND provider = $2;`,
+		TeamID, Provider,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete issue provider settings")
+	}
+
+	return nil
+}
@@ -0,0 +1,348 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// IssueFields are the plan fields kept in sync with the tracker issue the plan was imported from
+var IssueFields = []string{"name", "description"}
+
+// ErrIssueConflictNotFound is returned when resolving a conflict the plan doesn't have
+var ErrIssueConflictNotFound = errors.New("issue conflict not found")
+
+// how a field edited in the plan, the issue or both converges
+const (
+	issueFieldUnchanged = iota
+	// both sides made the same edit
+	issueFieldAgreed
+	// only the issue was edited, the plan takes it
+	issueFieldTakeTheirs
+	// only the plan was edited, the issue gets it
+	issueFieldPush
+	// both sides were edited differently
+	issueFieldConflict
+)
+
+// reconcileIssueField decides how a field converges from the plans and the issues value
+// given the value both last agreed on
+func reconcileIssueField(Mine string, Base string, Theirs string) int {
+	switch {
+	case Mine == Theirs && Theirs == Base:
+		return issueFieldUnchanged
+	case Mine == Theirs:
+		return issueFieldAgreed
+	case Theirs == Base:
+		return issueFieldPush
+	case Mine == Base:
+		return issueFieldTakeTheirs
+	default:
+		return issueFieldConflict
+	}
+}
+
+// setIssueField records the value both sides agreed on for the plans field along with the issues value
+// when they're in conflict, a nil Theirs clearing the conflict
+func setIssueField(tx *sql.Tx, PlanID string, Field string, Base string, Theirs *string) error {
+	_, err := tx.Exec(
+		`INSERT INTO plan_issue_fields (plan_id, field, base, theirs) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (plan_id, field) DO UPDATE SET base = EXCLUDED.base, theirs = EXCLUDED.theirs, updated_date = NOW();`,
+		PlanID, Field, Base, Theirs,
+	)
+
+	return err
+}
+
+// setPlanField sets one of the IssueFields of the plan
+func setPlanField(tx *sql.Tx, PlanID string, Field string, Value string) error {
+	Column := "name"
+	if Field == "description" {
+		Column = "description"
+	}
+	_, err := tx.Exec(
+		`UPDATE plans SET `+Column+` = $2, version = version + 1, updated_date = NOW() WHERE id = $1;`,
+		PlanID, Value,
+	)
+
+	return err
+}
+
+// reconcileIssuePlan brings the plan and the issues fields together, taking the issues edits, recording
+// conflicts and getting the plans own edits to push, a plan that no longer exists gets nil
+func reconcileIssuePlan(tx *sql.Tx, PlanID string, Theirs map[string]string) (*SyncedPlan, error) {
+	Synced := &SyncedPlan{PlanID: PlanID, Conflicts: make([]string, 0), Push: make(map[string]string)}
+	Mine := make(map[string]string)
+	var Name, Description string
+	err := tx.QueryRow(
+		`SELECT battle_id, coalesce(issue_provider, ''), coalesce(name, ''), coalesce(description, '')
+		FROM plans WHERE id = $1 FOR UPDATE;`,
+		PlanID,
+	).Scan(&Synced.BattleID, &Synced.Provider, &Name, &Description)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	Mine["name"] = Name
+	Mine["description"] = Description
+	Synced.PlanName = Name
+
+	Bases := make(map[string]string)
+	Pending := make(map[string]bool)
+	rows, err := tx.Query(`SELECT field, base, theirs IS NOT NULL FROM plan_issue_fields WHERE plan_id = $1;`, PlanID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var Field, Base string
+		var Conflicted bool
+		if err := rows.Scan(&Field, &Base, &Conflicted); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		Bases[Field] = Base
+		Pending[Field] = Conflicted
+	}
+	rows.Close()
+
+	for _, Field := range IssueFields {
+		theirs, ok := Theirs[Field]
+		if !ok {
+			continue
+		}
+		mine := Mine[Field]
+		// plans imported before their fields were tracked last agreed with the issue on what they have
+		base, known := Bases[Field]
+		if !known {
+			base = mine
+		}
+
+		switch reconcileIssueField(mine, base, theirs) {
+		case issueFieldTakeTheirs:
+			if err := setPlanField(tx, PlanID, Field, theirs); err != nil {
+				return nil, err
+			}
+			err = setIssueField(tx, PlanID, Field, theirs, nil)
+			Synced.Changed = true
+			if Field == "name" {
+				Synced.PlanName = theirs
+			}
+		case issueFieldAgreed:
+			err = setIssueField(tx, PlanID, Field, theirs, nil)
+		case issueFieldConflict:
+			err = setIssueField(tx, PlanID, Field, base, &theirs)
+			Synced.Conflicts = append(Synced.Conflicts, Field)
+		case issueFieldPush:
+			Synced.Push[Field] = mine
+			fallthrough
+		default:
+			// the issue went back to what was agreed so an earlier conflict is gone
+			if Pending[Field] {
+				err = setIssueField(tx, PlanID, Field, base, nil)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Synced, nil
+}
+
+// SyncIssuePlans reconciles the unpointed plans imported from the issue into the teams battles with the issues
+// fields after it was edited in the tracker. It gets the plans that took changes or ran into conflicts
+// and the plans of each battle that changed by battle ID
+func (d *Database) SyncIssuePlans(TeamID string, Provider string, ExternalID string, Theirs map[string]string) ([]*SyncedPlan, map[string][]*Plan, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, nil, errors.New("unable to sync issue plans")
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT p.id FROM plans p JOIN battles b ON b.id = p.battle_id
+		WHERE b.team_id = $1 AND p.issue_provider = $2 AND p.external_id = $3 AND p.points = '';`,
+		TeamID, Provider, ExternalID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, nil, errors.New("unable to sync issue plans")
+	}
+	var PlanIDs []string
+	for rows.Next() {
+		var PlanID string
+		if err := rows.Scan(&PlanID); err == nil {
+			PlanIDs = append(PlanIDs, PlanID)
+		}
+	}
+	rows.Close()
+
+	Synced := make([]*SyncedPlan, 0)
+	for _, PlanID := range PlanIDs {
+		s, err := reconcileIssuePlan(tx, PlanID, Theirs)
+		if err != nil {
+			log.Println(err)
+			return nil, nil, errors.New("unable to sync issue plans")
+		}
+		if s != nil && (s.Changed || len(s.Conflicts) > 0) {
+			Synced = append(Synced, s)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, nil, errors.New("unable to sync issue plans")
+	}
+
+	BattlePlans := make(map[string][]*Plan)
+	for _, s := range Synced {
+		if _, ok := BattlePlans[s.BattleID]; s.Changed && !ok {
+			BattlePlans[s.BattleID] = d.GetPlans(s.BattleID, "")
+		}
+	}
+
+	return Synced, BattlePlans, nil
+}
+
+// ReconcileIssuePlan reconciles a plan with the fields of the issue it was imported from after the plan was edited,
+// getting the outcome with the fields to push to the issue and the battles plans when the plan took changes.
+// A plan that no longer exists gets nil
+func (d *Database) ReconcileIssuePlan(PlanID string, Theirs map[string]string) (*SyncedPlan, []*Plan, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, nil, errors.New("unable to reconcile issue plan")
+	}
+	defer tx.Rollback()
+
+	Synced, err := reconcileIssuePlan(tx, PlanID, Theirs)
+	if err != nil {
+		log.Println(err)
+		return nil, nil, errors.New("unable to reconcile issue plan")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, nil, errors.New("unable to reconcile issue plan")
+	}
+
+	var Plans []*Plan
+	if Synced != nil && Synced.Changed {
+		Plans = d.GetPlans(Synced.BattleID, "")
+	}
+
+	return Synced, Plans, nil
+}
+
+// SetIssuePlanBase records the fields as agreed between the plan and its issue once they've been pushed to it
+func (d *Database) SetIssuePlanBase(PlanID string, Fields map[string]string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to set issue plan base")
+	}
+	defer tx.Rollback()
+
+	for Field, Value := range Fields {
+		if err := setIssueField(tx, PlanID, Field, Value, nil); err != nil {
+			log.Println(err)
+			return errors.New("unable to set issue plan base")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return errors.New("unable to set issue plan base")
+	}
+
+	return nil
+}
+
+// GetIssueConflicts gets the fields of the battles plans edited differently in the plan and its issue
+func (d *Database) GetIssueConflicts(BattleID string, warriorID string) ([]*IssueConflict, error) {
+	if err := d.ConfirmLeader(BattleID, warriorID); err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	var Conflicts = make([]*IssueConflict, 0)
+	rows, err := d.db.Query(
+		`SELECT f.plan_id, coalesce(p.name, ''), f.field,
+			CASE f.field WHEN 'description' THEN coalesce(p.description, '') ELSE coalesce(p.name, '') END,
+			f.theirs, f.base, f.updated_date
+		FROM plan_issue_fields f JOIN plans p ON p.id = f.plan_id
+		WHERE p.battle_id = $1 AND f.theirs IS NOT NULL
+		ORDER BY f.updated_date;`,
+		BattleID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get issue conflicts")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c IssueConflict
+		if err := rows.Scan(&c.PlanID, &c.PlanName, &c.Field, &c.Mine, &c.Theirs, &c.Base, &c.UpdatedDate); err != nil {
+			log.Println(err)
+			continue
+		}
+		Conflicts = append(Conflicts, &c)
+	}
+
+	return Conflicts, nil
+}
+
+// ResolveIssueConflict resolves a conflicting field of a battles plan by taking the issues value (theirs)
+// or keeping the plans value (mine), which is then pushed to the issue
+func (d *Database) ResolveIssueConflict(BattleID string, warriorID string, PlanID string, Field string, Resolution string) ([]*Plan, error) {
+	if err := d.ConfirmLeader(BattleID, warriorID); err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to resolve issue conflict")
+	}
+	defer tx.Rollback()
+
+	var Theirs string
+	err = tx.QueryRow(
+		`SELECT f.theirs FROM plan_issue_fields f JOIN plans p ON p.id = f.plan_id
+		WHERE f.plan_id = $1 AND p.battle_id = $2 AND f.field = $3 AND f.theirs IS NOT NULL
+		FOR UPDATE;`,
+		PlanID, BattleID, Field,
+	).Scan(&Theirs)
+	if err == sql.ErrNoRows {
+		return nil, ErrIssueConflictNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to resolve issue conflict")
+	}
+
+	// either way the issues value is now the agreed one, keeping mine then makes the plan the only side edited
+	if err := setIssueField(tx, PlanID, Field, Theirs, nil); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to resolve issue conflict")
+	}
+	if Resolution == "theirs" {
+		err = setPlanField(tx, PlanID, Field, Theirs)
+	} else {
+		_, err = tx.Exec(`call queue_issue_plan_revised($1);`, PlanID)
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to resolve issue conflict")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to resolve issue conflict")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
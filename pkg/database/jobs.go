@@ -0,0 +1,89 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// RunJobExclusively runs the job while holding a postgres advisory lock on its name so only one
+// instance runs it at a time, returning false when another instance holds the lock or already
+// started the run scheduled for ScheduledFor
+func (d *Database) RunJobExclusively(Name string, Schedule string, ScheduledFor time.Time, run func() error) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return false, errors.New("unable to lock job")
+	}
+	// the transaction level lock is released when the transaction ends
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock(hashtext('job:' || $1))`, Name).Scan(&locked); err != nil {
+		log.Println(err)
+		return false, errors.New("unable to lock job")
+	}
+	if !locked {
+		return false, nil
+	}
+
+	// the scheduled minute is compared rather than when it started, instances' clocks may differ from the database's
+	ScheduledFor = ScheduledFor.UTC().Truncate(time.Minute)
+	var started bool
+	if err := tx.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM jobs WHERE name = $1 AND last_scheduled >= $2)`, Name, ScheduledFor,
+	).Scan(&started); err != nil {
+		log.Println(err)
+		return false, errors.New("unable to lock job")
+	}
+	if started {
+		return false, nil
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO jobs (name, schedule, running, last_started, last_scheduled) VALUES ($1, $2, true, NOW(), $3)
+		ON CONFLICT (name) DO UPDATE SET schedule = $2, running = true, last_started = NOW(), last_scheduled = $3;`,
+		Name, Schedule, ScheduledFor,
+	); err != nil {
+		log.Println(err)
+	}
+
+	runErr := run()
+	var LastError string
+	if runErr != nil {
+		LastError = runErr.Error()
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE jobs SET running = false, last_finished = NOW(), runs = runs + 1,
+			failures = failures + CASE WHEN $2 = '' THEN 0 ELSE 1 END, last_error = NULLIF($2, '')
+		WHERE name = $1;`,
+		Name, LastError,
+	); err != nil {
+		log.Println(err)
+	}
+
+	return true, runErr
+}
+
+// GetJobs gets the run status of the background jobs
+func (d *Database) GetJobs() []*Job {
+	var jobs = make([]*Job, 0)
+	rows, err := d.db.Query(
+		`SELECT name, schedule, running, runs, failures, last_started, last_finished, coalesce(last_error, '')
+		FROM jobs ORDER BY name`,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var j Job
+			if err := rows.Scan(&j.Name, &j.Schedule, &j.Running, &j.Runs, &j.Failures, &j.LastStarted, &j.LastFinished, &j.LastError); err != nil {
+				log.Println(err)
+			} else {
+				jobs = append(jobs, &j)
+			}
+		}
+	}
+
+	return jobs
+}
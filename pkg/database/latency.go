@@ -0,0 +1,46 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// recordVoteLatency records how long after voting started the warrior first voted on the plan, changed votes keep
+// the time of the first while voting again after a revote records the new round
+func (d *Database) recordVoteLatency(PlanID string, WarriorID string) {
+	if _, err := d.db.Exec(
+		`INSERT INTO plan_vote_latencies (plan_id, battle_id, warrior_id, vote_start, latency_ms)
+		SELECT id, battle_id, $2, votestart_time, GREATEST(0, EXTRACT(EPOCH FROM (NOW() - votestart_time)) * 1000)::INTEGER
+		FROM plans WHERE id = $1 AND active = true AND votestart_time IS NOT NULL
+		ON CONFLICT (plan_id, warrior_id) DO UPDATE SET vote_start = EXCLUDED.vote_start, latency_ms = EXCLUDED.latency_ms
+		WHERE plan_vote_latencies.vote_start <> EXCLUDED.vote_start;`,
+		PlanID, WarriorID,
+	); err != nil {
+		log.Println(err)
+	}
+}
+
+// GetBattleVoteLatencies gets how long each warrior took to vote on each of the battle's plans
+func (d *Database) GetBattleVoteLatencies(BattleID string) ([]*VoteLatency, error) {
+	var latencies = make([]*VoteLatency, 0)
+	rows, err := d.db.Query(
+		`SELECT plan_id, warrior_id, latency_ms FROM plan_vote_latencies WHERE battle_id = $1`,
+		BattleID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get vote latencies")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l VoteLatency
+		if err := rows.Scan(&l.PlanID, &l.WarriorID, &l.LatencyMs); err != nil {
+			log.Println(err)
+		} else {
+			latencies = append(latencies, &l)
+		}
+	}
+
+	return latencies, nil
+}
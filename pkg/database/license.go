@@ -0,0 +1,72 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	// LicenseWarriors is the license limit on registered warriors
+	LicenseWarriors = "warriors"
+	// LicenseTeams is the license limit on teams
+	LicenseTeams = "teams"
+)
+
+// LicenseUsage is how much of the license limits the instance uses
+type LicenseUsage struct {
+	Warriors int `json:"warriors"`
+	Teams    int `json:"teams"`
+	// OverSince is when each limit was first gone over, by limit, those within their limit are left out
+	OverSince map[string]time.Time `json:"overSince"`
+}
+
+// GetLicenseUsage gets the number of registered warriors and teams, and since when any limit was gone over
+func (d *Database) GetLicenseUsage() (*LicenseUsage, error) {
+	usage := &LicenseUsage{OverSince: make(map[string]time.Time)}
+	if err := d.db.QueryRow(
+		`SELECT
+			(SELECT COUNT(*) FROM warriors WHERE email IS NOT NULL),
+			(SELECT COUNT(*) FROM teams);`,
+	).Scan(&usage.Warriors, &usage.Teams); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get license usage")
+	}
+
+	rows, err := d.db.Query(`SELECT resource, since FROM license_overages;`)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get license usage")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var Resource string
+		var Since time.Time
+		if err := rows.Scan(&Resource, &Since); err != nil {
+			log.Println(err)
+			continue
+		}
+		usage.OverSince[Resource] = Since
+	}
+
+	return usage, nil
+}
+
+// SetLicenseOverage records the limit as gone over from now on, keeping when it first was, or as within it again
+func (d *Database) SetLicenseOverage(Resource string, Over bool) error {
+	var err error
+	if Over {
+		_, err = d.db.Exec(
+			`INSERT INTO license_overages (resource) VALUES ($1) ON CONFLICT (resource) DO NOTHING;`, Resource,
+		)
+	} else {
+		_, err = d.db.Exec(`DELETE FROM license_overages WHERE resource = $1;`, Resource)
+	}
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to set license overage")
+	}
+
+	return nil
+}
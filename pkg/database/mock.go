@@ -0,0 +1,305 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mock is an in memory Datastore for unit testing handlers, covering warriors, API keys, sessions, permissions and
+// battle leadership. Tests needing more embed it in their own type adding what they need, anything else panics
+type Mock struct {
+	Datastore
+
+	mu sync.Mutex
+	// Warriors by ID, a rank of GENERAL makes them an admin
+	Warriors map[string]*Warrior
+	// APIKeys are the warrior ID of each active API key
+	APIKeys map[string]string
+	// Permissions granted to each warrior
+	Permissions map[string][]string
+	// Battles by ID
+	Battles map[string]*Battle
+	// Starred battles of each warrior
+	Starred map[string]map[string]bool
+	// APIRequests logged, as method and route followed by any detail
+	APIRequests []string
+	// Defaults are the organization's battle defaults, nil when not set
+	Defaults *BattleDefaults
+	// Domains are the teams' hostnames and path prefixes
+	Domains []*TeamDomain
+	// Sessions by the token their browser holds
+	Sessions map[string]*WarriorSession
+	// sessionCount numbers the sessions created
+	sessionCount int
+	// legacyCookies are the cookies from before sessions were stored that were exchanged for one
+	legacyCookies map[string]bool
+}
+
+// NewMock creates an empty Mock
+func NewMock() *Mock {
+	return &Mock{
+		Warriors:      make(map[string]*Warrior),
+		APIKeys:       make(map[string]string),
+		Permissions:   make(map[string][]string),
+		Battles:       make(map[string]*Battle),
+		Starred:       make(map[string]map[string]bool),
+		Sessions:      make(map[string]*WarriorSession),
+		legacyCookies: make(map[string]bool),
+	}
+}
+
+// GetWarrior gets the warrior by ID
+func (m *Mock) GetWarrior(WarriorID string) (*Warrior, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w, ok := m.Warriors[WarriorID]; ok {
+		return w, nil
+	}
+
+	return nil, errors.New("warrior not found")
+}
+
+// TouchWarriorActivity does nothing, activity isn't tracked
+func (m *Mock) TouchWarriorActivity(WarriorID string) {}
+
+// ConfirmAdmin confirms the warrior is a GENERAL
+func (m *Mock) ConfirmAdmin(AdminID string) error {
+	w, err := m.GetWarrior(AdminID)
+	if err != nil {
+		return err
+	}
+	if w.WarriorRank != "GENERAL" {
+		return errors.New("warrior is not an admin")
+	}
+
+	return nil
+}
+
+// ValidateAPIKey gets the warrior of the API key
+func (m *Mock) ValidateAPIKey(APK string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if WarriorID, ok := m.APIKeys[APK]; ok {
+		return WarriorID, nil
+	}
+
+	return "", errors.New("active API Key match not found")
+}
+
+// CreateWarriorSession starts a session for the warrior, its token and UUID are numbered
+func (m *Mock) CreateWarriorSession(WarriorID string, UserAgent string, Days int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessionCount++
+	Token := fmt.Sprintf("token%d", m.sessionCount)
+	m.Sessions[Token] = &WarriorSession{
+		SessionID:   fmt.Sprintf("00000000-0000-0000-0000-%012d", m.sessionCount),
+		WarriorID:   WarriorID,
+		UserAgent:   UserAgent,
+		CreatedDate: time.Now(),
+		ExpireDate:  time.Now().AddDate(0, 0, Days),
+	}
+
+	return Token, nil
+}
+
+// ExchangeLegacyCookie starts a session for the warrior in place of the legacy cookie, once per cookie
+func (m *Mock) ExchangeLegacyCookie(WarriorID string, Cookie string, UserAgent string, Days int) (string, error) {
+	m.mu.Lock()
+	if m.legacyCookies[Cookie] {
+		m.mu.Unlock()
+		return "", errors.New("legacy cookie already exchanged")
+	}
+	m.legacyCookies[Cookie] = true
+	m.mu.Unlock()
+
+	return m.CreateWarriorSession(WarriorID, UserAgent, Days)
+}
+
+// GetSession gets the unexpired session held by the token
+func (m *Mock) GetSession(Token string) (*WarriorSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ws, ok := m.Sessions[Token]; ok && time.Now().Before(ws.ExpireDate) {
+		session := *ws
+		return &session, nil
+	}
+
+	return nil, errors.New("session not found")
+}
+
+// GetWarriorSessions gets the warrior's unexpired sessions by ID
+func (m *Mock) GetWarriorSessions(WarriorID string) ([]*WarriorSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var Sessions = make([]*WarriorSession, 0)
+	for _, ws := range m.Sessions {
+		if ws.WarriorID == WarriorID && time.Now().Before(ws.ExpireDate) {
+			session := *ws
+			Sessions = append(Sessions, &session)
+		}
+	}
+	sort.Slice(Sessions, func(i, j int) bool {
+		return Sessions[i].SessionID < Sessions[j].SessionID
+	})
+
+	return Sessions, nil
+}
+
+// DeleteWarriorSession ends the warrior's session
+func (m *Mock) DeleteWarriorSession(WarriorID string, SessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for Token, ws := range m.Sessions {
+		if ws.SessionID == SessionID && ws.WarriorID == WarriorID {
+			delete(m.Sessions, Token)
+		}
+	}
+
+	return nil
+}
+
+// LogAPIRequest records the method and route of the request followed by its detail when it has one
+func (m *Mock) LogAPIRequest(APK string, WarriorID string, Method string, Route string, Detail string, Status int, Latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if Detail != "" {
+		Route += " " + Detail
+	}
+	m.APIRequests = append(m.APIRequests, Method+" "+Route)
+}
+
+// GetWarriorPermissions gets the permissions granted to the warrior
+func (m *Mock) GetWarriorPermissions(WarriorID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var permissions = make([]string, 0)
+	return append(permissions, m.Permissions[WarriorID]...), nil
+}
+
+// ConfirmPermission confirms the warrior was granted the permission
+func (m *Mock) ConfirmPermission(WarriorID string, Permission string) error {
+	permissions, _ := m.GetWarriorPermissions(WarriorID)
+	for _, p := range permissions {
+		if p == Permission {
+			return nil
+		}
+	}
+
+	return errors.New("permission not granted")
+}
+
+// GetBattle gets the battle by ID
+func (m *Mock) GetBattle(BattleID string, WarriorID string) (*Battle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if b, ok := m.Battles[BattleID]; ok {
+		return b, nil
+	}
+
+	return nil, errors.New("not found")
+}
+
+// ConfirmLeader confirms the warrior leads the battle
+func (m *Mock) ConfirmLeader(BattleID string, warriorID string) error {
+	b, err := m.GetBattle(BattleID, warriorID)
+	if err != nil {
+		return err
+	}
+	if b.LeaderID != warriorID {
+		return errors.New("not battle leader")
+	}
+
+	return nil
+}
+
+// GetBattleBots gets no bots, they aren't tracked
+func (m *Mock) GetBattleBots(BattleID string) []*BattleWarrior {
+	return make([]*BattleWarrior, 0)
+}
+
+// SetBattleStarred stars or unstars the battle for the warrior
+func (m *Mock) SetBattleStarred(BattleID string, WarriorID string, Starred bool) error {
+	if _, err := m.GetBattle(BattleID, WarriorID); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Starred[WarriorID] == nil {
+		m.Starred[WarriorID] = make(map[string]bool)
+	}
+	m.Starred[WarriorID][BattleID] = Starred
+
+	return nil
+}
+
+// GetBattleDefaults gets the Defaults
+func (m *Mock) GetBattleDefaults() (*BattleDefaults, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.Defaults, nil
+}
+
+// SetBattleDefaults sets the Defaults
+func (m *Mock) SetBattleDefaults(Defaults *BattleDefaults, UpdatedBy string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Defaults = Defaults
+
+	return nil
+}
+
+// GetTeamDomains gets the Domains
+func (m *Mock) GetTeamDomains() ([]*TeamDomain, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append(make([]*TeamDomain, 0, len(m.Domains)), m.Domains...), nil
+}
+
+// SetTeamDomain adds the domain to the Domains, replacing the team's
+func (m *Mock) SetTeamDomain(td *TeamDomain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, d := range m.Domains {
+		if d.TeamID == td.TeamID {
+			m.Domains[i] = td
+			return nil
+		}
+	}
+	m.Domains = append(m.Domains, td)
+
+	return nil
+}
+
+// DeleteTeamDomain removes the team's domain from the Domains
+func (m *Mock) DeleteTeamDomain(TeamID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, d := range m.Domains {
+		if d.TeamID == TeamID {
+			m.Domains = append(m.Domains[:i], m.Domains[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
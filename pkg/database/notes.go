@@ -0,0 +1,51 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// ErrNotesConflict is returned when revising the notes from a version that is no longer current
+var ErrNotesConflict = errors.New("notes version conflict")
+
+// GetBattleNotes gets the battles notes
+func (d *Database) GetBattleNotes(BattleID string) (*BattleNotes, error) {
+	var notes BattleNotes
+	e := d.db.QueryRow(
+		`SELECT notes, notes_version FROM battles WHERE id = $1`,
+		BattleID,
+	).Scan(&notes.Notes, &notes.Version)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("battle not found")
+	}
+
+	return &notes, nil
+}
+
+// ReviseBattleNotes replaces the battles notes, any warrior in the battle can revise them.
+// When Version is set it must match the current version otherwise ErrNotesConflict is returned
+// along with the current notes, a Version of 0 lets the last write win
+func (d *Database) ReviseBattleNotes(BattleID string, WarriorID string, Notes string, Version int) (*BattleNotes, error) {
+	if !d.IsBattleWarrior(BattleID, WarriorID) {
+		return nil, errors.New("warrior not in battle")
+	}
+
+	var notes BattleNotes
+	e := d.db.QueryRow(
+		`UPDATE battles SET notes = $3, notes_version = notes_version + 1, updated_date = NOW()
+		WHERE id = $1 AND ($2 = 0 OR notes_version = $2)
+		RETURNING notes, notes_version;`,
+		BattleID, Version, Notes,
+	).Scan(&notes.Notes, &notes.Version)
+	if e == nil {
+		return &notes, nil
+	}
+
+	current, err := d.GetBattleNotes(BattleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return current, ErrNotesConflict
+}
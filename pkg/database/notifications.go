@@ -0,0 +1,146 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// Notification channels
+const (
+	// NotificationChannelWeb notifies with a toast in the battle
+	NotificationChannelWeb = "web"
+	// NotificationChannelEmail notifies by email
+	NotificationChannelEmail = "email"
+)
+
+// Notification events
+const (
+	// NotificationBattleActivity is warriors joining, leaving and voting in a battle
+	NotificationBattleActivity = "battle_activity"
+	// NotificationVotingStarted is the leader starting the vote on a plan
+	NotificationVotingStarted = "voting_started"
+	// NotificationTeamAdded is a team admin adding the warrior to their team
+	NotificationTeamAdded = "team_added"
+	// NotificationBattleSummary is the results of a battle the warrior led once it ends
+	NotificationBattleSummary = "battle_summary"
+	// NotificationAnnouncements is announcements from the admins
+	NotificationAnnouncements = "announcements"
+	// NotificationMentioned is another warrior @mentioning the warrior in a battle
+	NotificationMentioned = "mentioned"
+	// NotificationAbsenceConflict is a team battle schedule landing on a day key members are absent, for team admins
+	NotificationAbsenceConflict = "absence_conflict"
+)
+
+// NotificationEvents are the notification events in the order they're shown, along with the channels each is sent
+// through, a notifier for another channel adds it here so warriors can turn it off
+var NotificationEvents = []struct {
+	Event    string
+	Channels []string
+}{
+	{NotificationBattleActivity, []string{NotificationChannelWeb}},
+	{NotificationVotingStarted, []string{NotificationChannelWeb}},
+	{NotificationTeamAdded, []string{NotificationChannelEmail}},
+	{NotificationBattleSummary, []string{NotificationChannelEmail}},
+	{NotificationAnnouncements, []string{NotificationChannelEmail}},
+	{NotificationMentioned, []string{NotificationChannelWeb, NotificationChannelEmail}},
+	{NotificationAbsenceConflict, []string{NotificationChannelEmail}},
+}
+
+// ValidNotification checks the event is sent through the channel
+func ValidNotification(Event string, Channel string) bool {
+	for _, ne := range NotificationEvents {
+		if ne.Event != Event {
+			continue
+		}
+		for _, c := range ne.Channels {
+			if c == Channel {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// GetNotificationPreferences gets whether the warrior wants each notification event through each of its channels,
+// those they haven't changed being on
+func (d *Database) GetNotificationPreferences(WarriorID string) ([]*NotificationPreference, error) {
+	rows, err := d.db.Query(
+		`SELECT event, channel, enabled FROM warrior_notification_preferences WHERE warrior_id = $1`,
+		WarriorID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get notification preferences")
+	}
+	defer rows.Close()
+
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var Event, Channel string
+		var Enabled bool
+		if err := rows.Scan(&Event, &Channel, &Enabled); err != nil {
+			log.Println(err)
+		} else {
+			stored[Event+"/"+Channel] = Enabled
+		}
+	}
+
+	var preferences = make([]*NotificationPreference, 0)
+	for _, ne := range NotificationEvents {
+		for _, Channel := range ne.Channels {
+			Enabled, ok := stored[ne.Event+"/"+Channel]
+			preferences = append(preferences, &NotificationPreference{
+				Event:   ne.Event,
+				Channel: Channel,
+				Enabled: Enabled || !ok,
+			})
+		}
+	}
+
+	return preferences, nil
+}
+
+// SetNotificationPreferences saves whether the warrior wants each of the notification events through the channel,
+// those left out keep what they were
+func (d *Database) SetNotificationPreferences(WarriorID string, Preferences []*NotificationPreference) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to save notification preferences")
+	}
+	defer tx.Rollback()
+
+	for _, p := range Preferences {
+		if _, err := tx.Exec(
+			`INSERT INTO warrior_notification_preferences (warrior_id, event, channel, enabled) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (warrior_id, event, channel) DO UPDATE SET enabled = EXCLUDED.enabled`,
+			WarriorID, p.Event, p.Channel, p.Enabled,
+		); err != nil {
+			log.Println(err)
+			return errors.New("unable to save notification preferences")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return errors.New("unable to save notification preferences")
+	}
+
+	return nil
+}
+
+// WarriorNotifies checks whether the warrior wants the notification event through the channel, warriors who turned
+// notifications off in their profile get none
+func (d *Database) WarriorNotifies(WarriorID string, Event string, Channel string) bool {
+	var Notifies bool
+	if err := d.db.QueryRow(
+		`SELECT coalesce(warrior_notifies($1, $2, $3), false)`,
+		WarriorID, Event, Channel,
+	).Scan(&Notifies); err != nil {
+		log.Println(err)
+		return false
+	}
+
+	return Notifies
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"sort"
+)
+
+// outboxClaim is how long claimed events are left to a worker, after which they're handed out again
+// in case the process died while delivering them
+const outboxClaim = "10 minutes"
+
+// ProcessOutboxEvents hands pending outbox events to the handler in order, marking them processed
+// when it succeeds. Events are claimed before being handled so concurrent workers skip them, without
+// holding a transaction open while they're delivered
+func (d *Database) ProcessOutboxEvents(Limit int, MaxAttempts int, handle func(*OutboxEvent) error) (int, error) {
+	rows, err := d.db.Query(
+		`UPDATE outbox_events SET claimed_until = NOW() + $3::INTERVAL
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE processed_date IS NULL AND attempts < $2 AND (claimed_until IS NULL OR claimed_until < NOW())
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, battle_id, payload, attempts, created_date`,
+		Limit,
+		MaxAttempts,
+		outboxClaim,
+	)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("unable to process outbox events")
+	}
+
+	var events = make([]*OutboxEvent, 0)
+	for rows.Next() {
+		var e OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.EventType, &e.BattleID, &payload, &e.Attempts, &e.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			e.Payload = payload
+			events = append(events, &e)
+		}
+	}
+	rows.Close()
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	for _, e := range events {
+		if handleErr := handle(e); handleErr != nil {
+			if _, err := d.db.Exec(
+				`UPDATE outbox_events SET attempts = attempts + 1, last_error = $2, claimed_until = NULL WHERE id = $1;`,
+				e.ID, handleErr.Error(),
+			); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+
+		if _, err := d.db.Exec(
+			`UPDATE outbox_events SET attempts = attempts + 1, processed_date = NOW(), claimed_until = NULL WHERE id = $1;`,
+			e.ID,
+		); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return len(events), nil
+}
+
+// GetOutboxDeliveries gets the names of the handlers the outbox event was delivered by
+func (d *Database) GetOutboxDeliveries(EventID int64) ([]string, error) {
+	var Handlers = make([]string, 0)
+	rows, err := d.db.Query(`SELECT handler FROM outbox_deliveries WHERE event_id = $1;`, EventID)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get outbox deliveries")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var Handler string
+		if err := rows.Scan(&Handler); err != nil {
+			log.Println(err)
+		} else {
+			Handlers = append(Handlers, Handler)
+		}
+	}
+
+	return Handlers, nil
+}
+
+// SetOutboxDelivered records the outbox event as delivered by the handler so retries of the event skip it
+func (d *Database) SetOutboxDelivered(Handler string, EventID int64) error {
+	if _, err := d.db.Exec(
+		`INSERT INTO outbox_deliveries (event_id, handler) VALUES ($1, $2) ON CONFLICT DO NOTHING;`,
+		EventID, Handler,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to record outbox delivery")
+	}
+
+	return nil
+}
+
+// PurgeOutboxEvents removes delivered outbox events older than the given number of days along with their webhook
+// deliveries
+func (d *Database) PurgeOutboxEvents(DaysOld int) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM outbox_events WHERE processed_date < NOW() - make_interval(days => $1);`,
+		DaysOld,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to purge outbox events")
+	}
+	if _, err := d.db.Exec(
+		`DELETE FROM webhook_deliveries wd WHERE NOT EXISTS (SELECT FROM outbox_events oe WHERE oe.id = wd.event_id);`,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to purge outbox events")
+	}
+
+	return nil
+}
+
+// GetLeaderOutboxEvents gets the most recent outbox events of a type from the battles the warrior leads, newest first
+func (d *Database) GetLeaderOutboxEvents(EventType string, LeaderID string, Limit int) ([]*OutboxEvent, error) {
+	var events = make([]*OutboxEvent, 0)
+	rows, err := d.db.Query(
+		`SELECT id, event_type, battle_id, payload, attempts, created_date
+		FROM outbox_events
+		WHERE event_type = $1 AND payload->>'leaderId' = $2
+		ORDER BY id DESC
+		LIMIT $3;`,
+		EventType, LeaderID, Limit,
+	)
+	if err != nil {
+		log.Println(err)
+		return events, errors.New("unable to get outbox events")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.EventType, &e.BattleID, &payload, &e.Attempts, &e.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			e.Payload = payload
+			events = append(events, &e)
+		}
+	}
+
+	return events, nil
+}
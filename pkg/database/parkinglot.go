@@ -0,0 +1,130 @@
+package database
+
+import (
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// GetTeamParkedPlans gets the plans in the teams parking lot, oldest first
+func (d *Database) GetTeamParkedPlans(TeamID string) []*ParkedPlan {
+	var plans = make([]*ParkedPlan, 0)
+	rows, err := d.db.Query(
+		`SELECT id, name, type, coalesce(reference_id, ''), coalesce(link, ''), coalesce(description, ''),
+			coalesce(acceptance_criteria, ''), created_date
+		FROM team_parked_plans
+		WHERE team_id = $1
+		ORDER BY created_date`,
+		TeamID,
+	)
+	if err != nil {
+		log.Println(err)
+		return plans
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var pp ParkedPlan
+		if err := rows.Scan(&pp.ParkedPlanID, &pp.PlanName, &pp.Type, &pp.ReferenceID, &pp.Link, &pp.Description, &pp.AcceptanceCriteria, &pp.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			plans = append(plans, &pp)
+		}
+	}
+
+	return plans
+}
+
+// ParkTeamPlan adds a plan to the teams parking lot
+func (d *Database) ParkTeamPlan(TeamID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string) ([]*ParkedPlan, error) {
+	if _, err := d.db.Exec(
+		`INSERT INTO team_parked_plans (team_id, name, type, reference_id, link, description, acceptance_criteria)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		TeamID, PlanName, PlanType, ReferenceID, Link, Description, AcceptanceCriteria,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to park plan")
+	}
+
+	return d.GetTeamParkedPlans(TeamID), nil
+}
+
+// DeleteTeamParkedPlan removes a plan from the teams parking lot
+func (d *Database) DeleteTeamParkedPlan(TeamID string, ParkedPlanID string) ([]*ParkedPlan, error) {
+	if _, err := d.db.Exec(
+		`DELETE FROM team_parked_plans WHERE id = $1 AND team_id = $2;`,
+		ParkedPlanID, TeamID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to delete parked plan")
+	}
+
+	return d.GetTeamParkedPlans(TeamID), nil
+}
+
+// ParkBattlePlan moves a plan out of the battle into the parking lot of the battles team
+func (d *Database) ParkBattlePlan(BattleID string, LeaderID string, PlanID string) ([]*Plan, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	res, err := d.db.Exec(
+		`INSERT INTO team_parked_plans (team_id, name, type, reference_id, link, description, acceptance_criteria, issue_provider, external_id)
+		SELECT b.team_id, p.name, p.type, p.reference_id, p.link, p.description, p.acceptance_criteria, p.issue_provider, p.external_id
+		FROM plans p JOIN battles b ON b.id = p.battle_id
+		WHERE p.id = $2 AND p.battle_id = $1 AND b.team_id IS NOT NULL;`,
+		BattleID, PlanID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to park plan")
+	}
+	if parked, _ := res.RowsAffected(); parked == 0 {
+		return nil, errors.New("plan not found or battle has no team")
+	}
+
+	if _, err := d.db.Exec(`call delete_plan($1, $2);`, BattleID, PlanID); err != nil {
+		log.Println(err)
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
+// PullTeamParkedPlans moves plans from the teams parking lot into one of the teams battles,
+// all of them when ParkedPlanIDs is empty
+func (d *Database) PullTeamParkedPlans(TeamID string, BattleID string, LeaderID string, ParkedPlanIDs []string) ([]*Plan, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	var battleTeamID string
+	if err := d.db.QueryRow(
+		`SELECT coalesce(team_id::TEXT, '') FROM battles WHERE id = $1`, BattleID,
+	).Scan(&battleTeamID); err != nil || battleTeamID != TeamID {
+		return nil, errors.New("battle not in team")
+	}
+	if ParkedPlanIDs == nil {
+		ParkedPlanIDs = make([]string, 0)
+	}
+
+	// moved in one statement so concurrent pulls can't take the same plan twice
+	if _, err := d.db.Exec(
+		`WITH pulled AS (
+			DELETE FROM team_parked_plans
+			WHERE team_id = $1 AND (cardinality($3::UUID[]) = 0 OR id = ANY($3::UUID[]))
+			RETURNING name, type, reference_id, link, description, acceptance_criteria, issue_provider, external_id, created_date
+		)
+		INSERT INTO plans (battle_id, name, type, reference_id, link, description, acceptance_criteria, issue_provider, external_id)
+		SELECT $2, name, type, reference_id, link, description, acceptance_criteria, issue_provider, external_id
+		FROM pulled ORDER BY created_date;`,
+		TeamID, BattleID, pq.Array(ParkedPlanIDs),
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to pull parked plans")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordParams are the Argon2id parameters passwords are hashed with
+type PasswordParams struct {
+	// Memory in KiB
+	Memory      uint32 `json:"memory"`
+	Iterations  uint32 `json:"iterations"`
+	Parallelism uint8  `json:"parallelism"`
+}
+
+// DefaultPasswordParams follow the OWASP recommendation for Argon2id
+var DefaultPasswordParams = PasswordParams{Memory: 64 * 1024, Iterations: 3, Parallelism: 2}
+
+// passwordParams are the parameters new hashes are made with, hashes made with others are rehashed on login
+var passwordParams = DefaultPasswordParams
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// SetPasswordParams sets the Argon2id parameters passwords are hashed with from then on
+func SetPasswordParams(Params PasswordParams) error {
+	if Params.Memory < 8*uint32(Params.Parallelism) || Params.Iterations < 1 || Params.Parallelism < 1 {
+		return errors.New("argon2 memory must be at least 8 KiB per thread with one or more iterations and threads")
+	}
+	passwordParams = Params
+
+	return nil
+}
+
+// prefix is how hashes made with the parameters start
+func (p PasswordParams) prefix() string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$", argon2.Version, p.Memory, p.Iterations, p.Parallelism)
+}
+
+// HashAndSalt takes a password byte and salt + hashes it with Argon2id
+// returning a hash string in the PHC format to store in db
+func HashAndSalt(pwd []byte) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	p := passwordParams
+	hash := argon2.IDKey(pwd, salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLength)
+
+	return p.prefix() + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(hash), nil
+}
+
+// ComparePasswords takes a password hash and compares it to entered password bytes
+// returning true if matches false if not, legacy bcrypt hashes are still compared
+func ComparePasswords(hashedPwd string, plainPwd []byte) bool {
+	if !strings.HasPrefix(hashedPwd, "$argon2id$") {
+		if err := bcrypt.CompareHashAndPassword([]byte(hashedPwd), plainPwd); err != nil {
+			log.Println(err)
+			return false
+		}
+		return true
+	}
+
+	var version int
+	var p PasswordParams
+	parts := strings.Split(hashedPwd, "$")
+	if len(parts) != 6 {
+		return false
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+
+	compared := argon2.IDKey(plainPwd, salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(hash)))
+
+	return subtle.ConstantTimeCompare(hash, compared) == 1
+}
+
+// NeedsRehash checks whether the hash was made with a legacy scheme or other parameters than are now configured
+func NeedsRehash(hashedPwd string) bool {
+	return !strings.HasPrefix(hashedPwd, passwordParams.prefix())
+}
+
+// rehashWarriorPassword replaces the warriors stored hash with one made with the current scheme and parameters,
+// only when it's still the hash the password was checked against
+func (d *Database) rehashWarriorPassword(WarriorID string, OldHash string, WarriorPassword string) {
+	hashedPassword, err := HashAndSalt([]byte(WarriorPassword))
+	if err != nil {
+		return
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE warriors SET password = $3 WHERE id = $1 AND password = $2`,
+		WarriorID, OldHash, hashedPassword,
+	); err != nil {
+		log.Println(err)
+	}
+}
+
+// GetPasswordHashReport counts the registered warriors by how their password is hashed
+func (d *Database) GetPasswordHashReport() (*PasswordHashReport, error) {
+	var r PasswordHashReport
+	e := d.db.QueryRow(
+		`SELECT
+			COUNT(*) FILTER (WHERE password LIKE $1 || '%'),
+			COUNT(*) FILTER (WHERE password LIKE '$argon2id$%' AND password NOT LIKE $1 || '%'),
+			COUNT(*) FILTER (WHERE password NOT LIKE '$argon2id$%')
+		FROM warriors WHERE password IS NOT NULL AND password != ''`,
+		passwordParams.prefix(),
+	).Scan(&r.Current, &r.OutdatedParams, &r.Legacy)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to get password hash report")
+	}
+	r.Params = passwordParams
+
+	return &r, nil
+}
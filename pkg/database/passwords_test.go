@@ -0,0 +1,54 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndSalt(t *testing.T) {
+	defer SetPasswordParams(DefaultPasswordParams)
+	SetPasswordParams(PasswordParams{Memory: 64, Iterations: 1, Parallelism: 1})
+
+	hash, err := HashAndSalt([]byte("mjolnir"))
+	if err != nil || !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatal("Unexpected hash ", hash, err)
+	}
+	if again, _ := HashAndSalt([]byte("mjolnir")); again == hash {
+		t.Error("Expected each hash to be salted")
+	}
+	if !ComparePasswords(hash, []byte("mjolnir")) || ComparePasswords(hash, []byte("stormbreaker")) {
+		t.Error("Unexpected comparison of ", hash)
+	}
+	if NeedsRehash(hash) {
+		t.Error("Expected a hash with the current params not to need rehashing")
+	}
+
+	SetPasswordParams(PasswordParams{Memory: 128, Iterations: 1, Parallelism: 1})
+	if !NeedsRehash(hash) || !ComparePasswords(hash, []byte("mjolnir")) {
+		t.Error("Expected a hash with outdated params to still compare but need rehashing")
+	}
+}
+
+func TestComparePasswordsLegacy(t *testing.T) {
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("mjolnir"), bcrypt.MinCost)
+	if !ComparePasswords(string(legacy), []byte("mjolnir")) || ComparePasswords(string(legacy), []byte("stormbreaker")) {
+		t.Error("Unexpected comparison of legacy hash ", string(legacy))
+	}
+	if !NeedsRehash(string(legacy)) {
+		t.Error("Expected a legacy hash to need rehashing")
+	}
+	if ComparePasswords("$argon2id$v=19$m=64,t=1,p=1$garbage", []byte("mjolnir")) {
+		t.Error("Expected a malformed hash not to compare")
+	}
+}
+
+func TestSetPasswordParams(t *testing.T) {
+	defer SetPasswordParams(DefaultPasswordParams)
+	for _, p := range []PasswordParams{{Memory: 64}, {Memory: 4, Iterations: 1, Parallelism: 1}, {Memory: 64, Iterations: 1}} {
+		if err := SetPasswordParams(p); err == nil {
+			t.Error("Expected ", p, " to be refused")
+		}
+	}
+}
@@ -10,24 +10,74 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrDuplicateVote is returned when a vote with the same vote id was already recorded
+var ErrDuplicateVote = errors.New("duplicate vote")
+
+// ErrVoteChangeRejected is returned when changing a vote isn't allowed
+var ErrVoteChangeRejected = errors.New("vote change rejected")
+
+// ErrPlanConflict is returned when revising a plan from a version that is no longer current
+var ErrPlanConflict = errors.New("plan version conflict")
+
+// ErrPlanNotFound is returned when revising a plan that isn't in the battle
+var ErrPlanNotFound = errors.New("plan not found")
+
 // GetPlans retrieves plans for given battle from db
 func (d *Database) GetPlans(BattleID string, WarriorID string) []*Plan {
+	return d.getPlans(BattleID, WarriorID, 0, 0)
+}
+
+// GetPlansPage gets a page of a battles plans along with the total number of plans
+func (d *Database) GetPlansPage(BattleID string, WarriorID string, Limit int, Offset int) ([]*Plan, int, error) {
+	if !d.IsBattleWarrior(BattleID, WarriorID) {
+		return nil, 0, errors.New("warrior not in battle")
+	}
+
+	var Total int
+	e := d.db.QueryRow(`SELECT count(*) FROM plans WHERE battle_id = $1`, BattleID).Scan(&Total)
+	if e != nil {
+		log.Println(e)
+		return nil, 0, errors.New("unable to get plans")
+	}
+
+	return d.getPlans(BattleID, WarriorID, Limit, Offset), Total, nil
+}
+
+// utcVotes moves the dates of the votes to UTC, the database writes them in its own time zone
+func utcVotes(Votes []*Vote) {
+	for _, vote := range Votes {
+		utc(&vote.CreatedDate, &vote.UpdatedDate)
+	}
+}
+
+// getPlans gets the battles plans, a Limit of 0 gets all of them
+func (d *Database) getPlans(BattleID string, WarriorID string, Limit int, Offset int) []*Plan {
 	var plans = make([]*Plan, 0)
 	planRows, plansErr := d.db.Query(
 		`SELECT
-			id, name, type, reference_id, link, description, acceptance_criteria, points, active, skipped, votestart_time, voteend_time, votes
-			FROM plans WHERE battle_id = $1 ORDER BY created_date
+			id, name, type, reference_id, link, description, acceptance_criteria, points, active, skipped, votestart_time, voteend_time, votes, parent_id, split, version,
+			coalesce(issue_provider, ''), coalesce(external_id, ''), translations,
+			dots + coalesce((SELECT SUM(pd.dots) FROM plan_dots pd WHERE pd.plan_id = plans.id), 0), created_date, updated_date
+			FROM plans WHERE battle_id = $1 ORDER BY sort_order, created_date
+			LIMIT NULLIF($2, 0) OFFSET $3
 		`,
 		BattleID,
+		Limit,
+		Offset,
 	)
 	if plansErr == nil {
 		defer planRows.Close()
+		checklists := d.getPlanChecklists(BattleID)
+		questions := d.getPlanQuestions(BattleID)
+		dependencies := d.getPlanDependencies(BattleID)
 		for planRows.Next() {
 			var v string
+			var Translations string
 			var ReferenceID sql.NullString
 			var Link sql.NullString
 			var Description sql.NullString
 			var AcceptanceCriteria sql.NullString
+			var ParentID sql.NullString
 			var p = &Plan{PlanID: "",
 				PlanName:           "",
 				Type:               "",
@@ -43,7 +93,7 @@ func (d *Database) GetPlans(BattleID string, WarriorID string) []*Plan {
 				VoteEndTime:        time.Now(),
 			}
 			if err := planRows.Scan(
-				&p.PlanID, &p.PlanName, &p.Type, &ReferenceID, &Link, &Description, &AcceptanceCriteria, &p.Points, &p.PlanActive, &p.PlanSkipped, &p.VoteStartTime, &p.VoteEndTime, &v,
+				&p.PlanID, &p.PlanName, &p.Type, &ReferenceID, &Link, &Description, &AcceptanceCriteria, &p.Points, &p.PlanActive, &p.PlanSkipped, &p.VoteStartTime, &p.VoteEndTime, &v, &ParentID, &p.Split, &p.Version, &p.IssueProvider, &p.ExternalID, &Translations, &p.Dots, &p.CreatedDate, &p.UpdatedDate,
 			); err != nil {
 				log.Println(err)
 			} else {
@@ -51,10 +101,28 @@ func (d *Database) GetPlans(BattleID string, WarriorID string) []*Plan {
 				p.Link = Link.String
 				p.Description = Description.String
 				p.AcceptanceCriteria = AcceptanceCriteria.String
+				p.ParentID = ParentID.String
+				utc(&p.CreatedDate, &p.UpdatedDate)
+				p.Checked = checklists[p.PlanID]
+				if p.Checked == nil {
+					p.Checked = make([]string, 0)
+				}
+				p.Questions = questions[p.PlanID]
+				if p.Questions == nil {
+					p.Questions = make([]*PlanQuestion, 0)
+				}
+				p.DependsOn = dependencies[p.PlanID]
+				if p.DependsOn == nil {
+					p.DependsOn = make([]string, 0)
+				}
 				err = json.Unmarshal([]byte(v), &p.Votes)
 				if err != nil {
 					log.Println(err)
 				}
+				utcVotes(p.Votes)
+				if err := json.Unmarshal([]byte(Translations), &p.Translations); err != nil {
+					log.Println(err)
+				}
 
 				// don't send others vote values to client, prevent sneaky devs from peaking at votes
 				for i := range p.Votes {
@@ -74,7 +142,7 @@ func (d *Database) GetPlans(BattleID string, WarriorID string) []*Plan {
 
 // CreatePlan adds a new plan to a battle
 func (d *Database) CreatePlan(BattleID string, warriorID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string) ([]*Plan, error) {
-	err := d.ConfirmLeader(BattleID, warriorID)
+	err := d.confirmPlanDriver(BattleID, warriorID)
 	if err != nil {
 		return nil, errors.New("incorrect permissions")
 	}
@@ -94,13 +162,38 @@ func (d *Database) CreatePlan(BattleID string, warriorID string, PlanName string
 	return plans, nil
 }
 
+// ImportPlans adds plans pulled from an issue tracker to a battle, remembering which issue each came from
+func (d *Database) ImportPlans(BattleID string, warriorID string, Provider string, Plans []*Plan) ([]*Plan, error) {
+	err := d.confirmPlanDriver(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	for _, p := range Plans {
+		if _, err := d.db.Exec(
+			`INSERT INTO plans (battle_id, name, type, reference_id, link, description, acceptance_criteria, issue_provider, external_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`,
+			BattleID, p.PlanName, p.Type, p.ReferenceID, p.Link, p.Description, p.AcceptanceCriteria, Provider, p.ExternalID,
+		); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
 // ActivatePlanVoting sets the plan by ID to active, wipes any previous votes/points, and disables votingLock
 func (d *Database) ActivatePlanVoting(BattleID string, warriorID string, PlanID string) ([]*Plan, error) {
-	err := d.ConfirmLeader(BattleID, warriorID)
+	err := d.confirmPlanDriver(BattleID, warriorID)
 	if err != nil {
 		return nil, errors.New("incorrect permissions")
 	}
 
+	readyErr := d.confirmPlanReady(BattleID, PlanID)
+	if readyErr != nil {
+		return nil, readyErr
+	}
+
 	if _, err := d.db.Exec(
 		`call activate_plan_voting($1, $2);`, BattleID, PlanID,
 	); err != nil {
@@ -112,12 +205,46 @@ func (d *Database) ActivatePlanVoting(BattleID string, warriorID string, PlanID
 	return plans, nil
 }
 
-// SetVote sets a warriors vote for the plan
-func (d *Database) SetVote(BattleID string, WarriorID string, PlanID string, VoteValue string) (BattlePlans []*Plan, AllWarriorsVoted bool) {
+// SetVote sets a warriors vote for the plan, a VoteID makes resubmitting the same vote a no-op
+// and RejectChanges refuses to replace an existing vote with a different value
+func (d *Database) SetVote(BattleID string, WarriorID string, PlanID string, VoteValue string, VoteID string, RejectChanges bool) (BattlePlans []*Plan, AllWarriorsVoted bool, err error) {
+	if RejectChanges {
+		var CurrentVote string
+		e := d.db.QueryRow(
+			`SELECT coalesce((
+				SELECT v->>'vote' FROM plans p, jsonb_array_elements(p.votes) v
+				WHERE p.id = $1 AND v->>'warriorId' = $2::TEXT
+			), '')`,
+			PlanID, WarriorID,
+		).Scan(&CurrentVote)
+		if e != nil {
+			log.Println(e)
+			return nil, false, errors.New("unable to set vote")
+		}
+		if CurrentVote != "" && CurrentVote != VoteValue {
+			return nil, false, ErrVoteChangeRejected
+		}
+	}
+
+	if VoteID != "" {
+		res, err := d.db.Exec(
+			`INSERT INTO plan_vote_submissions (vote_id, plan_id, warrior_id, vote) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING;`,
+			VoteID, PlanID, WarriorID, VoteValue,
+		)
+		if err != nil {
+			log.Println(err)
+			return nil, false, errors.New("unable to set vote")
+		}
+		if inserted, _ := res.RowsAffected(); inserted == 0 {
+			return nil, false, ErrDuplicateVote
+		}
+	}
+
 	if _, err := d.db.Exec(
 		`call set_warrior_vote($1, $2, $3);`, PlanID, WarriorID, VoteValue); err != nil {
 		log.Println(err)
 	}
+	d.recordVoteLatency(PlanID, WarriorID)
 
 	Plans := d.GetPlans(BattleID, "")
 	ActiveWarriors := d.GetBattleActiveWarriors(BattleID)
@@ -142,7 +269,7 @@ func (d *Database) SetVote(BattleID string, WarriorID string, PlanID string, Vot
 		}
 	}
 
-	return Plans, AllVoted
+	return Plans, AllVoted, nil
 }
 
 // RetractVote removes a warriors vote for the plan
@@ -160,7 +287,7 @@ func (d *Database) RetractVote(BattleID string, WarriorID string, PlanID string)
 // EndPlanVoting sets plan to active: false
 func (d *Database) EndPlanVoting(BattleID string, warriorID string, PlanID string, AutoFinishVoting bool) ([]*Plan, error) {
 	if !AutoFinishVoting {
-		err := d.ConfirmLeader(BattleID, warriorID)
+		err := d.confirmPlanDriver(BattleID, warriorID)
 		if err != nil {
 			return nil, errors.New("incorrect permissions")
 		}
@@ -178,7 +305,7 @@ func (d *Database) EndPlanVoting(BattleID string, warriorID string, PlanID strin
 
 // SkipPlan sets plan to active: false and unsets battle's activePlanId
 func (d *Database) SkipPlan(BattleID string, warriorID string, PlanID string) ([]*Plan, error) {
-	err := d.ConfirmLeader(BattleID, warriorID)
+	err := d.confirmPlanDriver(BattleID, warriorID)
 	if err != nil {
 		return nil, errors.New("incorrect permissions")
 	}
@@ -193,13 +320,37 @@ func (d *Database) SkipPlan(BattleID string, warriorID string, PlanID string) ([
 	return plans, nil
 }
 
-// RevisePlan updates the plan by ID
-func (d *Database) RevisePlan(BattleID string, warriorID string, PlanID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string) ([]*Plan, error) {
-	err := d.ConfirmLeader(BattleID, warriorID)
+// RevisePlan updates the plan by ID, when Version is set it must match the plans current version
+// otherwise ErrPlanConflict is returned along with the current plans, ErrPlanNotFound when the plan isn't in the battle
+func (d *Database) RevisePlan(BattleID string, warriorID string, PlanID string, PlanName string, PlanType string, ReferenceID string, Link string, Description string, AcceptanceCriteria string, Version int) ([]*Plan, error) {
+	err := d.confirmPlanDriver(BattleID, warriorID)
 	if err != nil {
 		return nil, errors.New("incorrect permissions")
 	}
 
+	// claim the next version first so only one of several concurrent edits wins
+	res, err := d.db.Exec(
+		`UPDATE plans SET version = version + 1 WHERE id = $1 AND battle_id = $2 AND ($3 = 0 OR version = $3);`,
+		PlanID, BattleID, Version,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to revise plan")
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		var exists bool
+		if err := d.db.QueryRow(
+			`SELECT EXISTS(SELECT 1 FROM plans WHERE id = $1 AND battle_id = $2);`, PlanID, BattleID,
+		).Scan(&exists); err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to revise plan")
+		}
+		if !exists {
+			return nil, ErrPlanNotFound
+		}
+		return d.GetPlans(BattleID, ""), ErrPlanConflict
+	}
+
 	// set PlanID to true
 	if _, err := d.db.Exec(
 		`call revise_plan($1, $2, $3, $4, $5, $6, $7);`, PlanID, PlanName, PlanType, ReferenceID, Link, Description, AcceptanceCriteria); err != nil {
@@ -211,9 +362,47 @@ func (d *Database) RevisePlan(BattleID string, warriorID string, PlanID string,
 	return plans, nil
 }
 
+// SetPlanTranslation sets the plans name and description in another language
+func (d *Database) SetPlanTranslation(BattleID string, warriorID string, PlanID string, Locale string, PlanName string, Description string) ([]*Plan, error) {
+	err := d.confirmPlanDriver(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	Translation, _ := json.Marshal(&PlanTranslation{PlanName: PlanName, Description: Description})
+	if _, err := d.db.Exec(
+		`UPDATE plans SET translations = jsonb_set(translations, ARRAY[$3::TEXT], $4::JSONB), updated_date = NOW()
+		WHERE id = $1 AND battle_id = $2;`,
+		PlanID, BattleID, Locale, string(Translation),
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to set plan translation")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
+// DeletePlanTranslation removes the plans name and description in another language
+func (d *Database) DeletePlanTranslation(BattleID string, warriorID string, PlanID string, Locale string) ([]*Plan, error) {
+	err := d.confirmPlanDriver(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE plans SET translations = translations - $3::TEXT, updated_date = NOW() WHERE id = $1 AND battle_id = $2;`,
+		PlanID, BattleID, Locale,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to delete plan translation")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
 // BurnPlan removes a plan from the current battle by ID
 func (d *Database) BurnPlan(BattleID string, warriorID string, PlanID string) ([]*Plan, error) {
-	err := d.ConfirmLeader(BattleID, warriorID)
+	err := d.confirmPlanDriver(BattleID, warriorID)
 	if err != nil {
 		return nil, errors.New("incorrect permissions")
 	}
@@ -230,7 +419,7 @@ func (d *Database) BurnPlan(BattleID string, warriorID string, PlanID string) ([
 
 // FinalizePlan sets plan to active: false
 func (d *Database) FinalizePlan(BattleID string, warriorID string, PlanID string, PlanPoints string) ([]*Plan, error) {
-	err := d.ConfirmLeader(BattleID, warriorID)
+	err := d.confirmPlanDriver(BattleID, warriorID)
 	if err != nil {
 		return nil, errors.New("incorrect permissions")
 	}
@@ -244,3 +433,26 @@ func (d *Database) FinalizePlan(BattleID string, warriorID string, PlanID string
 
 	return plans, nil
 }
+
+// SplitPlan creates child plans linked to the parent plan, carrying over any unset details, and marks the parent as split
+func (d *Database) SplitPlan(BattleID string, warriorID string, PlanID string, ChildPlans []*Plan) ([]*Plan, error) {
+	err := d.confirmPlanDriver(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if len(ChildPlans) == 0 {
+		return nil, errors.New("at least one child plan is required")
+	}
+
+	var childPlansJSON, _ = json.Marshal(ChildPlans)
+	if _, err := d.db.Exec(
+		`call split_plan($1, $2, $3);`, BattleID, PlanID, string(childPlansJSON)); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to split plan")
+	}
+
+	plans := d.GetPlans(BattleID, "")
+
+	return plans, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// AskPlanQuestion adds a clarification question to a battles plan
+func (d *Database) AskPlanQuestion(BattleID string, WarriorID string, PlanID string, Question string) ([]*Plan, error) {
+	if _, err := d.db.Exec(
+		`INSERT INTO plan_questions (plan_id, warrior_id, question)
+		SELECT id, $3, $4 FROM plans WHERE id = $2 AND battle_id = $1`,
+		BattleID, PlanID, WarriorID, Question,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add plan question")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
+// ResolvePlanQuestion marks a plans question as resolved with the leaders answer
+func (d *Database) ResolvePlanQuestion(BattleID string, warriorID string, QuestionID string, Answer string) ([]*Plan, error) {
+	err := d.ConfirmLeader(BattleID, warriorID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`UPDATE plan_questions pq SET answer = $3, resolved = true, resolved_date = NOW()
+		FROM plans p
+		WHERE pq.plan_id = p.id AND p.battle_id = $1 AND pq.id = $2`,
+		BattleID, QuestionID, Answer,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to resolve plan question")
+	}
+
+	return d.GetPlans(BattleID, ""), nil
+}
+
+// getPlanQuestions gets the questions for each plan of the battle
+func (d *Database) getPlanQuestions(BattleID string) map[string][]*PlanQuestion {
+	questions := make(map[string][]*PlanQuestion)
+	rows, err := d.db.Query(
+		`SELECT pq.id, pq.plan_id, pq.warrior_id, pq.question, pq.answer, pq.resolved, pq.created_date
+		FROM plan_questions pq
+		JOIN plans p ON p.id = pq.plan_id
+		WHERE p.battle_id = $1
+		ORDER BY pq.created_date`,
+		BattleID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var q PlanQuestion
+			var PlanID string
+			var WarriorID sql.NullString
+			if err := rows.Scan(&q.QuestionID, &PlanID, &WarriorID, &q.Question, &q.Answer, &q.Resolved, &q.CreatedDate); err != nil {
+				log.Println(err)
+			} else {
+				q.WarriorID = WarriorID.String
+				questions[PlanID] = append(questions[PlanID], &q)
+			}
+		}
+	}
+
+	return questions
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// RecordBattleEvent persists an event broadcast to the battle for later replay
+func (d *Database) RecordBattleEvent(BattleID string, Seq uint64, EventType string, EventValue string, WarriorID string) error {
+	if _, err := d.db.Exec(
+		`INSERT INTO battle_events (battle_id, seq, type, value, warrior_id) VALUES ($1, $2, $3, $4, $5);`,
+		BattleID, Seq, EventType, EventValue, WarriorID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to record battle event")
+	}
+
+	return nil
+}
+
+// GetBattleRecording gets the recorded events of a battle the warrior took part in,
+// each with its offset in milliseconds from the first event
+func (d *Database) GetBattleRecording(BattleID string, WarriorID string) ([]*BattleEvent, error) {
+	if !d.IsBattleWarrior(BattleID, WarriorID) {
+		return nil, errors.New("warrior not in battle")
+	}
+
+	var events = make([]*BattleEvent, 0)
+	rows, err := d.db.Query(
+		`SELECT seq, type, coalesce(value, ''), coalesce(warrior_id, ''),
+			(EXTRACT(EPOCH FROM created_date - min(created_date) OVER ()) * 1000)::BIGINT,
+			created_date
+		FROM battle_events
+		WHERE battle_id = $1
+		ORDER BY id`,
+		BattleID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get battle recording")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var be BattleEvent
+		if err := rows.Scan(&be.Seq, &be.Type, &be.Value, &be.WarriorID, &be.Offset, &be.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			events = append(events, &be)
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// voteRetention strips who voted what from the tables besides plans that hold it, each query taking VoteDays,
+// events marks those whose rows count as purged events
+var voteRetention = []struct {
+	table  string
+	query  string
+	events bool
+}{
+	{"battle_state_events", `UPDATE battle_state_events
+		SET state = jsonb_set(state, '{votes}', (SELECT coalesce(jsonb_agg(v - 'warriorId'), '[]'::JSONB) FROM jsonb_array_elements(state->'votes') v))
+		WHERE entity = 'plan' AND created_date < NOW() - make_interval(days => $1)
+		AND jsonb_typeof(state->'votes') = 'array'
+		AND EXISTS (SELECT 1 FROM jsonb_array_elements(state->'votes') v WHERE v ? 'warriorId')`, false},
+	// how long each warrior took to vote goes along with who voted what
+	{"plan_vote_latencies", `DELETE FROM plan_vote_latencies WHERE vote_start < NOW() - make_interval(days => $1)`, false},
+	// submissions only guard against the same vote being counted twice, which doesn't happen this long after
+	{"plan_vote_submissions", `DELETE FROM plan_vote_submissions WHERE created_date < NOW() - make_interval(days => $1)`, false},
+	// events carry the plans with their votes, by now they're delivered or given up on and are kept for reporting
+	{"outbox_events", `UPDATE outbox_events SET payload = '{}'::JSONB
+		WHERE created_date < NOW() - make_interval(days => $1) AND payload <> '{}'::JSONB`, false},
+	// recorded socket events carry who voted in their values, so they go rather than being rewritten
+	{"battle_events", `DELETE FROM battle_events WHERE created_date < NOW() - make_interval(days => $1)`, true},
+}
+
+// ApplyRetention purges battles without activity for BattleDays along with their logs, and strips who voted what
+// from plans, the battle state log, vote submissions, delivered outbox events and recordings older than VoteDays, a value of 0 keeps them forever.
+// Battles starred by any of their warriors are kept. What was purged is saved as a report for admins
+func (d *Database) ApplyRetention(BattleDays int, VoteDays int) (*RetentionReport, error) {
+	report := &RetentionReport{
+		BattleDays: BattleDays,
+		VoteDays:   VoteDays,
+		Battles:    make([]*PurgedBattle, 0),
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to apply retention")
+	}
+	defer tx.Rollback()
+
+	if BattleDays > 0 {
+		rows, err := tx.Query(
+			`SELECT b.id, coalesce(b.name, ''), coalesce(b.leader_id::TEXT, ''), b.created_date, coalesce(b.updated_date, b.created_date)
+			FROM battles b
+			WHERE b.parent_id IS NULL AND coalesce(b.updated_date, b.created_date) < NOW() - make_interval(days => $1)
+			AND NOT EXISTS (SELECT 1 FROM battles_warriors bw WHERE bw.battle_id = b.id AND bw.starred)
+			ORDER BY b.created_date`,
+			BattleDays,
+		)
+		if err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to apply retention")
+		}
+		for rows.Next() {
+			var pb PurgedBattle
+			if err := rows.Scan(&pb.BattleID, &pb.BattleName, &pb.LeaderID, &pb.CreatedDate, &pb.UpdatedDate); err != nil {
+				log.Println(err)
+			} else {
+				report.Battles = append(report.Battles, &pb)
+			}
+		}
+		rows.Close()
+
+		for _, pb := range report.Battles {
+			if _, err := tx.Exec(`CALL purge_battle($1);`, pb.BattleID); err != nil {
+				log.Println(err)
+				return nil, errors.New("unable to apply retention")
+			}
+		}
+
+		// the state log of battles that are gone, both purged now and ended earlier
+		res, err := tx.Exec(
+			`DELETE FROM battle_state_events e
+			WHERE e.created_date < NOW() - make_interval(days => $1)
+			AND NOT EXISTS (SELECT 1 FROM battles b WHERE b.id = e.battle_id)`,
+			BattleDays,
+		)
+		if err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to apply retention")
+		}
+		purged, _ := res.RowsAffected()
+		report.EventsPurged += int(purged)
+	}
+
+	if VoteDays > 0 {
+		res, err := tx.Exec(
+			`UPDATE plans SET votes = (SELECT coalesce(jsonb_agg(v - 'warriorId'), '[]'::JSONB) FROM jsonb_array_elements(votes) v)
+			WHERE coalesce(voteend_time, updated_date) < NOW() - make_interval(days => $1) AND NOT active
+			AND EXISTS (SELECT 1 FROM jsonb_array_elements(votes) v WHERE v ? 'warriorId')`,
+			VoteDays,
+		)
+		if err != nil {
+			log.Println(err)
+			return nil, errors.New("unable to apply retention")
+		}
+		anonymized, _ := res.RowsAffected()
+		report.PlansAnonymized = int(anonymized)
+
+		for _, vr := range voteRetention {
+			res, err := tx.Exec(vr.query, VoteDays)
+			if err != nil {
+				log.Println(err)
+				return nil, errors.New("unable to apply retention")
+			}
+			if vr.events {
+				purged, _ := res.RowsAffected()
+				report.EventsPurged += int(purged)
+			}
+		}
+	}
+
+	Battles, _ := json.Marshal(report.Battles)
+	if err := tx.QueryRow(
+		`INSERT INTO retention_reports (battle_days, vote_days, battles, plans_anonymized, events_purged)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_date`,
+		BattleDays, VoteDays, string(Battles), report.PlansAnonymized, report.EventsPurged,
+	).Scan(&report.ReportID, &report.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to apply retention")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to apply retention")
+	}
+
+	return report, nil
+}
+
+// GetRetentionReports gets the most recent retention reports, newest first
+func (d *Database) GetRetentionReports(Limit int, Offset int) ([]*RetentionReport, error) {
+	var reports = make([]*RetentionReport, 0)
+	rows, err := d.db.Query(
+		`SELECT id, battle_days, vote_days, battles, plans_anonymized, events_purged, created_date
+		FROM retention_reports ORDER BY created_date DESC LIMIT $1 OFFSET $2`,
+		Limit, Offset,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get retention reports")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rr RetentionReport
+		var Battles string
+		if err := rows.Scan(&rr.ReportID, &rr.BattleDays, &rr.VoteDays, &Battles, &rr.PlansAnonymized, &rr.EventsPurged, &rr.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			rr.Battles = make([]*PurgedBattle, 0)
+			_ = json.Unmarshal([]byte(Battles), &rr.Battles)
+			reports = append(reports, &rr)
+		}
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,277 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// Permissions that can be granted through roles, GENERALs (admins) have all of them
+const (
+	PermissionCreateBattles = "create_battles"
+	PermissionManageTeams   = "manage_teams"
+	PermissionViewAnalytics = "view_analytics"
+)
+
+// Permissions lists every permission
+var Permissions = []string{PermissionCreateBattles, PermissionManageTeams, PermissionViewAnalytics}
+
+// EveryoneRole is the role every warrior has without being assigned it
+const EveryoneRole = "everyone"
+
+// GetWarriorPermissions gets the permissions the warrior has through their rank, roles and team roles
+func (d *Database) GetWarriorPermissions(WarriorID string) ([]string, error) {
+	var permissions = make([]string, 0)
+	var Rank string
+	if e := d.db.QueryRow(`SELECT coalesce(rank, '') FROM warriors WHERE id = $1;`, WarriorID).Scan(&Rank); e != nil {
+		log.Println(e)
+		return permissions, errors.New("could not find warrior")
+	}
+	if Rank == "GENERAL" {
+		return append(permissions, Permissions...), nil
+	}
+
+	rows, err := d.db.Query(
+		`SELECT DISTINCT rp.permission
+		FROM role_permissions rp
+		JOIN roles r ON r.id = rp.role_id
+		WHERE r.name = $2
+		OR r.id IN (SELECT role_id FROM warrior_roles WHERE warrior_id = $1)
+		OR r.id IN (
+			SELECT tr.role_id FROM team_roles tr
+			JOIN team_warriors tw ON tw.team_id = tr.team_id AND tw.role = tr.team_role
+			WHERE tw.warrior_id = $1
+		)
+		ORDER BY rp.permission;`,
+		WarriorID, EveryoneRole,
+	)
+	if err != nil {
+		log.Println(err)
+		return permissions, errors.New("could not get warrior permissions")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var Permission string
+		if err := rows.Scan(&Permission); err != nil {
+			log.Println(err)
+		} else {
+			permissions = append(permissions, Permission)
+		}
+	}
+
+	return permissions, nil
+}
+
+// ConfirmPermission confirms the warrior has the permission
+func (d *Database) ConfirmPermission(WarriorID string, Permission string) error {
+	permissions, err := d.GetWarriorPermissions(WarriorID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range permissions {
+		if p == Permission {
+			return nil
+		}
+	}
+
+	return errors.New("warrior does not have permission " + Permission)
+}
+
+// GetRoles gets the roles with their permissions
+func (d *Database) GetRoles() ([]*Role, error) {
+	var roles = make([]*Role, 0)
+	rows, err := d.db.Query(
+		`SELECT r.id, r.name, r.description,
+			coalesce(json_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '[]'::json)
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		GROUP BY r.id
+		ORDER BY r.name;`,
+	)
+	if err != nil {
+		log.Println(err)
+		return roles, errors.New("unable to get roles")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Role
+		var permissions string
+		if err := rows.Scan(&r.RoleID, &r.Name, &r.Description, &permissions); err != nil {
+			log.Println(err)
+		} else {
+			_ = json.Unmarshal([]byte(permissions), &r.Permissions)
+			roles = append(roles, &r)
+		}
+	}
+
+	return roles, nil
+}
+
+// CreateRole adds a role
+func (d *Database) CreateRole(Name string, Description string, Permissions []string) (*Role, error) {
+	var RoleID string
+	if e := d.db.QueryRow(
+		`INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id;`, Name, Description,
+	).Scan(&RoleID); e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to create role")
+	}
+
+	if err := d.setRolePermissions(RoleID, Permissions); err != nil {
+		return nil, err
+	}
+
+	return &Role{RoleID: RoleID, Name: Name, Description: Description, Permissions: Permissions}, nil
+}
+
+// UpdateRole updates a roles description and permissions, the name of the everyone role can't change
+func (d *Database) UpdateRole(RoleID string, Name string, Description string, Permissions []string) error {
+	res, err := d.db.Exec(
+		`UPDATE roles SET name = CASE WHEN name = $4 THEN name ELSE $2 END, description = $3, updated_date = NOW()
+		WHERE id = $1;`,
+		RoleID, Name, Description, EveryoneRole,
+	)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to update role")
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		return errors.New("role not found")
+	}
+
+	return d.setRolePermissions(RoleID, Permissions)
+}
+
+// setRolePermissions replaces the roles permissions
+func (d *Database) setRolePermissions(RoleID string, Permissions []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to set role permissions")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM role_permissions WHERE role_id = $1;`, RoleID); err != nil {
+		log.Println(err)
+		return errors.New("unable to set role permissions")
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO role_permissions (role_id, permission) SELECT $1, unnest($2::TEXT[]);`,
+		RoleID, pq.Array(Permissions),
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to set role permissions")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return errors.New("unable to set role permissions")
+	}
+
+	return nil
+}
+
+// DeleteRole removes a role, the everyone role can't be removed
+func (d *Database) DeleteRole(RoleID string) error {
+	if _, err := d.db.Exec(`DELETE FROM roles WHERE id = $1 AND name != $2;`, RoleID, EveryoneRole); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete role")
+	}
+
+	return nil
+}
+
+// GetRoleAssignments gets the warriors and team roles the role is assigned to
+func (d *Database) GetRoleAssignments(RoleID string) (*RoleAssignments, error) {
+	var a = &RoleAssignments{Warriors: make([]*Warrior, 0)}
+	var teams string
+	e := d.db.QueryRow(
+		`SELECT coalesce(json_agg(json_build_object('teamId', t.id, 'teamName', t.name, 'teamRole', tr.team_role)
+			ORDER BY t.name) FILTER (WHERE t.id IS NOT NULL), '[]'::json)
+		FROM team_roles tr JOIN teams t ON t.id = tr.team_id WHERE tr.role_id = $1;`,
+		RoleID,
+	).Scan(&teams)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("unable to get role assignments")
+	}
+	_ = json.Unmarshal([]byte(teams), &a.Teams)
+
+	rows, err := d.db.Query(
+		`SELECT w.id, w.name, coalesce(w.email, ''), w.rank
+		FROM warrior_roles wr JOIN warriors w ON w.id = wr.warrior_id
+		WHERE wr.role_id = $1 ORDER BY w.name;`,
+		RoleID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get role assignments")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w Warrior
+		if err := rows.Scan(&w.WarriorID, &w.WarriorName, &w.WarriorEmail, &w.WarriorRank); err != nil {
+			log.Println(err)
+		} else {
+			a.Warriors = append(a.Warriors, &w)
+		}
+	}
+
+	return a, nil
+}
+
+// AssignWarriorRole assigns the role to a warrior
+func (d *Database) AssignWarriorRole(RoleID string, WarriorID string) error {
+	if _, err := d.db.Exec(
+		`INSERT INTO warrior_roles (warrior_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;`, WarriorID, RoleID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to assign role")
+	}
+
+	return nil
+}
+
+// UnassignWarriorRole removes the role from a warrior
+func (d *Database) UnassignWarriorRole(RoleID string, WarriorID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM warrior_roles WHERE warrior_id = $1 AND role_id = $2;`, WarriorID, RoleID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to unassign role")
+	}
+
+	return nil
+}
+
+// AssignTeamRole assigns the role to every warrior with the team role (ADMIN or MEMBER) in the team
+func (d *Database) AssignTeamRole(RoleID string, TeamID string, TeamRole string) error {
+	if _, err := d.db.Exec(
+		`INSERT INTO team_roles (team_id, team_role, role_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;`,
+		TeamID, TeamRole, RoleID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to assign role")
+	}
+
+	return nil
+}
+
+// UnassignTeamRole removes the role from the team role
+func (d *Database) UnassignTeamRole(RoleID string, TeamID string, TeamRole string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM team_roles WHERE team_id = $1 AND team_role = $2 AND role_id = $3;`,
+		TeamID, TeamRole, RoleID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to unassign role")
+	}
+
+	return nil
+}
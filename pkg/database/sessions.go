@@ -0,0 +1,188 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+)
+
+// maxUserAgentLength is as much of the browser's user agent as is kept with a session
+const maxUserAgentLength = 512
+
+// hashSessionToken hashes the session token so the sessions table can't be used to log in (not reversible)
+func hashSessionToken(Token string) string {
+	hash := sha256.Sum256([]byte(Token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// newSessionToken generates the random token a browser holds its session by
+func newSessionToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Println(err)
+		return "", errors.New("error generating session token")
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// truncateUserAgent keeps as much of the user agent as is kept with a session
+func truncateUserAgent(UserAgent string) string {
+	if len(UserAgent) > maxUserAgentLength {
+		return strings.ToValidUTF8(UserAgent[:maxUserAgentLength], "")
+	}
+
+	return UserAgent
+}
+
+// CreateWarriorSession starts a session for the warrior on the browser with the user agent lasting the days, getting
+// the token the browser holds it by
+func (d *Database) CreateWarriorSession(WarriorID string, UserAgent string, Days int) (string, error) {
+	Token, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := d.db.Exec(
+		`INSERT INTO warrior_sessions (token_hash, warrior_id, user_agent, expire_date) VALUES ($1, $2, $3, NOW() + make_interval(days => $4));`,
+		hashSessionToken(Token),
+		WarriorID,
+		truncateUserAgent(UserAgent),
+		Days,
+	); err != nil {
+		log.Println(err)
+		return "", errors.New("unable to create session")
+	}
+
+	return Token, nil
+}
+
+// ExchangeLegacyCookie starts a session for the warrior in place of the cookie from before sessions were stored,
+// which held the warrior ID, getting the token the browser holds it by. A cookie already exchanged isn't again
+func (d *Database) ExchangeLegacyCookie(WarriorID string, Cookie string, UserAgent string, Days int) (string, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return "", errors.New("unable to exchange legacy cookie")
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`INSERT INTO warrior_legacy_cookies (cookie_hash) VALUES ($1) ON CONFLICT DO NOTHING;`,
+		hashSessionToken(Cookie),
+	)
+	if err != nil {
+		log.Println(err)
+		return "", errors.New("unable to exchange legacy cookie")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", errors.New("legacy cookie already exchanged")
+	}
+
+	Token, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO warrior_sessions (token_hash, warrior_id, user_agent, expire_date) VALUES ($1, $2, $3, NOW() + make_interval(days => $4));`,
+		hashSessionToken(Token),
+		WarriorID,
+		truncateUserAgent(UserAgent),
+		Days,
+	); err != nil {
+		log.Println(err)
+		return "", errors.New("unable to exchange legacy cookie")
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return "", errors.New("unable to exchange legacy cookie")
+	}
+
+	return Token, nil
+}
+
+// GetSession gets the unexpired session held by the token
+func (d *Database) GetSession(Token string) (*WarriorSession, error) {
+	var ws WarriorSession
+	if err := d.db.QueryRow(
+		`SELECT id, warrior_id, user_agent, created_date, expire_date
+		FROM warrior_sessions WHERE token_hash = $1 AND NOW() < expire_date;`,
+		hashSessionToken(Token),
+	).Scan(
+		&ws.SessionID,
+		&ws.WarriorID,
+		&ws.UserAgent,
+		&ws.CreatedDate,
+		&ws.ExpireDate,
+	); err != nil {
+		return nil, errors.New("session not found")
+	}
+
+	return &ws, nil
+}
+
+// GetWarriorSessions gets the warrior's unexpired sessions, newest first
+func (d *Database) GetWarriorSessions(WarriorID string) ([]*WarriorSession, error) {
+	var Sessions = make([]*WarriorSession, 0)
+	rows, err := d.db.Query(
+		`SELECT id, warrior_id, user_agent, created_date, expire_date
+		FROM warrior_sessions WHERE warrior_id = $1 AND NOW() < expire_date
+		ORDER BY created_date DESC;`,
+		WarriorID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ws WarriorSession
+		if err := rows.Scan(
+			&ws.SessionID,
+			&ws.WarriorID,
+			&ws.UserAgent,
+			&ws.CreatedDate,
+			&ws.ExpireDate,
+		); err != nil {
+			log.Println(err)
+		} else {
+			Sessions = append(Sessions, &ws)
+		}
+	}
+
+	return Sessions, nil
+}
+
+// DeleteWarriorSession ends the warrior's session, logging its browser out
+func (d *Database) DeleteWarriorSession(WarriorID string, SessionID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM warrior_sessions WHERE id = $1 AND warrior_id = $2;`, SessionID, WarriorID); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// PurgeExpiredSessions deletes the sessions that expired, and the exchanged legacy cookies that are too old to be
+// accepted anyway
+func (d *Database) PurgeExpiredSessions() error {
+	if _, err := d.db.Exec(
+		`DELETE FROM warrior_sessions WHERE expire_date <= NOW();`); err != nil {
+		log.Println(err)
+		return err
+	}
+	// signed cookies stop decoding 30 days after they were issued
+	if _, err := d.db.Exec(
+		`DELETE FROM warrior_legacy_cookies WHERE created_date <= NOW() - INTERVAL '30 days';`); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
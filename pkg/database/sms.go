@@ -0,0 +1,116 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// AddBattleSMSVoter adds a warrior to the battle who votes by texting from the phone number,
+// a phone votes in the battle it was most recently added to
+func (d *Database) AddBattleSMSVoter(BattleID string, LeaderID string, Name string, Phone string) (*SMSVoter, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	var voter = &SMSVoter{WarriorName: Name, Phone: Phone}
+	tx, err := d.db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add sms voter")
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(
+		`INSERT INTO warriors (name, notifications_enabled) VALUES ($1, false) RETURNING id`, Name,
+	).Scan(&voter.WarriorID); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add sms voter")
+	}
+	// sms voters are always active so auto finish voting waits for their vote
+	if _, err := tx.Exec(
+		`INSERT INTO battles_warriors (battle_id, warrior_id, active) VALUES ($1, $2, true)`,
+		BattleID, voter.WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add sms voter")
+	}
+	if err := tx.QueryRow(
+		`INSERT INTO battle_sms_voters (battle_id, phone, warrior_id) VALUES ($1, $2, $3) RETURNING created_date`,
+		BattleID, Phone, voter.WarriorID,
+	).Scan(&voter.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("phone already voting in battle")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add sms voter")
+	}
+
+	return voter, nil
+}
+
+// GetBattleSMSVoters gets the warriors voting in the battle by text message
+func (d *Database) GetBattleSMSVoters(BattleID string, LeaderID string) ([]*SMSVoter, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	var voters = make([]*SMSVoter, 0)
+	rows, err := d.db.Query(
+		`SELECT w.id, w.name, sv.phone, sv.created_date
+		FROM battle_sms_voters sv
+		JOIN warriors w ON w.id = sv.warrior_id
+		WHERE sv.battle_id = $1
+		ORDER BY w.name`,
+		BattleID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get sms voters")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var sv SMSVoter
+		if err := rows.Scan(&sv.WarriorID, &sv.WarriorName, &sv.Phone, &sv.CreatedDate); err != nil {
+			log.Println(err)
+		} else {
+			voters = append(voters, &sv)
+		}
+	}
+
+	return voters, nil
+}
+
+// RemoveBattleSMSVoter stops a phone voting in the battle, its votes so far are kept
+func (d *Database) RemoveBattleSMSVoter(BattleID string, LeaderID string, WarriorID string) ([]*BattleWarrior, error) {
+	err := d.ConfirmLeader(BattleID, LeaderID)
+	if err != nil {
+		return nil, errors.New("incorrect permissions")
+	}
+
+	if _, err := d.db.Exec(
+		`DELETE FROM battle_sms_voters WHERE battle_id = $1 AND warrior_id = $2`, BattleID, WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to remove sms voter")
+	}
+
+	return d.RetreatWarrior(BattleID, WarriorID), nil
+}
+
+// GetSMSVoter gets the battle and warrior a phone number votes as
+func (d *Database) GetSMSVoter(Phone string) (BattleID string, WarriorID string, err error) {
+	e := d.db.QueryRow(
+		`SELECT battle_id, warrior_id FROM battle_sms_voters WHERE phone = $1 ORDER BY created_date DESC LIMIT 1`,
+		Phone,
+	).Scan(&BattleID, &WarriorID)
+	if e != nil {
+		return "", "", errors.New("phone not voting in a battle")
+	}
+
+	return BattleID, WarriorID, nil
+}
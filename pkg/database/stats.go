@@ -0,0 +1,53 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// GetWarriorVoteHistory gets the votes the warrior cast on plans whose voting ended between From and To, oldest
+// first, along with the points each plan ended up with
+func (d *Database) GetWarriorVoteHistory(WarriorID string, From time.Time, To time.Time) ([]*WarriorVote, error) {
+	var votes = make([]*WarriorVote, 0)
+	rows, err := d.db.Query(
+		`SELECT p.battle_id, p.id, v->>'vote', coalesce(p.points, ''), p.voteend_time
+		FROM plans p, jsonb_array_elements(p.votes) v
+		WHERE v->>'warriorId' = $1 AND p.voteend_time >= $2 AND p.voteend_time < $3
+		ORDER BY p.voteend_time`,
+		WarriorID, From, To,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get warrior votes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v WarriorVote
+		if err := rows.Scan(&v.BattleID, &v.PlanID, &v.VoteValue, &v.Points, &v.VotedDate); err != nil {
+			log.Println(err)
+		} else {
+			votes = append(votes, &v)
+		}
+	}
+
+	return votes, nil
+}
+
+// CountWarriorBattles counts the battles created between From and To the warrior joined or leads
+func (d *Database) CountWarriorBattles(WarriorID string, From time.Time, To time.Time) (Joined int, Led int, err error) {
+	if err := d.db.QueryRow(
+		`SELECT count(*), count(*) FILTER (WHERE b.leader_id = $1)
+		FROM battles b
+		WHERE b.created_date >= $2 AND b.created_date < $3 AND (
+			b.leader_id = $1 OR EXISTS (SELECT 1 FROM battles_warriors bw WHERE bw.battle_id = b.id AND bw.warrior_id = $1)
+		)`,
+		WarriorID, From, To,
+	).Scan(&Joined, &Led); err != nil {
+		log.Println(err)
+		return 0, 0, errors.New("unable to count warrior battles")
+	}
+
+	return Joined, Led, nil
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// ErrWarriorNotFound is returned when adding a warrior to a team by an email no registered warrior has
+var ErrWarriorNotFound = errors.New("warrior not found")
+
+// CreateTeam creates a new team with the warrior as its admin
+func (d *Database) CreateTeam(WarriorID string, TeamName string) (*Team, error) {
+	newID, _ := uuid.NewUUID()
+	var t = &Team{
+		TeamID:   newID.String(),
+		TeamName: TeamName,
+		Role:     "ADMIN",
+	}
+
+	if _, err := d.db.Exec(
+		`call create_team($1, $2, $3);`, t.TeamID, TeamName, WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create team")
+	}
+
+	return t, nil
+}
+
+// GetTeam gets a team by ID including its warriors
+func (d *Database) GetTeam(TeamID string) (*Team, error) {
+	var t = &Team{
+		Warriors: make([]*TeamWarrior, 0),
+	}
+
+	e := d.db.QueryRow(
+		`SELECT id, name, created_date FROM teams WHERE id = $1`,
+		TeamID,
+	).Scan(&t.TeamID, &t.TeamName, &t.CreatedDate)
+	if e != nil {
+		log.Println(e)
+		return nil, errors.New("team not found")
+	}
+
+	rows, err := d.db.Query(
+		`SELECT w.id, w.name, coalesce(w.email, ''), w.avatar, tw.role
+		FROM team_warriors tw
+		LEFT JOIN warriors w ON w.id = tw.warrior_id
+		WHERE tw.team_id = $1
+		ORDER BY w.name`,
+		TeamID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var tw TeamWarrior
+			if err := rows.Scan(&tw.WarriorID, &tw.WarriorName, &tw.WarriorEmail, &tw.WarriorAvatar, &tw.Role); err != nil {
+				log.Println(err)
+			} else {
+				t.Warriors = append(t.Warriors, &tw)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// GetTeamsByWarrior gets a list of teams the warrior belongs to
+func (d *Database) GetTeamsByWarrior(WarriorID string) []*Team {
+	var teams = make([]*Team, 0)
+	rows, err := d.db.Query(
+		`SELECT t.id, t.name, t.created_date, tw.role
+		FROM team_warriors tw
+		LEFT JOIN teams t ON t.id = tw.team_id
+		WHERE tw.warrior_id = $1
+		ORDER BY t.name`,
+		WarriorID,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var t Team
+			if err := rows.Scan(&t.TeamID, &t.TeamName, &t.CreatedDate, &t.Role); err != nil {
+				log.Println(err)
+			} else {
+				teams = append(teams, &t)
+			}
+		}
+	}
+
+	return teams
+}
+
+// GetTeamWarriorRole gets the warriors role in the team, erroring if not a member
+func (d *Database) GetTeamWarriorRole(TeamID string, WarriorID string) (string, error) {
+	var role string
+	e := d.db.QueryRow(
+		`SELECT role FROM team_warriors WHERE team_id = $1 AND warrior_id = $2`,
+		TeamID,
+		WarriorID,
+	).Scan(&role)
+	if e != nil {
+		if e != sql.ErrNoRows {
+			log.Println(e)
+		}
+		return "", errors.New("warrior not a team member")
+	}
+
+	return role, nil
+}
+
+// TeamAddWarrior adds a registered warrior to the team by email, or changes their role when already on it
+func (d *Database) TeamAddWarrior(TeamID string, WarriorEmail string, Role string) (*Team, error) {
+	res, err := d.db.Exec(
+		`INSERT INTO team_warriors (team_id, warrior_id, role)
+		SELECT $1, w.id, $3 FROM warriors w WHERE w.email = $2
+		ON CONFLICT (team_id, warrior_id) DO UPDATE SET role = $3`,
+		TeamID,
+		WarriorEmail,
+		Role,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to add warrior to team")
+	}
+	if added, _ := res.RowsAffected(); added == 0 {
+		return nil, ErrWarriorNotFound
+	}
+
+	return d.GetTeam(TeamID)
+}
+
+// TeamJoin adds the warrior to the team as a member, warriors already on the team keep their role
+func (d *Database) TeamJoin(TeamID string, WarriorID string) (*Team, error) {
+	if _, err := d.db.Exec(
+		`INSERT INTO team_warriors (team_id, warrior_id, role) VALUES ($1, $2, 'MEMBER')
+		ON CONFLICT (team_id, warrior_id) DO NOTHING`,
+		TeamID,
+		WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to join team")
+	}
+
+	return d.GetTeam(TeamID)
+}
+
+// TeamRemoveWarrior removes a warrior from the team
+func (d *Database) TeamRemoveWarrior(TeamID string, WarriorID string) (*Team, error) {
+	if _, err := d.db.Exec(
+		`DELETE FROM team_warriors WHERE team_id = $1 AND warrior_id = $2`,
+		TeamID,
+		WarriorID,
+	); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to remove warrior from team")
+	}
+
+	return d.GetTeam(TeamID)
+}
+
+// DeleteTeam removes the team, its battles are kept but no longer associated
+func (d *Database) DeleteTeam(TeamID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM teams WHERE id = $1`, TeamID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete team")
+	}
+
+	return nil
+}
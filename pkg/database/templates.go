@@ -0,0 +1,61 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// CreateBattleTemplate adds a battle template to the gallery, the document being a battle export
+func (d *Database) CreateBattleTemplate(Name string, Description string, Document json.RawMessage, CreatedBy string) (*BattleTemplate, error) {
+	var t = &BattleTemplate{
+		Name:        Name,
+		Description: Description,
+		Document:    Document,
+	}
+
+	if err := d.db.QueryRow(
+		`INSERT INTO battle_templates (name, description, document, created_by) VALUES ($1, $2, $3::JSONB, $4)
+		RETURNING id, created_date;`,
+		Name, Description, string(Document), CreatedBy,
+	).Scan(&t.TemplateID, &t.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create battle template")
+	}
+
+	return t, nil
+}
+
+// GetBattleTemplates gets the templates admins added to the gallery
+func (d *Database) GetBattleTemplates() []*BattleTemplate {
+	var templates = make([]*BattleTemplate, 0)
+	rows, err := d.db.Query(
+		`SELECT id, name, description, document, created_date FROM battle_templates ORDER BY name`,
+	)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var t BattleTemplate
+			var document []byte
+			if err := rows.Scan(&t.TemplateID, &t.Name, &t.Description, &document, &t.CreatedDate); err != nil {
+				log.Println(err)
+			} else {
+				t.Document = json.RawMessage(document)
+				templates = append(templates, &t)
+			}
+		}
+	}
+
+	return templates
+}
+
+// DeleteBattleTemplate removes the template from the gallery
+func (d *Database) DeleteBattleTemplate(TemplateID string) error {
+	if _, err := d.db.Exec(
+		`DELETE FROM battle_templates WHERE id = $1`, TemplateID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete battle template")
+	}
+
+	return nil
+}
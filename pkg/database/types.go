@@ -2,7 +2,10 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/secrets"
 )
 
 // Config holds all the configuration for the db
@@ -17,8 +20,9 @@ type Config struct {
 
 // Database contains all the methods to interact with DB
 type Database struct {
-	config *Config
-	db     *sql.DB
+	config  *Config
+	db      *sql.DB
+	secrets *secrets.Keyring
 }
 
 // BattleWarrior aka user
@@ -38,10 +42,67 @@ type Battle struct {
 	BattleName         string           `json:"name"`
 	Warriors           []*BattleWarrior `json:"warriors"`
 	Plans              []*Plan          `json:"plans"`
+	PlanCount          int              `json:"planCount"`
 	VotingLocked       bool             `json:"votingLocked"`
 	ActivePlanID       string           `json:"activePlanId"`
 	PointValuesAllowed []string         `json:"pointValuesAllowed"`
 	AutoFinishVoting   bool             `json:"autoFinishVoting"`
+	Timezone           string           `json:"timezone"`
+	Locale             string           `json:"locale"`
+	TeamID             string           `json:"teamId"`
+	RequireReady       bool             `json:"requireReady"`
+	DotBudget          int              `json:"dotBudget"`
+	Confidence         *Confidence      `json:"confidence"`
+	ParentID           string           `json:"parentId"`
+	Breakouts          []*Breakout      `json:"breakouts"`
+	Checklist          []*ChecklistItem `json:"checklist"`
+	Notes              *BattleNotes     `json:"notes"`
+	LiveWarriors       int              `json:"liveWarriors"`
+	VotingInProgress   bool             `json:"votingInProgress"`
+	Starred            bool             `json:"starred"`
+	RaisedHands        []*RaisedHand    `json:"raisedHands"`
+	CreatedDate        time.Time        `json:"createdDate"`
+	UpdatedDate        time.Time        `json:"updatedDate"`
+}
+
+// BattleFilter narrows down a warriors list of battles, empty fields don't filter
+type BattleFilter struct {
+	// Search matches part of the battle name ignoring case
+	Search string
+	// Status is active, voting (a plan is being voted on) or completed (every plan pointed or skipped)
+	Status string
+	// CreatedFrom and CreatedTo bound when the battle was created, CreatedTo is exclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Role is owned for battles the warrior leads or joined for the others
+	Role string
+}
+
+// BattleNotes is the battles shared scratchpad, Version goes up with every revision
+type BattleNotes struct {
+	Notes   string `json:"notes"`
+	Version int    `json:"version"`
+}
+
+// BattleState is the compact state of a battle polled by low-power clients
+type BattleState struct {
+	BattleID           string           `json:"id"`
+	BattleName         string           `json:"name"`
+	VotingLocked       bool             `json:"votingLocked"`
+	PointValuesAllowed []string         `json:"pointValuesAllowed"`
+	ActivePlan         *BattleStatePlan `json:"activePlan"`
+	// Voted is whether the warrior polling has voted on the active plan
+	Voted bool `json:"voted"`
+}
+
+// BattleStatePlan is the active plan of a BattleState
+type BattleStatePlan struct {
+	PlanID      string `json:"id"`
+	PlanName    string `json:"name"`
+	Type        string `json:"type"`
+	ReferenceID string `json:"referenceId"`
+	Link        string `json:"link"`
+	Points      string `json:"points"`
 }
 
 // Warrior aka user
@@ -53,29 +114,155 @@ type Warrior struct {
 	WarriorAvatar        string `json:"avatar"`
 	Verified             bool   `json:"verified"`
 	NotificationsEnabled bool   `json:"notificationsEnabled"`
+	// Handle is the optional unique name the warrior is @mentioned by
+	Handle string `json:"handle"`
+	// LastLogin and LastActive are only included in admin listings
+	LastLogin   *time.Time `json:"lastLogin,omitempty"`
+	LastActive  *time.Time `json:"lastActive,omitempty"`
+	CreatedDate time.Time  `json:"createdDate"`
+	UpdatedDate time.Time  `json:"updatedDate"`
 }
 
-// Vote structure
-type Vote struct {
-	WarriorID string `json:"warriorId"`
-	VoteValue string `json:"vote"`
+// WarriorSearch filters the registered warriors, empty fields don't filter
+type WarriorSearch struct {
+	// Query matches part of the name or email
+	Query    string
+	Rank     string
+	Verified *bool
+	// ActiveAfter and ActiveBefore bound when the warrior was last active
+	ActiveAfter  *time.Time
+	ActiveBefore *time.Time
+	Limit        int
+	Offset       int
 }
 
-// Plan aka Story structure
-type Plan struct {
-	PlanID             string    `json:"id"`
+// Role is a named set of permissions assigned to warriors directly or through their team role
+type Role struct {
+	RoleID      string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleAssignments are the warriors and team roles a role is assigned to
+type RoleAssignments struct {
+	Warriors []*Warrior `json:"warriors"`
+	Teams    []struct {
+		TeamID   string `json:"teamId"`
+		TeamName string `json:"teamName"`
+		TeamRole string `json:"teamRole"`
+	} `json:"teams"`
+}
+
+// SMSVoter is a battle participant without a laptop voting by text message from their phone
+type SMSVoter struct {
+	WarriorID   string    `json:"id"`
+	WarriorName string    `json:"name"`
+	Phone       string    `json:"phone"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+// ActionItem is a follow up the leader recorded during a battle
+type ActionItem struct {
+	ActionItemID string    `json:"id"`
+	Content      string    `json:"content"`
+	OwnerID      string    `json:"ownerId"`
+	OwnerName    string    `json:"ownerName"`
+	DueDate      string    `json:"dueDate"`
+	Completed    bool      `json:"completed"`
+	CreatedDate  time.Time `json:"createdDate"`
+}
+
+// ParkedPlan is a plan waiting in a teams parking lot to be pulled into a battle
+type ParkedPlan struct {
+	ParkedPlanID       string    `json:"id"`
 	PlanName           string    `json:"name"`
 	Type               string    `json:"type"`
 	ReferenceID        string    `json:"referenceId"`
 	Link               string    `json:"link"`
 	Description        string    `json:"description"`
 	AcceptanceCriteria string    `json:"acceptanceCriteria"`
-	Votes              []*Vote   `json:"votes"`
-	Points             string    `json:"points"`
-	PlanActive         bool      `json:"active"`
-	PlanSkipped        bool      `json:"skipped"`
-	VoteStartTime      time.Time `json:"voteStartTime"`
-	VoteEndTime        time.Time `json:"voteEndTime"`
+	CreatedDate        time.Time `json:"createdDate"`
+}
+
+// Vote structure
+type Vote struct {
+	WarriorID   string    `json:"warriorId"`
+	VoteValue   string    `json:"vote"`
+	CreatedDate time.Time `json:"createdDate"`
+	// UpdatedDate is when the vote was last changed
+	UpdatedDate time.Time `json:"updatedDate"`
+}
+
+// Plan aka Story structure
+type Plan struct {
+	PlanID             string          `json:"id"`
+	PlanName           string          `json:"name"`
+	Type               string          `json:"type"`
+	ReferenceID        string          `json:"referenceId"`
+	Link               string          `json:"link"`
+	Description        string          `json:"description"`
+	AcceptanceCriteria string          `json:"acceptanceCriteria"`
+	Votes              []*Vote         `json:"votes"`
+	Points             string          `json:"points"`
+	PlanActive         bool            `json:"active"`
+	PlanSkipped        bool            `json:"skipped"`
+	VoteStartTime      time.Time       `json:"voteStartTime"`
+	VoteEndTime        time.Time       `json:"voteEndTime"`
+	ParentID           string          `json:"parentId"`
+	Split              bool            `json:"split"`
+	Checked            []string        `json:"checked"`
+	Questions          []*PlanQuestion `json:"questions"`
+	DependsOn          []string        `json:"dependsOn"`
+	Dots               int             `json:"dots"`
+	Version            int             `json:"version"`
+	IssueProvider      string          `json:"issueProvider"`
+	ExternalID         string          `json:"externalId"`
+	// Translations of the name and description by locale
+	Translations map[string]*PlanTranslation `json:"translations"`
+	CreatedDate  time.Time                   `json:"createdDate"`
+	UpdatedDate  time.Time                   `json:"updatedDate"`
+}
+
+// PlanTranslation is a plans name and description in another language
+type PlanTranslation struct {
+	PlanName    string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SyncedPlan is a plan reconciled with the tracker issue it was imported from
+type SyncedPlan struct {
+	PlanID   string `json:"planId"`
+	BattleID string `json:"-"`
+	PlanName string `json:"planName"`
+	Provider string `json:"provider"`
+	// Changed is whether the plan took changes made to the issue
+	Changed bool `json:"changed"`
+	// Conflicts are the fields edited differently on both sides, left for the leader to resolve
+	Conflicts []string `json:"conflicts"`
+	// Push are the fields edited only in the plan, to be written to the issue
+	Push map[string]string `json:"-"`
+}
+
+// IssueConflict is a plan field edited differently in the plan and the issue it was imported from
+type IssueConflict struct {
+	PlanID      string    `json:"planId"`
+	PlanName    string    `json:"planName"`
+	Field       string    `json:"field"`
+	Mine        string    `json:"mine"`
+	Theirs      string    `json:"theirs"`
+	Base        string    `json:"base"`
+	UpdatedDate time.Time `json:"updatedDate"`
+}
+
+// PlanQuestion is a clarification question raised on a plan before voting
+type PlanQuestion struct {
+	QuestionID  string    `json:"id"`
+	WarriorID   string    `json:"warriorId"`
+	Question    string    `json:"question"`
+	Answer      string    `json:"answer"`
+	Resolved    bool      `json:"resolved"`
+	CreatedDate time.Time `json:"createdDate"`
 }
 
 // APIKey structure
@@ -89,3 +276,314 @@ type APIKey struct {
 	CreatedDate time.Time `json:"createdDate"`
 	UpdatedDate time.Time `json:"updatedDate"`
 }
+
+// WarriorSession is a browser the warrior is logged in on
+type WarriorSession struct {
+	SessionID   string    `json:"id"`
+	WarriorID   string    `json:"-"`
+	UserAgent   string    `json:"userAgent"`
+	CreatedDate time.Time `json:"createdDate"`
+	ExpireDate  time.Time `json:"expireDate"`
+	// Current is whether it's the session the sessions were listed with
+	Current bool `json:"current"`
+}
+
+// APIKeyRequest is an audited request made with an API key
+type APIKeyRequest struct {
+	ID          int64     `json:"id"`
+	KeyID       string    `json:"keyId"`
+	Prefix      string    `json:"prefix"`
+	WarriorID   string    `json:"warriorId"`
+	Method      string    `json:"method"`
+	Route       string    `json:"route"`
+	Detail      string    `json:"detail,omitempty"`
+	Status      int       `json:"status"`
+	LatencyMs   int64     `json:"latencyMs"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+// Team structure
+type Team struct {
+	TeamID      string         `json:"id"`
+	TeamName    string         `json:"name"`
+	Role        string         `json:"role,omitempty"`
+	Warriors    []*TeamWarrior `json:"warriors,omitempty"`
+	CreatedDate time.Time      `json:"createdDate"`
+}
+
+// TeamWarrior is a warrior's membership in a team
+type TeamWarrior struct {
+	WarriorID     string `json:"id"`
+	WarriorName   string `json:"name"`
+	WarriorEmail  string `json:"email"`
+	WarriorAvatar string `json:"avatar"`
+	Role          string `json:"role"`
+}
+
+// Department is a group of teams whose admins manage its warriors and battles
+type Department struct {
+	DepartmentID string               `json:"id"`
+	Name         string               `json:"name"`
+	Role         string               `json:"role,omitempty"`
+	Teams        []*Team              `json:"teams,omitempty"`
+	Warriors     []*DepartmentWarrior `json:"warriors,omitempty"`
+	CreatedDate  time.Time            `json:"createdDate"`
+}
+
+// DepartmentWarrior is a warrior's membership in a department
+type DepartmentWarrior struct {
+	WarriorID    string `json:"id"`
+	WarriorName  string `json:"name"`
+	WarriorEmail string `json:"email"`
+	Role         string `json:"role"`
+}
+
+// ChecklistItem is a teams Definition of Ready checklist entry
+type ChecklistItem struct {
+	ItemID    string `json:"id"`
+	Text      string `json:"text"`
+	SortOrder int    `json:"sortOrder"`
+}
+
+// Confidence is the result of a battles fist of five confidence round
+type Confidence struct {
+	Open    bool              `json:"open"`
+	Votes   []*ConfidenceVote `json:"votes"`
+	Average float64           `json:"average"`
+}
+
+// ConfidenceVote is a warriors fist of five confidence vote
+type ConfidenceVote struct {
+	WarriorID  string `json:"warriorId"`
+	Confidence int    `json:"confidence"`
+}
+
+// Breakout is a sub group battle estimating a subset of the parent battles plans
+type Breakout struct {
+	BattleID string   `json:"id"`
+	Name     string   `json:"name"`
+	LeaderID string   `json:"leaderId"`
+	PlanIDs  []string `json:"planIds"`
+}
+
+// BattleEvent is a recorded socket event broadcast to a battle
+type BattleEvent struct {
+	Seq         uint64 `json:"seq"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	WarriorID   string `json:"warriorId"`
+	Offset      int64  `json:"offset"`
+	CreatedDate string `json:"createdDate"`
+}
+
+// OutboxEvent is a battle domain event waiting to be delivered to integrations
+type OutboxEvent struct {
+	ID          int64           `json:"id"`
+	EventType   string          `json:"type"`
+	BattleID    string          `json:"battleId"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	CreatedDate time.Time       `json:"createdDate"`
+}
+
+// Webhook is an endpoint outbox events are posted to, Events empty for every event type
+// and Template empty to post the event as is. Webhooks with a WarriorID are REST hook
+// subscriptions that only get events of the battles the warrior leads
+type Webhook struct {
+	WebhookID   string    `json:"id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Template    string    `json:"template"`
+	Active      bool      `json:"active"`
+	WarriorID   string    `json:"-"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+// EmailDelivery is an attempt at sending an email, Error empty when the SMTP server accepted it
+type EmailDelivery struct {
+	Recipient   string    `json:"recipient"`
+	Subject     string    `json:"subject"`
+	Error       string    `json:"error"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+// NotificationPreference is whether a warrior wants a notification event through a channel
+type NotificationPreference struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+}
+
+// EmailBroadcast is an announcement emailed by an admin to every warrior or a team, warriors with notifications
+// turned off are skipped
+type EmailBroadcast struct {
+	BroadcastID string    `json:"id"`
+	Subject     string    `json:"subject"`
+	Body        string    `json:"body"`
+	TeamID      string    `json:"teamId"`
+	CreatedBy   string    `json:"createdBy"`
+	Recipients  int       `json:"recipients"`
+	Sent        int       `json:"sent"`
+	Failed      int       `json:"failed"`
+	Skipped     int       `json:"skipped"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+// BroadcastEmail is a broadcast waiting to be emailed to one of its recipients
+type BroadcastEmail struct {
+	BroadcastID  string
+	WarriorID    string
+	WarriorName  string
+	WarriorEmail string
+	Subject      string
+	Body         string
+}
+
+// Job is the run status of a scheduled background job
+type Job struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	Runs         int        `json:"runs"`
+	Failures     int        `json:"failures"`
+	LastStarted  *time.Time `json:"lastStarted"`
+	LastFinished *time.Time `json:"lastFinished"`
+	LastError    string     `json:"lastError"`
+}
+
+// PurgedBattle is a battle removed by the retention policy
+type PurgedBattle struct {
+	BattleID    string    `json:"id"`
+	BattleName  string    `json:"name"`
+	LeaderID    string    `json:"leaderId"`
+	CreatedDate time.Time `json:"createdDate"`
+	UpdatedDate time.Time `json:"updatedDate"`
+}
+
+// RetentionReport is what a run of the retention policy purged and anonymized
+type RetentionReport struct {
+	ReportID        int             `json:"id"`
+	BattleDays      int             `json:"battleDays"`
+	VoteDays        int             `json:"voteDays"`
+	Battles         []*PurgedBattle `json:"battles"`
+	PlansAnonymized int             `json:"plansAnonymized"`
+	EventsPurged    int             `json:"eventsPurged"`
+	CreatedDate     time.Time       `json:"createdDate"`
+}
+
+// FederationPeer is another Thunderdome instance whose identity was pinned during the federation handshake
+type FederationPeer struct {
+	PeerID      string    `json:"id"`
+	URL         string    `json:"url"`
+	PublicKey   string    `json:"publicKey"`
+	CreatedDate time.Time `json:"createdDate"`
+	UpdatedDate time.Time `json:"updatedDate"`
+}
+
+// PasswordHashReport is how many registered warriors have passwords hashed each way, the outdated and legacy ones
+// being rehashed as those warriors next log in
+type PasswordHashReport struct {
+	// Current are Argon2id hashes with the configured parameters
+	Current int `json:"current"`
+	// OutdatedParams are Argon2id hashes with other parameters
+	OutdatedParams int `json:"outdatedParams"`
+	// Legacy are bcrypt hashes
+	Legacy int            `json:"legacy"`
+	Params PasswordParams `json:"params"`
+}
+
+// BattleTemplate is a battle in the template gallery for warriors to start their battles from
+type BattleTemplate struct {
+	TemplateID  string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Builtin templates are bundled with Thunderdome rather than added by an admin
+	Builtin bool `json:"builtin"`
+	// Document is the battle as exported, its settings and plans
+	Document    json.RawMessage `json:"document"`
+	CreatedDate time.Time       `json:"createdDate"`
+}
+
+// PlanAttachment is a file attached to a plan, like a mockup or screenshot
+type PlanAttachment struct {
+	AttachmentID string    `json:"id"`
+	PlanID       string    `json:"planId"`
+	WarriorID    string    `json:"warriorId"`
+	Name         string    `json:"name"`
+	ContentType  string    `json:"contentType"`
+	Size         int       `json:"size"`
+	CreatedDate  time.Time `json:"createdDate"`
+}
+
+// WarriorVote is a vote the warrior cast and the points the plan ended up with
+type WarriorVote struct {
+	BattleID  string    `json:"battleId"`
+	PlanID    string    `json:"planId"`
+	VoteValue string    `json:"vote"`
+	Points    string    `json:"points"`
+	VotedDate time.Time `json:"votedDate"`
+}
+
+// WarriorParticipation is how much a warrior took part in battles, what their experience and badges are earned from
+type WarriorParticipation struct {
+	WarriorID     string `json:"warriorId"`
+	WarriorName   string `json:"warriorName"`
+	BattlesJoined int    `json:"battlesJoined"`
+	BattlesLed    int    `json:"battlesLed"`
+	VotesCast     int    `json:"votesCast"`
+	// PerfectConsensusBattles are the battles they were in where every plan was pointed without a differing vote
+	PerfectConsensusBattles int `json:"perfectConsensusBattles"`
+}
+
+// VoteLatency is how long after voting on the plan started the warrior voted
+type VoteLatency struct {
+	PlanID    string `json:"planId"`
+	WarriorID string `json:"warriorId"`
+	LatencyMs int    `json:"latencyMs"`
+}
+
+// WarriorAbsence is a stretch of days a warrior is away, both days included
+type WarriorAbsence struct {
+	AbsenceID string    `json:"id"`
+	WarriorID string    `json:"warriorId"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+	Note      string    `json:"note"`
+}
+
+// BattleSchedule is a team's recurring battle, like sprint planning every other monday
+type BattleSchedule struct {
+	ScheduleID string `json:"id"`
+	TeamID     string `json:"teamId"`
+	Name       string `json:"name"`
+	// Schedule is a five field cron expression running at most once a day
+	Schedule string `json:"schedule"`
+	// Timezone is the time zone the schedule runs in
+	Timezone string `json:"timezone"`
+	// KeyWarriorIDs are the team members the battle can't do without, all of them when empty
+	KeyWarriorIDs []string  `json:"keyWarriors"`
+	CreatedDate   time.Time `json:"createdDate"`
+}
+
+// RaisedHand is a warrior's place in a battle's speaking queue
+type RaisedHand struct {
+	WarriorID  string    `json:"warriorId"`
+	RaisedDate time.Time `json:"raisedDate"`
+}
+
+// SessionFeedback is the anonymous feedback on ended battles summed up by facilitator and by team
+type SessionFeedback struct {
+	Facilitators []*FeedbackSummary `json:"facilitators"`
+	Teams        []*FeedbackSummary `json:"teams"`
+}
+
+// FeedbackSummary is the feedback on a facilitator's or team's sessions
+type FeedbackSummary struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Sessions      int      `json:"sessions"`
+	Responses     int      `json:"responses"`
+	AverageRating float64  `json:"averageRating"`
+	Comments      []string `json:"comments"`
+}
@@ -4,14 +4,20 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
+// ErrHandleTaken is returned when another warrior already has the handle
+var ErrHandleTaken = errors.New("handle taken")
+
 // GetRegisteredWarriors retrieves the registered warriors from db
 func (d *Database) GetRegisteredWarriors(Limit int, Offset int) []*Warrior {
 	var warriors = make([]*Warrior, 0)
 	rows, err := d.db.Query(
 		`
-		SELECT id, name, email, rank, avatar, verified
+		SELECT id, name, email, rank, avatar, verified, last_login, last_active, created_date, updated_date
 		FROM warriors
 		WHERE email IS NOT NULL
 		ORDER BY created_date
@@ -34,10 +40,15 @@ func (d *Database) GetRegisteredWarriors(Limit int, Offset int) []*Warrior {
 				&w.WarriorRank,
 				&w.WarriorAvatar,
 				&w.Verified,
+				&w.LastLogin,
+				&w.LastActive,
+				&w.CreatedDate,
+				&w.UpdatedDate,
 			); err != nil {
 				log.Println(err)
 			} else {
 				w.WarriorEmail = warriorEmail.String
+				utc(&w.CreatedDate, &w.UpdatedDate)
 				warriors = append(warriors, &w)
 			}
 		}
@@ -48,13 +59,142 @@ func (d *Database) GetRegisteredWarriors(Limit int, Offset int) []*Warrior {
 	return warriors
 }
 
+// likeEscaper escapes the LIKE wildcards so they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchRegisteredWarriors finds the registered warriors matching the search
+func (d *Database) SearchRegisteredWarriors(Search *WarriorSearch) []*Warrior {
+	var warriors = make([]*Warrior, 0)
+	rows, err := d.db.Query(
+		`
+		SELECT id, name, email, rank, avatar, verified, last_login, last_active, created_date, updated_date
+		FROM warriors
+		WHERE email IS NOT NULL
+		AND ($1 = '' OR name ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+		AND ($2 = '' OR rank = $2)
+		AND ($3::BOOL IS NULL OR verified = $3)
+		AND ($4::TIMESTAMP IS NULL OR last_active >= $4)
+		AND ($5::TIMESTAMP IS NULL OR last_active < $5)
+		ORDER BY created_date
+		LIMIT $6
+		OFFSET $7
+		`,
+		likeEscaper.Replace(Search.Query),
+		Search.Rank,
+		Search.Verified,
+		Search.ActiveAfter,
+		Search.ActiveBefore,
+		Search.Limit,
+		Search.Offset,
+	)
+	if err != nil {
+		log.Println(err)
+		return warriors
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w Warrior
+		var warriorEmail sql.NullString
+
+		if err := rows.Scan(
+			&w.WarriorID,
+			&w.WarriorName,
+			&warriorEmail,
+			&w.WarriorRank,
+			&w.WarriorAvatar,
+			&w.Verified,
+			&w.LastLogin,
+			&w.LastActive,
+			&w.CreatedDate,
+			&w.UpdatedDate,
+		); err != nil {
+			log.Println(err)
+		} else {
+			w.WarriorEmail = warriorEmail.String
+			utc(&w.CreatedDate, &w.UpdatedDate)
+			warriors = append(warriors, &w)
+		}
+	}
+
+	return warriors
+}
+
+// GetInactiveWarriors gets the registered warriors that haven't been active for the given number of days, least recently active first
+func (d *Database) GetInactiveWarriors(Days int, Limit int, Offset int) []*Warrior {
+	var warriors = make([]*Warrior, 0)
+	rows, err := d.db.Query(
+		`
+		SELECT id, name, email, rank, avatar, verified, last_login, last_active, created_date, updated_date
+		FROM warriors
+		WHERE email IS NOT NULL AND (last_active IS NULL OR last_active < NOW() - make_interval(days => $1))
+		ORDER BY last_active NULLS FIRST
+		LIMIT $2
+		OFFSET $3
+		`,
+		Days,
+		Limit,
+		Offset,
+	)
+	if err != nil {
+		log.Println(err)
+		return warriors
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w Warrior
+		var warriorEmail sql.NullString
+
+		if err := rows.Scan(
+			&w.WarriorID,
+			&w.WarriorName,
+			&warriorEmail,
+			&w.WarriorRank,
+			&w.WarriorAvatar,
+			&w.Verified,
+			&w.LastLogin,
+			&w.LastActive,
+			&w.CreatedDate,
+			&w.UpdatedDate,
+		); err != nil {
+			log.Println(err)
+		} else {
+			w.WarriorEmail = warriorEmail.String
+			utc(&w.CreatedDate, &w.UpdatedDate)
+			warriors = append(warriors, &w)
+		}
+	}
+
+	return warriors
+}
+
+// RecordWarriorLogin records the warrior logging in
+func (d *Database) RecordWarriorLogin(WarriorID string) {
+	if _, err := d.db.Exec(
+		`UPDATE warriors SET last_login = NOW(), last_active = NOW() WHERE id = $1;`, WarriorID,
+	); err != nil {
+		log.Println(err)
+	}
+}
+
+// TouchWarriorActivity records the warrior being active, at most every few minutes to save on writes
+func (d *Database) TouchWarriorActivity(WarriorID string) {
+	if _, err := d.db.Exec(
+		`UPDATE warriors SET last_active = NOW() WHERE id = $1 AND last_active < NOW() - INTERVAL '5 minutes';`,
+		WarriorID,
+	); err != nil {
+		log.Println(err)
+	}
+}
+
 // GetWarrior gets a warrior from db by ID
 func (d *Database) GetWarrior(WarriorID string) (*Warrior, error) {
 	var w Warrior
 	var warriorEmail sql.NullString
 
 	e := d.db.QueryRow(
-		"SELECT id, name, email, rank, avatar, verified, notifications_enabled FROM warriors WHERE id = $1",
+		"SELECT id, name, email, rank, avatar, verified, notifications_enabled, coalesce(handle, ''), created_date, updated_date FROM warriors WHERE id = $1",
 		WarriorID,
 	).Scan(
 		&w.WarriorID,
@@ -64,6 +204,9 @@ func (d *Database) GetWarrior(WarriorID string) (*Warrior, error) {
 		&w.WarriorAvatar,
 		&w.Verified,
 		&w.NotificationsEnabled,
+		&w.Handle,
+		&w.CreatedDate,
+		&w.UpdatedDate,
 	)
 	if e != nil {
 		log.Println(e)
@@ -71,6 +214,7 @@ func (d *Database) GetWarrior(WarriorID string) (*Warrior, error) {
 	}
 
 	w.WarriorEmail = warriorEmail.String
+	utc(&w.CreatedDate, &w.UpdatedDate)
 
 	return &w, nil
 }
@@ -78,7 +222,7 @@ func (d *Database) GetWarrior(WarriorID string) (*Warrior, error) {
 func (d *Database) GetWarriorByEmail(WarriorEmail string) (*Warrior, error) {
 	var w Warrior
 	e := d.db.QueryRow(
-		"SELECT id, name, email, rank, verified FROM warriors WHERE email = $1",
+		"SELECT id, name, email, rank, verified, created_date, updated_date FROM warriors WHERE email = $1",
 		WarriorEmail,
 	).Scan(
 		&w.WarriorID,
@@ -86,11 +230,14 @@ func (d *Database) GetWarriorByEmail(WarriorEmail string) (*Warrior, error) {
 		&w.WarriorEmail,
 		&w.WarriorRank,
 		&w.Verified,
+		&w.CreatedDate,
+		&w.UpdatedDate,
 	)
 	if e != nil {
 		log.Println(e)
 		return nil, errors.New("warrior email not found")
 	}
+	utc(&w.CreatedDate, &w.UpdatedDate)
 
 	return &w, nil
 }
@@ -101,7 +248,7 @@ func (d *Database) AuthWarrior(WarriorEmail string, WarriorPassword string) (*Wa
 	var passHash string
 
 	e := d.db.QueryRow(
-		`SELECT id, name, email, rank, password, avatar, verified, notifications_enabled FROM warriors WHERE email = $1`,
+		`SELECT id, name, email, rank, password, avatar, verified, notifications_enabled, created_date, updated_date FROM warriors WHERE email = $1`,
 		WarriorEmail,
 	).Scan(
 		&w.WarriorID,
@@ -112,29 +259,39 @@ func (d *Database) AuthWarrior(WarriorEmail string, WarriorPassword string) (*Wa
 		&w.WarriorAvatar,
 		&w.Verified,
 		&w.NotificationsEnabled,
+		&w.CreatedDate,
+		&w.UpdatedDate,
 	)
 	if e != nil {
 		log.Println(e)
 		return nil, errors.New("warrior not found")
 	}
+	utc(&w.CreatedDate, &w.UpdatedDate)
 
 	if !ComparePasswords(passHash, []byte(WarriorPassword)) {
 		return nil, errors.New("password invalid")
 	}
+	// the password is only known here, so it's the chance to move its hash to the current scheme
+	if NeedsRehash(passHash) {
+		d.rehashWarriorPassword(w.WarriorID, passHash, WarriorPassword)
+	}
 
 	return &w, nil
 }
 
 // CreateWarriorPrivate adds a new warrior private (guest) to the db
 func (d *Database) CreateWarriorPrivate(WarriorName string) (*Warrior, error) {
-	var WarriorID string
-	e := d.db.QueryRow(`INSERT INTO warriors (name) VALUES ($1) RETURNING id`, WarriorName).Scan(&WarriorID)
+	var w = &Warrior{WarriorName: WarriorName, WarriorAvatar: "identicon", NotificationsEnabled: true}
+	e := d.db.QueryRow(
+		`INSERT INTO warriors (name) VALUES ($1) RETURNING id, created_date, updated_date`, WarriorName,
+	).Scan(&w.WarriorID, &w.CreatedDate, &w.UpdatedDate)
 	if e != nil {
 		log.Println(e)
 		return nil, errors.New("unable to create new warrior")
 	}
+	utc(&w.CreatedDate, &w.UpdatedDate)
 
-	return &Warrior{WarriorID: WarriorID, WarriorName: WarriorName, WarriorAvatar: "identicon", NotificationsEnabled: true}, nil
+	return w, nil
 }
 
 // CreateWarriorCorporal adds a new warrior corporal (registered) to the db
@@ -176,7 +333,16 @@ func (d *Database) CreateWarriorCorporal(WarriorName string, WarriorEmail string
 		}
 	}
 
-	return &Warrior{WarriorID: WarriorID, WarriorName: WarriorName, WarriorEmail: WarriorEmail, WarriorRank: WarriorRank, WarriorAvatar: WarriorAvatar}, verifyID, nil
+	w := &Warrior{WarriorID: WarriorID, WarriorName: WarriorName, WarriorEmail: WarriorEmail, WarriorRank: WarriorRank, WarriorAvatar: WarriorAvatar}
+	// a guest registering keeps when they were created as a guest
+	if e := d.db.QueryRow(
+		`SELECT created_date, updated_date FROM warriors WHERE id = $1`, WarriorID,
+	).Scan(&w.CreatedDate, &w.UpdatedDate); e != nil {
+		log.Println(e)
+	}
+	utc(&w.CreatedDate, &w.UpdatedDate)
+
+	return w, verifyID, nil
 }
 
 // UpdateWarriorProfile attempts to update the warriors profile
@@ -289,3 +455,87 @@ func (d *Database) VerifyWarriorAccount(VerifyID string) error {
 
 	return nil
 }
+
+// CreateInvitedWarrior adds a new warrior corporal whose email the admin vouches for, with a password nobody knows
+// until they set their own through an invitation or forgot password
+func (d *Database) CreateInvitedWarrior(WarriorName string, WarriorEmail string) (*Warrior, error) {
+	WarriorPassword, err := random(64)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create new warrior")
+	}
+
+	NewWarrior, VerifyID, err := d.CreateWarriorCorporal(WarriorName, WarriorEmail, WarriorPassword, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.VerifyWarriorAccount(VerifyID); err != nil {
+		log.Println(err)
+	} else {
+		NewWarrior.Verified = true
+	}
+
+	return NewWarrior, nil
+}
+
+// CreateWarriorInvite creates an invitation for the warrior to set their password, valid for a week
+// as it waits on someone who didn't ask for it
+func (d *Database) CreateWarriorInvite(WarriorID string) (string, error) {
+	var InviteID string
+	e := d.db.QueryRow(
+		`INSERT INTO warrior_reset (warrior_id, expire_date) VALUES ($1, NOW() + INTERVAL '7 days') RETURNING reset_id`,
+		WarriorID,
+	).Scan(&InviteID)
+	if e != nil {
+		log.Println(e)
+		return "", errors.New("unable to create warrior invite")
+	}
+
+	return InviteID, nil
+}
+
+// SetWarriorHandle sets the handle the warrior is mentioned by, unique regardless of case, an empty handle removes it
+func (d *Database) SetWarriorHandle(WarriorID string, Handle string) error {
+	if _, err := d.db.Exec(
+		`UPDATE warriors SET handle = NULLIF($2, '') WHERE id = $1;`,
+		WarriorID, Handle,
+	); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrHandleTaken
+		}
+		log.Println(err)
+		return errors.New("unable to set warrior handle")
+	}
+
+	return nil
+}
+
+// GetBattleWarriorsByHandles gets the warriors that have joined the battle with one of the handles,
+// in any case, so mentions only reach the battle's own warriors
+func (d *Database) GetBattleWarriorsByHandles(BattleID string, Handles []string) ([]*Warrior, error) {
+	var warriors = make([]*Warrior, 0)
+	rows, err := d.db.Query(
+		`SELECT w.id, w.name, coalesce(w.email, ''), w.rank, w.handle
+		FROM warriors w
+		JOIN battles_warriors bw ON bw.warrior_id = w.id AND bw.battle_id = $1
+		WHERE lower(w.handle) = ANY($2)`,
+		BattleID, pq.Array(Handles),
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get warriors by handle")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w Warrior
+		if err := rows.Scan(&w.WarriorID, &w.WarriorName, &w.WarriorEmail, &w.WarriorRank, &w.Handle); err != nil {
+			log.Println(err)
+		} else {
+			warriors = append(warriors, &w)
+		}
+	}
+
+	return warriors, nil
+}
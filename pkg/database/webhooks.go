@@ -0,0 +1,145 @@
+package database
+
+import (
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// getWebhooks gets the webhooks matching the where clause
+func (d *Database) getWebhooks(where string) ([]*Webhook, error) {
+	var webhooks = make([]*Webhook, 0)
+	rows, err := d.db.Query(
+		`SELECT id, name, url, events, template, active, coalesce(warrior_id::TEXT, ''), created_date
+		FROM webhooks WHERE ` + where + ` ORDER BY created_date;`,
+	)
+	if err != nil {
+		log.Println(err)
+		return webhooks, errors.New("unable to get webhooks")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wh Webhook
+		if err := rows.Scan(
+			&wh.WebhookID, &wh.Name, &wh.URL, pq.Array(&wh.Events), &wh.Template, &wh.Active, &wh.WarriorID, &wh.CreatedDate,
+		); err != nil {
+			log.Println(err)
+		} else {
+			webhooks = append(webhooks, &wh)
+		}
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhooks gets the webhooks added by admins
+func (d *Database) GetWebhooks() ([]*Webhook, error) {
+	return d.getWebhooks("warrior_id IS NULL")
+}
+
+// GetActiveWebhooks gets the active webhooks along with the warriors REST hook subscriptions
+func (d *Database) GetActiveWebhooks() ([]*Webhook, error) {
+	return d.getWebhooks("active")
+}
+
+// CreateWebhook adds a webhook
+func (d *Database) CreateWebhook(wh *Webhook) (*Webhook, error) {
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+
+	if err := d.db.QueryRow(
+		`INSERT INTO webhooks (name, url, events, template, active, warrior_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::UUID)
+		RETURNING id, created_date;`,
+		wh.Name, wh.URL, pq.Array(wh.Events), wh.Template, wh.Active, wh.WarriorID,
+	).Scan(&wh.WebhookID, &wh.CreatedDate); err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to create webhook")
+	}
+
+	return wh, nil
+}
+
+// UpdateWebhook updates a webhook
+func (d *Database) UpdateWebhook(wh *Webhook) error {
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+
+	res, err := d.db.Exec(
+		`UPDATE webhooks SET name = $2, url = $3, events = $4, template = $5, active = $6, updated_date = NOW()
+		WHERE id = $1 AND warrior_id IS NULL;`,
+		wh.WebhookID, wh.Name, wh.URL, pq.Array(wh.Events), wh.Template, wh.Active,
+	)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to update webhook")
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		return errors.New("webhook not found")
+	}
+
+	return nil
+}
+
+// DeleteWebhook removes a webhook
+func (d *Database) DeleteWebhook(WebhookID string) error {
+	if _, err := d.db.Exec(`DELETE FROM webhooks WHERE id = $1;`, WebhookID); err != nil {
+		log.Println(err)
+		return errors.New("unable to delete webhook")
+	}
+
+	return nil
+}
+
+// DeleteWarriorWebhook removes one of the warriors REST hook subscriptions
+func (d *Database) DeleteWarriorWebhook(WarriorID string, WebhookID string) error {
+	res, err := d.db.Exec(`DELETE FROM webhooks WHERE id = $1 AND warrior_id = $2;`, WebhookID, WarriorID)
+	if err != nil {
+		log.Println(err)
+		return errors.New("unable to delete webhook")
+	}
+	if deleted, _ := res.RowsAffected(); deleted == 0 {
+		return errors.New("webhook not found")
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveries gets the IDs of the webhooks the outbox event was delivered to
+func (d *Database) GetWebhookDeliveries(EventID int64) ([]string, error) {
+	var WebhookIDs = make([]string, 0)
+	rows, err := d.db.Query(`SELECT webhook_id FROM webhook_deliveries WHERE event_id = $1;`, EventID)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("unable to get webhook deliveries")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var WebhookID string
+		if err := rows.Scan(&WebhookID); err != nil {
+			log.Println(err)
+		} else {
+			WebhookIDs = append(WebhookIDs, WebhookID)
+		}
+	}
+
+	return WebhookIDs, nil
+}
+
+// SetWebhookDelivered records the outbox event as delivered to the webhook so retries of the event skip it
+func (d *Database) SetWebhookDelivered(WebhookID string, EventID int64) error {
+	if _, err := d.db.Exec(
+		`INSERT INTO webhook_deliveries (webhook_id, event_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;`,
+		WebhookID, EventID,
+	); err != nil {
+		log.Println(err)
+		return errors.New("unable to record webhook delivery")
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package email
+
+import (
+	"log"
+	"strings"
+
+	"github.com/matcornic/hermes/v2"
+)
+
+// ReportRow is a labeled value in a report email
+type ReportRow struct {
+	Label string
+	Value string
+}
+
+// SendUsageReport sends the periodic instance usage report to an admin
+func (m *Email) SendUsageReport(WarriorName string, WarriorEmail string, Period string, Usage []ReportRow, Teams []ReportRow) error {
+	usage := make([]hermes.Entry, 0)
+	for _, row := range Usage {
+		usage = append(usage, hermes.Entry{Key: row.Label, Value: row.Value})
+	}
+
+	teams := make([][]hermes.Entry, 0)
+	for _, row := range Teams {
+		teams = append(teams, []hermes.Entry{
+			{Key: "Most Active Teams", Value: row.Label},
+			{Key: "Battles", Value: row.Value},
+		})
+	}
+
+	emailBody, err := m.generateBody(
+		hermes.Body{
+			Name: WarriorName,
+			Intros: []string{
+				"Here is how the Thunderdome was used during " + Period + ".",
+			},
+			Dictionary: usage,
+			Table: hermes.Table{
+				Data: teams,
+			},
+			Actions: []hermes.Action{
+				{
+					Instructions: "See the current totals in the admin area.",
+					Button: hermes.Button{
+						Text: "Admin",
+						Link: m.config.AppURL + "admin",
+					},
+				},
+			},
+		},
+	)
+	if err != nil {
+		log.Println("Error Generating Usage Report Email HTML: ", err)
+		return err
+	}
+
+	sendErr := m.Send(
+		WarriorName,
+		WarriorEmail,
+		"Thunderdome usage report for "+Period,
+		emailBody,
+	)
+	if sendErr != nil {
+		log.Println("Error sending Usage Report Email: ", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
+
+// SendAnnouncement sends an admin's announcement, paragraphs of the body are separated by blank lines
+func (m *Email) SendAnnouncement(WarriorName string, WarriorEmail string, Subject string, Body string) error {
+	paragraphs := make([]string, 0)
+	for _, p := range strings.Split(strings.ReplaceAll(Body, "\r\n", "\n"), "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+
+	emailBody, err := m.generateBody(
+		hermes.Body{
+			Name:   WarriorName,
+			Intros: paragraphs,
+			Outros: []string{
+				"You're receiving this announcement because notifications are enabled in your profile, turn them off there to stop receiving them.",
+			},
+			Actions: []hermes.Action{
+				{
+					Button: hermes.Button{
+						Text: "Profile",
+						Link: m.config.AppURL + "profile",
+					},
+				},
+			},
+		},
+	)
+	if err != nil {
+		log.Println("Error Generating Announcement Email HTML: ", err)
+		return err
+	}
+
+	sendErr := m.Send(
+		WarriorName,
+		WarriorEmail,
+		Subject,
+		emailBody,
+	)
+	if sendErr != nil {
+		log.Println("Error sending Announcement Email: ", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
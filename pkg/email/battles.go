@@ -0,0 +1,108 @@
+package email
+
+import (
+	"log"
+
+	"github.com/matcornic/hermes/v2"
+)
+
+// ActionItemRow is an action item in a battle summary email
+type ActionItemRow struct {
+	Content string
+	Owner   string
+	DueDate string
+}
+
+// SendBattleSummary sends the leader the points of each plan and the action items of a battle that ended
+func (m *Email) SendBattleSummary(WarriorName string, WarriorEmail string, BattleName string, Plans []ReportRow, ActionItems []ActionItemRow) error {
+	plans := make([]hermes.Entry, 0)
+	for _, row := range Plans {
+		plans = append(plans, hermes.Entry{Key: row.Label, Value: row.Value})
+	}
+
+	items := make([][]hermes.Entry, 0)
+	for _, row := range ActionItems {
+		items = append(items, []hermes.Entry{
+			{Key: "Action Item", Value: row.Content},
+			{Key: "Owner", Value: row.Owner},
+			{Key: "Due", Value: row.DueDate},
+		})
+	}
+
+	outros := []string{}
+	if len(items) == 0 {
+		outros = append(outros, "No action items were recorded.")
+	}
+
+	emailBody, err := m.generateBody(
+		hermes.Body{
+			Name: WarriorName,
+			Intros: []string{
+				"The battle " + BattleName + " has ended, here is how the plans were pointed.",
+			},
+			Dictionary: plans,
+			Table: hermes.Table{
+				Data: items,
+			},
+			Outros: outros,
+		},
+	)
+	if err != nil {
+		log.Println("Error Generating Battle Summary Email HTML: ", err)
+		return err
+	}
+
+	sendErr := m.Send(
+		WarriorName,
+		WarriorEmail,
+		"Summary of "+BattleName,
+		emailBody,
+	)
+	if sendErr != nil {
+		log.Println("Error sending Battle Summary Email: ", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
+
+// SendMention tells the warrior they were @mentioned in a battle, quoting what was said
+func (m *Email) SendMention(WarriorName string, WarriorEmail string, MentionedBy string, BattleID string, BattleName string, Text string) error {
+	emailBody, err := m.generateBody(
+		hermes.Body{
+			Name: WarriorName,
+			Intros: []string{
+				MentionedBy + " mentioned you in the battle " + BattleName + ":",
+				Text,
+			},
+			Actions: []hermes.Action{
+				{
+					Button: hermes.Button{
+						Text: "Join Battle",
+						Link: m.config.AppURL + "battle/" + BattleID,
+					},
+				},
+			},
+			Outros: []string{
+				"You can turn these emails off in your profile.",
+			},
+		},
+	)
+	if err != nil {
+		log.Println("Error Generating Mention Email HTML: ", err)
+		return err
+	}
+
+	sendErr := m.Send(
+		WarriorName,
+		WarriorEmail,
+		MentionedBy+" mentioned you in "+BattleName,
+		emailBody,
+	)
+	if sendErr != nil {
+		log.Println("Error sending Mention Email: ", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
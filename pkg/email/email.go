@@ -46,6 +46,8 @@ type Config struct {
 // Email contains all the methods to send application emails
 type Email struct {
 	config *Config
+	// OnDelivery when set is called after every email with the outcome of sending it
+	OnDelivery func(Recipient string, Subject string, SendErr error)
 }
 
 // GetEnv gets environment variable matching key string
@@ -155,6 +157,32 @@ func (m *Email) generateBody(Body hermes.Body) (emailBody string, generateErr er
 
 // Send - utility function to send emails
 func (m *Email) Send(WarriorName string, WarriorEmail string, Subject string, Body string) error {
+	err := m.send(WarriorName, WarriorEmail, Subject, Body, &Transcript{})
+	if m.OnDelivery != nil {
+		m.OnDelivery(WarriorEmail, Subject, err)
+	}
+
+	return err
+}
+
+// Transcript records each step of an SMTP conversation along with the servers reply when it failed
+type Transcript struct {
+	Steps []string `json:"steps"`
+}
+
+// step records the outcome of a step and passes its error through
+func (t *Transcript) step(Name string, err error) error {
+	if err != nil {
+		t.Steps = append(t.Steps, Name+": "+err.Error())
+	} else {
+		t.Steps = append(t.Steps, Name+": OK")
+	}
+
+	return err
+}
+
+// send sends an email recording the SMTP conversation in the transcript
+func (m *Email) send(WarriorName string, WarriorEmail string, Subject string, Body string, t *Transcript) error {
 	to := mail.Address{
 		Name:    WarriorName,
 		Address: WarriorEmail,
@@ -176,52 +204,83 @@ func (m *Email) Send(WarriorName string, WarriorEmail string, Subject string, Bo
 	message += "\r\n" + Body
 
 	c, err := smtp.Dial(smtpServerConfig.Address())
-	if err != nil {
+	if t.step("CONNECT "+smtpServerConfig.Address(), err) != nil {
 		log.Println("Error dialing SMTP: ", err)
 		return err
 	}
 
-	c.StartTLS(tlsConfig)
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		t.step("STARTTLS", c.StartTLS(tlsConfig))
+	} else {
+		t.Steps = append(t.Steps, "STARTTLS: not offered by the server")
+	}
 
 	// Auth
 	if m.config.smtpSecure {
-		if err = c.Auth(smtpAuth); err != nil {
+		if err = t.step("AUTH "+m.config.smtpUser, c.Auth(smtpAuth)); err != nil {
 			log.Println("Error authenticating SMTP: ", err)
 			return err
 		}
 	}
 
 	// To && From
-	if err = c.Mail(smtpFrom.Address); err != nil {
+	if err = t.step("MAIL FROM "+smtpFrom.Address, c.Mail(smtpFrom.Address)); err != nil {
 		log.Println("Error setting SMTP from: ", err)
 		return err
 	}
 
-	if err = c.Rcpt(to.Address); err != nil {
+	if err = t.step("RCPT TO "+to.Address, c.Rcpt(to.Address)); err != nil {
 		log.Println("Error setting SMTP to: ", err)
 		return err
 	}
 
 	// Data
 	w, err := c.Data()
-	if err != nil {
+	if t.step("DATA", err) != nil {
 		log.Println("Error setting SMTP data: ", err)
 		return err
 	}
 
 	_, err = w.Write([]byte(message))
 	if err != nil {
+		t.step("WRITE MESSAGE", err)
 		log.Println("Error sending email: ", err)
 		return err
 	}
 
 	err = w.Close()
-	if err != nil {
+	if t.step("END DATA", err) != nil {
 		log.Println("Error closing SMTP: ", err)
 		return err
 	}
 
-	c.Quit()
+	t.step("QUIT", c.Quit())
 
 	return nil
 }
+
+// SendTest sends a test email returning the SMTP conversation for troubleshooting
+func (m *Email) SendTest(WarriorName string, WarriorEmail string) (*Transcript, error) {
+	t := &Transcript{Steps: make([]string, 0)}
+	Subject := "Thunderdome test email"
+
+	emailBody, err := m.generateBody(
+		hermes.Body{
+			Name: WarriorName,
+			Intros: []string{
+				"This is a test email from Thunderdome, if you're reading it email delivery is working.",
+			},
+		},
+	)
+	if err != nil {
+		log.Println("Error Generating Test Email HTML: ", err)
+		return t, err
+	}
+
+	err = m.send(WarriorName, WarriorEmail, Subject, emailBody, t)
+	if m.OnDelivery != nil {
+		m.OnDelivery(WarriorEmail, Subject, err)
+	}
+
+	return t, err
+}
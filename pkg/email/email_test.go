@@ -1,7 +1,10 @@
 package email
 
 import (
+	"net"
+	"net/textproto"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +45,46 @@ func TestGetBoolEnvNonDefault(t *testing.T) {
 		t.Error("Expected true, got ", TestEnv)
 	}
 }
+
+func TestSendTranscript(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// a server that refuses the recipient
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 test ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				text.PrintfLine("250 test")
+			case strings.HasPrefix(line, "RCPT"):
+				text.PrintfLine("550 5.1.1 no such user")
+			default:
+				text.PrintfLine("250 OK")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	smtpServerConfig = smtpServer{host: host, port: port}
+	m := &Email{config: &Config{}}
+
+	transcript := &Transcript{}
+	err = m.send("Thor", "thor@thunderdome.dev", "Test", "Body", transcript)
+	if err == nil || len(transcript.Steps) != 4 || !strings.HasPrefix(transcript.Steps[3], "RCPT TO thor@thunderdome.dev: 550") {
+		t.Error("Unexpected transcript ", transcript.Steps, err)
+	}
+}
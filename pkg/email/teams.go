@@ -0,0 +1,95 @@
+package email
+
+import (
+	"log"
+	"strings"
+
+	"github.com/matcornic/hermes/v2"
+)
+
+// SendTeamAdded tells the warrior they were added to a team
+func (m *Email) SendTeamAdded(WarriorName string, WarriorEmail string, TeamName string) error {
+	emailBody, err := m.generateBody(
+		hermes.Body{
+			Name: WarriorName,
+			Intros: []string{
+				"You've been added to the team " + TeamName + ", its battles are now in your list of battles.",
+			},
+			Actions: []hermes.Action{
+				{
+					Button: hermes.Button{
+						Text: "Battles",
+						Link: m.config.AppURL + "battles",
+					},
+				},
+			},
+			Outros: []string{
+				"You can turn these emails off in your profile.",
+			},
+		},
+	)
+	if err != nil {
+		log.Println("Error Generating Team Added Email HTML: ", err)
+		return err
+	}
+
+	sendErr := m.Send(
+		WarriorName,
+		WarriorEmail,
+		"You've been added to "+TeamName,
+		emailBody,
+	)
+	if sendErr != nil {
+		log.Println("Error sending Team Added Email: ", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
+
+// SendAbsenceConflict warns a team admin that key members are away on the day of one of the team's recurring
+// battles, suggesting days they're all around
+func (m *Email) SendAbsenceConflict(WarriorName string, WarriorEmail string, TeamName string, ScheduleName string, Date string, Absent []string, Alternatives []string) error {
+	suggestion := "None of the days around it have everyone around either."
+	if len(Alternatives) > 0 {
+		suggestion = "Everyone is around on " + strings.Join(Alternatives, ", ") + "."
+	}
+
+	emailBody, err := m.generateBody(
+		hermes.Body{
+			Name: WarriorName,
+			Intros: []string{
+				ScheduleName + " for " + TeamName + " is on " + Date + " while " + strings.Join(Absent, ", ") + " will be away.",
+				suggestion,
+			},
+			Actions: []hermes.Action{
+				{
+					Button: hermes.Button{
+						Text: "Battles",
+						Link: m.config.AppURL + "battles",
+					},
+				},
+			},
+			Outros: []string{
+				"You can turn these emails off in your profile.",
+			},
+		},
+	)
+	if err != nil {
+		log.Println("Error Generating Absence Conflict Email HTML: ", err)
+		return err
+	}
+
+	sendErr := m.Send(
+		WarriorName,
+		WarriorEmail,
+		"Key members are away for "+ScheduleName+" on "+Date,
+		emailBody,
+	)
+	if sendErr != nil {
+		log.Println("Error sending Absence Conflict Email: ", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
@@ -97,6 +97,52 @@ func (m *Email) SendForgotPassword(WarriorName string, WarriorEmail string, Rese
 	return nil
 }
 
+// SendInvite sends a warrior an admin created an account for the link to set their password
+func (m *Email) SendInvite(WarriorName string, WarriorEmail string, InviteID string) error {
+	emailBody, err := m.generateBody(
+		hermes.Body{
+			Name: WarriorName,
+			Intros: []string{
+				"An account has been made for you in the Thunderdome! Bring your own mouthguard.",
+			},
+			Actions: []hermes.Action{
+				{
+					Instructions: "Set your password to get started, the following link will expire in 7 days.",
+					Button: hermes.Button{
+						Color: "#22BC66",
+						Text:  "Set Password",
+						Link:  m.config.AppURL + "reset-password/" + InviteID,
+					},
+				},
+				{
+					Instructions: "Need help, or have questions? Visit our Github page",
+					Button: hermes.Button{
+						Text: "Github Repo",
+						Link: "https://github.com/StevenWeathers/thunderdome-planning-poker/",
+					},
+				},
+			},
+		},
+	)
+	if err != nil {
+		log.Println("Error Generating Invite Email HTML: ", err)
+		return err
+	}
+
+	sendErr := m.Send(
+		WarriorName,
+		WarriorEmail,
+		"You've been invited to the Thunderdome!",
+		emailBody,
+	)
+	if sendErr != nil {
+		log.Println("Error sending Invite Email: ", sendErr)
+		return sendErr
+	}
+
+	return nil
+}
+
 // SendPasswordReset Sends a Reset Password confirmation email to warrior
 func (m *Email) SendPasswordReset(WarriorName string, WarriorEmail string) error {
 	emailBody, err := m.generateBody(
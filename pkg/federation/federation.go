@@ -0,0 +1,271 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers signed requests between instances carry
+const (
+	InstanceHeader  = "X-Thunderdome-Instance"
+	TimestampHeader = "X-Thunderdome-Timestamp"
+	SignatureHeader = "X-Thunderdome-Signature"
+)
+
+// MaxSkew is how far a signed request's timestamp may be from now before it's refused as a replay
+const MaxSkew = 5 * time.Minute
+
+var (
+	// ErrInvalidKey is returned for keys that aren't a base64 encoded ed25519 seed
+	ErrInvalidKey = errors.New("federation key must be a base64 encoded 32 byte ed25519 seed")
+	// ErrInvalidSignature is returned for requests and passports not signed by the expected instance
+	ErrInvalidSignature = errors.New("invalid federation signature")
+	// ErrExpired is returned for requests outside the allowed skew and expired passports
+	ErrExpired = errors.New("federation signature expired")
+	// ErrWrongAudience is returned for passports issued for another instance
+	ErrWrongAudience = errors.New("federation passport issued for another instance")
+)
+
+// Instance is this Thunderdome instance as it's known to its federation peers
+type Instance struct {
+	URL  string
+	key  ed25519.PrivateKey
+	http *http.Client
+}
+
+// Identity is what an instance publishes for peers to pin during the handshake
+type Identity struct {
+	InstanceURL string `json:"instanceUrl"`
+	PublicKey   string `json:"publicKey"`
+}
+
+// Passport vouches for a warrior of the issuing instance joining a battle hosted by a peer
+type Passport struct {
+	Instance string `json:"instance"`
+	// Audience is the url of the peer the passport is for, so it can't be presented at another
+	Audience    string `json:"audience"`
+	WarriorID   string `json:"warriorId"`
+	WarriorName string `json:"warriorName"`
+	BattleID    string `json:"battleId"`
+	// Nonce is random per passport, the peer only accepts each once
+	Nonce   string `json:"nonce"`
+	Expires int64  `json:"expires"`
+}
+
+// New creates the instance from its public url and base64 encoded ed25519 seed
+func New(URL string, Key string) (*Instance, error) {
+	seed, err := base64.StdEncoding.DecodeString(Key)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrInvalidKey
+	}
+
+	return &Instance{
+		URL:  strings.TrimRight(URL, "/"),
+		key:  ed25519.NewKeyFromSeed(seed),
+		http: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// GenerateKey creates a new base64 encoded seed for the federation.key config
+func GenerateKey() (string, error) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key.Seed()), nil
+}
+
+// Identity gets the instances published identity
+func (i *Instance) Identity() Identity {
+	return Identity{
+		InstanceURL: i.URL,
+		PublicKey:   base64.StdEncoding.EncodeToString(i.key.Public().(ed25519.PublicKey)),
+	}
+}
+
+// FetchIdentity gets the identity a peer publishes at /api/federation/identity
+func (i *Instance) FetchIdentity(PeerURL string) (*Identity, error) {
+	PeerURL = strings.TrimRight(PeerURL, "/")
+	resp, err := i.http.Get(PeerURL + "/api/federation/identity")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("federation peer %s responded %d", PeerURL, resp.StatusCode)
+	}
+
+	var identity Identity
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		return nil, err
+	}
+	if _, err := decodePublicKey(identity.PublicKey); err != nil {
+		return nil, err
+	}
+	// a peer answering for another url would let it speak for that instance
+	if strings.TrimRight(identity.InstanceURL, "/") != PeerURL {
+		return nil, fmt.Errorf("federation peer %s identifies as %s", PeerURL, identity.InstanceURL)
+	}
+
+	return &identity, nil
+}
+
+// Post sends a signed request to a peer, path is relative to the peers url, giving up when the context is done
+func (i *Instance) Post(ctx context.Context, PeerURL string, Path string, Body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(PeerURL, "/")+Path, bytes.NewReader(Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	i.Sign(req, Body)
+
+	resp, err := i.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("federation peer %s responded %d", PeerURL, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign sets the headers identifying the request as sent by this instance
+func (i *Instance) Sign(req *http.Request, Body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := ed25519.Sign(i.key, signedContent(req.Method, req.URL.Path, timestamp, Body))
+
+	req.Header.Set(InstanceHeader, i.URL)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, base64.StdEncoding.EncodeToString(signature))
+}
+
+// Verify checks the request was signed with the public key within the allowed skew,
+// the body having been read by the caller
+func Verify(req *http.Request, Body []byte, PublicKey string) error {
+	key, err := decodePublicKey(PublicKey)
+	if err != nil {
+		return err
+	}
+
+	timestamp := req.Header.Get(TimestampHeader)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if skew := time.Since(time.Unix(sent, 0)); skew > MaxSkew || skew < -MaxSkew {
+		return ErrExpired
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(req.Header.Get(SignatureHeader))
+	if err != nil || !ed25519.Verify(key, signedContent(req.Method, req.URL.Path, timestamp, Body), signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// IssuePassport signs a passport for one of this instances warriors to join the battle of the peer at the audience url
+func (i *Instance) IssuePassport(WarriorID string, WarriorName string, BattleID string, Audience string, TTL time.Duration) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	passport, err := json.Marshal(Passport{
+		Instance:    i.URL,
+		Audience:    strings.TrimRight(Audience, "/"),
+		WarriorID:   WarriorID,
+		WarriorName: WarriorName,
+		BattleID:    BattleID,
+		Nonce:       hex.EncodeToString(nonce),
+		Expires:     time.Now().Add(TTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(passport)
+	signature := ed25519.Sign(i.key, []byte(encoded))
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ReadPassport gets the passport without verifying it, so the issuing instance can be looked up
+func ReadPassport(Token string) (*Passport, error) {
+	dot := strings.Index(Token, ".")
+	if dot < 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(Token[:dot])
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	var passport Passport
+	if err := json.Unmarshal(raw, &passport); err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	return &passport, nil
+}
+
+// VerifyPassport checks the passport was signed with the issuing instances public key for the audience url and
+// hasn't expired, the caller makes sure its nonce is only accepted once
+func VerifyPassport(Token string, PublicKey string, Audience string) (*Passport, error) {
+	key, err := decodePublicKey(PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	passport, err := ReadPassport(Token)
+	if err != nil {
+		return nil, err
+	}
+
+	dot := strings.Index(Token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(Token[dot+1:])
+	if err != nil || !ed25519.Verify(key, []byte(Token[:dot]), signature) {
+		return nil, ErrInvalidSignature
+	}
+	if time.Now().Unix() > passport.Expires {
+		return nil, ErrExpired
+	}
+	if passport.Audience != strings.TrimRight(Audience, "/") || passport.Nonce == "" {
+		return nil, ErrWrongAudience
+	}
+
+	return passport, nil
+}
+
+// signedContent is what's signed for a request, the body by its hash
+func signedContent(Method string, Path string, Timestamp string, Body []byte) []byte {
+	sum := sha256.Sum256(Body)
+
+	return []byte(strings.Join([]string{Method, Path, Timestamp, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+func decodePublicKey(PublicKey string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("federation public key must be a base64 encoded 32 byte ed25519 key")
+	}
+
+	return ed25519.PublicKey(key), nil
+}
@@ -0,0 +1,121 @@
+package federation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestInstance(t *testing.T, URL string) *Instance {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := New(URL, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return i
+}
+
+func TestNew(t *testing.T) {
+	for _, key := range []string{"", "c2VjcmV0", "not base64!"} {
+		if _, err := New("https://a.example.com", key); err != ErrInvalidKey {
+			t.Error("Expected ", key, " to be an invalid key got ", err)
+		}
+	}
+
+	i := newTestInstance(t, "https://a.example.com/")
+	if i.URL != "https://a.example.com" {
+		t.Error("Expected the trailing slash to be trimmed got ", i.URL)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	a := newTestInstance(t, "https://a.example.com")
+	b := newTestInstance(t, "https://b.example.com")
+	body := []byte(`{"battleId":"b1"}`)
+
+	req := httptest.NewRequest("POST", "/api/federation/relay", nil)
+	a.Sign(req, body)
+	if req.Header.Get(InstanceHeader) != a.URL {
+		t.Error("Expected the instance header to be set got ", req.Header.Get(InstanceHeader))
+	}
+	if err := Verify(req, body, a.Identity().PublicKey); err != nil {
+		t.Error("Expected a valid signature got ", err)
+	}
+	if err := Verify(req, []byte(`{"battleId":"b2"}`), a.Identity().PublicKey); err != ErrInvalidSignature {
+		t.Error("Expected a tampered body to be refused got ", err)
+	}
+	if err := Verify(req, body, b.Identity().PublicKey); err != ErrInvalidSignature {
+		t.Error("Expected another instances key to be refused got ", err)
+	}
+
+	req.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().Add(-2*MaxSkew).Unix(), 10))
+	if err := Verify(req, body, a.Identity().PublicKey); err != ErrExpired {
+		t.Error("Expected an old request to be refused got ", err)
+	}
+}
+
+func TestPassport(t *testing.T) {
+	a := newTestInstance(t, "https://a.example.com")
+	b := newTestInstance(t, "https://b.example.com")
+
+	token, err := a.IssuePassport("w1", "Thor", "b1", b.URL, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unverified, err := ReadPassport(token)
+	if err != nil || unverified.Instance != a.URL {
+		t.Error("Unexpected passport ", unverified, err)
+	}
+
+	passport, err := VerifyPassport(token, a.Identity().PublicKey, b.URL)
+	if err != nil || passport.WarriorID != "w1" || passport.WarriorName != "Thor" || passport.BattleID != "b1" || passport.Nonce == "" {
+		t.Error("Unexpected passport ", passport, err)
+	}
+	if _, err := VerifyPassport(token, b.Identity().PublicKey, b.URL); err != ErrInvalidSignature {
+		t.Error("Expected another instances key to be refused got ", err)
+	}
+	if _, err := VerifyPassport(token, a.Identity().PublicKey, "https://c.example.com"); err != ErrWrongAudience {
+		t.Error("Expected a passport for another instance to be refused got ", err)
+	}
+	if again, _ := a.IssuePassport("w1", "Thor", "b1", b.URL, time.Minute); again == token {
+		t.Error("Expected each passport to have its own nonce")
+	}
+
+	expired, _ := a.IssuePassport("w1", "Thor", "b1", b.URL, -time.Minute)
+	if _, err := VerifyPassport(expired, a.Identity().PublicKey, b.URL); err != ErrExpired {
+		t.Error("Expected an expired passport to be refused got ", err)
+	}
+}
+
+func TestFetchIdentity(t *testing.T) {
+	var peer *Instance
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/federation/identity" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(peer.Identity())
+	}))
+	defer srv.Close()
+
+	a := newTestInstance(t, "https://a.example.com")
+	peer = newTestInstance(t, srv.URL)
+
+	identity, err := a.FetchIdentity(srv.URL + "/")
+	if err != nil || identity.PublicKey != peer.Identity().PublicKey {
+		t.Error("Unexpected identity ", identity, err)
+	}
+
+	peer = newTestInstance(t, "https://c.example.com")
+	if _, err := a.FetchIdentity(srv.URL); err == nil {
+		t.Error("Expected a peer identifying as another instance to be refused")
+	}
+}
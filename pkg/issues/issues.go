@@ -0,0 +1,109 @@
+// Package issues defines the interface issue tracker drivers implement so their issues
+// can be imported as plans and have their estimates written back.
+//
+// Drivers register themselves from an init function, the same way database/sql drivers do,
+// so a driver is made available by importing its package (see the providers_*.go files of the server).
+package issues
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrUnknownProvider is returned for providers that haven't been compiled in
+	ErrUnknownProvider = errors.New("unknown issue provider")
+
+	// ErrInvalidSource is returned by ListIssues when the source doesn't say what to list
+	ErrInvalidSource = errors.New("invalid issue source")
+)
+
+// Issue is an issue as seen by the trackers
+type Issue struct {
+	// ID is the trackers own ID for the issue, used to push the estimate back
+	ID string
+	// Key is the human readable identifier like ENG-123
+	Key         string
+	Title       string
+	Description string
+	// Type is the plan type of the issue, Story when the tracker doesn't say
+	Type string
+	URL  string
+}
+
+// Provider is an issue tracker
+type Provider interface {
+	// ListIssues lists the issues of a source such as a sprint, cycle or project,
+	// the source keys are specific to the provider
+	ListIssues(Source map[string]string) ([]*Issue, error)
+	// ImportIssue gets a single issue by its ID or key
+	ImportIssue(IssueID string) (*Issue, error)
+	// PushEstimate writes a finalized plans points back to the issue,
+	// points the tracker can't represent are left out without error
+	PushEstimate(IssueID string, Points string) error
+}
+
+// Editor is implemented by providers whose issues take edits made to the plans imported from them,
+// keeping the two in sync both ways
+type Editor interface {
+	// UpdateIssue sets the issues title and description
+	UpdateIssue(IssueID string, Title string, Description string) error
+}
+
+// Factory creates a provider authenticated with a teams api key
+type Factory func(APIKey string) Provider
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Factory)
+)
+
+// Register makes a provider available by name, panics when the name is taken
+func Register(Name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if factory == nil {
+		panic("issues: Register factory is nil")
+	}
+	if _, dup := providers[Name]; dup {
+		panic("issues: Register called twice for provider " + Name)
+	}
+	providers[Name] = factory
+}
+
+// New creates the named provider
+func New(Name string, APIKey string) (Provider, error) {
+	mu.RLock()
+	factory, ok := providers[Name]
+	mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return factory(APIKey), nil
+}
+
+// Registered reports whether the named provider has been compiled in
+func Registered(Name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := providers[Name]
+
+	return ok
+}
+
+// Providers gets the sorted names of the registered providers
+func Providers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,37 @@
+package issues
+
+import "testing"
+
+type testProvider struct{ apiKey string }
+
+func (p *testProvider) ListIssues(Source map[string]string) ([]*Issue, error) { return nil, nil }
+func (p *testProvider) ImportIssue(IssueID string) (*Issue, error)            { return nil, nil }
+func (p *testProvider) PushEstimate(IssueID string, Points string) error      { return nil }
+
+func TestRegister(t *testing.T) {
+	Register("test", func(APIKey string) Provider { return &testProvider{APIKey} })
+
+	if !Registered("test") || Registered("missing") {
+		t.Error("Expected only test to be registered, got ", Providers())
+	}
+
+	p, err := New("test", "key")
+	if err != nil || p.(*testProvider).apiKey != "key" {
+		t.Error("Expected test provider with key, got ", p, err)
+	}
+
+	if _, err := New("missing", "key"); err != ErrUnknownProvider {
+		t.Error("Expected ErrUnknownProvider, got ", err)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a provider twice to panic")
+		}
+	}()
+
+	Register("twice", func(APIKey string) Provider { return nil })
+	Register("twice", func(APIKey string) Provider { return nil })
+}
@@ -0,0 +1,147 @@
+package jira
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/unfurl"
+)
+
+// StoryPointsField is the custom field Jira Cloud keeps story point estimates in
+const StoryPointsField = "customfield_10016"
+
+// ErrInvalidAPIKey is returned for api keys not in the email:token@site form
+var ErrInvalidAPIKey = errors.New("jira api key must be email:token@site")
+
+// siteClient is what clients talk to their site with, the site comes from the teams api key so only public
+// addresses are connected to
+var siteClient = unfurl.PublicClient(15 * time.Second)
+
+// Client talks to a Jira site on behalf of a user with an api token
+type Client struct {
+	baseURL  string
+	username string
+	apiToken string
+	http     *http.Client
+}
+
+// Issue is a Jira issue with the fields plans are made of
+type Issue struct {
+	ID     string `json:"id"`
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string `json:"summary"`
+		Description string `json:"description"`
+		IssueType   struct {
+			Name string `json:"name"`
+		} `json:"issuetype"`
+	} `json:"fields"`
+}
+
+// New creates a Jira client, baseURL is the site root e.g. https://example.atlassian.net
+func New(baseURL string, username string, apiToken string) *Client {
+	return &Client{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: username,
+		apiToken: apiToken,
+		http:     siteClient,
+	}
+}
+
+// ParseAPIKey splits a teams api key like me@example.com:token@example.atlassian.net into
+// the site url, username and api token
+func ParseAPIKey(APIKey string) (string, string, string, error) {
+	at := strings.LastIndex(APIKey, "@")
+	colon := strings.LastIndex(APIKey[:at+1], ":")
+	if at < 1 || colon < 1 || at == len(APIKey)-1 {
+		return "", "", "", ErrInvalidAPIKey
+	}
+
+	site := APIKey[at+1:]
+	if !strings.HasPrefix(site, "http://") && !strings.HasPrefix(site, "https://") {
+		site = "https://" + site
+	}
+
+	return site, APIKey[:colon], APIKey[colon+1 : at], nil
+}
+
+// do sends a request to the api decoding the response into out when set
+func (c *Client) do(method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("jira responded %s to %s %s", resp.Status, method, path)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
+
+// Search gets up to 100 issues matching the JQL query
+func (c *Client) Search(JQL string) ([]*Issue, error) {
+	params := url.Values{}
+	params.Set("jql", JQL)
+	params.Set("fields", "summary,description,issuetype")
+	params.Set("maxResults", "100")
+
+	var result struct {
+		Issues []*Issue `json:"issues"`
+	}
+	err := c.do(http.MethodGet, "/rest/api/2/search?"+params.Encode(), nil, &result)
+
+	return result.Issues, err
+}
+
+// Issue gets an issue by its ID or key
+func (c *Client) Issue(IssueID string) (*Issue, error) {
+	var issue Issue
+	err := c.do(http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(IssueID)+"?fields=summary,description,issuetype", nil, &issue)
+
+	return &issue, err
+}
+
+// SetStoryPoints sets the issues story point estimate
+func (c *Client) SetStoryPoints(IssueID string, Points float64) error {
+	return c.do(http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(IssueID), map[string]interface{}{
+		"fields": map[string]float64{StoryPointsField: Points},
+	}, nil)
+}
+
+// EditIssue sets the issues summary and description
+func (c *Client) EditIssue(IssueID string, Summary string, Description string) error {
+	return c.do(http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(IssueID), map[string]interface{}{
+		"fields": map[string]string{"summary": Summary, "description": Description},
+	}, nil)
+}
+
+// IssueURL gets the browse link of the issue
+func (c *Client) IssueURL(Key string) string {
+	return c.baseURL + "/browse/" + Key
+}
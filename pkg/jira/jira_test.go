@@ -0,0 +1,83 @@
+package jira
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/issues"
+)
+
+func init() {
+	// the test sites are on loopback
+	siteClient = &http.Client{Timeout: 15 * time.Second}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	site, username, token, err := ParseAPIKey("me@example.com:s3cr3t@example.atlassian.net")
+	if err != nil || site != "https://example.atlassian.net" || username != "me@example.com" || token != "s3cr3t" {
+		t.Error("Unexpected api key parts ", site, username, token, err)
+	}
+
+	for _, key := range []string{"", "s3cr3t", "me@example.com:s3cr3t@", "s3cr3t@example.atlassian.net"} {
+		if _, _, _, err := ParseAPIKey(key); err != ErrInvalidAPIKey {
+			t.Error("Expected ", key, " to be invalid got ", err)
+		}
+	}
+}
+
+func TestImportIssue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "me@example.com" || p != "s3cr3t" || r.URL.Path != "/rest/api/2/issue/ENG-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id":"10001","key":"ENG-1","fields":{"summary":"Login","description":"SSO","issuetype":{"name":"Bug"}}}`))
+	}))
+	defer srv.Close()
+
+	issue, err := NewProvider("me@example.com:s3cr3t@" + srv.URL).ImportIssue("ENG-1")
+	if err != nil || issue.ID != "10001" || issue.Title != "Login" || issue.Type != "Bug" || issue.URL != srv.URL+"/browse/ENG-1" {
+		t.Error("Unexpected issue ", issue, err)
+	}
+
+	if _, err := NewProvider("s3cr3t").ImportIssue("ENG-1"); err != ErrInvalidAPIKey {
+		t.Error("Expected an invalid api key error got ", err)
+	}
+}
+
+func TestPushEstimate(t *testing.T) {
+	var body map[string]map[string]float64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+	p := NewProvider("me@example.com:s3cr3t@" + srv.URL)
+
+	if err := p.PushEstimate("10001", "1/2"); err != nil || body["fields"][StoryPointsField] != 0.5 {
+		t.Error("Unexpected estimate update ", body, err)
+	}
+	body = nil
+	if err := p.PushEstimate("10001", "?"); err != nil || body != nil {
+		t.Error("Expected ? to be left out got ", body, err)
+	}
+}
+
+func TestUpdateIssue(t *testing.T) {
+	var body map[string]map[string]string
+	var method, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	var editor issues.Editor = NewProvider("me@example.com:s3cr3t@" + srv.URL)
+	if err := editor.UpdateIssue("10001", "Login with SSO", "SAML too"); err != nil ||
+		method != http.MethodPut || path != "/rest/api/2/issue/10001" ||
+		body["fields"]["summary"] != "Login with SSO" || body["fields"]["description"] != "SAML too" {
+		t.Error("Unexpected issue update ", method, path, body, err)
+	}
+}
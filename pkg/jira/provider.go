@@ -0,0 +1,119 @@
+package jira
+
+import (
+	"strconv"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/issues"
+)
+
+func init() {
+	issues.Register("jira", func(APIKey string) issues.Provider {
+		return NewProvider(APIKey)
+	})
+}
+
+// Provider is the Jira issue provider, created from a teams api key
+type Provider struct {
+	*Client
+	err error
+}
+
+// NewProvider creates the issue provider from an api key like me@example.com:token@example.atlassian.net,
+// an invalid key gives a provider whose calls return ErrInvalidAPIKey
+func NewProvider(APIKey string) *Provider {
+	site, username, apiToken, err := ParseAPIKey(APIKey)
+	if err != nil {
+		return &Provider{err: err}
+	}
+
+	return &Provider{Client: New(site, username, apiToken)}
+}
+
+// toIssue converts a Jira issue for import
+func (p *Provider) toIssue(i *Issue) *issues.Issue {
+	Type := i.Fields.IssueType.Name
+	if Type == "" {
+		Type = "Story"
+	}
+
+	return &issues.Issue{
+		ID:          i.ID,
+		Key:         i.Key,
+		Title:       i.Fields.Summary,
+		Description: i.Fields.Description,
+		Type:        Type,
+		URL:         p.IssueURL(i.Key),
+	}
+}
+
+// ListIssues lists the issues of a sprint or a JQL query, the source sets either sprintId or jql
+func (p *Provider) ListIssues(Source map[string]string) ([]*issues.Issue, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	var JQL string
+	switch {
+	case Source["sprintId"] != "":
+		if _, err := strconv.Atoi(Source["sprintId"]); err != nil {
+			return nil, issues.ErrInvalidSource
+		}
+		JQL = "sprint = " + Source["sprintId"] + " ORDER BY rank"
+	case Source["jql"] != "":
+		JQL = Source["jql"]
+	default:
+		return nil, issues.ErrInvalidSource
+	}
+
+	found, err := p.Search(JQL)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*issues.Issue, 0, len(found))
+	for _, i := range found {
+		list = append(list, p.toIssue(i))
+	}
+
+	return list, nil
+}
+
+// ImportIssue gets an issue by its ID or key
+func (p *Provider) ImportIssue(IssueID string) (*issues.Issue, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	i, err := p.Issue(IssueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.toIssue(i), nil
+}
+
+// PushEstimate sets the issues story points, ? is left out
+func (p *Provider) PushEstimate(IssueID string, Points string) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	Estimate, err := strconv.ParseFloat(Points, 64)
+	if Points == "1/2" {
+		Estimate, err = 0.5, nil
+	}
+	if err != nil {
+		return nil
+	}
+
+	return p.SetStoryPoints(IssueID, Estimate)
+}
+
+// UpdateIssue sets the issues summary and description from the plan
+func (p *Provider) UpdateIssue(IssueID string, Title string, Description string) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	return p.EditIssue(IssueID, Title, Description)
+}
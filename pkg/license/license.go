@@ -0,0 +1,133 @@
+// Package license verifies license keys limiting how many registered warriors and teams a commercially self hosted
+// instance has.
+//
+// A key is the base64 encoded JSON license followed by a dot and the base64 encoded Ed25519 signature of it, made
+// with the key of whoever issues licenses. Limits aren't enforced as hard stops: an instance can go over them, and
+// keep working past the license's expiry, for the license's grace period before adding more is refused.
+package license
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// DefaultGraceDays is the grace period of licenses that don't set one
+const DefaultGraceDays = 14
+
+const (
+	// Active licenses are within their limits and not expired
+	Active = "active"
+	// Grace licenses are expired or over a limit but still within their grace period
+	Grace = "grace"
+	// Expired licenses are expired past their grace period
+	Expired = "expired"
+)
+
+var (
+	// ErrInvalidKey is returned for license keys that aren't signed by the public key or can't be read
+	ErrInvalidKey = errors.New("invalid license key")
+
+	// ErrInvalidPublicKey is returned for public keys that aren't 32 bytes of base64
+	ErrInvalidPublicKey = errors.New("license public key must be 32 bytes encoded as base64")
+
+	// ErrExpired is returned when adding to an instance whose license expired past its grace period
+	ErrExpired = errors.New("the license expired")
+
+	// ErrLimitReached is returned when adding to a limit that has been exceeded for longer than the grace period
+	ErrLimitReached = errors.New("the license limit is reached")
+)
+
+// License is what an instance is licensed for
+type License struct {
+	Licensee string `json:"licensee"`
+	// Warriors is how many registered warriors the instance can have, 0 for any number
+	Warriors int `json:"warriors"`
+	// Teams is how many teams the instance can have, 0 for any number
+	Teams   int       `json:"teams"`
+	Expires time.Time `json:"expires"`
+	// GraceDays is how long the instance can be over a limit or past expiry, DefaultGraceDays when 0
+	GraceDays int `json:"graceDays"`
+}
+
+// Parse verifies the license key was signed with the base64 encoded Ed25519 public key and reads its license
+func Parse(Key string, PublicKey string) (*License, error) {
+	pub, err := base64.StdEncoding.DecodeString(PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(Key), ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidKey
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(pub), payload, signature) {
+		return nil, ErrInvalidKey
+	}
+
+	var l License
+	if err := json.Unmarshal(payload, &l); err != nil || l.Warriors < 0 || l.Teams < 0 || l.GraceDays < 0 {
+		return nil, ErrInvalidKey
+	}
+	if l.GraceDays == 0 {
+		l.GraceDays = DefaultGraceDays
+	}
+
+	return &l, nil
+}
+
+// Sign issues the license as a key signed with the Ed25519 private key
+func Sign(l *License, PrivateKey ed25519.PrivateKey) (string, error) {
+	payload, err := json.Marshal(l)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(ed25519.Sign(PrivateKey, payload)), nil
+}
+
+func (l *License) grace() time.Duration {
+	return time.Duration(l.GraceDays) * 24 * time.Hour
+}
+
+// State gets whether the license is active, expired but within its grace period, or expired past it
+func (l *License) State(Now time.Time) string {
+	switch {
+	case l.Expires.IsZero() || Now.Before(l.Expires):
+		return Active
+	case Now.Before(l.Expires.Add(l.grace())):
+		return Grace
+	default:
+		return Expired
+	}
+}
+
+// GraceEnds gets when the grace period of going over a limit at the time ends
+func (l *License) GraceEnds(OverSince time.Time) time.Time {
+	return OverSince.Add(l.grace())
+}
+
+// Allows reports whether one more can be added to a limit with the number used, the limit having been exceeded
+// since the time given or not when nil, and whether adding it goes over the limit
+func (l *License) Allows(Limit int, Used int, OverSince *time.Time, Now time.Time) (over bool, err error) {
+	if l.State(Now) == Expired {
+		return false, ErrExpired
+	}
+	if Limit == 0 || Used < Limit {
+		return false, nil
+	}
+	if OverSince != nil && !Now.Before(l.GraceEnds(*OverSince)) {
+		return true, ErrLimitReached
+	}
+
+	return true, nil
+}
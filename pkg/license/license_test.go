@@ -0,0 +1,92 @@
+package license
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func testKeys(t *testing.T) (string, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(pub), priv
+}
+
+func TestParse(t *testing.T) {
+	pub, priv := testKeys(t)
+	key, err := Sign(&License{Licensee: "Acme", Warriors: 50, Teams: 5}, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Parse(key, pub)
+	if err != nil || l.Licensee != "Acme" || l.Warriors != 50 || l.Teams != 5 || l.GraceDays != DefaultGraceDays {
+		t.Fatal("Expected the signed license got ", l, err)
+	}
+
+	other, _ := testKeys(t)
+	if _, err := Parse(key, other); err != ErrInvalidKey {
+		t.Error("Expected a key signed by someone else to be invalid got ", err)
+	}
+	if _, err := Parse(key[:len(key)-4]+"AAAA", pub); err != ErrInvalidKey {
+		t.Error("Expected a tampered key to be invalid got ", err)
+	}
+	if _, err := Parse("not a key", pub); err != ErrInvalidKey {
+		t.Error("Expected garbage to be invalid got ", err)
+	}
+	if _, err := Parse(key, "short"); err != ErrInvalidPublicKey {
+		t.Error("Expected an invalid public key to be refused got ", err)
+	}
+}
+
+func TestState(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		expires time.Time
+		state   string
+	}{
+		{time.Time{}, Active},
+		{now.Add(time.Hour), Active},
+		{now.Add(-24 * time.Hour), Grace},
+		{now.Add(-15 * 24 * time.Hour), Expired},
+	}
+	for _, tt := range tests {
+		l := &License{Expires: tt.expires, GraceDays: 14}
+		if state := l.State(now); state != tt.state {
+			t.Error("Expected expiring ", tt.expires, " to be ", tt.state, " got ", state)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	now := time.Now()
+	recently := now.Add(-24 * time.Hour)
+	longAgo := now.Add(-30 * 24 * time.Hour)
+	l := &License{Warriors: 10, GraceDays: 14}
+	expired := &License{Warriors: 10, GraceDays: 14, Expires: longAgo}
+
+	tests := []struct {
+		license   *License
+		limit     int
+		used      int
+		overSince *time.Time
+		over      bool
+		err       error
+	}{
+		{l, 10, 9, nil, false, nil},
+		{l, 0, 500, nil, false, nil},
+		{l, 10, 10, nil, true, nil},
+		{l, 10, 12, &recently, true, nil},
+		{l, 10, 12, &longAgo, true, ErrLimitReached},
+		{expired, 10, 1, nil, false, ErrExpired},
+	}
+	for _, tt := range tests {
+		over, err := tt.license.Allows(tt.limit, tt.used, tt.overSince, now)
+		if over != tt.over || err != tt.err {
+			t.Error("Expected ", tt.used, " of ", tt.limit, " to be ", tt.over, tt.err, " got ", over, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package linear
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Endpoint is the Linear GraphQL api
+const Endpoint = "https://api.linear.app/graphql"
+
+// Client talks to the Linear api with a personal api key
+type Client struct {
+	endpoint string
+	apiKey   string
+	http     *http.Client
+}
+
+// Issue is a Linear issue
+type Issue struct {
+	ID          string `json:"id"`
+	Identifier  string `json:"identifier"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
+// New creates a Linear client
+func New(apiKey string) *Client {
+	return &Client{
+		endpoint: Endpoint,
+		apiKey:   apiKey,
+		http:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// query runs a GraphQL query decoding its data into out
+func (c *Client) query(query string, variables map[string]interface{}, out interface{}) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("linear responded %s", resp.Status)
+	}
+	if len(result.Errors) > 0 {
+		return errors.New(result.Errors[0].Message)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("linear responded %s", resp.Status)
+	}
+
+	return json.Unmarshal(result.Data, out)
+}
+
+const issueFields = `nodes { id identifier title description url }`
+
+// CycleIssues gets the issues in a cycle
+func (c *Client) CycleIssues(CycleID string) ([]*Issue, error) {
+	var data struct {
+		Cycle struct {
+			Issues struct {
+				Nodes []*Issue `json:"nodes"`
+			} `json:"issues"`
+		} `json:"cycle"`
+	}
+	err := c.query(
+		`query($id: String!) { cycle(id: $id) { issues(first: 250) { `+issueFields+` } } }`,
+		map[string]interface{}{"id": CycleID},
+		&data,
+	)
+
+	return data.Cycle.Issues.Nodes, err
+}
+
+// ProjectIssues gets the issues in a project
+func (c *Client) ProjectIssues(ProjectID string) ([]*Issue, error) {
+	var data struct {
+		Project struct {
+			Issues struct {
+				Nodes []*Issue `json:"nodes"`
+			} `json:"issues"`
+		} `json:"project"`
+	}
+	err := c.query(
+		`query($id: String!) { project(id: $id) { issues(first: 250) { `+issueFields+` } } }`,
+		map[string]interface{}{"id": ProjectID},
+		&data,
+	)
+
+	return data.Project.Issues.Nodes, err
+}
+
+// Issue gets an issue by its ID or identifier
+func (c *Client) Issue(IssueID string) (*Issue, error) {
+	var data struct {
+		Issue *Issue `json:"issue"`
+	}
+	err := c.query(
+		`query($id: String!) { issue(id: $id) { id identifier title description url } }`,
+		map[string]interface{}{"id": IssueID},
+		&data,
+	)
+	if err == nil && data.Issue == nil {
+		err = errors.New("linear issue not found")
+	}
+
+	return data.Issue, err
+}
+
+// SetEstimate sets the issues estimate
+func (c *Client) SetEstimate(IssueID string, Estimate int) error {
+	var data struct {
+		IssueUpdate struct {
+			Success bool `json:"success"`
+		} `json:"issueUpdate"`
+	}
+	err := c.query(
+		`mutation($id: String!, $estimate: Int) { issueUpdate(id: $id, input: { estimate: $estimate }) { success } }`,
+		map[string]interface{}{"id": IssueID, "estimate": Estimate},
+		&data,
+	)
+	if err == nil && !data.IssueUpdate.Success {
+		err = errors.New("linear did not update the issue estimate")
+	}
+
+	return err
+}
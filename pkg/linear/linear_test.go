@@ -0,0 +1,76 @@
+package linear
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testClient(handler http.HandlerFunc) (*Client, func()) {
+	srv := httptest.NewServer(handler)
+	c := New("key")
+	c.endpoint = srv.URL
+
+	return c, srv.Close
+}
+
+func TestCycleIssues(t *testing.T) {
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":{"cycle":{"issues":{"nodes":[{"id":"1","identifier":"ENG-1","title":"Login"}]}}}}`))
+	})
+	defer done()
+
+	issues, err := c.CycleIssues("cycle")
+	if err != nil || len(issues) != 1 || issues[0].Identifier != "ENG-1" {
+		t.Error("Unexpected issues ", issues, err)
+	}
+}
+
+func TestSetEstimate(t *testing.T) {
+	var variables map[string]interface{}
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		variables = body.Variables
+		w.Write([]byte(`{"data":{"issueUpdate":{"success":true}}}`))
+	})
+	defer done()
+
+	if err := c.SetEstimate("1", 5); err != nil || variables["estimate"] != float64(5) {
+		t.Error("Unexpected estimate update ", variables, err)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":[{"message":"Entity not found"}]}`))
+	})
+	defer done()
+
+	if _, err := c.ProjectIssues("missing"); err == nil || err.Error() != "Entity not found" {
+		t.Error("Expected Entity not found, got ", err)
+	}
+}
+
+func TestPushEstimate(t *testing.T) {
+	calls := 0
+	c, done := testClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"data":{"issueUpdate":{"success":true}}}`))
+	})
+	defer done()
+
+	if err := c.PushEstimate("1", "1/2"); err != nil || calls != 0 {
+		t.Error("Expected fractional points to be left out, got ", calls, err)
+	}
+	if err := c.PushEstimate("1", "3"); err != nil || calls != 1 {
+		t.Error("Expected whole points to be pushed, got ", calls, err)
+	}
+}
@@ -0,0 +1,69 @@
+package linear
+
+import (
+	"strconv"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/issues"
+)
+
+func init() {
+	issues.Register("linear", func(APIKey string) issues.Provider {
+		return New(APIKey)
+	})
+}
+
+// toIssue converts a Linear issue for import
+func toIssue(i *Issue) *issues.Issue {
+	return &issues.Issue{
+		ID:          i.ID,
+		Key:         i.Identifier,
+		Title:       i.Title,
+		Description: i.Description,
+		Type:        "Story",
+		URL:         i.URL,
+	}
+}
+
+// ListIssues lists the issues of a cycle or project, the source sets either cycleId or projectId
+func (c *Client) ListIssues(Source map[string]string) ([]*issues.Issue, error) {
+	var found []*Issue
+	var err error
+	switch {
+	case Source["cycleId"] != "":
+		found, err = c.CycleIssues(Source["cycleId"])
+	case Source["projectId"] != "":
+		found, err = c.ProjectIssues(Source["projectId"])
+	default:
+		return nil, issues.ErrInvalidSource
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*issues.Issue, 0, len(found))
+	for _, i := range found {
+		list = append(list, toIssue(i))
+	}
+
+	return list, nil
+}
+
+// ImportIssue gets an issue by its ID or identifier
+func (c *Client) ImportIssue(IssueID string) (*issues.Issue, error) {
+	i, err := c.Issue(IssueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toIssue(i), nil
+}
+
+// PushEstimate sets the issues estimate, linear estimates are whole numbers so points like ? or 1/2 are left out
+func (c *Client) PushEstimate(IssueID string, Points string) error {
+	Estimate, err := strconv.Atoi(Points)
+	if err != nil {
+		return nil
+	}
+
+	return c.SetEstimate(IssueID, Estimate)
+}
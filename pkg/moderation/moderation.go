@@ -0,0 +1,147 @@
+// Package moderation checks text entered by warriors, like plan and warrior names, against a word list and
+// optionally an external moderation API before it's shown to everyone in a battle.
+package moderation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrRejected is returned for text that isn't allowed
+var ErrRejected = errors.New("content not allowed")
+
+// Moderator checks text against its words and API, a nil Moderator allows everything
+type Moderator struct {
+	words  map[string]bool
+	apiURL string
+	apiKey string
+	http   *http.Client
+}
+
+// New creates a moderator refusing the words, matched whole and in any case, and text the API at APIURL flags,
+// no words and no API give a nil Moderator
+func New(Words []string, APIURL string, APIKey string) *Moderator {
+	words := make(map[string]bool)
+	for _, word := range Words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			words[word] = true
+		}
+	}
+	if len(words) == 0 && APIURL == "" {
+		return nil
+	}
+
+	return &Moderator{
+		words:  words,
+		apiURL: APIURL,
+		apiKey: APIKey,
+		http:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// ReadWords reads a word list file of a word per line, blank lines and lines starting with # being skipped
+func ReadWords(Path string) ([]string, error) {
+	f, err := os.Open(Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+
+	return words, scanner.Err()
+}
+
+// Check returns ErrRejected when any of the texts contains a listed word or is flagged by the API
+func (m *Moderator) Check(Texts ...string) error {
+	if m == nil {
+		return nil
+	}
+
+	var text []string
+	for _, t := range Texts {
+		if t == "" {
+			continue
+		}
+		if m.listed(t) {
+			return ErrRejected
+		}
+		text = append(text, t)
+	}
+
+	if m.apiURL != "" && len(text) > 0 && m.flagged(strings.Join(text, "\n")) {
+		return ErrRejected
+	}
+
+	return nil
+}
+
+// listed checks whether any word of the text is in the word list
+func (m *Moderator) listed(Text string) bool {
+	if len(m.words) == 0 {
+		return false
+	}
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if m.words[word] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flagged asks the API whether the text should be refused, the API being unreachable lets the text through
+// so a moderation outage doesn't stop battles
+func (m *Moderator) flagged(Text string) bool {
+	body, _ := json.Marshal(map[string]string{"text": Text})
+	req, err := http.NewRequest("POST", m.apiURL, bytes.NewReader(body))
+	if err != nil {
+		log.Println("error creating moderation request : " + err.Error())
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		log.Println("error calling moderation api : " + err.Error())
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Println("moderation api responded " + resp.Status)
+		return false
+	}
+
+	var result struct {
+		Flagged bool `json:"flagged"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Println("error reading moderation api response : " + err.Error())
+		return false
+	}
+
+	return result.Flagged
+}
@@ -0,0 +1,88 @@
+package moderation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNilModerator(t *testing.T) {
+	var m *Moderator
+	if err := m.Check("anything"); err != nil {
+		t.Error("Expected a nil moderator to allow everything got ", err)
+	}
+	if New([]string{" ", ""}, "", "") != nil {
+		t.Error("Expected no words and no api to give a nil moderator")
+	}
+}
+
+func TestCheckWords(t *testing.T) {
+	m := New([]string{"Darn", "heck "}, "", "")
+	tests := []struct {
+		text    string
+		allowed bool
+	}{
+		{"Login page", true},
+		{"darn login page", false},
+		{"Login DARN!", false},
+		{"what the heck,", false},
+		// words are matched whole
+		{"darning socks", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if err := m.Check("Fine", tt.text); (err == nil) != tt.allowed {
+			t.Error("Expected ", tt.text, " allowed to be ", tt.allowed, " got ", err)
+		}
+	}
+}
+
+func TestCheckAPI(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		var body struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(map[string]bool{"flagged": strings.Contains(body.Text, "rude")})
+	}))
+	defer srv.Close()
+
+	m := New(nil, srv.URL, "key1")
+	if err := m.Check("Login page", "Let warriors log in"); err != nil {
+		t.Error("Expected text to be allowed got ", err)
+	}
+	if err := m.Check("Login page", "something rude"); err != ErrRejected {
+		t.Error("Expected flagged text to be rejected got ", err)
+	}
+	if authorization != "Bearer key1" {
+		t.Error("Expected the api key to be sent got ", authorization)
+	}
+
+	// an api that's down lets text through
+	srv.Close()
+	if err := m.Check("something rude"); err != nil {
+		t.Error("Expected text to be allowed with the api down got ", err)
+	}
+}
+
+func TestReadWords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moderation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "words.txt")
+	ioutil.WriteFile(path, []byte("# mild\ndarn\n\n heck \n"), 0600)
+
+	words, err := ReadWords(path)
+	if err != nil || len(words) != 2 || words[0] != "darn" || words[1] != "heck" {
+		t.Error("Unexpected words ", words, err)
+	}
+}
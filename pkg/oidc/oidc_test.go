@@ -0,0 +1,123 @@
+package oidc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func idToken(claims map[string]interface{}) string {
+	payload, _ := json.Marshal(claims)
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+func newTestProvider(claims map[string]interface{}) (*Provider, func()) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/realms/td/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 srv.URL + "/realms/td",
+				"authorization_endpoint": srv.URL + "/realms/td/auth",
+				"token_endpoint":         srv.URL + "/realms/td/token",
+			})
+		case "/realms/td/token":
+			r.ParseForm()
+			if r.PostForm.Get("code") != "c1" || r.PostForm.Get("code_verifier") != "v1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "a1", "id_token": idToken(claims)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return New(srv.URL+"/realms/td/", "thunderdome", "secret", "openid profile email"), srv.Close
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p, done := newTestProvider(nil)
+	defer done()
+
+	AuthURL, err := p.AuthCodeURL("https://td.example/api/auth/oidc/callback", "s1", "n1", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(AuthURL)
+	q := u.Query()
+	if u.Path != "/realms/td/auth" || q.Get("state") != "s1" || q.Get("nonce") != "n1" ||
+		q.Get("code_challenge") != Challenge("v1") || q.Get("code_challenge_method") != "S256" {
+		t.Error("Unexpected auth code url ", AuthURL)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// the example of RFC 7636 appendix B
+	if c := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); c != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Error("Unexpected challenge ", c)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	claims := map[string]interface{}{
+		"aud":   []string{"thunderdome", "account"},
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": "n1",
+		"name":  "Thor Odinson",
+		"email": "thor@asgard.example",
+	}
+	p, done := newTestProvider(claims)
+	defer done()
+	claims["iss"] = p.Issuer
+
+	got, err := p.Exchange("https://td.example/api/auth/oidc/callback", "c1", "v1", "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String("name") != "Thor Odinson" || got.String("email") != "thor@asgard.example" {
+		t.Error("Unexpected claims ", got)
+	}
+
+	if _, err := p.Exchange("https://td.example/api/auth/oidc/callback", "c1", "v2", "n1"); err == nil {
+		t.Error("Expected a wrong code verifier to fail")
+	}
+	if _, err := p.Exchange("https://td.example/api/auth/oidc/callback", "c1", "v1", "n2"); err != ErrInvalidIDToken {
+		t.Error("Expected a wrong nonce to fail got ", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	p := New("https://sso.example/realms/td", "thunderdome", "", "openid")
+	now := time.Now()
+	valid := func() Claims {
+		return Claims{"iss": p.Issuer, "aud": "thunderdome", "exp": float64(now.Unix() + 60), "nonce": "n1"}
+	}
+
+	tests := []struct {
+		name  string
+		claim string
+		value interface{}
+	}{
+		{"another issuer", "iss", "https://evil.example/realms/td"},
+		{"another client", "aud", "other"},
+		{"no client", "aud", []interface{}{"other"}},
+		{"expired", "exp", float64(now.Unix() - 1)},
+		{"no expiry", "exp", nil},
+		{"another sign in", "nonce", "n2"},
+	}
+	if err := p.validate(valid(), "n1", now); err != nil {
+		t.Error("Expected valid claims to pass got ", err)
+	}
+	for _, tt := range tests {
+		c := valid()
+		c[tt.claim] = tt.value
+		if err := p.validate(c, "n1", now); err != ErrInvalidIDToken {
+			t.Error("Expected ", tt.name, " to fail")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package releases checks the latest release of Thunderdome on GitHub so admins learn when an update is available.
+package releases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatestURL is the GitHub API URL of Thunderdome's latest release
+const LatestURL = "https://api.github.com/repos/StevenWeathers/thunderdome-planning-poker/releases/latest"
+
+const (
+	// releases come out every few weeks, checking twice a day is plenty and stays well within GitHub's rate limit
+	checkTTL = 12 * time.Hour
+	// failures are cached briefly so GitHub being down doesn't stick
+	errorTTL = 5 * time.Minute
+)
+
+// Release is a published release
+type Release struct {
+	Version       string    `json:"version"`
+	URL           string    `json:"url"`
+	PublishedDate time.Time `json:"publishedDate"`
+}
+
+// Checker gets the latest release, caching it in memory
+type Checker struct {
+	url  string
+	http *http.Client
+
+	mu      sync.Mutex
+	latest  *Release
+	err     error
+	expires time.Time
+}
+
+// New creates a checker getting the latest release from the GitHub API URL
+func New(URL string) *Checker {
+	return &Checker{url: URL, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Latest gets the latest release, checking GitHub when it hasn't recently
+func (c *Checker) Latest() (*Release, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.latest, c.err
+	}
+
+	c.latest, c.err = c.fetch()
+	if c.err != nil {
+		c.expires = time.Now().Add(errorTTL)
+	} else {
+		c.expires = time.Now().Add(checkTTL)
+	}
+
+	return c.latest, c.err
+}
+
+func (c *Checker) fetch() (*Release, error) {
+	req, err := http.NewRequest("GET", c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("checking the latest release responded %d", resp.StatusCode)
+	}
+
+	var release struct {
+		TagName     string    `json:"tag_name"`
+		HTMLURL     string    `json:"html_url"`
+		PublishedAt time.Time `json:"published_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+	if release.TagName == "" {
+		return nil, errors.New("the latest release has no tag")
+	}
+
+	return &Release{Version: release.TagName, URL: release.HTMLURL, PublishedDate: release.PublishedAt}, nil
+}
+
+// parseVersion gets the major, minor and patch numbers of a version like v1.2.3, ignoring any pre-release suffix
+func parseVersion(Version string) ([3]int, bool) {
+	var parts [3]int
+	Version = strings.TrimPrefix(strings.TrimSpace(Version), "v")
+	if i := strings.IndexAny(Version, "-+"); i >= 0 {
+		Version = Version[:i]
+	}
+	fields := strings.Split(Version, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+
+	return parts, true
+}
+
+// Newer reports whether the latest version is newer than the current one, never for versions that aren't
+// releases like dev builds
+func Newer(Current string, Latest string) bool {
+	current, ok := parseVersion(Current)
+	if !ok {
+		return false
+	}
+	latest, ok := parseVersion(Latest)
+	if !ok {
+		return false
+	}
+	for i := range current {
+		if latest[i] != current[i] {
+			return latest[i] > current[i]
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,58 @@
+package releases
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		current string
+		latest  string
+		newer   bool
+	}{
+		{"v1.2.3", "v1.2.4", true},
+		{"v1.2.3", "v1.10.0", true},
+		{"1.2.3", "v2.0.0", true},
+		{"v1.2.3", "v1.2.3", false},
+		{"v1.3.0", "v1.2.9", false},
+		{"v1.2.3-rc1", "v1.2.3", false},
+		{"dev", "v1.2.3", false},
+		{"v1.2.3", "nightly", false},
+	}
+	for _, tt := range tests {
+		if Newer(tt.current, tt.latest) != tt.newer {
+			t.Error("Expected ", tt.latest, " newer than ", tt.current, " to be ", tt.newer)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"tag_name": "v2.1.0", "html_url": "https://github.com/releases/v2.1.0", "published_at": "2026-10-01T12:00:00Z"}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	release, err := c.Latest()
+	if err != nil || release.Version != "v2.1.0" || release.URL != "https://github.com/releases/v2.1.0" {
+		t.Fatal("Expected the latest release got ", release, err)
+	}
+	if _, err := c.Latest(); err != nil || requests != 1 {
+		t.Error("Expected the latest release to be cached got ", requests, " requests")
+	}
+}
+
+func TestLatestError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	if release, err := New(srv.URL).Latest(); err == nil {
+		t.Error("Expected a failed check to error got ", release)
+	}
+}
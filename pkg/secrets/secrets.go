@@ -0,0 +1,130 @@
+// Package secrets encrypts credentials stored in the database with AES-256-GCM.
+//
+// A Keyring holds the current key, which encrypts, along with any previous keys still needed to decrypt values
+// written before a rotation. Encrypted values name the key they were encrypted with, values without the prefix are
+// taken as plaintext written before encryption was enabled.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// prefix marks encrypted values, followed by the key id and the base64 nonce and ciphertext
+const prefix = "enc:v1:"
+
+var (
+	// ErrInvalidKey is returned for keys that aren't 32 bytes of base64
+	ErrInvalidKey = errors.New("encryption keys must be 32 bytes encoded as base64")
+
+	// ErrUnknownKey is returned when a value was encrypted with a key that isn't in the keyring
+	ErrUnknownKey = errors.New("value encrypted with an unknown key")
+
+	// ErrMalformed is returned for encrypted values that can't be decrypted
+	ErrMalformed = errors.New("malformed encrypted value")
+)
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring encrypts with its current key and decrypts with any of its keys, a nil Keyring leaves values as they are
+type Keyring struct {
+	current *key
+	keys    map[string]*key
+}
+
+// New creates a keyring from base64 encoded 32 byte keys, the first one being current,
+// no keys gives a nil Keyring that doesn't encrypt
+func New(Keys []string) (*Keyring, error) {
+	if len(Keys) == 0 {
+		return nil, nil
+	}
+
+	k := &Keyring{keys: make(map[string]*key)}
+	for _, encoded := range Keys {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(raw) != 32 {
+			return nil, ErrInvalidKey
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, ErrInvalidKey
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, ErrInvalidKey
+		}
+
+		// the id is a hash prefix so it says which key was used without giving anything about it away
+		sum := sha256.Sum256(raw)
+		kk := &key{id: hex.EncodeToString(sum[:4]), aead: aead}
+		if k.current == nil {
+			k.current = kk
+		}
+		k.keys[kk.id] = kk
+	}
+
+	return k, nil
+}
+
+// Encrypt encrypts the value with the current key, empty values stay empty
+func (k *Keyring) Encrypt(Value string) (string, error) {
+	if k == nil || Value == "" {
+		return Value, nil
+	}
+
+	nonce := make([]byte, k.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.current.aead.Seal(nonce, nonce, []byte(Value), []byte(k.current.id))
+
+	return prefix + k.current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts the value with the key it was encrypted with, plaintext values are returned as they are
+func (k *Keyring) Decrypt(Value string) (string, error) {
+	if !strings.HasPrefix(Value, prefix) {
+		return Value, nil
+	}
+	if k == nil {
+		return "", ErrUnknownKey
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(Value, prefix), ":", 2)
+	if len(parts) != 2 {
+		return "", ErrMalformed
+	}
+	kk, ok := k.keys[parts[0]]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < kk.aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	nonce, ciphertext := sealed[:kk.aead.NonceSize()], sealed[kk.aead.NonceSize():]
+	plain, err := kk.aead.Open(nil, nonce, ciphertext, []byte(kk.id))
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	return string(plain), nil
+}
+
+// Stale reports whether the value should be re-encrypted, being plaintext or encrypted with a previous key
+func (k *Keyring) Stale(Value string) bool {
+	if k == nil || Value == "" {
+		return false
+	}
+
+	return !strings.HasPrefix(Value, prefix+k.current.id+":")
+}
@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	oldKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	newKey = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	k, err := New([]string{newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := k.Encrypt("lin_api_secret")
+	if err != nil || !strings.HasPrefix(encrypted, prefix) || strings.Contains(encrypted, "lin_api_secret") {
+		t.Fatal("Expected the value to be encrypted got ", encrypted, err)
+	}
+	if plain, err := k.Decrypt(encrypted); err != nil || plain != "lin_api_secret" {
+		t.Error("Expected the value back got ", plain, err)
+	}
+	if k.Stale(encrypted) {
+		t.Error("Expected a value encrypted with the current key not to be stale")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	before, _ := New([]string{oldKey})
+	encrypted, _ := before.Encrypt("lin_api_secret")
+
+	after, err := New([]string{newKey, oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := after.Decrypt(encrypted); err != nil || plain != "lin_api_secret" {
+		t.Error("Expected a previous key to still decrypt got ", plain, err)
+	}
+	if !after.Stale(encrypted) {
+		t.Error("Expected a value encrypted with a previous key to be stale")
+	}
+
+	dropped, _ := New([]string{newKey})
+	if _, err := dropped.Decrypt(encrypted); err != ErrUnknownKey {
+		t.Error("Expected an unknown key error got ", err)
+	}
+}
+
+func TestPlaintext(t *testing.T) {
+	var disabled *Keyring
+	if v, _ := disabled.Encrypt("plain"); v != "plain" {
+		t.Error("Expected a nil keyring to leave values as they are got ", v)
+	}
+
+	k, _ := New([]string{newKey})
+	if v, err := k.Decrypt("plain"); err != nil || v != "plain" {
+		t.Error("Expected plaintext from before encryption to be returned got ", v, err)
+	}
+	if !k.Stale("plain") {
+		t.Error("Expected plaintext to be stale")
+	}
+}
+
+func TestTampered(t *testing.T) {
+	k, _ := New([]string{newKey})
+	encrypted, _ := k.Encrypt("lin_api_secret")
+
+	tampered := encrypted[:len(encrypted)-4] + "AAA="
+	if _, err := k.Decrypt(tampered); err != ErrMalformed {
+		t.Error("Expected a tampered value to fail got ", err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	if _, err := New([]string{"c2hvcnQ="}); err != ErrInvalidKey {
+		t.Error("Expected a short key to be rejected got ", err)
+	}
+}
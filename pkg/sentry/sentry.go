@@ -0,0 +1,106 @@
+// Package sentry reports errors to Sentry, or a Sentry compatible service like GlitchTip, through its store api.
+package sentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDSN is returned for DSNs that aren't in the https://<key>@<host>/<project> format
+var ErrInvalidDSN = errors.New("invalid sentry dsn")
+
+// Client sends events to the project of a DSN, a nil Client drops them
+type Client struct {
+	storeURL  string
+	publicKey string
+	release   string
+	http      *http.Client
+}
+
+// Event is an error report
+type Event struct {
+	EventID    string            `json:"event_id"`
+	Timestamp  string            `json:"timestamp"`
+	Level      string            `json:"level"`
+	Platform   string            `json:"platform"`
+	Release    string            `json:"release,omitempty"`
+	ServerName string            `json:"server_name,omitempty"`
+	Message    string            `json:"message"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Extra      map[string]string `json:"extra,omitempty"`
+}
+
+// New creates a client for the DSN tagging events with the release, an empty DSN gives a nil Client
+func New(DSN string, Release string) (*Client, error) {
+	if DSN == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(DSN)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, ErrInvalidDSN
+	}
+	slash := strings.LastIndex(u.Path, "/")
+	project := u.Path[slash+1:]
+	if slash < 0 || project == "" {
+		return nil, ErrInvalidDSN
+	}
+
+	return &Client{
+		storeURL:  fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, u.Path[:slash], project),
+		publicKey: u.User.Username(),
+		release:   Release,
+		http:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Report sends the error along with its stack trace and tags describing where it happened
+func (c *Client) Report(Message string, Stack string, Tags map[string]string) error {
+	if c == nil {
+		return nil
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	host, _ := os.Hostname()
+	body, _ := json.Marshal(&Event{
+		EventID:    hex.EncodeToString(id),
+		Timestamp:  time.Now().UTC().Format("2006-01-02T15:04:05"),
+		Level:      "error",
+		Platform:   "go",
+		Release:    c.release,
+		ServerName: host,
+		Message:    Message,
+		Tags:       Tags,
+		Extra:      map[string]string{"stack": Stack},
+	})
+
+	req, err := http.NewRequest(http.MethodPost, c.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=thunderdome/%s, sentry_key=%s", c.release, c.publicKey,
+	))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry responded %s", resp.Status)
+	}
+
+	return nil
+}
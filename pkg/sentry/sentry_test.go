@@ -0,0 +1,59 @@
+package sentry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	c, err := New("https://abc123@glitchtip.example.com/sub/42", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.storeURL != "https://glitchtip.example.com/sub/api/42/store/" || c.publicKey != "abc123" {
+		t.Error("Expected the store url and key from the dsn got ", c.storeURL, c.publicKey)
+	}
+
+	if c, err := New("", "1.0.0"); c != nil || err != nil {
+		t.Error("Expected no client without a dsn got ", c, err)
+	}
+	for _, dsn := range []string{"https://sentry.example.com/42", "https://abc123@sentry.example.com/", "not a dsn"} {
+		if _, err := New(dsn, "1.0.0"); err != ErrInvalidDSN {
+			t.Error("Expected an invalid dsn error for ", dsn, " got ", err)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	var auth string
+	var event Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/42/store/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		auth = r.Header.Get("X-Sentry-Auth")
+		_ = json.NewDecoder(r.Body).Decode(&event)
+	}))
+	defer srv.Close()
+
+	c, _ := New(strings.Replace(srv.URL, "://", "://abc123@", 1)+"/42", "1.0.0")
+	if err := c.Report("boom", "goroutine 1 [running]:", map[string]string{"route": "/api/battles"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(auth, "sentry_key=abc123") {
+		t.Error("Expected the key in the auth header got ", auth)
+	}
+	if event.Message != "boom" || event.Tags["route"] != "/api/battles" || event.Release != "1.0.0" || len(event.EventID) != 32 {
+		t.Error("Expected the event got ", event)
+	}
+
+	var disabled *Client
+	if err := disabled.Report("boom", "", nil); err != nil {
+		t.Error("Expected a nil client to drop events got ", err)
+	}
+}
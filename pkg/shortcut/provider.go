@@ -0,0 +1,71 @@
+package shortcut
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/issues"
+)
+
+func init() {
+	issues.Register("shortcut", func(APIKey string) issues.Provider {
+		return New(APIKey)
+	})
+}
+
+// toIssue converts a Shortcut story for import
+func toIssue(s *Story) *issues.Issue {
+	StoryID := strconv.Itoa(s.ID)
+	Type := "Story"
+	if s.StoryType == "bug" {
+		Type = "Bug"
+	}
+
+	return &issues.Issue{
+		ID:          StoryID,
+		Key:         "sc-" + StoryID,
+		Title:       s.Name,
+		Description: s.Description,
+		Type:        Type,
+		URL:         s.AppURL,
+	}
+}
+
+// ListIssues lists the stories of an iteration, the source sets iterationId
+func (c *Client) ListIssues(Source map[string]string) ([]*issues.Issue, error) {
+	if Source["iterationId"] == "" {
+		return nil, issues.ErrInvalidSource
+	}
+
+	stories, err := c.IterationStories(Source["iterationId"])
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*issues.Issue, 0, len(stories))
+	for _, s := range stories {
+		list = append(list, toIssue(s))
+	}
+
+	return list, nil
+}
+
+// ImportIssue gets a story by its ID, with or without the sc- prefix
+func (c *Client) ImportIssue(IssueID string) (*issues.Issue, error) {
+	s, err := c.Story(strings.TrimPrefix(IssueID, "sc-"))
+	if err != nil {
+		return nil, err
+	}
+
+	return toIssue(s), nil
+}
+
+// PushEstimate sets the stories estimate, shortcut estimates are whole numbers so points like ? or 1/2 are left out
+func (c *Client) PushEstimate(IssueID string, Points string) error {
+	Estimate, err := strconv.Atoi(Points)
+	if err != nil {
+		return nil
+	}
+
+	return c.SetEstimate(IssueID, Estimate)
+}
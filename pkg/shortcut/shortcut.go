@@ -0,0 +1,91 @@
+package shortcut
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Endpoint is the Shortcut REST api
+const Endpoint = "https://api.app.shortcut.com/api/v3"
+
+// Client talks to the Shortcut api with an api token
+type Client struct {
+	endpoint string
+	apiToken string
+	http     *http.Client
+}
+
+// Story is a Shortcut story
+type Story struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	StoryType   string `json:"story_type"`
+	AppURL      string `json:"app_url"`
+}
+
+// New creates a Shortcut client
+func New(apiToken string) *Client {
+	return &Client{
+		endpoint: Endpoint,
+		apiToken: apiToken,
+		http:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// do sends a request to the api decoding the response into out when set
+func (c *Client) do(method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Shortcut-Token", c.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("shortcut responded %s to %s %s", resp.Status, method, path)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
+
+// IterationStories gets the stories in an iteration
+func (c *Client) IterationStories(IterationID string) ([]*Story, error) {
+	var stories []*Story
+	err := c.do(http.MethodGet, "/iterations/"+url.PathEscape(IterationID)+"/stories", nil, &stories)
+
+	return stories, err
+}
+
+// Story gets a story
+func (c *Client) Story(StoryID string) (*Story, error) {
+	var story Story
+	err := c.do(http.MethodGet, "/stories/"+url.PathEscape(StoryID), nil, &story)
+
+	return &story, err
+}
+
+// SetEstimate sets the stories estimate
+func (c *Client) SetEstimate(StoryID string, Estimate int) error {
+	return c.do(http.MethodPut, "/stories/"+url.PathEscape(StoryID), map[string]int{"estimate": Estimate}, nil)
+}
@@ -0,0 +1,60 @@
+package shortcut
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIterationStories(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Shortcut-Token") != "token" || r.URL.Path != "/iterations/12/stories" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[{"id":34,"name":"Login","story_type":"feature","app_url":"https://app.shortcut.com/td/story/34"}]`))
+	}))
+	defer srv.Close()
+	c := New("token")
+	c.endpoint = srv.URL
+
+	stories, err := c.IterationStories("12")
+	if err != nil || len(stories) != 1 || stories[0].ID != 34 || stories[0].StoryType != "feature" {
+		t.Error("Unexpected stories ", stories, err)
+	}
+}
+
+func TestSetEstimate(t *testing.T) {
+	var body map[string]int
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+	c := New("token")
+	c.endpoint = srv.URL
+
+	if err := c.SetEstimate("34", 8); err != nil || path != "/stories/34" || body["estimate"] != 8 {
+		t.Error("Unexpected estimate update ", path, body, err)
+	}
+}
+
+func TestImportIssue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stories/34" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id":34,"name":"Crash on login","story_type":"bug"}`))
+	}))
+	defer srv.Close()
+	c := New("token")
+	c.endpoint = srv.URL
+
+	issue, err := c.ImportIssue("sc-34")
+	if err != nil || issue.ID != "34" || issue.Key != "sc-34" || issue.Type != "Bug" {
+		t.Error("Unexpected issue ", issue, err)
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Local stores objects as files under a directory
+type Local struct {
+	dir string
+}
+
+// NewLocal creates a local storage in the directory, creating it when it doesn't exist
+func NewLocal(Dir string) (*Local, error) {
+	if Dir == "" {
+		Dir = "data"
+	}
+	if err := os.MkdirAll(Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: Dir}, nil
+}
+
+// Put writes the object to a temporary file renamed into place, so Get never sees it half written
+func (l *Local) Put(Key string, Body io.Reader, ContentType string) error {
+	Key, err := cleanKey(Key)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(l.dir, filepath.FromSlash(Key))
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Get opens the object's file
+func (l *Local) Get(Key string) (io.ReadCloser, error) {
+	Key, err := cleanKey(Key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(l.dir, filepath.FromSlash(Key)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+// Delete removes the object's file
+func (l *Local) Delete(Key string) error {
+	Key, err := cleanKey(Key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(l.dir, filepath.FromSlash(Key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
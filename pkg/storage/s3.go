@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxErrorBytes is how much of an error response is read for its message
+const maxErrorBytes = 4 << 10
+
+// S3 stores objects in a bucket of an S3 compatible object storage, signing requests with AWS Signature Version 4
+type S3 struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	http      *http.Client
+}
+
+// NewS3 creates a storage for the bucket, objects being addressed by path (endpoint/bucket/key) which AWS, MinIO
+// and Cloud Storage all support
+func NewS3(Endpoint string, Region string, Bucket string, AccessKey string, SecretKey string) (*S3, error) {
+	if Endpoint == "" {
+		Endpoint = "https://s3." + Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+		return nil, errors.New("invalid storage endpoint")
+	}
+	if Region == "" || Bucket == "" || AccessKey == "" || SecretKey == "" {
+		return nil, errors.New("storage region, bucket, access key and secret key required")
+	}
+
+	return &S3{
+		endpoint:  endpoint,
+		region:    Region,
+		bucket:    Bucket,
+		accessKey: AccessKey,
+		secretKey: SecretKey,
+		http:      &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Put uploads the object, read into memory first as the signature covers its hash
+func (s *S3) Put(Key string, Body io.Reader, ContentType string) error {
+	data, err := ioutil.ReadAll(Body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodPut, Key, data, ContentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return responseError(resp)
+}
+
+// Get downloads the object
+func (s *S3) Get(Key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, Key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if err := responseError(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// Delete removes the object, S3 responding the same whether it existed or not
+func (s *S3) Delete(Key string) error {
+	resp, err := s.do(http.MethodDelete, Key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return responseError(resp)
+}
+
+// do sends the signed request for the object
+func (s *S3) do(Method string, Key string, Body []byte, ContentType string) (*http.Response, error) {
+	Key, err := cleanKey(Key)
+	if err != nil {
+		return nil, err
+	}
+
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.bucket + "/" + Key
+	// sent escaped the same way it's signed
+	u.RawPath = uriEncode(u.Path)
+	req, err := http.NewRequest(Method, u.String(), bytes.NewReader(Body))
+	if err != nil {
+		return nil, err
+	}
+	if ContentType != "" {
+		req.Header.Set("Content-Type", ContentType)
+	}
+	s.sign(req, Body, time.Now())
+
+	return s.http.Do(req)
+}
+
+// sign adds the Signature Version 4 authorization for the request's host and headers
+func (s *S3) sign(req *http.Request, Body []byte, Now time.Time) {
+	Now = Now.UTC()
+	amzDate := Now.Format("20060102T150405Z")
+	date := Now.Format("20060102")
+	bodyHash := sha256.Sum256(Body)
+	payloadHash := hex.EncodeToString(bodyHash[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		// url.Values.Encode sorts by key and escapes like Signature Version 4 expects, other than spaces
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+// hmacSHA256 is a step of deriving the signing key and the signature itself
+func hmacSHA256(Key []byte, Data string) []byte {
+	mac := hmac.New(sha256.New, Key)
+	mac.Write([]byte(Data))
+
+	return mac.Sum(nil)
+}
+
+// uriEncode escapes everything in the path but unreserved characters and the slashes
+func uriEncode(Path string) string {
+	var b strings.Builder
+	for _, c := range []byte(Path) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// responseError gets an error for responses that aren't successful
+func responseError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+
+	return fmt.Errorf("storage responded %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
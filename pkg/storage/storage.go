@@ -0,0 +1,77 @@
+// Package storage keeps files Thunderdome generates or warriors upload, like export artifacts, on local disk or in
+// S3 compatible object storage so container deployments without a persistent disk don't lose them.
+package storage
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned by Get for keys that have nothing stored
+	ErrNotFound = errors.New("object not found")
+
+	// ErrInvalidKey is returned for keys that are empty or reach outside the storage
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Storage stores objects by key, keys being slash separated paths like exports/{warriorId}.zip
+type Storage interface {
+	// Put stores the object, replacing any stored with the key
+	Put(Key string, Body io.Reader, ContentType string) error
+	// Get opens the stored object, the caller closing it
+	Get(Key string) (io.ReadCloser, error)
+	// Delete removes the object, deleting a key with nothing stored isn't an error
+	Delete(Key string) error
+}
+
+// Config is the backend and its settings
+type Config struct {
+	// Backend is local, s3 or gcs
+	Backend string
+	// LocalPath is the directory the local backend stores objects in
+	LocalPath string
+	// Endpoint is the S3 compatible API, e.g. https://s3.eu-west-1.amazonaws.com or a MinIO server, gcs using
+	// https://storage.googleapis.com when it's empty
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// New creates the configured storage, nil when no backend is configured
+func New(c Config) (Storage, error) {
+	switch c.Backend {
+	case "":
+		return nil, nil
+	case "local":
+		return NewLocal(c.LocalPath)
+	case "s3":
+		return NewS3(c.Endpoint, c.Region, c.Bucket, c.AccessKey, c.SecretKey)
+	case "gcs":
+		// Cloud Storage's XML API is S3 compatible with HMAC keys
+		Endpoint, Region := c.Endpoint, c.Region
+		if Endpoint == "" {
+			Endpoint = "https://storage.googleapis.com"
+		}
+		if Region == "" {
+			Region = "auto"
+		}
+		return NewS3(Endpoint, Region, c.Bucket, c.AccessKey, c.SecretKey)
+	}
+
+	return nil, errors.New("unknown storage backend " + c.Backend)
+}
+
+// cleanKey checks the key stays within the storage
+func cleanKey(Key string) (string, error) {
+	cleaned := path.Clean("/" + Key)[1:]
+	if cleaned == "" || cleaned != Key || strings.Contains(Key, "\\") {
+		return "", ErrInvalidKey
+	}
+
+	return cleaned, nil
+}
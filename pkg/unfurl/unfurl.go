@@ -0,0 +1,385 @@
+// Package unfurl fetches the title, description and image of a link to preview it.
+//
+// Links are entered by users so every connection is checked against the address it actually
+// dials, refusing loopback, private and link local networks, which also covers redirects and
+// hosts that resolve to a different address between lookups.
+package unfurl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// ErrInvalidLink is returned for links that aren't absolute http(s) urls
+	ErrInvalidLink = errors.New("invalid link")
+
+	// ErrBlockedAddress is returned when a link connects to a non public address
+	ErrBlockedAddress = errors.New("link address not allowed")
+
+	// ErrUnsupportedContent is returned when a link isn't a page or an image
+	ErrUnsupportedContent = errors.New("unsupported content type")
+
+	// ErrNoImage is returned by Image for links without a preview image
+	ErrNoImage = errors.New("link has no preview image")
+)
+
+const (
+	maxPageBytes    = 1 << 20
+	maxImageBytes   = 5 << 20
+	maxRedirects    = 5
+	maxCacheEntries = 1000
+	// failures are cached briefly so a tracker being down doesn't stick
+	maxErrorTTL = time.Minute
+)
+
+// blockedNetworks are the loopback, private, link local, shared, multicast and reserved ranges
+var blockedNetworks = parseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "64:ff9b::/96", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+// Preview is what a link shows when unfurled
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	SiteName    string `json:"siteName"`
+}
+
+type cacheEntry struct {
+	preview *Preview
+	err     error
+	expires time.Time
+}
+
+// Unfurler fetches link previews, caching them in memory
+type Unfurler struct {
+	http    *http.Client
+	ttl     time.Duration
+	allowed func(ip net.IP) bool
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
+}
+
+// New creates an Unfurler keeping previews for TTL
+func New(TTL time.Duration) *Unfurler {
+	u := &Unfurler{
+		ttl:     TTL,
+		allowed: PublicIP,
+		cache:   make(map[string]*cacheEntry),
+	}
+
+	u.http = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: publicTransport(u.checkAddress),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkLink(req.URL)
+		},
+	}
+
+	return u
+}
+
+// publicTransport dials through the address check, which sees the address actually connected to after the host is
+// resolved
+func publicTransport(check func(network string, address string, c syscall.RawConn) error) *http.Transport {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: check}
+
+	return &http.Transport{
+		// no proxy, it would make the connection to the link on our behalf past the address check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// PublicClient creates a client for requests to other user entered urls, like webhooks, that only connects to
+// public addresses. Redirects aren't followed, the redirect response is returned as is
+func PublicClient(Timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: Timeout,
+		Transport: publicTransport(func(network string, address string, c syscall.RawConn) error {
+			return checkAddress(PublicIP, address)
+		}),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// PublicIP reports whether the ip is outside of the blocked networks
+func PublicIP(ip net.IP) bool {
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Unfurl gets the preview of a link, from the cache when it was fetched within the TTL
+func (u *Unfurler) Unfurl(Link string) (*Preview, error) {
+	u.mu.Lock()
+	entry, ok := u.cache[Link]
+	u.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.preview, entry.err
+	}
+
+	preview, err := u.fetchPreview(Link)
+
+	ttl := u.ttl
+	if err != nil && ttl > maxErrorTTL {
+		ttl = maxErrorTTL
+	}
+	u.mu.Lock()
+	if len(u.cache) >= maxCacheEntries {
+		u.evict()
+	}
+	u.cache[Link] = &cacheEntry{preview: preview, err: err, expires: time.Now().Add(ttl)}
+	u.mu.Unlock()
+
+	return preview, err
+}
+
+// Image fetches the preview image of a link, returning it with its content type
+func (u *Unfurler) Image(Link string) ([]byte, string, error) {
+	preview, err := u.Unfurl(Link)
+	if err != nil {
+		return nil, "", err
+	}
+	if preview.Image == "" {
+		return nil, "", ErrNoImage
+	}
+
+	// svg is left out as it can carry script
+	image, contentType, _, err := u.fetch(preview.Image, "image/*", maxImageBytes, func(mediaType string) bool {
+		return strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml"
+	})
+
+	return image, contentType, err
+}
+
+// evict drops the expired previews, or all of them when none have expired, expects the lock held
+func (u *Unfurler) evict() {
+	now := time.Now()
+	for link, entry := range u.cache {
+		if now.After(entry.expires) {
+			delete(u.cache, link)
+		}
+	}
+	if len(u.cache) >= maxCacheEntries {
+		u.cache = make(map[string]*cacheEntry)
+	}
+}
+
+// checkAddress is the dialers control func refusing connections to blocked addresses
+func (u *Unfurler) checkAddress(network string, address string, _ syscall.RawConn) error {
+	return checkAddress(u.allowed, address)
+}
+
+// checkAddress refuses dialing an address whose ip isn't allowed
+func checkAddress(allowed func(ip net.IP) bool, address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !allowed(ip) {
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
+
+// checkLink allows absolute http(s) urls without credentials
+func checkLink(link *url.URL) error {
+	if (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" || link.User != nil {
+		return ErrInvalidLink
+	}
+
+	return nil
+}
+
+// fetch gets the link when its content type is accepted, returning the body, media type and the url after redirects
+func (u *Unfurler) fetch(Link string, accept string, maxBytes int64, accepted func(mediaType string) bool) ([]byte, string, *url.URL, error) {
+	link, err := url.Parse(Link)
+	if err != nil || checkLink(link) != nil {
+		return nil, "", nil, ErrInvalidLink
+	}
+
+	req, err := http.NewRequest(http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, "", nil, ErrInvalidLink
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "Thunderdome link preview")
+
+	resp, err := u.http.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return nil, "", nil, ErrBlockedAddress
+		}
+		return nil, "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, "", nil, fmt.Errorf("link responded %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !accepted(mediaType) {
+		return nil, "", nil, ErrUnsupportedContent
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return body, mediaType, resp.Request.URL, nil
+}
+
+// fetchPreview fetches the link and reads its preview from the page head
+func (u *Unfurler) fetchPreview(Link string) (*Preview, error) {
+	body, _, finalURL, err := u.fetch(Link, "text/html", maxPageBytes, func(mediaType string) bool {
+		return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	preview := parsePreview(bytes.NewReader(body))
+	preview.URL = finalURL.String()
+	if preview.Image != "" {
+		image, err := finalURL.Parse(preview.Image)
+		if err != nil || checkLink(image) != nil {
+			preview.Image = ""
+		} else {
+			preview.Image = image.String()
+		}
+	}
+
+	return preview, nil
+}
+
+// parsePreview reads the open graph and twitter card meta tags falling back to the title and description,
+// stopping at the body
+func parsePreview(r io.Reader) *Preview {
+	meta := make(map[string]string)
+	var title string
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		token := z.Token()
+		if tt == html.TextToken && inTitle && title == "" {
+			title = token.Data
+			continue
+		}
+		if tt == html.EndTagToken && token.Data == "title" {
+			inTitle = false
+			continue
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		if token.Data == "body" {
+			break
+		}
+		if token.Data == "title" {
+			inTitle = true
+			continue
+		}
+		if token.Data != "meta" {
+			continue
+		}
+
+		var name, content string
+		for _, attr := range token.Attr {
+			switch attr.Key {
+			case "property", "name":
+				name = strings.ToLower(attr.Val)
+			case "content":
+				content = attr.Val
+			}
+		}
+		if _, seen := meta[name]; name != "" && !seen {
+			meta[name] = content
+		}
+	}
+
+	return &Preview{
+		Title:       clean(first(meta["og:title"], meta["twitter:title"], title), 300),
+		Description: clean(first(meta["og:description"], meta["twitter:description"], meta["description"]), 1000),
+		Image:       strings.TrimSpace(first(meta["og:image"], meta["og:image:url"], meta["twitter:image"])),
+		SiteName:    clean(meta["og:site_name"], 100),
+	}
+}
+
+// first gets the first non blank value
+func first(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// clean collapses the whitespace of the text and cuts it to length runes
+func clean(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "")
+	}
+	if utf8.RuneCountInString(text) > length {
+		text = string([]rune(text)[:length])
+	}
+
+	return text
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic("unfurl: invalid network " + cidr)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
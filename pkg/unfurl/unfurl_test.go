@@ -0,0 +1,100 @@
+package unfurl
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testUnfurler(handler http.HandlerFunc) (*Unfurler, *httptest.Server) {
+	srv := httptest.NewServer(handler)
+	u := New(time.Hour)
+	u.allowed = func(ip net.IP) bool { return true }
+
+	return u, srv
+}
+
+func TestUnfurl(t *testing.T) {
+	requests := 0
+	u, srv := testUnfurler(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>ENG-1 fallback</title>
+			<meta property="og:title" content=" ENG-1:  Login ">
+			<meta name="description" content="Let warriors log in">
+			<meta property="og:image" content="/logo.png">
+			</head><body><meta property="og:site_name" content="ignored"></body></html>`))
+	})
+	defer srv.Close()
+
+	preview, err := u.Unfurl(srv.URL + "/browse/ENG-1")
+	if err != nil {
+		t.Fatal("Unexpected error ", err)
+	}
+	if preview.Title != "ENG-1: Login" || preview.Description != "Let warriors log in" || preview.Image != srv.URL+"/logo.png" || preview.SiteName != "" {
+		t.Error("Unexpected preview ", preview)
+	}
+
+	u.Unfurl(srv.URL + "/browse/ENG-1")
+	if requests != 1 {
+		t.Error("Expected the second unfurl to be cached got requests ", requests)
+	}
+}
+
+func TestUnfurlBlocksPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request to a loopback address")
+	}))
+	defer srv.Close()
+
+	if _, err := New(time.Hour).Unfurl(srv.URL); err != ErrBlockedAddress {
+		t.Error("Expected ErrBlockedAddress got ", err)
+	}
+	if _, err := New(time.Hour).Unfurl("file:///etc/passwd"); err != ErrInvalidLink {
+		t.Error("Expected ErrInvalidLink got ", err)
+	}
+}
+
+func TestPublicClientBlocksPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request to a loopback address")
+	}))
+	defer srv.Close()
+
+	if _, err := PublicClient(time.Second).Post(srv.URL, "application/json", nil); !errors.Is(err, ErrBlockedAddress) {
+		t.Error("Expected ErrBlockedAddress got ", err)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "169.254.169.254", "192.168.1.1", "::1", "fd00::1", "::ffff:10.0.0.1"} {
+		if PublicIP(net.ParseIP(ip)) {
+			t.Error("Expected blocked ", ip)
+		}
+	}
+	for _, ip := range []string{"8.8.8.8", "2606:4700:4700::1111"} {
+		if !PublicIP(net.ParseIP(ip)) {
+			t.Error("Expected allowed ", ip)
+		}
+	}
+}
+
+func TestImageRejectsSVG(t *testing.T) {
+	u, srv := testUnfurler(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logo.svg" {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(`<svg></svg>`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<meta property="og:image" content="/logo.svg">`))
+	})
+	defer srv.Close()
+
+	if _, _, err := u.Image(srv.URL); err != ErrUnsupportedContent {
+		t.Error("Expected ErrUnsupportedContent got ", err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// maxPlanImportRows is the most plans a single import previews
+const maxPlanImportRows = 1000
+
+// the warnings a previewed plan can have, codes the frontend translates
+const (
+	// planImportNameMissing plans can't be imported, they aren't selected
+	planImportNameMissing = "name_missing"
+	// planImportNameTruncated plans have names longer than plans can have, they're cut
+	planImportNameTruncated = "name_truncated"
+	// planImportInvalidLink plans have a link that isn't an http(s) URL
+	planImportInvalidLink = "invalid_link"
+)
+
+// planImportRow is a plan of an import as it would be added to the battle
+type planImportRow struct {
+	Line int            `json:"line"`
+	Plan *database.Plan `json:"plan"`
+	// Duplicate is the name of the battle's plan or the earlier row the plan has the reference id or name of
+	Duplicate string   `json:"duplicate,omitempty"`
+	Warnings  []string `json:"warnings"`
+	// Selected is whether the plan is worth importing, those without a name or duplicating another aren't
+	Selected bool `json:"selected"`
+}
+
+// normalizedPlanName is the plan name as compared when looking for duplicates
+func normalizedPlanName(Name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(Name), " "))
+}
+
+// duplicatePlan finds the plan with the reference id, or the name when there's no reference id to go by
+func duplicatePlan(Plans []*database.Plan, Name string, ReferenceID string) *database.Plan {
+	ReferenceID = strings.TrimSpace(ReferenceID)
+	Name = normalizedPlanName(Name)
+	for _, p := range Plans {
+		if ReferenceID != "" && strings.EqualFold(strings.TrimSpace(p.ReferenceID), ReferenceID) {
+			return p
+		}
+		if ReferenceID == "" && Name != "" && normalizedPlanName(p.PlanName) == Name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// previewPlanImport checks the plans to import against the battle's existing plans and each other
+func previewPlanImport(Existing []*database.Plan, Plans []*database.Plan) []*planImportRow {
+	rows := make([]*planImportRow, 0, len(Plans))
+	seen := make([]*database.Plan, 0, len(Plans))
+	for i, p := range Plans {
+		row := &planImportRow{Line: i + 1, Plan: p, Warnings: make([]string, 0), Selected: true}
+		rows = append(rows, row)
+
+		p.PlanName = sanitizeName(p.PlanName)
+		if p.PlanName == "" {
+			row.Warnings = append(row.Warnings, planImportNameMissing)
+			row.Selected = false
+			continue
+		}
+		if len([]rune(p.PlanName)) > maxPlanNameLength {
+			p.PlanName = truncateRunes(p.PlanName, maxPlanNameLength)
+			row.Warnings = append(row.Warnings, planImportNameTruncated)
+		}
+		if p.Link != "" {
+			if link, err := url.Parse(p.Link); err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+				row.Warnings = append(row.Warnings, planImportInvalidLink)
+			}
+		}
+
+		if d := duplicatePlan(Existing, p.PlanName, p.ReferenceID); d != nil {
+			row.Duplicate = d.PlanName
+		} else if d := duplicatePlan(seen, p.PlanName, p.ReferenceID); d != nil {
+			row.Duplicate = d.PlanName
+		}
+		row.Selected = row.Duplicate == ""
+		seen = append(seen, p)
+	}
+
+	return rows
+}
+
+// parsePlanImport reads the plans from a CSV with a header row naming the columns, in any order and case,
+// the plan export's columns being understood so exported plans can be brought into another battle
+func parsePlanImport(r io.Reader) ([]*database.Plan, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("missing header row")
+	}
+	aliases := map[string]string{
+		"plan":                "name",
+		"name":                "name",
+		"summary":             "name",
+		"type":                "type",
+		"issue type":          "type",
+		"reference id":        "referenceId",
+		"key":                 "referenceId",
+		"issue key":           "referenceId",
+		"link":                "link",
+		"url":                 "link",
+		"description":         "description",
+		"acceptance criteria": "acceptanceCriteria",
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		if name, ok := aliases[strings.ToLower(strings.TrimSpace(column))]; ok {
+			if _, taken := columns[name]; !taken {
+				columns[name] = i
+			}
+		}
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("header row needs a plan or name column")
+	}
+
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var plans = make([]*database.Plan, 0)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		plan := &database.Plan{
+			PlanName:           field(record, "name"),
+			Type:               field(record, "type"),
+			ReferenceID:        field(record, "referenceId"),
+			Link:               field(record, "link"),
+			Description:        field(record, "description"),
+			AcceptanceCriteria: field(record, "acceptanceCriteria"),
+		}
+		if plan.PlanName == "" && plan.ReferenceID == "" {
+			continue
+		}
+		if len(plans) == maxPlanImportRows {
+			return nil, errors.New("too many rows")
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// handleBattlePlanImportPreview handles the leader previewing plans before adding them, like those of a Jira XML
+// export read by the browser or a CSV, getting each with any duplicate and warnings to deselect those not wanted
+func (s *server) handleBattlePlanImportPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		BattleID := vars["id"]
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+		var preview struct {
+			Plans []struct {
+				PlanName           string `json:"planName"`
+				Type               string `json:"type"`
+				ReferenceID        string `json:"referenceId"`
+				Link               string `json:"link"`
+				Description        string `json:"description"`
+				AcceptanceCriteria string `json:"acceptanceCriteria"`
+			} `json:"plans"`
+			CSV string `json:"csv"`
+		}
+		body, _ := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 5<<20)) // check for errors
+		if err := json.Unmarshal(body, &preview); err != nil || len(preview.Plans) > maxPlanImportRows {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.database.ConfirmLeader(BattleID, warriorID); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		Plans := make([]*database.Plan, 0, len(preview.Plans))
+		if preview.CSV != "" {
+			var err error
+			if Plans, err = parsePlanImport(strings.NewReader(preview.CSV)); err != nil {
+				RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		for _, p := range preview.Plans {
+			Plans = append(Plans, &database.Plan{
+				PlanName:           p.PlanName,
+				Type:               p.Type,
+				ReferenceID:        p.ReferenceID,
+				Link:               p.Link,
+				Description:        p.Description,
+				AcceptanceCriteria: p.AcceptanceCriteria,
+			})
+		}
+
+		RespondWithJSON(w, http.StatusOK, previewPlanImport(s.database.GetPlans(BattleID, warriorID), Plans))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/issues"
+	"github.com/gorilla/mux"
+)
+
+func TestPreviewPlanImport(t *testing.T) {
+	existing := []*database.Plan{
+		{PlanID: "p1", PlanName: "Login page", ReferenceID: "ENG-1"},
+		{PlanID: "p2", PlanName: "Logout  button"},
+	}
+	plans := []*database.Plan{
+		{PlanName: "Sign in", ReferenceID: "eng-1"},
+		{PlanName: "logout button"},
+		{PlanName: "Search", ReferenceID: "ENG-3", Link: "javascript:alert(1)"},
+		{PlanName: "Search again", ReferenceID: "ENG-3"},
+		{PlanName: "  "},
+		{PlanName: strings.Repeat("a", maxPlanNameLength+1)},
+	}
+
+	rows := previewPlanImport(existing, plans)
+	tests := []struct {
+		duplicate string
+		warnings  string
+		selected  bool
+	}{
+		{"Login page", "", false},
+		{"Logout  button", "", false},
+		{"", planImportInvalidLink, true},
+		{"Search", "", false},
+		{"", planImportNameMissing, false},
+		{"", planImportNameTruncated, true},
+	}
+	for i, tt := range tests {
+		row := rows[i]
+		if row.Line != i+1 || row.Duplicate != tt.duplicate || strings.Join(row.Warnings, ",") != tt.warnings || row.Selected != tt.selected {
+			t.Error("Unexpected preview of line ", i+1, " ", row.Duplicate, row.Warnings, row.Selected)
+		}
+	}
+	if len([]rune(rows[5].Plan.PlanName)) != maxPlanNameLength {
+		t.Error("Expected the name to be truncated")
+	}
+}
+
+func TestParsePlanImport(t *testing.T) {
+	data := "Issue Key,Summary,Link\nENG-1,\"Login, with comma\",https://example.com/ENG-1\n,,\nENG-2,,\n"
+	plans, err := parsePlanImport(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans) != 2 || plans[0].PlanName != "Login, with comma" || plans[0].ReferenceID != "ENG-1" ||
+		plans[0].Link != "https://example.com/ENG-1" || plans[1].ReferenceID != "ENG-2" {
+		t.Error("Unexpected plans ", plans)
+	}
+
+	// the plan export can be imported again
+	export, _ := battlePlansCSV([]*database.Plan{{PlanName: "Login", Type: "Story", ReferenceID: "ENG-1"}}, "w1", time.UTC)
+	plans, err = parsePlanImport(strings.NewReader(string(export)))
+	if err != nil || len(plans) != 1 || plans[0].PlanName != "Login" || plans[0].Type != "Story" || plans[0].ReferenceID != "ENG-1" {
+		t.Error("Expected the exported plans to be imported got ", plans, err)
+	}
+
+	if _, err := parsePlanImport(strings.NewReader("Email,Role\n")); err == nil {
+		t.Error("Expected a header without a name column to be refused")
+	}
+}
+
+// importPreviewMock has the plans the battle already has
+type importPreviewMock struct {
+	*database.Mock
+}
+
+func (m *importPreviewMock) GetPlans(BattleID string, WarriorID string) []*database.Plan {
+	return []*database.Plan{{PlanID: "p1", PlanName: "Login", ReferenceID: "ENG-1"}}
+}
+
+func TestHandleBattlePlanImportPreview(t *testing.T) {
+	s, db := newMockServer()
+	s.database = &importPreviewMock{Mock: db}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/battle/{id}/plans/import-preview", s.warriorOnly(s.handleBattlePlanImportPreview()))
+
+	tests := []struct {
+		body   string
+		apiKey string
+		status int
+		rows   int
+	}{
+		{`{"plans": [{"planName": "Sign in", "referenceId": "ENG-1"}, {"planName": "Search"}]}`, "key1", http.StatusOK, 2},
+		{`{"csv": "Summary,Key\nSearch,ENG-2\n"}`, "key1", http.StatusOK, 1},
+		{`{"csv": "Key\nENG-2\n"}`, "key1", http.StatusBadRequest, 0},
+		{`{"plans": [{"planName": "Search"}]}`, "admin1", http.StatusForbidden, 0},
+		{`not json`, "key1", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/battle/b1/plans/import-preview", strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, tt.apiKey)
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var rows []*planImportRow
+		json.NewDecoder(w.Body).Decode(&rows)
+		if len(rows) != tt.rows {
+			t.Error("Expected ", tt.rows, " rows got ", len(rows))
+		}
+		if tt.rows == 2 && (rows[0].Duplicate != "Login" || rows[0].Selected || !rows[1].Selected) {
+			t.Error("Expected the first plan to duplicate the battle's got ", rows[0], rows[1])
+		}
+	}
+}
+
+func TestIssuePlans(t *testing.T) {
+	plans := issuePlans([]*issues.Issue{
+		{Key: "ENG-1", Title: "  Login\u200b  form\n"},
+		{Key: "ENG-2", Title: strings.Repeat("é", maxPlanNameLength+10)},
+	})
+
+	if plans[0].PlanName != "Login form" {
+		t.Error("Expected the issue title cleaned like plan names got ", plans[0].PlanName)
+	}
+	if len([]rune(plans[1].PlanName)) != maxPlanNameLength {
+		t.Error("Expected a long issue title cut to fit got ", len([]rune(plans[1].PlanName)))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// linkPreviewTTL is how long plan link previews are cached for
+const linkPreviewTTL = time.Hour
+
+// planLink gets the link of the battle plan in the request, when the warrior is in the battle
+func (s *server) planLink(r *http.Request) (string, bool) {
+	vars := mux.Vars(r)
+	BattleID := vars["id"]
+	PlanID := vars["planId"]
+	warriorID := r.Context().Value(contextKeyWarriorID).(string)
+
+	if !s.database.IsBattleWarrior(BattleID, warriorID) {
+		return "", false
+	}
+	for _, plan := range s.database.GetPlans(BattleID, warriorID) {
+		if plan.PlanID == PlanID && plan.Link != "" {
+			return plan.Link, true
+		}
+	}
+
+	return "", false
+}
+
+// handlePlanLinkPreview gets the title, description and image of a plans link,
+// the image is pointed at the image proxy so viewing it doesn't reach the linked site
+func (s *server) handlePlanLinkPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Link, ok := s.planLink(r)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		preview, err := s.unfurler.Unfurl(Link)
+		if err != nil {
+			log.Println("error unfurling plan link : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		// copied as the cached preview is shared
+		Preview := *preview
+		if Preview.Image != "" {
+			Preview.Image = r.URL.Path + "/image"
+		}
+
+		RespondWithJSON(w, http.StatusOK, Preview)
+	}
+}
+
+// handlePlanLinkPreviewImage proxies the preview image of a plans link
+func (s *server) handlePlanLinkPreviewImage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Link, ok := s.planLink(r)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		image, contentType, err := s.unfurler.Image(Link)
+		if err != nil {
+			log.Println("error getting plan link preview image : " + err.Error() + "\n")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(linkPreviewTTL.Seconds())))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'")
+		w.Write(image)
+	}
+}
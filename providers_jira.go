@@ -0,0 +1,7 @@
+//go:build !no_jira
+// +build !no_jira
+
+package main
+
+// the jira issue provider is compiled in unless built with the no_jira tag
+import _ "github.com/StevenWeathers/thunderdome-planning-poker/pkg/jira"
@@ -0,0 +1,7 @@
+//go:build !no_linear
+// +build !no_linear
+
+package main
+
+// the linear issue provider is compiled in unless built with the no_linear tag
+import _ "github.com/StevenWeathers/thunderdome-planning-poker/pkg/linear"
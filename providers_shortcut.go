@@ -0,0 +1,7 @@
+//go:build !no_shortcut
+// +build !no_shortcut
+
+package main
+
+// the shortcut issue provider is compiled in unless built with the no_shortcut tag
+import _ "github.com/StevenWeathers/thunderdome-planning-poker/pkg/shortcut"
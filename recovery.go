@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// reportPanic logs a recovered panic with its stack and reports it when error reporting is configured,
+// reporting happens in the background so the request or socket isn't held up by it
+func (s *server) reportPanic(p interface{}, Tags map[string]string) {
+	stack := string(debug.Stack())
+	msg := fmt.Sprintf("panic: %v", p)
+	log.Printf("%s %v\n%s", msg, Tags, stack)
+
+	if s.sentry == nil {
+		return
+	}
+	go func() {
+		if err := s.sentry.Report(msg, stack, Tags); err != nil {
+			log.Println("unable to report panic : " + err.Error())
+		}
+	}()
+}
+
+// recoverPanics responds 500 to requests whose handler panics rather than the panic taking the server down
+func (s *server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// ErrAbortHandler is how handlers deliberately abort a response, the http server expects it back
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			Tags := map[string]string{"method": r.Method, "route": auditRoute(r)}
+			if entry, ok := r.Context().Value(contextKeyAccessLog).(*accessEntry); ok && entry.WarriorID != "" {
+				Tags["warriorId"] = entry.WarriorID
+			}
+			s.reportPanic(p, Tags)
+
+			RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
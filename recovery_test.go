@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	s := &server{}
+	router := mux.NewRouter()
+	router.Use(accessLog(false, 0, ""), s.recoverPanics)
+	router.HandleFunc("/api/battle/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var plans []string
+		_ = plans[1]
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/battle/b1", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Error("Expected a panicking handler to respond 500 got ", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"error"`) || w.Header().Get("Content-Type") != "application/json" {
+		t.Error("Expected a JSON error got ", w.Body.String())
+	}
+}
+
+func TestRecoverPanicsAbort(t *testing.T) {
+	s := &server{}
+	handler := s.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Error("Expected an aborted handler to be left to the http server got ", p)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
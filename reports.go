@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/email"
+)
+
+const (
+	// Maximum announcement emails sent per transaction
+	emailBroadcastBatchSize = 100
+
+	// Announcements that failed this many times for a warrior aren't sent to them
+	emailBroadcastMaxAttempts = 3
+)
+
+// sendUsageReport emails every admin a summary of the previous months usage
+func (s *server) sendUsageReport() error {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, now.Location())
+	to := from.AddDate(0, 1, 0)
+
+	report, err := s.database.GetUsageReport(from, to)
+	if err != nil {
+		return err
+	}
+
+	usage := []email.ReportRow{
+		{Label: "New registered warriors", Value: strconv.Itoa(report.NewRegistered)},
+		{Label: "New guest warriors", Value: strconv.Itoa(report.NewUnregistered)},
+		{Label: "Battles run", Value: strconv.Itoa(report.BattlesRun)},
+		{Label: "Plans added", Value: strconv.Itoa(report.PlansAdded)},
+		{Label: "Database size", Value: formatBytes(report.DatabaseSize)},
+		{Label: "Database growth", Value: formatBytes(report.DatabaseGrowth)},
+	}
+	teams := make([]email.ReportRow, 0)
+	for _, team := range report.MostActiveTeams {
+		teams = append(teams, email.ReportRow{Label: team.TeamName, Value: strconv.Itoa(team.BattleCount)})
+	}
+
+	period := from.Format("January 2006")
+	for _, admin := range s.database.GetAdminWarriors() {
+		// one admin's mailbox failing shouldn't keep the others from their report
+		_ = s.email.SendUsageReport(admin.WarriorName, admin.WarriorEmail, period, usage, teams)
+	}
+
+	return nil
+}
+
+// sendEmailBroadcasts emails queued admin announcements, draining full batches so a large instance isn't
+// left waiting a minute per batch
+func (s *server) sendEmailBroadcasts() error {
+	for {
+		sent, err := s.database.ProcessEmailBroadcasts(emailBroadcastBatchSize, emailBroadcastMaxAttempts, func(e *database.BroadcastEmail) error {
+			return s.email.SendAnnouncement(e.WarriorName, e.WarriorEmail, e.Subject, e.Body)
+		})
+		if err != nil {
+			return err
+		}
+		if sent < emailBroadcastBatchSize {
+			return nil
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	"net/http"
 
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
 	"github.com/spf13/viper"
 )
 
@@ -27,37 +28,219 @@ func (s *server) routes() {
 		s.router.PathPrefix("/avatar/{width}/{id}/{avatar}").Handler(s.handleWarriorAvatar()).Methods("GET")
 		s.router.PathPrefix("/avatar/{width}/{id}").Handler(s.handleWarriorAvatar()).Methods("GET")
 	}
+	if s.avatars != nil {
+		s.router.PathPrefix("/avatar/{width}/{id}").Handler(rateLimited(s.avatarThrottle, s.handleWarriorAvatarProxy())).Methods("GET")
+	}
 	// api (currently internal to UI application)
 	// warrior authentication, profile
 	if viper.GetString("auth.method") == "ldap" {
-		s.router.HandleFunc("/api/auth", s.handleLdapLogin()).Methods("POST")
+		s.router.HandleFunc("/api/auth", s.throttled(s.handleLdapLogin())).Methods("POST")
+	} else if viper.GetString("auth.method") == "oidc" {
+		s.router.HandleFunc("/api/auth/oidc", s.handleOidcLogin()).Methods("GET")
+		s.router.HandleFunc("/api/auth/oidc/callback", s.handleOidcCallback()).Methods("GET")
+	} else if viper.GetString("auth.method") == "header" {
+		s.router.HandleFunc("/api/auth/header", s.handleHeaderLogin()).Methods("GET")
 	} else {
-		s.router.HandleFunc("/api/auth", s.handleLogin()).Methods("POST")
-		s.router.HandleFunc("/api/auth/forgot-password", s.handleForgotPassword()).Methods("POST")
-		s.router.HandleFunc("/api/auth/reset-password", s.handleResetPassword()).Methods("POST")
+		s.router.HandleFunc("/api/auth", s.throttled(s.handleLogin())).Methods("POST")
+		s.router.HandleFunc("/api/auth/forgot-password", s.throttled(s.handleForgotPassword())).Methods("POST")
+		s.router.HandleFunc("/api/auth/reset-password", s.throttled(s.handleResetPassword())).Methods("POST")
 		s.router.HandleFunc("/api/auth/update-password", s.warriorOnly(s.handleUpdatePassword())).Methods("POST")
 		s.router.HandleFunc("/api/auth/verify", s.handleAccountVerification()).Methods("POST")
-		s.router.HandleFunc("/api/enlist", s.handleWarriorEnlist()).Methods("POST")
+		s.router.HandleFunc("/api/enlist", s.throttled(s.handleWarriorEnlist())).Methods("POST")
 	}
-	s.router.HandleFunc("/api/warrior", s.handleWarriorRecruit()).Methods("POST")
+	s.router.HandleFunc("/api/warrior", s.throttled(s.handleWarriorRecruit())).Methods("POST")
 	s.router.HandleFunc("/api/auth/logout", s.handleLogout()).Methods("POST")
 	s.router.HandleFunc("/api/warrior/{id}/apikey/{keyID}", s.warriorOnly(s.handleWarriorAPIKeyUpdate())).Methods("PUT")
 	s.router.HandleFunc("/api/warrior/{id}/apikey/{keyID}", s.warriorOnly(s.handleWarriorAPIKeyDelete())).Methods("DELETE")
 	s.router.HandleFunc("/api/warrior/{id}/apikey", s.warriorOnly(s.handleAPIKeyGenerate())).Methods("POST")
 	s.router.HandleFunc("/api/warrior/{id}/apikeys", s.warriorOnly(s.handleWarriorAPIKeys())).Methods("GET")
+	s.router.HandleFunc("/api/warrior/{id}/apikeys/requests", s.warriorOnly(s.handleWarriorAPIKeyRequests())).Methods("GET")
+	s.router.HandleFunc("/api/warrior/{id}/sessions", s.warriorOnly(s.handleWarriorSessionsGet())).Methods("GET")
+	s.router.HandleFunc("/api/warrior/{id}/sessions/{sessionId}", s.warriorOnly(s.handleWarriorSessionDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/warrior/{id}/permissions", s.warriorOnly(s.handleWarriorPermissionsGet())).Methods("GET")
+	s.router.HandleFunc("/api/warrior/{id}/notifications", s.warriorOnly(s.handleNotificationPreferencesGet())).Methods("GET")
+	s.router.HandleFunc("/api/warrior/{id}/notifications", s.warriorOnly(s.handleNotificationPreferencesUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/warrior/{id}/stats", s.warriorOnly(s.handleWarriorStatsGet())).Methods("GET")
+	s.router.HandleFunc("/api/warrior/{id}/absences", s.warriorOnly(s.handleWarriorAbsencesGet())).Methods("GET")
+	s.router.HandleFunc("/api/warrior/{id}/absences", s.warriorOnly(s.handleWarriorAbsenceAdd())).Methods("POST")
+	s.router.HandleFunc("/api/warrior/{id}/absences/{absenceId}", s.warriorOnly(s.handleWarriorAbsenceDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/warrior/{id}/battles/export", s.signedOnly(s.handleWarriorBattlesExport())).Methods("GET").Queries("signature", "{signature}")
+	s.router.HandleFunc("/api/warrior/{id}/battles/export", s.warriorOnly(s.handleWarriorBattlesExport())).Methods("GET")
+	s.router.HandleFunc("/api/warrior/{id}/battles/export/link", s.warriorOnly(s.handleWarriorBattlesExportLink())).Methods("POST")
 	s.router.HandleFunc("/api/warrior/{id}", s.warriorOnly(s.handleWarriorProfile())).Methods("GET")
 	s.router.HandleFunc("/api/warrior/{id}", s.warriorOnly(s.handleWarriorProfileUpdate())).Methods("POST")
 	// battle(s)
-	s.router.HandleFunc("/api/battle", s.warriorOnly(s.handleBattleCreate())).Methods("POST")
+	s.router.HandleFunc("/api/battle", s.permissionOnly(database.PermissionCreateBattles, s.handleBattleCreate())).Methods("POST")
 	s.router.HandleFunc("/api/battles", s.warriorOnly(s.handleBattlesGet()))
+	s.router.HandleFunc("/api/templates", s.handleBattleTemplatesGet()).Methods("GET")
+	s.router.HandleFunc("/api/config", s.handleAppConfig()).Methods("GET")
+	s.router.HandleFunc("/api/defaults", s.warriorOnly(s.handleBattleDefaultsGet())).Methods("GET")
+	s.router.HandleFunc("/api/battles/import", s.permissionOnly(database.PermissionCreateBattles, s.handleBattleImport())).Methods("POST")
+	s.router.HandleFunc("/api/battle/{id}/star", s.warriorOnly(s.handleBattleStar())).Methods("PUT", "DELETE")
+	s.router.HandleFunc("/api/battle/{id}/bots", s.warriorOnly(s.handleBattleBotsGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/bot", s.warriorOnly(s.handleBattleBotCreate())).Methods("POST")
+	s.router.HandleFunc("/api/battle/{id}/bot/{botId}", s.warriorOnly(s.handleBattleBotDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/battle/{id}/plan/{planId}", s.warriorOnly(s.handleBattlePlanRevise())).Methods("PUT")
+	s.router.HandleFunc("/api/battle/{id}/plan/{planId}/points", s.warriorOnly(s.handleBattlePlanPointsUpdate())).Methods("PATCH")
+	s.router.HandleFunc("/api/battle/{id}/plan/{planId}/park", s.warriorOnly(s.handleBattlePlanPark())).Methods("POST")
+	s.router.HandleFunc("/api/battle/{id}/plan/{planId}/translation/{locale}", s.warriorOnly(s.handleBattlePlanTranslationUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/battle/{id}/plan/{planId}/translation/{locale}", s.warriorOnly(s.handleBattlePlanTranslationDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/battle/{id}/plans/import-preview", s.warriorOnly(s.handleBattlePlanImportPreview())).Methods("POST")
+	s.router.HandleFunc("/api/battle/{id}/import/{provider}", s.warriorOnly(s.handleBattleIssueImport())).Methods("POST")
+	s.router.HandleFunc("/api/battle/{id}/issue-conflicts", s.warriorOnly(s.handleBattleIssueConflictsGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/plan/{planId}/issue-conflict/{field}", s.warriorOnly(s.handleBattleIssueConflictResolve())).Methods("PUT")
+	s.router.HandleFunc("/api/battle/{id}/plans", s.warriorOnly(s.handleBattlePlansGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/state", s.warriorOnly(s.handleBattleStateGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/export", s.warriorOnly(s.handleBattleExport())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/heatmap", s.warriorOnly(s.handleBattleHeatmapGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/feedback", s.warriorOnly(s.handleBattleFeedbackSubmit())).Methods("POST")
+	if s.unfurler != nil {
+		s.router.HandleFunc("/api/battle/{id}/plans/{planId}/preview", s.warriorOnly(s.handlePlanLinkPreview())).Methods("GET")
+		s.router.HandleFunc("/api/battle/{id}/plans/{planId}/preview/image", s.warriorOnly(s.handlePlanLinkPreviewImage())).Methods("GET")
+	}
+	if s.storage != nil {
+		s.router.HandleFunc("/api/battle/{id}/plan/{planId}/attachments", s.warriorOnly(s.handlePlanAttachmentsGet())).Methods("GET")
+		s.router.HandleFunc("/api/battle/{id}/plan/{planId}/attachments", s.warriorOnly(s.handlePlanAttachmentUpload())).Methods("POST")
+		s.router.HandleFunc("/api/battle/{id}/attachments/{attachmentId}", s.warriorOnly(s.handlePlanAttachmentGet())).Methods("GET")
+		s.router.HandleFunc("/api/battle/{id}/attachments/{attachmentId}", s.warriorOnly(s.handlePlanAttachmentDelete())).Methods("DELETE")
+		s.router.HandleFunc("/api/battle/{id}/attachments/{attachmentId}/thumbnail/{width}", s.warriorOnly(s.handlePlanAttachmentThumbnail())).Methods("GET")
+	}
+	s.router.HandleFunc("/api/battle/{id}/qr", s.warriorOnly(s.handleBattleQRCode())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/recording", s.warriorOnly(s.handleBattleRecordingGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/history", s.warriorOnly(s.handleBattleHistoryGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/email-code", s.warriorOnly(s.handleBattleEmailCodeGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/email-code", s.warriorOnly(s.handleBattleEmailCodeCreate())).Methods("POST")
+	s.router.HandleFunc("/api/battle/{id}/email-code", s.warriorOnly(s.handleBattleEmailCodeDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/battle/{id}/sms-voters", s.warriorOnly(s.handleBattleSMSVotersGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/sms-voters", s.warriorOnly(s.handleBattleSMSVoterAdd())).Methods("POST")
+	s.router.HandleFunc("/api/battle/{id}/sms-voter/{warriorId}", s.warriorOnly(s.handleBattleSMSVoterRemove())).Methods("DELETE")
+	s.router.HandleFunc("/api/battle/{id}/action-items", s.warriorOnly(s.handleBattleActionItemsGet())).Methods("GET")
+	s.router.HandleFunc("/api/battle/{id}/action-items", s.warriorOnly(s.handleBattleActionItemAdd())).Methods("POST")
+	s.router.HandleFunc("/api/battle/{id}/action-item/{itemId}", s.warriorOnly(s.handleBattleActionItemUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/battle/{id}/action-item/{itemId}", s.warriorOnly(s.handleBattleActionItemDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/inbound-email", s.handleInboundEmail()).Methods("POST")
+	s.router.HandleFunc("/api/sms/twilio", s.handleTwilioSMS()).Methods("POST")
+	// team(s)
+	s.router.HandleFunc("/api/teams", s.warriorOnly(s.handleTeamsGet())).Methods("GET")
+	s.router.HandleFunc("/api/teams", s.permissionOnly(database.PermissionManageTeams, s.handleTeamCreate())).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}", s.teamOnly(s.handleTeamGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}", s.teamAdminOnly(s.handleTeamDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/warriors", s.teamAdminOnly(s.handleTeamWarriorAdd())).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/invite", s.teamAdminOnly(s.handleTeamInvite())).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/join", s.warriorOnly(s.signedOnly(s.handleTeamJoin()))).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/warrior/{warriorId}", s.teamAdminOnly(s.handleTeamWarriorRemove())).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/checklist", s.teamOnly(s.handleTeamChecklistGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/checklist", s.teamAdminOnly(s.handleTeamChecklistItemAdd())).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/checklist/{itemId}", s.teamAdminOnly(s.handleTeamChecklistItemDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/schedules", s.teamOnly(s.handleTeamBattleSchedulesGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/schedules", s.teamAdminOnly(s.handleTeamBattleScheduleCreate())).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/schedules/{scheduleId}", s.teamAdminOnly(s.handleTeamBattleScheduleDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/schedules/feed", s.teamOnly(s.handleTeamCalendarFeedLink())).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/calendar.ics", s.signedOnly(s.handleTeamCalendarFeed())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/parking-lot", s.teamOnly(s.handleTeamParkedPlansGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/parking-lot", s.teamOnly(s.handleTeamParkedPlanAdd())).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/parking-lot/pull", s.teamOnly(s.handleTeamParkedPlansPull())).Methods("POST")
+	s.router.HandleFunc("/api/team/{teamId}/parking-lot/{planId}", s.teamOnly(s.handleTeamParkedPlanDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/confluence", s.teamAdminOnly(s.handleTeamConfluenceGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/confluence", s.teamAdminOnly(s.handleTeamConfluenceUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/confluence", s.teamAdminOnly(s.handleTeamConfluenceDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/calendar", s.teamAdminOnly(s.handleTeamCalendarGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/calendar", s.teamAdminOnly(s.handleTeamCalendarDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/calendar/{provider}", s.teamAdminOnly(s.handleTeamCalendarConnect())).Methods("POST")
+	s.router.HandleFunc("/api/calendar/{provider}/callback", s.handleCalendarCallback()).Methods("GET")
+	s.router.HandleFunc("/api/calendar/slots/{scheduleId}/join", s.signedOnly(s.handleCalendarSlotJoin())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/issue-providers", s.teamOnly(s.handleTeamIssueProvidersGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/{provider}", s.teamAdminOnly(s.handleTeamIssueProviderGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/{provider}", s.teamAdminOnly(s.handleTeamIssueProviderUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/{provider}", s.teamAdminOnly(s.handleTeamIssueProviderDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/team/{teamId}/integrations/jira/webhook", s.teamAdminOnly(s.handleTeamJiraWebhookGet())).Methods("GET")
+	s.router.HandleFunc("/api/team/{teamId}/webhooks/jira", s.handleJiraWebhook()).Methods("POST")
+	// department(s)
+	s.router.HandleFunc("/api/departments", s.warriorOnly(s.handleDepartmentsGet())).Methods("GET")
+	s.router.HandleFunc("/api/department/{departmentId}", s.departmentOnly(s.handleDepartmentGet())).Methods("GET")
+	s.router.HandleFunc("/api/department/{departmentId}/warriors", s.departmentAdminOnly(s.handleDepartmentWarriorAdd())).Methods("POST")
+	s.router.HandleFunc("/api/department/{departmentId}/warrior/{warriorId}", s.departmentAdminOnly(s.handleDepartmentWarriorRemove())).Methods("DELETE")
+	s.router.HandleFunc("/api/department/{departmentId}/battles", s.departmentAdminOnly(s.handleDepartmentBattlesGet())).Methods("GET")
+	s.router.HandleFunc("/api/department/{departmentId}/battle/{battleId}", s.departmentAdminOnly(s.handleDepartmentBattleDelete())).Methods("DELETE")
+	// rest hooks
+	s.router.HandleFunc("/api/hooks/me", s.warriorOnly(s.handleHookMe())).Methods("GET")
+	s.router.HandleFunc("/api/hooks", s.warriorOnly(s.handleHookSubscribe())).Methods("POST")
+	s.router.HandleFunc("/api/hooks/{hookId}", s.warriorOnly(s.handleHookUnsubscribe())).Methods("DELETE")
+	s.router.HandleFunc("/api/hooks/triggers/{event}", s.warriorOnly(s.handleHookTrigger())).Methods("GET")
 	// admin routes
-	s.router.HandleFunc("/api/admin/stats", s.adminOnly(s.handleAppStats()))
+	s.router.HandleFunc("/api/admin/stats", s.permissionOnly(database.PermissionViewAnalytics, s.handleAppStats()))
+	s.router.HandleFunc("/api/admin/feedback", s.permissionOnly(database.PermissionViewAnalytics, s.handleSessionFeedbackGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/roles", s.adminOnly(s.handleRolesGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/roles", s.adminOnly(s.handleRoleCreate())).Methods("POST")
+	s.router.HandleFunc("/api/admin/roles/{roleId}", s.adminOnly(s.handleRoleUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/roles/{roleId}", s.adminOnly(s.handleRoleDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/roles/{roleId}/assignments", s.adminOnly(s.handleRoleAssignmentsGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/roles/{roleId}/warriors/{warriorId}", s.adminOnly(s.handleRoleWarriorAssign())).Methods("PUT", "DELETE")
+	s.router.HandleFunc("/api/admin/roles/{roleId}/teams/{teamId}/{teamRole}", s.adminOnly(s.handleRoleTeamAssign())).Methods("PUT", "DELETE")
+	s.router.HandleFunc("/api/admin/departments", s.adminOnly(s.handleAdminDepartmentsGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/departments", s.adminOnly(s.handleDepartmentCreate())).Methods("POST")
+	s.router.HandleFunc("/api/admin/departments/{departmentId}", s.adminOnly(s.handleDepartmentDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/departments/{departmentId}/teams/{teamId}", s.adminOnly(s.handleDepartmentTeamAssign())).Methods("PUT", "DELETE")
+	s.router.HandleFunc("/api/admin/templates", s.adminOnly(s.handleBattleTemplateCreate())).Methods("POST")
+	s.router.HandleFunc("/api/admin/templates/{templateId}", s.adminOnly(s.handleBattleTemplateDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/defaults", s.adminOnly(s.handleBattleDefaultsUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/domains", s.adminOnly(s.handleTeamDomainsGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/domains/{teamId}", s.adminOnly(s.handleTeamDomainUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/domains/{teamId}", s.adminOnly(s.handleTeamDomainDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/version", s.adminOnly(s.handleVersionGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/license", s.adminOnly(s.handleLicenseGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/telemetry", s.adminOnly(s.handleTelemetryPreview())).Methods("GET")
+	s.router.HandleFunc("/api/admin/battles/{battleId}/snapshot", s.adminOnly(s.handleBattleSnapshotGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/jobs", s.adminOnly(s.handleJobsGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/retention", s.adminOnly(s.handleRetentionReportsGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/secrets/reencrypt", s.adminOnly(s.handleSecretsReencrypt())).Methods("POST")
+	s.router.HandleFunc("/api/admin/passwords", s.adminOnly(s.handlePasswordHashReport())).Methods("GET")
+	s.router.HandleFunc("/api/admin/email/test", s.adminOnly(s.handleEmailTest())).Methods("POST")
+	s.router.HandleFunc("/api/admin/email/deliveries", s.adminOnly(s.handleEmailDeliveriesGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/email/broadcasts", s.adminOnly(s.handleEmailBroadcastCreate())).Methods("POST")
+	s.router.HandleFunc("/api/admin/email/broadcasts", s.adminOnly(s.handleEmailBroadcastsGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/apikeys/requests", s.adminOnly(s.handleAPIKeyRequestsGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/webhooks", s.adminOnly(s.handleWebhooksGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/webhooks", s.adminOnly(s.handleWebhookCreate())).Methods("POST")
+	s.router.HandleFunc("/api/admin/webhooks/{webhookId}", s.adminOnly(s.handleWebhookUpdate())).Methods("PUT")
+	s.router.HandleFunc("/api/admin/webhooks/{webhookId}", s.adminOnly(s.handleWebhookDelete())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/warriors/inactive", s.adminOnly(s.handleInactiveWarriorsGet())).Methods("GET")
+	s.router.HandleFunc("/api/admin/warriors/search", s.adminOnly(s.handleWarriorSearch())).Methods("GET")
 	s.router.HandleFunc("/api/admin/warriors/{limit}/{offset}", s.adminOnly(s.handleGetRegisteredWarriors()))
 	s.router.HandleFunc("/api/admin/warrior", s.adminOnly(s.handleWarriorCreate())).Methods("POST")
+	s.router.HandleFunc("/api/admin/warriors/import", s.adminOnly(s.handleWarriorImport())).Methods("POST")
 	s.router.HandleFunc("/api/admin/promote", s.adminOnly(s.handleWarriorPromote())).Methods("POST")
 	s.router.HandleFunc("/api/admin/demote", s.adminOnly(s.handleWarriorDemote())).Methods("POST")
+	// federation with other instances
+	if s.federation != nil {
+		s.router.HandleFunc("/api/federation/identity", s.handleFederationIdentity()).Methods("GET")
+		s.router.HandleFunc("/api/federation/join", s.warriorOnly(s.handleFederationJoin())).Methods("GET")
+		s.router.HandleFunc("/api/federation/arrive", s.handleFederationArrive()).Methods("GET")
+		s.router.HandleFunc("/api/federation/relay", s.handleFederationRelay()).Methods("POST")
+		s.router.HandleFunc("/api/federation/arena/{peerId}/{battleId}", s.serveFederatedArena())
+		s.router.HandleFunc("/api/battle/{id}/federation", s.warriorOnly(s.handleBattleFederationsGet())).Methods("GET")
+		s.router.HandleFunc("/api/battle/{id}/federation/{peerId}", s.warriorOnly(s.handleBattleFederate())).Methods("PUT", "DELETE")
+		s.router.HandleFunc("/api/admin/federation/peers", s.adminOnly(s.handleFederationPeersGet())).Methods("GET")
+		s.router.HandleFunc("/api/admin/federation/peers", s.adminOnly(s.handleFederationPeerAdd())).Methods("POST")
+		s.router.HandleFunc("/api/admin/federation/peers/{peerId}", s.adminOnly(s.handleFederationPeerDelete())).Methods("DELETE")
+	}
 	// websocket for battle
+	s.router.HandleFunc("/api/arena/{id}/replay", s.serveReplay())
+	s.router.HandleFunc("/api/admin/live", s.adminOnly(s.serveOps()))
 	s.router.HandleFunc("/api/arena/{id}", s.serveWs())
+	// server rendered fallback views
+	s.router.HandleFunc("/lite/battle/{id}", s.handleLiteBattle()).Methods("GET")
+	s.router.HandleFunc("/lite/battle/{id}/join", s.handleLiteJoin()).Methods("POST")
+	s.router.HandleFunc("/lite/battle/{id}/vote", s.warriorOnly(s.handleLiteVote())).Methods("POST")
+	// experience, badges and leaderboards
+	if viper.GetBool("config.gamification") {
+		s.router.HandleFunc("/api/warrior/{id}/gamification", s.warriorOnly(s.handleWarriorGamificationGet())).Methods("GET")
+		s.router.HandleFunc("/api/team/{teamId}/leaderboard", s.teamOnly(s.handleTeamLeaderboardGet())).Methods("GET")
+	}
+	// runtime diagnostics
+	if viper.GetBool("config.diagnostics") {
+		s.diagnosticsRoutes()
+	}
 	// handle index.html
 	s.router.PathPrefix("/").HandlerFunc(s.handleIndex())
 }
@@ -59,6 +59,509 @@ CREATE TABLE IF NOT EXISTS api_keys (
     UNIQUE(warrior_id, name)
 );
 
+CREATE TABLE IF NOT EXISTS api_key_requests (
+    id BIGSERIAL PRIMARY KEY,
+    key_id TEXT NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    method VARCHAR(16) NOT NULL,
+    route VARCHAR(256) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL,
+    latency_ms BIGINT NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS api_key_requests_warrior_id_idx ON api_key_requests (warrior_id, created_date);
+
+CREATE TABLE IF NOT EXISTS teams (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS team_warriors (
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    role VARCHAR(16) NOT NULL DEFAULT 'MEMBER',
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (team_id, warrior_id)
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id UUID REFERENCES roles(id) ON DELETE CASCADE NOT NULL,
+    permission VARCHAR(64) NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+CREATE TABLE IF NOT EXISTS warrior_roles (
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    role_id UUID REFERENCES roles(id) ON DELETE CASCADE NOT NULL,
+    PRIMARY KEY (warrior_id, role_id)
+);
+CREATE TABLE IF NOT EXISTS team_roles (
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE NOT NULL,
+    team_role VARCHAR(16) NOT NULL,
+    role_id UUID REFERENCES roles(id) ON DELETE CASCADE NOT NULL,
+    PRIMARY KEY (team_id, team_role, role_id)
+);
+CREATE TABLE IF NOT EXISTS departments (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS department_warriors (
+    department_id UUID REFERENCES departments(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    role VARCHAR(16) NOT NULL DEFAULT 'MEMBER',
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (department_id, warrior_id)
+);
+
+CREATE TABLE IF NOT EXISTS team_checklist_items (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE NOT NULL,
+    text VARCHAR(256) NOT NULL,
+    sort_order INTEGER DEFAULT 0,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS plan_checklist (
+    plan_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    item_id UUID REFERENCES team_checklist_items(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (plan_id, item_id)
+);
+
+CREATE TABLE IF NOT EXISTS plan_questions (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    plan_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE SET NULL,
+    question TEXT NOT NULL,
+    answer TEXT DEFAULT '',
+    resolved BOOL DEFAULT false,
+    created_date TIMESTAMP DEFAULT NOW(),
+    resolved_date TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS plan_dots (
+    plan_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    dots INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (plan_id, warrior_id)
+);
+
+CREATE TABLE IF NOT EXISTS battle_confidence (
+    battle_id UUID REFERENCES battles(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    confidence SMALLINT NOT NULL CHECK (confidence BETWEEN 1 AND 5),
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (battle_id, warrior_id)
+);
+
+CREATE TABLE IF NOT EXISTS battle_raised_hands (
+    battle_id UUID REFERENCES battles(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    position INTEGER NOT NULL,
+    raised_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (battle_id, warrior_id)
+);
+
+CREATE TABLE IF NOT EXISTS plan_vote_submissions (
+    vote_id UUID PRIMARY KEY,
+    plan_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    vote VARCHAR(3),
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(64) NOT NULL,
+    battle_id UUID NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}'::JSONB,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_date TIMESTAMP DEFAULT NOW(),
+    processed_date TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE processed_date IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(256) NOT NULL,
+    url TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    template TEXT NOT NULL DEFAULT '',
+    active BOOL DEFAULT true,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS outbox_deliveries (
+    event_id BIGINT REFERENCES outbox_events(id) ON DELETE CASCADE NOT NULL,
+    handler VARCHAR(64) NOT NULL,
+    delivered_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (event_id, handler)
+);
+
+-- no reference to outbox_events, its deliveries were recorded while its rows were locked --
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    webhook_id UUID REFERENCES webhooks(id) ON DELETE CASCADE NOT NULL,
+    event_id BIGINT NOT NULL,
+    delivered_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (event_id, webhook_id)
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    name VARCHAR(64) PRIMARY KEY,
+    schedule VARCHAR(128) NOT NULL,
+    running BOOL DEFAULT false,
+    runs INTEGER DEFAULT 0,
+    failures INTEGER DEFAULT 0,
+    last_started TIMESTAMP,
+    last_finished TIMESTAMP,
+    last_error TEXT,
+    last_scheduled TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS app_stats_snapshots (
+    snapshot_date DATE PRIMARY KEY,
+    unregistered_warrior_count INTEGER NOT NULL,
+    registered_warrior_count INTEGER NOT NULL,
+    battle_count INTEGER NOT NULL,
+    plan_count INTEGER NOT NULL,
+    team_count INTEGER NOT NULL,
+    database_size BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS email_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    recipient VARCHAR(320) NOT NULL,
+    subject TEXT NOT NULL,
+    error TEXT,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS team_confluence (
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE PRIMARY KEY,
+    base_url VARCHAR(256) NOT NULL,
+    space_key VARCHAR(64) NOT NULL,
+    parent_page_id VARCHAR(64),
+    username VARCHAR(320) NOT NULL,
+    api_token VARCHAR(256) NOT NULL,
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS team_issue_providers (
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+    provider VARCHAR(32) NOT NULL,
+    api_key VARCHAR(256) NOT NULL,
+    updated_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (team_id, provider)
+);
+
+CREATE TABLE IF NOT EXISTS team_jira_webhooks (
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE PRIMARY KEY,
+    secret TEXT NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS battle_sms_voters (
+    battle_id UUID REFERENCES battles(id) ON DELETE CASCADE NOT NULL,
+    phone VARCHAR(32) NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (battle_id, phone)
+);
+
+CREATE TABLE IF NOT EXISTS battle_action_items (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    battle_id UUID REFERENCES battles(id) ON DELETE CASCADE NOT NULL,
+    content TEXT NOT NULL,
+    owner_id UUID REFERENCES warriors(id) ON DELETE SET NULL,
+    due_date DATE,
+    completed BOOL DEFAULT false,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS team_parked_plans (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE NOT NULL,
+    name VARCHAR(256),
+    type VARCHAR(64) DEFAULT 'story',
+    reference_id VARCHAR(128),
+    link TEXT,
+    description TEXT,
+    acceptance_criteria TEXT,
+    issue_provider VARCHAR(32),
+    external_id VARCHAR(128),
+    created_date TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS team_parked_plans_team_idx ON team_parked_plans (team_id, created_date);
+
+CREATE TABLE IF NOT EXISTS battle_state_events (
+    id BIGSERIAL PRIMARY KEY,
+    battle_id UUID NOT NULL,
+    entity VARCHAR(16) NOT NULL,
+    entity_id UUID NOT NULL,
+    op VARCHAR(16) NOT NULL,
+    state JSONB NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS battle_state_events_battle_idx ON battle_state_events (battle_id, created_date);
+CREATE INDEX IF NOT EXISTS battle_state_events_entity_idx ON battle_state_events (entity_id);
+
+CREATE TABLE IF NOT EXISTS retention_reports (
+    id SERIAL PRIMARY KEY,
+    battle_days INTEGER NOT NULL,
+    vote_days INTEGER NOT NULL,
+    battles JSONB NOT NULL DEFAULT '[]'::JSONB,
+    plans_anonymized INTEGER NOT NULL DEFAULT 0,
+    events_purged INTEGER NOT NULL DEFAULT 0,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS plan_issue_fields (
+    plan_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    field VARCHAR(32) NOT NULL,
+    base TEXT NOT NULL DEFAULT '',
+    theirs TEXT,
+    updated_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (plan_id, field)
+);
+
+CREATE TABLE IF NOT EXISTS federation_peers (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    url VARCHAR(256) NOT NULL UNIQUE,
+    public_key VARCHAR(64) NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS federated_warriors (
+    peer_id UUID REFERENCES federation_peers(id) ON DELETE CASCADE NOT NULL,
+    remote_warrior_id VARCHAR(64) NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    PRIMARY KEY (peer_id, remote_warrior_id)
+);
+
+CREATE TABLE IF NOT EXISTS battle_federations (
+    battle_id UUID REFERENCES battles(id) ON DELETE CASCADE NOT NULL,
+    peer_id UUID REFERENCES federation_peers(id) ON DELETE CASCADE NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (battle_id, peer_id)
+);
+
+CREATE TABLE IF NOT EXISTS federation_nonces (
+    peer_id UUID REFERENCES federation_peers(id) ON DELETE CASCADE NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    expire_date TIMESTAMP NOT NULL,
+    PRIMARY KEY (peer_id, nonce)
+);
+
+CREATE TABLE IF NOT EXISTS federation_watchers (
+    peer_id UUID REFERENCES federation_peers(id) ON DELETE CASCADE NOT NULL,
+    battle_id UUID NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (peer_id, battle_id, warrior_id)
+);
+
+CREATE TABLE IF NOT EXISTS plan_dependencies (
+    plan_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    depends_on_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (plan_id, depends_on_id)
+);
+
+CREATE TABLE IF NOT EXISTS plan_vote_latencies (
+    plan_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    battle_id UUID REFERENCES battles(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    vote_start TIMESTAMP NOT NULL,
+    latency_ms INTEGER NOT NULL,
+    PRIMARY KEY (plan_id, warrior_id)
+);
+CREATE INDEX IF NOT EXISTS plan_vote_latencies_battle_idx ON plan_vote_latencies (battle_id);
+
+CREATE TABLE IF NOT EXISTS plan_attachments (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    plan_id UUID REFERENCES plans(id) ON DELETE CASCADE NOT NULL,
+    battle_id UUID REFERENCES battles(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE SET NULL,
+    name VARCHAR(256) NOT NULL,
+    content_type VARCHAR(128) NOT NULL,
+    size INTEGER NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS plan_attachments_plan_idx ON plan_attachments (plan_id);
+
+CREATE TABLE IF NOT EXISTS deleted_attachments (
+    id UUID NOT NULL PRIMARY KEY,
+    deleted_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS warrior_absences (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    note VARCHAR(256) NOT NULL DEFAULT '',
+    created_date TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS warrior_absences_warrior_idx ON warrior_absences (warrior_id, end_date);
+
+CREATE TABLE IF NOT EXISTS team_battle_schedules (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE NOT NULL,
+    name VARCHAR(256) NOT NULL,
+    schedule VARCHAR(128) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    key_warriors UUID[] NOT NULL DEFAULT '{}',
+    created_date TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS team_battle_schedules_team_idx ON team_battle_schedules (team_id);
+
+CREATE TABLE IF NOT EXISTS battle_sessions (
+    id UUID NOT NULL PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    leader_id UUID REFERENCES warriors(id) ON DELETE SET NULL,
+    team_id UUID REFERENCES teams(id) ON DELETE SET NULL,
+    ended_date TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS battle_sessions_ended_idx ON battle_sessions (ended_date);
+
+CREATE TABLE IF NOT EXISTS battle_session_warriors (
+    session_id UUID REFERENCES battle_sessions(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    responded BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (session_id, warrior_id)
+);
+
+CREATE TABLE IF NOT EXISTS battle_session_feedback (
+    session_id UUID REFERENCES battle_sessions(id) ON DELETE CASCADE NOT NULL,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    comment TEXT NOT NULL DEFAULT '',
+    -- only the day so the order warriors responded in doesn't tell who wrote what
+    created_date DATE NOT NULL DEFAULT CURRENT_DATE
+);
+CREATE INDEX IF NOT EXISTS battle_session_feedback_session_idx ON battle_session_feedback (session_id);
+
+CREATE TABLE IF NOT EXISTS team_calendars (
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE PRIMARY KEY,
+    provider VARCHAR(32) NOT NULL,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT NOT NULL,
+    expiry TIMESTAMP NOT NULL,
+    connected_by UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS calendar_slots (
+    schedule_id UUID REFERENCES team_battle_schedules(id) ON DELETE CASCADE NOT NULL,
+    team_id UUID REFERENCES team_calendars(team_id) ON DELETE CASCADE NOT NULL,
+    start_time TIMESTAMP NOT NULL,
+    event_id VARCHAR(256) NOT NULL,
+    battle_id UUID REFERENCES battles(id) ON DELETE SET NULL,
+    opened BOOL NOT NULL DEFAULT false,
+    created_date TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (schedule_id, start_time)
+);
+
+CREATE TABLE IF NOT EXISTS battle_defaults (
+    id BOOL PRIMARY KEY DEFAULT true CHECK (id),
+    defaults JSONB NOT NULL,
+    updated_by UUID REFERENCES warriors(id) ON DELETE SET NULL,
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS team_domains (
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE PRIMARY KEY,
+    host VARCHAR(253) UNIQUE,
+    path_prefix VARCHAR(64) UNIQUE,
+    app_name VARCHAR(64) NOT NULL DEFAULT '',
+    logo_url VARCHAR(512) NOT NULL DEFAULT '',
+    primary_color VARCHAR(7) NOT NULL DEFAULT '',
+    defaults JSONB,
+    updated_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS license_overages (
+    resource VARCHAR(32) PRIMARY KEY,
+    since TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS battle_templates (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    document JSONB NOT NULL,
+    created_by UUID REFERENCES warriors(id) ON DELETE SET NULL,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS warrior_notification_preferences (
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    channel VARCHAR(32) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (warrior_id, event, channel)
+);
+
+CREATE TABLE IF NOT EXISTS email_broadcasts (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    subject VARCHAR(256) NOT NULL,
+    body TEXT NOT NULL,
+    team_id UUID REFERENCES teams(id) ON DELETE SET NULL,
+    created_by UUID REFERENCES warriors(id) ON DELETE SET NULL,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS email_broadcast_recipients (
+    broadcast_id UUID REFERENCES email_broadcasts(id) ON DELETE CASCADE NOT NULL,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    sent_date TIMESTAMP,
+    PRIMARY KEY (broadcast_id, warrior_id)
+);
+CREATE INDEX IF NOT EXISTS email_broadcast_recipients_pending_idx ON email_broadcast_recipients (broadcast_id) WHERE sent_date IS NULL;
+
+CREATE TABLE IF NOT EXISTS battle_events (
+    id SERIAL PRIMARY KEY,
+    battle_id UUID REFERENCES battles(id) ON DELETE CASCADE NOT NULL,
+    seq BIGINT NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    value TEXT,
+    warrior_id VARCHAR(64),
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS warrior_sessions (
+    id UUID NOT NULL DEFAULT uuid_generate_v4() PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE NOT NULL,
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    created_date TIMESTAMP DEFAULT NOW(),
+    expire_date TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS warrior_sessions_warrior_idx ON warrior_sessions (warrior_id);
+
+CREATE TABLE IF NOT EXISTS warrior_legacy_cookies (
+    cookie_hash TEXT NOT NULL PRIMARY KEY,
+    created_date TIMESTAMP DEFAULT NOW()
+);
+
 --
 -- Table Alterations
 --
@@ -67,15 +570,30 @@ ALTER TABLE battles ADD COLUMN IF NOT EXISTS updated_date TIMESTAMP DEFAULT NOW(
 ALTER TABLE battles ADD COLUMN IF NOT EXISTS point_values_allowed JSONB DEFAULT '["1/2", "1", "2", "3", "5", "8", "13", "?"]'::JSONB;
 ALTER TABLE battles ALTER COLUMN id SET DEFAULT uuid_generate_v4();
 ALTER TABLE battles ADD COLUMN IF NOT EXISTS auto_finish_voting BOOL DEFAULT true;
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) DEFAULT 'UTC';
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS locale VARCHAR(16) DEFAULT '';
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS team_id UUID REFERENCES teams(id) ON DELETE SET NULL;
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS require_ready BOOL DEFAULT false;
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS dot_budget INTEGER DEFAULT 0;
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS confidence_open BOOL DEFAULT false;
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES battles(id);
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS email_code VARCHAR(32) UNIQUE;
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE battles ADD COLUMN IF NOT EXISTS notes_version INTEGER NOT NULL DEFAULT 0;
 
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS department_id UUID REFERENCES departments(id) ON DELETE SET NULL;
 ALTER TABLE warriors ADD COLUMN IF NOT EXISTS created_date TIMESTAMP DEFAULT NOW();
+ALTER TABLE warriors ADD COLUMN IF NOT EXISTS updated_date TIMESTAMPTZ;
 ALTER TABLE warriors ADD COLUMN IF NOT EXISTS last_active TIMESTAMP DEFAULT NOW();
+ALTER TABLE warriors ADD COLUMN IF NOT EXISTS last_login TIMESTAMP;
 ALTER TABLE warriors ADD COLUMN IF NOT EXISTS email VARCHAR(320) UNIQUE;
 ALTER TABLE warriors ADD COLUMN IF NOT EXISTS password TEXT;
 ALTER TABLE warriors ADD COLUMN IF NOT EXISTS rank VARCHAR(128) DEFAULT 'PRIVATE';
 ALTER TABLE warriors ADD COLUMN IF NOT EXISTS verified BOOL DEFAULT false;
 ALTER TABLE warriors ADD COLUMN IF NOT EXISTS avatar VARCHAR(128) DEFAULT 'identicon';
 ALTER TABLE warriors ADD COLUMN IF NOT EXISTS notifications_enabled BOOL DEFAULT true;
+ALTER TABLE warriors ADD COLUMN IF NOT EXISTS handle VARCHAR(32);
+CREATE UNIQUE INDEX IF NOT EXISTS warriors_handle_idx ON warriors (lower(handle));
 ALTER TABLE warriors ALTER COLUMN id SET DEFAULT uuid_generate_v4();
 
 ALTER TABLE plans ADD COLUMN IF NOT EXISTS created_date TIMESTAMP DEFAULT NOW();
@@ -89,8 +607,195 @@ ALTER TABLE plans ADD COLUMN IF NOT EXISTS description TEXT;
 ALTER TABLE plans ADD COLUMN IF NOT EXISTS acceptance_criteria TEXT;
 ALTER TABLE plans ADD COLUMN IF NOT EXISTS reference_id VARCHAR(128);
 ALTER TABLE plans ADD COLUMN IF NOT EXISTS type VARCHAR(64) DEFAULT 'story';
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES plans(id) ON DELETE SET NULL;
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS split BOOL DEFAULT false;
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS dots INTEGER DEFAULT 0;
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS sort_order INTEGER DEFAULT 0;
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS version INTEGER DEFAULT 1;
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS issue_provider VARCHAR(32);
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS external_id VARCHAR(128);
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS translations JSONB NOT NULL DEFAULT '{}'::JSONB;
 
 ALTER TABLE battles_warriors ADD COLUMN IF NOT EXISTS abandoned BOOL DEFAULT false;
+ALTER TABLE battles_warriors ADD COLUMN IF NOT EXISTS starred BOOL DEFAULT false;
+
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS warrior_id UUID REFERENCES warriors(id) ON DELETE CASCADE;
+
+ALTER TABLE api_key_requests ADD COLUMN IF NOT EXISTS detail TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE team_battle_schedules ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP;
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS last_scheduled TIMESTAMP;
+
+-- slots remember being opened so one whose battle was deleted isn't opened again --
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'calendar_slots' AND column_name = 'opened'
+    ) THEN
+        ALTER TABLE calendar_slots ADD COLUMN opened BOOL NOT NULL DEFAULT false;
+        UPDATE calendar_slots SET opened = true WHERE battle_id IS NOT NULL;
+    END IF;
+END $$;
+DROP INDEX IF EXISTS calendar_slots_start_idx;
+CREATE INDEX IF NOT EXISTS calendar_slots_due_idx ON calendar_slots (start_time) WHERE NOT opened;
+
+-- encrypted credentials are longer than the plaintext ones --
+ALTER TABLE team_confluence ALTER COLUMN api_token TYPE TEXT;
+ALTER TABLE team_issue_providers ALTER COLUMN api_key TYPE TEXT;
+
+-- created and updated dates are sent in UTC so they're stored with their time zone, the ones from before were written in the database's --
+DO $$
+DECLARE tableName TEXT;
+BEGIN
+    FOREACH tableName IN ARRAY ARRAY['warriors', 'battles', 'plans'] LOOP
+        IF EXISTS (
+            SELECT FROM information_schema.columns
+            WHERE table_schema = current_schema() AND table_name = tableName
+            AND column_name IN ('created_date', 'updated_date') AND data_type = 'timestamp without time zone'
+        ) THEN
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN created_date TYPE TIMESTAMPTZ, ALTER COLUMN updated_date TYPE TIMESTAMPTZ', tableName);
+        END IF;
+    END LOOP;
+END $$;
+
+-- backfill the dates missing from rows from before they were kept, warriors weren't known to be updated since created --
+UPDATE warriors SET created_date = coalesce(created_date, last_active, NOW()) WHERE created_date IS NULL;
+UPDATE warriors SET updated_date = created_date WHERE updated_date IS NULL;
+ALTER TABLE warriors ALTER COLUMN updated_date SET DEFAULT NOW();
+UPDATE battles SET created_date = coalesce(created_date, updated_date, NOW()), updated_date = coalesce(updated_date, created_date, NOW())
+WHERE created_date IS NULL OR updated_date IS NULL;
+UPDATE plans SET created_date = coalesce(created_date, updated_date, NOW()), updated_date = coalesce(updated_date, created_date, NOW())
+WHERE created_date IS NULL OR updated_date IS NULL;
+-- votes from before they were dated are dated when their plan's voting started --
+UPDATE plans SET votes = (
+    SELECT jsonb_agg(jsonb_build_object(
+        'createdDate', coalesce(votestart_time::TIMESTAMPTZ, created_date),
+        'updatedDate', coalesce(votestart_time::TIMESTAMPTZ, created_date)
+    ) || v)
+    FROM jsonb_array_elements(votes) v
+)
+WHERE jsonb_typeof(votes) = 'array' AND EXISTS (SELECT FROM jsonb_array_elements(votes) v WHERE NOT v ? 'createdDate');
+
+-- every warrior has the everyone role, seeded once with what warriors could always do so admins can take it away --
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM roles WHERE name = 'everyone') THEN
+        INSERT INTO roles (name, description) VALUES ('everyone', 'Granted to every warrior including guests');
+        INSERT INTO role_permissions (role_id, permission)
+        SELECT id, p FROM roles, unnest(ARRAY['create_battles', 'manage_teams']) p WHERE name = 'everyone';
+    END IF;
+END $$;
+
+-- move the per tracker api keys into team_issue_providers --
+DO $$
+BEGIN
+    IF to_regclass('team_linear') IS NOT NULL THEN
+        INSERT INTO team_issue_providers (team_id, provider, api_key)
+        SELECT team_id, 'linear', api_key FROM team_linear ON CONFLICT DO NOTHING;
+        DROP TABLE team_linear;
+    END IF;
+    IF to_regclass('team_shortcut') IS NOT NULL THEN
+        INSERT INTO team_issue_providers (team_id, provider, api_key)
+        SELECT team_id, 'shortcut', api_token FROM team_shortcut ON CONFLICT DO NOTHING;
+        DROP TABLE team_shortcut;
+    END IF;
+END $$;
+
+-- whether the warrior wants the notification event through the channel, on unless they turned it off --
+CREATE OR REPLACE FUNCTION warrior_notifies(warriorId UUID, notificationEvent VARCHAR, notificationChannel VARCHAR) RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(w.notifications_enabled, false) AND coalesce((
+        SELECT p.enabled FROM warrior_notification_preferences p
+        WHERE p.warrior_id = w.id AND p.event = notificationEvent AND p.channel = notificationChannel
+    ), true)
+    FROM warriors w WHERE w.id = warriorId;
+$$;
+
+-- append every change to a battle or its plans to the battle state log, an audit history the battle can be seen at
+-- any point of from, the tables stay what's read and written --
+CREATE OR REPLACE FUNCTION log_battle_state() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+DECLARE state JSONB;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        state := to_jsonb(OLD);
+    ELSE
+        state := to_jsonb(NEW);
+    END IF;
+    -- notes have their own revisions and would bloat the log
+    state := state - 'notes' - 'notes_version';
+    IF TG_OP = 'UPDATE' AND state - 'updated_date' = to_jsonb(OLD) - 'notes' - 'notes_version' - 'updated_date' THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO battle_state_events (battle_id, entity, entity_id, op, state)
+    VALUES (
+        CASE WHEN TG_TABLE_NAME = 'battles' THEN (state->>'id')::UUID ELSE (state->>'battle_id')::UUID END,
+        CASE WHEN TG_TABLE_NAME = 'battles' THEN 'battle' ELSE 'plan' END,
+        (state->>'id')::UUID,
+        lower(TG_OP),
+        state
+    );
+
+    RETURN NULL;
+END;
+$$;
+
+-- bump the updated date of a row when it changes, the columns passed changing don't count as it being updated --
+CREATE OR REPLACE FUNCTION set_updated_date() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+DECLARE ignored TEXT[] := coalesce(TG_ARGV, '{}'::TEXT[]) || ARRAY['updated_date'];
+BEGIN
+    IF to_jsonb(NEW) - ignored <> to_jsonb(OLD) - ignored THEN
+        NEW.updated_date := NOW();
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS warriors_updated_date ON warriors;
+CREATE TRIGGER warriors_updated_date BEFORE UPDATE ON warriors
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_date('last_active', 'last_login', 'password');
+DROP TRIGGER IF EXISTS battles_updated_date ON battles;
+CREATE TRIGGER battles_updated_date BEFORE UPDATE ON battles
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_date();
+DROP TRIGGER IF EXISTS plans_updated_date ON plans;
+CREATE TRIGGER plans_updated_date BEFORE UPDATE ON plans
+    FOR EACH ROW EXECUTE PROCEDURE set_updated_date();
+
+DROP TRIGGER IF EXISTS battles_state_log ON battles;
+CREATE TRIGGER battles_state_log AFTER INSERT OR UPDATE OR DELETE ON battles
+    FOR EACH ROW EXECUTE PROCEDURE log_battle_state();
+DROP TRIGGER IF EXISTS plans_state_log ON plans;
+CREATE TRIGGER plans_state_log AFTER INSERT OR UPDATE OR DELETE ON plans
+    FOR EACH ROW EXECUTE PROCEDURE log_battle_state();
+
+-- queue the files of removed attachments to be deleted from storage, however the row went (its plan, battle or the retention) --
+CREATE OR REPLACE FUNCTION queue_attachment_deletion() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO deleted_attachments (id) VALUES (OLD.id) ON CONFLICT DO NOTHING;
+
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS plan_attachments_deleted ON plan_attachments;
+CREATE TRIGGER plan_attachments_deleted AFTER DELETE ON plan_attachments
+    FOR EACH ROW EXECUTE PROCEDURE queue_attachment_deletion();
+
+-- start the log of battles from before it existed (or whose events were purged) with a snapshot --
+INSERT INTO battle_state_events (battle_id, entity, entity_id, op, state)
+SELECT b.id, 'battle', b.id, 'snapshot', to_jsonb(b) - 'notes' - 'notes_version'
+FROM battles b WHERE NOT EXISTS (SELECT 1 FROM battle_state_events e WHERE e.entity_id = b.id);
+INSERT INTO battle_state_events (battle_id, entity, entity_id, op, state)
+SELECT p.battle_id, 'plan', p.id, 'snapshot', to_jsonb(p)
+FROM plans p WHERE NOT EXISTS (SELECT 1 FROM battle_state_events e WHERE e.entity_id = p.id);
 
 --
 -- Types (used in Stored Procedures)
@@ -99,7 +804,9 @@ DROP TYPE IF EXISTS WarriorsVote;
 CREATE TYPE WarriorsVote AS
 (
     "warriorId"     uuid,
-    "vote"   VARCHAR(3)
+    "vote"   VARCHAR(3),
+    "createdDate"   TIMESTAMPTZ,
+    "updatedDate"   TIMESTAMPTZ
 );
 
 --
@@ -123,6 +830,20 @@ BEGIN
 END;
 $$;
 
+-- Queue the edits of a plan imported from a team's tracker for the issue sync --
+CREATE OR REPLACE PROCEDURE queue_issue_plan_revised(planId UUID)
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO outbox_events (event_type, battle_id, payload)
+    SELECT 'issue_plan_revised', p.battle_id, jsonb_build_object(
+        'planId', p.id, 'planName', p.name, 'referenceId', p.reference_id,
+        'teamId', b.team_id, 'issueProvider', p.issue_provider, 'externalId', p.external_id, 'leaderId', b.leader_id
+    )
+    FROM plans p JOIN battles b ON b.id = p.battle_id
+    WHERE p.id = planId AND coalesce(p.issue_provider, '') <> '' AND b.team_id IS NOT NULL;
+END;
+$$;
+
 -- Revise Plan --
 CREATE OR REPLACE PROCEDURE revise_plan(planId UUID, planName VARCHAR(256), planType VARCHAR(64), referenceId VARCHAR(128), planLink TEXT, planDescription TEXT, acceptanceCriteria TEXT)
 LANGUAGE plpgsql AS $$
@@ -137,6 +858,7 @@ BEGIN
         description = planDescription,
         acceptance_criteria = acceptanceCriteria
     WHERE id = planId;
+    CALL queue_issue_plan_revised(planId);
 END;
 $$;
 
@@ -174,6 +896,12 @@ BEGIN
     UPDATE plans SET updated_date = NOW(), active = false, voteend_time = NOW() WHERE battle_id = battleId;
     -- set battle VotingLocked
     UPDATE battles SET updated_date = NOW(), voting_locked = true WHERE id = battleId;
+    -- let integrations know in the same transaction
+    INSERT INTO outbox_events (event_type, battle_id, payload)
+    SELECT 'voting_ended', battleId, jsonb_build_object(
+        'planId', p.id, 'planName', p.name, 'referenceId', p.reference_id, 'votes', p.votes, 'leaderId', b.leader_id
+    )
+    FROM plans p JOIN battles b ON b.id = p.battle_id WHERE p.id = planId;
     COMMIT;
 END;
 $$;
@@ -184,8 +912,149 @@ LANGUAGE plpgsql AS $$
 BEGIN
     -- set plan points and deactivate
     UPDATE plans SET updated_date = NOW(), active = false, points = planPoints WHERE id = planId;
-    -- reset battle active_plan_id
-    UPDATE battles SET updated_date = NOW(), active_plan_id = null WHERE id = battleId;
+    -- reset battle active_plan_id when it was the plan being voted on
+    UPDATE battles SET updated_date = NOW(), active_plan_id = null WHERE id = battleId AND active_plan_id = planId;
+    -- let integrations know in the same transaction
+    INSERT INTO outbox_events (event_type, battle_id, payload)
+    SELECT 'plan_finalized', battleId, jsonb_build_object(
+        'planId', p.id, 'planName', p.name, 'referenceId', p.reference_id, 'points', p.points,
+        'teamId', b.team_id, 'issueProvider', p.issue_provider, 'externalId', p.external_id, 'leaderId', b.leader_id
+    )
+    FROM plans p JOIN battles b ON b.id = p.battle_id WHERE p.id = planId;
+    COMMIT;
+END;
+$$;
+
+-- Split a plan into child plans --
+CREATE OR REPLACE PROCEDURE split_plan(battleId UUID, parentId UUID, childPlans JSONB)
+LANGUAGE plpgsql AS $$
+DECLARE parentPlan plans%ROWTYPE;
+BEGIN
+    SELECT * INTO parentPlan FROM plans WHERE id = parentId AND battle_id = battleId;
+    IF NOT FOUND THEN
+        RAISE 'Plan not found';
+    END IF;
+
+    INSERT INTO plans (battle_id, parent_id, name, type, reference_id, link, description, acceptance_criteria)
+    SELECT
+        battleId,
+        parentId,
+        child->>'name',
+        coalesce(NULLIF(child->>'type', ''), parentPlan.type),
+        coalesce(NULLIF(child->>'referenceId', ''), parentPlan.reference_id),
+        coalesce(NULLIF(child->>'link', ''), parentPlan.link),
+        coalesce(NULLIF(child->>'description', ''), parentPlan.description),
+        coalesce(NULLIF(child->>'acceptanceCriteria', ''), parentPlan.acceptance_criteria)
+    FROM jsonb_array_elements(childPlans) AS child;
+
+    UPDATE plans SET updated_date = NOW(), split = true, active = false WHERE id = parentId;
+    UPDATE battles SET updated_date = NOW(), voting_locked = true, active_plan_id = null
+    WHERE id = battleId AND active_plan_id = parentId;
+
+    COMMIT;
+END;
+$$;
+
+-- Start a dot voting prioritization round --
+CREATE OR REPLACE PROCEDURE start_dot_voting(battleId UUID, dotBudget INTEGER)
+LANGUAGE plpgsql AS $$
+BEGIN
+    DELETE FROM plan_dots pd USING plans p WHERE pd.plan_id = p.id AND p.battle_id = battleId;
+    UPDATE plans SET dots = 0 WHERE battle_id = battleId;
+    UPDATE battles SET updated_date = NOW(), dot_budget = dotBudget WHERE id = battleId;
+
+    COMMIT;
+END;
+$$;
+
+-- Set a warriors dot allocation across the battles plans --
+CREATE OR REPLACE PROCEDURE set_warrior_dots(battleId UUID, warriorId UUID, planDots JSONB)
+LANGUAGE plpgsql AS $$
+DECLARE dotBudget INTEGER;
+DECLARE dotTotal INTEGER;
+BEGIN
+    SELECT dot_budget INTO dotBudget FROM battles WHERE id = battleId;
+    IF dotBudget IS NULL OR dotBudget = 0 THEN
+        RAISE 'Dot voting not in progress';
+    END IF;
+
+    SELECT coalesce(SUM(value::INTEGER), 0) INTO dotTotal FROM jsonb_each_text(planDots);
+    IF dotTotal > dotBudget THEN
+        RAISE 'Dots exceed budget';
+    END IF;
+
+    DELETE FROM plan_dots pd USING plans p
+    WHERE pd.plan_id = p.id AND p.battle_id = battleId AND pd.warrior_id = warriorId;
+
+    INSERT INTO plan_dots (plan_id, warrior_id, dots)
+    SELECT p.id, warriorId, pd.value::INTEGER
+    FROM jsonb_each_text(planDots) pd
+    JOIN plans p ON p.id = pd.key::UUID AND p.battle_id = battleId
+    WHERE pd.value::INTEGER > 0;
+
+    COMMIT;
+END;
+$$;
+
+-- End a dot voting round, persisting totals and ordering plans by them --
+CREATE OR REPLACE PROCEDURE end_dot_voting(battleId UUID)
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE plans p SET dots = coalesce(totals.dots, 0), sort_order = totals.priority
+    FROM (
+        SELECT p2.id, SUM(pd.dots) AS dots,
+            ROW_NUMBER() OVER (ORDER BY coalesce(SUM(pd.dots), 0) DESC, p2.created_date) AS priority
+        FROM plans p2
+        LEFT JOIN plan_dots pd ON pd.plan_id = p2.id
+        WHERE p2.battle_id = battleId
+        GROUP BY p2.id
+    ) totals
+    WHERE p.id = totals.id;
+
+    DELETE FROM plan_dots pd USING plans p WHERE pd.plan_id = p.id AND p.battle_id = battleId;
+    UPDATE battles SET updated_date = NOW(), dot_budget = 0 WHERE id = battleId;
+
+    COMMIT;
+END;
+$$;
+
+-- Create a Breakout battle from a subset of the parent battles plans, within the callers transaction --
+CREATE OR REPLACE PROCEDURE create_breakout(parentId UUID, breakoutId UUID, breakoutName VARCHAR(256), leaderId UUID, planIds UUID[])
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO battles (id, parent_id, leader_id, name, point_values_allowed, auto_finish_voting, timezone, locale, team_id)
+    SELECT breakoutId, id, leaderId, breakoutName, point_values_allowed, auto_finish_voting, timezone, locale, team_id
+    FROM battles WHERE id = parentId;
+
+    UPDATE plans SET updated_date = NOW(), active = false, battle_id = breakoutId
+    WHERE battle_id = parentId AND id = ANY(planIds);
+
+    UPDATE battles SET updated_date = NOW(), voting_locked = true, active_plan_id = null
+    WHERE id = parentId AND active_plan_id = ANY(planIds);
+END;
+$$;
+
+-- Merge all Breakout battles back into their parent battle --
+CREATE OR REPLACE PROCEDURE merge_breakouts(parentId UUID)
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE plans SET updated_date = NOW(), active = false, battle_id = parentId
+    WHERE battle_id IN (SELECT id FROM battles WHERE parent_id = parentId);
+
+    DELETE FROM battles_warriors WHERE battle_id IN (SELECT id FROM battles WHERE parent_id = parentId);
+    DELETE FROM battles WHERE parent_id = parentId;
+
+    COMMIT;
+END;
+$$;
+
+-- Create a Team with the creating warrior as its admin --
+CREATE OR REPLACE PROCEDURE create_team(teamId UUID, teamName VARCHAR(256), warriorId UUID)
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO teams (id, name) VALUES (teamId, teamName);
+    INSERT INTO team_warriors (team_id, warrior_id, role) VALUES (teamId, warriorId, 'ADMIN');
+
     COMMIT;
 END;
 $$;
@@ -217,13 +1086,88 @@ BEGIN
 END;
 $$;
 
--- Delete Battle --
-CREATE OR REPLACE PROCEDURE delete_battle(battleId UUID)
+-- Remove a Battle along with its breakouts and bots, without letting anyone know --
+CREATE OR REPLACE PROCEDURE purge_battle(battleId UUID)
 LANGUAGE plpgsql AS $$
+DECLARE botIds UUID[];
 BEGIN
+    botIds := ARRAY(
+        SELECT w.id FROM battles_warriors bw
+        JOIN warriors w ON w.id = bw.warrior_id
+        WHERE bw.battle_id = battleId AND w.rank = 'BOT'
+    );
+    -- breakouts go down with their parent battle
+    DELETE FROM plans WHERE battle_id IN (SELECT id FROM battles WHERE parent_id = battleId);
+    DELETE FROM battles_warriors WHERE battle_id IN (SELECT id FROM battles WHERE parent_id = battleId);
+    DELETE FROM battles WHERE parent_id = battleId;
     DELETE FROM plans WHERE battle_id = battleId;
     DELETE FROM battles_warriors WHERE battle_id = battleId;
     DELETE FROM battles WHERE id = battleId;
+    DELETE FROM api_keys WHERE warrior_id = ANY(botIds);
+    DELETE FROM warriors WHERE id = ANY(botIds);
+END;
+$$;
+
+-- Delete Battle --
+CREATE OR REPLACE PROCEDURE delete_battle(battleId UUID)
+LANGUAGE plpgsql AS $$
+BEGIN
+    -- let integrations know in the same transaction, with the results as the battle is about to be gone
+    INSERT INTO outbox_events (event_type, battle_id, payload)
+    SELECT 'battle_ended', b.id, jsonb_build_object(
+        'battleName', b.name,
+        'leaderId', b.leader_id,
+        'teamId', b.team_id,
+        'plans', coalesce((
+            SELECT jsonb_agg(jsonb_build_object('planId', p.id, 'planName', p.name, 'referenceId', p.reference_id, 'points', p.points))
+            FROM plans p WHERE p.battle_id = b.id
+        ), '[]'::JSONB),
+        'actionItems', coalesce((
+            SELECT jsonb_agg(jsonb_build_object(
+                'content', ai.content, 'ownerName', coalesce(w.name, ''),
+                'dueDate', coalesce(to_char(ai.due_date, 'YYYY-MM-DD'), ''), 'completed', ai.completed
+            ) ORDER BY ai.created_date)
+            FROM battle_action_items ai LEFT JOIN warriors w ON w.id = ai.owner_id WHERE ai.battle_id = b.id
+        ), '[]'::JSONB)
+    )
+    FROM battles b WHERE b.id = battleId;
+    -- the warriors that took part can give anonymous feedback on the session once it's gone
+    INSERT INTO battle_sessions (id, name, leader_id, team_id)
+    SELECT b.id, b.name, b.leader_id, b.team_id FROM battles b WHERE b.id = battleId
+    ON CONFLICT (id) DO NOTHING;
+    INSERT INTO battle_session_warriors (session_id, warrior_id)
+    SELECT bw.battle_id, bw.warrior_id FROM battles_warriors bw
+    JOIN battles b ON b.id = bw.battle_id
+    JOIN warriors w ON w.id = bw.warrior_id
+    WHERE bw.battle_id = battleId AND bw.abandoned = false AND bw.warrior_id <> b.leader_id AND w.rank <> 'BOT'
+    ON CONFLICT DO NOTHING;
+    -- plans of team battles that weren't pointed wait in the teams parking lot for the next battle
+    INSERT INTO team_parked_plans (team_id, name, type, reference_id, link, description, acceptance_criteria, issue_provider, external_id)
+    SELECT b.team_id, p.name, p.type, p.reference_id, p.link, p.description, p.acceptance_criteria, p.issue_provider, p.external_id
+    FROM plans p JOIN battles b ON b.id = p.battle_id
+    WHERE p.battle_id = battleId AND b.team_id IS NOT NULL AND p.points = '' AND NOT coalesce(p.split, false)
+    ORDER BY p.sort_order, p.created_date;
+    CALL purge_battle(battleId);
+
+    COMMIT;
+END;
+$$;
+
+-- Delete Battle Bot --
+CREATE OR REPLACE PROCEDURE delete_battle_bot(battleId UUID, botId UUID)
+LANGUAGE plpgsql AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM battles_warriors bw
+        JOIN warriors w ON w.id = bw.warrior_id
+        WHERE bw.battle_id = battleId AND bw.warrior_id = botId AND w.rank = 'BOT'
+    ) THEN
+        RAISE 'Battle bot not found';
+    END IF;
+
+    DELETE FROM battles_warriors WHERE battle_id = battleId AND warrior_id = botId;
+    DELETE FROM api_keys WHERE warrior_id = botId;
+    DELETE FROM warriors WHERE id = botId;
 
     COMMIT;
 END;
@@ -237,10 +1181,11 @@ BEGIN
     SET votes = (
         SELECT json_agg(data)
         FROM (
-            SELECT coalesce(newVote."warriorId", oldVote."warriorId") AS "warriorId", coalesce(newVote.vote, oldVote.vote) AS vote
+            SELECT coalesce(newVote."warriorId", oldVote."warriorId") AS "warriorId", coalesce(newVote.vote, oldVote.vote) AS vote,
+                coalesce(oldVote."createdDate", newVote."createdDate") AS "createdDate", coalesce(newVote."updatedDate", oldVote."updatedDate") AS "updatedDate"
             FROM jsonb_populate_recordset(null::WarriorsVote,p1.votes) AS oldVote
             FULL JOIN jsonb_populate_recordset(null::WarriorsVote,
-                ('[{"warriorId":"'|| warriorsId::TEXT ||'", "vote":"'|| warriorVote ||'"}]')::JSONB
+                jsonb_build_array(jsonb_build_object('warriorId', warriorsId, 'vote', warriorVote, 'createdDate', NOW(), 'updatedDate', NOW()))
             ) AS newVote
             ON newVote."warriorId" = oldVote."warriorId"
         ) data
@@ -259,7 +1204,8 @@ BEGIN
     SET votes = (
         SELECT coalesce(json_agg(data), '[]'::JSON)
         FROM (
-            SELECT coalesce(oldVote."warriorId") AS "warriorId", coalesce(oldVote.vote) AS vote
+            SELECT coalesce(oldVote."warriorId") AS "warriorId", coalesce(oldVote.vote) AS vote,
+                oldVote."createdDate" AS "createdDate", oldVote."updatedDate" AS "updatedDate"
             FROM jsonb_populate_recordset(null::WarriorsVote,p1.votes) AS oldVote
             WHERE oldVote."warriorId" != warriorsId
         ) data
@@ -290,6 +1236,7 @@ BEGIN
 
     UPDATE warriors SET password = warriorPassword, last_active = NOW() WHERE id = matchedWarriorId;
     DELETE FROM warrior_reset WHERE reset_id = resetId;
+    DELETE FROM warrior_sessions WHERE warrior_id = matchedWarriorId;
 
     COMMIT;
 END;
@@ -300,6 +1247,7 @@ CREATE OR REPLACE PROCEDURE update_warrior_password(warriorId UUID, warriorPassw
 LANGUAGE plpgsql AS $$
 BEGIN
     UPDATE warriors SET password = warriorPassword, last_active = NOW() WHERE id = warriorId;
+    DELETE FROM warrior_sessions WHERE warrior_id = warriorId;
 
     COMMIT;
 END;
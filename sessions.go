@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// errLegacyCookie is a warrior cookie from before sessions were stored, holding the warrior ID instead of a token
+var errLegacyCookie = errors.New("legacy warrior cookie")
+
+// sessionCookie starts a session for the warrior on the browser making the request, lasting the days, getting the
+// cookie holding it. Only the session's token is in the cookie so it can be revoked, nil when it couldn't be started
+func (s *server) sessionCookie(r *http.Request, WarriorID string, Days int) *http.Cookie {
+	Token, err := s.database.CreateWarriorSession(WarriorID, r.UserAgent(), Days)
+	if err != nil {
+		log.Println("error starting warrior session : " + err.Error() + "\n")
+		return nil
+	}
+
+	return s.tokenCookie(Token, Days)
+}
+
+// tokenCookie is the cookie holding the session token, lasting the days
+func (s *server) tokenCookie(Token string, Days int) *http.Cookie {
+	encoded, err := s.cookie.Encode(s.config.SecureCookieName, Token)
+	if err != nil {
+		return nil
+	}
+
+	return &http.Cookie{
+		Name:     s.config.SecureCookieName,
+		Value:    encoded,
+		Path:     s.config.PathPrefix + "/",
+		HttpOnly: true,
+		Domain:   s.config.AppDomain,
+		MaxAge:   86400 * Days,
+		Secure:   s.config.SecureCookieFlag,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// cookieSession gets the session held by the request's warrior cookie, errLegacyCookie when the cookie is from
+// before sessions were stored and holds the warrior ID
+func (s *server) cookieSession(r *http.Request) (*database.WarriorSession, error) {
+	cookie, err := r.Cookie(s.config.SecureCookieName)
+	if err != nil {
+		return nil, err
+	}
+	var Token string
+	if err := s.cookie.Decode(s.config.SecureCookieName, cookie.Value, &Token); err != nil {
+		return nil, err
+	}
+	if Token == "" {
+		return nil, errors.New("empty session token")
+	}
+	if _, err := uuid.Parse(Token); err == nil {
+		return nil, errLegacyCookie
+	}
+
+	return s.database.GetSession(Token)
+}
+
+// exchangeLegacyCookie swaps the request's cookie from before sessions were stored for a stored session, so guests
+// who can't log in again keep who they were. Each legacy cookie is only exchanged once
+func (s *server) exchangeLegacyCookie(w http.ResponseWriter, r *http.Request) (*database.WarriorSession, error) {
+	cookie, err := r.Cookie(s.config.SecureCookieName)
+	if err != nil {
+		return nil, err
+	}
+	var WarriorID string
+	if err := s.cookie.Decode(s.config.SecureCookieName, cookie.Value, &WarriorID); err != nil {
+		return nil, err
+	}
+	Warrior, err := s.database.GetWarrior(WarriorID)
+	if err != nil {
+		return nil, err
+	}
+	// the same days createWarriorCookie gives guests and registered warriors
+	Days := 30
+	if Warrior.WarriorRank == "PRIVATE" {
+		Days = 365
+	}
+
+	Token, err := s.database.ExchangeLegacyCookie(WarriorID, cookie.Value, r.UserAgent(), Days)
+	if err != nil {
+		return nil, err
+	}
+	newCookie := s.tokenCookie(Token, Days)
+	if newCookie == nil {
+		return nil, errors.New("unable to encode session cookie")
+	}
+	http.SetCookie(w, newCookie)
+
+	return s.database.GetSession(Token)
+}
+
+// handleWarriorSessionsGet gets the browsers the warrior is logged in on, marking the one asking
+func (s *server) handleWarriorSessionsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WarriorID := mux.Vars(r)["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		Sessions, err := s.database.GetWarriorSessions(WarriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if current, err := s.cookieSession(r); err == nil {
+			for _, ws := range Sessions {
+				ws.Current = ws.SessionID == current.SessionID
+			}
+		}
+
+		RespondWithJSON(w, http.StatusOK, Sessions)
+	}
+}
+
+// handleWarriorSessionDelete revokes one of the warrior's sessions logging that browser out, revoking the session
+// asking logs it out too
+func (s *server) handleWarriorSessionDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		SessionID := vars["sessionId"]
+		if _, err := uuid.Parse(SessionID); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		current, _ := s.cookieSession(r)
+
+		if err := s.database.DeleteWarriorSession(WarriorID, SessionID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if current != nil && current.SessionID == SessionID {
+			s.clearWarriorCookies(w)
+		}
+
+		Sessions, err := s.database.GetWarriorSessions(WarriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Sessions)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestWarriorSessions(t *testing.T) {
+	s, db := newMockServer()
+	router := mux.NewRouter()
+	router.HandleFunc("/api/warrior/{id}/sessions", s.warriorOnly(s.handleWarriorSessionsGet())).Methods("GET")
+	router.HandleFunc("/api/warrior/{id}/sessions/{sessionId}", s.warriorOnly(s.handleWarriorSessionDelete())).Methods("DELETE")
+	router.HandleFunc("/api/auth/logout", s.handleLogout()).Methods("POST")
+
+	// w1 logs in on a laptop and a phone
+	login := func(UserAgent string) *http.Cookie {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/auth", nil)
+		r.Header.Set("User-Agent", UserAgent)
+		s.createWarriorCookie(w, r, true, "w1")
+		return w.Result().Cookies()[0]
+	}
+	laptop, phone := login("Laptop"), login("Phone")
+	request := func(method string, target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, nil)
+		r.AddCookie(cookie)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("GET", "/api/warrior/w1/sessions", laptop)
+	var sessions []*database.WarriorSession
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if w.Code != http.StatusOK || len(sessions) != 2 || !sessions[0].Current || sessions[0].UserAgent != "Laptop" || sessions[1].Current {
+		t.Fatal("Expected both sessions with the laptop's current got ", w.Code, w.Body.String())
+	}
+
+	// the laptop revokes the phone, which is logged out
+	if w := request("DELETE", "/api/warrior/w1/sessions/"+sessions[1].SessionID, laptop); w.Code != http.StatusOK {
+		t.Error("Expected the phone's session to be revoked got ", w.Code)
+	}
+	if w := request("GET", "/api/warrior/w1/sessions", phone); w.Code != http.StatusUnauthorized {
+		t.Error("Expected the revoked session to be refused got ", w.Code)
+	}
+
+	if w := request("DELETE", "/api/warrior/w1/sessions/s1", laptop); w.Code != http.StatusNotFound {
+		t.Error("Expected revoking a session that isn't a UUID to respond 404 got ", w.Code)
+	}
+
+	// cookies from before sessions held the warrior ID, they're exchanged for a session once
+	guestID := "8e8e2c8e-3d0e-4c3f-9b7a-6a1f3c0d9e21"
+	db.Warriors[guestID] = &database.Warrior{WarriorID: guestID, WarriorName: "Guest", WarriorRank: "PRIVATE"}
+	encoded, _ := s.cookie.Encode(s.config.SecureCookieName, guestID)
+	legacy := &http.Cookie{Name: s.config.SecureCookieName, Value: encoded}
+	w = request("GET", "/api/warrior/"+guestID+"/sessions", legacy)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 1 {
+		t.Fatal("Expected a warrior ID cookie to be exchanged for a session got ", w.Code)
+	}
+	if w := request("GET", "/api/warrior/"+guestID+"/sessions", w.Result().Cookies()[0]); w.Code != http.StatusOK {
+		t.Error("Expected the exchanged session to be accepted got ", w.Code)
+	}
+	if w := request("GET", "/api/warrior/"+guestID+"/sessions", legacy); w.Code != http.StatusUnauthorized {
+		t.Error("Expected an exchanged warrior ID cookie to be refused got ", w.Code)
+	}
+
+	request("POST", "/api/auth/logout", laptop)
+	if Sessions, _ := db.GetWarriorSessions("w1"); len(Sessions) != 0 {
+		t.Error("Expected logging out to end the session got ", Sessions)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// how long signed links are valid for
+const (
+	exportLinkTTL = 24 * time.Hour
+	inviteLinkTTL = 7 * 24 * time.Hour
+	feedLinkTTL   = 90 * 24 * time.Hour
+)
+
+// urlSignature is the HMAC of the path and query params (sorted by url.Values.Encode)
+func urlSignature(key []byte, path string, params url.Values) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(path + "?" + params.Encode()))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signURL gets an absolute URL for the application path (without the path prefix) and params
+// that can be used without credentials until it expires, any params it was signed with can't be changed
+func (s *server) signURL(path string, params url.Values, ttl time.Duration) (string, time.Time) {
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	signed := url.Values{}
+	for k, v := range params {
+		signed[k] = v
+	}
+	signed.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	signed.Set("signature", urlSignature([]byte(s.config.SigningKey), s.config.PathPrefix+path, signed))
+
+	return "https://" + s.config.AppDomain + s.config.PathPrefix + path + "?" + signed.Encode(), expires
+}
+
+// verifySignedURL checks the request was made with an unexpired URL from signURL
+func (s *server) verifySignedURL(r *http.Request) error {
+	params := r.URL.Query()
+	signature := params.Get("signature")
+	params.Del("signature")
+
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+	if err != nil || signature == "" {
+		return errors.New("url not signed")
+	}
+
+	expected := urlSignature([]byte(s.config.SigningKey), r.URL.Path, params)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errors.New("invalid url signature")
+	}
+	if time.Now().Unix() > expires {
+		return errors.New("signed url expired")
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSigningServer = &server{config: &ServerConfig{AppDomain: "thunderdome.dev", PathPrefix: "/td", SigningKey: "secret"}}
+
+func TestSignedURL(t *testing.T) {
+	link, _ := testSigningServer.signURL("/api/team/t1/join", url.Values{"warriorId": {"w1"}}, time.Hour)
+	if !strings.HasPrefix(link, "https://thunderdome.dev/td/api/team/t1/join?") {
+		t.Error("Expected an absolute url got ", link)
+	}
+
+	if err := testSigningServer.verifySignedURL(httptest.NewRequest("POST", link, nil)); err != nil {
+		t.Error("Expected the signed url to verify got ", err)
+	}
+
+	tampered := strings.Replace(link, "warriorId=w1", "warriorId=w2", 1)
+	if err := testSigningServer.verifySignedURL(httptest.NewRequest("POST", tampered, nil)); err == nil {
+		t.Error("Expected a changed param to fail verification")
+	}
+
+	other := strings.Replace(link, "/t1/", "/t2/", 1)
+	if err := testSigningServer.verifySignedURL(httptest.NewRequest("POST", other, nil)); err == nil {
+		t.Error("Expected a different path to fail verification")
+	}
+}
+
+func TestSignedURLExpired(t *testing.T) {
+	link, _ := testSigningServer.signURL("/api/warrior/w1/battles/export", nil, -time.Minute)
+
+	if err := testSigningServer.verifySignedURL(httptest.NewRequest("GET", link, nil)); err == nil {
+		t.Error("Expected an expired url to fail verification")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// smsVoteNamespace is the UUID namespace the vote IDs of texted votes are derived in
+var smsVoteNamespace = uuid.MustParse("5b1f6c57-2f0c-4f2a-9d43-3c1d6a0e7b84")
+
+// e164Phone matches a phone number in the international format twilio sends them in
+var e164Phone = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// normalizePhone strips the formatting from a phone number, erroring unless it includes the country code
+func normalizePhone(phone string) (string, bool) {
+	normalized := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(phone)
+	if strings.HasPrefix(normalized, "00") {
+		normalized = "+" + normalized[2:]
+	}
+
+	return normalized, e164Phone.MatchString(normalized)
+}
+
+// twilioSignature is the signature twilio sends in the X-Twilio-Signature header, the HMAC-SHA1
+// of the webhook URL followed by each posted param name and value sorted by name
+func twilioSignature(authToken string, webhookURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	data := webhookURL
+	for _, k := range keys {
+		for _, v := range params[k] {
+			data += k + v
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(data))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// smsWebhookURL is the URL twilio is configured to post incoming messages to
+func (s *server) smsWebhookURL() string {
+	return "https://" + s.config.AppDomain + s.config.PathPrefix + "/api/sms/twilio"
+}
+
+// respondWithSMS replies to the texter with TwiML
+func respondWithSMS(w http.ResponseWriter, text string) {
+	var reply strings.Builder
+	_ = xml.EscapeText(&reply, []byte(text))
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Response><Message>` + reply.String() + `</Message></Response>`))
+}
+
+// smsVoteValue matches the texted vote to one of the battles point values ignoring case and surrounding space
+func smsVoteValue(text string, pointValues []string) (string, bool) {
+	text = strings.TrimSpace(text)
+	for _, pv := range pointValues {
+		if strings.EqualFold(text, pv) {
+			return pv, true
+		}
+	}
+
+	return "", false
+}
+
+// smsVoteID derives the vote ID of a texted vote from twilio's message id so a retried webhook is the same vote,
+// empty without one
+func smsVoteID(MessageSid string) string {
+	if MessageSid == "" {
+		return ""
+	}
+
+	return uuid.NewSHA1(smsVoteNamespace, []byte(MessageSid)).String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	if phone, ok := normalizePhone("+1 (555) 010-9999"); !ok || phone != "+15550109999" {
+		t.Error("Expected +15550109999 got ", phone, ok)
+	}
+	if phone, ok := normalizePhone("0049 30 1234567"); !ok || phone != "+49301234567" {
+		t.Error("Expected +49301234567 got ", phone, ok)
+	}
+	if _, ok := normalizePhone("555-0109"); ok {
+		t.Error("Expected a number without a country code to be invalid")
+	}
+}
+
+func TestTwilioSignature(t *testing.T) {
+	params := url.Values{"From": {"+15550109999"}, "Body": {"5"}, "MessageSid": {"SM1"}}
+	signature := twilioSignature("token", "https://thunderdome.dev/api/sms/twilio", params)
+
+	params.Set("Body", "8")
+	if twilioSignature("token", "https://thunderdome.dev/api/sms/twilio", params) == signature {
+		t.Error("Expected a changed param to change the signature")
+	}
+	if twilioSignature("other", "https://thunderdome.dev/api/sms/twilio", params) == twilioSignature("token", "https://thunderdome.dev/api/sms/twilio", params) {
+		t.Error("Expected a different auth token to change the signature")
+	}
+}
+
+func TestSMSVoteValue(t *testing.T) {
+	if vote, ok := smsVoteValue(" 1/2\n", []string{"1/2", "1", "?"}); !ok || vote != "1/2" {
+		t.Error("Expected 1/2 got ", vote, ok)
+	}
+	if _, ok := smsVoteValue("4", []string{"1/2", "1", "?"}); ok {
+		t.Error("Expected a value not allowed in the battle to be invalid")
+	}
+}
+
+func TestSMSVoteID(t *testing.T) {
+	VoteID := smsVoteID("SM1")
+	if _, err := uuid.Parse(VoteID); err != nil || smsVoteID("SM1") != VoteID || smsVoteID("SM2") == VoteID {
+		t.Error("Expected a stable UUID per message got ", VoteID)
+	}
+	if smsVoteID("") != "" {
+		t.Error("Expected no vote ID without a message id")
+	}
+}
+
+func TestRespondWithSMS(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondWithSMS(w, "Reply with one of <1>, & ?")
+
+	if !strings.Contains(w.Body.String(), "<Message>Reply with one of &lt;1&gt;, &amp; ?</Message>") {
+		t.Error("Expected escaped TwiML got ", w.Body.String())
+	}
+}
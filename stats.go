@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// WarriorStats is a warrior's year in estimation
+type WarriorStats struct {
+	Year          int `json:"year"`
+	BattlesJoined int `json:"battlesJoined"`
+	BattlesLed    int `json:"battlesLed"`
+	VotesCast     int `json:"votesCast"`
+	// PlansPointed are the plans voted on that were given points, the ones agreement is counted on
+	PlansPointed int `json:"plansPointed"`
+	// AgreementRate is the share of PlansPointed where the warrior voted the points the plan was given
+	AgreementRate      float64 `json:"agreementRate"`
+	FavoritePointValue string  `json:"favoritePointValue"`
+	// AgreementStreak is the most plans in a row where the warrior voted the points the plan was given
+	AgreementStreak int `json:"agreementStreak"`
+	// WeekStreak is the most weeks in a row the warrior voted in
+	WeekStreak int `json:"weekStreak"`
+}
+
+// newWarriorStats works out the stats from the warrior's votes, oldest first
+func newWarriorStats(Year int, BattlesJoined int, BattlesLed int, Votes []*database.WarriorVote) *WarriorStats {
+	stats := &WarriorStats{
+		Year:          Year,
+		BattlesJoined: BattlesJoined,
+		BattlesLed:    BattlesLed,
+		VotesCast:     len(Votes),
+	}
+
+	agreed, streak := 0, 0
+	counts := make(map[string]int)
+	weeks := make(map[time.Time]bool)
+	for _, v := range Votes {
+		counts[v.VoteValue]++
+		weeks[weekStart(v.VotedDate)] = true
+
+		if v.Points == "" {
+			continue
+		}
+		stats.PlansPointed++
+		if v.VoteValue == v.Points {
+			agreed++
+			streak++
+			if streak > stats.AgreementStreak {
+				stats.AgreementStreak = streak
+			}
+		} else {
+			streak = 0
+		}
+	}
+	if stats.PlansPointed > 0 {
+		stats.AgreementRate = float64(agreed) / float64(stats.PlansPointed)
+	}
+
+	// ties go to the lowest sorting value so the favorite doesn't change between requests
+	for value, count := range counts {
+		if count > counts[stats.FavoritePointValue] || (count == counts[stats.FavoritePointValue] && value < stats.FavoritePointValue) {
+			stats.FavoritePointValue = value
+		}
+	}
+
+	starts := make([]time.Time, 0, len(weeks))
+	for start := range weeks {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	run := 0
+	for i, start := range starts {
+		if i > 0 && start.Sub(starts[i-1]) == 7*24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		if run > stats.WeekStreak {
+			stats.WeekStreak = run
+		}
+	}
+
+	return stats
+}
+
+// weekStart gets the Monday the date's week started on, in UTC
+func weekStart(Date time.Time) time.Time {
+	Date = Date.UTC()
+	day := time.Date(Date.Year(), Date.Month(), Date.Day(), 0, 0, 0, 0, time.UTC)
+	// Sunday is the last day of the week
+	offset := (int(day.Weekday()) + 6) % 7
+
+	return day.AddDate(0, 0, -offset)
+}
+
+// handleWarriorStatsGet gets the warrior's stats for the year query param, the current year by default
+func (s *server) handleWarriorStatsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		WarriorID := vars["id"]
+		warriorCookieID := r.Context().Value(contextKeyWarriorID).(string)
+
+		if WarriorID != warriorCookieID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		Year := time.Now().UTC().Year()
+		if y := r.URL.Query().Get("year"); y != "" {
+			var err error
+			if Year, err = strconv.Atoi(y); err != nil || Year < 2000 || Year > 9999 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		From := time.Date(Year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		To := From.AddDate(1, 0, 0)
+
+		Votes, err := s.database.GetWarriorVoteHistory(WarriorID, From, To)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		Joined, Led, err := s.database.CountWarriorBattles(WarriorID, From, To)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, newWarriorStats(Year, Joined, Led, Votes))
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+func TestNewWarriorStats(t *testing.T) {
+	// Monday 5 January 2026
+	monday := time.Date(2026, time.January, 5, 10, 0, 0, 0, time.UTC)
+	votes := []*database.WarriorVote{
+		{VoteValue: "3", Points: "3", VotedDate: monday},
+		{VoteValue: "5", Points: "5", VotedDate: monday.AddDate(0, 0, 6)},
+		{VoteValue: "5", Points: "5", VotedDate: monday.AddDate(0, 0, 7)},
+		{VoteValue: "8", Points: "5", VotedDate: monday.AddDate(0, 0, 8)},
+		{VoteValue: "3", Points: "", VotedDate: monday.AddDate(0, 0, 28)},
+		{VoteValue: "3", Points: "3", VotedDate: monday.AddDate(0, 0, 29)},
+	}
+
+	stats := newWarriorStats(2026, 4, 1, votes)
+	if stats.VotesCast != 6 || stats.PlansPointed != 5 || stats.AgreementRate != 0.8 {
+		t.Error("Unexpected counts ", stats.VotesCast, stats.PlansPointed, stats.AgreementRate)
+	}
+	if stats.FavoritePointValue != "3" {
+		t.Error("Expected the favorite to be 3 got ", stats.FavoritePointValue)
+	}
+	if stats.AgreementStreak != 3 {
+		t.Error("Expected an agreement streak of 3 got ", stats.AgreementStreak)
+	}
+	// the first two weeks in a row, then a gap of two weeks
+	if stats.WeekStreak != 2 {
+		t.Error("Expected a week streak of 2 got ", stats.WeekStreak)
+	}
+
+	empty := newWarriorStats(2026, 0, 0, nil)
+	if empty.VotesCast != 0 || empty.AgreementRate != 0 || empty.FavoritePointValue != "" || empty.WeekStreak != 0 {
+		t.Error("Unexpected stats without votes ", empty)
+	}
+}
+
+func TestWeekStart(t *testing.T) {
+	sunday := time.Date(2026, time.January, 11, 23, 0, 0, 0, time.UTC)
+	if got := weekStart(sunday); !got.Equal(time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected sunday to be in the week starting monday the 5th got ", got)
+	}
+}
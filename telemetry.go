@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// telemetryClient posts telemetry reports, a report that doesn't go through is sent again the next week
+var telemetryClient = &http.Client{Timeout: 10 * time.Second}
+
+// telemetryReport is the anonymous usage sent to the telemetry endpoint, it has no names, emails, addresses or
+// anything else entered into the instance
+type telemetryReport struct {
+	// InstanceID tells reports of the same instance apart, it's derived one way from the cookie hashkey
+	InstanceID string          `json:"instanceId"`
+	Version    string          `json:"version"`
+	GoVersion  string          `json:"goVersion"`
+	OS         string          `json:"os"`
+	Arch       string          `json:"arch"`
+	AuthMethod string          `json:"authMethod"`
+	Counts     map[string]int  `json:"counts"`
+	Features   map[string]bool `json:"features"`
+}
+
+// telemetryEnabled reports whether the admin opted in to sending telemetry
+func telemetryEnabled() bool {
+	return viper.GetBool("telemetry.enabled") && viper.GetString("telemetry.endpoint") != ""
+}
+
+// telemetryReport gathers the instance's anonymous usage
+func (s *server) telemetryReport() (*telemetryReport, error) {
+	stats, err := s.database.GetAppStats()
+	if err != nil {
+		return nil, err
+	}
+
+	id := sha256.Sum256([]byte("thunderdome-telemetry:" + s.config.SigningKey))
+
+	return &telemetryReport{
+		InstanceID: hex.EncodeToString(id[:16]),
+		Version:    s.config.Version,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		AuthMethod: viper.GetString("auth.method"),
+		Counts: map[string]int{
+			"registeredWarriors":   stats.RegisteredCount,
+			"unregisteredWarriors": stats.UnregisteredCount,
+			"battles":              stats.BattleCount,
+			"plans":                stats.PlanCount,
+		},
+		Features: map[string]bool{
+			"calendars":     len(s.calendars) > 0,
+			"encryption":    viper.GetString("config.encryption_keys") != "",
+			"externalApi":   viper.GetBool("config.allow_external_api"),
+			"federation":    s.federation != nil,
+			"gamification":  viper.GetBool("config.gamification"),
+			"guests":        viper.GetBool("config.allow_guests"),
+			"inboundEmail":  s.config.InboundEmailSecret != "",
+			"jiraImport":    viper.GetBool("config.allow_jira_import"),
+			"license":       s.license != nil,
+			"linkPreviews":  s.unfurler != nil,
+			"moderation":    s.moderation != nil,
+			"recordBattles": viper.GetBool("config.record_battles"),
+			"registration":  viper.GetBool("config.allow_registration"),
+			"sentry":        s.sentry != nil,
+			"storage":       s.storage != nil,
+			"teamDomains":   len(s.teamDomains()) > 0,
+			"textVoting":    s.config.TwilioAuthToken != "",
+			"updateCheck":   s.releases != nil,
+		},
+	}, nil
+}
+
+// sendTelemetry posts the anonymous usage report to the telemetry endpoint
+func (s *server) sendTelemetry() error {
+	report, err := s.telemetryReport()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	resp, err := telemetryClient.Post(viper.GetString("telemetry.endpoint"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint responded %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// handleTelemetryPreview shows admins exactly what is sent to the telemetry endpoint, also before they opt in
+func (s *server) handleTelemetryPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := s.telemetryReport()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"enabled":  telemetryEnabled(),
+			"endpoint": viper.GetString("telemetry.endpoint"),
+			"report":   report,
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/spf13/viper"
+)
+
+// telemetryMock has application stats to report
+type telemetryMock struct {
+	*database.Mock
+}
+
+func (m *telemetryMock) GetAppStats() (*database.ApplicationStats, error) {
+	return &database.ApplicationStats{RegisteredCount: 12, UnregisteredCount: 30, BattleCount: 7, PlanCount: 64}, nil
+}
+
+func TestSendTelemetry(t *testing.T) {
+	s, db := newMockServer()
+	s.database = &telemetryMock{Mock: db}
+	s.config.Version = "v2.1.0"
+	s.config.SigningKey = "secret"
+
+	var sent telemetryReport
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+	}))
+	defer endpoint.Close()
+	viper.Set("telemetry.endpoint", endpoint.URL)
+	defer viper.Set("telemetry.endpoint", nil)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/admin/telemetry", nil)
+	r.Header.Set(apiKeyHeaderName, "admin1")
+	s.adminOnly(s.handleTelemetryPreview())(w, r)
+	var preview struct {
+		Enabled bool            `json:"enabled"`
+		Report  telemetryReport `json:"report"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil || w.Code != http.StatusOK {
+		t.Fatal("Expected the preview got ", w.Code, w.Body.String())
+	}
+	if preview.Enabled || preview.Report.Counts["plans"] != 64 || preview.Report.InstanceID == "" {
+		t.Error("Expected a preview of the report while telemetry is off got ", preview)
+	}
+
+	if err := s.sendTelemetry(); err != nil {
+		t.Fatal(err)
+	}
+	if sent.InstanceID != preview.Report.InstanceID || sent.Version != "v2.1.0" || sent.Counts["registeredWarriors"] != 12 {
+		t.Error("Expected the previewed report to be sent got ", sent)
+	}
+}
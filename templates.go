@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// The template gallery is the battle templates bundled here along with the ones admins add, each being a battle
+// document like the battle export for warriors to start their battles from
+
+//go:embed templates
+var bundledTemplates embed.FS
+
+// getBundledTemplates reads the templates bundled with Thunderdome, each identified by its file name
+func getBundledTemplates() ([]*database.BattleTemplate, error) {
+	entries, err := bundledTemplates.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]*database.BattleTemplate, 0, len(entries))
+	for _, entry := range entries {
+		data, err := bundledTemplates.ReadFile(path.Join("templates", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var t database.BattleTemplate
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		t.TemplateID = strings.TrimSuffix(entry.Name(), ".json")
+		t.Builtin = true
+		templates = append(templates, &t)
+	}
+
+	return templates, nil
+}
+
+// handleBattleTemplatesGet gets the template gallery, the bundled templates first
+func (s *server) handleBattleTemplatesGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		templates, err := getBundledTemplates()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, append(templates, s.database.GetBattleTemplates()...))
+	}
+}
+
+// handleBattleTemplateCreate handles an admin adding a template to the gallery, its document checked like an import
+func (s *server) handleBattleTemplateCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warriorID := r.Context().Value(contextKeyWarriorID).(string)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+		var keyVal struct {
+			Name        string          `json:"name"`
+			Description string          `json:"description"`
+			Document    json.RawMessage `json:"document"`
+		}
+		jsonErr := json.Unmarshal(body, &keyVal) // check for errors
+		if jsonErr != nil || keyVal.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := readBattleDocument(bytes.NewReader(keyVal.Document)); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		Template, err := s.database.CreateBattleTemplate(truncateRunes(keyVal.Name, 256), keyVal.Description, keyVal.Document, warriorID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, Template)
+	}
+}
+
+// handleBattleTemplateDelete handles an admin removing a template they added from the gallery
+func (s *server) handleBattleTemplateDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		TemplateID := vars["templateId"]
+
+		if _, err := bundledTemplates.ReadFile(path.Join("templates", TemplateID+".json")); err == nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "bundled templates can't be deleted"})
+			return
+		}
+
+		err := s.database.DeleteBattleTemplate(TemplateID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestBundledTemplates(t *testing.T) {
+	templates, err := getBundledTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) == 0 {
+		t.Fatal("Expected templates to be bundled")
+	}
+	for _, tmpl := range templates {
+		if tmpl.TemplateID == "" || tmpl.Name == "" || !tmpl.Builtin {
+			t.Error("Unexpected bundled template ", tmpl)
+		}
+		// the gallery's templates are imported like any battle document
+		if _, err := readBattleDocument(bytes.NewReader(tmpl.Document)); err != nil {
+			t.Error("Expected template ", tmpl.TemplateID, " to be a valid battle document got ", err)
+		}
+	}
+}
+
+// templateMock keeps the templates admins add in memory
+type templateMock struct {
+	*database.Mock
+	templates []*database.BattleTemplate
+}
+
+func (m *templateMock) CreateBattleTemplate(Name string, Description string, Document json.RawMessage, CreatedBy string) (*database.BattleTemplate, error) {
+	t := &database.BattleTemplate{TemplateID: "t1", Name: Name, Description: Description, Document: Document}
+	m.templates = append(m.templates, t)
+	return t, nil
+}
+
+func (m *templateMock) GetBattleTemplates() []*database.BattleTemplate {
+	return m.templates
+}
+
+func TestHandleBattleTemplates(t *testing.T) {
+	s, db := newMockServer()
+	mock := &templateMock{Mock: db}
+	s.database = mock
+	router := mux.NewRouter()
+	router.HandleFunc("/api/templates", s.handleBattleTemplatesGet()).Methods("GET")
+	router.HandleFunc("/api/admin/templates", s.adminOnly(s.handleBattleTemplateCreate())).Methods("POST")
+	router.HandleFunc("/api/admin/templates/{templateId}", s.adminOnly(s.handleBattleTemplateDelete())).Methods("DELETE")
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"name": "Retro", "document": {"schemaVersion": 1, "battle": {"name": "Retro"}}}`, http.StatusOK},
+		{`{"name": "Retro", "document": {"schemaVersion": 9, "battle": {"name": "Retro"}}}`, http.StatusBadRequest},
+		{`{"name": "", "document": {"schemaVersion": 1, "battle": {"name": "Retro"}}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/admin/templates", strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, "admin1")
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/admin/templates", strings.NewReader(tests[0].body))
+	r.Header.Set(apiKeyHeaderName, "key1")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Error("Expected only admins to add templates got ", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/templates", nil))
+	var templates []*database.BattleTemplate
+	json.NewDecoder(w.Body).Decode(&templates)
+	if w.Code != http.StatusOK || len(templates) < 2 || !templates[0].Builtin || templates[len(templates)-1].TemplateID != "t1" {
+		t.Error("Unexpected templates ", w.Code, templates)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("DELETE", "/api/admin/templates/sprint-planning", nil)
+	r.Header.Set(apiKeyHeaderName, "admin1")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("Expected bundled templates not to be deleted got ", w.Code)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+const teamDomainsTTL = time.Minute
+
+var (
+	teamDomainPathPattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+	teamDomainColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	// reservedTeamPaths are the first path segments of the instance's own routes, a team can't be served at them
+	reservedTeamPaths = []string{
+		"api", "static", "img", "lang", "avatar", "debug", "lite", "register", "login", "reset-password",
+		"verify-account", "profile", "admin", "battles", "battle", "games", "game",
+	}
+)
+
+// teamDomains caches the teams' hostnames and path prefixes so routing a request doesn't query them
+type teamDomains struct {
+	mu      sync.Mutex
+	domains []*database.TeamDomain
+	expires time.Time
+}
+
+// tenant is the team a request came in for at its hostname or path prefix
+type tenant struct {
+	domain *database.TeamDomain
+	// pathPrefix is the path prefix the UI is served at for the team
+	pathPrefix string
+}
+
+// teamDomains gets the teams' hostnames and path prefixes, loading them when they aren't cached
+func (s *server) teamDomains() []*database.TeamDomain {
+	s.tenants.mu.Lock()
+	defer s.tenants.mu.Unlock()
+	if s.tenants.domains != nil && time.Now().Before(s.tenants.expires) {
+		return s.tenants.domains
+	}
+
+	domains, err := s.database.GetTeamDomains()
+	if err != nil {
+		return s.tenants.domains
+	}
+	s.tenants.domains = domains
+	s.tenants.expires = time.Now().Add(teamDomainsTTL)
+
+	return domains
+}
+
+// forgetTeamDomains drops the cached hostnames and path prefixes, after an admin changes them
+func (s *server) forgetTeamDomains() {
+	s.tenants.mu.Lock()
+	s.tenants.domains = nil
+	s.tenants.mu.Unlock()
+}
+
+// requestTenant gets the team the request came in for at its hostname or path prefix, nil when it came in for
+// the instance itself
+func requestTenant(r *http.Request) *tenant {
+	t, _ := r.Context().Value(contextKeyTenant).(*tenant)
+	return t
+}
+
+// requestTeamID gets the team given, or when none is the team the request came in for
+func requestTeamID(r *http.Request, TeamID string) string {
+	if TeamID != "" {
+		return TeamID
+	}
+	if t := requestTenant(r); t != nil {
+		return t.domain.TeamID
+	}
+
+	return ""
+}
+
+// tenantRouting serves the requests that come in at a team's hostname or path prefix, the path prefix is removed
+// before routing so the team's UI and API are served by the same routes as the instance's
+func (s *server) tenantRouting(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.ToLower(host)
+
+		var t *tenant
+		for _, td := range s.teamDomains() {
+			if td.Host != "" && td.Host == host {
+				t = &tenant{domain: td, pathPrefix: s.config.PathPrefix}
+				break
+			}
+		}
+		if t == nil {
+			for _, td := range s.teamDomains() {
+				if td.PathPrefix == "" {
+					continue
+				}
+				prefix := s.config.PathPrefix + "/" + td.PathPrefix
+				if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+					continue
+				}
+				u := *r.URL
+				u.Path = s.config.PathPrefix + strings.TrimPrefix(r.URL.Path, prefix)
+				if u.Path == s.config.PathPrefix {
+					u.Path += "/"
+				}
+				u.RawPath = ""
+				r = r.Clone(r.Context())
+				r.URL = &u
+				t = &tenant{domain: td, pathPrefix: prefix}
+				break
+			}
+		}
+
+		if t != nil {
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyTenant, t))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// validateTeamDomain checks the team's hostname is under the instance's domain so cookies are shared with it,
+// and its path prefix doesn't shadow one of the instance's routes
+func (s *server) validateTeamDomain(td *database.TeamDomain) error {
+	td.Host = strings.ToLower(strings.TrimSpace(td.Host))
+	td.PathPrefix = strings.ToLower(strings.Trim(td.PathPrefix, " /"))
+
+	if td.Host == "" && td.PathPrefix == "" {
+		return errors.New("host or pathPrefix is required")
+	}
+	if td.Host != "" && (s.config.AppDomain == "" || !strings.HasSuffix(td.Host, "."+s.config.AppDomain)) {
+		return errors.New("host must be a subdomain of " + s.config.AppDomain)
+	}
+	if td.PathPrefix != "" && (!teamDomainPathPattern.MatchString(td.PathPrefix) || contains(reservedTeamPaths, td.PathPrefix)) {
+		return errors.New("pathPrefix " + td.PathPrefix + " isn't allowed")
+	}
+	if td.PrimaryColor != "" && !teamDomainColorPattern.MatchString(td.PrimaryColor) {
+		return errors.New("primaryColor must be a hex color like #1e40af")
+	}
+	if td.LogoURL != "" {
+		u, err := url.Parse(td.LogoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("logoUrl must be an http or https URL")
+		}
+	}
+	if td.Defaults != nil {
+		return validateBattleDefaults(td.Defaults)
+	}
+
+	return nil
+}
+
+// handleTeamDomainsGet gets the hostnames and path prefixes teams are served at
+func (s *server) handleTeamDomainsGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domains, err := s.database.GetTeamDomains()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, domains)
+	}
+}
+
+// handleTeamDomainUpdate handles an admin serving a team at its own hostname or path prefix with its own branding
+// and battle defaults
+func (s *server) handleTeamDomainUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		body, _ := ioutil.ReadAll(r.Body) // check for errors
+
+		var td database.TeamDomain
+		if err := json.Unmarshal(body, &td); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		td.TeamID = vars["teamId"]
+		if err := s.validateTeamDomain(&td); err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		domains, err := s.database.GetTeamDomains()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, other := range domains {
+			if other.TeamID == td.TeamID {
+				continue
+			}
+			if (td.Host != "" && other.Host == td.Host) || (td.PathPrefix != "" && other.PathPrefix == td.PathPrefix) {
+				RespondWithJSON(w, http.StatusConflict, map[string]string{"error": "another team is served at the host or pathPrefix"})
+				return
+			}
+		}
+
+		if err := s.database.SetTeamDomain(&td); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.forgetTeamDomains()
+
+		RespondWithJSON(w, http.StatusOK, td)
+	}
+}
+
+// handleTeamDomainDelete handles an admin no longer serving a team at its own hostname or path prefix
+func (s *server) handleTeamDomainDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := s.database.DeleteTeamDomain(vars["teamId"]); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.forgetTeamDomains()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+func TestTenantRouting(t *testing.T) {
+	s, db := newMockServer()
+	s.config.PathPrefix = "/td"
+	db.Domains = []*database.TeamDomain{
+		{TeamID: "t1", Host: "sales.thunderdome.dev"},
+		{TeamID: "t2", PathPrefix: "support"},
+	}
+	router := mux.NewRouter().PathPrefix("/td").Subrouter()
+	var routed *http.Request
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed = r
+	})
+	handler := s.tenantRouting(router)
+
+	tests := []struct {
+		host       string
+		path       string
+		wantPath   string
+		wantTeam   string
+		wantPrefix string
+	}{
+		{"sales.thunderdome.dev:8080", "/td/battle/b1", "/td/battle/b1", "t1", "/td"},
+		{"thunderdome.dev", "/td/support/api/battles", "/td/api/battles", "t2", "/td/support"},
+		{"thunderdome.dev", "/td/support", "/td/", "t2", "/td/support"},
+		{"thunderdome.dev", "/td/supportive/battle/b1", "/td/supportive/battle/b1", "", ""},
+		{"thunderdome.dev", "/td/battle/b1", "/td/battle/b1", "", ""},
+	}
+	for _, tt := range tests {
+		routed = nil
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Host = tt.host
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if routed == nil || routed.URL.Path != tt.wantPath {
+			t.Error("Expected ", tt.host, tt.path, " to be routed to ", tt.wantPath, " got ", routed)
+			continue
+		}
+		tenant := requestTenant(routed)
+		if tt.wantTeam == "" && tenant != nil {
+			t.Error("Expected ", tt.host, tt.path, " not to be routed to a team got ", tenant.domain.TeamID)
+		}
+		if tt.wantTeam != "" && (tenant == nil || tenant.domain.TeamID != tt.wantTeam || tenant.pathPrefix != tt.wantPrefix) {
+			t.Error("Expected ", tt.host, tt.path, " to be routed to ", tt.wantTeam, tt.wantPrefix, " got ", tenant)
+		}
+	}
+}
+
+func TestHandleTeamDomainUpdate(t *testing.T) {
+	s, db := newMockServer()
+	s.config.AppDomain = "thunderdome.dev"
+	db.Domains = []*database.TeamDomain{{TeamID: "t2", PathPrefix: "support"}}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/admin/domains/{teamId}", s.adminOnly(s.handleTeamDomainUpdate()))
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"host": "Sales.thunderdome.dev", "pathPrefix": "/sales/", "appName": "Sales Poker", "primaryColor": "#1e40af"}`, http.StatusOK},
+		{`{"appName": "Sales Poker"}`, http.StatusBadRequest},
+		{`{"host": "sales.example.com"}`, http.StatusBadRequest},
+		{`{"pathPrefix": "api"}`, http.StatusBadRequest},
+		{`{"pathPrefix": "sales/eu"}`, http.StatusBadRequest},
+		{`{"pathPrefix": "sales", "primaryColor": "blue"}`, http.StatusBadRequest},
+		{`{"pathPrefix": "sales", "logoUrl": "javascript:alert(1)"}`, http.StatusBadRequest},
+		{`{"pathPrefix": "sales", "defaults": {"pointValuesAllowed": []}}`, http.StatusBadRequest},
+		{`{"pathPrefix": "support"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/api/admin/domains/t1", strings.NewReader(tt.body))
+		r.Header.Set(apiKeyHeaderName, "admin1")
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.body, " to respond ", tt.status, " got ", w.Code)
+		}
+	}
+
+	if len(db.Domains) != 2 || db.Domains[1].Host != "sales.thunderdome.dev" || db.Domains[1].PathPrefix != "sales" {
+		t.Error("Expected the valid domain to be saved normalized got ", db.Domains)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseNetworks parses a comma separated list of CIDRs, a bare address being a network of its own
+func parseNetworks(CIDRs string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(CIDRs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.New("invalid network " + cidr)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// inNetworks checks whether the address is in one of the networks
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP gets the address of the client making the request, taken from X-Forwarded-For when the request
+// came through one of the trusted proxies, skipping the proxies along the way
+func clientIP(r *http.Request, proxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !inNetworks(ip, proxies) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !inNetworks(hop, proxies) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// loginThrottle limits how many times each address attempts to log in, register or reset a password in a window,
+// addresses in the trusted networks get their own limit which is none by default
+type loginThrottle struct {
+	mu        sync.Mutex
+	attempts  map[string]*throttleWindow
+	lastSweep time.Time
+
+	window       time.Duration
+	limit        int
+	trustedLimit int
+	trusted      []*net.IPNet
+	proxies      []*net.IPNet
+}
+
+// throttleWindow is the attempts an address has made since the window started
+type throttleWindow struct {
+	started  time.Time
+	attempts int
+}
+
+// allow records an attempt from the address, reporting whether it's within the limit and if not how long
+// until it is
+func (t *loginThrottle) allow(ip net.IP, now time.Time) (bool, time.Duration) {
+	limit := t.limit
+	if ip != nil && inNetworks(ip, t.trusted) {
+		limit = t.trustedLimit
+	}
+	if limit <= 0 {
+		return true, 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// windows that have passed are dropped now and then so the addresses seen don't pile up
+	if now.Sub(t.lastSweep) > t.window {
+		for key, w := range t.attempts {
+			if now.Sub(w.started) >= t.window {
+				delete(t.attempts, key)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	key := ip.String()
+	w, ok := t.attempts[key]
+	if !ok || now.Sub(w.started) >= t.window {
+		w = &throttleWindow{started: now}
+		t.attempts[key] = w
+	}
+	if w.attempts >= limit {
+		return false, w.started.Add(t.window).Sub(now)
+	}
+	w.attempts++
+
+	return true, 0
+}
+
+// throttled refuses requests from addresses that have used up their login attempts for the window
+func (s *server) throttled(h http.HandlerFunc) http.HandlerFunc {
+	return rateLimited(s.loginThrottle, h)
+}
+
+// rateLimited refuses requests from addresses that have used up their attempts of the throttle for the window,
+// a nil throttle allowing all of them
+func rateLimited(t *loginThrottle, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if t != nil {
+			ok, retryAfter := t.allow(clientIP(r, t.proxies), time.Now())
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		h(w, r)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := parseNetworks("10.0.0.0/8, 192.168.1.7,,fd00::/8")
+	if err != nil || len(networks) != 3 {
+		t.Fatal("Unexpected networks ", networks, err)
+	}
+	for ip, want := range map[string]bool{"10.1.2.3": true, "192.168.1.7": true, "192.168.1.8": false, "fd00::1": true, "8.8.8.8": false} {
+		if inNetworks(net.ParseIP(ip), networks) != want {
+			t.Error("Expected ", ip, " in networks to be ", want)
+		}
+	}
+
+	if _, err := parseNetworks("10.0.0.0/33"); err == nil {
+		t.Error("Expected an invalid network to be refused")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := parseNetworks("10.0.0.1,10.0.0.2")
+	tests := []struct {
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"203.0.113.9:1234", "", "203.0.113.9"},
+		// only trusted proxies are believed
+		{"203.0.113.9:1234", "10.10.10.10", "203.0.113.9"},
+		{"10.0.0.1:1234", "198.51.100.4", "198.51.100.4"},
+		// a client can't spoof an address ahead of the proxies
+		{"10.0.0.1:1234", "10.10.10.10, 198.51.100.4, 10.0.0.2", "198.51.100.4"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/auth", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if ip := clientIP(r, proxies); ip.String() != tt.want {
+			t.Error("Expected ", tt.want, " got ", ip)
+		}
+	}
+}
+
+func TestHandleThrottled(t *testing.T) {
+	s, _ := newMockServer()
+	trusted, _ := parseNetworks("10.0.0.0/8")
+	s.loginThrottle = &loginThrottle{
+		attempts: make(map[string]*throttleWindow),
+		window:   time.Minute,
+		limit:    2,
+		trusted:  trusted,
+	}
+	handler := s.throttled(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		remote string
+		status int
+	}{
+		{"203.0.113.9:1234", http.StatusOK},
+		{"203.0.113.9:1234", http.StatusOK},
+		{"203.0.113.9:1234", http.StatusTooManyRequests},
+		{"198.51.100.4:1234", http.StatusOK},
+		{"10.1.2.3:1234", http.StatusOK},
+		{"10.1.2.3:1234", http.StatusOK},
+		{"10.1.2.3:1234", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/auth", nil)
+		r.RemoteAddr = tt.remote
+		handler(w, r)
+
+		if w.Code != tt.status {
+			t.Error("Expected ", tt.status, " from ", tt.remote, " got ", w.Code)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("Expected a Retry-After header")
+		}
+	}
+
+	// the window passing lets the address try again
+	ok, _ := s.loginThrottle.allow(net.ParseIP("203.0.113.9"), time.Now().Add(time.Minute))
+	if !ok {
+		t.Error("Expected the address to be allowed once the window passed")
+	}
+}
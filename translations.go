@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+// preferredLocales gets the locales the request asks for in order of preference,
+// the locale query param first and then the Accept-Language header
+func preferredLocales(r *http.Request) []string {
+	var Locales []string
+	if l := r.URL.Query().Get("locale"); l != "" {
+		Locales = append(Locales, l)
+	}
+	for _, tag := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		// weights are ignored, browsers list languages in the order they prefer them
+		tag = strings.TrimSpace(strings.SplitN(tag, ";", 2)[0])
+		if tag != "" && tag != "*" {
+			Locales = append(Locales, tag)
+		}
+	}
+
+	return Locales
+}
+
+// planTranslation gets the plans translation closest to the locales, a translation for just the language
+// (de) serving regional locales (de-AT) and vice versa
+func planTranslation(Plan *database.Plan, Locales []string) *database.PlanTranslation {
+	for _, Locale := range Locales {
+		if t, ok := Plan.Translations[Locale]; ok {
+			return t
+		}
+		Language := strings.ToLower(strings.SplitN(Locale, "-", 2)[0])
+		if t, ok := Plan.Translations[Language]; ok {
+			return t
+		}
+		for l, t := range Plan.Translations {
+			if strings.HasPrefix(strings.ToLower(l), Language+"-") {
+				return t
+			}
+		}
+	}
+
+	return nil
+}
+
+// localizePlans gets copies of the plans with their name and description in the first of the locales
+// they're translated to, leaving plans without a translation as they are
+func localizePlans(Plans []*database.Plan, Locales []string) []*database.Plan {
+	if len(Locales) == 0 {
+		return Plans
+	}
+
+	Localized := make([]*database.Plan, 0, len(Plans))
+	for _, p := range Plans {
+		t := planTranslation(p, Locales)
+		if t == nil {
+			Localized = append(Localized, p)
+			continue
+		}
+		lp := *p
+		lp.PlanName = t.PlanName
+		if t.Description != "" {
+			lp.Description = t.Description
+		}
+		Localized = append(Localized, &lp)
+	}
+
+	return Localized
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+func TestPreferredLocales(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/battle/b1/plans?locale=ru", nil)
+	r.Header.Set("Accept-Language", "de-AT, de;q=0.9, *;q=0.5")
+
+	if got := preferredLocales(r); !reflect.DeepEqual(got, []string{"ru", "de-AT", "de"}) {
+		t.Error("Expected ru, de-AT, de got ", got)
+	}
+}
+
+func TestLocalizePlans(t *testing.T) {
+	plans := []*database.Plan{
+		{PlanName: "Login", Description: "SSO", Translations: map[string]*database.PlanTranslation{
+			"de": {PlanName: "Anmeldung", Description: "Einmalanmeldung"},
+		}},
+		{PlanName: "Logout", Translations: map[string]*database.PlanTranslation{
+			"pt-BR": {PlanName: "Sair"},
+		}},
+	}
+
+	tests := []struct {
+		locales []string
+		names   []string
+	}{
+		{nil, []string{"Login", "Logout"}},
+		{[]string{"de-AT"}, []string{"Anmeldung", "Logout"}},
+		{[]string{"pt"}, []string{"Login", "Sair"}},
+		{[]string{"fr", "de"}, []string{"Anmeldung", "Logout"}},
+	}
+	for _, tt := range tests {
+		localized := localizePlans(plans, tt.locales)
+		for i, p := range localized {
+			if p.PlanName != tt.names[i] {
+				t.Error("Expected ", tt.locales, " to localize plan ", i, " as ", tt.names[i], " got ", p.PlanName)
+			}
+		}
+	}
+
+	if plans[0].PlanName != "Login" || localizePlans(plans, []string{"pt"})[1].Description != "" {
+		t.Error("Expected the plans to be left as they were")
+	}
+}
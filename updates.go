@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/releases"
+)
+
+// versionStatus is the running version compared to the latest release
+type versionStatus struct {
+	CurrentVersion string `json:"currentVersion"`
+	// LatestVersion is empty when the update check is off or failed
+	LatestVersion   string     `json:"latestVersion"`
+	ReleaseURL      string     `json:"releaseUrl"`
+	ReleaseDate     *time.Time `json:"releaseDate"`
+	UpdateAvailable bool       `json:"updateAvailable"`
+	UpdateCheck     bool       `json:"updateCheck"`
+}
+
+// versionStatus compares the running version to the latest release, when the update check is on
+func (s *server) versionStatus() versionStatus {
+	vs := versionStatus{CurrentVersion: s.config.Version, UpdateCheck: s.releases != nil}
+	if s.releases == nil {
+		return vs
+	}
+
+	release, err := s.releases.Latest()
+	if err != nil {
+		log.Println("error checking the latest release : " + err.Error())
+		return vs
+	}
+	vs.LatestVersion = release.Version
+	vs.ReleaseURL = release.URL
+	vs.ReleaseDate = &release.PublishedDate
+	vs.UpdateAvailable = releases.Newer(s.config.Version, release.Version)
+
+	return vs
+}
+
+// handleVersionGet gets the running version and whether an update is available
+func (s *server) handleVersionGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		RespondWithJSON(w, http.StatusOK, s.versionStatus())
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/releases"
+)
+
+func TestHandleVersionGet(t *testing.T) {
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v2.1.0", "html_url": "https://github.com/releases/v2.1.0", "published_at": "2026-10-01T12:00:00Z"}`))
+	}))
+	defer github.Close()
+
+	tests := []struct {
+		version   string
+		check     bool
+		latest    string
+		available bool
+	}{
+		{"v2.0.3", true, "v2.1.0", true},
+		{"v2.1.0", true, "v2.1.0", false},
+		{"dev", true, "v2.1.0", false},
+		{"v2.0.3", false, "", false},
+	}
+	for _, tt := range tests {
+		s, _ := newMockServer()
+		s.config.Version = tt.version
+		if tt.check {
+			s.releases = releases.New(github.URL)
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/admin/version", nil)
+		r.Header.Set(apiKeyHeaderName, "admin1")
+		s.adminOnly(s.handleVersionGet())(w, r)
+
+		var vs versionStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &vs); err != nil || w.Code != http.StatusOK {
+			t.Fatal("Expected the version status got ", w.Code, w.Body.String())
+		}
+		if vs.CurrentVersion != tt.version || vs.LatestVersion != tt.latest || vs.UpdateAvailable != tt.available || vs.UpdateCheck != tt.check {
+			t.Error("Expected ", tt.version, " to compare to ", tt.latest, tt.available, " got ", vs)
+		}
+	}
+}
@@ -61,3 +61,15 @@ func TestGetBoolEnvNonDefault(t *testing.T) {
 		t.Error("Expected true, got ", TestEnv)
 	}
 }
+
+func TestFormatBytes(t *testing.T) {
+	if v := formatBytes(512); v != "512 B" {
+		t.Error("Expected 512 B, got ", v)
+	}
+	if v := formatBytes(1536); v != "1.5 KiB" {
+		t.Error("Expected 1.5 KiB, got ", v)
+	}
+	if v := formatBytes(-3 * 1024 * 1024); v != "-3.0 MiB" {
+		t.Error("Expected -3.0 MiB, got ", v)
+	}
+}
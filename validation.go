@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/de"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/spf13/viper"
+	"gopkg.in/go-playground/validator.v9"
+	en_translations "gopkg.in/go-playground/validator.v9/translations/en"
+)
+
+// validationMessages are a locale's messages for the validate tags the warrior structs use, {0} is the field and
+// {1} the param, or the characters for min and max
+type validationMessages struct {
+	tags map[string]string
+	// characters are how many characters min and max allow, {0} is the count
+	characters map[locales.PluralRule]string
+}
+
+// validationLocales are the messages of the locales besides English, which the validator translates itself
+var validationLocales = map[locales.Translator]validationMessages{
+	de.New(): {
+		tags: map[string]string{
+			"required": "{0} ist ein Pflichtfeld",
+			"email":    "{0} muss eine gültige E-Mail-Adresse sein",
+			"min":      "{0} muss mindestens {1} lang sein",
+			"max":      "{0} darf höchstens {1} lang sein",
+			"eqfield":  "{0} muss gleich {1} sein",
+		},
+		characters: map[locales.PluralRule]string{
+			locales.PluralRuleOne:   "{0} Zeichen",
+			locales.PluralRuleOther: "{0} Zeichen",
+		},
+	},
+	ru.New(): {
+		tags: map[string]string{
+			"required": "Поле {0} обязательно",
+			"email":    "Поле {0} должно содержать корректный адрес электронной почты",
+			"min":      "Поле {0} должно содержать не менее {1}",
+			"max":      "Поле {0} должно содержать не более {1}",
+			"eqfield":  "Поле {0} должно совпадать с {1}",
+		},
+		characters: map[locales.PluralRule]string{
+			locales.PluralRuleOne:   "{0} символа",
+			locales.PluralRuleFew:   "{0} символов",
+			locales.PluralRuleMany:  "{0} символов",
+			locales.PluralRuleOther: "{0} символа",
+		},
+	},
+}
+
+// validate checks the warrior account and password structs, it caches their rules so is shared by all requests
+var validate = validator.New()
+
+// validationTranslator translates the validate errors to the warrior's locale, falling back to English
+var validationTranslator = newValidationTranslator(validate)
+
+// newValidationTranslator registers the English translations the validator comes with and those of validationLocales
+func newValidationTranslator(v *validator.Validate) *ut.UniversalTranslator {
+	English := en.New()
+	Locales := []locales.Translator{English}
+	for l := range validationLocales {
+		Locales = append(Locales, l)
+	}
+	uni := ut.New(English, Locales...)
+
+	trans, _ := uni.GetTranslator(English.Locale())
+	if err := en_translations.RegisterDefaultTranslations(v, trans); err != nil {
+		log.Fatal("failed to register the validation translations ", err)
+	}
+
+	for l, messages := range validationLocales {
+		trans, _ := uni.GetTranslator(l.Locale())
+		for rule, text := range messages.characters {
+			if err := trans.AddCardinal("characters", text, rule, false); err != nil {
+				log.Fatal("failed to register the validation translations ", err)
+			}
+		}
+		for tag, text := range messages.tags {
+			text := text
+			register := func(t ut.Translator) error {
+				return t.Add(tag, text, false)
+			}
+			if err := v.RegisterTranslation(tag, trans, register, translateFieldError); err != nil {
+				log.Fatal("failed to register the validation translations ", err)
+			}
+		}
+	}
+
+	return uni
+}
+
+// translateFieldError translates the field error with its param, counting the characters of min and max
+func translateFieldError(trans ut.Translator, fe validator.FieldError) string {
+	Param := fe.Param()
+	if fe.Tag() == "min" || fe.Tag() == "max" {
+		if count, err := strconv.ParseFloat(Param, 64); err == nil {
+			if characters, err := trans.C("characters", count, 0, trans.FmtNumber(count, 0)); err == nil {
+				Param = characters
+			}
+		}
+	}
+
+	t, err := trans.T(fe.Tag(), fe.Field(), Param)
+	if err != nil {
+		return fe.(error).Error()
+	}
+
+	return t
+}
+
+// requestTranslator finds the validation translator for the request's preferred locales, then the instance's
+// default locale
+func requestTranslator(r *http.Request) ut.Translator {
+	var Languages []string
+	for _, Locale := range append(preferredLocales(r), viper.GetString("config.default_locale")) {
+		// regional locales (de-AT) are given the language's (de) messages
+		Languages = append(Languages, strings.SplitN(strings.Replace(Locale, "_", "-", 1), "-", 2)[0])
+	}
+	trans, _ := validationTranslator.FindTranslator(Languages...)
+
+	return trans
+}
+
+// fieldError is a field that failed validation with its message translated for the warrior
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+// respondInvalid responds to a request with invalid input, explaining a refused name or the fields that failed
+// validation in the warrior's locale
+func respondInvalid(w http.ResponseWriter, r *http.Request, err error) {
+	var invalidName *nameError
+	if errors.As(err, &invalidName) {
+		RespondWithJSON(w, http.StatusBadRequest, invalidName)
+		return
+	}
+
+	var invalidFields validator.ValidationErrors
+	if errors.As(err, &invalidFields) {
+		trans := requestTranslator(r)
+		Fields := make([]fieldError, 0, len(invalidFields))
+		Messages := make([]string, 0, len(invalidFields))
+		for _, fe := range invalidFields {
+			Message := fe.Translate(trans)
+			Fields = append(Fields, fieldError{Field: fe.Field(), Code: fe.Tag(), Message: Message})
+			Messages = append(Messages, Message)
+		}
+		RespondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":  strings.Join(Messages, ", "),
+			"fields": Fields,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+}
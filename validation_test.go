@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRespondInvalid(t *testing.T) {
+	viper.Set("config.default_locale", "de")
+	defer viper.Set("config.default_locale", nil)
+
+	tests := []struct {
+		language  string
+		password1 string
+		password2 string
+		want      string
+	}{
+		{"en-US,en;q=0.9", "secret1", "secret2", "Password2 must be equal to Password1"},
+		{"de-AT", "secret1", "secret2", "Password2 muss gleich Password1 sein"},
+		{"ru", "secret", "abc", "Поле Password2 должно содержать не менее 6 символов"},
+		{"ru", "", "secret" + strings.Repeat("!", 70), "Поле Password1 обязательно, Поле Password2 должно содержать не более 72 символов"},
+		// languages without translations are given the instance's default locale
+		{"fr-FR", "secret1", "", "Password2 ist ein Pflichtfeld"},
+	}
+	for _, tt := range tests {
+		_, err := ValidateWarriorPassword(tt.password1, tt.password2)
+		r := httptest.NewRequest("POST", "/api/auth/reset-password", nil)
+		r.Header.Set("Accept-Language", tt.language)
+		w := httptest.NewRecorder()
+		respondInvalid(w, r, err)
+
+		var invalid struct {
+			Message string       `json:"error"`
+			Fields  []fieldError `json:"fields"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &invalid)
+		if w.Code != http.StatusBadRequest || invalid.Message != tt.want || len(invalid.Fields) == 0 {
+			t.Errorf("Expected %s to be told %q got %d %s", tt.language, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
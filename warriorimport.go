@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+// maxWarriorImportRows is the most warriors a single import creates, a department at a time
+const maxWarriorImportRows = 1000
+
+// warriorImportRow is a warrior to create from a line of the import
+type warriorImportRow struct {
+	Line  int
+	Name  string
+	Email string
+	Role  string
+}
+
+// warriorImportResult is what came of a line of the import
+type warriorImportResult struct {
+	Line      int    `json:"line"`
+	Email     string `json:"email"`
+	WarriorID string `json:"warriorId,omitempty"`
+	Invited   bool   `json:"invited"`
+	Error     string `json:"error,omitempty"`
+}
+
+// warriorImport is the outcome of an import, a line failing doesn't stop the others
+type warriorImport struct {
+	Created int                    `json:"created"`
+	Failed  int                    `json:"failed"`
+	Results []*warriorImportResult `json:"results"`
+}
+
+// parseWarriorImport reads the warriors from a CSV with a header row naming the name, email and optional role
+// columns, in any order and case
+func parseWarriorImport(r io.Reader) ([]*warriorImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("missing header row")
+	}
+	columns := map[string]int{"name": -1, "email": -1, "role": -1}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if _, ok := columns[column]; ok {
+			columns[column] = i
+		}
+	}
+	if columns["name"] == -1 || columns["email"] == -1 {
+		return nil, errors.New("header row needs name and email columns")
+	}
+
+	field := func(record []string, column string) string {
+		i := columns[column]
+		if i == -1 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows = make([]*warriorImportRow, 0)
+	// lines are counted by record, the header being line 1
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := &warriorImportRow{
+			Line:  line,
+			Name:  field(record, "name"),
+			Email: field(record, "email"),
+			Role:  field(record, "role"),
+		}
+		if row.Name == "" && row.Email == "" {
+			continue
+		}
+		if len(rows) == maxWarriorImportRows {
+			return nil, errors.New("too many rows")
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// importWarrior creates the warrior of the row giving them its role, roles being CORPORAL (or empty) for a
+// registered warrior, GENERAL for an admin or the name of a custom role
+func (s *server) importWarrior(row *warriorImportRow, Roles map[string]string) (*database.Warrior, error) {
+	Role := strings.ToLower(row.Role)
+	RoleID, customRole := Roles[Role]
+	if Role != "" && Role != "corporal" && Role != "general" && !customRole {
+		return nil, errors.New("unknown role")
+	}
+
+	Name, _, _, err := ValidateWarriorAccount(row.Name, row.Email, "placeholder", "placeholder")
+	if err != nil {
+		return nil, errors.New("invalid name or email")
+	}
+
+	if err := s.licenseAllows(database.LicenseWarriors); err != nil {
+		return nil, err
+	}
+
+	Warrior, err := s.database.CreateInvitedWarrior(Name, row.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case Role == "general":
+		if err := s.database.PromoteWarrior(Warrior.WarriorID); err != nil {
+			return Warrior, err
+		}
+		Warrior.WarriorRank = "GENERAL"
+	case customRole:
+		if err := s.database.AssignWarriorRole(RoleID, Warrior.WarriorID); err != nil {
+			return Warrior, err
+		}
+	}
+
+	return Warrior, nil
+}
+
+// handleWarriorImport handles an admin creating warriors in bulk from a CSV body of name, email and role,
+// with ?invite=true emailing each a link to set their password
+func (s *server) handleWarriorImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Invite := r.URL.Query().Get("invite") == "true"
+
+		rows, err := parseWarriorImport(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		Roles := make(map[string]string)
+		CustomRoles, err := s.database.GetRoles()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, Role := range CustomRoles {
+			Roles[strings.ToLower(Role.Name)] = Role.RoleID
+		}
+
+		type invite struct {
+			Name     string
+			Email    string
+			InviteID string
+		}
+		var invites []invite
+		Import := &warriorImport{Results: make([]*warriorImportResult, 0, len(rows))}
+		for _, row := range rows {
+			result := &warriorImportResult{Line: row.Line, Email: row.Email}
+			Import.Results = append(Import.Results, result)
+
+			Warrior, err := s.importWarrior(row, Roles)
+			if Warrior != nil {
+				result.WarriorID = Warrior.WarriorID
+				Import.Created++
+			}
+			if err != nil {
+				result.Error = err.Error()
+				Import.Failed++
+				continue
+			}
+
+			if Invite {
+				InviteID, err := s.database.CreateWarriorInvite(Warrior.WarriorID)
+				if err != nil {
+					result.Error = err.Error()
+					Import.Failed++
+					continue
+				}
+				invites = append(invites, invite{Warrior.WarriorName, Warrior.WarriorEmail, InviteID})
+				result.Invited = true
+			}
+		}
+
+		// a department's worth of emails would outlast the request, their deliveries are in the email log
+		if len(invites) > 0 {
+			go func() {
+				for _, i := range invites {
+					s.email.SendInvite(i.Name, i.Email, i.InviteID)
+				}
+			}()
+		}
+
+		RespondWithJSON(w, http.StatusOK, Import)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+// importMock creates warriors by email, refusing emails already taken
+type importMock struct {
+	*database.Mock
+	promoted []string
+	assigned []string
+}
+
+func (m *importMock) GetRoles() ([]*database.Role, error) {
+	return []*database.Role{{RoleID: "r1", Name: "Facilitator"}}, nil
+}
+
+func (m *importMock) CreateInvitedWarrior(WarriorName string, WarriorEmail string) (*database.Warrior, error) {
+	for _, w := range m.Warriors {
+		if w.WarriorEmail == WarriorEmail {
+			return nil, errors.New("a warrior with that email already exists")
+		}
+	}
+	w := &database.Warrior{WarriorID: "new-" + WarriorEmail, WarriorName: WarriorName, WarriorEmail: WarriorEmail, WarriorRank: "CORPORAL"}
+	m.Warriors[w.WarriorID] = w
+	return w, nil
+}
+
+func (m *importMock) PromoteWarrior(WarriorID string) error {
+	m.promoted = append(m.promoted, WarriorID)
+	return nil
+}
+
+func (m *importMock) AssignWarriorRole(RoleID string, WarriorID string) error {
+	m.assigned = append(m.assigned, RoleID+" "+WarriorID)
+	return nil
+}
+
+func TestParseWarriorImport(t *testing.T) {
+	rows, err := parseWarriorImport(strings.NewReader("Email, Name\nthor@example.com,Thor\n\n\"loki@example.com\",\"Loki, of Asgard\"\n"))
+	if err != nil || len(rows) != 2 {
+		t.Fatal("Unexpected rows ", rows, err)
+	}
+	if rows[0].Line != 2 || rows[0].Name != "Thor" || rows[0].Email != "thor@example.com" || rows[0].Role != "" {
+		t.Error("Unexpected row ", rows[0])
+	}
+	if rows[1].Name != "Loki, of Asgard" || rows[1].Email != "loki@example.com" {
+		t.Error("Unexpected row ", rows[1])
+	}
+
+	for _, body := range []string{"", "name,role\nThor,GENERAL\n"} {
+		if _, err := parseWarriorImport(strings.NewReader(body)); err == nil {
+			t.Error("Expected ", body, " to be refused")
+		}
+	}
+}
+
+func TestHandleWarriorImport(t *testing.T) {
+	s, db := newMockServer()
+	db.Warriors["w1"].WarriorEmail = "thor@example.com"
+	mock := &importMock{Mock: db}
+	s.database = mock
+
+	body := "name,email,role\n" +
+		"Thor,thor@example.com,\n" +
+		"Loki,loki@example.com,general\n" +
+		"Hela,hela@example.com,Facilitator\n" +
+		"Odin,odin@example.com,Allfather\n" +
+		"Frigg,not-an-email,\n" +
+		"Sif,sif@example.com,corporal\n"
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/admin/warriors/import", strings.NewReader(body))
+	s.handleWarriorImport()(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatal("Expected 200 got ", w.Code)
+	}
+	var Import warriorImport
+	if err := json.Unmarshal(w.Body.Bytes(), &Import); err != nil {
+		t.Fatal(err)
+	}
+	if Import.Created != 3 || Import.Failed != 3 || len(Import.Results) != 6 {
+		t.Error("Unexpected import ", Import.Created, Import.Failed, len(Import.Results))
+	}
+	for i, want := range []string{"a warrior with that email already exists", "", "", "unknown role", "invalid name or email", ""} {
+		if Import.Results[i].Error != want || Import.Results[i].Line != i+2 {
+			t.Error("Unexpected result ", i, Import.Results[i])
+		}
+	}
+	if len(mock.promoted) != 1 || mock.promoted[0] != "new-loki@example.com" {
+		t.Error("Unexpected promotions ", mock.promoted)
+	}
+	if len(mock.assigned) != 1 || mock.assigned[0] != "r1 new-hela@example.com" {
+		t.Error("Unexpected role assignments ", mock.assigned)
+	}
+}
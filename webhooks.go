@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/unfurl"
+)
+
+// webhookClient posts webhook payloads, receivers that don't answer in time are retried with the event. Webhook
+// urls are entered by warriors so it only connects to public addresses and doesn't follow redirects
+var webhookClient = unfurl.PublicClient(10 * time.Second)
+
+// webhookEvent is the data webhook templates are executed against
+type webhookEvent struct {
+	ID          int64                  `json:"id"`
+	Type        string                 `json:"type"`
+	BattleID    string                 `json:"battleId"`
+	CreatedDate time.Time              `json:"createdDate"`
+	Payload     map[string]interface{} `json:"payload"`
+}
+
+// webhookFuncs are the functions available to webhook templates
+var webhookFuncs = template.FuncMap{
+	// json encodes a value so strings are quoted and escaped, {{ json .Payload.battleName }}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseWebhookTemplate parses a webhook payload template
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(webhookFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// newWebhookEvent decodes an outbox event for webhooks
+func newWebhookEvent(event *database.OutboxEvent) (*webhookEvent, error) {
+	data := &webhookEvent{
+		ID:          event.ID,
+		Type:        event.EventType,
+		BattleID:    event.BattleID,
+		CreatedDate: event.CreatedDate,
+	}
+	err := json.Unmarshal(event.Payload, &data.Payload)
+
+	return data, err
+}
+
+// renderWebhookPayload renders the body posted to the webhook for the event,
+// the event as JSON when the webhook has no template
+func renderWebhookPayload(hook *database.Webhook, event *database.OutboxEvent) ([]byte, error) {
+	data, err := newWebhookEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if hook.Template == "" {
+		return json.Marshal(data)
+	}
+
+	tmpl, err := parseWebhookTemplate(hook.Template)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, err
+	}
+
+	return body.Bytes(), nil
+}
+
+// webhookSubscribed reports whether the webhook wants events of the type
+func webhookSubscribed(hook *database.Webhook, EventType string) bool {
+	if !hook.Active {
+		return false
+	}
+
+	return len(hook.Events) == 0 || contains(hook.Events, EventType)
+}
+
+// webhookOwnerLeads reports whether a REST hook subscriptions warrior leads the battle of the event,
+// admin webhooks get every battles events
+func webhookOwnerLeads(hook *database.Webhook, event *database.OutboxEvent) bool {
+	if hook.WarriorID == "" {
+		return true
+	}
+
+	var payload struct {
+		LeaderID string `json:"leaderId"`
+	}
+	_ = json.Unmarshal(event.Payload, &payload)
+
+	return payload.LeaderID == hook.WarriorID
+}
+
+// deliverWebhooks posts the event to every subscribed webhook it wasn't delivered to yet, recording each delivery so
+// when one fails only the failed ones get the event again on retry. Receivers should still dedupe on the
+// X-Thunderdome-Delivery header as a delivery may go unrecorded
+func (s *server) deliverWebhooks(event *database.OutboxEvent) error {
+	hooks, err := s.database.GetActiveWebhooks()
+	if err != nil {
+		return err
+	}
+	Delivered, err := s.database.GetWebhookDeliveries(event.ID)
+	if err != nil {
+		return err
+	}
+
+	failed := make([]string, 0)
+	for _, hook := range hooks {
+		if !webhookSubscribed(hook, event.EventType) || !webhookOwnerLeads(hook, event) || contains(Delivered, hook.WebhookID) {
+			continue
+		}
+
+		body, err := renderWebhookPayload(hook, event)
+		if err != nil {
+			// a broken template won't render on retry either
+			log.Printf("unable to render webhook %s payload : %v\n", hook.WebhookID, err)
+			continue
+		}
+
+		req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("invalid webhook %s : %v\n", hook.WebhookID, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Thunderdome-Event", event.EventType)
+		req.Header.Set("X-Thunderdome-Delivery", strconv.FormatInt(event.ID, 10))
+
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			log.Printf("webhook %s failed on event %d : %v\n", hook.WebhookID, event.ID, err)
+			failed = append(failed, hook.Name)
+			continue
+		}
+		resp.Body.Close()
+		// REST hook receivers answer 410 once the subscription is gone on their side
+		if resp.StatusCode == http.StatusGone && hook.WarriorID != "" {
+			_ = s.database.DeleteWarriorWebhook(hook.WarriorID, hook.WebhookID)
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			log.Printf("webhook %s responded %s on event %d\n", hook.WebhookID, resp.Status, event.ID)
+			failed = append(failed, hook.Name)
+			continue
+		}
+		if err := s.database.SetWebhookDelivered(hook.WebhookID, event.ID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("webhooks %s failed", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/StevenWeathers/thunderdome-planning-poker/pkg/database"
+)
+
+var testOutboxEvent = &database.OutboxEvent{
+	ID:        7,
+	EventType: "plan_finalized",
+	BattleID:  "b1",
+	Payload:   []byte(`{"planName":"Login \"form\"","points":"5"}`),
+}
+
+func TestRenderWebhookPayloadDefault(t *testing.T) {
+	body, err := renderWebhookPayload(&database.Webhook{}, testOutboxEvent)
+	expected := `{"id":7,"type":"plan_finalized","battleId":"b1","createdDate":"0001-01-01T00:00:00Z","payload":{"planName":"Login \"form\"","points":"5"}}`
+
+	if err != nil || string(body) != expected {
+		t.Error("Expected ", expected, " got ", string(body), err)
+	}
+}
+
+func TestRenderWebhookPayloadTemplate(t *testing.T) {
+	hook := &database.Webhook{Template: `{"text": {{ json (printf "%s estimated at %s" .Payload.planName .Payload.points) }}, "ref": {{ json .Payload.referenceId }}}`}
+	body, err := renderWebhookPayload(hook, testOutboxEvent)
+	expected := `{"text": "Login \"form\" estimated at 5", "ref": null}`
+
+	if err != nil || string(body) != expected {
+		t.Error("Expected ", expected, " got ", string(body), err)
+	}
+}
+
+func TestWebhookSubscribed(t *testing.T) {
+	if !webhookSubscribed(&database.Webhook{Active: true}, "battle_ended") {
+		t.Error("Expected a webhook without events to get every event")
+	}
+	if webhookSubscribed(&database.Webhook{Active: true, Events: []string{"plan_finalized"}}, "battle_ended") {
+		t.Error("Expected a webhook to only get its events")
+	}
+	if webhookSubscribed(&database.Webhook{Events: []string{"battle_ended"}}, "battle_ended") {
+		t.Error("Expected an inactive webhook to get no events")
+	}
+}
+
+func TestWebhookOwnerLeads(t *testing.T) {
+	event := &database.OutboxEvent{Payload: []byte(`{"leaderId":"w1"}`)}
+
+	if !webhookOwnerLeads(&database.Webhook{}, event) {
+		t.Error("Expected an admin webhook to get every battles events")
+	}
+	if !webhookOwnerLeads(&database.Webhook{WarriorID: "w1"}, event) || webhookOwnerLeads(&database.Webhook{WarriorID: "w2"}, event) {
+		t.Error("Expected a REST hook to only get events of battles its warrior leads")
+	}
+}
+
+// webhookDeliveryMock has the webhooks and records which got which event
+type webhookDeliveryMock struct {
+	*database.Mock
+	hooks     []*database.Webhook
+	delivered map[int64][]string
+}
+
+func (m *webhookDeliveryMock) GetActiveWebhooks() ([]*database.Webhook, error) {
+	return m.hooks, nil
+}
+
+func (m *webhookDeliveryMock) GetWebhookDeliveries(EventID int64) ([]string, error) {
+	return m.delivered[EventID], nil
+}
+
+func (m *webhookDeliveryMock) SetWebhookDelivered(WebhookID string, EventID int64) error {
+	m.delivered[EventID] = append(m.delivered[EventID], WebhookID)
+	return nil
+}
+
+func TestDeliverWebhooksRetriesOnlyFailed(t *testing.T) {
+	requests := make(map[string]int)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+	// the receiver is on loopback
+	defer func(c *http.Client) { webhookClient = c }(webhookClient)
+	webhookClient = receiver.Client()
+
+	s, db := newMockServer()
+	s.database = &webhookDeliveryMock{Mock: db, delivered: make(map[int64][]string), hooks: []*database.Webhook{
+		{WebhookID: "wh1", Name: "up", URL: receiver.URL + "/up", Active: true},
+		{WebhookID: "wh2", Name: "down", URL: receiver.URL + "/down", Active: true},
+	}}
+
+	if err := s.deliverWebhooks(testOutboxEvent); err == nil {
+		t.Error("Expected the failed webhook to fail the event")
+	}
+	if err := s.deliverWebhooks(testOutboxEvent); err == nil {
+		t.Error("Expected the failed webhook to fail the retry")
+	}
+	if requests["/up"] != 1 || requests["/down"] != 2 {
+		t.Error("Expected only the failed webhook to get the event again got ", requests)
+	}
+}